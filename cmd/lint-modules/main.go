@@ -0,0 +1,51 @@
+// cmd/lint-modules/main.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/black4ninja/mi-proyecto/pkg/tools"
+)
+
+func main() {
+	strict := flag.Bool("strict", false, "Termina con código 1 si algún módulo tiene marcadores pendientes")
+	flag.Usage = func() {
+		fmt.Println("Uso: go run ./cmd/lint-modules [-strict] [directorio_raiz]")
+		fmt.Printf("Busca en internal/* los comentarios \"%s\" que deja el generador de módulos.\n", tools.ModulePlaceholder)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	root := "."
+	if flag.NArg() > 0 {
+		root = flag.Arg(0)
+	}
+
+	findings, err := tools.FindModulePlaceholders(os.DirFS(root))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(findings) == 0 {
+		fmt.Println("Ningún módulo contiene marcadores pendientes")
+		return
+	}
+
+	for _, f := range findings {
+		lines := make([]string, len(f.Lines))
+		for i, n := range f.Lines {
+			lines[i] = strconv.Itoa(n)
+		}
+		fmt.Printf("%s: líneas %s\n", f.File, strings.Join(lines, ", "))
+	}
+	fmt.Printf("\nMódulos con marcadores pendientes: %s\n", strings.Join(tools.PlaceholderModules(findings), ", "))
+
+	if *strict {
+		os.Exit(1)
+	}
+}
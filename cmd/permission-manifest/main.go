@@ -0,0 +1,192 @@
+// cmd/permission-manifest/main.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	auditDomain "github.com/black4ninja/mi-proyecto/internal/audit/domain"
+	auditRepo "github.com/black4ninja/mi-proyecto/internal/audit/repository"
+	auditUseCase "github.com/black4ninja/mi-proyecto/internal/audit/usecase"
+	permDomain "github.com/black4ninja/mi-proyecto/internal/permission/domain"
+	permRepo "github.com/black4ninja/mi-proyecto/internal/permission/repository"
+	"github.com/black4ninja/mi-proyecto/pkg/tools"
+)
+
+// Códigos de salida del comando diff
+const (
+	exitInSync = 0
+	exitError  = 1
+	exitDrift  = 2
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		showManifestHelp()
+		os.Exit(exitError)
+	}
+
+	switch os.Args[1] {
+	case "diff":
+		// Comparar el manifiesto con la base de datos sin aplicar cambios
+		if len(os.Args) < 3 {
+			fmt.Println("Error: Falta la ruta del manifiesto")
+			fmt.Println("Uso: go run ./cmd/permission-manifest diff <manifiesto.json>")
+			os.Exit(exitError)
+		}
+
+		os.Exit(runDiff(os.Args[2]))
+
+	case "apply":
+		// Crear los permisos y roles del manifiesto que aún no existen
+		if len(os.Args) < 3 {
+			fmt.Println("Error: Falta la ruta del manifiesto")
+			fmt.Println("Uso: go run ./cmd/permission-manifest apply <manifiesto.json>")
+			os.Exit(exitError)
+		}
+
+		os.Exit(runApply(os.Args[2]))
+
+	case "help":
+		showManifestHelp()
+
+	default:
+		fmt.Printf("Comando desconocido: %s\n", os.Args[1])
+		showManifestHelp()
+		os.Exit(exitError)
+	}
+}
+
+// runDiff imprime el diff en JSON por stdout y retorna el código de salida
+func runDiff(manifestPath string) int {
+	manifest, err := tools.LoadPermissionManifest(manifestPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	db, disconnect, err := connectManifestDB()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error al conectar a MongoDB: %v\n", err)
+		return exitError
+	}
+	defer disconnect()
+
+	diff, err := tools.DiffPermissionState(
+		manifest,
+		permRepo.NewMongoPermissionRepository(db.Collection("permissions")),
+		permRepo.NewMongoRoleRepository(db.Collection("roles")),
+	)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(diff); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	if diff.HasDrift() {
+		return exitDrift
+	}
+	return exitInSync
+}
+
+// runApply crea las entradas faltantes del manifiesto e imprime el resultado en JSON
+func runApply(manifestPath string) int {
+	manifest, err := tools.LoadPermissionManifest(manifestPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	db, disconnect, err := connectManifestDB()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error al conectar a MongoDB: %v\n", err)
+		return exitError
+	}
+	defer disconnect()
+
+	result, err := tools.ApplyPermissionManifest(
+		manifest,
+		permRepo.NewMongoPermissionRepository(db.Collection("permissions")),
+		permRepo.NewMongoRoleRepository(db.Collection("roles")),
+		manifestChangeRecorder(db),
+	)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	return exitInSync
+}
+
+// manifestChangeRecorder registra en la auditoría, con el actor "system", las entradas que crea apply
+func manifestChangeRecorder(db *mongo.Database) permDomain.PermissionChangeRecorder {
+	auditLogService := auditUseCase.NewAuditLogUseCase(auditRepo.NewMongoAuditLogRepository(db.Collection("audit_logs")))
+	return permDomain.PermissionChangeRecorderFunc(func(change *permDomain.PermissionChange) error {
+		return auditLogService.Record(&auditDomain.AuditLog{
+			ActorID: change.ActorID,
+			Action:  change.Action,
+			Target:  change.Target,
+			Details: change.Details,
+		})
+	})
+}
+
+// connectManifestDB conecta a la base de datos configurada en el entorno
+func connectManifestDB() (*mongo.Database, func(), error) {
+	if err := godotenv.Load(); err != nil {
+		fmt.Fprintln(os.Stderr, "Archivo .env no encontrado, usando variables de entorno del sistema")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(getEnvManifest("MONGO_URI", "mongodb://localhost:27017")))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	disconnect := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		client.Disconnect(ctx)
+	}
+	return client.Database(getEnvManifest("MONGO_DB", "my_database")), disconnect, nil
+}
+
+func getEnvManifest(key, defaultValue string) string {
+	if value, exists := os.LookupEnv(key); exists {
+		return value
+	}
+	return defaultValue
+}
+
+func showManifestHelp() {
+	fmt.Println("Herramienta de manifiesto de permisos")
+	fmt.Println("Uso: go run ./cmd/permission-manifest <comando> [argumentos]")
+	fmt.Println("")
+	fmt.Println("Comandos disponibles:")
+	fmt.Println("  diff <manifiesto.json>  Compara el manifiesto con la base de datos sin aplicar cambios")
+	fmt.Println("  apply <manifiesto.json> Crea los permisos y roles declarados que aún no existen")
+	fmt.Println("  help                    Muestra esta ayuda")
+	fmt.Println("")
+	fmt.Println("Códigos de salida de diff: 0 sin diferencias, 1 error, 2 diferencias detectadas")
+}
@@ -10,15 +10,21 @@ import (
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Println("Uso: go run cmd/tools/generate_module.go <nombre_del_modulo>")
+		fmt.Println("Uso: go run cmd/tools/generate_module.go <nombre_del_modulo> [directorio_raiz]")
 		os.Exit(1)
 	}
 
 	moduleName := os.Args[1]
 
+	// Directorio raíz opcional para redirigir la salida (por defecto, el directorio actual)
+	writer := tools.OSModuleWriter{}
+	if len(os.Args) > 2 {
+		writer.Root = os.Args[2]
+	}
+
 	fmt.Printf("Generando módulo: %s\n", moduleName)
 
-	if err := tools.GenerateModule(moduleName); err != nil {
+	if err := tools.GenerateModuleTo(moduleName, writer); err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,195 @@
+package delivery
+
+import (
+	"encoding/csv"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/black4ninja/mi-proyecto/internal/audit/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// exportFlushEvery es el número de filas tras el cual se envía al cliente lo escrito hasta el momento
+const exportFlushEvery = 500
+
+// exportHeader son las columnas del CSV exportado, en orden
+var exportHeader = []string{"id", "created_at", "actor_id", "action", "target", "details"}
+
+// auditLogFilterConfig define los campos del registro de auditoría que pueden filtrarse
+var auditLogFilterConfig = utils.FilterConfig{
+	"actor_id": utils.FilterDefinition{
+		Validator:  func(s string) bool { return len(s) <= 100 },
+		MultiValue: true,
+	},
+	"action": utils.FilterDefinition{
+		Validator:  func(s string) bool { return len(s) <= 100 },
+		MultiValue: true,
+	},
+	"target": utils.FilterDefinition{
+		Validator: func(s string) bool { return len(s) <= 200 },
+	},
+}
+
+// AuditHandler maneja las peticiones HTTP del registro de auditoría
+type AuditHandler struct {
+	auditUseCase domain.AuditLogUseCase
+	paginator    *utils.Paginator
+}
+
+// NewAuditHandler registra las rutas del registro de auditoría.
+// El grupo recibido debe estar protegido con un permiso administrativo (ej. admin:audit).
+// Si paginator es nil se usan los tamaños de página por defecto.
+func NewAuditHandler(router *gin.RouterGroup, useCase domain.AuditLogUseCase, paginator *utils.Paginator) {
+	if paginator == nil {
+		paginator = utils.NewPaginator(utils.DefaultPageSize, utils.DefaultMaxSize)
+	}
+	handler := &AuditHandler{
+		auditUseCase: useCase,
+		paginator:    paginator,
+	}
+
+	router.GET("", handler.GetLogs)
+	router.GET("/export", handler.ExportCSV)
+}
+
+// @Summary Listar el registro de auditoría
+// @Description Obtiene una página de entradas de auditoría, las más recientes primero, con los mismos filtros que la exportación (solo administradores)
+// @Tags auditoría
+// @Produce json
+// @Param actor_id query string false "Usuarios que realizaron la acción, separados por coma"
+// @Param action query string false "Acciones separadas por coma"
+// @Param target query string false "Recurso afectado"
+// @Param created_from query string false "Fecha desde (formato ISO8601)"
+// @Param created_to query string false "Fecha hasta (formato ISO8601)"
+// @Param page query int false "Página (desde 1)"
+// @Param limit query int false "Tamaño de página (se reduce al máximo configurado)"
+// @Success 200 {object} utils.Response{data=[]domain.AuditLogResponse,pagination=utils.PaginationMeta} "Entradas de auditoría"
+// @Failure 500 {object} utils.Response "Error interno"
+// @Router /audit-logs [get]
+// @Security BearerAuth
+func (h *AuditHandler) GetLogs(c *gin.Context) {
+	filter := buildAuditFilter(c)
+
+	page := h.paginator.Parse(c)
+	entries, total, err := h.auditUseCase.GetLogsPage(filter, page.Skip(), int64(page.Limit))
+	if err != nil {
+		utils.InternalErrorResponse(c)
+		return
+	}
+
+	response := make([]*domain.AuditLogResponse, len(entries))
+	for i, entry := range entries {
+		response[i] = auditLogResponse(entry)
+	}
+	utils.PaginatedResponse(c, http.StatusOK, "Registro de auditoría obtenido con éxito", response, h.paginator.Meta(page, total))
+}
+
+// auditLogResponse convierte una entrada al formato de la API, con las fechas en TimestampLayout
+func auditLogResponse(entry *domain.AuditLog) *domain.AuditLogResponse {
+	return &domain.AuditLogResponse{
+		ID:        entry.ID.Hex(),
+		ActorID:   entry.ActorID,
+		Action:    entry.Action,
+		Target:    entry.Target,
+		Details:   entry.Details,
+		CreatedAt: utils.NewTimestamp(entry.CreatedAt),
+	}
+}
+
+// @Summary Exportar el registro de auditoría
+// @Description Descarga en CSV las entradas de auditoría que coincidan con los filtros (solo administradores)
+// @Tags auditoría
+// @Produce text/csv
+// @Param actor_id query string false "Usuarios que realizaron la acción, separados por coma"
+// @Param action query string false "Acciones separadas por coma"
+// @Param target query string false "Recurso afectado"
+// @Param created_from query string false "Fecha desde (formato ISO8601)"
+// @Param created_to query string false "Fecha hasta (formato ISO8601)"
+// @Success 200 {string} string "CSV con fila de encabezado"
+// @Failure 500 {object} utils.Response "Error interno"
+// @Router /audit-logs/export [get]
+// @Security BearerAuth
+func (h *AuditHandler) ExportCSV(c *gin.Context) {
+	filter := buildAuditFilter(c)
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="audit-logs.csv"`)
+
+	writer := csv.NewWriter(c.Writer)
+	if err := writer.Write(exportHeader); err != nil {
+		utils.InternalErrorResponse(c)
+		return
+	}
+
+	rows := 0
+	err := h.auditUseCase.StreamLogs(filter, func(entry *domain.AuditLog) error {
+		if err := writer.Write([]string{
+			entry.ID.Hex(),
+			entry.CreatedAt.UTC().Format(time.RFC3339),
+			csvCell(entry.ActorID),
+			csvCell(entry.Action),
+			csvCell(entry.Target),
+			csvCell(entry.Details),
+		}); err != nil {
+			return err
+		}
+
+		rows++
+		if rows%exportFlushEvery == 0 {
+			writer.Flush()
+			c.Writer.Flush()
+			return writer.Error()
+		}
+		return nil
+	})
+
+	if err != nil {
+		// Si aún no se envió nada al cliente, se responde con un error normal;
+		// de lo contrario el estado 200 ya fue enviado y el CSV queda truncado
+		if !c.Writer.Written() {
+			c.Writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			c.Writer.Header().Del("Content-Disposition")
+			utils.InternalErrorResponse(c)
+			return
+		}
+		log.Printf("[WARN] exportación de auditoría interrumpida rows=%d error=%v", rows, err)
+		return
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Printf("[WARN] exportación de auditoría interrumpida rows=%d error=%v", rows, err)
+	}
+}
+
+// csvCell antepone ' a los valores que una hoja de cálculo interpretaría como fórmula (los que
+// comienzan con =, +, -, @, tabulación o retorno de carro), para que abrir la exportación no
+// ejecute contenido controlado por quien generó la entrada de auditoría
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// buildAuditFilter construye el filtro de MongoDB a partir de los parámetros de consulta
+func buildAuditFilter(c *gin.Context) map[string]interface{} {
+	queryParams := make(map[string]string)
+	for param := range auditLogFilterConfig {
+		if values := c.QueryArray(param); len(values) > 0 {
+			queryParams[param] = strings.Join(values, ",")
+		}
+	}
+
+	filter := utils.BuildMongoFilter(queryParams, auditLogFilterConfig)
+
+	if dateRange := utils.DateRangeFilter(c.Query("created_from"), c.Query("created_to")); dateRange != nil {
+		filter["created_at"] = dateRange
+	}
+
+	return filter
+}
@@ -0,0 +1,172 @@
+package delivery_test
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/black4ninja/mi-proyecto/internal/audit/delivery"
+	"github.com/black4ninja/mi-proyecto/internal/audit/domain"
+)
+
+// MockAuditLogUseCase simula el caso de uso de auditoría; StreamLogs entrega
+// las entradas configuradas en entries antes de retornar el error simulado
+type MockAuditLogUseCase struct {
+	mock.Mock
+	entries []*domain.AuditLog
+}
+
+func (m *MockAuditLogUseCase) Record(entry *domain.AuditLog) error {
+	return m.Called(entry).Error(0)
+}
+
+func (m *MockAuditLogUseCase) StreamLogs(filter map[string]interface{}, fn func(entry *domain.AuditLog) error) error {
+	args := m.Called(filter)
+	for _, entry := range m.entries {
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return args.Error(0)
+}
+
+func (m *MockAuditLogUseCase) GetLogsPage(filter map[string]interface{}, skip, limit int64) ([]*domain.AuditLog, int64, error) {
+	args := m.Called(filter, skip, limit)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]*domain.AuditLog), args.Get(1).(int64), args.Error(2)
+}
+
+func setupAuditRouter(useCase domain.AuditLogUseCase) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	delivery.NewAuditHandler(r.Group("/api/audit"), useCase, nil)
+	return r
+}
+
+func TestGetLogs(t *testing.T) {
+	t.Run("filtra y pagina", func(t *testing.T) {
+		entries := []*domain.AuditLog{
+			{ID: primitive.NewObjectID(), ActorID: "admin-1", Action: "role.assign", Target: "user:7", Details: "role=rol-1",
+				CreatedAt: time.Date(2024, 3, 2, 9, 30, 0, 0, time.FixedZone("CST", -6*3600))},
+		}
+		mockUseCase := &MockAuditLogUseCase{}
+		mockUseCase.On("GetLogsPage", map[string]interface{}{
+			"target":     "user:7",
+			"created_at": bson.M{"$gte": time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		}, int64(10), int64(10)).Return(entries, int64(11), nil)
+
+		req, _ := http.NewRequest("GET", "/api/audit?target=user:7&created_from=2024-03-01T00:00:00Z&page=2&limit=10", nil)
+		w := httptest.NewRecorder()
+		setupAuditRouter(mockUseCase).ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Data []struct {
+				ID        string `json:"id"`
+				Action    string `json:"action"`
+				CreatedAt string `json:"created_at"`
+			} `json:"data"`
+			Meta struct {
+				Total int64 `json:"total"`
+			} `json:"pagination"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Data, 1)
+		assert.Equal(t, entries[0].ID.Hex(), response.Data[0].ID)
+		assert.Equal(t, "role.assign", response.Data[0].Action)
+		assert.Equal(t, "2024-03-02T15:30:00.000Z", response.Data[0].CreatedAt, "las fechas usan utils.TimestampLayout en UTC")
+		assert.Equal(t, int64(11), response.Meta.Total)
+		mockUseCase.AssertExpectations(t)
+	})
+
+	t.Run("error interno", func(t *testing.T) {
+		mockUseCase := &MockAuditLogUseCase{}
+		mockUseCase.On("GetLogsPage", mock.Anything, mock.Anything, mock.Anything).Return(nil, int64(0), errors.New("sin conexión"))
+
+		req, _ := http.NewRequest("GET", "/api/audit", nil)
+		w := httptest.NewRecorder()
+		setupAuditRouter(mockUseCase).ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
+
+func TestExportCSV(t *testing.T) {
+	createdAt := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	entries := []*domain.AuditLog{
+		{ID: primitive.NewObjectID(), ActorID: "admin-1", Action: "role.assign", Target: "user-7", CreatedAt: createdAt},
+		// Comas, comillas y saltos de línea deben quedar escapados
+		{ID: primitive.NewObjectID(), ActorID: "admin-1", Action: "role.delete", Target: "role-3", Details: "nombre: \"Soporte, nivel 2\"\nsin usuarios", CreatedAt: createdAt.Add(time.Minute)},
+		// Los valores que empiezan como una fórmula se neutralizan
+		{ID: primitive.NewObjectID(), ActorID: "admin-1", Action: "role.create", Target: "=HYPERLINK(\"http://x\")", Details: "@SUM(A1)", CreatedAt: createdAt.Add(2 * time.Minute)},
+	}
+
+	mockUseCase := &MockAuditLogUseCase{entries: entries}
+	mockUseCase.On("StreamLogs", map[string]interface{}{
+		"actor_id":   "admin-1",
+		"created_at": bson.M{"$gte": createdAt},
+	}).Return(nil)
+
+	req, _ := http.NewRequest("GET", "/api/audit/export?actor_id=admin-1&created_from=2024-03-01T12:30:00Z&ignorado=x", nil)
+	w := httptest.NewRecorder()
+	setupAuditRouter(mockUseCase).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "audit-logs.csv")
+
+	records, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	assert.Equal(t, []string{"id", "created_at", "actor_id", "action", "target", "details"}, records[0])
+	assert.Equal(t, []string{entries[0].ID.Hex(), "2024-03-01T12:30:00Z", "admin-1", "role.assign", "user-7", ""}, records[1])
+	assert.Equal(t, entries[1].Details, records[2][5])
+	assert.Equal(t, "'=HYPERLINK(\"http://x\")", records[3][4])
+	assert.Equal(t, "'@SUM(A1)", records[3][5])
+
+	mockUseCase.AssertExpectations(t)
+}
+
+func TestExportCSVEmpty(t *testing.T) {
+	mockUseCase := &MockAuditLogUseCase{}
+	mockUseCase.On("StreamLogs", map[string]interface{}{}).Return(nil)
+
+	req, _ := http.NewRequest("GET", "/api/audit/export", nil)
+	w := httptest.NewRecorder()
+	setupAuditRouter(mockUseCase).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "id,created_at,actor_id,action,target,details\n", w.Body.String())
+}
+
+func TestExportCSVErrorBeforeOutput(t *testing.T) {
+	mockUseCase := &MockAuditLogUseCase{}
+	mockUseCase.On("StreamLogs", mock.Anything).Return(errors.New("sin conexión"))
+
+	req, _ := http.NewRequest("GET", "/api/audit/export", nil)
+	w := httptest.NewRecorder()
+	setupAuditRouter(mockUseCase).ServeHTTP(w, req)
+
+	// Nada se envió aún al cliente: se responde con el error estándar en JSON
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+	assert.Empty(t, w.Header().Get("Content-Disposition"))
+
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "error", response["status"])
+}
@@ -0,0 +1,44 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// AuditLog representa una entrada del registro de auditoría
+// @Description Acción registrada para revisión de cumplimiento
+type AuditLog struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`                    // ID único de la entrada
+	ActorID   string             `json:"actor_id" bson:"actor_id"`                   // Usuario que realizó la acción
+	Action    string             `json:"action" bson:"action" example:"role.assign"` // Acción realizada
+	Target    string             `json:"target" bson:"target"`                       // Recurso afectado (ej. usuario o rol)
+	Details   string             `json:"details,omitempty" bson:"details,omitempty"` // Información adicional opcional
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`               // Momento en que ocurrió la acción
+}
+
+// AuditLogResponse representa una entrada de auditoría en las respuestas de la API
+type AuditLogResponse struct {
+	ID        string          `json:"id"`
+	ActorID   string          `json:"actor_id"`
+	Action    string          `json:"action" example:"role.assign"`
+	Target    string          `json:"target"`
+	Details   string          `json:"details,omitempty"`
+	CreatedAt utils.Timestamp `json:"created_at" swaggertype:"string" format:"date-time" example:"2023-07-10T15:04:05.000Z"`
+}
+
+// AuditLogRepository define el contrato para la capa de persistencia
+type AuditLogRepository interface {
+	Create(entry *AuditLog) error
+	ForEach(filter map[string]interface{}, fn func(entry *AuditLog) error) error          // Recorre las entradas con un cursor, en orden cronológico
+	GetPage(filter map[string]interface{}, skip, limit int64) ([]*AuditLog, int64, error) // Página de entradas, las más recientes primero, y el total
+}
+
+// AuditLogUseCase define el contrato para la capa de casos de uso
+type AuditLogUseCase interface {
+	Record(entry *AuditLog) error
+	StreamLogs(filter map[string]interface{}, fn func(entry *AuditLog) error) error
+	GetLogsPage(filter map[string]interface{}, skip, limit int64) ([]*AuditLog, int64, error)
+}
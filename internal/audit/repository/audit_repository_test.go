@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/black4ninja/mi-proyecto/internal/audit/domain"
+)
+
+func TestAuditLogGetPage(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("las más recientes primero con el total", func(mt *mtest.T) {
+		repo := NewMongoAuditLogRepository(mt.Coll)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "n", Value: int32(3)}}),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "action", Value: "role.delete"}},
+			),
+		)
+
+		entries, total, err := repo.GetPage(map[string]interface{}{"actor_id": "admin-1"}, 2, 2)
+		require.NoError(mt, err)
+		assert.Equal(mt, int64(3), total)
+		require.Len(mt, entries, 1)
+		assert.Equal(mt, "role.delete", entries[0].Action)
+
+		var find bson.Raw
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName == "find" {
+				find = event.Command
+			}
+		}
+		require.NotNil(mt, find)
+		assert.Equal(mt, "admin-1", find.Lookup("filter", "actor_id").StringValue())
+		assert.Equal(mt, int32(-1), find.Lookup("sort", "created_at").Int32())
+		assert.Equal(mt, int64(2), find.Lookup("skip").Int64())
+	})
+
+	mt.Run("sin coincidencias retorna una lista vacía", func(mt *mtest.T) {
+		repo := NewMongoAuditLogRepository(mt.Coll)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "n", Value: int32(0)}}),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch),
+		)
+
+		entries, total, err := repo.GetPage(nil, 0, 20)
+		require.NoError(mt, err)
+		assert.Zero(mt, total)
+		assert.NotNil(mt, entries)
+		assert.Empty(mt, entries)
+	})
+}
+
+func TestAuditLogForEach(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("recorre todos los lotes del cursor", func(mt *mtest.T) {
+		repo := NewMongoAuditLogRepository(mt.Coll)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		entry := func(action string) bson.D {
+			return bson.D{
+				{Key: "_id", Value: primitive.NewObjectID()},
+				{Key: "actor_id", Value: "admin-1"},
+				{Key: "action", Value: action},
+				{Key: "created_at", Value: time.Now()},
+			}
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, ns, mtest.FirstBatch, entry("role.assign"), entry("role.remove")),
+			mtest.CreateCursorResponse(0, ns, mtest.NextBatch, entry("role.delete")),
+		)
+
+		var actions []string
+		err := repo.ForEach(map[string]interface{}{"actor_id": "admin-1"}, func(entry *domain.AuditLog) error {
+			actions = append(actions, entry.Action)
+			return nil
+		})
+		require.NoError(mt, err)
+		assert.Equal(mt, []string{"role.assign", "role.remove", "role.delete"}, actions)
+	})
+
+	mt.Run("se detiene cuando fn retorna un error", func(mt *mtest.T) {
+		repo := NewMongoAuditLogRepository(mt.Coll)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch,
+			bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "action", Value: "role.assign"}},
+			bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "action", Value: "role.remove"}},
+		))
+
+		calls := 0
+		stop := assert.AnError
+		err := repo.ForEach(nil, func(entry *domain.AuditLog) error {
+			calls++
+			return stop
+		})
+		assert.ErrorIs(mt, err, stop)
+		assert.Equal(mt, 1, calls)
+	})
+}
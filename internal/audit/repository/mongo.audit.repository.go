@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/black4ninja/mi-proyecto/internal/audit/domain"
+)
+
+type mongoAuditLogRepository struct {
+	collection    *mongo.Collection
+	timeout       time.Duration
+	streamTimeout time.Duration // Límite para recorridos completos (exportaciones)
+}
+
+// NewMongoAuditLogRepository crea un nuevo repositorio de auditoría con MongoDB
+func NewMongoAuditLogRepository(collection *mongo.Collection) domain.AuditLogRepository {
+	return &mongoAuditLogRepository{
+		collection:    collection,
+		timeout:       10 * time.Second,
+		streamTimeout: 5 * time.Minute,
+	}
+}
+
+// Create registra una nueva entrada de auditoría
+func (r *mongoAuditLogRepository) Create(entry *domain.AuditLog) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	entry.ID = primitive.NewObjectID()
+
+	_, err := r.collection.InsertOne(ctx, entry)
+	return err
+}
+
+// GetPage obtiene una página de entradas que coincidan con el filtro, las más recientes primero,
+// y el total de coincidencias
+func (r *mongoAuditLogRepository) GetPage(filter map[string]interface{}, skip, limit int64) ([]*domain.AuditLog, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	query := bson.M{}
+	for key, value := range filter {
+		query[key] = value
+	}
+
+	total, err := r.collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).SetSkip(skip).SetLimit(limit)
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	// Siempre se retorna una lista (posiblemente vacía) para que se serialice como [] y no como null
+	entries := []*domain.AuditLog{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, 0, err
+	}
+
+	return entries, total, nil
+}
+
+// ForEach recorre las entradas que coincidan con el filtro en orden cronológico, llamando a fn por cada una.
+// Las entradas se decodifican de una en una desde el cursor, por lo que la memoria no depende del total.
+// Si fn retorna un error, el recorrido se detiene y se retorna ese error.
+func (r *mongoAuditLogRepository) ForEach(filter map[string]interface{}, fn func(entry *domain.AuditLog) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.streamTimeout)
+	defer cancel()
+
+	query := bson.M{}
+	for key, value := range filter {
+		query[key] = value
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var entry domain.AuditLog
+		if err := cursor.Decode(&entry); err != nil {
+			return err
+		}
+		if err := fn(&entry); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
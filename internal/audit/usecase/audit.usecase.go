@@ -0,0 +1,43 @@
+package usecase
+
+import (
+	"fmt"
+
+	"github.com/black4ninja/mi-proyecto/internal/audit/domain"
+)
+
+type auditLogUseCase struct {
+	auditRepo domain.AuditLogRepository
+}
+
+// NewAuditLogUseCase crea un nuevo caso de uso para el registro de auditoría
+func NewAuditLogUseCase(auditRepo domain.AuditLogRepository) domain.AuditLogUseCase {
+	return &auditLogUseCase{
+		auditRepo: auditRepo,
+	}
+}
+
+// Record guarda una entrada en el registro de auditoría
+func (u *auditLogUseCase) Record(entry *domain.AuditLog) error {
+	if err := u.auditRepo.Create(entry); err != nil {
+		return fmt.Errorf("registrar auditoría %s: %w", entry.Action, err)
+	}
+	return nil
+}
+
+// GetLogsPage obtiene una página de entradas, las más recientes primero, y el total de coincidencias
+func (u *auditLogUseCase) GetLogsPage(filter map[string]interface{}, skip, limit int64) ([]*domain.AuditLog, int64, error) {
+	entries, total, err := u.auditRepo.GetPage(filter, skip, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("listar registro de auditoría: %w", err)
+	}
+	return entries, total, nil
+}
+
+// StreamLogs recorre las entradas que coincidan con el filtro sin cargarlas todas en memoria
+func (u *auditLogUseCase) StreamLogs(filter map[string]interface{}, fn func(entry *domain.AuditLog) error) error {
+	if err := u.auditRepo.ForEach(filter, fn); err != nil {
+		return fmt.Errorf("recorrer registro de auditoría: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package delivery
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/black4ninja/mi-proyecto/internal/oauth/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// APIKeyHandler maneja las peticiones HTTP de administración de API keys
+type APIKeyHandler struct {
+	apiKeyUseCase domain.APIKeyUseCase
+}
+
+// NewAPIKeyAdminHandler registra las rutas de administración de API keys.
+// El grupo recibido debe estar protegido con un permiso administrativo (ej. admin:api-keys).
+func NewAPIKeyAdminHandler(router *gin.RouterGroup, useCase domain.APIKeyUseCase) {
+	handler := &APIKeyHandler{
+		apiKeyUseCase: useCase,
+	}
+
+	router.POST("/api-keys", handler.CreateAPIKey)
+	router.GET("/api-keys", handler.GetAPIKeys)
+	router.DELETE("/api-keys/:id", handler.RevokeAPIKey)
+}
+
+// CreateAPIKey manejador para generar una API key. La clave solo se incluye en esta respuesta.
+// Una API key no puede generar otras: se exige un usuario autenticado con token OAuth.
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	if _, viaAPIKey := c.Get(utils.APIKeyIDContextKey); viaAPIKey {
+		utils.ErrorResponse(c, http.StatusForbidden, "Las API keys no pueden generar otras API keys")
+		return
+	}
+
+	userID, ok := utils.MustUserID(c)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "No autenticado")
+		return
+	}
+
+	var req domain.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	apiKey, err := h.apiKeyUseCase.CreateAPIKey(userID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrInvalidAPIKeyExpiry), errors.Is(err, domain.ErrUnknownAPIKeyPermission):
+			utils.UnprocessableEntityResponse(c, err.Error())
+			return
+		case errors.Is(err, domain.ErrAPIKeyPermissionNotHeld):
+			utils.ErrorResponse(c, http.StatusForbidden, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al generar la API key")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "API key generada con éxito; guárdela, no volverá a mostrarse", apiKey)
+}
+
+// GetAPIKeys manejador que lista las API keys sin sus claves
+func (h *APIKeyHandler) GetAPIKeys(c *gin.Context) {
+	apiKeys, err := h.apiKeyUseCase.GetAPIKeys()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al obtener las API keys")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "API keys obtenidas con éxito", apiKeys)
+}
+
+// RevokeAPIKey manejador para revocar una API key
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	revoked, err := h.apiKeyUseCase.RevokeAPIKey(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidAPIKeyID) {
+			utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al revocar la API key")
+		return
+	}
+	if !revoked {
+		utils.ErrorResponse(c, http.StatusNotFound, "No existe una API key activa con ese ID")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "API key revocada con éxito", nil)
+}
@@ -0,0 +1,145 @@
+package delivery_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/black4ninja/mi-proyecto/internal/oauth/delivery"
+	"github.com/black4ninja/mi-proyecto/internal/oauth/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// MockAPIKeyUseCase simula el caso de uso de API keys; los métodos no
+// implementados entran en pánico a través de la interfaz embebida
+type MockAPIKeyUseCase struct {
+	domain.APIKeyUseCase
+	mock.Mock
+}
+
+func (m *MockAPIKeyUseCase) CreateAPIKey(createdBy string, req *domain.CreateAPIKeyRequest) (*domain.CreateAPIKeyResponse, error) {
+	args := m.Called(createdBy, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.CreateAPIKeyResponse), args.Error(1)
+}
+
+func (m *MockAPIKeyUseCase) RevokeAPIKey(id string) (bool, error) {
+	args := m.Called(id)
+	return args.Bool(0), args.Error(1)
+}
+
+// newAPIKeyRouter monta el manejador con la identidad que establecería el middleware de autenticación
+func newAPIKeyRouter(useCase domain.APIKeyUseCase, identity map[string]interface{}) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	group := r.Group("/oauth", func(c *gin.Context) {
+		for key, value := range identity {
+			c.Set(key, value)
+		}
+		c.Next()
+	})
+	delivery.NewAPIKeyAdminHandler(group, useCase)
+	return r
+}
+
+func TestCreateAPIKeyHandler(t *testing.T) {
+	body := `{"name": "ERP", "scopes": ["read"]}`
+
+	t.Run("usuario administrador", func(t *testing.T) {
+		useCase := new(MockAPIKeyUseCase)
+		useCase.On("CreateAPIKey", "admin-1", &domain.CreateAPIKeyRequest{Name: "ERP", Scopes: []string{"read"}}).
+			Return(&domain.CreateAPIKeyResponse{Key: "ak_nueva"}, nil)
+		r := newAPIKeyRouter(useCase, map[string]interface{}{utils.UserIDContextKey: "admin-1"})
+
+		req, _ := http.NewRequest("POST", "/oauth/api-keys", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"key":"ak_nueva"`)
+		useCase.AssertExpectations(t)
+	})
+
+	t.Run("autenticado con API key", func(t *testing.T) {
+		useCase := new(MockAPIKeyUseCase)
+		r := newAPIKeyRouter(useCase, map[string]interface{}{
+			utils.UserIDContextKey:   "apikey:123",
+			utils.APIKeyIDContextKey: "123",
+		})
+
+		req, _ := http.NewRequest("POST", "/oauth/api-keys", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		useCase.AssertNotCalled(t, "CreateAPIKey", mock.Anything, mock.Anything)
+	})
+
+	t.Run("vencimiento pasado", func(t *testing.T) {
+		useCase := new(MockAPIKeyUseCase)
+		useCase.On("CreateAPIKey", "admin-1", mock.AnythingOfType("*domain.CreateAPIKeyRequest")).
+			Return(nil, domain.ErrInvalidAPIKeyExpiry)
+		r := newAPIKeyRouter(useCase, map[string]interface{}{utils.UserIDContextKey: "admin-1"})
+
+		req, _ := http.NewRequest("POST", "/oauth/api-keys", strings.NewReader(`{"name": "ERP", "expires_at": "2020-01-01T00:00:00Z"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), domain.ErrInvalidAPIKeyExpiry.Error())
+		sent := useCase.Calls[0].Arguments.Get(1).(*domain.CreateAPIKeyRequest)
+		if assert.NotNil(t, sent.ExpiresAt) {
+			assert.Equal(t, 2020, sent.ExpiresAt.Year())
+		}
+		useCase.AssertExpectations(t)
+	})
+}
+
+func TestCreateAPIKeyPermissionErrors(t *testing.T) {
+	for err, want := range map[error]int{
+		fmt.Errorf("%w: admin:users", domain.ErrAPIKeyPermissionNotHeld): http.StatusForbidden,
+		fmt.Errorf("%w: x:y", domain.ErrUnknownAPIKeyPermission):         http.StatusUnprocessableEntity,
+	} {
+		useCase := new(MockAPIKeyUseCase)
+		useCase.On("CreateAPIKey", "admin-1", mock.AnythingOfType("*domain.CreateAPIKeyRequest")).Return(nil, err)
+		r := newAPIKeyRouter(useCase, map[string]interface{}{utils.UserIDContextKey: "admin-1"})
+
+		req, _ := http.NewRequest("POST", "/oauth/api-keys", strings.NewReader(`{"name": "ERP", "permissions": ["admin:users"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, want, w.Code, err.Error())
+		assert.Contains(t, w.Body.String(), err.Error())
+	}
+}
+
+func TestRevokeAPIKeyHandler(t *testing.T) {
+	useCase := new(MockAPIKeyUseCase)
+	useCase.On("RevokeAPIKey", "activa").Return(true, nil)
+	useCase.On("RevokeAPIKey", "revocada").Return(false, nil)
+	useCase.On("RevokeAPIKey", "xyz").Return(false, domain.ErrInvalidAPIKeyID)
+	r := newAPIKeyRouter(useCase, map[string]interface{}{utils.UserIDContextKey: "admin-1"})
+
+	for id, want := range map[string]int{
+		"activa":   http.StatusOK,
+		"revocada": http.StatusNotFound,
+		"xyz":      http.StatusBadRequest,
+	} {
+		req, _ := http.NewRequest("DELETE", "/oauth/api-keys/"+id, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, want, w.Code, id)
+	}
+}
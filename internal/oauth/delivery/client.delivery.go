@@ -0,0 +1,115 @@
+package delivery
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/black4ninja/mi-proyecto/internal/oauth/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// ClientHandler maneja las peticiones HTTP de administración de clientes OAuth
+type ClientHandler struct {
+	clientUseCase domain.ClientUseCase
+}
+
+// NewClientAdminHandler registra las rutas de administración de clientes OAuth.
+// El grupo recibido debe estar protegido con un permiso administrativo (ej. admin:clients).
+func NewClientAdminHandler(router *gin.RouterGroup, useCase domain.ClientUseCase) {
+	handler := &ClientHandler{
+		clientUseCase: useCase,
+	}
+
+	router.GET("/clients", handler.GetClients)
+	router.GET("/clients/:client_id", handler.GetClient)
+	router.POST("/clients", handler.CreateClient)
+	router.PUT("/clients/:client_id", handler.UpdateClient)
+	router.DELETE("/clients/:client_id", handler.DeleteClient)
+}
+
+// GetClients manejador que lista los clientes sin sus secretos
+func (h *ClientHandler) GetClients(c *gin.Context) {
+	clients, err := h.clientUseCase.GetClients()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al obtener los clientes")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Clientes obtenidos con éxito", clients)
+}
+
+// GetClient manejador para obtener un cliente por su client_id
+func (h *ClientHandler) GetClient(c *gin.Context) {
+	client, err := h.clientUseCase.GetClient(c.Param("client_id"))
+	if err != nil {
+		clientErrorResponse(c, err, "Error al obtener el cliente")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Cliente obtenido con éxito", client)
+}
+
+// CreateClient manejador para registrar un cliente. El client_secret solo se incluye en esta respuesta.
+func (h *ClientHandler) CreateClient(c *gin.Context) {
+	userID, ok := utils.MustUserID(c)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "No autenticado")
+		return
+	}
+
+	var req domain.CreateClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	client, err := h.clientUseCase.CreateClient(userID, &req)
+	if err != nil {
+		clientErrorResponse(c, err, "Error al crear el cliente")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Cliente creado con éxito; guarde el client_secret, no volverá a mostrarse", client)
+}
+
+// UpdateClient manejador para reemplazar la configuración de un cliente
+func (h *ClientHandler) UpdateClient(c *gin.Context) {
+	var req domain.UpdateClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	client, err := h.clientUseCase.UpdateClient(c.Param("client_id"), &req)
+	if err != nil {
+		clientErrorResponse(c, err, "Error al actualizar el cliente")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Cliente actualizado con éxito", client)
+}
+
+// DeleteClient manejador para eliminar un cliente
+func (h *ClientHandler) DeleteClient(c *gin.Context) {
+	if err := h.clientUseCase.DeleteClient(c.Param("client_id")); err != nil {
+		clientErrorResponse(c, err, "Error al eliminar el cliente")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Cliente eliminado con éxito", nil)
+}
+
+// clientErrorResponse responde 404 si el cliente no existe, 400 si la configuración es inválida
+// y 500 con el mensaje genérico en cualquier otro caso
+func clientErrorResponse(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, domain.ErrClientNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, domain.ErrInvalidClientRequest):
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, message)
+	}
+}
@@ -0,0 +1,125 @@
+package delivery_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/black4ninja/mi-proyecto/internal/oauth/delivery"
+	"github.com/black4ninja/mi-proyecto/internal/oauth/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// MockClientUseCase simula el caso de uso de administración de clientes; los métodos no
+// implementados entran en pánico a través de la interfaz embebida
+type MockClientUseCase struct {
+	domain.ClientUseCase
+	mock.Mock
+}
+
+func (m *MockClientUseCase) CreateClient(ownerID string, req *domain.CreateClientRequest) (*domain.CreateClientResponse, error) {
+	args := m.Called(ownerID, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.CreateClientResponse), args.Error(1)
+}
+
+func (m *MockClientUseCase) GetClient(clientID string) (*domain.ClientResponse, error) {
+	args := m.Called(clientID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.ClientResponse), args.Error(1)
+}
+
+func (m *MockClientUseCase) UpdateClient(clientID string, req *domain.UpdateClientRequest) (*domain.ClientResponse, error) {
+	args := m.Called(clientID, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.ClientResponse), args.Error(1)
+}
+
+func newClientRouter(useCase domain.ClientUseCase) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	group := r.Group("/oauth", func(c *gin.Context) {
+		c.Set(utils.UserIDContextKey, "admin-1")
+		c.Next()
+	})
+	delivery.NewClientAdminHandler(group, useCase)
+	return r
+}
+
+func TestCreateClientHandler(t *testing.T) {
+	t.Run("retorna el secreto al crear", func(t *testing.T) {
+		useCase := new(MockClientUseCase)
+		useCase.On("CreateClient", "admin-1", &domain.CreateClientRequest{
+			Name:       "ERP",
+			GrantTypes: []string{domain.GrantTypeClientCredentials},
+		}).Return(&domain.CreateClientResponse{
+			ClientResponse: domain.ClientResponse{ClientID: "nuevo"},
+			ClientSecret:   "secreto-nuevo",
+		}, nil)
+
+		req, _ := http.NewRequest("POST", "/oauth/clients", strings.NewReader(`{"name": "ERP", "grant_types": ["client_credentials"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		newClientRouter(useCase).ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"client_secret":"secreto-nuevo"`)
+		useCase.AssertExpectations(t)
+	})
+
+	t.Run("sin tipos de concesión", func(t *testing.T) {
+		useCase := new(MockClientUseCase)
+
+		req, _ := http.NewRequest("POST", "/oauth/clients", strings.NewReader(`{"name": "ERP"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		newClientRouter(useCase).ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		useCase.AssertNotCalled(t, "CreateClient", mock.Anything, mock.Anything)
+	})
+
+	t.Run("configuración inválida", func(t *testing.T) {
+		useCase := new(MockClientUseCase)
+		useCase.On("CreateClient", "admin-1", mock.Anything).
+			Return(nil, fmt.Errorf("%w: scope no soportado: superuser", domain.ErrInvalidClientRequest))
+
+		req, _ := http.NewRequest("POST", "/oauth/clients", strings.NewReader(`{"name": "ERP", "grant_types": ["client_credentials"], "scopes": ["superuser"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		newClientRouter(useCase).ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "scope no soportado")
+	})
+}
+
+func TestClientHandlerNotFound(t *testing.T) {
+	useCase := new(MockClientUseCase)
+	useCase.On("GetClient", "no-existe").Return(nil, domain.ErrClientNotFound)
+	useCase.On("UpdateClient", "no-existe", mock.Anything).Return(nil, domain.ErrClientNotFound)
+	r := newClientRouter(useCase)
+
+	req, _ := http.NewRequest("GET", "/oauth/clients/no-existe", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	req, _ = http.NewRequest("PUT", "/oauth/clients/no-existe", strings.NewReader(`{"name": "ERP", "grant_types": ["password"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -1,7 +1,10 @@
 package delivery
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
@@ -12,52 +15,330 @@ import (
 // OAuthHandler maneja las peticiones HTTP para OAuth
 type OAuthHandler struct {
 	oauthUseCase domain.OAuthUseCase
+	oauthPath    string // Ruta base de los endpoints OAuth, para el documento de metadatos
+	issuer       string // URL pública del servidor, para el documento de metadatos
 }
 
-// NewOAuthHandler crea un nuevo manejador de OAuth
-func NewOAuthHandler(router *gin.RouterGroup, useCase domain.OAuthUseCase) {
+// NewOAuthHandler crea un nuevo manejador de OAuth.
+// tokenMiddlewares se aplican solo al endpoint de tokens (ej. rate limit por scope).
+//
+// Los endpoints del protocolo OAuth (los de este manejador y los de NewOAuthSessionHandler)
+// responden JSON según la especificación, sin el envoltorio utils.Response: el cuerpo exitoso
+// se envía tal cual y los errores usan {"error": ..., "error_description": ...}. Las rutas de
+// administración de sesiones, clientes y API keys mantienen el formato general de la API.
+func NewOAuthHandler(router *gin.RouterGroup, useCase domain.OAuthUseCase, tokenMiddlewares ...gin.HandlerFunc) {
 	handler := &OAuthHandler{
 		oauthUseCase: useCase,
 	}
 
 	// Rutas OAuth
-	router.POST("/token", handler.GenerateToken)
+	router.POST("/token", append(tokenMiddlewares, handler.GenerateToken)...)
 	router.POST("/revoke", handler.RevokeToken)
 }
 
-// GenerateToken manejador para generar tokens OAuth
+// NewOAuthSessionHandler registra las rutas OAuth que requieren una sesión activa.
+// El grupo recibido debe estar protegido con OAuthMiddleware.Protected.
+func NewOAuthSessionHandler(router *gin.RouterGroup, useCase domain.OAuthUseCase) {
+	handler := &OAuthHandler{
+		oauthUseCase: useCase,
+	}
+
+	router.POST("/refresh-claims", handler.RefreshClaims)
+	router.GET("/authorize", handler.Authorize)
+	router.POST("/authorize", handler.Authorize)
+}
+
+// NewOAuthUserHandler registra las rutas con las que el usuario administra las aplicaciones
+// conectadas a su cuenta. El grupo recibido debe estar protegido con OAuthMiddleware.Protected
+// (ej. /api/users/me).
+func NewOAuthUserHandler(router *gin.RouterGroup, useCase domain.OAuthUseCase) {
+	handler := &OAuthHandler{
+		oauthUseCase: useCase,
+	}
+
+	router.GET("/authorized-clients", handler.GetAuthorizedClients)
+	router.DELETE("/authorized-clients/:client_id", handler.RevokeClientAuthorization)
+}
+
+// NewOAuthMetadataHandler registra el documento de metadatos del servidor de autorización
+// (domain.MetadataPath) en la raíz del router. oauthPath es la ruta base con la que se montaron
+// NewOAuthHandler y NewOAuthSessionHandler (ej. "/api/oauth") e issuer la URL pública del
+// servidor (ej. "https://api.ejemplo.com"); vacío la deriva del host de cada solicitud.
+func NewOAuthMetadataHandler(router gin.IRoutes, useCase domain.OAuthUseCase, oauthPath, issuer string) {
+	handler := &OAuthHandler{
+		oauthUseCase: useCase,
+		oauthPath:    strings.TrimSuffix(oauthPath, "/"),
+		issuer:       strings.TrimSuffix(issuer, "/"),
+	}
+
+	router.GET(domain.MetadataPath, handler.GetServerMetadata)
+}
+
+// NewOAuthAdminHandler registra las rutas administrativas de tokens.
+// El grupo recibido debe estar protegido con un permiso administrativo (ej. admin:tokens).
+func NewOAuthAdminHandler(router *gin.RouterGroup, useCase domain.OAuthUseCase) {
+	handler := &OAuthHandler{
+		oauthUseCase: useCase,
+	}
+
+	router.DELETE("/tokens/:id", handler.ExpireToken)
+	router.DELETE("/users/:user_id/tokens", handler.RevokeUserTokens)
+}
+
+// GenerateToken manejador para generar tokens OAuth.
+// Acepta cuerpos JSON o application/x-www-form-urlencoded según el Content-Type.
+// Las credenciales del cliente pueden enviarse también con HTTP Basic.
 func (h *OAuthHandler) GenerateToken(c *gin.Context) {
+	setNoStore(c)
+
 	var req domain.OAuthRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	if err := c.ShouldBind(&req); err != nil {
+		oauthErrorResponse(c, domain.NewOAuthError(domain.ErrorInvalidRequest, err.Error()))
 		return
 	}
 
+	basicAuth := false
+	if clientID, clientSecret, ok := utils.ClientBasicAuth(c.Request); ok {
+		// RFC 6749 §2.3: el cliente no debe usar más de un método de autenticación
+		if req.ClientSecret != "" || (req.ClientID != "" && req.ClientID != clientID) {
+			oauthErrorResponse(c, domain.NewOAuthError(domain.ErrorInvalidRequest,
+				"las credenciales del cliente deben enviarse en el encabezado Authorization o en el cuerpo, no en ambos"))
+			return
+		}
+		req.ClientID = clientID
+		req.ClientSecret = clientSecret
+		basicAuth = true
+	}
+
+	if req.ClientID == "" {
+		oauthErrorResponse(c, domain.NewOAuthError(domain.ErrorInvalidRequest, "client_id es requerido"))
+		return
+	}
+
+	req.ClientIP = c.ClientIP()
 	token, err := h.oauthUseCase.GenerateToken(&req)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		oauthErr := domain.AsOAuthError(err)
+		if oauthErr.Code == domain.ErrorServerError {
+			log.Printf("[ERROR] emisión de token fallida client_id=%s grant_type=%s error=%v", req.ClientID, req.GrantType, err)
+		}
+		// RFC 6749 §5.2: si el cliente se autenticó con el encabezado Authorization, el 401
+		// debe indicar el esquema
+		if oauthErr.Code == domain.ErrorInvalidClient && basicAuth {
+			c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		oauthErrorResponse(c, oauthErr)
 		return
 	}
 
 	c.JSON(http.StatusOK, token)
 }
 
-// RevokeToken manejador para revocar tokens
+// setNoStore impide que la respuesta, que incluye tokens, se guarde en cachés (RFC 6749 §5.1)
+func setNoStore(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+}
+
+// oauthErrorResponse responde un error de los endpoints OAuth con el formato de RFC 6749 §5.2
+// ({"error": ..., "error_description": ...}) en lugar del formato general de la API
+func oauthErrorResponse(c *gin.Context, err *domain.OAuthError) {
+	// RFC 6750 §3: los errores de token de acceso indican el esquema y el código
+	if err.Code == domain.ErrorInvalidToken {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+	c.JSON(err.StatusCode(), err)
+}
+
+// RevokeToken manejador para revocar tokens (RFC 7009). Acepta cuerpos JSON o
+// application/x-www-form-urlencoded y responde 200 sin cuerpo, también si el token
+// no existe, para no revelar qué tokens son válidos.
 func (h *OAuthHandler) RevokeToken(c *gin.Context) {
 	type RevokeRequest struct {
-		RefreshToken string `json:"refresh_token" binding:"required"`
+		RefreshToken string `json:"refresh_token" form:"refresh_token" binding:"required"`
 	}
 
 	var req RevokeRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	if err := c.ShouldBind(&req); err != nil {
+		oauthErrorResponse(c, domain.NewOAuthError(domain.ErrorInvalidRequest, err.Error()))
 		return
 	}
 
 	if err := h.oauthUseCase.RevokeToken(req.RefreshToken); err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		log.Printf("[ERROR] revocación de token fallida error=%v", err)
+		oauthErrorResponse(c, domain.AsOAuthError(err))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// GetServerMetadata responde el documento de descubrimiento (RFC 8414) con los endpoints y las
+// concesiones habilitadas globalmente. El endpoint de autorización, la respuesta "code" y PKCE
+// solo se anuncian si authorization_code está habilitado.
+func (h *OAuthHandler) GetServerMetadata(c *gin.Context) {
+	issuer := h.issuer
+	if issuer == "" {
+		issuer = requestOrigin(c)
+	}
+	endpoint := func(path string) string {
+		return issuer + h.oauthPath + path
+	}
+
+	grantTypes := h.oauthUseCase.EnabledGrantTypes()
+	metadata := domain.ServerMetadata{
+		Issuer:                            issuer,
+		TokenEndpoint:                     endpoint("/token"),
+		RevocationEndpoint:                endpoint("/revoke"),
+		ScopesSupported:                   domain.SupportedScopes,
+		ResponseTypesSupported:            []string{},
+		GrantTypesSupported:               grantTypes,
+		TokenEndpointAuthMethodsSupported: []string{domain.ClientAuthSecretBasic, domain.ClientAuthSecretPost},
+	}
+	for _, grantType := range grantTypes {
+		if grantType != domain.GrantTypeAuthorizationCode {
+			continue
+		}
+		metadata.AuthorizationEndpoint = endpoint("/authorize")
+		metadata.ResponseTypesSupported = []string{"code"}
+		metadata.CodeChallengeMethodsSupported = []string{domain.CodeChallengeS256, domain.CodeChallengePlain}
+		// Los clientes públicos (sin secreto) solo pueden canjear códigos y refresh tokens
+		metadata.TokenEndpointAuthMethodsSupported = append(metadata.TokenEndpointAuthMethodsSupported, domain.ClientAuthNone)
+	}
+
+	c.JSON(http.StatusOK, metadata)
+}
+
+// requestOrigin retorna el esquema y host con que se recibió la solicitud (ej.
+// "http://localhost:3000"). Los headers Host y X-Forwarded-* los controla el cliente, por lo que
+// solo se usa sin OAUTH_ISSUER, que CheckTransportSecurity exige en producción.
+func requestOrigin(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// RefreshClaims manejador para reemitir el access token con los permisos actuales del usuario
+func (h *OAuthHandler) RefreshClaims(c *gin.Context) {
+	setNoStore(c)
+	accessToken := c.GetString("accessToken")
+	if accessToken == "" {
+		oauthErrorResponse(c, domain.NewOAuthError(domain.ErrorInvalidToken, "No autenticado"))
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Token revocado con éxito", nil)
+	token, err := h.oauthUseCase.RefreshClaims(accessToken)
+	if err != nil {
+		oauthErr := domain.AsOAuthError(err)
+		if oauthErr.Code == domain.ErrorServerError {
+			log.Printf("[ERROR] actualización de claims fallida error=%v", err)
+		}
+		oauthErrorResponse(c, oauthErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, token)
+}
+
+// Authorize manejador del endpoint de autorización del grant authorization_code.
+// El usuario autenticado autoriza al cliente y recibe el código junto con la URL de
+// redirección (redirect_to) a la que debe enviarse.
+func (h *OAuthHandler) Authorize(c *gin.Context) {
+	userID, ok := utils.MustUserID(c)
+	if !ok {
+		oauthErrorResponse(c, domain.NewOAuthError(domain.ErrorInvalidToken, "No autenticado"))
+		return
+	}
+
+	var req domain.AuthorizeRequest
+	if err := c.ShouldBind(&req); err != nil {
+		oauthErrorResponse(c, domain.NewOAuthError(domain.ErrorInvalidRequest, err.Error()))
+		return
+	}
+	// El token emitido con el código conserva la autenticación de esta sesión
+	req.AuthTime, _ = utils.ClaimTime(c, "auth_time")
+
+	response, err := h.oauthUseCase.Authorize(userID, &req)
+	if err != nil {
+		oauthErr := domain.AsOAuthError(err)
+		if oauthErr.Code == domain.ErrorServerError {
+			log.Printf("[ERROR] autorización fallida client_id=%s error=%v", req.ClientID, err)
+		}
+		oauthErrorResponse(c, oauthErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetAuthorizedClients manejador que lista los clientes con sesiones activas del usuario autenticado
+func (h *OAuthHandler) GetAuthorizedClients(c *gin.Context) {
+	userID, ok := utils.MustUserID(c)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "No autenticado")
+		return
+	}
+
+	clients, err := h.oauthUseCase.GetAuthorizedClients(userID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al obtener las aplicaciones autorizadas")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Aplicaciones autorizadas obtenidas con éxito", clients)
+}
+
+// RevokeClientAuthorization manejador que desconecta un cliente: elimina las sesiones del
+// usuario autenticado con ese cliente
+func (h *OAuthHandler) RevokeClientAuthorization(c *gin.Context) {
+	userID, ok := utils.MustUserID(c)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "No autenticado")
+		return
+	}
+
+	removed, err := h.oauthUseCase.RevokeClientAuthorization(userID, c.Param("client_id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al revocar la autorización del cliente")
+		return
+	}
+	if removed == 0 {
+		utils.ErrorResponse(c, http.StatusNotFound, "No hay sesiones activas con ese cliente")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Autorización del cliente revocada con éxito", gin.H{"removed": removed})
+}
+
+// RevokeUserTokens manejador que elimina todas las sesiones de un usuario (ej. ante una cuenta
+// comprometida); sus access tokens dejan de ser válidos
+func (h *OAuthHandler) RevokeUserTokens(c *gin.Context) {
+	removed, err := h.oauthUseCase.RevokeUserTokens(c.Param("user_id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al revocar los tokens del usuario")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Tokens del usuario revocados con éxito", gin.H{"removed": removed})
+}
+
+// ExpireToken manejador para expirar forzosamente un token por su ID
+func (h *OAuthHandler) ExpireToken(c *gin.Context) {
+	removed, err := h.oauthUseCase.ExpireToken(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidTokenID) {
+			utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al expirar el token")
+		return
+	}
+
+	message := "Token expirado con éxito"
+	if !removed {
+		message = "No existe un token con ese ID"
+	}
+	utils.SuccessResponse(c, http.StatusOK, message, gin.H{"removed": removed})
 }
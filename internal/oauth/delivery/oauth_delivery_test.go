@@ -0,0 +1,514 @@
+package delivery_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/black4ninja/mi-proyecto/internal/oauth/delivery"
+	"github.com/black4ninja/mi-proyecto/internal/oauth/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// MockOAuthUseCase simula el caso de uso OAuth; los métodos no
+// implementados entran en pánico a través de la interfaz embebida
+type MockOAuthUseCase struct {
+	domain.OAuthUseCase
+	mock.Mock
+}
+
+func (m *MockOAuthUseCase) GenerateToken(req *domain.OAuthRequest) (*domain.OAuthResponse, error) {
+	args := m.Called(req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.OAuthResponse), args.Error(1)
+}
+
+func (m *MockOAuthUseCase) GetAuthorizedClients(userID string) ([]*domain.AuthorizedClient, error) {
+	args := m.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.AuthorizedClient), args.Error(1)
+}
+
+func (m *MockOAuthUseCase) RevokeClientAuthorization(userID, clientID string) (int64, error) {
+	args := m.Called(userID, clientID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockOAuthUseCase) RevokeToken(refreshToken string) error {
+	return m.Called(refreshToken).Error(0)
+}
+
+func (m *MockOAuthUseCase) RefreshClaims(accessToken string) (*domain.OAuthResponse, error) {
+	args := m.Called(accessToken)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.OAuthResponse), args.Error(1)
+}
+
+func (m *MockOAuthUseCase) Authorize(userID string, req *domain.AuthorizeRequest) (*domain.AuthorizeResponse, error) {
+	args := m.Called(userID, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.AuthorizeResponse), args.Error(1)
+}
+
+// newOAuthRouter monta el manejador bajo /oauth, igual que main
+func newOAuthRouter(useCase domain.OAuthUseCase) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	delivery.NewOAuthHandler(r.Group("/oauth"), useCase)
+	return r
+}
+
+func postToken(r *gin.Engine, contentType, body, authorization string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/oauth/token", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func basicAuth(clientID, clientSecret string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(clientID+":"+clientSecret))
+}
+
+func TestGenerateTokenRequestFormats(t *testing.T) {
+	token := &domain.OAuthResponse{AccessToken: "access", TokenType: domain.TokenTypeBearer, ExpiresIn: 3600}
+	expected := &domain.OAuthRequest{
+		GrantType:    domain.GrantTypeClientCredentials,
+		ClientID:     "cliente",
+		ClientSecret: "secreto",
+		Scope:        "read",
+	}
+
+	tests := []struct {
+		name          string
+		contentType   string
+		body          string
+		authorization string
+	}{
+		{"json", "application/json", `{"grant_type":"client_credentials","client_id":"cliente","client_secret":"secreto","scope":"read"}`, ""},
+		{"formulario", "application/x-www-form-urlencoded", "grant_type=client_credentials&client_id=cliente&client_secret=secreto&scope=read", ""},
+		{"formulario con basic", "application/x-www-form-urlencoded", "grant_type=client_credentials&scope=read", basicAuth("cliente", "secreto")},
+		{"basic con client_id en el cuerpo", "application/x-www-form-urlencoded", "grant_type=client_credentials&client_id=cliente&scope=read", basicAuth("cliente", "secreto")},
+		{"json con basic", "application/json", `{"grant_type":"client_credentials","scope":"read"}`, basicAuth("cliente", "secreto")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useCase := new(MockOAuthUseCase)
+			useCase.On("GenerateToken", expected).Return(token, nil).Once()
+
+			w := postToken(newOAuthRouter(useCase), tt.contentType, tt.body, tt.authorization)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), `"access_token":"access"`)
+			assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+			assert.Equal(t, "no-cache", w.Header().Get("Pragma"))
+			useCase.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGenerateTokenRejectsInvalidClientAuthentication(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		authorization string
+	}{
+		{"sin client_id", "grant_type=client_credentials", ""},
+		{"secreto en cuerpo y basic", "grant_type=client_credentials&client_secret=secreto", basicAuth("cliente", "secreto")},
+		{"client_id distinto al de basic", "grant_type=client_credentials&client_id=otro", basicAuth("cliente", "secreto")},
+		{"sin grant_type", "client_id=cliente&client_secret=secreto", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useCase := new(MockOAuthUseCase)
+
+			w := postToken(newOAuthRouter(useCase), "application/x-www-form-urlencoded", tt.body, tt.authorization)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), `"error":"invalid_request"`)
+			assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+			useCase.AssertNotCalled(t, "GenerateToken", mock.Anything)
+		})
+	}
+}
+
+func TestGenerateTokenErrorResponses(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		authorization string
+		status        int
+		body          string
+		authenticate  string
+	}{
+		{"cliente inválido con basic", domain.ErrInvalidClient, basicAuth("cliente", "incorrecto"),
+			http.StatusUnauthorized, `{"error":"invalid_client","error_description":"credenciales de cliente inválidas"}`, `Basic realm="oauth"`},
+		{"grant inválido", domain.NewOAuthError(domain.ErrorInvalidGrant, "refresh token expirado"), basicAuth("cliente", "secreto"),
+			http.StatusBadRequest, `{"error":"invalid_grant","error_description":"refresh token expirado"}`, ""},
+		{"grant no soportado envuelto", fmt.Errorf("emitir token: %w", domain.ErrUnsupportedGrantType), basicAuth("cliente", "secreto"),
+			http.StatusBadRequest, `{"error":"unsupported_grant_type","error_description":"tipo de concesión no soportado"}`, ""},
+		{"error interno sin detalle", errors.New("mongo: conexión rechazada"), basicAuth("cliente", "secreto"),
+			http.StatusInternalServerError, `{"error":"server_error","error_description":"error interno del servidor"}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useCase := new(MockOAuthUseCase)
+			useCase.On("GenerateToken", mock.Anything).Return(nil, tt.err)
+
+			w := postToken(newOAuthRouter(useCase), "application/x-www-form-urlencoded", "grant_type=client_credentials", tt.authorization)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.JSONEq(t, tt.body, w.Body.String())
+			assert.Equal(t, tt.authenticate, w.Header().Get("WWW-Authenticate"))
+		})
+	}
+
+	t.Run("sin encabezado WWW-Authenticate si las credenciales vienen en el cuerpo", func(t *testing.T) {
+		useCase := new(MockOAuthUseCase)
+		useCase.On("GenerateToken", mock.Anything).Return(nil, domain.ErrInvalidClient)
+
+		w := postToken(newOAuthRouter(useCase), "application/x-www-form-urlencoded",
+			"grant_type=client_credentials&client_id=cliente&client_secret=incorrecto", "")
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Empty(t, w.Header().Get("WWW-Authenticate"))
+	})
+}
+
+// newOAuthSessionRouter monta las rutas OAuth con sesión bajo /oauth con el usuario y el
+// access token indicados (vacíos = sin sesión)
+func newOAuthSessionRouter(useCase domain.OAuthUseCase, userID, accessToken string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if userID != "" {
+			c.Set(utils.UserIDContextKey, userID)
+			c.Set("accessToken", accessToken)
+		}
+	})
+	delivery.NewOAuthSessionHandler(r.Group("/oauth"), useCase)
+	return r
+}
+
+func TestRevokeTokenResponses(t *testing.T) {
+	post := func(r *gin.Engine, contentType, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/oauth/revoke", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("éxito sin cuerpo ni envoltorio", func(t *testing.T) {
+		for contentType, body := range map[string]string{
+			"application/json":                  `{"refresh_token":"refresh"}`,
+			"application/x-www-form-urlencoded": "refresh_token=refresh",
+		} {
+			useCase := new(MockOAuthUseCase)
+			useCase.On("RevokeToken", "refresh").Return(nil).Once()
+
+			w := post(newOAuthRouter(useCase), contentType, body)
+
+			assert.Equal(t, http.StatusOK, w.Code, contentType)
+			assert.Empty(t, w.Body.String(), contentType)
+			useCase.AssertExpectations(t)
+		}
+	})
+
+	t.Run("sin refresh_token", func(t *testing.T) {
+		useCase := new(MockOAuthUseCase)
+
+		w := post(newOAuthRouter(useCase), "application/json", `{}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"error":"invalid_request"`)
+		assert.NotContains(t, w.Body.String(), `"status"`)
+		useCase.AssertNotCalled(t, "RevokeToken", mock.Anything)
+	})
+
+	t.Run("error interno sin detalle", func(t *testing.T) {
+		useCase := new(MockOAuthUseCase)
+		useCase.On("RevokeToken", "refresh").Return(errors.New("mongo: conexión rechazada"))
+
+		w := post(newOAuthRouter(useCase), "application/json", `{"refresh_token":"refresh"}`)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.JSONEq(t, `{"error":"server_error","error_description":"error interno del servidor"}`, w.Body.String())
+	})
+}
+
+func TestOAuthSessionResponsesNotWrapped(t *testing.T) {
+	token := &domain.OAuthResponse{AccessToken: "nuevo", TokenType: domain.TokenTypeBearer, ExpiresIn: 3600}
+
+	t.Run("refresh-claims responde el token tal cual", func(t *testing.T) {
+		useCase := new(MockOAuthUseCase)
+		useCase.On("RefreshClaims", "access").Return(token, nil)
+
+		req, _ := http.NewRequest("POST", "/oauth/refresh-claims", nil)
+		w := httptest.NewRecorder()
+		newOAuthSessionRouter(useCase, "usuario-1", "access").ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"access_token":"nuevo","token_type":"Bearer","expires_in":3600}`, w.Body.String())
+	})
+
+	t.Run("refresh-claims con token inválido", func(t *testing.T) {
+		useCase := new(MockOAuthUseCase)
+		useCase.On("RefreshClaims", "access").Return(nil, domain.NewOAuthError(domain.ErrorInvalidToken, "token inválido"))
+
+		req, _ := http.NewRequest("POST", "/oauth/refresh-claims", nil)
+		w := httptest.NewRecorder()
+		newOAuthSessionRouter(useCase, "usuario-1", "access").ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.JSONEq(t, `{"error":"invalid_token","error_description":"token inválido"}`, w.Body.String())
+		assert.Equal(t, `Bearer error="invalid_token"`, w.Header().Get("WWW-Authenticate"))
+	})
+
+	t.Run("refresh-claims con error interno", func(t *testing.T) {
+		useCase := new(MockOAuthUseCase)
+		useCase.On("RefreshClaims", "access").Return(nil, errors.New("conexión perdida"))
+
+		req, _ := http.NewRequest("POST", "/oauth/refresh-claims", nil)
+		w := httptest.NewRecorder()
+		newOAuthSessionRouter(useCase, "usuario-1", "access").ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.JSONEq(t, `{"error":"server_error","error_description":"error interno del servidor"}`, w.Body.String())
+	})
+
+	t.Run("authorize responde el código tal cual", func(t *testing.T) {
+		useCase := new(MockOAuthUseCase)
+		useCase.On("Authorize", "usuario-1", mock.Anything).Return(&domain.AuthorizeResponse{
+			Code: "codigo", RedirectURI: "https://app.example.com/cb", RedirectTo: "https://app.example.com/cb?code=codigo",
+		}, nil)
+
+		req, _ := http.NewRequest("GET", "/oauth/authorize?response_type=code&client_id=spa&redirect_uri=https://app.example.com/cb", nil)
+		w := httptest.NewRecorder()
+		newOAuthSessionRouter(useCase, "usuario-1", "access").ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"codigo"`)
+		assert.NotContains(t, w.Body.String(), `"data"`)
+	})
+
+	t.Run("authorize con error OAuth", func(t *testing.T) {
+		useCase := new(MockOAuthUseCase)
+		useCase.On("Authorize", "usuario-1", mock.Anything).Return(nil, domain.ErrPKCERequired)
+
+		req, _ := http.NewRequest("GET", "/oauth/authorize?response_type=code&client_id=spa&redirect_uri=https://app.example.com/cb", nil)
+		w := httptest.NewRecorder()
+		newOAuthSessionRouter(useCase, "usuario-1", "access").ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"error":"invalid_request","error_description":"los clientes públicos deben enviar code_challenge"}`, w.Body.String())
+	})
+
+	t.Run("authorize sin sesión", func(t *testing.T) {
+		useCase := new(MockOAuthUseCase)
+
+		req, _ := http.NewRequest("GET", "/oauth/authorize", nil)
+		w := httptest.NewRecorder()
+		newOAuthSessionRouter(useCase, "", "").ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), `"error":"invalid_token"`)
+		useCase.AssertNotCalled(t, "Authorize", mock.Anything, mock.Anything)
+	})
+}
+
+// newOAuthUserRouter monta las rutas de aplicaciones conectadas bajo /api/users/me con el
+// usuario autenticado indicado (vacío = sin sesión)
+func newOAuthUserRouter(useCase domain.OAuthUseCase, userID string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if userID != "" {
+			c.Set(utils.UserIDContextKey, userID)
+		}
+	})
+	delivery.NewOAuthUserHandler(r.Group("/api/users/me"), useCase)
+	return r
+}
+
+func TestGetAuthorizedClients(t *testing.T) {
+	t.Run("lista los clientes del usuario autenticado", func(t *testing.T) {
+		lastUsed := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+		useCase := new(MockOAuthUseCase)
+		useCase.On("GetAuthorizedClients", "usuario-1").Return([]*domain.AuthorizedClient{
+			{ClientID: "app-movil", ClientName: "App móvil", Scopes: []string{"read"}, Sessions: 2,
+				LastUsedAt: utils.NewTimestamp(lastUsed), ExpiresAt: utils.NewTimestamp(lastUsed.Add(time.Hour))},
+		}, nil)
+
+		req, _ := http.NewRequest("GET", "/api/users/me/authorized-clients", nil)
+		w := httptest.NewRecorder()
+		newOAuthUserRouter(useCase, "usuario-1").ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"client_id":"app-movil"`)
+		assert.Contains(t, w.Body.String(), `"last_used_at":"2024-03-01T10:00:00.000Z"`)
+		assert.Contains(t, w.Body.String(), `"expires_at":"2024-03-01T11:00:00.000Z"`)
+		useCase.AssertExpectations(t)
+	})
+
+	t.Run("sin sesión", func(t *testing.T) {
+		useCase := new(MockOAuthUseCase)
+
+		req, _ := http.NewRequest("GET", "/api/users/me/authorized-clients", nil)
+		w := httptest.NewRecorder()
+		newOAuthUserRouter(useCase, "").ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		useCase.AssertNotCalled(t, "GetAuthorizedClients", mock.Anything)
+	})
+}
+
+func TestRevokeClientAuthorization(t *testing.T) {
+	tests := []struct {
+		name     string
+		removed  int64
+		err      error
+		expected int
+	}{
+		{"elimina las sesiones del cliente", 2, nil, http.StatusOK},
+		{"sin sesiones con el cliente", 0, nil, http.StatusNotFound},
+		{"error del repositorio", 0, errors.New("fallo"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useCase := new(MockOAuthUseCase)
+			useCase.On("RevokeClientAuthorization", "usuario-1", "app-movil").Return(tt.removed, tt.err)
+
+			req, _ := http.NewRequest("DELETE", "/api/users/me/authorized-clients/app-movil", nil)
+			w := httptest.NewRecorder()
+			newOAuthUserRouter(useCase, "usuario-1").ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expected, w.Code)
+			useCase.AssertExpectations(t)
+		})
+	}
+}
+
+func (m *MockOAuthUseCase) RevokeUserTokens(userID string) (int64, error) {
+	args := m.Called(userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockOAuthUseCase) RevokeClientTokens(clientID string) (int64, error) {
+	args := m.Called(clientID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func TestRevokeUserTokens(t *testing.T) {
+	tests := []struct {
+		name     string
+		removed  int64
+		err      error
+		expected int
+	}{
+		{"elimina las sesiones del usuario", 2, nil, http.StatusOK},
+		{"sin sesiones activas", 0, nil, http.StatusOK},
+		{"error del repositorio", 0, errors.New("fallo"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useCase := new(MockOAuthUseCase)
+			useCase.On("RevokeUserTokens", "usuario-1").Return(tt.removed, tt.err)
+
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			delivery.NewOAuthAdminHandler(r.Group("/api/oauth"), useCase)
+
+			req, _ := http.NewRequest("DELETE", "/api/oauth/users/usuario-1/tokens", nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expected, w.Code)
+			useCase.AssertExpectations(t)
+		})
+	}
+}
+
+func (m *MockOAuthUseCase) EnabledGrantTypes() []string {
+	return m.Called().Get(0).([]string)
+}
+
+func TestGetServerMetadata(t *testing.T) {
+	getMetadata := func(grantTypes []string, issuer string, header map[string]string) (*httptest.ResponseRecorder, domain.ServerMetadata) {
+		useCase := new(MockOAuthUseCase)
+		useCase.On("EnabledGrantTypes").Return(grantTypes)
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		delivery.NewOAuthMetadataHandler(r, useCase, "/api/oauth/", issuer)
+
+		req, _ := http.NewRequest("GET", domain.MetadataPath, nil)
+		req.Host = "api.ejemplo.com"
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var metadata domain.ServerMetadata
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &metadata))
+		return w, metadata
+	}
+
+	t.Run("anuncia las concesiones y endpoints habilitados", func(t *testing.T) {
+		grantTypes := []string{domain.GrantTypeAuthorizationCode, domain.GrantTypeRefreshToken}
+		w, metadata := getMetadata(grantTypes, "https://auth.ejemplo.com/", nil)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "https://auth.ejemplo.com", metadata.Issuer)
+		assert.Equal(t, "https://auth.ejemplo.com/api/oauth/token", metadata.TokenEndpoint)
+		assert.Equal(t, "https://auth.ejemplo.com/api/oauth/revoke", metadata.RevocationEndpoint)
+		assert.Equal(t, "https://auth.ejemplo.com/api/oauth/authorize", metadata.AuthorizationEndpoint)
+		assert.Equal(t, grantTypes, metadata.GrantTypesSupported)
+		assert.Equal(t, []string{"code"}, metadata.ResponseTypesSupported)
+		assert.Equal(t, []string{"S256", "plain"}, metadata.CodeChallengeMethodsSupported)
+		assert.Equal(t, []string{"client_secret_basic", "client_secret_post", "none"}, metadata.TokenEndpointAuthMethodsSupported)
+		assert.Equal(t, domain.SupportedScopes, metadata.ScopesSupported)
+	})
+
+	t.Run("sin authorization_code omite el endpoint de autorización", func(t *testing.T) {
+		grantTypes := []string{domain.GrantTypeClientCredentials}
+		w, metadata := getMetadata(grantTypes, "", map[string]string{"X-Forwarded-Proto": "https"})
+
+		// Sin OAUTH_ISSUER se usa el host de la solicitud; X-Forwarded-Proto no se considera
+		assert.Equal(t, "http://api.ejemplo.com", metadata.Issuer)
+		assert.Equal(t, "http://api.ejemplo.com/api/oauth/token", metadata.TokenEndpoint)
+		assert.Equal(t, grantTypes, metadata.GrantTypesSupported)
+		assert.Empty(t, metadata.ResponseTypesSupported)
+		assert.Equal(t, []string{"client_secret_basic", "client_secret_post"}, metadata.TokenEndpointAuthMethodsSupported)
+		assert.NotContains(t, w.Body.String(), "authorization_endpoint")
+		assert.NotContains(t, w.Body.String(), "code_challenge_methods_supported")
+		// El documento se envía tal cual, sin el envoltorio de la API
+		assert.NotContains(t, w.Body.String(), `"status"`)
+	})
+}
@@ -0,0 +1,113 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// APIKeyPrefix antecede a las API keys generadas para reconocerlas en logs y escáneres de secretos
+const APIKeyPrefix = "ak_"
+
+// Errores de autenticación con API key
+var (
+	ErrInvalidAPIKey   = errors.New("API key inválida")
+	ErrAPIKeyRevoked   = errors.New("API key revocada")
+	ErrAPIKeyExpired   = errors.New("API key vencida")
+	ErrInvalidAPIKeyID = errors.New("ID de API key inválido")
+)
+
+// ErrInvalidAPIKeyExpiry se retorna al generar una API key con un vencimiento que ya pasó
+var ErrInvalidAPIKeyExpiry = errors.New("expires_at debe ser una fecha futura")
+
+// Errores al asignar permisos a una API key
+var (
+	ErrUnknownAPIKeyPermission = errors.New("permisos inexistentes")
+	ErrAPIKeyPermissionNotHeld = errors.New("no puede otorgar permisos que no tiene")
+)
+
+// APIKey es una credencial de larga duración para clientes de servicio, alternativa a
+// client_credentials. La clave solo se muestra al crearla; se guarda su hash SHA-256.
+type APIKey struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name        string             `json:"name" bson:"name"`
+	KeyHash     string             `json:"-" bson:"key_hash"`
+	Prefix      string             `json:"prefix" bson:"prefix"` // Primeros caracteres de la clave, para identificarla
+	Scopes      []string           `json:"scopes" bson:"scopes"`
+	Permissions []string           `json:"permissions" bson:"permissions"`
+	CreatedBy   string             `json:"created_by" bson:"created_by"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	RevokedAt   *time.Time         `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	ExpiresAt   *time.Time         `json:"expires_at,omitempty" bson:"expires_at,omitempty"` // nil = sin vencimiento
+}
+
+// Revoked indica si la API key fue revocada
+func (k *APIKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+// Expired indica si la API key tiene vencimiento y ya pasó en now
+func (k *APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// CreateAPIKeyRequest representa la solicitud para generar una API key
+type CreateAPIKeyRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Scopes      []string `json:"scopes"`
+	Permissions []string `json:"permissions"`
+	// Vencimiento opcional (RFC 3339); sin él la API key es válida hasta que se revoque
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// APIKeyResponse representa una API key en las respuestas de la API (sin la clave)
+type APIKeyResponse struct {
+	ID          string           `json:"id"`
+	Name        string           `json:"name"`
+	Prefix      string           `json:"prefix"`
+	Scopes      []string         `json:"scopes"`
+	Permissions []string         `json:"permissions"`
+	CreatedBy   string           `json:"created_by"`
+	CreatedAt   utils.Timestamp  `json:"created_at" swaggertype:"string"`
+	RevokedAt   *utils.Timestamp `json:"revoked_at,omitempty" swaggertype:"string"`
+	ExpiresAt   *utils.Timestamp `json:"expires_at,omitempty" swaggertype:"string"`
+}
+
+// CreateAPIKeyResponse incluye la clave en texto plano; es la única vez que se entrega
+type CreateAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
+// APIKeyRepository define el contrato para la persistencia de API keys
+type APIKeyRepository interface {
+	Create(key *APIKey) error
+	// GetByPrefix retorna las API keys cuyo Prefix es prefix. Prefix no es secreto ni único:
+	// la clave se confirma comparando su hash.
+	GetByPrefix(prefix string) ([]*APIKey, error)
+	GetAll() ([]*APIKey, error)
+	// Revoke marca la API key como revocada; retorna false si no existe o ya estaba revocada
+	Revoke(id string, revokedAt time.Time) (bool, error)
+}
+
+// PermissionCatalog consulta qué códigos de permiso existen. Lo implementa el repositorio de
+// permisos del módulo de permisos.
+type PermissionCatalog interface {
+	GetExistingCodes(codes []string) ([]string, error)
+}
+
+// APIKeyUseCase define el contrato para la capa de casos de uso de API keys
+type APIKeyUseCase interface {
+	// CreateAPIKey retorna ErrUnknownAPIKeyPermission si algún permiso no existe y
+	// ErrAPIKeyPermissionNotHeld si createdBy no tiene alguno de los permisos
+	CreateAPIKey(createdBy string, req *CreateAPIKeyRequest) (*CreateAPIKeyResponse, error)
+	GetAPIKeys() ([]*APIKeyResponse, error)
+	RevokeAPIKey(id string) (bool, error)
+	// Authenticate retorna la API key correspondiente a la clave en texto plano.
+	// Retorna ErrInvalidAPIKey si no existe, ErrAPIKeyRevoked si fue revocada y
+	// ErrAPIKeyExpired si venció.
+	Authenticate(key string) (*APIKey, error)
+}
@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ResponseTypeCode es el único response_type soportado por /oauth/authorize
+const ResponseTypeCode = "code"
+
+// Métodos de code_challenge de PKCE (RFC 7636)
+const (
+	CodeChallengeS256  = "S256"
+	CodeChallengePlain = "plain"
+)
+
+// AuthorizationCodeTTL es la vigencia de un código de autorización
+const AuthorizationCodeTTL = 10 * time.Minute
+
+// Errores del flujo authorization_code
+var (
+	ErrInvalidAuthorizationCode = NewOAuthError(ErrorInvalidGrant, "código de autorización inválido o expirado")
+	ErrMissingCodeVerifier      = NewOAuthError(ErrorInvalidGrant, "se requiere code_verifier")
+	ErrInvalidCodeVerifier      = NewOAuthError(ErrorInvalidGrant, "code_verifier no coincide con el code_challenge")
+	ErrPKCERequired             = NewOAuthError(ErrorInvalidRequest, "los clientes públicos deben enviar code_challenge")
+)
+
+// AuthorizationCode es un código de autorización emitido por /oauth/authorize. Es de un solo uso.
+type AuthorizationCode struct {
+	ID                  primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Code                string             `json:"-" bson:"code"`
+	ClientID            string             `json:"client_id" bson:"client_id"`
+	UserID              string             `json:"user_id" bson:"user_id"`
+	RedirectURI         string             `json:"redirect_uri" bson:"redirect_uri"`
+	Scopes              []string           `json:"scopes" bson:"scopes"`
+	CodeChallenge       string             `json:"-" bson:"code_challenge,omitempty"`
+	CodeChallengeMethod string             `json:"-" bson:"code_challenge_method,omitempty"`
+	AuthTime            time.Time          `json:"-" bson:"auth_time,omitempty"` // Autenticación de la sesión que autorizó; pasa al token emitido
+	ExpiresAt           time.Time          `json:"expires_at" bson:"expires_at"`
+	CreatedAt           time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// AuthorizationCodeRepository define el contrato para la persistencia de códigos de autorización
+type AuthorizationCodeRepository interface {
+	Create(code *AuthorizationCode) error
+	// Consume obtiene y elimina el código en una sola operación; retorna nil si no existe
+	Consume(code string) (*AuthorizationCode, error)
+}
+
+// AuthorizeRequest representa la solicitud a /oauth/authorize
+type AuthorizeRequest struct {
+	ResponseType        string `json:"response_type" form:"response_type" binding:"required"`
+	ClientID            string `json:"client_id" form:"client_id" binding:"required"`
+	RedirectURI         string `json:"redirect_uri" form:"redirect_uri" binding:"required"`
+	Scope               string `json:"scope" form:"scope"`
+	State               string `json:"state" form:"state"`
+	CodeChallenge       string `json:"code_challenge" form:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method" form:"code_challenge_method"`
+	// AuthTime es el momento en que se autenticó la sesión que hace la solicitud (claim
+	// auth_time); lo completa el handler, no el cliente
+	AuthTime time.Time `json:"-" form:"-"`
+}
+
+// AuthorizeResponse contiene el código emitido y la URL de redirección con sus parámetros
+type AuthorizeResponse struct {
+	Code        string `json:"code"`
+	State       string `json:"state,omitempty"`
+	RedirectURI string `json:"redirect_uri"`
+	RedirectTo  string `json:"redirect_to"`
+}
@@ -1,29 +1,140 @@
 package domain
 
 import (
+	"errors"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// SupportedScopes contiene los scopes que pueden asignarse a un cliente
+var SupportedScopes = []string{"read", "write", "admin"}
+
+// IsSupportedScope verifica si un scope puede asignarse a un cliente
+func IsSupportedScope(scope string) bool {
+	for _, s := range SupportedScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Errores de administración de clientes
+var (
+	ErrClientNotFound       = errors.New("cliente no encontrado")
+	ErrInvalidClientRequest = errors.New("configuración de cliente inválida")
 )
 
 // Client representa un cliente OAuth 2.0
 type Client struct {
-	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	ClientID     string             `json:"client_id" bson:"client_id"`
-	ClientSecret string             `json:"client_secret" bson:"client_secret"`
-	Name         string             `json:"name" bson:"name"`
-	RedirectURIs []string           `json:"redirect_uris" bson:"redirect_uris"`
-	GrantTypes   []string           `json:"grant_types" bson:"grant_types"`
-	Scopes       []string           `json:"scopes" bson:"scopes"`
-	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt    time.Time          `json:"updated_at" bson:"updated_at"`
+	ID           primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	ClientID     string              `json:"client_id" bson:"client_id"`
+	ClientSecret string              `json:"client_secret" bson:"client_secret"`
+	Name         string              `json:"name" bson:"name"`
+	RedirectURIs []string            `json:"redirect_uris" bson:"redirect_uris"`
+	GrantTypes   []string            `json:"grant_types" bson:"grant_types"`
+	Scopes       []string            `json:"scopes" bson:"scopes"`
+	GrantScopes  map[string][]string `json:"grant_scopes,omitempty" bson:"grant_scopes,omitempty"` // Scopes permitidos por tipo de concesión
+	OwnerID      string              `json:"owner_id,omitempty" bson:"owner_id,omitempty"`         // Usuario que administra el cliente
+	Public       bool                `json:"public" bson:"public,omitempty"`                       // Cliente público (SPA, móvil): sin secreto, exige PKCE
+	CreatedAt    time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+// AllowedScopes retorna los scopes permitidos (y por defecto) para un tipo de concesión.
+// Si el cliente no define scopes para ese tipo de concesión se usan sus Scopes generales.
+func (c *Client) AllowedScopes(grantType string) []string {
+	if scopes, ok := c.GrantScopes[grantType]; ok {
+		return scopes
+	}
+	return c.Scopes
+}
+
+// AuthorizedClient representa un cliente con sesiones activas de un usuario ("aplicaciones conectadas").
+// LastUsedAt es la emisión más reciente de un token para el cliente (inicio de sesión o renovación)
+// y ExpiresAt la expiración más lejana entre sus sesiones.
+type AuthorizedClient struct {
+	ClientID   string          `json:"client_id"`
+	ClientName string          `json:"client_name,omitempty"`
+	Scopes     []string        `json:"scopes"`
+	Sessions   int             `json:"sessions"`
+	LastUsedAt utils.Timestamp `json:"last_used_at" swaggertype:"string"`
+	ExpiresAt  utils.Timestamp `json:"expires_at" swaggertype:"string"`
+}
+
+// CreateClientRequest representa la solicitud para registrar un cliente OAuth.
+// El client_id y el client_secret los genera el servidor.
+type CreateClientRequest struct {
+	Name         string              `json:"name" binding:"required"`
+	RedirectURIs []string            `json:"redirect_uris"`
+	GrantTypes   []string            `json:"grant_types" binding:"required,min=1"`
+	Scopes       []string            `json:"scopes"`
+	GrantScopes  map[string][]string `json:"grant_scopes"`
+	Public       bool                `json:"public"`
+}
+
+// UpdateClientRequest representa la solicitud para reemplazar la configuración de un cliente.
+// No permite cambiar el client_id, el client_secret ni si el cliente es público.
+type UpdateClientRequest struct {
+	Name         string              `json:"name" binding:"required"`
+	RedirectURIs []string            `json:"redirect_uris"`
+	GrantTypes   []string            `json:"grant_types" binding:"required,min=1"`
+	Scopes       []string            `json:"scopes"`
+	GrantScopes  map[string][]string `json:"grant_scopes"`
+}
+
+// ClientResponse representa un cliente en las respuestas de la API (sin el secreto)
+type ClientResponse struct {
+	ID           string              `json:"id"`
+	ClientID     string              `json:"client_id"`
+	Name         string              `json:"name"`
+	RedirectURIs []string            `json:"redirect_uris"`
+	GrantTypes   []string            `json:"grant_types"`
+	Scopes       []string            `json:"scopes"`
+	GrantScopes  map[string][]string `json:"grant_scopes,omitempty"`
+	OwnerID      string              `json:"owner_id,omitempty"`
+	Public       bool                `json:"public"`
+	CreatedAt    utils.Timestamp     `json:"created_at" swaggertype:"string"`
+	UpdatedAt    utils.Timestamp     `json:"updated_at" swaggertype:"string"`
+}
+
+// CreateClientResponse incluye el client_secret en texto plano; es la única vez que se entrega.
+// Los clientes públicos no tienen secreto.
+type CreateClientResponse struct {
+	ClientResponse
+	ClientSecret string `json:"client_secret,omitempty"`
 }
 
 // ClientRepository define el contrato para la capa de persistencia
 type ClientRepository interface {
+	// GetByClientID retorna ErrClientNotFound si no existe
 	GetByClientID(clientID string) (*Client, error)
+	GetAll() ([]*Client, error)
 	ValidateClient(clientID, clientSecret string) (*Client, error)
 	Create(client *Client) error
 	Update(client *Client) error
 	Delete(id string) error
+	TransferOwnership(fromUserID, toUserID string) (int64, error)
+}
+
+// ClientTokenRevoker elimina las sesiones emitidas a un cliente. Lo implementa el caso de uso de
+// OAuth (RevokeClientTokens).
+type ClientTokenRevoker interface {
+	RevokeClientTokens(clientID string) (int64, error)
+}
+
+// ClientUseCase define el contrato para la administración de clientes OAuth
+type ClientUseCase interface {
+	// CreateClient registra un cliente con client_id y client_secret generados por el servidor
+	CreateClient(ownerID string, req *CreateClientRequest) (*CreateClientResponse, error)
+	GetClients() ([]*ClientResponse, error)
+	GetClient(clientID string) (*ClientResponse, error)
+	UpdateClient(clientID string, req *UpdateClientRequest) (*ClientResponse, error)
+	DeleteClient(clientID string) error
+	// EnsureDefaultClient crea el cliente por defecto si no existe ningún cliente. Retorna nil
+	// sin crear nada si ya hay clientes registrados.
+	EnsureDefaultClient() (*CreateClientResponse, error)
 }
@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Códigos de error de los endpoints OAuth (RFC 6749 §4.1.2.1 y §5.2, RFC 6750 §3.1)
+const (
+	ErrorInvalidRequest          = "invalid_request"
+	ErrorInvalidClient           = "invalid_client"
+	ErrorInvalidGrant            = "invalid_grant"
+	ErrorUnauthorizedClient      = "unauthorized_client"
+	ErrorUnsupportedGrantType    = "unsupported_grant_type"
+	ErrorUnsupportedResponseType = "unsupported_response_type"
+	ErrorInvalidScope            = "invalid_scope"
+	ErrorInvalidToken            = "invalid_token"
+	ErrorServerError             = "server_error"
+)
+
+// OAuthError es un error de los endpoints OAuth con el código y la descripción que
+// RFC 6749 §5.2 define para la respuesta ({"error": ..., "error_description": ...})
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// NewOAuthError crea un error OAuth con el código y la descripción indicados
+func NewOAuthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// Error retorna la descripción del error (o el código si no tiene descripción)
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Description
+}
+
+// StatusCode retorna el estado HTTP de la respuesta: 401 para invalid_client e invalid_token,
+// 500 para server_error y 400 para el resto
+func (e *OAuthError) StatusCode() int {
+	switch e.Code {
+	case ErrorInvalidClient, ErrorInvalidToken:
+		return http.StatusUnauthorized
+	case ErrorServerError:
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// AsOAuthError retorna el OAuthError contenido en err. Cualquier otro error es un fallo
+// interno y se reporta como server_error sin exponer su detalle.
+func AsOAuthError(err error) *OAuthError {
+	var oauthErr *OAuthError
+	if errors.As(err, &oauthErr) {
+		return oauthErr
+	}
+	return NewOAuthError(ErrorServerError, "error interno del servidor")
+}
+
+// Errores del endpoint de tokens
+var (
+	// ErrInvalidClient se retorna cuando el cliente no existe o sus credenciales no son válidas
+	ErrInvalidClient = NewOAuthError(ErrorInvalidClient, "credenciales de cliente inválidas")
+
+	// ErrUnauthorizedClient se retorna cuando el cliente no tiene habilitado el grant_type solicitado
+	ErrUnauthorizedClient = NewOAuthError(ErrorUnauthorizedClient, "tipo de concesión no permitido para este cliente")
+)
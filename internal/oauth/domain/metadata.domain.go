@@ -0,0 +1,26 @@
+package domain
+
+// MetadataPath es la ruta del documento de metadatos del servidor de autorización (RFC 8414)
+const MetadataPath = "/.well-known/oauth-authorization-server"
+
+// ServerMetadata es el documento de descubrimiento del servidor de autorización (RFC 8414), con
+// el que los clientes OAuth se configuran sin conocer de antemano las rutas ni las capacidades
+// del servidor. Los endpoints y concesiones no habilitados se omiten.
+type ServerMetadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported,omitempty"`
+}
+
+// Métodos de autenticación de clientes en el endpoint de tokens (RFC 8414 §2)
+const (
+	ClientAuthSecretBasic = "client_secret_basic" // HTTP Basic
+	ClientAuthSecretPost  = "client_secret_post"  // client_id y client_secret en el cuerpo
+	ClientAuthNone        = "none"                // Clientes públicos
+)
@@ -1,5 +1,11 @@
 package domain
 
+import (
+	"errors"
+
+	userDomain "github.com/black4ninja/mi-proyecto/internal/user/domain"
+)
+
 // GrantType representa los tipos de concesión de OAuth 2.0
 const (
 	GrantTypeAuthorizationCode = "authorization_code"
@@ -8,20 +14,60 @@ const (
 	GrantTypeRefreshToken      = "refresh_token"
 )
 
+// ErrUnsupportedGrantType se retorna cuando el grant_type solicitado no está soportado
+var ErrUnsupportedGrantType = NewOAuthError(ErrorUnsupportedGrantType, "tipo de concesión no soportado")
+
+// ErrInvalidTokenID se retorna cuando el ID de token recibido no es un ObjectID válido
+var ErrInvalidTokenID = errors.New("ID de token inválido")
+
+// ErrTokenNotFound se retorna cuando no existe una sesión con el token indicado
+var ErrTokenNotFound = errors.New("token no encontrado")
+
+// ErrRefreshTokenConsumed indica que el refresh token ya fue canjeado (rotación estricta)
+var ErrRefreshTokenConsumed = NewOAuthError(ErrorInvalidGrant, "refresh token inválido o ya utilizado")
+
+// SupportedGrantTypes contiene los tipos de concesión implementados por el servidor
+var SupportedGrantTypes = []string{
+	GrantTypeAuthorizationCode,
+	GrantTypePassword,
+	GrantTypeClientCredentials,
+	GrantTypeRefreshToken,
+}
+
+// IsSupportedGrantType verifica si un tipo de concesión está soportado
+func IsSupportedGrantType(grantType string) bool {
+	for _, g := range SupportedGrantTypes {
+		if g == grantType {
+			return true
+		}
+	}
+	return false
+}
+
 // TokenType representa los tipos de token
 const (
 	TokenTypeBearer = "Bearer"
 )
 
-// OAuthRequest representa la solicitud de token OAuth 2.0
+// OAuthRequest representa la solicitud de token OAuth 2.0.
+// Los clientes públicos omiten client_secret y se autentican con PKCE (code_verifier).
+// client_id y client_secret pueden enviarse en el cuerpo o en el encabezado Authorization: Basic;
+// el handler los completa desde el encabezado, por eso client_id no se valida en el binding.
 type OAuthRequest struct {
-	GrantType    string `json:"grant_type" binding:"required"`
-	ClientID     string `json:"client_id" binding:"required"`
-	ClientSecret string `json:"client_secret" binding:"required"`
-	Username     string `json:"username"`
-	Password     string `json:"password"`
-	RefreshToken string `json:"refresh_token"`
-	Scope        string `json:"scope"`
+	GrantType    string `json:"grant_type" form:"grant_type" binding:"required"`
+	ClientID     string `json:"client_id" form:"client_id"`
+	ClientSecret string `json:"client_secret" form:"client_secret"`
+	Username     string `json:"username" form:"username"`
+	Password     string `json:"password" form:"password"`
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+	Scope        string `json:"scope" form:"scope"`
+	DeviceID     string `json:"device_id" form:"device_id"`         // Identificador estable del dispositivo (apps móviles)
+	Code         string `json:"code" form:"code"`                   // Grant authorization_code
+	RedirectURI  string `json:"redirect_uri" form:"redirect_uri"`   // Debe coincidir con la usada en /oauth/authorize
+	CodeVerifier string `json:"code_verifier" form:"code_verifier"` // PKCE (RFC 7636)
+	OTP          string `json:"otp" form:"otp"`                     // Código TOTP del grant password si el usuario tiene 2FA
+	NewPassword  string `json:"new_password" form:"new_password"`   // Reemplaza la contraseña temporal en el grant password
+	ClientIP     string `json:"-" form:"-"`                         // IP de la petición; la asigna la capa de entrega
 }
 
 // OAuthResponse representa la respuesta de token OAuth 2.0
@@ -31,12 +77,50 @@ type OAuthResponse struct {
 	ExpiresIn    int    `json:"expires_in"`
 	RefreshToken string `json:"refresh_token,omitempty"`
 	Scope        string `json:"scope,omitempty"`
+
+	// RequestedScope son los scopes solicitados por el cliente; solo se incluye cuando el servidor
+	// está configurado para informarlo y se concedió un subconjunto (o los scopes por defecto)
+	RequestedScope string `json:"requested_scope,omitempty"`
+
+	// User es el perfil del usuario autenticado; solo se incluye en el grant password
+	// cuando el servidor está configurado para ello
+	User *userDomain.UserResponse `json:"user,omitempty"`
 }
 
 // OAuthUseCase define el contrato para la capa de casos de uso
 type OAuthUseCase interface {
 	GenerateToken(req *OAuthRequest) (*OAuthResponse, error)
+	Authorize(userID string, req *AuthorizeRequest) (*AuthorizeResponse, error)
 	ValidateToken(accessToken string) (string, map[string]interface{}, error)
 	ValidateRefreshToken(refreshToken string) (*Token, error)
 	RevokeToken(refreshToken string) error
+	TransferClientOwnership(fromUserID, toUserID string) (int64, error)
+	RefreshClaims(accessToken string) (*OAuthResponse, error)
+	ExpireToken(tokenID string) (bool, error)
+	GetAuthorizedClients(userID string) ([]*AuthorizedClient, error)
+	RevokeClientAuthorization(userID, clientID string) (int64, error)
+	RevokeUserTokens(userID string) (int64, error)     // Elimina todas las sesiones del usuario; retorna cuántas estaban activas
+	RevokeClientTokens(clientID string) (int64, error) // Elimina todas las sesiones emitidas al cliente; retorna cuántas se eliminaron
+	EnabledGrantTypes() []string                       // Tipos de concesión habilitados globalmente
+}
+
+// LoginFailureRecorder registra los inicios de sesión fallidos del grant password con su motivo
+// real (not_found, inactive, bad_password o error), para métricas o auditoría. El cliente
+// siempre recibe el mismo mensaje opaco de credenciales inválidas.
+type LoginFailureRecorder interface {
+	RecordLoginFailure(clientID, username, reason string)
+}
+
+// LoginFailureRecorderFunc permite usar una función como LoginFailureRecorder
+type LoginFailureRecorderFunc func(clientID, username, reason string)
+
+// RecordLoginFailure llama a f
+func (f LoginFailureRecorderFunc) RecordLoginFailure(clientID, username, reason string) {
+	f(clientID, username, reason)
+}
+
+// PermissionResolver resuelve los permisos efectivos de un usuario para incluirlos en el access token.
+// Lo implementa el caso de uso de roles de usuario del módulo de permisos.
+type PermissionResolver interface {
+	GetUserPermissions(userID string) ([]string, error)
 }
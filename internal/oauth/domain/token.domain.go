@@ -1,12 +1,15 @@
 package domain
 
 import (
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// Token representa un token OAuth 2.0
+// Token representa un token OAuth 2.0.
+// El repositorio guarda AccessToken y RefreshToken como hash SHA-256: en los tokens leídos
+// de la base de datos ambos campos contienen el hash, no el valor entregado al cliente.
 type Token struct {
 	ID               primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	AccessToken      string             `json:"access_token" bson:"access_token"`
@@ -17,6 +20,79 @@ type Token struct {
 	ExpiresAt        time.Time          `json:"expires_at" bson:"expires_at"`
 	CreatedAt        time.Time          `json:"created_at" bson:"created_at"`
 	RefreshExpiresAt time.Time          `json:"refresh_expires_at" bson:"refresh_expires_at"`
+	AuthTime         time.Time          `json:"-" bson:"auth_time,omitempty"`   // Momento en que el usuario se autenticó; se conserva al refrescar
+	JTI              string             `json:"-" bson:"jti,omitempty"`         // Identificador (claim jti) del access token JWT
+	ClientName       string             `json:"-" bson:"client_name,omitempty"` // Nombre del cliente; solo se guarda si se emiten los claims del cliente
+	PurgeAt          time.Time          `json:"-" bson:"purge_at,omitempty"`    // Momento a partir del cual la sesión puede eliminarse (índice TTL)
+	Hashed           bool               `json:"-" bson:"hashed,omitempty"`      // AccessToken y RefreshToken se guardan como hash SHA-256
+
+	// Familia de refresh tokens: todas las sesiones obtenidas por rotación desde el mismo inicio de
+	// sesión comparten FamilyID. RotatedRefreshTokens guarda el hash de los refresh tokens ya
+	// canjeados en la familia para detectar su reutilización.
+	FamilyID             string   `json:"-" bson:"family_id,omitempty"`
+	RotatedRefreshTokens []string `json:"-" bson:"rotated_refresh_tokens,omitempty"`
+
+	// DeviceID es el identificador del dispositivo enviado al iniciar sesión; los refresh tokens
+	// de la familia quedan ligados a él (ver DeviceBindingMode)
+	DeviceID string `json:"-" bson:"device_id,omitempty"`
+
+	// Campos de los access tokens opacos: los claims se guardan en el servidor en lugar de en un JWT
+	Opaque      bool     `json:"-" bson:"opaque,omitempty"`
+	Role        string   `json:"-" bson:"role,omitempty"`
+	Permissions []string `json:"-" bson:"permissions,omitempty"`
+}
+
+// DeviceBindingMode define cómo se valida al refrescar que el device_id coincida con el de la sesión
+type DeviceBindingMode string
+
+const (
+	DeviceBindingOff     DeviceBindingMode = "off"     // No se valida (por defecto)
+	DeviceBindingWarn    DeviceBindingMode = "warn"    // Se registra la discrepancia y se permite refrescar
+	DeviceBindingEnforce DeviceBindingMode = "enforce" // Se rechaza el refresco y se revoca la familia de tokens
+)
+
+// ParseDeviceBindingMode convierte el valor de configuración en un modo; los valores
+// desconocidos desactivan la validación
+func ParseDeviceBindingMode(value string) DeviceBindingMode {
+	switch mode := DeviceBindingMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case DeviceBindingWarn, DeviceBindingEnforce:
+		return mode
+	default:
+		return DeviceBindingOff
+	}
+}
+
+// LastExpiry retorna la expiración más lejana entre el access token y el refresh token.
+// Los tokens sin refresh token (client_credentials) tienen RefreshExpiresAt en cero y
+// expiran con su access token.
+func (t *Token) LastExpiry() time.Time {
+	if t.RefreshExpiresAt.After(t.ExpiresAt) {
+		return t.RefreshExpiresAt
+	}
+	return t.ExpiresAt
+}
+
+// Claims retorna los claims guardados de un token opaco con las mismas claves que un JWT
+// decodificado (user_id, role, scopes, permissions, exp, iat, auth_time, client_id, client_name)
+func (t *Token) Claims() map[string]interface{} {
+	claims := map[string]interface{}{
+		"user_id": t.UserID,
+		"role":    t.Role,
+		"scopes":  t.Scopes,
+		"exp":     float64(t.ExpiresAt.Unix()),
+		"iat":     float64(t.CreatedAt.Unix()),
+	}
+	if len(t.Permissions) > 0 {
+		claims["permissions"] = t.Permissions
+	}
+	if !t.AuthTime.IsZero() {
+		claims["auth_time"] = float64(t.AuthTime.Unix())
+	}
+	if t.ClientName != "" {
+		claims["client_id"] = t.ClientID
+		claims["client_name"] = t.ClientName
+	}
+	return claims
 }
 
 // TokenRepository define el contrato para la capa de persistencia
@@ -25,5 +101,33 @@ type TokenRepository interface {
 	GetByAccessToken(accessToken string) (*Token, error)
 	GetByRefreshToken(refreshToken string) (*Token, error)
 	DeleteByRefreshToken(refreshToken string) error
+	// ConsumeRefreshToken elimina atómicamente la sesión del refresh token y la retorna
+	// (nil si no existía). Solo una de varias llamadas concurrentes obtiene el token.
+	ConsumeRefreshToken(refreshToken string) (*Token, error)
 	DeleteByUserID(userID string) error
+	// GetActiveByUserID retorna los tokens del usuario cuyo access token o refresh token no ha expirado
+	GetActiveByUserID(userID string) ([]*Token, error)
+	// GetActiveByClientID retorna los tokens del cliente cuyo access token o refresh token no ha expirado
+	GetActiveByClientID(clientID string) ([]*Token, error)
+	DeleteByClientID(clientID string) (int64, error)             // Elimina todos los tokens del cliente; retorna cuántos se eliminaron
+	UpdateAccessToken(oldAccessToken string, token *Token) error // Reemplaza el access token y sus claims guardados
+	// DeleteByID elimina un token por su ObjectID y retorna el token eliminado (nil si no existía)
+	DeleteByID(id string) (*Token, error)
+	// DeleteExpired elimina las sesiones cuyo access token y refresh token expiraron antes de
+	// before y retorna cuántas se eliminaron
+	DeleteExpired(before time.Time) (int64, error)
+	// GetByRotatedRefreshToken retorna la sesión vigente de la familia en la que el refresh token
+	// ya fue canjeado (nil si no pertenece a ninguna)
+	GetByRotatedRefreshToken(refreshToken string) (*Token, error)
+	// DeleteByFamily elimina todas las sesiones de una familia de refresh tokens y retorna cuántas
+	// se eliminaron
+	DeleteByFamily(familyID string) (int64, error)
+}
+
+// RevocationList define el contrato para la lista de access tokens revocados antes de su
+// expiración. En modo sin estado los JWT se validan sin consultar la sesión, por lo que
+// revocarlos requiere registrar su identificador (jti) hasta que expiren.
+type RevocationList interface {
+	Revoke(jti string, expiresAt time.Time) error
+	IsRevoked(jti string) (bool, error)
 }
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/black4ninja/mi-proyecto/internal/oauth/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+func TestClientSecretStoredHashed(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("Create guarda el hash bcrypt", func(mt *mtest.T) {
+		repo := NewMongoClientRepository(mt.Coll)
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		client := &domain.Client{ClientID: "erp", ClientSecret: "secreto-claro"}
+
+		require.NoError(mt, repo.Create(client))
+
+		doc := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		stored := doc.Lookup("client_secret").StringValue()
+		assert.NotEqual(mt, "secreto-claro", stored)
+		assert.True(mt, utils.CheckPasswordHash("secreto-claro", stored))
+		assert.Equal(mt, "secreto-claro", client.ClientSecret, "el llamador conserva el secreto para entregarlo")
+	})
+
+	mt.Run("ValidateClient busca por client_id y compara el hash", func(mt *mtest.T) {
+		repo := NewMongoClientRepository(mt.Coll)
+		hashed, err := utils.HashPassword("secreto-claro")
+		require.NoError(mt, err)
+		clientDoc := bson.D{{Key: "client_id", Value: "erp"}, {Key: "client_secret", Value: hashed}}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.oauth_clients", mtest.FirstBatch, clientDoc),
+			mtest.CreateCursorResponse(0, "db.oauth_clients", mtest.FirstBatch, clientDoc),
+		)
+
+		client, err := repo.ValidateClient("erp", "secreto-claro")
+		require.NoError(mt, err)
+		assert.Equal(mt, "erp", client.ClientID)
+
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		_, err = filter.LookupErr("client_secret")
+		assert.Error(mt, err, "el secreto no forma parte de la consulta")
+
+		_, err = repo.ValidateClient("erp", "otro-secreto")
+		assert.Error(mt, err)
+	})
+
+	mt.Run("un secreto en texto plano se acepta y se migra", func(mt *mtest.T) {
+		repo := NewMongoClientRepository(mt.Coll)
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.oauth_clients", mtest.FirstBatch, bson.D{
+				{Key: "client_id", Value: "erp"},
+				{Key: "client_secret", Value: "secreto-claro"},
+			}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+
+		_, err := repo.ValidateClient("erp", "secreto-claro")
+		require.NoError(mt, err)
+
+		mt.GetStartedEvent() // find
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.True(mt, utils.CheckPasswordHash("secreto-claro", update.Lookup("u", "$set", "client_secret").StringValue()))
+	})
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/black4ninja/mi-proyecto/internal/oauth/domain"
+)
+
+type mongoAPIKeyRepository struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+}
+
+// NewMongoAPIKeyRepository crea un nuevo repositorio de API keys con MongoDB
+func NewMongoAPIKeyRepository(collection *mongo.Collection) domain.APIKeyRepository {
+	return &mongoAPIKeyRepository{
+		collection: collection,
+		timeout:    10 * time.Second,
+	}
+}
+
+// EnsureAPIKeyIndexes crea el índice único sobre el hash de la clave y el índice sobre el
+// prefijo con el que se buscan las claves al autenticar. Es idempotente.
+func EnsureAPIKeyIndexes(collection *mongo.Collection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "key_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "prefix", Value: 1}}},
+	})
+	return err
+}
+
+// Create guarda una nueva API key
+func (r *mongoAPIKeyRepository) Create(key *domain.APIKey) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	key.ID = primitive.NewObjectID()
+	_, err := r.collection.InsertOne(ctx, key)
+	return err
+}
+
+// GetByPrefix obtiene las API keys con ese prefijo visible
+func (r *mongoAPIKeyRepository) GetByPrefix(prefix string) ([]*domain.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, bson.M{"prefix": prefix})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var keys []*domain.APIKey
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// GetAll obtiene todas las API keys, de la más reciente a la más antigua
+func (r *mongoAPIKeyRepository) GetAll() ([]*domain.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var keys []*domain.APIKey
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Revoke marca una API key como revocada. Las claves ya revocadas conservan su fecha de revocación.
+func (r *mongoAPIKeyRepository) Revoke(id string, revokedAt time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, domain.ErrInvalidAPIKeyID
+	}
+
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": objID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": revokedAt}},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/black4ninja/mi-proyecto/internal/oauth/domain"
+)
+
+type mongoAuthorizationCodeRepository struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+}
+
+// NewMongoAuthorizationCodeRepository crea un repositorio de códigos de autorización con MongoDB
+func NewMongoAuthorizationCodeRepository(collection *mongo.Collection) domain.AuthorizationCodeRepository {
+	return &mongoAuthorizationCodeRepository{
+		collection: collection,
+		timeout:    10 * time.Second,
+	}
+}
+
+// EnsureAuthorizationCodeIndexes crea el índice único por código y el índice TTL que elimina
+// los códigos expirados. Es idempotente.
+func EnsureAuthorizationCodeIndexes(collection *mongo.Collection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "code", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// Create guarda un nuevo código de autorización
+func (r *mongoAuthorizationCodeRepository) Create(code *domain.AuthorizationCode) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	code.ID = primitive.NewObjectID()
+	_, err := r.collection.InsertOne(ctx, code)
+	return err
+}
+
+// Consume obtiene y elimina el código de forma atómica, de modo que solo pueda canjearse una vez
+func (r *mongoAuthorizationCodeRepository) Consume(code string) (*domain.AuthorizationCode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	var authCode domain.AuthorizationCode
+	err := r.collection.FindOneAndDelete(ctx, bson.M{"code": code}).Decode(&authCode)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &authCode, nil
+}
@@ -2,14 +2,17 @@ package repository
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"github.com/black4ninja/mi-proyecto/internal/oauth/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
 )
 
 type mongoClientRepository struct {
@@ -25,6 +28,46 @@ func NewMongoClientRepository(collection *mongo.Collection) domain.ClientReposit
 	}
 }
 
+// MigratePlaintextClientSecrets reemplaza por su hash bcrypt los secretos de cliente guardados
+// en texto plano y retorna cuántos se migraron. Es idempotente: los secretos ya hasheados se omiten.
+func MigratePlaintextClientSecrets(collection *mongo.Collection) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.M{"client_secret": bson.M{"$nin": bson.A{"", nil}}},
+		options.Find().SetProjection(bson.M{"client_secret": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var migrated int64
+	for cursor.Next(ctx) {
+		var legacy domain.Client
+		if err := cursor.Decode(&legacy); err != nil {
+			return migrated, err
+		}
+		if utils.IsPasswordHash(legacy.ClientSecret) {
+			continue
+		}
+		hashed, err := utils.HashPassword(legacy.ClientSecret)
+		if err != nil {
+			return migrated, err
+		}
+		// El filtro por el valor anterior evita sobrescribir un secreto migrado en paralelo
+		result, err := collection.UpdateOne(ctx,
+			bson.M{"_id": legacy.ID, "client_secret": legacy.ClientSecret},
+			bson.M{"$set": bson.M{"client_secret": hashed}},
+		)
+		if err != nil {
+			return migrated, err
+		}
+		migrated += result.ModifiedCount
+	}
+
+	return migrated, cursor.Err()
+}
+
 // GetByClientID obtiene un cliente por su ID de cliente
 func (r *mongoClientRepository) GetByClientID(clientID string) (*domain.Client, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
@@ -34,7 +77,7 @@ func (r *mongoClientRepository) GetByClientID(clientID string) (*domain.Client,
 	err := r.collection.FindOne(ctx, bson.M{"client_id": clientID}).Decode(&client)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("cliente no encontrado")
+			return nil, domain.ErrClientNotFound
 		}
 		return nil, err
 	}
@@ -42,24 +85,62 @@ func (r *mongoClientRepository) GetByClientID(clientID string) (*domain.Client,
 	return &client, nil
 }
 
-// ValidateClient valida las credenciales de un cliente
+// GetAll obtiene todos los clientes ordenados por fecha de creación
+func (r *mongoClientRepository) GetAll() ([]*domain.Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var clients []*domain.Client
+	if err := cursor.All(ctx, &clients); err != nil {
+		return nil, err
+	}
+
+	return clients, nil
+}
+
+// ValidateClient valida las credenciales de un cliente comparando el secreto con su hash bcrypt.
+// Un secreto aún guardado en texto plano (anterior al hash) se compara en tiempo constante y se
+// reemplaza por su hash.
 func (r *mongoClientRepository) ValidateClient(clientID, clientSecret string) (*domain.Client, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
 
-	var client domain.Client
-	err := r.collection.FindOne(ctx, bson.M{
-		"client_id":     clientID,
-		"client_secret": clientSecret,
-	}).Decode(&client)
+	invalid := errors.New("credenciales de cliente inválidas")
 
+	var client domain.Client
+	err := r.collection.FindOne(ctx, bson.M{"client_id": clientID}).Decode(&client)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("credenciales de cliente inválidas")
+			return nil, invalid
 		}
 		return nil, err
 	}
+	if client.ClientSecret == "" || clientSecret == "" {
+		return nil, invalid
+	}
+
+	if utils.IsPasswordHash(client.ClientSecret) {
+		if !utils.CheckPasswordHash(clientSecret, client.ClientSecret) {
+			return nil, invalid
+		}
+		return &client, nil
+	}
 
+	if subtle.ConstantTimeCompare([]byte(client.ClientSecret), []byte(clientSecret)) != 1 {
+		return nil, invalid
+	}
+	if hashed, err := utils.HashPassword(clientSecret); err == nil {
+		_, _ = r.collection.UpdateOne(ctx,
+			bson.M{"_id": client.ID, "client_secret": client.ClientSecret},
+			bson.M{"$set": bson.M{"client_secret": hashed}},
+		)
+	}
 	return &client, nil
 }
 
@@ -69,7 +150,18 @@ func (r *mongoClientRepository) Create(client *domain.Client) error {
 	defer cancel()
 
 	client.ID = primitive.NewObjectID()
-	_, err := r.collection.InsertOne(ctx, client)
+
+	// Se guarda una copia con el secreto hasheado; el llamador conserva el original para
+	// entregarlo una única vez. Los clientes públicos no tienen secreto.
+	stored := *client
+	if client.ClientSecret != "" {
+		hashed, err := utils.HashPassword(client.ClientSecret)
+		if err != nil {
+			return err
+		}
+		stored.ClientSecret = hashed
+	}
+	_, err := r.collection.InsertOne(ctx, &stored)
 	return err
 }
 
@@ -84,6 +176,8 @@ func (r *mongoClientRepository) Update(client *domain.Client) error {
 			"redirect_uris": client.RedirectURIs,
 			"grant_types":   client.GrantTypes,
 			"scopes":        client.Scopes,
+			"grant_scopes":  client.GrantScopes,
+			"public":        client.Public,
 			"updated_at":    time.Now(),
 		},
 	}
@@ -109,3 +203,11 @@ func (r *mongoClientRepository) Delete(id string) error {
 	_, err = r.collection.DeleteOne(ctx, bson.M{"_id": objID})
 	return err
 }
+
+// TransferOwnership reasigna todos los clientes de un usuario a otro
+func (r *mongoClientRepository) TransferOwnership(fromUserID, toUserID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	return utils.TransferOwnership(ctx, r.collection, fromUserID, toUserID)
+}
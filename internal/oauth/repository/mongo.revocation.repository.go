@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/black4ninja/mi-proyecto/internal/oauth/domain"
+)
+
+type mongoRevocationList struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+}
+
+// NewMongoRevocationList crea una lista de revocación de JTI con MongoDB.
+// Cada documento usa el jti como _id y guarda la expiración del token revocado.
+func NewMongoRevocationList(collection *mongo.Collection) domain.RevocationList {
+	return &mongoRevocationList{
+		collection: collection,
+		timeout:    10 * time.Second,
+	}
+}
+
+// EnsureRevocationIndexes crea el índice TTL que elimina las entradas cuando el token
+// revocado expira. Es idempotente.
+func EnsureRevocationIndexes(collection *mongo.Collection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// Revoke registra un jti como revocado hasta su expiración
+func (r *mongoRevocationList) Revoke(jti string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{"expires_at": expiresAt},
+		"$setOnInsert": bson.M{
+			"revoked_at": time.Now(),
+		},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": jti}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// IsRevoked indica si un jti está revocado. Las entradas expiradas se ignoran aunque
+// el índice TTL aún no las haya eliminado.
+func (r *mongoRevocationList) IsRevoked(jti string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	count, err := r.collection.CountDocuments(ctx, bson.M{
+		"_id":        jti,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
@@ -2,27 +2,98 @@ package repository
 
 import (
 	"context"
-	"errors"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"github.com/black4ninja/mi-proyecto/internal/oauth/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
 )
 
 type mongoTokenRepository struct {
-	collection *mongo.Collection
-	timeout    time.Duration
+	collection      *mongo.Collection
+	timeout         time.Duration
+	plaintextLookup bool
 }
 
-// NewMongoTokenRepository crea un nuevo repositorio de tokens con MongoDB
-func NewMongoTokenRepository(collection *mongo.Collection) domain.TokenRepository {
+// EnsureTokenTTLIndex crea un índice TTL sobre purge_at para que MongoDB elimine las sesiones
+// cuando expiran tanto el access token como el refresh token. Es una alternativa al barrido
+// periódico con DeleteExpired; las sesiones guardadas antes de existir purge_at solo las
+// elimina el barrido. Es idempotente.
+func EnsureTokenTTLIndex(collection *mongo.Collection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "purge_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// NewMongoTokenRepository crea un nuevo repositorio de tokens con MongoDB.
+// Los access y refresh tokens se guardan como hash SHA-256 y las búsquedas hashean el valor
+// recibido. Si plaintextLookup es true también se aceptan las sesiones guardadas en texto plano
+// antes de este cambio (ventana de transición; ver MigratePlaintextTokens).
+func NewMongoTokenRepository(collection *mongo.Collection, plaintextLookup bool) domain.TokenRepository {
 	return &mongoTokenRepository{
-		collection: collection,
-		timeout:    10 * time.Second,
+		collection:      collection,
+		timeout:         10 * time.Second,
+		plaintextLookup: plaintextLookup,
+	}
+}
+
+// MigratePlaintextTokens reemplaza por su hash los tokens de las sesiones guardadas en texto
+// plano y retorna cuántas se migraron. Es idempotente: las sesiones ya hasheadas se omiten.
+func MigratePlaintextTokens(collection *mongo.Collection) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.M{"hashed": bson.M{"$ne": true}},
+		options.Find().SetProjection(bson.M{"access_token": 1, "refresh_token": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var migrated int64
+	for cursor.Next(ctx) {
+		var legacy domain.Token
+		if err := cursor.Decode(&legacy); err != nil {
+			return migrated, err
+		}
+		result, err := collection.UpdateOne(ctx,
+			bson.M{"_id": legacy.ID, "hashed": bson.M{"$ne": true}},
+			bson.M{"$set": bson.M{
+				"access_token":  utils.HashToken(legacy.AccessToken),
+				"refresh_token": utils.HashToken(legacy.RefreshToken),
+				"hashed":        true,
+			}},
+		)
+		if err != nil {
+			return migrated, err
+		}
+		migrated += result.ModifiedCount
 	}
+
+	return migrated, cursor.Err()
+}
+
+// tokenFilter construye el filtro de búsqueda por access_token o refresh_token. Con la búsqueda
+// en texto plano habilitada también coincide con sesiones no migradas; nunca con las hasheadas,
+// para que un hash filtrado no pueda usarse como token.
+func (r *mongoTokenRepository) tokenFilter(field, value string) bson.M {
+	hashed := bson.M{field: utils.HashToken(value)}
+	if !r.plaintextLookup {
+		return hashed
+	}
+	return bson.M{"$or": []bson.M{
+		hashed,
+		{field: value, "hashed": bson.M{"$ne": true}},
+	}}
 }
 
 // Create crea un nuevo token
@@ -31,7 +102,17 @@ func (r *mongoTokenRepository) Create(token *domain.Token) error {
 	defer cancel()
 
 	token.ID = primitive.NewObjectID()
-	_, err := r.collection.InsertOne(ctx, token)
+	token.PurgeAt = token.LastExpiry()
+	if token.FamilyID == "" {
+		token.FamilyID = token.ID.Hex() // Inicio de una nueva familia de refresh tokens
+	}
+
+	// Se guarda una copia con los tokens hasheados; el llamador conserva los originales
+	stored := *token
+	stored.AccessToken = utils.HashToken(token.AccessToken)
+	stored.RefreshToken = utils.HashToken(token.RefreshToken)
+	stored.Hashed = true
+	_, err := r.collection.InsertOne(ctx, &stored)
 	return err
 }
 
@@ -41,10 +122,10 @@ func (r *mongoTokenRepository) GetByAccessToken(accessToken string) (*domain.Tok
 	defer cancel()
 
 	var token domain.Token
-	err := r.collection.FindOne(ctx, bson.M{"access_token": accessToken}).Decode(&token)
+	err := r.collection.FindOne(ctx, r.tokenFilter("access_token", accessToken)).Decode(&token)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("token no encontrado")
+			return nil, domain.ErrTokenNotFound
 		}
 		return nil, err
 	}
@@ -58,10 +139,10 @@ func (r *mongoTokenRepository) GetByRefreshToken(refreshToken string) (*domain.T
 	defer cancel()
 
 	var token domain.Token
-	err := r.collection.FindOne(ctx, bson.M{"refresh_token": refreshToken}).Decode(&token)
+	err := r.collection.FindOne(ctx, r.tokenFilter("refresh_token", refreshToken)).Decode(&token)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("token no encontrado")
+			return nil, domain.ErrTokenNotFound
 		}
 		return nil, err
 	}
@@ -74,10 +155,28 @@ func (r *mongoTokenRepository) DeleteByRefreshToken(refreshToken string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
 
-	_, err := r.collection.DeleteOne(ctx, bson.M{"refresh_token": refreshToken})
+	_, err := r.collection.DeleteOne(ctx, r.tokenFilter("refresh_token", refreshToken))
 	return err
 }
 
+// ConsumeRefreshToken elimina la sesión del refresh token con FindOneAndDelete y la retorna.
+// Retorna nil si no existía, por ejemplo porque otra solicitud concurrente ya la consumió.
+func (r *mongoTokenRepository) ConsumeRefreshToken(refreshToken string) (*domain.Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	var token domain.Token
+	err := r.collection.FindOneAndDelete(ctx, r.tokenFilter("refresh_token", refreshToken)).Decode(&token)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
 // DeleteByUserID elimina todos los tokens de un usuario
 func (r *mongoTokenRepository) DeleteByUserID(userID string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
@@ -86,3 +185,185 @@ func (r *mongoTokenRepository) DeleteByUserID(userID string) error {
 	_, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
 	return err
 }
+
+// GetActiveByUserID retorna los tokens del usuario cuyo access token o refresh token no ha expirado
+func (r *mongoTokenRepository) GetActiveByUserID(userID string) ([]*domain.Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	now := time.Now()
+	cursor, err := r.collection.Find(ctx, bson.M{
+		"user_id": userID,
+		"$or": []bson.M{
+			{"expires_at": bson.M{"$gt": now}},
+			{"refresh_expires_at": bson.M{"$gt": now}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var tokens []*domain.Token
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// GetActiveByClientID retorna los tokens del cliente cuyo access token o refresh token no ha expirado
+func (r *mongoTokenRepository) GetActiveByClientID(clientID string) ([]*domain.Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	now := time.Now()
+	cursor, err := r.collection.Find(ctx, bson.M{
+		"client_id": clientID,
+		"$or": []bson.M{
+			{"expires_at": bson.M{"$gt": now}},
+			{"refresh_expires_at": bson.M{"$gt": now}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var tokens []*domain.Token
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// DeleteByClientID elimina todos los tokens de un cliente y retorna cuántos se eliminaron
+func (r *mongoTokenRepository) DeleteByClientID(clientID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	result, err := r.collection.DeleteMany(ctx, bson.M{"client_id": clientID})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// UpdateAccessToken reemplaza el access token de una sesión manteniendo su refresh token.
+// También actualiza la expiración y los claims guardados (tokens opacos). Una sesión aún
+// guardada en texto plano queda migrada: también se hashea su refresh token.
+func (r *mongoTokenRepository) UpdateAccessToken(oldAccessToken string, token *domain.Token) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	var previous domain.Token
+	err := r.collection.FindOneAndUpdate(
+		ctx,
+		r.tokenFilter("access_token", oldAccessToken),
+		bson.M{"$set": bson.M{
+			"access_token": utils.HashToken(token.AccessToken),
+			"expires_at":   token.ExpiresAt,
+			"purge_at":     token.LastExpiry(),
+			"opaque":       token.Opaque,
+			"role":         token.Role,
+			"permissions":  token.Permissions,
+			"hashed":       true,
+		}},
+		options.FindOneAndUpdate().SetProjection(bson.M{"refresh_token": 1, "hashed": 1}),
+	).Decode(&previous)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return domain.ErrTokenNotFound
+		}
+		return err
+	}
+
+	if !previous.Hashed && previous.RefreshToken != "" {
+		_, err = r.collection.UpdateOne(ctx,
+			bson.M{"_id": previous.ID},
+			bson.M{"$set": bson.M{"refresh_token": utils.HashToken(previous.RefreshToken)}},
+		)
+	}
+	return err
+}
+
+// DeleteByID elimina un token por su ObjectID y retorna el documento eliminado.
+// Si no existe ningún token con ese ID retorna nil sin error.
+func (r *mongoTokenRepository) DeleteByID(id string) (*domain.Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, domain.ErrInvalidTokenID
+	}
+
+	var token domain.Token
+	err = r.collection.FindOneAndDelete(ctx, bson.M{"_id": objectID}).Decode(&token)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// DeleteExpired elimina las sesiones cuyo access token expiró antes de before y cuyo refresh
+// token también expiró o no existe. Los tokens client_credentials guardan refresh_expires_at
+// con la fecha cero, por lo que se eliminan en cuanto expira su access token.
+func (r *mongoTokenRepository) DeleteExpired(before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	result, err := r.collection.DeleteMany(ctx, bson.M{
+		"expires_at": bson.M{"$lt": before},
+		"$or": []bson.M{
+			{"refresh_expires_at": bson.M{"$lt": before}},
+			{"refresh_expires_at": nil}, // Nulo o ausente
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// GetByRotatedRefreshToken busca la sesión cuyo historial de rotación contiene el hash del
+// refresh token. Retorna nil si no existe. El historial solo guarda hashes, por lo que no
+// aplica la búsqueda en texto plano.
+func (r *mongoTokenRepository) GetByRotatedRefreshToken(refreshToken string) (*domain.Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	var token domain.Token
+	err := r.collection.FindOne(ctx, bson.M{"rotated_refresh_tokens": utils.HashToken(refreshToken)}).Decode(&token)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// DeleteByFamily elimina todas las sesiones de una familia de refresh tokens
+func (r *mongoTokenRepository) DeleteByFamily(familyID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	if familyID == "" {
+		return 0, nil
+	}
+
+	result, err := r.collection.DeleteMany(ctx, bson.M{"family_id": familyID})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/black4ninja/mi-proyecto/internal/oauth/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+func TestTokenCreateSetsPurgeAt(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	now := time.Now().Truncate(time.Millisecond)
+
+	tests := []struct {
+		name  string
+		token *domain.Token
+		want  time.Time
+	}{
+		{
+			name:  "sesión con refresh token",
+			token: &domain.Token{ExpiresAt: now.Add(time.Hour), RefreshExpiresAt: now.Add(24 * time.Hour)},
+			want:  now.Add(24 * time.Hour),
+		},
+		{
+			name:  "client_credentials sin refresh token",
+			token: &domain.Token{ExpiresAt: now.Add(time.Hour)},
+			want:  now.Add(time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			repo := NewMongoTokenRepository(mt.Coll, false)
+			mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+			require.NoError(mt, repo.Create(tt.token))
+
+			doc := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+			assert.True(mt, tt.want.Equal(doc.Lookup("purge_at").Time()))
+		})
+	}
+}
+
+func TestTokenDeleteExpired(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("exige que expiren el access token y el refresh token", func(mt *mtest.T) {
+		repo := NewMongoTokenRepository(mt.Coll, false)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 4}))
+		before := time.Now().Truncate(time.Millisecond)
+
+		deleted, err := repo.DeleteExpired(before)
+		require.NoError(mt, err)
+		assert.Equal(mt, int64(4), deleted)
+
+		filter := mt.GetStartedEvent().Command.Lookup("deletes").Array().Index(0).Value().Document().Lookup("q").Document()
+		assert.True(mt, before.Equal(filter.Lookup("expires_at", "$lt").Time()))
+
+		conditions, err := filter.Lookup("$or").Array().Values()
+		require.NoError(mt, err)
+		require.Len(mt, conditions, 2)
+		assert.True(mt, before.Equal(conditions[0].Document().Lookup("refresh_expires_at", "$lt").Time()))
+		// Los documentos sin refresh_expires_at también se consideran expirados
+		assert.Equal(mt, bson.TypeNull, conditions[1].Document().Lookup("refresh_expires_at").Type)
+	})
+}
+
+func TestTokenStoredHashed(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("Create guarda solo el hash", func(mt *mtest.T) {
+		repo := NewMongoTokenRepository(mt.Coll, false)
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		token := &domain.Token{AccessToken: "access-claro", RefreshToken: "refresh-claro", ExpiresAt: time.Now()}
+
+		require.NoError(mt, repo.Create(token))
+
+		doc := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		assert.Equal(mt, utils.HashToken("access-claro"), doc.Lookup("access_token").StringValue())
+		assert.Equal(mt, utils.HashToken("refresh-claro"), doc.Lookup("refresh_token").StringValue())
+		assert.True(mt, doc.Lookup("hashed").Boolean())
+		assert.Equal(mt, "access-claro", token.AccessToken, "el llamador conserva el token para entregarlo")
+	})
+
+	mt.Run("la búsqueda hashea el valor recibido", func(mt *mtest.T) {
+		repo := NewMongoTokenRepository(mt.Coll, false)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.tokens", mtest.FirstBatch, bson.D{
+			{Key: "refresh_token", Value: utils.HashToken("refresh-claro")},
+		}))
+
+		_, err := repo.GetByRefreshToken("refresh-claro")
+		require.NoError(mt, err)
+
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		assert.Equal(mt, utils.HashToken("refresh-claro"), filter.Lookup("refresh_token").StringValue())
+	})
+
+	mt.Run("en transición acepta sesiones en texto plano no migradas", func(mt *mtest.T) {
+		repo := NewMongoTokenRepository(mt.Coll, true)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.tokens", mtest.FirstBatch, bson.D{
+			{Key: "access_token", Value: "access-claro"},
+		}))
+
+		_, err := repo.GetByAccessToken("access-claro")
+		require.NoError(mt, err)
+
+		conditions, err := mt.GetStartedEvent().Command.Lookup("filter", "$or").Array().Values()
+		require.NoError(mt, err)
+		require.Len(mt, conditions, 2)
+		assert.Equal(mt, utils.HashToken("access-claro"), conditions[0].Document().Lookup("access_token").StringValue())
+		legacy := conditions[1].Document()
+		assert.Equal(mt, "access-claro", legacy.Lookup("access_token").StringValue())
+		// Un hash filtrado no sirve como token: las sesiones hasheadas no coinciden en claro
+		assert.True(mt, legacy.Lookup("hashed", "$ne").Boolean())
+	})
+}
+
+func TestTokenFamily(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("una sesión nueva inicia su propia familia", func(mt *mtest.T) {
+		repo := NewMongoTokenRepository(mt.Coll, false)
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		token := &domain.Token{ExpiresAt: time.Now()}
+
+		require.NoError(mt, repo.Create(token))
+
+		assert.Equal(mt, token.ID.Hex(), token.FamilyID)
+		doc := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		assert.Equal(mt, token.ID.Hex(), doc.Lookup("family_id").StringValue())
+	})
+
+	mt.Run("una rotación conserva la familia", func(mt *mtest.T) {
+		repo := NewMongoTokenRepository(mt.Coll, false)
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		token := &domain.Token{ExpiresAt: time.Now(), FamilyID: "familia-1"}
+
+		require.NoError(mt, repo.Create(token))
+		assert.Equal(mt, "familia-1", token.FamilyID)
+	})
+
+	mt.Run("el historial se busca por hash", func(mt *mtest.T) {
+		repo := NewMongoTokenRepository(mt.Coll, true)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.tokens", mtest.FirstBatch))
+
+		session, err := repo.GetByRotatedRefreshToken("refresh-canjeado")
+		require.NoError(mt, err)
+		assert.Nil(mt, session)
+
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		assert.Equal(mt, utils.HashToken("refresh-canjeado"), filter.Lookup("rotated_refresh_tokens").StringValue())
+	})
+
+	mt.Run("DeleteByFamily elimina todas las sesiones de la familia", func(mt *mtest.T) {
+		repo := NewMongoTokenRepository(mt.Coll, false)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}))
+
+		deleted, err := repo.DeleteByFamily("familia-1")
+		require.NoError(mt, err)
+		assert.Equal(mt, int64(2), deleted)
+
+		filter := mt.GetStartedEvent().Command.Lookup("deletes").Array().Index(0).Value().Document().Lookup("q").Document()
+		assert.Equal(mt, "familia-1", filter.Lookup("family_id").StringValue())
+	})
+}
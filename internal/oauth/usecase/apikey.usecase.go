@@ -0,0 +1,199 @@
+package usecase
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/black4ninja/mi-proyecto/internal/oauth/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// apiKeyVisibleChars es la cantidad de caracteres aleatorios de la clave que se guardan
+// en claro (Prefix) para que el administrador pueda identificarla
+const apiKeyVisibleChars = 8
+
+// apiKeyPrefixLength es la longitud del Prefix guardado de cada API key
+const apiKeyPrefixLength = len(domain.APIKeyPrefix) + apiKeyVisibleChars
+
+type apiKeyUseCase struct {
+	repo        domain.APIKeyRepository
+	permissions domain.PermissionResolver
+	catalog     domain.PermissionCatalog
+	now         func() time.Time
+}
+
+// NewAPIKeyUseCase crea un nuevo caso de uso para API keys. permissions resuelve los permisos
+// efectivos de quien genera la clave y catalog los códigos existentes.
+func NewAPIKeyUseCase(repo domain.APIKeyRepository, permissions domain.PermissionResolver, catalog domain.PermissionCatalog) domain.APIKeyUseCase {
+	return &apiKeyUseCase{
+		repo:        repo,
+		permissions: permissions,
+		catalog:     catalog,
+		now:         time.Now,
+	}
+}
+
+// CreateAPIKey genera una API key aleatoria y guarda solo su hash.
+// La clave en texto plano se retorna únicamente en esta respuesta.
+func (u *apiKeyUseCase) CreateAPIKey(createdBy string, req *domain.CreateAPIKeyRequest) (*domain.CreateAPIKeyResponse, error) {
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(u.now()) {
+		return nil, domain.ErrInvalidAPIKeyExpiry
+	}
+	if err := u.checkPermissions(createdBy, req.Permissions); err != nil {
+		return nil, err
+	}
+
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	key := domain.APIKeyPrefix + secret
+
+	apiKey := &domain.APIKey{
+		Name:        strings.TrimSpace(req.Name),
+		KeyHash:     utils.HashToken(key), // 256 bits aleatorios: basta SHA-256, sin hash lento
+		Prefix:      key[:apiKeyPrefixLength],
+		Scopes:      nonNilStrings(req.Scopes),
+		Permissions: nonNilStrings(req.Permissions),
+		CreatedBy:   createdBy,
+		CreatedAt:   u.now(),
+		ExpiresAt:   req.ExpiresAt,
+	}
+	if err := u.repo.Create(apiKey); err != nil {
+		return nil, err
+	}
+
+	return &domain.CreateAPIKeyResponse{
+		APIKeyResponse: *apiKeyResponse(apiKey),
+		Key:            key,
+	}, nil
+}
+
+// checkPermissions verifica que los permisos pedidos para la clave existan y que createdBy los
+// tenga entre sus permisos efectivos, para que una API key no pueda ampliar los privilegios de
+// quien la genera. Los comodines ("modulo:*") no se buscan en el catálogo, pero también deben
+// estar cubiertos por un comodín igual o más amplio de createdBy.
+func (u *apiKeyUseCase) checkPermissions(createdBy string, codes []string) error {
+	if len(codes) == 0 {
+		return nil
+	}
+
+	var specific []string
+	for _, code := range codes {
+		if !strings.HasSuffix(code, utils.PermissionWildcard) {
+			specific = append(specific, code)
+		}
+	}
+	existing, err := u.catalog.GetExistingCodes(specific)
+	if err != nil {
+		return err
+	}
+	var unknown []string
+	for _, code := range specific {
+		if !slices.Contains(existing, code) {
+			unknown = append(unknown, code)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("%w: %s", domain.ErrUnknownAPIKeyPermission, strings.Join(unknown, ", "))
+	}
+
+	granted, err := u.permissions.GetUserPermissions(createdBy)
+	if err != nil {
+		return err
+	}
+	var notHeld []string
+	for _, code := range codes {
+		if !slices.ContainsFunc(granted, func(g string) bool { return utils.PermissionMatches(g, code) }) {
+			notHeld = append(notHeld, code)
+		}
+	}
+	if len(notHeld) > 0 {
+		return fmt.Errorf("%w: %s", domain.ErrAPIKeyPermissionNotHeld, strings.Join(notHeld, ", "))
+	}
+	return nil
+}
+
+// GetAPIKeys lista todas las API keys, incluidas las revocadas
+func (u *apiKeyUseCase) GetAPIKeys() ([]*domain.APIKeyResponse, error) {
+	keys, err := u.repo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]*domain.APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		response = append(response, apiKeyResponse(key))
+	}
+	return response, nil
+}
+
+// RevokeAPIKey revoca una API key; retorna false si no existe o ya estaba revocada
+func (u *apiKeyUseCase) RevokeAPIKey(id string) (bool, error) {
+	return u.repo.Revoke(id, u.now())
+}
+
+// Authenticate busca las API keys por el prefijo visible de la clave recibida, que no es
+// secreto, y compara el hash guardado con el de la clave en tiempo constante. Así la búsqueda
+// en el almacenamiento no depende de ningún dato secreto.
+func (u *apiKeyUseCase) Authenticate(key string) (*domain.APIKey, error) {
+	if !strings.HasPrefix(key, domain.APIKeyPrefix) || len(key) <= apiKeyPrefixLength {
+		return nil, domain.ErrInvalidAPIKey
+	}
+
+	candidates, err := u.repo.GetByPrefix(key[:apiKeyPrefixLength])
+	if err != nil {
+		return nil, err
+	}
+	keyHash := []byte(utils.HashToken(key))
+	var apiKey *domain.APIKey
+	for _, candidate := range candidates {
+		if subtle.ConstantTimeCompare([]byte(candidate.KeyHash), keyHash) == 1 {
+			apiKey = candidate
+		}
+	}
+	if apiKey == nil {
+		return nil, domain.ErrInvalidAPIKey
+	}
+	if apiKey.Revoked() {
+		return nil, domain.ErrAPIKeyRevoked
+	}
+	if apiKey.Expired(u.now()) {
+		return nil, domain.ErrAPIKeyExpired
+	}
+
+	return apiKey, nil
+}
+
+// apiKeyResponse convierte una API key en su representación pública
+func apiKeyResponse(key *domain.APIKey) *domain.APIKeyResponse {
+	response := &domain.APIKeyResponse{
+		ID:          key.ID.Hex(),
+		Name:        key.Name,
+		Prefix:      key.Prefix,
+		Scopes:      nonNilStrings(key.Scopes),
+		Permissions: nonNilStrings(key.Permissions),
+		CreatedBy:   key.CreatedBy,
+		CreatedAt:   utils.NewTimestamp(key.CreatedAt),
+	}
+	if key.RevokedAt != nil {
+		revokedAt := utils.NewTimestamp(*key.RevokedAt)
+		response.RevokedAt = &revokedAt
+	}
+	if key.ExpiresAt != nil {
+		expiresAt := utils.NewTimestamp(*key.ExpiresAt)
+		response.ExpiresAt = &expiresAt
+	}
+	return response
+}
+
+// nonNilStrings retorna una lista vacía en lugar de nil para que se serialice como []
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
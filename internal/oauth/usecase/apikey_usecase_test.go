@@ -0,0 +1,180 @@
+package usecase
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/black4ninja/mi-proyecto/internal/oauth/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// newTestAPIKeyUseCase crea el caso de uso con un catálogo de inventario y un admin-1 con
+// permisos sobre todo el módulo
+func newTestAPIKeyUseCase(repo domain.APIKeyRepository) domain.APIKeyUseCase {
+	return NewAPIKeyUseCase(repo,
+		&fakePermissionResolver{permissions: map[string][]string{"admin-1": {"inventario:*", "admin:api-keys"}}},
+		fakePermissionCatalog{"inventario:read", "inventario:write", "admin:users", "admin:api-keys"},
+	)
+}
+
+func TestCreateAPIKeyStoresOnlyHash(t *testing.T) {
+	repo := &fakeAPIKeyRepo{}
+	uc := newTestAPIKeyUseCase(repo)
+
+	created, err := uc.CreateAPIKey("admin-1", &domain.CreateAPIKeyRequest{
+		Name:        " Integración ERP ",
+		Scopes:      []string{"read"},
+		Permissions: []string{"inventario:read"},
+	})
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(created.Key, domain.APIKeyPrefix))
+	assert.True(t, strings.HasPrefix(created.Key, created.Prefix))
+	assert.Equal(t, "Integración ERP", created.Name)
+	assert.Equal(t, "admin-1", created.CreatedBy)
+
+	require.Len(t, repo.keys, 1)
+	stored := repo.keys[0]
+	assert.NotEqual(t, created.Key, stored.KeyHash, "la clave no debe guardarse en claro")
+	assert.Equal(t, utils.HashToken(created.Key), stored.KeyHash)
+
+	// El listado no expone la clave ni su hash
+	keys, err := uc.GetAPIKeys()
+	require.NoError(t, err)
+	body, err := json.Marshal(keys)
+	require.NoError(t, err)
+	assert.NotContains(t, string(body), created.Key)
+	assert.NotContains(t, string(body), stored.KeyHash)
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	repo := &fakeAPIKeyRepo{}
+	uc := newTestAPIKeyUseCase(repo)
+
+	valid, err := uc.CreateAPIKey("admin-1", &domain.CreateAPIKeyRequest{Name: "válida", Scopes: []string{"read"}})
+	require.NoError(t, err)
+	revoked, err := uc.CreateAPIKey("admin-1", &domain.CreateAPIKeyRequest{Name: "revocada"})
+	require.NoError(t, err)
+
+	ok, err := uc.RevokeAPIKey(revoked.ID)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	t.Run("clave válida", func(t *testing.T) {
+		key, err := uc.Authenticate(valid.Key)
+		require.NoError(t, err)
+		assert.Equal(t, valid.ID, key.ID.Hex())
+		assert.Equal(t, []string{"read"}, key.Scopes)
+	})
+
+	t.Run("clave revocada", func(t *testing.T) {
+		_, err := uc.Authenticate(revoked.Key)
+		assert.ErrorIs(t, err, domain.ErrAPIKeyRevoked)
+	})
+
+	t.Run("clave desconocida", func(t *testing.T) {
+		_, err := uc.Authenticate(domain.APIKeyPrefix + strings.Repeat("0", 64))
+		assert.ErrorIs(t, err, domain.ErrInvalidAPIKey)
+	})
+
+	t.Run("formato inválido", func(t *testing.T) {
+		_, err := uc.Authenticate("Bearer abc")
+		assert.ErrorIs(t, err, domain.ErrInvalidAPIKey)
+	})
+
+	t.Run("revocar dos veces", func(t *testing.T) {
+		ok, err := uc.RevokeAPIKey(revoked.ID)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+}
+
+func TestCreateAPIKeyPermissions(t *testing.T) {
+	repo := &fakeAPIKeyRepo{}
+	uc := newTestAPIKeyUseCase(repo)
+
+	tests := []struct {
+		name        string
+		permissions []string
+		wantErr     error
+	}{
+		{"permisos cubiertos por un comodín", []string{"inventario:read", "inventario:write"}, nil},
+		{"comodín igual al del creador", []string{"inventario:*"}, nil},
+		{"permiso que el creador no tiene", []string{"inventario:read", "admin:users"}, domain.ErrAPIKeyPermissionNotHeld},
+		{"comodín más amplio que el del creador", []string{"admin:*"}, domain.ErrAPIKeyPermissionNotHeld},
+		{"comodín global", []string{"*"}, domain.ErrAPIKeyPermissionNotHeld},
+		{"permiso inexistente", []string{"inventario:borrar"}, domain.ErrUnknownAPIKeyPermission},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(repo.keys)
+			_, err := uc.CreateAPIKey("admin-1", &domain.CreateAPIKeyRequest{Name: "erp", Permissions: tt.permissions})
+			if tt.wantErr == nil {
+				require.NoError(t, err)
+				assert.Len(t, repo.keys, before+1)
+				return
+			}
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Len(t, repo.keys, before)
+		})
+	}
+
+	_, err := uc.CreateAPIKey("otro", &domain.CreateAPIKeyRequest{Name: "erp", Permissions: []string{"inventario:read"}})
+	assert.ErrorIs(t, err, domain.ErrAPIKeyPermissionNotHeld, "un usuario sin permisos no puede otorgarlos")
+}
+
+func TestAPIKeyExpiry(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	repo := &fakeAPIKeyRepo{}
+	uc := newTestAPIKeyUseCase(repo).(*apiKeyUseCase)
+	uc.now = func() time.Time { return now }
+
+	t.Run("vencimiento pasado", func(t *testing.T) {
+		past := now.Add(-time.Minute)
+		_, err := uc.CreateAPIKey("admin-1", &domain.CreateAPIKeyRequest{Name: "vencida", ExpiresAt: &past})
+		assert.ErrorIs(t, err, domain.ErrInvalidAPIKeyExpiry)
+		assert.Empty(t, repo.keys)
+	})
+
+	expiresAt := now.Add(time.Hour)
+	created, err := uc.CreateAPIKey("admin-1", &domain.CreateAPIKeyRequest{Name: "temporal", ExpiresAt: &expiresAt})
+	require.NoError(t, err)
+	require.NotNil(t, created.ExpiresAt)
+	assert.Equal(t, expiresAt, created.ExpiresAt.Time)
+
+	_, err = uc.Authenticate(created.Key)
+	assert.NoError(t, err)
+
+	// Al llegar al vencimiento deja de autenticar
+	now = expiresAt
+	_, err = uc.Authenticate(created.Key)
+	assert.ErrorIs(t, err, domain.ErrAPIKeyExpired)
+}
+
+func TestAuthenticateAPIKeyComparesHash(t *testing.T) {
+	repo := &fakeAPIKeyRepo{}
+	uc := newTestAPIKeyUseCase(repo)
+
+	created, err := uc.CreateAPIKey("admin-1", &domain.CreateAPIKeyRequest{Name: "erp"})
+	require.NoError(t, err)
+	_, err = uc.CreateAPIKey("admin-1", &domain.CreateAPIKeyRequest{Name: "crm"})
+	require.NoError(t, err)
+
+	// Dos claves con el mismo prefijo visible: se distingue por el hash
+	repo.keys[1].Prefix = created.Prefix
+	key, err := uc.Authenticate(created.Key)
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, key.ID.Hex())
+
+	forged := created.Prefix + strings.Repeat("0", len(created.Key)-len(created.Prefix))
+	_, err = uc.Authenticate(forged)
+	assert.ErrorIs(t, err, domain.ErrInvalidAPIKey)
+
+	_, err = uc.Authenticate(created.Prefix)
+	assert.ErrorIs(t, err, domain.ErrInvalidAPIKey)
+}
@@ -0,0 +1,239 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/black4ninja/mi-proyecto/internal/oauth/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// defaultClientRequest es la configuración del cliente creado por EnsureDefaultClient; coincide
+// con la del script scripts/init_oauth_client.go
+var defaultClientRequest = domain.CreateClientRequest{
+	Name:         "Cliente por defecto",
+	RedirectURIs: []string{"http://localhost:3000/callback"},
+	GrantTypes:   []string{domain.GrantTypePassword, domain.GrantTypeRefreshToken, domain.GrantTypeClientCredentials},
+	Scopes:       []string{"read", "write", "admin"},
+}
+
+type clientUseCase struct {
+	repo         domain.ClientRepository
+	tokenRevoker domain.ClientTokenRevoker
+	now          func() time.Time
+}
+
+// NewClientUseCase crea un nuevo caso de uso para la administración de clientes OAuth. Con
+// tokenRevoker (puede ser nil) la eliminación de un cliente también revoca sus sesiones.
+func NewClientUseCase(repo domain.ClientRepository, tokenRevoker domain.ClientTokenRevoker) domain.ClientUseCase {
+	return &clientUseCase{
+		repo:         repo,
+		tokenRevoker: tokenRevoker,
+		now:          time.Now,
+	}
+}
+
+// CreateClient valida la configuración y registra el cliente con credenciales aleatorias.
+// El client_secret en texto plano se retorna únicamente en esta respuesta.
+func (u *clientUseCase) CreateClient(ownerID string, req *domain.CreateClientRequest) (*domain.CreateClientResponse, error) {
+	client := &domain.Client{
+		Name:         strings.TrimSpace(req.Name),
+		RedirectURIs: nonNilStrings(req.RedirectURIs),
+		GrantTypes:   req.GrantTypes,
+		Scopes:       nonNilStrings(req.Scopes),
+		GrantScopes:  req.GrantScopes,
+		OwnerID:      ownerID,
+		Public:       req.Public,
+	}
+	if err := validateClient(client); err != nil {
+		return nil, err
+	}
+
+	clientID, err := utils.GenerateRandomString(16)
+	if err != nil {
+		return nil, err
+	}
+	client.ClientID = clientID
+
+	// Los clientes públicos no pueden guardar un secreto: se autentican con PKCE
+	if !client.Public {
+		clientSecret, err := utils.GenerateRandomString(32)
+		if err != nil {
+			return nil, err
+		}
+		client.ClientSecret = clientSecret
+	}
+
+	now := u.now()
+	client.CreatedAt = now
+	client.UpdatedAt = now
+	if err := u.repo.Create(client); err != nil {
+		return nil, err
+	}
+
+	return &domain.CreateClientResponse{
+		ClientResponse: *clientResponse(client),
+		ClientSecret:   client.ClientSecret,
+	}, nil
+}
+
+// GetClients lista todos los clientes sin sus secretos
+func (u *clientUseCase) GetClients() ([]*domain.ClientResponse, error) {
+	clients, err := u.repo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]*domain.ClientResponse, 0, len(clients))
+	for _, client := range clients {
+		response = append(response, clientResponse(client))
+	}
+	return response, nil
+}
+
+// GetClient obtiene un cliente por su client_id
+func (u *clientUseCase) GetClient(clientID string) (*domain.ClientResponse, error) {
+	client, err := u.repo.GetByClientID(clientID)
+	if err != nil {
+		return nil, err
+	}
+	return clientResponse(client), nil
+}
+
+// UpdateClient reemplaza la configuración de un cliente existente
+func (u *clientUseCase) UpdateClient(clientID string, req *domain.UpdateClientRequest) (*domain.ClientResponse, error) {
+	client, err := u.repo.GetByClientID(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	client.Name = strings.TrimSpace(req.Name)
+	client.RedirectURIs = nonNilStrings(req.RedirectURIs)
+	client.GrantTypes = req.GrantTypes
+	client.Scopes = nonNilStrings(req.Scopes)
+	client.GrantScopes = req.GrantScopes
+	if err := validateClient(client); err != nil {
+		return nil, err
+	}
+
+	client.UpdatedAt = u.now()
+	if err := u.repo.Update(client); err != nil {
+		return nil, err
+	}
+	return clientResponse(client), nil
+}
+
+// DeleteClient elimina un cliente por su client_id y revoca las sesiones emitidas a él. Las
+// sesiones se revocan después de eliminar el cliente para que no pueda obtener tokens nuevos
+// entre ambos pasos; si la revocación falla, el cliente ya no existe y el error lo indica.
+func (u *clientUseCase) DeleteClient(clientID string) error {
+	client, err := u.repo.GetByClientID(clientID)
+	if err != nil {
+		return err
+	}
+	if err := u.repo.Delete(client.ID.Hex()); err != nil {
+		return err
+	}
+	if u.tokenRevoker == nil {
+		return nil
+	}
+	if _, err := u.tokenRevoker.RevokeClientTokens(client.ClientID); err != nil {
+		return fmt.Errorf("revocar tokens del cliente %s: %w", client.ClientID, err)
+	}
+	return nil
+}
+
+// EnsureDefaultClient crea el cliente por defecto en el primer arranque para que la API pueda
+// usarse sin ejecutar scripts/init_oauth_client.go. Es idempotente: si existe algún cliente no
+// hace nada y retorna nil.
+func (u *clientUseCase) EnsureDefaultClient() (*domain.CreateClientResponse, error) {
+	clients, err := u.repo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(clients) > 0 {
+		return nil, nil
+	}
+
+	req := defaultClientRequest
+	return u.CreateClient("", &req)
+}
+
+// validateClient verifica los tipos de concesión, scopes y URIs de redirección del cliente.
+// Retorna un error que envuelve ErrInvalidClientRequest con el detalle del problema.
+func validateClient(client *domain.Client) error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", domain.ErrInvalidClientRequest, fmt.Sprintf(format, args...))
+	}
+
+	if client.Name == "" {
+		return invalid("el nombre es obligatorio")
+	}
+
+	grantTypes := make(map[string]bool, len(client.GrantTypes))
+	for _, grantType := range client.GrantTypes {
+		if !domain.IsSupportedGrantType(grantType) {
+			return invalid("tipo de concesión no soportado: %s", grantType)
+		}
+		// Sin secreto solo se pueden canjear códigos de autorización y refresh tokens
+		if client.Public && grantType != domain.GrantTypeAuthorizationCode && grantType != domain.GrantTypeRefreshToken {
+			return invalid("un cliente público no puede usar el tipo de concesión %s", grantType)
+		}
+		grantTypes[grantType] = true
+	}
+
+	if err := validateScopes(client.Scopes); err != nil {
+		return invalid("%v", err)
+	}
+	for grantType, scopes := range client.GrantScopes {
+		if !grantTypes[grantType] {
+			return invalid("grant_scopes define scopes para un tipo de concesión no asignado: %s", grantType)
+		}
+		if err := validateScopes(scopes); err != nil {
+			return invalid("%v", err)
+		}
+	}
+
+	if grantTypes[domain.GrantTypeAuthorizationCode] && len(client.RedirectURIs) == 0 {
+		return invalid("authorization_code requiere al menos una redirect_uri")
+	}
+	for _, redirectURI := range client.RedirectURIs {
+		parsed, err := url.Parse(redirectURI)
+		// Absoluta y sin fragmento (RFC 6749 §3.1.2); se admiten esquemas propios de apps móviles
+		if err != nil || !parsed.IsAbs() || parsed.Fragment != "" {
+			return invalid("redirect_uri inválida: %s", redirectURI)
+		}
+	}
+
+	return nil
+}
+
+// validateScopes verifica que todos los scopes sean conocidos
+func validateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if !domain.IsSupportedScope(scope) {
+			return errors.New("scope no soportado: " + scope)
+		}
+	}
+	return nil
+}
+
+// clientResponse convierte un cliente en su representación pública (sin el secreto)
+func clientResponse(client *domain.Client) *domain.ClientResponse {
+	return &domain.ClientResponse{
+		ID:           client.ID.Hex(),
+		ClientID:     client.ClientID,
+		Name:         client.Name,
+		RedirectURIs: nonNilStrings(client.RedirectURIs),
+		GrantTypes:   nonNilStrings(client.GrantTypes),
+		Scopes:       nonNilStrings(client.Scopes),
+		GrantScopes:  client.GrantScopes,
+		OwnerID:      client.OwnerID,
+		Public:       client.Public,
+		CreatedAt:    utils.NewTimestamp(client.CreatedAt),
+		UpdatedAt:    utils.NewTimestamp(client.UpdatedAt),
+	}
+}
@@ -0,0 +1,182 @@
+package usecase
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/black4ninja/mi-proyecto/internal/oauth/domain"
+)
+
+func TestCreateClientReturnsSecretOnce(t *testing.T) {
+	repo := newFakeClientRepo()
+	uc := NewClientUseCase(repo, nil)
+
+	created, err := uc.CreateClient("admin-1", &domain.CreateClientRequest{
+		Name:         " Portal ",
+		RedirectURIs: []string{"https://portal.example.com/callback"},
+		GrantTypes:   []string{domain.GrantTypeAuthorizationCode, domain.GrantTypeRefreshToken},
+		Scopes:       []string{"read"},
+	})
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, created.ClientID)
+	assert.NotEmpty(t, created.ClientSecret)
+	assert.Equal(t, "Portal", created.Name)
+	assert.Equal(t, "admin-1", created.OwnerID)
+
+	stored, err := repo.GetByClientID(created.ClientID)
+	require.NoError(t, err)
+	assert.Equal(t, created.ClientSecret, stored.ClientSecret)
+
+	// Las consultas posteriores no exponen el secreto
+	client, err := uc.GetClient(created.ClientID)
+	require.NoError(t, err)
+	clients, err := uc.GetClients()
+	require.NoError(t, err)
+	for _, response := range []interface{}{client, clients} {
+		body, err := json.Marshal(response)
+		require.NoError(t, err)
+		assert.NotContains(t, string(body), created.ClientSecret)
+	}
+
+	t.Run("los clientes públicos no tienen secreto", func(t *testing.T) {
+		public, err := uc.CreateClient("admin-1", &domain.CreateClientRequest{
+			Name:         "SPA",
+			RedirectURIs: []string{"com.example.app:/callback"},
+			GrantTypes:   []string{domain.GrantTypeAuthorizationCode},
+			Public:       true,
+		})
+		require.NoError(t, err)
+		assert.Empty(t, public.ClientSecret)
+	})
+}
+
+func TestClientValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		req  domain.CreateClientRequest
+	}{
+		{
+			name: "tipo de concesión desconocido",
+			req:  domain.CreateClientRequest{Name: "ERP", GrantTypes: []string{"implicit"}},
+		},
+		{
+			name: "scope desconocido",
+			req:  domain.CreateClientRequest{Name: "ERP", GrantTypes: []string{domain.GrantTypeClientCredentials}, Scopes: []string{"superuser"}},
+		},
+		{
+			name: "grant_scopes de un tipo de concesión no asignado",
+			req: domain.CreateClientRequest{
+				Name:        "ERP",
+				GrantTypes:  []string{domain.GrantTypeClientCredentials},
+				GrantScopes: map[string][]string{domain.GrantTypePassword: {"read"}},
+			},
+		},
+		{
+			name: "grant_scopes con scope desconocido",
+			req: domain.CreateClientRequest{
+				Name:        "ERP",
+				GrantTypes:  []string{domain.GrantTypeClientCredentials},
+				GrantScopes: map[string][]string{domain.GrantTypeClientCredentials: {"superuser"}},
+			},
+		},
+		{
+			name: "cliente público con client_credentials",
+			req:  domain.CreateClientRequest{Name: "SPA", GrantTypes: []string{domain.GrantTypeClientCredentials}, Public: true},
+		},
+		{
+			name: "authorization_code sin redirect_uri",
+			req:  domain.CreateClientRequest{Name: "Portal", GrantTypes: []string{domain.GrantTypeAuthorizationCode}},
+		},
+		{
+			name: "redirect_uri relativa",
+			req:  domain.CreateClientRequest{Name: "Portal", GrantTypes: []string{domain.GrantTypeAuthorizationCode}, RedirectURIs: []string{"/callback"}},
+		},
+		{
+			name: "nombre vacío",
+			req:  domain.CreateClientRequest{Name: "  ", GrantTypes: []string{domain.GrantTypeClientCredentials}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeClientRepo()
+			_, err := NewClientUseCase(repo, nil).CreateClient("admin-1", &tt.req)
+			assert.ErrorIs(t, err, domain.ErrInvalidClientRequest)
+			assert.Empty(t, repo.clients)
+		})
+	}
+}
+
+func TestUpdateAndDeleteClient(t *testing.T) {
+	repo := newFakeClientRepo(newTestClient())
+	uc := NewClientUseCase(repo, nil)
+
+	updated, err := uc.UpdateClient("cliente-prueba", &domain.UpdateClientRequest{
+		Name:       "Renombrado",
+		GrantTypes: []string{domain.GrantTypeClientCredentials},
+		Scopes:     []string{"read", "write"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Renombrado", updated.Name)
+	assert.Equal(t, "secreto-cliente", repo.clients["cliente-prueba"].ClientSecret, "la actualización conserva las credenciales")
+
+	_, err = uc.UpdateClient("cliente-prueba", &domain.UpdateClientRequest{Name: "ERP", GrantTypes: []string{"implicit"}})
+	assert.ErrorIs(t, err, domain.ErrInvalidClientRequest)
+
+	_, err = uc.UpdateClient("no-existe", &domain.UpdateClientRequest{Name: "ERP", GrantTypes: []string{domain.GrantTypePassword}})
+	assert.ErrorIs(t, err, domain.ErrClientNotFound)
+
+	require.NoError(t, uc.DeleteClient("cliente-prueba"))
+	_, err = uc.GetClient("cliente-prueba")
+	assert.ErrorIs(t, err, domain.ErrClientNotFound)
+}
+
+func TestDeleteClientRevokesTokens(t *testing.T) {
+	clientRepo := newFakeClientRepo(newTestClient())
+	oauth := NewOAuthUseCase(clientRepo, newFakeTokenRepo(), newFakeUserUseCase(newTestUser("usuario@example.com", "secreto123")),
+		testSecret, 15*time.Minute, time.Hour, WithStatelessTokens(true), WithRevocationList(newFakeRevocationList()))
+	uc := NewClientUseCase(clientRepo, oauth)
+
+	resp, err := oauth.GenerateToken(&domain.OAuthRequest{
+		GrantType:    domain.GrantTypeClientCredentials,
+		ClientID:     "cliente-prueba",
+		ClientSecret: "secreto-cliente",
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, uc.DeleteClient("cliente-prueba"))
+	_, _, err = oauth.ValidateToken(resp.AccessToken)
+	assert.Error(t, err, "el access token del cliente eliminado deja de ser válido")
+
+	removed, err := oauth.RevokeClientTokens("cliente-prueba")
+	require.NoError(t, err)
+	assert.Zero(t, removed, "la eliminación ya borró las sesiones")
+}
+
+func TestEnsureDefaultClient(t *testing.T) {
+	repo := newFakeClientRepo()
+	uc := NewClientUseCase(repo, nil)
+
+	created, err := uc.EnsureDefaultClient()
+	require.NoError(t, err)
+	require.NotNil(t, created)
+	assert.NotEmpty(t, created.ClientSecret)
+	assert.Len(t, repo.clients, 1)
+
+	// Con algún cliente registrado no se crea otro
+	again, err := uc.EnsureDefaultClient()
+	require.NoError(t, err)
+	assert.Nil(t, again)
+	assert.Len(t, repo.clients, 1)
+
+	existing := newFakeClientRepo(newTestClient())
+	created, err = NewClientUseCase(existing, nil).EnsureDefaultClient()
+	require.NoError(t, err)
+	assert.Nil(t, created)
+	assert.Len(t, existing.clients, 1)
+}
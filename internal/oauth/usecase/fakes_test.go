@@ -0,0 +1,490 @@
+package usecase
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/black4ninja/mi-proyecto/internal/oauth/domain"
+	userDomain "github.com/black4ninja/mi-proyecto/internal/user/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// fakeClientRepo es un repositorio de clientes en memoria para pruebas
+type fakeClientRepo struct {
+	mu            sync.Mutex
+	clients       map[string]*domain.Client
+	validateCalls int
+}
+
+func newFakeClientRepo(clients ...*domain.Client) *fakeClientRepo {
+	repo := &fakeClientRepo{clients: make(map[string]*domain.Client)}
+	for _, c := range clients {
+		repo.clients[c.ClientID] = c
+	}
+	return repo
+}
+
+func (r *fakeClientRepo) GetByClientID(clientID string) (*domain.Client, error) {
+	client, ok := r.clients[clientID]
+	if !ok {
+		return nil, domain.ErrClientNotFound
+	}
+	return client, nil
+}
+
+func (r *fakeClientRepo) GetAll() ([]*domain.Client, error) {
+	clients := make([]*domain.Client, 0, len(r.clients))
+	for _, c := range r.clients {
+		clients = append(clients, c)
+	}
+	return clients, nil
+}
+
+func (r *fakeClientRepo) ValidateClient(clientID, clientSecret string) (*domain.Client, error) {
+	r.mu.Lock()
+	r.validateCalls++
+	r.mu.Unlock()
+	client, ok := r.clients[clientID]
+	if !ok || client.ClientSecret != clientSecret {
+		return nil, errors.New("credenciales de cliente inválidas")
+	}
+	return client, nil
+}
+
+func (r *fakeClientRepo) Create(client *domain.Client) error {
+	client.ID = primitive.NewObjectID()
+	r.clients[client.ClientID] = client
+	return nil
+}
+
+func (r *fakeClientRepo) Update(client *domain.Client) error {
+	r.clients[client.ClientID] = client
+	return nil
+}
+
+func (r *fakeClientRepo) Delete(id string) error {
+	for key, c := range r.clients {
+		if c.ID.Hex() == id {
+			delete(r.clients, key)
+		}
+	}
+	return nil
+}
+
+func (r *fakeClientRepo) TransferOwnership(fromUserID, toUserID string) (int64, error) {
+	var moved int64
+	for _, c := range r.clients {
+		if c.OwnerID == fromUserID {
+			c.OwnerID = toUserID
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+// fakeTokenRepo es un repositorio de tokens en memoria para pruebas
+type fakeTokenRepo struct {
+	mu     sync.Mutex
+	tokens []*domain.Token
+}
+
+func newFakeTokenRepo() *fakeTokenRepo {
+	return &fakeTokenRepo{}
+}
+
+func (r *fakeTokenRepo) Create(token *domain.Token) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token.ID = primitive.NewObjectID()
+	if token.FamilyID == "" {
+		token.FamilyID = token.ID.Hex()
+	}
+	stored := *token
+	stored.AccessToken = utils.HashToken(token.AccessToken)
+	stored.RefreshToken = utils.HashToken(token.RefreshToken)
+	stored.Hashed = true
+	r.tokens = append(r.tokens, &stored)
+	return nil
+}
+
+func (r *fakeTokenRepo) GetByAccessToken(accessToken string) (*domain.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.tokens {
+		if t.AccessToken == utils.HashToken(accessToken) {
+			return t, nil
+		}
+	}
+	return nil, domain.ErrTokenNotFound
+}
+
+func (r *fakeTokenRepo) GetByRefreshToken(refreshToken string) (*domain.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.tokens {
+		if t.RefreshToken != "" && t.RefreshToken == utils.HashToken(refreshToken) {
+			return t, nil
+		}
+	}
+	return nil, domain.ErrTokenNotFound
+}
+
+func (r *fakeTokenRepo) DeleteByRefreshToken(refreshToken string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.removeWhere(func(t *domain.Token) bool { return t.RefreshToken == utils.HashToken(refreshToken) })
+	return nil
+}
+
+func (r *fakeTokenRepo) ConsumeRefreshToken(refreshToken string) (*domain.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, t := range r.tokens {
+		if t.RefreshToken != "" && t.RefreshToken == utils.HashToken(refreshToken) {
+			r.tokens = append(r.tokens[:i], r.tokens[i+1:]...)
+			return t, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeTokenRepo) DeleteByUserID(userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.removeWhere(func(t *domain.Token) bool { return t.UserID == userID })
+	return nil
+}
+
+func (r *fakeTokenRepo) GetActiveByUserID(userID string) ([]*domain.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var tokens []*domain.Token
+	for _, t := range r.tokens {
+		if t.UserID == userID && (t.ExpiresAt.After(now) || t.RefreshExpiresAt.After(now)) {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens, nil
+}
+
+func (r *fakeTokenRepo) GetActiveByClientID(clientID string) ([]*domain.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var tokens []*domain.Token
+	for _, t := range r.tokens {
+		if t.ClientID == clientID && (t.ExpiresAt.After(now) || t.RefreshExpiresAt.After(now)) {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens, nil
+}
+
+func (r *fakeTokenRepo) DeleteByClientID(clientID string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	before := len(r.tokens)
+	r.removeWhere(func(t *domain.Token) bool { return t.ClientID == clientID })
+	return int64(before - len(r.tokens)), nil
+}
+
+func (r *fakeTokenRepo) UpdateAccessToken(oldAccessToken string, token *domain.Token) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.tokens {
+		if t.AccessToken == utils.HashToken(oldAccessToken) {
+			t.AccessToken = utils.HashToken(token.AccessToken)
+			t.ExpiresAt = token.ExpiresAt
+			t.Opaque = token.Opaque
+			t.Role = token.Role
+			t.Permissions = token.Permissions
+			return nil
+		}
+	}
+	return domain.ErrTokenNotFound
+}
+
+func (r *fakeTokenRepo) DeleteByID(id string) (*domain.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, domain.ErrInvalidTokenID
+	}
+	for i, t := range r.tokens {
+		if t.ID == objectID {
+			r.tokens = append(r.tokens[:i], r.tokens[i+1:]...)
+			return t, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeTokenRepo) DeleteExpired(before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return int64(r.removeWhere(func(t *domain.Token) bool {
+		return t.LastExpiry().Before(before)
+	})), nil
+}
+
+func (r *fakeTokenRepo) GetByRotatedRefreshToken(refreshToken string) (*domain.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.tokens {
+		for _, rotated := range t.RotatedRefreshTokens {
+			if rotated == utils.HashToken(refreshToken) {
+				return t, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeTokenRepo) DeleteByFamily(familyID string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return int64(r.removeWhere(func(t *domain.Token) bool { return t.FamilyID == familyID })), nil
+}
+
+func (r *fakeTokenRepo) removeWhere(match func(t *domain.Token) bool) int {
+	kept := r.tokens[:0]
+	removed := 0
+	for _, t := range r.tokens {
+		if match(t) {
+			removed++
+			continue
+		}
+		kept = append(kept, t)
+	}
+	r.tokens = kept
+	return removed
+}
+
+// fakeUserUseCase implementa solo los métodos de UserUseCase usados por OAuth;
+// el resto entra en pánico a través de la interfaz embebida
+type fakeUserUseCase struct {
+	userDomain.UserUseCase
+	users    map[string]*userDomain.User
+	refreshs map[string]string
+	logins   map[string]string // IP del último inicio de sesión por usuario
+}
+
+func newFakeUserUseCase(users ...*userDomain.User) *fakeUserUseCase {
+	uc := &fakeUserUseCase{
+		users:    make(map[string]*userDomain.User),
+		refreshs: make(map[string]string),
+		logins:   make(map[string]string),
+	}
+	for _, user := range users {
+		uc.users[user.ID.Hex()] = user
+	}
+	return uc
+}
+
+// newTestUser crea un usuario activo con la contraseña indicada
+func newTestUser(email, password string) *userDomain.User {
+	hash, _ := utils.HashPassword(password)
+	return &userDomain.User{
+		ID:       primitive.NewObjectID(),
+		Email:    email,
+		Name:     "Usuario de prueba",
+		Password: hash,
+		Status:   userDomain.UserStatusActive,
+		Role:     "user",
+	}
+}
+
+func (f *fakeUserUseCase) GetUser(id string) (*userDomain.UserResponse, error) {
+	user, ok := f.users[id]
+	if !ok {
+		return nil, userDomain.ErrUserNotFound
+	}
+	return &userDomain.UserResponse{
+		ID:     user.ID.Hex(),
+		Email:  user.Email,
+		Name:   user.Name,
+		Status: user.Status,
+		Role:   user.Role,
+	}, nil
+}
+
+func (f *fakeUserUseCase) ValidateCredentials(email string, password string) (*userDomain.User, error) {
+	for _, user := range f.users {
+		if user.Email != email {
+			continue
+		}
+		if user.Status != userDomain.UserStatusActive && user.Status != userDomain.UserStatusPending {
+			return nil, &userDomain.CredentialError{Reason: userDomain.ErrUserInactive}
+		}
+		if !utils.CheckPasswordHash(password, user.Password) {
+			return nil, &userDomain.CredentialError{Reason: userDomain.ErrInvalidPassword}
+		}
+		if user.Status == userDomain.UserStatusPending {
+			return nil, userDomain.ErrEmailNotVerified
+		}
+		return user, nil
+	}
+	return nil, &userDomain.CredentialError{Reason: userDomain.ErrUserNotFound}
+}
+
+// ChangePassword aplica la política de contraseñas por defecto y quita MustChangePassword
+func (f *fakeUserUseCase) ChangePassword(userID string, req *userDomain.ChangePasswordRequest) error {
+	user, ok := f.users[userID]
+	if !ok {
+		return userDomain.ErrUserNotFound
+	}
+	if !utils.CheckPasswordHash(req.OldPassword, user.Password) {
+		return userDomain.ErrIncorrectOldPassword
+	}
+	if err := utils.ValidatePasswordStrength(req.NewPassword, utils.DefaultPasswordPolicy()); err != nil {
+		return err
+	}
+	hash, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		return err
+	}
+	user.Password = hash
+	user.MustChangePassword = false
+	return nil
+}
+
+func (f *fakeUserUseCase) VerifyTwoFactor(userID string, code string) error {
+	user, ok := f.users[userID]
+	if !ok {
+		return userDomain.ErrUserNotFound
+	}
+	if !utils.ValidateTOTP(user.TwoFactorSecret, code, time.Now(), 1) {
+		return userDomain.ErrInvalidOTP
+	}
+	return nil
+}
+
+func (f *fakeUserUseCase) UpdateRefreshToken(userID string, refreshToken string) error {
+	f.refreshs[userID] = refreshToken
+	return nil
+}
+
+func (f *fakeUserUseCase) RecordLogin(userID string, ip string) error {
+	f.logins[userID] = ip
+	return nil
+}
+
+func (f *fakeUserUseCase) GetUserByRefreshToken(refreshToken string) (*userDomain.User, error) {
+	for userID, rt := range f.refreshs {
+		if rt == refreshToken && rt != "" {
+			return f.users[userID], nil
+		}
+	}
+	return nil, errors.New("token de refresco inválido")
+}
+
+// fakePermissionResolver retorna permisos configurables por usuario
+type fakePermissionResolver struct {
+	permissions map[string][]string
+}
+
+func (f *fakePermissionResolver) GetUserPermissions(userID string) ([]string, error) {
+	return f.permissions[userID], nil
+}
+
+// fakePermissionCatalog es un catálogo fijo de códigos de permiso
+type fakePermissionCatalog []string
+
+func (f fakePermissionCatalog) GetExistingCodes(codes []string) ([]string, error) {
+	var existing []string
+	for _, code := range codes {
+		if slices.Contains(f, code) {
+			existing = append(existing, code)
+		}
+	}
+	return existing, nil
+}
+
+// fakeRevocationList es una lista de revocación en memoria para pruebas
+type fakeRevocationList struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+func newFakeRevocationList() *fakeRevocationList {
+	return &fakeRevocationList{revoked: make(map[string]time.Time)}
+}
+
+func (l *fakeRevocationList) Revoke(jti string, expiresAt time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.revoked[jti] = expiresAt
+	return nil
+}
+
+func (l *fakeRevocationList) IsRevoked(jti string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	expiresAt, ok := l.revoked[jti]
+	return ok && time.Now().Before(expiresAt), nil
+}
+
+// fakeAuthorizationCodeRepo es un repositorio de códigos de autorización en memoria para pruebas
+type fakeAuthorizationCodeRepo struct {
+	codes map[string]*domain.AuthorizationCode
+}
+
+func newFakeAuthorizationCodeRepo() *fakeAuthorizationCodeRepo {
+	return &fakeAuthorizationCodeRepo{codes: make(map[string]*domain.AuthorizationCode)}
+}
+
+func (r *fakeAuthorizationCodeRepo) Create(code *domain.AuthorizationCode) error {
+	code.ID = primitive.NewObjectID()
+	r.codes[code.Code] = code
+	return nil
+}
+
+func (r *fakeAuthorizationCodeRepo) Consume(code string) (*domain.AuthorizationCode, error) {
+	authCode, ok := r.codes[code]
+	if !ok {
+		return nil, nil
+	}
+	delete(r.codes, code)
+	return authCode, nil
+}
+
+// fakeAPIKeyRepo es un repositorio de API keys en memoria para pruebas
+type fakeAPIKeyRepo struct {
+	keys []*domain.APIKey
+}
+
+func (r *fakeAPIKeyRepo) Create(key *domain.APIKey) error {
+	key.ID = primitive.NewObjectID()
+	r.keys = append(r.keys, key)
+	return nil
+}
+
+func (r *fakeAPIKeyRepo) GetByPrefix(prefix string) ([]*domain.APIKey, error) {
+	var keys []*domain.APIKey
+	for _, key := range r.keys {
+		if key.Prefix == prefix {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (r *fakeAPIKeyRepo) GetAll() ([]*domain.APIKey, error) {
+	return r.keys, nil
+}
+
+func (r *fakeAPIKeyRepo) Revoke(id string, revokedAt time.Time) (bool, error) {
+	for _, key := range r.keys {
+		if key.ID.Hex() == id && key.RevokedAt == nil {
+			key.RevokedAt = &revokedAt
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,147 @@
+package usecase
+
+import (
+	"time"
+
+	"github.com/black4ninja/mi-proyecto/internal/oauth/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// Option configura una dependencia o un ajuste opcional del caso de uso de OAuth. Sin opciones
+// el caso de uso emite JWT HS256 validados contra la sesión y acepta todos los tipos de concesión
+// salvo authorization_code.
+type Option func(*oauthUseCase)
+
+// WithPermissionResolver incluye los permisos del usuario como claim del access token
+func WithPermissionResolver(resolver domain.PermissionResolver) Option {
+	return func(u *oauthUseCase) {
+		u.permissionResolver = resolver
+	}
+}
+
+// WithUserProfile incluye el perfil del usuario en la respuesta del grant password, evitando una
+// llamada adicional a /users/me. Desactivado por defecto (no forma parte del estándar).
+func WithUserProfile(enabled bool) Option {
+	return func(u *oauthUseCase) {
+		u.includeUserProfile = enabled
+	}
+}
+
+// WithOpaqueTokens emite access tokens aleatorios en lugar de JWT. Los claims se guardan en el
+// token persistido y ValidateToken los obtiene de la base de datos.
+func WithOpaqueTokens(enabled bool) Option {
+	return func(u *oauthUseCase) {
+		u.opaqueTokens = enabled
+	}
+}
+
+// WithStatelessTokens valida los access tokens JWT solo con su firma y expiración, sin consultar
+// la sesión en la base de datos. Los tokens revocados se rechazan mediante WithRevocationList.
+// No tiene efecto con WithOpaqueTokens.
+func WithStatelessTokens(enabled bool) Option {
+	return func(u *oauthUseCase) {
+		u.statelessTokens = enabled
+	}
+}
+
+// WithRevocationList guarda los jti de los access tokens revocados antes de expirar (modo sin estado)
+func WithRevocationList(list domain.RevocationList) Option {
+	return func(u *oauthUseCase) {
+		u.revocationList = list
+	}
+}
+
+// WithClientClaims agrega los claims client_id y client_name del cliente que emitió el token,
+// para depuración y auditoría en los servidores de recursos. Desactivado por defecto para no
+// aumentar el tamaño de los tokens.
+func WithClientClaims(enabled bool) Option {
+	return func(u *oauthUseCase) {
+		u.clientClaims = enabled
+	}
+}
+
+// WithAuthorizationCodes guarda los códigos emitidos por /oauth/authorize. Sin esta opción el
+// grant authorization_code no está disponible.
+func WithAuthorizationCodes(codes domain.AuthorizationCodeRepository) Option {
+	return func(u *oauthUseCase) {
+		u.authorizationCodes = codes
+	}
+}
+
+// WithEnabledGrantTypes limita los tipos de concesión aceptados para todos los clientes, antes
+// de la verificación por cliente. Sin tipos habilita todos los de domain.SupportedGrantTypes.
+func WithEnabledGrantTypes(grantTypes ...string) Option {
+	return func(u *oauthUseCase) {
+		u.enabledGrantTypes = grantTypes
+	}
+}
+
+// WithStrictRefreshRotation hace que cada refresh token sea de un solo uso estricto: la sesión
+// anterior se elimina de forma atómica antes de emitir la nueva, de modo que de dos solicitudes
+// concurrentes con el mismo refresh token solo una tiene éxito.
+func WithStrictRefreshRotation(enabled bool) Option {
+	return func(u *oauthUseCase) {
+		u.strictRefresh = enabled
+	}
+}
+
+// WithJWTSigner define el algoritmo y las claves de los access tokens JWT (ej.
+// utils.NewRS256Signer para que otros servicios los validen solo con la clave pública). Sin esta
+// opción se usa HS256 con jwtSecret. Los tokens firmados con otro algoritmo se rechazan.
+func WithJWTSigner(signer *utils.JWTSigner) Option {
+	return func(u *oauthUseCase) {
+		u.signer = signer
+	}
+}
+
+// WithDeviceBinding valida al refrescar que el device_id recibido coincida con el enviado al
+// iniciar sesión. En modo enforce una discrepancia revoca la familia de tokens; las sesiones
+// iniciadas sin device_id no se validan.
+func WithDeviceBinding(mode domain.DeviceBindingMode) Option {
+	return func(u *oauthUseCase) {
+		u.deviceBinding = mode
+	}
+}
+
+// WithLoginFailureRecorder recibe el motivo de cada inicio de sesión fallido del grant password
+// (ej. para registrarlo en la auditoría). El motivo no se expone al cliente.
+func WithLoginFailureRecorder(recorder domain.LoginFailureRecorder) Option {
+	return func(u *oauthUseCase) {
+		u.loginFailures = recorder
+	}
+}
+
+// WithUserStatusCheck verifica en cada validación de un access token que su usuario siga activo,
+// además de la revocación de sesiones al archivarlo o desactivarlo. Agrega una consulta del
+// usuario por petición.
+func WithUserStatusCheck(enabled bool) Option {
+	return func(u *oauthUseCase) {
+		u.checkUserStatus = enabled
+	}
+}
+
+// WithSingleSession limita cada usuario a una sesión activa: cada inicio de sesión con el grant
+// password revoca las sesiones anteriores del usuario antes de emitir la nueva. Desactivado por
+// defecto porque impide usar la cuenta en varios dispositivos a la vez.
+func WithSingleSession(enabled bool) Option {
+	return func(u *oauthUseCase) {
+		u.singleSession = enabled
+	}
+}
+
+// WithClock reemplaza el reloj usado para las expiraciones de los tokens y los códigos de
+// autorización, la emisión de los JWT y las rotaciones de refresh tokens
+func WithClock(now func() time.Time) Option {
+	return func(u *oauthUseCase) {
+		u.now = now
+	}
+}
+
+// WithScopeNarrowingReport agrega requested_scope a la respuesta de token cuando se concede un
+// subconjunto de los scopes solicitados, para que el cliente detecte la reducción. scope siempre
+// contiene los scopes concedidos (RFC 6749, sección 5.1); sin esta opción la respuesta es la estándar.
+func WithScopeNarrowingReport(enabled bool) Option {
+	return func(u *oauthUseCase) {
+		u.reportNarrowing = enabled
+	}
+}
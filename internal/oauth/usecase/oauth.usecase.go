@@ -2,24 +2,54 @@ package usecase
 
 import (
 	"errors"
+	"log"
+	"net/url"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/golang-jwt/jwt/v4"
+
 	"github.com/black4ninja/mi-proyecto/internal/oauth/domain"
 	userDomain "github.com/black4ninja/mi-proyecto/internal/user/domain"
 	"github.com/black4ninja/mi-proyecto/pkg/utils"
 )
 
+// refreshReuseLeeway es el margen tras una rotación en el que volver a presentar el refresh token
+// recién canjeado no se considera reutilización: cubre solicitudes concurrentes o reintentos del
+// mismo cliente que perdieron la carrera contra la rotación.
+const refreshReuseLeeway = 10 * time.Second
+
+// maxRotatedRefreshTokens limita el historial de refresh tokens canjeados que se guarda en cada
+// sesión; la reutilización de tokens más antiguos ya no se detecta.
+const maxRotatedRefreshTokens = 100
+
 type oauthUseCase struct {
-	clientRepo domain.ClientRepository
-	tokenRepo  domain.TokenRepository
-	userUC     userDomain.UserUseCase
-	jwtSecret  string
-	tokenExp   time.Duration
-	refreshExp time.Duration
+	clientRepo         domain.ClientRepository
+	tokenRepo          domain.TokenRepository
+	userUC             userDomain.UserUseCase
+	signer             *utils.JWTSigner
+	tokenExp           time.Duration
+	refreshExp         time.Duration
+	permissionResolver domain.PermissionResolver
+	includeUserProfile bool
+	opaqueTokens       bool
+	statelessTokens    bool
+	revocationList     domain.RevocationList
+	enabledGrantTypes  []string
+	clientClaims       bool
+	authorizationCodes domain.AuthorizationCodeRepository
+	strictRefresh      bool
+	deviceBinding      domain.DeviceBindingMode
+	loginFailures      domain.LoginFailureRecorder
+	checkUserStatus    bool
+	singleSession      bool
+	reportNarrowing    bool
+	now                func() time.Time
 }
 
-// NewOAuthUseCase crea un nuevo caso de uso para OAuth
+// NewOAuthUseCase crea un nuevo caso de uso para OAuth. Las dependencias y ajustes opcionales
+// se indican con opciones (ver Option).
 func NewOAuthUseCase(
 	clientRepo domain.ClientRepository,
 	tokenRepo domain.TokenRepository,
@@ -27,170 +57,542 @@ func NewOAuthUseCase(
 	jwtSecret string,
 	tokenExp time.Duration,
 	refreshExp time.Duration,
+	opts ...Option,
 ) domain.OAuthUseCase {
-	return &oauthUseCase{
+	u := &oauthUseCase{
 		clientRepo: clientRepo,
 		tokenRepo:  tokenRepo,
 		userUC:     userUC,
-		jwtSecret:  jwtSecret,
 		tokenExp:   tokenExp,
 		refreshExp: refreshExp,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(u)
 	}
+
+	if u.signer == nil {
+		u.signer = utils.NewHS256Signer(jwtSecret)
+	}
+	// Los tokens opacos siempre se validan contra la sesión
+	u.statelessTokens = u.statelessTokens && !u.opaqueTokens
+
+	return u
 }
 
 // GenerateToken genera un token OAuth 2.0
 func (u *oauthUseCase) GenerateToken(req *domain.OAuthRequest) (*domain.OAuthResponse, error) {
+	// Validar el tipo de concesión antes de consultar el cliente
+	if !domain.IsSupportedGrantType(req.GrantType) {
+		return nil, domain.ErrUnsupportedGrantType
+	}
+
+	// Los tipos deshabilitados globalmente se tratan como no soportados
+	if !u.grantTypeEnabled(req.GrantType) {
+		return nil, domain.ErrUnsupportedGrantType
+	}
+
 	// Validar cliente
-	client, err := u.clientRepo.ValidateClient(req.ClientID, req.ClientSecret)
+	client, err := u.authenticateClient(req)
 	if err != nil {
 		return nil, err
 	}
 
 	// Verificar si el tipo de concesión es válido para este cliente
 	if !contains(client.GrantTypes, req.GrantType) {
-		return nil, errors.New("tipo de concesión no permitido para este cliente")
+		return nil, domain.ErrUnauthorizedClient
 	}
 
-	// Verificar scopes
+	// Verificar scopes contra los permitidos para este tipo de concesión
+	allowedScopes := client.AllowedScopes(req.GrantType)
 	var scopes []string
 	if req.Scope != "" {
-		requestedScopes := strings.Split(req.Scope, " ")
+		requestedScopes := strings.Fields(req.Scope)
 		for _, s := range requestedScopes {
-			if contains(client.Scopes, s) {
+			if contains(allowedScopes, s) {
 				scopes = append(scopes, s)
 			}
 		}
 	}
 
-	// Si no se proporcionaron scopes válidos, usar los scopes por defecto del cliente
+	// Si no se proporcionaron scopes válidos, usar los scopes por defecto del tipo de concesión
 	if len(scopes) == 0 {
-		scopes = client.Scopes
+		scopes = allowedScopes
 	}
 
 	// Generar tokens según el tipo de concesión
+	var response *domain.OAuthResponse
 	switch req.GrantType {
+	case domain.GrantTypeAuthorizationCode:
+		response, err = u.handleAuthorizationCodeGrant(req, client)
 	case domain.GrantTypePassword:
-		return u.handlePasswordGrant(req, client, scopes)
+		response, err = u.handlePasswordGrant(req, client, scopes)
 	case domain.GrantTypeRefreshToken:
-		return u.handleRefreshTokenGrant(req, client, scopes)
+		response, err = u.handleRefreshTokenGrant(req, client)
 	case domain.GrantTypeClientCredentials:
-		return u.handleClientCredentialsGrant(client, scopes)
+		response, err = u.handleClientCredentialsGrant(client, scopes)
 	default:
-		return nil, errors.New("tipo de concesión no implementado")
+		return nil, domain.ErrUnsupportedGrantType
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if u.reportNarrowing && scopeNarrowed(req.Scope, response.Scope) {
+		response.RequestedScope = strings.Join(strings.Fields(req.Scope), " ")
+	}
+	return response, nil
+}
+
+// scopeNarrowed indica si alguno de los scopes solicitados no está entre los concedidos
+func scopeNarrowed(requested, granted string) bool {
+	grantedScopes := strings.Fields(granted)
+	for _, s := range strings.Fields(requested) {
+		if !contains(grantedScopes, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// grantTypeEnabled indica si el tipo de concesión está habilitado globalmente
+func (u *oauthUseCase) grantTypeEnabled(grantType string) bool {
+	if grantType == domain.GrantTypeAuthorizationCode && u.authorizationCodes == nil {
+		return false
+	}
+	return len(u.enabledGrantTypes) == 0 || contains(u.enabledGrantTypes, grantType)
+}
+
+// EnabledGrantTypes retorna los tipos de concesión habilitados globalmente, en el orden de
+// domain.SupportedGrantTypes
+func (u *oauthUseCase) EnabledGrantTypes() []string {
+	grantTypes := make([]string, 0, len(domain.SupportedGrantTypes))
+	for _, grantType := range domain.SupportedGrantTypes {
+		if u.grantTypeEnabled(grantType) {
+			grantTypes = append(grantTypes, grantType)
+		}
+	}
+	return grantTypes
+}
+
+// authenticateClient valida las credenciales del cliente. Los clientes públicos no tienen
+// secreto: solo pueden canjear códigos de autorización (protegidos con PKCE) y refresh tokens.
+func (u *oauthUseCase) authenticateClient(req *domain.OAuthRequest) (*domain.Client, error) {
+	if req.ClientSecret != "" {
+		client, err := u.clientRepo.ValidateClient(req.ClientID, req.ClientSecret)
+		if err != nil {
+			return nil, domain.ErrInvalidClient
+		}
+		return client, nil
 	}
+
+	if req.GrantType != domain.GrantTypeAuthorizationCode && req.GrantType != domain.GrantTypeRefreshToken {
+		return nil, domain.ErrInvalidClient
+	}
+	client, err := u.clientRepo.GetByClientID(req.ClientID)
+	if err != nil || !client.Public {
+		return nil, domain.ErrInvalidClient
+	}
+	return client, nil
+}
+
+// Authorize emite un código de autorización para el usuario autenticado. Los clientes públicos
+// deben enviar code_challenge (PKCE); el método por defecto es "plain" (RFC 7636).
+func (u *oauthUseCase) Authorize(userID string, req *domain.AuthorizeRequest) (*domain.AuthorizeResponse, error) {
+	if !u.grantTypeEnabled(domain.GrantTypeAuthorizationCode) {
+		return nil, domain.ErrUnsupportedGrantType
+	}
+	if req.ResponseType != domain.ResponseTypeCode {
+		return nil, domain.NewOAuthError(domain.ErrorUnsupportedResponseType, "solo se admite response_type=code")
+	}
+
+	client, err := u.clientRepo.GetByClientID(req.ClientID)
+	if err != nil {
+		return nil, domain.NewOAuthError(domain.ErrorInvalidRequest, "cliente no encontrado")
+	}
+	if !contains(client.GrantTypes, domain.GrantTypeAuthorizationCode) {
+		return nil, domain.ErrUnauthorizedClient
+	}
+	if !contains(client.RedirectURIs, req.RedirectURI) {
+		return nil, domain.NewOAuthError(domain.ErrorInvalidRequest, "redirect_uri no registrada para este cliente")
+	}
+
+	// PKCE
+	method := req.CodeChallengeMethod
+	if req.CodeChallenge == "" {
+		if client.Public {
+			return nil, domain.ErrPKCERequired
+		}
+		method = ""
+	} else {
+		if method == "" {
+			method = domain.CodeChallengePlain
+		}
+		if method != domain.CodeChallengeS256 && method != domain.CodeChallengePlain {
+			return nil, domain.NewOAuthError(domain.ErrorInvalidRequest, "code_challenge_method no soportado")
+		}
+		if !utils.ValidPKCEValue(req.CodeChallenge) {
+			return nil, domain.NewOAuthError(domain.ErrorInvalidRequest, "code_challenge inválido")
+		}
+	}
+
+	// Scopes solicitados dentro de los permitidos para el grant
+	allowedScopes := client.AllowedScopes(domain.GrantTypeAuthorizationCode)
+	var scopes []string
+	for _, s := range strings.Fields(req.Scope) {
+		if contains(allowedScopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	if len(scopes) == 0 {
+		scopes = allowedScopes
+	}
+
+	code, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	now := u.now()
+	if err := u.authorizationCodes.Create(&domain.AuthorizationCode{
+		Code:                code,
+		ClientID:            client.ClientID,
+		UserID:              userID,
+		RedirectURI:         req.RedirectURI,
+		Scopes:              scopes,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: method,
+		AuthTime:            req.AuthTime,
+		ExpiresAt:           now.Add(domain.AuthorizationCodeTTL),
+		CreatedAt:           now,
+	}); err != nil {
+		return nil, err
+	}
+
+	// URL de redirección con el código y el state
+	redirectTo, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		return nil, domain.NewOAuthError(domain.ErrorInvalidRequest, "redirect_uri inválida")
+	}
+	query := redirectTo.Query()
+	query.Set("code", code)
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	redirectTo.RawQuery = query.Encode()
+
+	return &domain.AuthorizeResponse{
+		Code:        code,
+		State:       req.State,
+		RedirectURI: req.RedirectURI,
+		RedirectTo:  redirectTo.String(),
+	}, nil
+}
+
+// handleAuthorizationCodeGrant canjea un código de autorización verificando el cliente, la
+// redirect_uri y, si el código se emitió con code_challenge, el code_verifier de PKCE
+func (u *oauthUseCase) handleAuthorizationCodeGrant(req *domain.OAuthRequest, client *domain.Client) (*domain.OAuthResponse, error) {
+	if req.Code == "" {
+		return nil, domain.NewOAuthError(domain.ErrorInvalidRequest, "código de autorización requerido")
+	}
+
+	// El código se elimina al consultarlo: un segundo intento falla aunque el primero sea rechazado
+	authCode, err := u.authorizationCodes.Consume(req.Code)
+	if err != nil {
+		return nil, err
+	}
+	if authCode == nil || authCode.ClientID != client.ClientID || u.now().After(authCode.ExpiresAt) {
+		return nil, domain.ErrInvalidAuthorizationCode
+	}
+	if req.RedirectURI != authCode.RedirectURI {
+		return nil, domain.NewOAuthError(domain.ErrorInvalidGrant, "redirect_uri no coincide")
+	}
+
+	// PKCE
+	if authCode.CodeChallenge != "" {
+		if req.CodeVerifier == "" {
+			return nil, domain.ErrMissingCodeVerifier
+		}
+		if !utils.ValidPKCEValue(req.CodeVerifier) ||
+			!utils.VerifyCodeChallenge(authCode.CodeChallenge, authCode.CodeChallengeMethod, req.CodeVerifier) {
+			return nil, domain.ErrInvalidCodeVerifier
+		}
+	} else if client.Public {
+		return nil, domain.ErrPKCERequired
+	}
+
+	// El usuario debe seguir activo
+	user, err := u.userUC.GetUser(authCode.UserID)
+	if err != nil {
+		return nil, domain.NewOAuthError(domain.ErrorInvalidGrant, "usuario no encontrado")
+	}
+	if user.Status != userDomain.UserStatusActive {
+		return nil, domain.NewOAuthError(domain.ErrorInvalidGrant, "usuario inactivo")
+	}
+
+	refreshToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := u.now()
+	token := &domain.Token{
+		RefreshToken:     refreshToken,
+		UserID:           authCode.UserID,
+		ClientID:         client.ClientID,
+		ClientName:       client.Name,
+		Scopes:           authCode.Scopes,
+		ExpiresAt:        now.Add(u.tokenExp),
+		RefreshExpiresAt: now.Add(u.refreshExp),
+		CreatedAt:        now,
+		AuthTime:         authCode.AuthTime, // El canje no es una nueva autenticación
+		DeviceID:         req.DeviceID,
+	}
+	if err := u.issueAccessToken(token, user.Role); err != nil {
+		return nil, err
+	}
+
+	if err := u.tokenRepo.Create(token); err != nil {
+		return nil, err
+	}
+	if err := u.userUC.UpdateRefreshToken(authCode.UserID, utils.HashToken(refreshToken)); err != nil {
+		return nil, err
+	}
+
+	return u.newOAuthResponse(token.AccessToken, refreshToken, authCode.Scopes), nil
 }
 
 // handlePasswordGrant maneja la concesión de tipo password
 func (u *oauthUseCase) handlePasswordGrant(req *domain.OAuthRequest, client *domain.Client, scopes []string) (*domain.OAuthResponse, error) {
 	// Validar que se proporcionaron username y password
 	if req.Username == "" || req.Password == "" {
-		return nil, errors.New("nombre de usuario y contraseña requeridos")
+		return nil, domain.NewOAuthError(domain.ErrorInvalidRequest, "nombre de usuario y contraseña requeridos")
 	}
 
-	// Validar credenciales del usuario
+	// Validar credenciales del usuario. Todos los fallos, incluidos los de la base de datos, se
+	// reportan al cliente con el mismo mensaje; el motivo real solo se registra. La excepción es
+	// el email sin verificar, que solo se informa con la contraseña correcta.
 	user, err := u.userUC.ValidateCredentials(req.Username, req.Password)
 	if err != nil {
-		return nil, err
+		u.recordLoginFailure(client.ClientID, req.Username, err)
+		if errors.Is(err, userDomain.ErrEmailNotVerified) {
+			return nil, domain.NewOAuthError(domain.ErrorInvalidGrant, userDomain.ErrEmailNotVerified.Error())
+		}
+		return nil, domain.NewOAuthError(domain.ErrorInvalidGrant, userDomain.ErrInvalidCredentials.Error())
 	}
 
-	// Generar tokens
-	accessToken, err := utils.GenerateJWT(user.ID.Hex(), user.Role, scopes, u.jwtSecret, u.tokenExp)
-	if err != nil {
-		return nil, err
+	// Con la verificación en dos pasos activa se exige el código TOTP. Como el email sin
+	// verificar, solo se informa a quien ya dio la contraseña correcta.
+	if user.TwoFactorEnabled {
+		if req.OTP == "" {
+			u.recordLoginFailure(client.ClientID, req.Username, userDomain.ErrOTPRequired)
+			return nil, domain.NewOAuthError(domain.ErrorInvalidGrant, userDomain.ErrOTPRequired.Error())
+		}
+		if err := u.userUC.VerifyTwoFactor(user.ID.Hex(), req.OTP); err != nil {
+			u.recordLoginFailure(client.ClientID, req.Username, err)
+			if errors.Is(err, userDomain.ErrInvalidOTP) {
+				return nil, domain.NewOAuthError(domain.ErrorInvalidGrant, userDomain.ErrInvalidOTP.Error())
+			}
+			if errors.Is(err, userDomain.ErrTwoFactorLocked) {
+				return nil, domain.NewOAuthError(domain.ErrorInvalidGrant, userDomain.ErrTwoFactorLocked.Error())
+			}
+			return nil, err
+		}
+	}
+
+	// Una contraseña temporal (ej. de una importación) no da acceso: el cliente repite el grant con
+	// new_password y la sesión se emite tras reemplazarla. Como el 2FA, solo se informa a quien ya
+	// dio la contraseña correcta.
+	if user.MustChangePassword {
+		if err := u.replaceTemporaryPassword(user, req); err != nil {
+			u.recordLoginFailure(client.ClientID, req.Username, err)
+			if errors.Is(err, userDomain.ErrPasswordChangeRequired) || errors.Is(err, userDomain.ErrPasswordUnchanged) ||
+				errors.Is(err, utils.ErrWeakPassword) {
+				return nil, domain.NewOAuthError(domain.ErrorInvalidGrant, err.Error())
+			}
+			return nil, err
+		}
 	}
 
+	// Con sesión única, las sesiones anteriores del usuario se revocan antes de emitir la nueva
+	if u.singleSession {
+		if _, err := u.RevokeUserTokens(user.ID.Hex()); err != nil {
+			return nil, err
+		}
+	}
+
+	// Generar tokens
 	refreshToken, err := utils.GenerateRandomToken(32)
 	if err != nil {
 		return nil, err
 	}
 
-	// Guardar token en la base de datos
-	expiresAt := time.Now().Add(u.tokenExp)
-	refreshExpiresAt := time.Now().Add(u.refreshExp)
+	now := u.now()
+	expiresAt := now.Add(u.tokenExp)
+	refreshExpiresAt := now.Add(u.refreshExp)
 	token := &domain.Token{
-		AccessToken:      accessToken,
 		RefreshToken:     refreshToken,
 		UserID:           user.ID.Hex(),
 		ClientID:         client.ClientID,
+		ClientName:       client.Name,
 		Scopes:           scopes,
 		ExpiresAt:        expiresAt,
 		RefreshExpiresAt: refreshExpiresAt,
-		CreatedAt:        time.Now(),
+		CreatedAt:        now,
+		AuthTime:         now,
+		DeviceID:         req.DeviceID,
+	}
+	if err := u.issueAccessToken(token, user.Role); err != nil {
+		return nil, err
 	}
 
+	// Guardar token en la base de datos
 	if err := u.tokenRepo.Create(token); err != nil {
 		return nil, err
 	}
 
 	// Actualizar refresh token del usuario
-	if err := u.userUC.UpdateRefreshToken(user.ID.Hex(), refreshToken); err != nil {
+	if err := u.userUC.UpdateRefreshToken(user.ID.Hex(), utils.HashToken(refreshToken)); err != nil {
 		return nil, err
 	}
 
+	// El último inicio de sesión es informativo: si no se registra no se rechaza el login
+	if err := u.userUC.RecordLogin(user.ID.Hex(), req.ClientIP); err != nil {
+		log.Printf("[WARN] no se pudo registrar el inicio de sesión user=%s error=%v", user.ID.Hex(), err)
+	}
+
 	// Preparar respuesta
-	return &domain.OAuthResponse{
-		AccessToken:  accessToken,
-		TokenType:    domain.TokenTypeBearer,
-		ExpiresIn:    int(u.tokenExp.Seconds()),
-		RefreshToken: refreshToken,
-		Scope:        strings.Join(scopes, " "),
-	}, nil
+	response := u.newOAuthResponse(token.AccessToken, refreshToken, scopes)
+	if u.includeUserProfile {
+		profile, err := u.userUC.GetUser(user.ID.Hex())
+		if err != nil {
+			// La sesión ya se guardó: se revoca para no dejar tokens vigentes que el cliente no recibió
+			if revokeErr := u.RevokeToken(refreshToken); revokeErr != nil {
+				log.Printf("[ERROR] no se pudo revocar la sesión sin perfil user=%s error=%v", user.ID.Hex(), revokeErr)
+			}
+			return nil, err
+		}
+		response.User = profile
+	}
+
+	return response, nil
+}
+
+// replaceTemporaryPassword cambia la contraseña temporal del usuario por req.NewPassword, que debe
+// cumplir la política de contraseñas y ser distinta de la temporal
+func (u *oauthUseCase) replaceTemporaryPassword(user *userDomain.User, req *domain.OAuthRequest) error {
+	if req.NewPassword == "" {
+		return userDomain.ErrPasswordChangeRequired
+	}
+	if req.NewPassword == req.Password {
+		return userDomain.ErrPasswordUnchanged
+	}
+	return u.userUC.ChangePassword(user.ID.Hex(), &userDomain.ChangePasswordRequest{
+		OldPassword: req.Password,
+		NewPassword: req.NewPassword,
+	})
+}
+
+// recordLoginFailure registra el motivo de un inicio de sesión fallido en el log y, si está
+// configurado, en el LoginFailureRecorder
+func (u *oauthUseCase) recordLoginFailure(clientID, username string, err error) {
+	reason := userDomain.CredentialFailureReason(err)
+	if reason == "error" {
+		log.Printf("[ERROR] validación de credenciales fallida client_id=%s error=%v", clientID, err)
+	} else {
+		log.Printf("[WARN] inicio de sesión fallido client_id=%s reason=%s", clientID, reason)
+	}
+	if u.loginFailures != nil {
+		u.loginFailures.RecordLoginFailure(clientID, username, reason)
+	}
 }
 
 // handleRefreshTokenGrant maneja la concesión de tipo refresh_token
 // En internal/oauth/usecase/oauth_usecase.go, actualiza la función handleRefreshTokenGrant
 
-func (u *oauthUseCase) handleRefreshTokenGrant(req *domain.OAuthRequest, client *domain.Client, scopes []string) (*domain.OAuthResponse, error) {
+func (u *oauthUseCase) handleRefreshTokenGrant(req *domain.OAuthRequest, client *domain.Client) (*domain.OAuthResponse, error) {
 	// Validar que se proporcionó un refresh token
 	if req.RefreshToken == "" {
-		return nil, errors.New("refresh token requerido")
+		return nil, domain.NewOAuthError(domain.ErrorInvalidRequest, "refresh token requerido")
 	}
 
-	// Usar la nueva función de validación
-	oldToken, err := u.ValidateRefreshToken(req.RefreshToken)
+	// Las comprobaciones de la solicitud se hacen antes de canjear el token: en modo estricto
+	// canjearlo elimina la sesión y un error del cliente no debe dejar al usuario sin ella
+	session, err := u.findRefreshToken(req.RefreshToken)
 	if err != nil {
 		return nil, err
 	}
 
 	// Verificar que el token pertenezca al mismo cliente
-	if oldToken.ClientID != client.ClientID {
-		return nil, errors.New("refresh token no válido para este cliente")
+	if session.ClientID != client.ClientID {
+		return nil, domain.NewOAuthError(domain.ErrorInvalidGrant, "refresh token no válido para este cliente")
 	}
 
-	// Si no se proporcionaron scopes, usar los del token anterior
-	if len(scopes) == 0 {
-		scopes = oldToken.Scopes
+	if err := u.checkDeviceBinding(session, req.DeviceID); err != nil {
+		return nil, err
 	}
 
-	// Generar nuevos tokens
-	accessToken, err := utils.GenerateJWT(oldToken.UserID, "", scopes, u.jwtSecret, u.tokenExp)
+	// El nuevo token no puede tener scopes que el anterior no tenía (RFC 6749 §6): sin scope
+	// solicitado se conservan los del token anterior que el cliente aún tiene permitidos, y los
+	// solicitados se limitan a ellos
+	scopes := intersectScopes(session.Scopes, client.AllowedScopes(domain.GrantTypeRefreshToken))
+	if req.Scope != "" {
+		scopes = intersectScopes(strings.Fields(req.Scope), scopes)
+		if len(scopes) == 0 {
+			return nil, domain.NewOAuthError(domain.ErrorInvalidScope, "los scopes solicitados no fueron concedidos al token original")
+		}
+	}
+
+	oldToken, err := u.takeRefreshToken(session, req.RefreshToken)
 	if err != nil {
 		return nil, err
 	}
 
+	// Generar nuevos tokens con el rol y los permisos actuales del usuario
+	role := ""
+	if oldToken.UserID != "" {
+		if user, err := u.userUC.GetUser(oldToken.UserID); err == nil {
+			role = user.Role
+		}
+	}
 	refreshToken, err := utils.GenerateRandomToken(32)
 	if err != nil {
 		return nil, err
 	}
 
-	// Eliminar token antiguo
-	if err := u.tokenRepo.DeleteByRefreshToken(req.RefreshToken); err != nil {
+	// Eliminar token antiguo (en modo estricto ya se consumió al obtenerlo)
+	if err := u.revokeAccessToken(oldToken); err != nil {
 		return nil, err
 	}
+	if !u.strictRefresh {
+		if err := u.tokenRepo.DeleteByRefreshToken(req.RefreshToken); err != nil {
+			return nil, err
+		}
+	}
 
 	// Guardar nuevo token con fechas de expiración configuradas
-	accessExpiresAt := time.Now().Add(u.tokenExp)
-	refreshExpiresAt := time.Now().Add(u.refreshExp)
+	now := u.now()
+	accessExpiresAt := now.Add(u.tokenExp)
+	refreshExpiresAt := now.Add(u.refreshExp)
 
 	token := &domain.Token{
-		AccessToken:      accessToken,
-		RefreshToken:     refreshToken,
-		UserID:           oldToken.UserID,
-		ClientID:         client.ClientID,
-		Scopes:           scopes,
-		ExpiresAt:        accessExpiresAt,
-		RefreshExpiresAt: refreshExpiresAt,
-		CreatedAt:        time.Now(),
+		RefreshToken:         refreshToken,
+		UserID:               oldToken.UserID,
+		ClientID:             client.ClientID,
+		ClientName:           client.Name,
+		Scopes:               scopes,
+		ExpiresAt:            accessExpiresAt,
+		RefreshExpiresAt:     refreshExpiresAt,
+		CreatedAt:            now,
+		AuthTime:             oldToken.AuthTime, // Refrescar no es una nueva autenticación
+		FamilyID:             oldToken.FamilyID,
+		DeviceID:             oldToken.DeviceID,
+		RotatedRefreshTokens: rotatedRefreshTokens(oldToken.RotatedRefreshTokens, req.RefreshToken),
+	}
+	if token.FamilyID == "" {
+		token.FamilyID = oldToken.ID.Hex() // Sesiones anteriores a las familias
+	}
+	if err := u.issueAccessToken(token, role); err != nil {
+		return nil, err
 	}
 
 	if err := u.tokenRepo.Create(token); err != nil {
@@ -199,119 +601,671 @@ func (u *oauthUseCase) handleRefreshTokenGrant(req *domain.OAuthRequest, client
 
 	// Actualizar refresh token del usuario si hay un usuario asociado
 	if oldToken.UserID != "" {
-		if err := u.userUC.UpdateRefreshToken(oldToken.UserID, refreshToken); err != nil {
+		if err := u.userUC.UpdateRefreshToken(oldToken.UserID, utils.HashToken(refreshToken)); err != nil {
 			return nil, err
 		}
 	}
 
 	// Preparar respuesta
+	return u.newOAuthResponse(token.AccessToken, refreshToken, scopes), nil
+}
+
+// handleClientCredentialsGrant maneja la concesión de tipo client_credentials
+func (u *oauthUseCase) handleClientCredentialsGrant(client *domain.Client, scopes []string) (*domain.OAuthResponse, error) {
+	// Generar access token para el cliente (sin usuario asociado).
+	// No se genera refresh token para client credentials
+	now := u.now()
+	token := &domain.Token{
+		ClientID:   client.ClientID,
+		ClientName: client.Name,
+		Scopes:     scopes,
+		ExpiresAt:  now.Add(u.tokenExp),
+		CreatedAt:  now,
+	}
+	if err := u.issueAccessToken(token, "client"); err != nil {
+		return nil, err
+	}
+
+	if err := u.tokenRepo.Create(token); err != nil {
+		return nil, err
+	}
+
+	// Preparar respuesta (sin refresh token)
+	return u.newOAuthResponse(token.AccessToken, "", scopes), nil
+}
+
+// newOAuthResponse construye la respuesta de token omitiendo los campos vacíos.
+// Los scopes vacíos se descartan para que un conjunto sin scopes no se serialice como "".
+func (u *oauthUseCase) newOAuthResponse(accessToken, refreshToken string, scopes []string) *domain.OAuthResponse {
+	var nonEmpty []string
+	for _, s := range scopes {
+		if s = strings.TrimSpace(s); s != "" {
+			nonEmpty = append(nonEmpty, s)
+		}
+	}
+
 	return &domain.OAuthResponse{
 		AccessToken:  accessToken,
 		TokenType:    domain.TokenTypeBearer,
 		ExpiresIn:    int(u.tokenExp.Seconds()),
 		RefreshToken: refreshToken,
-		Scope:        strings.Join(scopes, " "),
-	}, nil
+		Scope:        strings.Join(nonEmpty, " "),
+	}
 }
 
-// handleClientCredentialsGrant maneja la concesión de tipo client_credentials
-func (u *oauthUseCase) handleClientCredentialsGrant(client *domain.Client, scopes []string) (*domain.OAuthResponse, error) {
-	// Generar access token para el cliente (sin usuario asociado)
-	accessToken, err := utils.GenerateJWT("", "client", scopes, u.jwtSecret, u.tokenExp)
+// issueAccessToken genera el access token de la sesión con el rol y los permisos actuales del usuario.
+// En modo JWT los claims viajan firmados en el token; en modo opaco el token es aleatorio y los
+// claims se guardan en la propia sesión. El JWT expira junto con la sesión (token.ExpiresAt).
+func (u *oauthUseCase) issueAccessToken(token *domain.Token, role string) error {
+	var permissions []string
+	if u.permissionResolver != nil && token.UserID != "" {
+		resolved, err := u.permissionResolver.GetUserPermissions(token.UserID)
+		if err != nil {
+			return err
+		}
+		permissions = resolved
+	}
+
+	// El nombre del cliente solo se conserva si se emiten sus claims
+	if !u.clientClaims {
+		token.ClientName = ""
+	}
+
+	if u.opaqueTokens {
+		accessToken, err := utils.GenerateRandomToken(32)
+		if err != nil {
+			return err
+		}
+		token.AccessToken = accessToken
+		token.JTI = ""
+		token.Opaque = true
+		token.Role = role
+		token.Permissions = permissions
+		return nil
+	}
+
+	claims := &utils.Claims{
+		UserID:      token.UserID,
+		Role:        role,
+		Scopes:      token.Scopes,
+		Permissions: permissions,
+	}
+	if !token.AuthTime.IsZero() {
+		claims.AuthTime = jwt.NewNumericDate(token.AuthTime)
+	}
+	if u.clientClaims {
+		claims.ClientID = token.ClientID
+		claims.ClientName = token.ClientName
+	}
+	jti, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return err
+	}
+	claims.ID = jti
+	accessToken, err := u.signer.SignAt(claims, u.now(), token.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	token.AccessToken = accessToken
+	token.JTI = jti
+	token.Opaque = false
+	token.Role = ""
+	token.Permissions = nil
+	return nil
+}
+
+// RefreshClaims reemite el access token de la sesión actual con el rol y los permisos vigentes,
+// sin intercambiar el refresh token. El token anterior deja de ser válido. El nuevo token conserva
+// la expiración del anterior, de modo que reemitirlo no prolonga la sesión.
+func (u *oauthUseCase) RefreshClaims(accessToken string) (*domain.OAuthResponse, error) {
+	// Validar la sesión actual
+	userID, _, err := u.ValidateToken(accessToken)
+	if err != nil {
+		return nil, invalidTokenError(err)
+	}
+
+	token, err := u.tokenRepo.GetByAccessToken(accessToken)
+	if errors.Is(err, domain.ErrTokenNotFound) {
+		return nil, domain.NewOAuthError(domain.ErrorInvalidToken, utils.ErrTokenInvalid.Error())
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	// No se genera refresh token para client credentials
-	expiresAt := time.Now().Add(u.tokenExp)
-	token := &domain.Token{
-		AccessToken: accessToken,
-		ClientID:    client.ClientID,
-		Scopes:      scopes,
-		ExpiresAt:   expiresAt,
-		CreatedAt:   time.Now(),
+	if userID == "" || token.UserID != userID {
+		return nil, domain.NewOAuthError(domain.ErrorInvalidToken, "solo los tokens de usuario pueden actualizar sus claims")
 	}
 
-	if err := u.tokenRepo.Create(token); err != nil {
+	user, err := u.userUC.GetUser(userID)
+	if errors.Is(err, userDomain.ErrUserNotFound) {
+		return nil, domain.NewOAuthError(domain.ErrorInvalidToken, "usuario inactivo")
+	}
+	if err != nil {
 		return nil, err
 	}
+	if user.Status != userDomain.UserStatusActive {
+		return nil, domain.NewOAuthError(domain.ErrorInvalidToken, "usuario inactivo")
+	}
 
-	// Preparar respuesta
-	return &domain.OAuthResponse{
-		AccessToken: accessToken,
-		TokenType:   domain.TokenTypeBearer,
-		ExpiresIn:   int(u.tokenExp.Seconds()),
-		Scope:       strings.Join(scopes, " "),
-	}, nil
+	refreshed := *token
+	if maxExpiresAt := u.now().Add(u.tokenExp); maxExpiresAt.Before(refreshed.ExpiresAt) {
+		refreshed.ExpiresAt = maxExpiresAt
+	}
+	if err := u.issueAccessToken(&refreshed, user.Role); err != nil {
+		return nil, err
+	}
+
+	if err := u.tokenRepo.UpdateAccessToken(accessToken, &refreshed); err != nil {
+		return nil, err
+	}
+	if err := u.revokeAccessToken(token); err != nil {
+		return nil, err
+	}
+
+	// El refresh token de la sesión no cambia, por lo que no se incluye en la respuesta
+	resp := u.newOAuthResponse(refreshed.AccessToken, "", token.Scopes)
+	resp.ExpiresIn = int(refreshed.ExpiresAt.Sub(u.now()).Seconds())
+	return resp, nil
+}
+
+// invalidTokenError convierte un error de validación del token (expirado, mal formado, inválido
+// o revocado) en invalid_token. Los demás errores (ej. de la base de datos) se retornan tal
+// cual, para responder server_error.
+func invalidTokenError(err error) error {
+	for _, tokenErr := range []error{utils.ErrTokenExpired, utils.ErrTokenMalformed, utils.ErrTokenInvalid, utils.ErrTokenRevoked} {
+		if errors.Is(err, tokenErr) {
+			_, message := utils.TokenErrorCode(err)
+			return domain.NewOAuthError(domain.ErrorInvalidToken, message)
+		}
+	}
+	return err
 }
 
 // ValidateToken valida un token de acceso
 func (u *oauthUseCase) ValidateToken(accessToken string) (string, map[string]interface{}, error) {
+	userID, claims, err := u.validateToken(accessToken)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := u.ensureActiveUser(userID); err != nil {
+		return "", nil, err
+	}
+	return userID, claims, nil
+}
+
+// ensureActiveUser rechaza el token si su usuario dejó de estar activo (solo con
+// CheckUserStatus). Los tokens de client_credentials no tienen usuario y no se verifican.
+func (u *oauthUseCase) ensureActiveUser(userID string) error {
+	if !u.checkUserStatus || userID == "" {
+		return nil
+	}
+	user, err := u.userUC.GetUser(userID)
+	if err != nil || user.Status != userDomain.UserStatusActive {
+		return utils.ErrTokenRevoked
+	}
+	return nil
+}
+
+// validateToken valida la firma, la expiración y la sesión de un token de acceso
+func (u *oauthUseCase) validateToken(accessToken string) (string, map[string]interface{}, error) {
+	if u.statelessTokens {
+		return u.validateStatelessToken(accessToken)
+	}
+
 	// Verificar que el token exista en la base de datos
 	token, err := u.tokenRepo.GetByAccessToken(accessToken)
+	if errors.Is(err, domain.ErrTokenNotFound) {
+		return "", nil, utils.ErrTokenInvalid
+	}
 	if err != nil {
-		return "", nil, errors.New("token inválido")
+		return "", nil, err
 	}
 
 	// Verificar que el token no haya expirado
-	if time.Now().After(token.ExpiresAt) {
-		return "", nil, errors.New("token expirado")
+	if u.now().After(token.ExpiresAt) {
+		return "", nil, utils.ErrTokenExpired
+	}
+
+	// Los tokens opacos no contienen claims: se usan los guardados en la sesión
+	if token.Opaque {
+		return token.UserID, token.Claims(), nil
 	}
 
 	// Verificar y decodificar JWT
-	userID, claims, err := utils.ValidateJWT(accessToken, u.jwtSecret)
+	userID, claims, err := u.signer.Validate(accessToken)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return userID, claims, nil
+}
+
+// validateStatelessToken valida un JWT sin consultar la sesión: basta la firma, la expiración
+// y que su jti no esté en la lista de revocación
+func (u *oauthUseCase) validateStatelessToken(accessToken string) (string, map[string]interface{}, error) {
+	userID, claims, err := u.signer.Validate(accessToken)
 	if err != nil {
 		return "", nil, err
 	}
 
+	// Sin jti el token no podría revocarse, por lo que no se acepta
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return "", nil, utils.ErrTokenInvalid
+	}
+
+	if u.revocationList != nil {
+		revoked, err := u.revocationList.IsRevoked(jti)
+		if err != nil {
+			return "", nil, errors.New("no se pudo verificar la revocación del token")
+		}
+		if revoked {
+			return "", nil, utils.ErrTokenRevoked
+		}
+	}
+
 	return userID, claims, nil
 }
 
+// revokeAccessToken agrega el jti del access token a la lista de revocación. Solo es necesario
+// en modo sin estado: de lo contrario basta con eliminar o reemplazar la sesión.
+func (u *oauthUseCase) revokeAccessToken(token *domain.Token) error {
+	if !u.statelessTokens || u.revocationList == nil || token.JTI == "" {
+		return nil
+	}
+	if !u.now().Before(token.ExpiresAt) {
+		return nil
+	}
+	return u.revocationList.Revoke(token.JTI, token.ExpiresAt)
+}
+
 // ValidateRefreshToken valida un token de refresco y retorna el token si es válido
 func (u *oauthUseCase) ValidateRefreshToken(refreshToken string) (*domain.Token, error) {
 	// Buscar token en la base de datos
 	token, err := u.tokenRepo.GetByRefreshToken(refreshToken)
 	if err != nil {
-		return nil, errors.New("refresh token inválido o no encontrado")
+		return nil, domain.NewOAuthError(domain.ErrorInvalidGrant, "refresh token inválido o no encontrado")
+	}
+
+	if err := u.checkRefreshToken(token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// findRefreshToken obtiene la sesión de un refresh token sin canjearlo. Si el refresh token ya
+// fue canjeado se revoca su familia (ver revokeReusedRefreshToken).
+func (u *oauthUseCase) findRefreshToken(refreshToken string) (*domain.Token, error) {
+	session, err := u.tokenRepo.GetByRefreshToken(refreshToken)
+	if err != nil {
+		invalidErr := domain.NewOAuthError(domain.ErrorInvalidGrant, "refresh token inválido o no encontrado")
+		if u.strictRefresh {
+			invalidErr = domain.ErrRefreshTokenConsumed
+		}
+		return nil, u.revokeReusedRefreshToken(refreshToken, invalidErr)
+	}
+	return session, nil
+}
+
+// takeRefreshToken canjea la sesión obtenida con findRefreshToken y la valida. En modo estricto
+// la elimina de forma atómica antes de validarla: la eliminación decide qué solicitud
+// concurrente gana y las demás reciben invalid_grant. Un token consumido que no pasa la
+// validación queda eliminado igualmente.
+func (u *oauthUseCase) takeRefreshToken(session *domain.Token, refreshToken string) (*domain.Token, error) {
+	token := session
+	if u.strictRefresh {
+		consumed, err := u.tokenRepo.ConsumeRefreshToken(refreshToken)
+		if err != nil {
+			return nil, err
+		}
+		if consumed == nil {
+			return nil, u.revokeReusedRefreshToken(refreshToken, domain.ErrRefreshTokenConsumed)
+		}
+		token = consumed
+	}
+
+	if err := u.checkRefreshToken(token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// revokeReusedRefreshToken se llama cuando el refresh token presentado no tiene sesión. Si ya fue
+// canjeado en una familia, alguien conserva una copia (posible robo): se eliminan todas las
+// sesiones de la familia, incluida la del cliente legítimo, que debe volver a iniciar sesión.
+// Retorna invalidErr para no revelar al cliente si se detectó la reutilización.
+func (u *oauthUseCase) revokeReusedRefreshToken(refreshToken string, invalidErr error) error {
+	session, err := u.tokenRepo.GetByRotatedRefreshToken(refreshToken)
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		return invalidErr
+	}
+
+	// Canje concurrente del mismo cliente que perdió la carrera contra la rotación
+	rotated := session.RotatedRefreshTokens
+	if rotated[len(rotated)-1] == utils.HashToken(refreshToken) && u.now().Sub(session.CreatedAt) < refreshReuseLeeway {
+		return invalidErr
+	}
+
+	log.Printf("[WARN] reutilización de refresh token detectada, se revoca la familia family=%s user=%s client=%s",
+		session.FamilyID, session.UserID, session.ClientID)
+	if err := u.revokeTokenFamily(session); err != nil {
+		return err
+	}
+	return invalidErr
+}
+
+// checkDeviceBinding compara el device_id recibido al refrescar con el de la sesión. En modo
+// enforce una discrepancia (incluido omitirlo) revoca la familia de tokens y se rechaza el refresco.
+func (u *oauthUseCase) checkDeviceBinding(token *domain.Token, deviceID string) error {
+	if u.deviceBinding != domain.DeviceBindingWarn && u.deviceBinding != domain.DeviceBindingEnforce {
+		return nil
+	}
+	if token.DeviceID == "" || token.DeviceID == deviceID {
+		return nil
+	}
+
+	log.Printf("[WARN] device_id distinto al refrescar mode=%s family=%s user=%s client=%s",
+		u.deviceBinding, token.FamilyID, token.UserID, token.ClientID)
+	if u.deviceBinding == domain.DeviceBindingWarn {
+		return nil
+	}
+
+	if err := u.revokeTokenFamily(token); err != nil {
+		return err
+	}
+	return domain.NewOAuthError(domain.ErrorInvalidGrant, "refresh token no válido para este dispositivo")
+}
+
+// revokeTokenFamily elimina todas las sesiones de la familia del token y revoca su access token
+func (u *oauthUseCase) revokeTokenFamily(token *domain.Token) error {
+	if err := u.revokeAccessToken(token); err != nil {
+		return err
+	}
+	if token.FamilyID != "" {
+		if _, err := u.tokenRepo.DeleteByFamily(token.FamilyID); err != nil {
+			return err
+		}
+	} else if _, err := u.tokenRepo.DeleteByID(token.ID.Hex()); err != nil { // Sesiones anteriores a las familias
+		return err
 	}
+	_ = u.clearUserRefreshToken(token)
+	return nil
+}
 
+// rotatedRefreshTokens agrega el hash del refresh token canjeado al historial de la familia,
+// conservando como máximo maxRotatedRefreshTokens entradas
+func rotatedRefreshTokens(history []string, refreshToken string) []string {
+	rotated := make([]string, 0, len(history)+1)
+	rotated = append(rotated, history...)
+	rotated = append(rotated, utils.HashToken(refreshToken))
+	if len(rotated) > maxRotatedRefreshTokens {
+		rotated = rotated[len(rotated)-maxRotatedRefreshTokens:]
+	}
+	return rotated
+}
+
+// checkRefreshToken verifica que el refresh token no haya expirado y que su usuario siga activo
+func (u *oauthUseCase) checkRefreshToken(token *domain.Token) error {
 	// Verificar que el token no haya expirado
-	if token.RefreshExpiresAt.Before(time.Now()) {
-		return nil, errors.New("refresh token expirado")
+	if token.RefreshExpiresAt.Before(u.now()) {
+		return domain.NewOAuthError(domain.ErrorInvalidGrant, "refresh token expirado")
 	}
 
 	// Si hay un usuario asociado, verificar que esté activo
 	if token.UserID != "" {
 		user, err := u.userUC.GetUser(token.UserID)
 		if err != nil {
-			return nil, errors.New("usuario no encontrado")
+			return domain.NewOAuthError(domain.ErrorInvalidGrant, "usuario no encontrado")
 		}
 
 		if user.Status != userDomain.UserStatusActive {
-			return nil, errors.New("usuario inactivo")
+			return domain.NewOAuthError(domain.ErrorInvalidGrant, "usuario inactivo")
 		}
 	}
 
-	return token, nil
+	return nil
 }
 
 // RevokeToken revoca un token de refresco
 func (u *oauthUseCase) RevokeToken(refreshToken string) error {
+	// Revocar también el access token vigente de la sesión
+	token, err := u.tokenRepo.GetByRefreshToken(refreshToken)
+	if err == nil {
+		if err := u.revokeAccessToken(token); err != nil {
+			return err
+		}
+	}
+
 	// Eliminar token
 	if err := u.tokenRepo.DeleteByRefreshToken(refreshToken); err != nil {
 		return err
 	}
 
-	// Intentar obtener usuario por refresh token
-	user, err := u.userUC.GetUserByRefreshToken(refreshToken)
-	if err == nil {
-		// Limpiar refresh token del usuario
-		_ = u.userUC.UpdateRefreshToken(user.ID.Hex(), "")
+	// Limpiar el refresh token del usuario si es el de esta sesión
+	if token != nil {
+		_ = u.clearUserRefreshToken(token)
 	}
 
 	return nil
 }
 
+// ExpireToken elimina un token específico por su ID (uso administrativo).
+// Si el refresh token eliminado es el vigente del usuario, también se limpia del usuario.
+// Retorna true si se eliminó un token.
+func (u *oauthUseCase) ExpireToken(tokenID string) (bool, error) {
+	token, err := u.tokenRepo.DeleteByID(tokenID)
+	if err != nil {
+		return false, err
+	}
+	if token == nil {
+		return false, nil
+	}
+
+	if err := u.revokeAccessToken(token); err != nil {
+		return true, err
+	}
+	if err := u.clearUserRefreshToken(token); err != nil {
+		return true, err
+	}
+
+	return true, nil
+}
+
+// RevokeUserTokens elimina todas las sesiones del usuario (ej. al archivarlo o desactivarlo) y
+// retorna cuántas estaban activas. En modo sin estado también revoca sus access tokens vigentes.
+func (u *oauthUseCase) RevokeUserTokens(userID string) (int64, error) {
+	if userID == "" {
+		return 0, errors.New("user_id es requerido")
+	}
+
+	tokens, err := u.tokenRepo.GetActiveByUserID(userID)
+	if err != nil {
+		return 0, err
+	}
+	for _, token := range tokens {
+		if err := u.revokeAccessToken(token); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := u.tokenRepo.DeleteByUserID(userID); err != nil {
+		return 0, err
+	}
+	if len(tokens) > 0 {
+		if err := u.userUC.UpdateRefreshToken(userID, ""); err != nil {
+			return int64(len(tokens)), err
+		}
+	}
+
+	return int64(len(tokens)), nil
+}
+
+// RevokeClientTokens elimina todas las sesiones emitidas al cliente (ej. al eliminarlo) y retorna
+// cuántas se eliminaron. En modo sin estado también revoca sus access tokens vigentes.
+func (u *oauthUseCase) RevokeClientTokens(clientID string) (int64, error) {
+	if clientID == "" {
+		return 0, errors.New("client_id es requerido")
+	}
+
+	tokens, err := u.tokenRepo.GetActiveByClientID(clientID)
+	if err != nil {
+		return 0, err
+	}
+	for _, token := range tokens {
+		if err := u.revokeAccessToken(token); err != nil {
+			return 0, err
+		}
+		if err := u.clearUserRefreshToken(token); err != nil {
+			return 0, err
+		}
+	}
+
+	return u.tokenRepo.DeleteByClientID(clientID)
+}
+
+// clearUserRefreshToken borra el refresh token guardado en el usuario si corresponde a la
+// sesión eliminada. El usuario guarda el mismo hash que la sesión (o el texto plano en las
+// sesiones anteriores al hash), por lo que se compara con el valor leído del repositorio.
+func (u *oauthUseCase) clearUserRefreshToken(token *domain.Token) error {
+	if token.UserID == "" || token.RefreshToken == "" {
+		return nil
+	}
+	user, err := u.userUC.GetUserByRefreshToken(token.RefreshToken)
+	if err != nil || user.ID.Hex() != token.UserID {
+		return nil
+	}
+	return u.userUC.UpdateRefreshToken(token.UserID, "")
+}
+
+// GetAuthorizedClients lista los clientes con sesiones activas del usuario, agrupando sus
+// tokens por cliente. Los más usados recientemente aparecen primero.
+func (u *oauthUseCase) GetAuthorizedClients(userID string) ([]*domain.AuthorizedClient, error) {
+	tokens, err := u.tokenRepo.GetActiveByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	type aggregate struct {
+		client     *domain.AuthorizedClient
+		lastUsedAt time.Time
+		expiresAt  time.Time
+	}
+	byClient := make(map[string]*aggregate)
+	var order []string
+	for _, token := range tokens {
+		agg, ok := byClient[token.ClientID]
+		if !ok {
+			agg = &aggregate{client: &domain.AuthorizedClient{ClientID: token.ClientID, Scopes: []string{}}}
+			byClient[token.ClientID] = agg
+			order = append(order, token.ClientID)
+		}
+
+		agg.client.Sessions++
+		for _, scope := range token.Scopes {
+			if !contains(agg.client.Scopes, scope) {
+				agg.client.Scopes = append(agg.client.Scopes, scope)
+			}
+		}
+		if token.CreatedAt.After(agg.lastUsedAt) {
+			agg.lastUsedAt = token.CreatedAt
+		}
+		expiresAt := token.ExpiresAt
+		if token.RefreshExpiresAt.After(expiresAt) {
+			expiresAt = token.RefreshExpiresAt
+		}
+		if expiresAt.After(agg.expiresAt) {
+			agg.expiresAt = expiresAt
+		}
+	}
+
+	clients := make([]*domain.AuthorizedClient, 0, len(order))
+	for _, clientID := range order {
+		agg := byClient[clientID]
+		// Un cliente eliminado se lista sin nombre para que el usuario pueda desconectarlo
+		if client, err := u.clientRepo.GetByClientID(clientID); err == nil {
+			agg.client.ClientName = client.Name
+		}
+		agg.client.LastUsedAt = utils.NewTimestamp(agg.lastUsedAt)
+		agg.client.ExpiresAt = utils.NewTimestamp(agg.expiresAt)
+		clients = append(clients, agg.client)
+	}
+
+	sort.SliceStable(clients, func(i, j int) bool {
+		return clients[i].LastUsedAt.After(clients[j].LastUsedAt.Time)
+	})
+	return clients, nil
+}
+
+// RevokeClientAuthorization elimina las sesiones activas del usuario con un cliente y revoca
+// sus access tokens. Retorna la cantidad de sesiones eliminadas.
+func (u *oauthUseCase) RevokeClientAuthorization(userID, clientID string) (int64, error) {
+	if clientID == "" {
+		return 0, errors.New("client_id es requerido")
+	}
+
+	tokens, err := u.tokenRepo.GetActiveByUserID(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	var removed int64
+	for _, token := range tokens {
+		if token.ClientID != clientID {
+			continue
+		}
+
+		deleted, err := u.tokenRepo.DeleteByID(token.ID.Hex())
+		if err != nil {
+			return removed, err
+		}
+		if deleted == nil {
+			continue // Eliminado por otra solicitud
+		}
+		removed++
+
+		if err := u.revokeAccessToken(deleted); err != nil {
+			return removed, err
+		}
+		if err := u.clearUserRefreshToken(deleted); err != nil {
+			return removed, err
+		}
+	}
+
+	return removed, nil
+}
+
+// TransferClientOwnership reasigna los clientes OAuth de un usuario a otro (ej. al dar de baja al usuario).
+// El usuario destino debe existir y estar activo.
+func (u *oauthUseCase) TransferClientOwnership(fromUserID, toUserID string) (int64, error) {
+	if err := utils.ValidateOwnershipTransfer(fromUserID, toUserID); err != nil {
+		return 0, err
+	}
+
+	target, err := u.userUC.GetUser(toUserID)
+	if err != nil {
+		return 0, err
+	}
+	if target.Status != userDomain.UserStatusActive {
+		return 0, errors.New("el usuario destino no está activo")
+	}
+
+	return u.clientRepo.TransferOwnership(fromUserID, toUserID)
+}
+
+// intersectScopes retorna los scopes de requested que también están en granted, en el orden de requested
+func intersectScopes(requested, granted []string) []string {
+	var scopes []string
+	for _, s := range requested {
+		if contains(granted, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
 // contains verifica si un slice contiene un elemento
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
@@ -0,0 +1,2058 @@
+package usecase
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/black4ninja/mi-proyecto/internal/oauth/domain"
+	userDomain "github.com/black4ninja/mi-proyecto/internal/user/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+const testSecret = "secreto_de_prueba"
+
+// newTestClient crea un cliente con todos los tipos de concesión soportados
+func newTestClient() *domain.Client {
+	return &domain.Client{
+		ClientID:     "cliente-prueba",
+		ClientSecret: "secreto-cliente",
+		Name:         "Cliente de prueba",
+		GrantTypes: []string{
+			domain.GrantTypePassword,
+			domain.GrantTypeRefreshToken,
+			domain.GrantTypeClientCredentials,
+		},
+		Scopes: []string{"read", "write"},
+	}
+}
+
+// newTestOAuthUseCase construye el caso de uso con repositorios en memoria
+func newTestOAuthUseCase(clientRepo *fakeClientRepo, tokenRepo *fakeTokenRepo, userUC *fakeUserUseCase) *oauthUseCase {
+	return NewOAuthUseCase(clientRepo, tokenRepo, userUC, testSecret, 15*time.Minute, time.Hour).(*oauthUseCase)
+}
+
+func TestGenerateTokenRejectsUnknownGrantTypeBeforeClientLookup(t *testing.T) {
+	for _, grantType := range []string{"", "implicit", "PASSWORD", "urn:ietf:params:oauth:grant-type:device_code"} {
+		t.Run(grantType, func(t *testing.T) {
+			clientRepo := newFakeClientRepo(newTestClient())
+			uc := newTestOAuthUseCase(clientRepo, newFakeTokenRepo(), newFakeUserUseCase())
+
+			// Incluso con credenciales de cliente inválidas, el error debe ser de grant_type
+			_, err := uc.GenerateToken(&domain.OAuthRequest{
+				GrantType:    grantType,
+				ClientID:     "desconocido",
+				ClientSecret: "incorrecto",
+			})
+
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, domain.ErrUnsupportedGrantType))
+			assert.Equal(t, 0, clientRepo.validateCalls, "no se debe consultar el repositorio de clientes")
+		})
+	}
+}
+
+func TestGenerateTokenGloballyDisabledGrantType(t *testing.T) {
+	clientRepo := newFakeClientRepo(newTestClient())
+	uc := NewOAuthUseCase(clientRepo, newFakeTokenRepo(), newFakeUserUseCase(), testSecret, 15*time.Minute, time.Hour,
+		WithEnabledGrantTypes(domain.GrantTypeClientCredentials, domain.GrantTypeRefreshToken))
+
+	t.Run("deshabilitado aunque el cliente lo permita", func(t *testing.T) {
+		_, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypePassword,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+			Username:     "usuario@example.com",
+			Password:     "secreto",
+		})
+
+		assert.ErrorIs(t, err, domain.ErrUnsupportedGrantType)
+		assert.Equal(t, 0, clientRepo.validateCalls, "no se debe consultar el repositorio de clientes")
+	})
+
+	t.Run("los habilitados siguen funcionando", func(t *testing.T) {
+		resp, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypeClientCredentials,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+		})
+
+		require.NoError(t, err)
+		assert.NotEmpty(t, resp.AccessToken)
+	})
+}
+
+func TestGenerateTokenKnownGrantTypeValidatesClient(t *testing.T) {
+	clientRepo := newFakeClientRepo(newTestClient())
+	uc := newTestOAuthUseCase(clientRepo, newFakeTokenRepo(), newFakeUserUseCase())
+
+	resp, err := uc.GenerateToken(&domain.OAuthRequest{
+		GrantType:    domain.GrantTypeClientCredentials,
+		ClientID:     "cliente-prueba",
+		ClientSecret: "secreto-cliente",
+	})
+
+	require.NoError(t, err)
+	assert.NotEmpty(t, resp.AccessToken)
+	assert.Equal(t, 1, clientRepo.validateCalls)
+}
+
+// responseKeys serializa la respuesta y retorna los campos JSON presentes
+func responseKeys(t *testing.T, resp *domain.OAuthResponse) map[string]interface{} {
+	t.Helper()
+	raw, err := json.Marshal(resp)
+	require.NoError(t, err)
+	var fields map[string]interface{}
+	require.NoError(t, json.Unmarshal(raw, &fields))
+	return fields
+}
+
+func TestTokenResponseJSONShape(t *testing.T) {
+	user := newTestUser("usuario@example.com", "secreto123")
+
+	t.Run("client_credentials omite refresh_token", func(t *testing.T) {
+		uc := newTestOAuthUseCase(newFakeClientRepo(newTestClient()), newFakeTokenRepo(), newFakeUserUseCase())
+		resp, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypeClientCredentials,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+			Scope:        "read",
+		})
+		require.NoError(t, err)
+
+		fields := responseKeys(t, resp)
+		assert.NotContains(t, fields, "refresh_token")
+		assert.Equal(t, "read", fields["scope"])
+		assert.Equal(t, domain.TokenTypeBearer, fields["token_type"])
+	})
+
+	t.Run("password incluye refresh_token", func(t *testing.T) {
+		uc := newTestOAuthUseCase(newFakeClientRepo(newTestClient()), newFakeTokenRepo(), newFakeUserUseCase(user))
+		resp, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypePassword,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+			Username:     "usuario@example.com",
+			Password:     "secreto123",
+			Scope:        "read  write",
+		})
+		require.NoError(t, err)
+
+		fields := responseKeys(t, resp)
+		assert.NotEmpty(t, fields["refresh_token"])
+		assert.Equal(t, "read write", fields["scope"])
+	})
+
+	t.Run("cliente sin scopes omite scope", func(t *testing.T) {
+		client := newTestClient()
+		client.Scopes = []string{"", " "}
+		uc := newTestOAuthUseCase(newFakeClientRepo(client), newFakeTokenRepo(), newFakeUserUseCase())
+		resp, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypeClientCredentials,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+		})
+		require.NoError(t, err)
+
+		fields := responseKeys(t, resp)
+		assert.NotContains(t, fields, "scope")
+		assert.NotContains(t, fields, "refresh_token")
+		assert.ElementsMatch(t, []string{"access_token", "token_type", "expires_in"}, keysOf(fields))
+	})
+}
+
+func keysOf(fields map[string]interface{}) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestTransferClientOwnership(t *testing.T) {
+	origin := newTestUser("saliente@example.com", "secreto123")
+	target := newTestUser("destino@example.com", "secreto123")
+	inactive := newTestUser("inactivo@example.com", "secreto123")
+	inactive.Status = userDomain.UserStatusArchived
+
+	newClients := func() *fakeClientRepo {
+		owned := newTestClient()
+		owned.OwnerID = origin.ID.Hex()
+		other := newTestClient()
+		other.ClientID = "cliente-ajeno"
+		other.OwnerID = "otro-usuario"
+		return newFakeClientRepo(owned, other)
+	}
+
+	t.Run("reasigna solo los clientes del usuario origen", func(t *testing.T) {
+		clientRepo := newClients()
+		uc := newTestOAuthUseCase(clientRepo, newFakeTokenRepo(), newFakeUserUseCase(origin, target))
+
+		moved, err := uc.TransferClientOwnership(origin.ID.Hex(), target.ID.Hex())
+
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), moved)
+		assert.Equal(t, target.ID.Hex(), clientRepo.clients["cliente-prueba"].OwnerID)
+		assert.Equal(t, "otro-usuario", clientRepo.clients["cliente-ajeno"].OwnerID)
+	})
+
+	t.Run("rechaza origen y destino iguales", func(t *testing.T) {
+		uc := newTestOAuthUseCase(newClients(), newFakeTokenRepo(), newFakeUserUseCase(origin))
+
+		_, err := uc.TransferClientOwnership(origin.ID.Hex(), origin.ID.Hex())
+		assert.ErrorIs(t, err, utils.ErrInvalidOwnershipTransfer)
+	})
+
+	t.Run("rechaza destino inexistente o inactivo", func(t *testing.T) {
+		clientRepo := newClients()
+		uc := newTestOAuthUseCase(clientRepo, newFakeTokenRepo(), newFakeUserUseCase(origin, inactive))
+
+		_, err := uc.TransferClientOwnership(origin.ID.Hex(), "desconocido")
+		assert.Error(t, err)
+
+		_, err = uc.TransferClientOwnership(origin.ID.Hex(), inactive.ID.Hex())
+		assert.Error(t, err)
+		assert.Equal(t, origin.ID.Hex(), clientRepo.clients["cliente-prueba"].OwnerID)
+	})
+}
+
+// permissionsClaim extrae el claim de permisos de un access token
+func permissionsClaim(t *testing.T, accessToken string) []interface{} {
+	t.Helper()
+	_, claims, err := utils.ValidateJWT(accessToken, testSecret)
+	require.NoError(t, err)
+	permissions, _ := claims["permissions"].([]interface{})
+	return permissions
+}
+
+func TestRefreshClaimsReflectsUpdatedPermissions(t *testing.T) {
+	user := newTestUser("usuario@example.com", "secreto123")
+	resolver := &fakePermissionResolver{permissions: map[string][]string{
+		user.ID.Hex(): {"users:read"},
+	}}
+	tokenRepo := newFakeTokenRepo()
+	uc := NewOAuthUseCase(newFakeClientRepo(newTestClient()), tokenRepo, newFakeUserUseCase(user),
+		testSecret, 15*time.Minute, time.Hour, WithPermissionResolver(resolver)).(*oauthUseCase)
+
+	resp, err := uc.GenerateToken(&domain.OAuthRequest{
+		GrantType:    domain.GrantTypePassword,
+		ClientID:     "cliente-prueba",
+		ClientSecret: "secreto-cliente",
+		Username:     "usuario@example.com",
+		Password:     "secreto123",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"users:read"}, permissionsClaim(t, resp.AccessToken))
+
+	// Los roles del usuario cambian a mitad de sesión
+	resolver.permissions[user.ID.Hex()] = []string{"users:read", "admin:users"}
+
+	refreshed, err := uc.RefreshClaims(resp.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"users:read", "admin:users"}, permissionsClaim(t, refreshed.AccessToken))
+	assert.Empty(t, refreshed.RefreshToken, "el refresh token de la sesión no se reemite")
+
+	// El token anterior deja de ser válido y el nuevo conserva la sesión
+	_, _, err = uc.ValidateToken(resp.AccessToken)
+	assert.Error(t, err)
+	session, err := tokenRepo.GetByAccessToken(refreshed.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, utils.HashToken(resp.RefreshToken), session.RefreshToken, "el repositorio guarda el hash")
+}
+
+func TestRefreshClaimsKeepsExpiration(t *testing.T) {
+	user := newTestUser("usuario@example.com", "secreto123")
+	tokenRepo := newFakeTokenRepo()
+	uc := newTestOAuthUseCase(newFakeClientRepo(newTestClient()), tokenRepo, newFakeUserUseCase(user))
+
+	resp, err := uc.GenerateToken(&domain.OAuthRequest{
+		GrantType:    domain.GrantTypePassword,
+		ClientID:     "cliente-prueba",
+		ClientSecret: "secreto-cliente",
+		Username:     "usuario@example.com",
+		Password:     "secreto123",
+	})
+	require.NoError(t, err)
+
+	// A la sesión le quedan dos minutos: reemitir los claims no debe prolongarla
+	session, err := tokenRepo.GetByAccessToken(resp.AccessToken)
+	require.NoError(t, err)
+	expiresAt := time.Now().Add(2 * time.Minute).Truncate(time.Second)
+	session.ExpiresAt = expiresAt
+
+	refreshed, err := uc.RefreshClaims(resp.AccessToken)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, refreshed.ExpiresIn, 120)
+
+	session, err = tokenRepo.GetByAccessToken(refreshed.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, expiresAt, session.ExpiresAt)
+	_, claims, err := utils.ValidateJWT(refreshed.AccessToken, testSecret)
+	require.NoError(t, err)
+	assert.InDelta(t, float64(expiresAt.Unix()), claims["exp"], 1)
+}
+
+func TestRefreshClaimsRejectsInvalidSessions(t *testing.T) {
+	user := newTestUser("usuario@example.com", "secreto123")
+	userUC := newFakeUserUseCase(user)
+	uc := newTestOAuthUseCase(newFakeClientRepo(newTestClient()), newFakeTokenRepo(), userUC)
+
+	t.Run("token desconocido", func(t *testing.T) {
+		_, err := uc.RefreshClaims("no-existe")
+		assert.Equal(t, domain.ErrorInvalidToken, domain.AsOAuthError(err).Code)
+	})
+
+	t.Run("token de cliente sin usuario", func(t *testing.T) {
+		resp, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypeClientCredentials,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+		})
+		require.NoError(t, err)
+
+		_, err = uc.RefreshClaims(resp.AccessToken)
+		assert.Equal(t, domain.ErrorInvalidToken, domain.AsOAuthError(err).Code)
+	})
+
+	t.Run("usuario desactivado", func(t *testing.T) {
+		resp, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypePassword,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+			Username:     "usuario@example.com",
+			Password:     "secreto123",
+		})
+		require.NoError(t, err)
+
+		user.Status = userDomain.UserStatusInactive
+		_, err = uc.RefreshClaims(resp.AccessToken)
+		assert.Equal(t, domain.ErrorInvalidToken, domain.AsOAuthError(err).Code)
+	})
+}
+
+// failingTokenRepo simula una falla de la base de datos al consultar sesiones
+type failingTokenRepo struct {
+	*fakeTokenRepo
+}
+
+func (r *failingTokenRepo) GetByAccessToken(string) (*domain.Token, error) {
+	return nil, errors.New("conexión perdida")
+}
+
+func TestRefreshClaimsReportsInternalErrors(t *testing.T) {
+	uc := newTestOAuthUseCase(newFakeClientRepo(newTestClient()), newFakeTokenRepo(), newFakeUserUseCase())
+	uc.tokenRepo = &failingTokenRepo{newFakeTokenRepo()}
+
+	_, err := uc.RefreshClaims("access")
+	require.Error(t, err)
+	assert.Equal(t, domain.ErrorServerError, domain.AsOAuthError(err).Code)
+}
+
+func TestExpireToken(t *testing.T) {
+	user := newTestUser("usuario@example.com", "secreto123")
+	userUC := newFakeUserUseCase(user)
+	tokenRepo := newFakeTokenRepo()
+	uc := newTestOAuthUseCase(newFakeClientRepo(newTestClient()), tokenRepo, userUC)
+
+	resp, err := uc.GenerateToken(&domain.OAuthRequest{
+		GrantType:    domain.GrantTypePassword,
+		ClientID:     "cliente-prueba",
+		ClientSecret: "secreto-cliente",
+		Username:     "usuario@example.com",
+		Password:     "secreto123",
+	})
+	require.NoError(t, err)
+	session, err := tokenRepo.GetByAccessToken(resp.AccessToken)
+	require.NoError(t, err)
+
+	t.Run("token existente", func(t *testing.T) {
+		removed, err := uc.ExpireToken(session.ID.Hex())
+		require.NoError(t, err)
+		assert.True(t, removed)
+
+		_, _, err = uc.ValidateToken(resp.AccessToken)
+		assert.Error(t, err)
+		assert.Empty(t, userUC.refreshs[user.ID.Hex()], "el refresh token del usuario se limpia")
+	})
+
+	t.Run("token inexistente", func(t *testing.T) {
+		removed, err := uc.ExpireToken(session.ID.Hex())
+		require.NoError(t, err)
+		assert.False(t, removed)
+	})
+
+	t.Run("ID inválido", func(t *testing.T) {
+		removed, err := uc.ExpireToken("no-es-un-object-id")
+		assert.ErrorIs(t, err, domain.ErrInvalidTokenID)
+		assert.False(t, removed)
+	})
+}
+
+func TestExpireTokenKeepsNewerUserRefreshToken(t *testing.T) {
+	user := newTestUser("usuario@example.com", "secreto123")
+	userUC := newFakeUserUseCase(user)
+	tokenRepo := newFakeTokenRepo()
+	uc := newTestOAuthUseCase(newFakeClientRepo(newTestClient()), tokenRepo, userUC)
+
+	login := func() *domain.OAuthResponse {
+		resp, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypePassword,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+			Username:     "usuario@example.com",
+			Password:     "secreto123",
+		})
+		require.NoError(t, err)
+		return resp
+	}
+
+	first := login()
+	second := login()
+	old, err := tokenRepo.GetByAccessToken(first.AccessToken)
+	require.NoError(t, err)
+
+	// Expirar la sesión antigua no afecta al refresh token vigente del usuario
+	removed, err := uc.ExpireToken(old.ID.Hex())
+	require.NoError(t, err)
+	assert.True(t, removed)
+	assert.Equal(t, utils.HashToken(second.RefreshToken), userUC.refreshs[user.ID.Hex()])
+}
+
+func TestGrantScopesRestrictClientCredentials(t *testing.T) {
+	client := newTestClient()
+	client.Scopes = []string{"read", "write", "admin"}
+	client.GrantScopes = map[string][]string{
+		domain.GrantTypeClientCredentials: {"read"},
+	}
+	user := newTestUser("usuario@example.com", "secreto123")
+	uc := newTestOAuthUseCase(newFakeClientRepo(client), newFakeTokenRepo(), newFakeUserUseCase(user))
+
+	t.Run("client_credentials no obtiene un scope exclusivo de password", func(t *testing.T) {
+		resp, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypeClientCredentials,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+			Scope:        "admin",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "read", resp.Scope)
+	})
+
+	t.Run("client_credentials usa sus scopes por defecto", func(t *testing.T) {
+		resp, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypeClientCredentials,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "read", resp.Scope)
+	})
+
+	t.Run("password recurre a los scopes generales del cliente", func(t *testing.T) {
+		resp, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypePassword,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+			Username:     "usuario@example.com",
+			Password:     "secreto123",
+			Scope:        "read admin",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "read admin", resp.Scope)
+	})
+}
+
+func TestPasswordGrantIncludeUserProfile(t *testing.T) {
+	user := newTestUser("usuario@example.com", "secreto123")
+	passwordReq := &domain.OAuthRequest{
+		GrantType:    domain.GrantTypePassword,
+		ClientID:     "cliente-prueba",
+		ClientSecret: "secreto-cliente",
+		Username:     "usuario@example.com",
+		Password:     "secreto123",
+	}
+	clientReq := &domain.OAuthRequest{
+		GrantType:    domain.GrantTypeClientCredentials,
+		ClientID:     "cliente-prueba",
+		ClientSecret: "secreto-cliente",
+	}
+
+	t.Run("desactivado por defecto", func(t *testing.T) {
+		uc := newTestOAuthUseCase(newFakeClientRepo(newTestClient()), newFakeTokenRepo(), newFakeUserUseCase(user))
+
+		resp, err := uc.GenerateToken(passwordReq)
+		require.NoError(t, err)
+		assert.Nil(t, resp.User)
+		assert.NotContains(t, responseKeys(t, resp), "user")
+	})
+
+	t.Run("activado", func(t *testing.T) {
+		uc := NewOAuthUseCase(newFakeClientRepo(newTestClient()), newFakeTokenRepo(), newFakeUserUseCase(user),
+			testSecret, 15*time.Minute, time.Hour, WithUserProfile(true))
+
+		resp, err := uc.GenerateToken(passwordReq)
+		require.NoError(t, err)
+		require.NotNil(t, resp.User)
+		assert.Equal(t, user.ID.Hex(), resp.User.ID)
+		assert.Equal(t, "usuario@example.com", resp.User.Email)
+
+		// El perfil no expone datos sensibles
+		data, err := json.Marshal(resp)
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "password")
+		assert.NotContains(t, string(data), user.Password)
+
+		// client_credentials no tiene usuario asociado
+		clientResp, err := uc.GenerateToken(clientReq)
+		require.NoError(t, err)
+		assert.Nil(t, clientResp.User)
+	})
+
+	t.Run("un fallo al obtener el perfil revoca la sesión", func(t *testing.T) {
+		tokenRepo := newFakeTokenRepo()
+		users := &profileFailingUserUseCase{newFakeUserUseCase(user)}
+		uc := NewOAuthUseCase(newFakeClientRepo(newTestClient()), tokenRepo, users,
+			testSecret, 15*time.Minute, time.Hour, WithUserProfile(true))
+
+		_, err := uc.GenerateToken(passwordReq)
+		require.Error(t, err)
+		assert.Empty(t, tokenRepo.tokens, "no deben quedar tokens que el cliente no recibió")
+	})
+}
+
+// profileFailingUserUseCase simula una falla al obtener el perfil del usuario
+type profileFailingUserUseCase struct {
+	*fakeUserUseCase
+}
+
+func (f *profileFailingUserUseCase) GetUser(string) (*userDomain.UserResponse, error) {
+	return nil, errors.New("conexión perdida")
+}
+
+func TestPasswordGrantRecordsLastLogin(t *testing.T) {
+	user := newTestUser("usuario@example.com", "secreto123")
+	users := newFakeUserUseCase(user)
+	uc := newTestOAuthUseCase(newFakeClientRepo(newTestClient()), newFakeTokenRepo(), users)
+
+	request := &domain.OAuthRequest{
+		GrantType:    domain.GrantTypePassword,
+		ClientID:     "cliente-prueba",
+		ClientSecret: "secreto-cliente",
+		Username:     "usuario@example.com",
+		Password:     "otra",
+		ClientIP:     "203.0.113.10",
+	}
+	_, err := uc.GenerateToken(request)
+	require.Error(t, err)
+	assert.Empty(t, users.logins, "un intento fallido no es un inicio de sesión")
+
+	request.Password = "secreto123"
+	_, err = uc.GenerateToken(request)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{user.ID.Hex(): "203.0.113.10"}, users.logins)
+}
+
+func TestPasswordGrantRecordsFailureReason(t *testing.T) {
+	active := newTestUser("activo@example.com", "secreto123")
+	inactive := newTestUser("inactivo@example.com", "secreto123")
+	inactive.Status = userDomain.UserStatusInactive
+
+	type failure struct{ clientID, username, reason string }
+	var recorded []failure
+	uc := NewOAuthUseCase(newFakeClientRepo(newTestClient()), newFakeTokenRepo(), newFakeUserUseCase(active, inactive),
+		testSecret, 15*time.Minute, time.Hour, WithLoginFailureRecorder(domain.LoginFailureRecorderFunc(func(clientID, username, reason string) {
+			recorded = append(recorded, failure{clientID, username, reason})
+		})))
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		reason   string
+	}{
+		{"usuario inexistente", "nadie@example.com", "secreto123", userDomain.LoginDiagnosisNotFound},
+		{"usuario inactivo", "inactivo@example.com", "secreto123", userDomain.LoginDiagnosisInactive},
+		{"contraseña incorrecta", "activo@example.com", "otra", userDomain.LoginDiagnosisBadPassword},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorded = nil
+
+			_, err := uc.GenerateToken(&domain.OAuthRequest{
+				GrantType:    domain.GrantTypePassword,
+				ClientID:     "cliente-prueba",
+				ClientSecret: "secreto-cliente",
+				Username:     tt.username,
+				Password:     tt.password,
+			})
+
+			var oauthErr *domain.OAuthError
+			require.ErrorAs(t, err, &oauthErr)
+			assert.Equal(t, domain.ErrorInvalidGrant, oauthErr.Code)
+			// El cliente recibe siempre el mismo mensaje, sin importar el motivo
+			assert.Equal(t, userDomain.ErrInvalidCredentials.Error(), oauthErr.Description)
+			assert.Equal(t, []failure{{"cliente-prueba", tt.username, tt.reason}}, recorded)
+		})
+	}
+
+	t.Run("email sin verificar", func(t *testing.T) {
+		pending := newTestUser("pendiente@example.com", "secreto123")
+		pending.Status = userDomain.UserStatusPending
+		recorded = nil
+		pendingUC := NewOAuthUseCase(newFakeClientRepo(newTestClient()), newFakeTokenRepo(), newFakeUserUseCase(pending),
+			testSecret, 15*time.Minute, time.Hour, WithLoginFailureRecorder(domain.LoginFailureRecorderFunc(func(clientID, username, reason string) {
+				recorded = append(recorded, failure{clientID, username, reason})
+			})))
+		request := &domain.OAuthRequest{
+			GrantType:    domain.GrantTypePassword,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+			Username:     "pendiente@example.com",
+			Password:     "secreto123",
+		}
+
+		_, err := pendingUC.GenerateToken(request)
+		var oauthErr *domain.OAuthError
+		require.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, domain.ErrorInvalidGrant, oauthErr.Code)
+		assert.Equal(t, userDomain.ErrEmailNotVerified.Error(), oauthErr.Description)
+		assert.Equal(t, []failure{{"cliente-prueba", "pendiente@example.com", userDomain.LoginDiagnosisUnverified}}, recorded)
+
+		// Con una contraseña incorrecta no se revela que la cuenta existe
+		request.Password = "otra"
+		_, err = pendingUC.GenerateToken(request)
+		require.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, userDomain.ErrInvalidCredentials.Error(), oauthErr.Description)
+	})
+
+	t.Run("un inicio de sesión correcto no se registra", func(t *testing.T) {
+		recorded = nil
+
+		_, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypePassword,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+			Username:     "activo@example.com",
+			Password:     "secreto123",
+		})
+		require.NoError(t, err)
+		assert.Empty(t, recorded)
+	})
+}
+
+func TestPasswordGrantTemporaryPassword(t *testing.T) {
+	user := newTestUser("importado@example.com", "temporal123")
+	user.MustChangePassword = true
+
+	var reasons []string
+	tokenRepo := newFakeTokenRepo()
+	uc := NewOAuthUseCase(newFakeClientRepo(newTestClient()), tokenRepo, newFakeUserUseCase(user),
+		testSecret, 15*time.Minute, time.Hour, WithLoginFailureRecorder(domain.LoginFailureRecorderFunc(func(clientID, username, reason string) {
+			reasons = append(reasons, reason)
+		})))
+	request := func(password, newPassword string) *domain.OAuthRequest {
+		return &domain.OAuthRequest{
+			GrantType:    domain.GrantTypePassword,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+			Username:     "importado@example.com",
+			Password:     password,
+			NewPassword:  newPassword,
+		}
+	}
+	rejected := func(t *testing.T, req *domain.OAuthRequest, description string) {
+		reasons = nil
+		_, err := uc.GenerateToken(req)
+		var oauthErr *domain.OAuthError
+		require.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, domain.ErrorInvalidGrant, oauthErr.Code)
+		assert.Equal(t, description, oauthErr.Description)
+		assert.Equal(t, []string{userDomain.LoginDiagnosisPasswordChange}, reasons)
+		assert.Empty(t, tokenRepo.tokens, "no se emite ninguna sesión")
+		assert.True(t, user.MustChangePassword)
+	}
+
+	t.Run("sin nueva contraseña no se emite sesión", func(t *testing.T) {
+		rejected(t, request("temporal123", ""), userDomain.ErrPasswordChangeRequired.Error())
+	})
+
+	t.Run("la nueva contraseña debe ser distinta", func(t *testing.T) {
+		rejected(t, request("temporal123", "temporal123"), userDomain.ErrPasswordUnchanged.Error())
+	})
+
+	t.Run("la nueva contraseña cumple la política", func(t *testing.T) {
+		rejected(t, request("temporal123", "123"), "la contraseña debe tener al menos 6 caracteres")
+	})
+
+	t.Run("con contraseña incorrecta no se revela el cambio pendiente", func(t *testing.T) {
+		_, err := uc.GenerateToken(request("otra", "propia123"))
+		var oauthErr *domain.OAuthError
+		require.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, userDomain.ErrInvalidCredentials.Error(), oauthErr.Description)
+	})
+
+	t.Run("con nueva contraseña la reemplaza y emite la sesión", func(t *testing.T) {
+		response, err := uc.GenerateToken(request("temporal123", "propia123"))
+		require.NoError(t, err)
+		assert.NotEmpty(t, response.AccessToken)
+		assert.False(t, user.MustChangePassword)
+
+		_, err = uc.GenerateToken(request("propia123", ""))
+		assert.NoError(t, err, "la nueva contraseña da acceso sin más cambios")
+	})
+}
+
+func TestPasswordGrantTwoFactor(t *testing.T) {
+	secret, err := utils.GenerateTOTPSecret()
+	require.NoError(t, err)
+	user := newTestUser("dosfactores@example.com", "secreto123")
+	user.TwoFactorSecret = secret
+	user.TwoFactorEnabled = true
+
+	var reasons []string
+	uc := NewOAuthUseCase(newFakeClientRepo(newTestClient()), newFakeTokenRepo(), newFakeUserUseCase(user),
+		testSecret, 15*time.Minute, time.Hour, WithLoginFailureRecorder(domain.LoginFailureRecorderFunc(func(clientID, username, reason string) {
+			reasons = append(reasons, reason)
+		})))
+	request := func(otp string) *domain.OAuthRequest {
+		return &domain.OAuthRequest{
+			GrantType:    domain.GrantTypePassword,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+			Username:     "dosfactores@example.com",
+			Password:     "secreto123",
+			OTP:          otp,
+		}
+	}
+
+	t.Run("sin código", func(t *testing.T) {
+		reasons = nil
+		_, err := uc.GenerateToken(request(""))
+		var oauthErr *domain.OAuthError
+		require.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, domain.ErrorInvalidGrant, oauthErr.Code)
+		assert.Equal(t, userDomain.ErrOTPRequired.Error(), oauthErr.Description)
+		assert.Equal(t, []string{userDomain.LoginDiagnosisOTPRequired}, reasons)
+	})
+
+	t.Run("código incorrecto", func(t *testing.T) {
+		reasons = nil
+		_, err := uc.GenerateToken(request("000000"))
+		var oauthErr *domain.OAuthError
+		require.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, domain.ErrorInvalidGrant, oauthErr.Code)
+		assert.Equal(t, userDomain.ErrInvalidOTP.Error(), oauthErr.Description)
+		assert.Equal(t, []string{userDomain.LoginDiagnosisBadOTP}, reasons)
+	})
+
+	t.Run("código válido", func(t *testing.T) {
+		reasons = nil
+		code, err := utils.TOTPCode(secret, time.Now())
+		require.NoError(t, err)
+
+		token, err := uc.GenerateToken(request(code))
+		require.NoError(t, err)
+		assert.NotEmpty(t, token.AccessToken)
+		assert.Empty(t, reasons)
+	})
+
+	t.Run("la contraseña se valida antes que el código", func(t *testing.T) {
+		reasons = nil
+		req := request("")
+		req.Password = "otra"
+		_, err := uc.GenerateToken(req)
+		var oauthErr *domain.OAuthError
+		require.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, userDomain.ErrInvalidCredentials.Error(), oauthErr.Description)
+		assert.Equal(t, []string{userDomain.LoginDiagnosisBadPassword}, reasons)
+	})
+}
+
+func TestOpaqueAccessTokens(t *testing.T) {
+	user := newTestUser("usuario@example.com", "secreto123")
+	user.Role = "admin"
+	resolver := &fakePermissionResolver{permissions: map[string][]string{
+		user.ID.Hex(): {"users:read"},
+	}}
+	tokenRepo := newFakeTokenRepo()
+	uc := NewOAuthUseCase(newFakeClientRepo(newTestClient()), tokenRepo, newFakeUserUseCase(user),
+		testSecret, 15*time.Minute, time.Hour, WithPermissionResolver(resolver), WithOpaqueTokens(true))
+
+	resp, err := uc.GenerateToken(&domain.OAuthRequest{
+		GrantType:    domain.GrantTypePassword,
+		ClientID:     "cliente-prueba",
+		ClientSecret: "secreto-cliente",
+		Username:     "usuario@example.com",
+		Password:     "secreto123",
+		Scope:        "read",
+	})
+	require.NoError(t, err)
+
+	t.Run("el token no es un JWT", func(t *testing.T) {
+		assert.Len(t, resp.AccessToken, 64)
+		assert.NotContains(t, resp.AccessToken, ".")
+		_, _, err := utils.ValidateJWT(resp.AccessToken, testSecret)
+		assert.Error(t, err)
+	})
+
+	t.Run("los claims se guardan en el servidor", func(t *testing.T) {
+		stored, err := tokenRepo.GetByAccessToken(resp.AccessToken)
+		require.NoError(t, err)
+		assert.True(t, stored.Opaque)
+		assert.Equal(t, "admin", stored.Role)
+		assert.Equal(t, []string{"users:read"}, stored.Permissions)
+	})
+
+	t.Run("ValidateToken retorna los claims guardados", func(t *testing.T) {
+		userID, claims, err := uc.ValidateToken(resp.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID.Hex(), userID)
+		assert.Equal(t, user.ID.Hex(), claims["user_id"])
+		assert.Equal(t, "admin", claims["role"])
+		assert.Equal(t, []string{"read"}, claims["scopes"])
+		assert.Equal(t, []string{"users:read"}, claims["permissions"])
+	})
+
+	t.Run("RefreshClaims actualiza los claims guardados", func(t *testing.T) {
+		resolver.permissions[user.ID.Hex()] = []string{"users:read", "admin:users"}
+
+		refreshed, err := uc.RefreshClaims(resp.AccessToken)
+		require.NoError(t, err)
+
+		_, claims, err := uc.ValidateToken(refreshed.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"users:read", "admin:users"}, claims["permissions"])
+
+		_, _, err = uc.ValidateToken(resp.AccessToken)
+		assert.Error(t, err, "el token anterior deja de ser válido")
+	})
+
+	t.Run("client_credentials", func(t *testing.T) {
+		clientResp, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypeClientCredentials,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+		})
+		require.NoError(t, err)
+
+		userID, claims, err := uc.ValidateToken(clientResp.AccessToken)
+		require.NoError(t, err)
+		assert.Empty(t, userID)
+		assert.Equal(t, "client", claims["role"])
+		assert.NotContains(t, claims, "permissions")
+	})
+
+	t.Run("token expirado", func(t *testing.T) {
+		clientResp, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypeClientCredentials,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+		})
+		require.NoError(t, err)
+		stored, err := tokenRepo.GetByAccessToken(clientResp.AccessToken)
+		require.NoError(t, err)
+		stored.ExpiresAt = time.Now().Add(-time.Minute)
+
+		_, _, err = uc.ValidateToken(clientResp.AccessToken)
+		assert.ErrorIs(t, err, utils.ErrTokenExpired)
+	})
+}
+
+func TestJWTTokensStillValidAfterSwitchingToOpaque(t *testing.T) {
+	user := newTestUser("usuario@example.com", "secreto123")
+	tokenRepo := newFakeTokenRepo()
+	clientRepo := newFakeClientRepo(newTestClient())
+	userUC := newFakeUserUseCase(user)
+
+	jwtUC := newTestOAuthUseCase(clientRepo, tokenRepo, userUC)
+	resp, err := jwtUC.GenerateToken(&domain.OAuthRequest{
+		GrantType:    domain.GrantTypePassword,
+		ClientID:     "cliente-prueba",
+		ClientSecret: "secreto-cliente",
+		Username:     "usuario@example.com",
+		Password:     "secreto123",
+	})
+	require.NoError(t, err)
+
+	// Las sesiones emitidas como JWT se siguen validando al activar el modo opaco
+	opaqueUC := NewOAuthUseCase(clientRepo, tokenRepo, userUC, testSecret, 15*time.Minute, time.Hour, WithOpaqueTokens(true))
+	userID, claims, err := opaqueUC.ValidateToken(resp.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID.Hex(), userID)
+	assert.Equal(t, "user", claims["role"])
+}
+
+func TestAuthTimeClaim(t *testing.T) {
+	user := newTestUser("usuario@example.com", "secreto123")
+	tokenRepo := newFakeTokenRepo()
+	uc := newTestOAuthUseCase(newFakeClientRepo(newTestClient()), tokenRepo, newFakeUserUseCase(user))
+
+	before := time.Now().Add(-time.Second)
+	resp, err := uc.GenerateToken(&domain.OAuthRequest{
+		GrantType:    domain.GrantTypePassword,
+		ClientID:     "cliente-prueba",
+		ClientSecret: "secreto-cliente",
+		Username:     "usuario@example.com",
+		Password:     "secreto123",
+	})
+	require.NoError(t, err)
+
+	_, claims, err := uc.ValidateToken(resp.AccessToken)
+	require.NoError(t, err)
+	authTime, ok := claims["auth_time"].(float64)
+	require.True(t, ok, "el token del grant password incluye auth_time")
+	assert.GreaterOrEqual(t, int64(authTime), before.Unix())
+
+	// La renovación conserva el momento de la autenticación original
+	original := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	stored, err := tokenRepo.GetByRefreshToken(resp.RefreshToken)
+	require.NoError(t, err)
+	stored.AuthTime = original
+
+	refreshed, err := uc.GenerateToken(&domain.OAuthRequest{
+		GrantType:    domain.GrantTypeRefreshToken,
+		ClientID:     "cliente-prueba",
+		ClientSecret: "secreto-cliente",
+		RefreshToken: resp.RefreshToken,
+	})
+	require.NoError(t, err)
+
+	_, claims, err = uc.ValidateToken(refreshed.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, float64(original.Unix()), claims["auth_time"])
+}
+
+func TestStatelessTokenRevocation(t *testing.T) {
+	user := newTestUser("usuario@example.com", "secreto123")
+	tokenRepo := newFakeTokenRepo()
+	revocations := newFakeRevocationList()
+	uc := NewOAuthUseCase(newFakeClientRepo(newTestClient()), tokenRepo, newFakeUserUseCase(user),
+		testSecret, 15*time.Minute, time.Hour, WithStatelessTokens(true), WithRevocationList(revocations))
+
+	login := func(t *testing.T) *domain.OAuthResponse {
+		resp, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypePassword,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+			Username:     "usuario@example.com",
+			Password:     "secreto123",
+		})
+		require.NoError(t, err)
+		return resp
+	}
+
+	t.Run("el token incluye jti y se valida sin consultar la sesión", func(t *testing.T) {
+		resp := login(t)
+		_, claims, err := utils.ValidateJWT(resp.AccessToken, testSecret)
+		require.NoError(t, err)
+		assert.NotEmpty(t, claims["jti"])
+
+		tokenRepo.tokens = nil
+		userID, _, err := uc.ValidateToken(resp.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID.Hex(), userID)
+	})
+
+	t.Run("un jti revocado se rechaza", func(t *testing.T) {
+		resp := login(t)
+		_, claims, err := utils.ValidateJWT(resp.AccessToken, testSecret)
+		require.NoError(t, err)
+
+		require.NoError(t, revocations.Revoke(claims["jti"].(string), time.Now().Add(time.Hour)))
+		_, _, err = uc.ValidateToken(resp.AccessToken)
+		assert.EqualError(t, err, "token revocado")
+	})
+
+	t.Run("revocar el refresh token revoca el access token de la sesión", func(t *testing.T) {
+		resp := login(t)
+		require.NoError(t, uc.RevokeToken(resp.RefreshToken))
+
+		_, _, err := uc.ValidateToken(resp.AccessToken)
+		assert.EqualError(t, err, "token revocado")
+	})
+
+	t.Run("el access token anterior se revoca al refrescar", func(t *testing.T) {
+		resp := login(t)
+		refreshed, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypeRefreshToken,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+			RefreshToken: resp.RefreshToken,
+		})
+		require.NoError(t, err)
+
+		_, _, err = uc.ValidateToken(resp.AccessToken)
+		assert.EqualError(t, err, "token revocado")
+		_, _, err = uc.ValidateToken(refreshed.AccessToken)
+		assert.NoError(t, err)
+	})
+
+	t.Run("un JWT sin jti no se acepta", func(t *testing.T) {
+		legacy, err := utils.GenerateJWT(user.ID.Hex(), "user", nil, testSecret, time.Minute)
+		require.NoError(t, err)
+		_, _, err = uc.ValidateToken(legacy)
+		assert.Error(t, err)
+	})
+}
+
+func TestRevokeUserTokens(t *testing.T) {
+	setup := func(opts ...Option) (*oauthUseCase, *fakeUserUseCase, *userDomain.User) {
+		user := newTestUser("usuario@example.com", "secreto123")
+		userUC := newFakeUserUseCase(user)
+		uc := NewOAuthUseCase(newFakeClientRepo(newTestClient()), newFakeTokenRepo(), userUC,
+			testSecret, 15*time.Minute, time.Hour, opts...).(*oauthUseCase)
+		return uc, userUC, user
+	}
+	login := func(t *testing.T, uc *oauthUseCase) *domain.OAuthResponse {
+		resp, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypePassword,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+			Username:     "usuario@example.com",
+			Password:     "secreto123",
+		})
+		require.NoError(t, err)
+		return resp
+	}
+	clientToken := func(t *testing.T, uc *oauthUseCase) string {
+		resp, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypeClientCredentials,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+		})
+		require.NoError(t, err)
+		return resp.AccessToken
+	}
+
+	t.Run("elimina todas las sesiones del usuario", func(t *testing.T) {
+		uc, userUC, user := setup()
+		first, second := login(t, uc), login(t, uc)
+		service := clientToken(t, uc)
+
+		removed, err := uc.RevokeUserTokens(user.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), removed)
+		assert.Empty(t, userUC.refreshs[user.ID.Hex()])
+
+		for _, resp := range []*domain.OAuthResponse{first, second} {
+			_, _, err := uc.ValidateToken(resp.AccessToken)
+			assert.ErrorIs(t, err, utils.ErrTokenInvalid)
+		}
+		// Los tokens de otros usuarios o de clientes no se ven afectados
+		_, _, err = uc.ValidateToken(service)
+		assert.NoError(t, err)
+
+		_, err = uc.RevokeUserTokens("")
+		assert.Error(t, err)
+	})
+
+	t.Run("en modo sin estado revoca los access tokens vigentes", func(t *testing.T) {
+		uc, _, user := setup(WithStatelessTokens(true), WithRevocationList(newFakeRevocationList()))
+		resp := login(t, uc)
+
+		_, err := uc.RevokeUserTokens(user.ID.Hex())
+		require.NoError(t, err)
+		_, _, err = uc.ValidateToken(resp.AccessToken)
+		assert.ErrorIs(t, err, utils.ErrTokenRevoked)
+	})
+
+	t.Run("con CheckUserStatus se rechaza el token de un usuario archivado", func(t *testing.T) {
+		uc, _, user := setup(WithStatelessTokens(true), WithUserStatusCheck(true))
+		resp := login(t, uc)
+		service := clientToken(t, uc)
+
+		_, _, err := uc.ValidateToken(resp.AccessToken)
+		require.NoError(t, err)
+
+		user.Status = userDomain.UserStatusArchived
+		_, _, err = uc.ValidateToken(resp.AccessToken)
+		assert.ErrorIs(t, err, utils.ErrTokenRevoked)
+
+		// Los tokens de client_credentials no tienen usuario
+		_, _, err = uc.ValidateToken(service)
+		assert.NoError(t, err)
+	})
+
+	t.Run("sin CheckUserStatus el token sigue siendo válido hasta revocar la sesión", func(t *testing.T) {
+		uc, _, user := setup()
+		resp := login(t, uc)
+
+		user.Status = userDomain.UserStatusArchived
+		_, _, err := uc.ValidateToken(resp.AccessToken)
+		assert.NoError(t, err)
+	})
+}
+
+func TestRS256AccessTokens(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	user := newTestUser("usuario@example.com", "secreto123")
+	uc := NewOAuthUseCase(newFakeClientRepo(newTestClient()), newFakeTokenRepo(), newFakeUserUseCase(user),
+		testSecret, 15*time.Minute, time.Hour, WithJWTSigner(utils.NewRS256Signer(privateKey)))
+
+	resp, err := uc.GenerateToken(&domain.OAuthRequest{
+		GrantType:    domain.GrantTypePassword,
+		ClientID:     "cliente-prueba",
+		ClientSecret: "secreto-cliente",
+		Username:     "usuario@example.com",
+		Password:     "secreto123",
+	})
+	require.NoError(t, err)
+
+	// Otros servicios validan el token solo con la clave pública
+	userID, _, err := utils.ValidateJWTRS256(resp.AccessToken, &privateKey.PublicKey)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID.Hex(), userID)
+
+	_, _, err = uc.ValidateToken(resp.AccessToken)
+	require.NoError(t, err)
+
+	// El secreto HMAC ya no sirve para validar ni para forjar tokens
+	_, _, err = utils.ValidateJWT(resp.AccessToken, testSecret)
+	assert.Error(t, err)
+
+	statelessUC := NewOAuthUseCase(newFakeClientRepo(newTestClient()), newFakeTokenRepo(), newFakeUserUseCase(user),
+		testSecret, 15*time.Minute, time.Hour, WithJWTSigner(utils.NewRS256Signer(privateKey)), WithStatelessTokens(true))
+	forged, err := utils.GenerateJWTWithClaims(&utils.Claims{
+		UserID:           user.ID.Hex(),
+		RegisteredClaims: jwt.RegisteredClaims{ID: "jti-forjado"},
+	}, testSecret, time.Minute)
+	require.NoError(t, err)
+	_, _, err = statelessUC.ValidateToken(forged)
+	assert.Error(t, err)
+}
+
+func TestClientClaims(t *testing.T) {
+	user := newTestUser("usuario@example.com", "secreto123")
+	passwordGrant := &domain.OAuthRequest{
+		GrantType:    domain.GrantTypePassword,
+		ClientID:     "cliente-prueba",
+		ClientSecret: "secreto-cliente",
+		Username:     "usuario@example.com",
+		Password:     "secreto123",
+	}
+	clientGrant := &domain.OAuthRequest{
+		GrantType:    domain.GrantTypeClientCredentials,
+		ClientID:     "cliente-prueba",
+		ClientSecret: "secreto-cliente",
+	}
+
+	for _, opaque := range []bool{false, true} {
+		t.Run(fmt.Sprintf("habilitados opaco=%v", opaque), func(t *testing.T) {
+			uc := NewOAuthUseCase(newFakeClientRepo(newTestClient()), newFakeTokenRepo(), newFakeUserUseCase(user),
+				testSecret, 15*time.Minute, time.Hour, WithClientClaims(true), WithOpaqueTokens(opaque))
+
+			for _, req := range []*domain.OAuthRequest{passwordGrant, clientGrant} {
+				resp, err := uc.GenerateToken(req)
+				require.NoError(t, err)
+
+				_, claims, err := uc.ValidateToken(resp.AccessToken)
+				require.NoError(t, err)
+				assert.Equal(t, "cliente-prueba", claims["client_id"], req.GrantType)
+				assert.Equal(t, "Cliente de prueba", claims["client_name"], req.GrantType)
+			}
+		})
+	}
+
+	t.Run("deshabilitados por defecto", func(t *testing.T) {
+		tokenRepo := newFakeTokenRepo()
+		uc := newTestOAuthUseCase(newFakeClientRepo(newTestClient()), tokenRepo, newFakeUserUseCase(user))
+
+		resp, err := uc.GenerateToken(passwordGrant)
+		require.NoError(t, err)
+
+		_, claims, err := uc.ValidateToken(resp.AccessToken)
+		require.NoError(t, err)
+		assert.NotContains(t, claims, "client_id")
+		assert.NotContains(t, claims, "client_name")
+
+		stored, err := tokenRepo.GetByRefreshToken(resp.RefreshToken)
+		require.NoError(t, err)
+		assert.Empty(t, stored.ClientName)
+	})
+}
+
+func TestAuthorizationCodePKCE(t *testing.T) {
+	const (
+		verifier    = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		redirectURI = "https://app.example.com/callback"
+	)
+	user := newTestUser("usuario@example.com", "secreto123")
+
+	newClient := func(clientID string, public bool) *domain.Client {
+		client := newTestClient()
+		client.ClientID = clientID
+		client.Public = public
+		client.RedirectURIs = []string{redirectURI}
+		client.GrantTypes = append(client.GrantTypes, domain.GrantTypeAuthorizationCode)
+		if public {
+			client.ClientSecret = ""
+		}
+		return client
+	}
+	newUseCase := func() *oauthUseCase {
+		clientRepo := newFakeClientRepo(newClient("cliente-prueba", false), newClient("spa", true))
+		return NewOAuthUseCase(clientRepo, newFakeTokenRepo(), newFakeUserUseCase(user), testSecret,
+			15*time.Minute, time.Hour, WithAuthorizationCodes(newFakeAuthorizationCodeRepo())).(*oauthUseCase)
+	}
+	authorize := func(t *testing.T, uc *oauthUseCase, clientID, challenge, method string) string {
+		resp, err := uc.Authorize(user.ID.Hex(), &domain.AuthorizeRequest{
+			ResponseType:        domain.ResponseTypeCode,
+			ClientID:            clientID,
+			RedirectURI:         redirectURI,
+			State:               "xyz",
+			CodeChallenge:       challenge,
+			CodeChallengeMethod: method,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, redirectURI+"?code="+resp.Code+"&state=xyz", resp.RedirectTo)
+		return resp.Code
+	}
+	exchange := func(uc *oauthUseCase, clientID, secret, code, codeVerifier string) (*domain.OAuthResponse, error) {
+		return uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypeAuthorizationCode,
+			ClientID:     clientID,
+			ClientSecret: secret,
+			Code:         code,
+			RedirectURI:  redirectURI,
+			CodeVerifier: codeVerifier,
+		})
+	}
+
+	t.Run("S256 con cliente público sin secreto", func(t *testing.T) {
+		uc := newUseCase()
+		code := authorize(t, uc, "spa", utils.S256CodeChallenge(verifier), domain.CodeChallengeS256)
+
+		resp, err := exchange(uc, "spa", "", code, verifier)
+		require.NoError(t, err)
+		userID, _, err := uc.ValidateToken(resp.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID.Hex(), userID)
+		assert.NotEmpty(t, resp.RefreshToken)
+
+		// El código es de un solo uso
+		_, err = exchange(uc, "spa", "", code, verifier)
+		assert.ErrorIs(t, err, domain.ErrInvalidAuthorizationCode)
+	})
+
+	t.Run("plain por defecto si no se indica el método", func(t *testing.T) {
+		uc := newUseCase()
+		code := authorize(t, uc, "spa", verifier, "")
+
+		_, err := exchange(uc, "spa", "", code, verifier)
+		assert.NoError(t, err)
+	})
+
+	t.Run("el token conserva la autenticación de la sesión que autorizó", func(t *testing.T) {
+		uc := newUseCase()
+		authTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+		resp, err := uc.Authorize(user.ID.Hex(), &domain.AuthorizeRequest{
+			ResponseType:        domain.ResponseTypeCode,
+			ClientID:            "spa",
+			RedirectURI:         redirectURI,
+			CodeChallenge:       utils.S256CodeChallenge(verifier),
+			CodeChallengeMethod: domain.CodeChallengeS256,
+			AuthTime:            authTime,
+		})
+		require.NoError(t, err)
+
+		token, err := exchange(uc, "spa", "", resp.Code, verifier)
+		require.NoError(t, err)
+		_, claims, err := uc.ValidateToken(token.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, float64(authTime.Unix()), claims["auth_time"])
+	})
+
+	t.Run("verifier incorrecto", func(t *testing.T) {
+		uc := newUseCase()
+		code := authorize(t, uc, "spa", utils.S256CodeChallenge(verifier), domain.CodeChallengeS256)
+
+		_, err := exchange(uc, "spa", "", code, strings.Repeat("x", 43))
+		assert.ErrorIs(t, err, domain.ErrInvalidCodeVerifier)
+	})
+
+	t.Run("verifier ausente con challenge guardado", func(t *testing.T) {
+		uc := newUseCase()
+		code := authorize(t, uc, "cliente-prueba", utils.S256CodeChallenge(verifier), domain.CodeChallengeS256)
+
+		_, err := exchange(uc, "cliente-prueba", "secreto-cliente", code, "")
+		assert.ErrorIs(t, err, domain.ErrMissingCodeVerifier)
+	})
+
+	t.Run("cliente confidencial sin PKCE", func(t *testing.T) {
+		uc := newUseCase()
+		code := authorize(t, uc, "cliente-prueba", "", "")
+
+		_, err := exchange(uc, "cliente-prueba", "secreto-cliente", code, "")
+		assert.NoError(t, err)
+	})
+
+	t.Run("cliente público sin code_challenge", func(t *testing.T) {
+		uc := newUseCase()
+		_, err := uc.Authorize(user.ID.Hex(), &domain.AuthorizeRequest{
+			ResponseType: domain.ResponseTypeCode,
+			ClientID:     "spa",
+			RedirectURI:  redirectURI,
+		})
+		assert.ErrorIs(t, err, domain.ErrPKCERequired)
+	})
+
+	t.Run("cliente confidencial sin secreto", func(t *testing.T) {
+		uc := newUseCase()
+		code := authorize(t, uc, "cliente-prueba", utils.S256CodeChallenge(verifier), domain.CodeChallengeS256)
+
+		_, err := exchange(uc, "cliente-prueba", "", code, verifier)
+		assert.EqualError(t, err, "credenciales de cliente inválidas")
+	})
+
+	t.Run("redirect_uri no registrada", func(t *testing.T) {
+		uc := newUseCase()
+		_, err := uc.Authorize(user.ID.Hex(), &domain.AuthorizeRequest{
+			ResponseType:  domain.ResponseTypeCode,
+			ClientID:      "spa",
+			RedirectURI:   "https://otro.example.com/callback",
+			CodeChallenge: verifier,
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("método de challenge no soportado", func(t *testing.T) {
+		uc := newUseCase()
+		_, err := uc.Authorize(user.ID.Hex(), &domain.AuthorizeRequest{
+			ResponseType:        domain.ResponseTypeCode,
+			ClientID:            "spa",
+			RedirectURI:         redirectURI,
+			CodeChallenge:       verifier,
+			CodeChallengeMethod: "S512",
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("sin repositorio de códigos el grant no está disponible", func(t *testing.T) {
+		uc := newTestOAuthUseCase(newFakeClientRepo(newClient("spa", true)), newFakeTokenRepo(), newFakeUserUseCase(user))
+		_, err := exchange(uc, "spa", "", "codigo", verifier)
+		assert.ErrorIs(t, err, domain.ErrUnsupportedGrantType)
+	})
+}
+
+func TestStrictRefreshRotation(t *testing.T) {
+	user := newTestUser("usuario@example.com", "secreto123")
+	tokenRepo := newFakeTokenRepo()
+	uc := NewOAuthUseCase(newFakeClientRepo(newTestClient()), tokenRepo, newFakeUserUseCase(user),
+		testSecret, 15*time.Minute, time.Hour, WithStrictRefreshRotation(true))
+
+	login := func(t *testing.T) *domain.OAuthResponse {
+		resp, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypePassword,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+			Username:     "usuario@example.com",
+			Password:     "secreto123",
+		})
+		require.NoError(t, err)
+		return resp
+	}
+	refresh := func(refreshToken string) (*domain.OAuthResponse, error) {
+		return uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypeRefreshToken,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+			RefreshToken: refreshToken,
+		})
+	}
+
+	t.Run("un refresh token canjeado no se acepta de nuevo", func(t *testing.T) {
+		resp := login(t)
+		refreshed, err := refresh(resp.RefreshToken)
+		require.NoError(t, err)
+
+		_, err = refresh(resp.RefreshToken)
+		assert.ErrorIs(t, err, domain.ErrRefreshTokenConsumed)
+
+		// El nuevo refresh token sigue siendo válido
+		_, err = refresh(refreshed.RefreshToken)
+		assert.NoError(t, err)
+	})
+
+	t.Run("canjes concurrentes: solo uno tiene éxito", func(t *testing.T) {
+		const attempts = 10
+		resp := login(t)
+		sessions := len(tokenRepo.tokens)
+
+		var (
+			wg        sync.WaitGroup
+			start     = make(chan struct{})
+			successes = make(chan *domain.OAuthResponse, attempts)
+			failures  = make(chan error, attempts)
+		)
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				refreshed, err := refresh(resp.RefreshToken)
+				if err != nil {
+					failures <- err
+					return
+				}
+				successes <- refreshed
+			}()
+		}
+		close(start)
+		wg.Wait()
+		close(successes)
+		close(failures)
+
+		assert.Len(t, successes, 1)
+		assert.Len(t, failures, attempts-1)
+		for err := range failures {
+			assert.ErrorIs(t, err, domain.ErrRefreshTokenConsumed)
+		}
+		assert.Len(t, tokenRepo.tokens, sessions, "la sesión anterior se reemplaza por una sola nueva")
+	})
+
+	t.Run("un scope no concedido no consume el refresh token", func(t *testing.T) {
+		resp := login(t)
+		_, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypeRefreshToken,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+			RefreshToken: resp.RefreshToken,
+			Scope:        "desconocido",
+		})
+		var oauthErr *domain.OAuthError
+		require.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, domain.ErrorInvalidScope, oauthErr.Code)
+
+		_, err = refresh(resp.RefreshToken)
+		assert.NoError(t, err)
+	})
+
+	t.Run("un token expirado se consume y se rechaza", func(t *testing.T) {
+		resp := login(t)
+		stored, err := tokenRepo.GetByRefreshToken(resp.RefreshToken)
+		require.NoError(t, err)
+		stored.RefreshExpiresAt = time.Now().Add(-time.Minute)
+
+		_, err = refresh(resp.RefreshToken)
+		assert.EqualError(t, err, "refresh token expirado")
+		_, err = tokenRepo.GetByRefreshToken(resp.RefreshToken)
+		assert.Error(t, err)
+	})
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		name := "rotación normal"
+		if strict {
+			name = "rotación estricta"
+		}
+		t.Run(name, func(t *testing.T) {
+			user := newTestUser("usuario@example.com", "secreto123")
+			tokenRepo := newFakeTokenRepo()
+			uc := NewOAuthUseCase(newFakeClientRepo(newTestClient()), tokenRepo, newFakeUserUseCase(user),
+				testSecret, 15*time.Minute, time.Hour, WithStrictRefreshRotation(strict))
+
+			login := func() *domain.OAuthResponse {
+				resp, err := uc.GenerateToken(&domain.OAuthRequest{
+					GrantType:    domain.GrantTypePassword,
+					ClientID:     "cliente-prueba",
+					ClientSecret: "secreto-cliente",
+					Username:     "usuario@example.com",
+					Password:     "secreto123",
+				})
+				require.NoError(t, err)
+				return resp
+			}
+			refresh := func(refreshToken string) (*domain.OAuthResponse, error) {
+				return uc.GenerateToken(&domain.OAuthRequest{
+					GrantType:    domain.GrantTypeRefreshToken,
+					ClientID:     "cliente-prueba",
+					ClientSecret: "secreto-cliente",
+					RefreshToken: refreshToken,
+				})
+			}
+
+			stolen := login()
+			other := login() // Otra sesión del mismo usuario, no debe verse afectada
+
+			first, err := refresh(stolen.RefreshToken)
+			require.NoError(t, err)
+			second, err := refresh(first.RefreshToken)
+			require.NoError(t, err)
+
+			// El atacante reutiliza el refresh token original, ya canjeado
+			_, err = refresh(stolen.RefreshToken)
+			require.Error(t, err)
+			var oauthErr *domain.OAuthError
+			require.ErrorAs(t, err, &oauthErr)
+			assert.Equal(t, domain.ErrorInvalidGrant, oauthErr.Code)
+
+			// Toda la familia queda revocada, incluida la sesión legítima más reciente
+			_, err = refresh(second.RefreshToken)
+			assert.Error(t, err)
+			_, _, err = uc.ValidateToken(second.AccessToken)
+			assert.Error(t, err)
+
+			_, err = refresh(other.RefreshToken)
+			assert.NoError(t, err, "las demás familias siguen vigentes")
+		})
+	}
+
+	t.Run("un reintento inmediato del último token canjeado no revoca la familia", func(t *testing.T) {
+		user := newTestUser("usuario@example.com", "secreto123")
+		tokenRepo := newFakeTokenRepo()
+		uc := NewOAuthUseCase(newFakeClientRepo(newTestClient()), tokenRepo, newFakeUserUseCase(user),
+			testSecret, 15*time.Minute, time.Hour, WithStrictRefreshRotation(true))
+
+		resp, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypePassword,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+			Username:     "usuario@example.com",
+			Password:     "secreto123",
+		})
+		require.NoError(t, err)
+		refresh := func(refreshToken string) (*domain.OAuthResponse, error) {
+			return uc.GenerateToken(&domain.OAuthRequest{
+				GrantType:    domain.GrantTypeRefreshToken,
+				ClientID:     "cliente-prueba",
+				ClientSecret: "secreto-cliente",
+				RefreshToken: refreshToken,
+			})
+		}
+
+		refreshed, err := refresh(resp.RefreshToken)
+		require.NoError(t, err)
+
+		_, err = refresh(resp.RefreshToken)
+		assert.ErrorIs(t, err, domain.ErrRefreshTokenConsumed)
+		_, err = refresh(refreshed.RefreshToken)
+		assert.NoError(t, err)
+	})
+}
+
+func TestDeviceBinding(t *testing.T) {
+	setup := func(mode domain.DeviceBindingMode) (domain.OAuthUseCase, *fakeTokenRepo) {
+		user := newTestUser("usuario@example.com", "secreto123")
+		tokenRepo := newFakeTokenRepo()
+		uc := NewOAuthUseCase(newFakeClientRepo(newTestClient()), tokenRepo, newFakeUserUseCase(user),
+			testSecret, 15*time.Minute, time.Hour, WithDeviceBinding(mode))
+		return uc, tokenRepo
+	}
+	login := func(t *testing.T, uc domain.OAuthUseCase, deviceID string) *domain.OAuthResponse {
+		resp, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypePassword,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+			Username:     "usuario@example.com",
+			Password:     "secreto123",
+			DeviceID:     deviceID,
+		})
+		require.NoError(t, err)
+		return resp
+	}
+	refresh := func(uc domain.OAuthUseCase, refreshToken, deviceID string) (*domain.OAuthResponse, error) {
+		return uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypeRefreshToken,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+			RefreshToken: refreshToken,
+			DeviceID:     deviceID,
+		})
+	}
+
+	t.Run("el mismo dispositivo puede refrescar", func(t *testing.T) {
+		uc, tokenRepo := setup(domain.DeviceBindingEnforce)
+		resp := login(t, uc, "iphone-1")
+
+		refreshed, err := refresh(uc, resp.RefreshToken, "iphone-1")
+		require.NoError(t, err)
+
+		// El nuevo refresh token hereda el dispositivo
+		stored, err := tokenRepo.GetByRefreshToken(refreshed.RefreshToken)
+		require.NoError(t, err)
+		assert.Equal(t, "iphone-1", stored.DeviceID)
+		_, err = refresh(uc, refreshed.RefreshToken, "iphone-1")
+		assert.NoError(t, err)
+	})
+
+	t.Run("enforce: otro dispositivo revoca la familia", func(t *testing.T) {
+		uc, tokenRepo := setup(domain.DeviceBindingEnforce)
+		resp := login(t, uc, "iphone-1")
+		other := login(t, uc, "ipad-1")
+
+		_, err := refresh(uc, resp.RefreshToken, "android-9")
+		var oauthErr *domain.OAuthError
+		require.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, domain.ErrorInvalidGrant, oauthErr.Code)
+
+		// La sesión queda revocada también para el dispositivo legítimo
+		_, err = refresh(uc, resp.RefreshToken, "iphone-1")
+		assert.Error(t, err)
+		_, _, err = uc.ValidateToken(resp.AccessToken)
+		assert.Error(t, err)
+
+		// Las sesiones de otros dispositivos no se ven afectadas
+		_, err = tokenRepo.GetByRefreshToken(other.RefreshToken)
+		assert.NoError(t, err)
+	})
+
+	t.Run("enforce: omitir device_id cuenta como discrepancia", func(t *testing.T) {
+		uc, _ := setup(domain.DeviceBindingEnforce)
+		resp := login(t, uc, "iphone-1")
+
+		_, err := refresh(uc, resp.RefreshToken, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("warn: la discrepancia solo se registra", func(t *testing.T) {
+		uc, _ := setup(domain.DeviceBindingWarn)
+		resp := login(t, uc, "iphone-1")
+
+		_, err := refresh(uc, resp.RefreshToken, "android-9")
+		assert.NoError(t, err)
+	})
+
+	t.Run("las sesiones sin device_id no se validan", func(t *testing.T) {
+		uc, _ := setup(domain.DeviceBindingEnforce)
+		resp := login(t, uc, "")
+
+		_, err := refresh(uc, resp.RefreshToken, "android-9")
+		assert.NoError(t, err)
+	})
+}
+
+func TestParseDeviceBindingMode(t *testing.T) {
+	assert.Equal(t, domain.DeviceBindingEnforce, domain.ParseDeviceBindingMode(" Enforce "))
+	assert.Equal(t, domain.DeviceBindingWarn, domain.ParseDeviceBindingMode("warn"))
+	assert.Equal(t, domain.DeviceBindingOff, domain.ParseDeviceBindingMode("desconocido"))
+}
+
+func TestAuthorizedClients(t *testing.T) {
+	user := newTestUser("usuario@example.com", "secreto123")
+	other := newTestUser("otro@example.com", "secreto123")
+	mobile := newTestClient()
+	mobile.ClientID = "app-movil"
+	mobile.ClientSecret = "secreto-movil"
+	mobile.Name = "App móvil"
+
+	tokenRepo := newFakeTokenRepo()
+	revocations := newFakeRevocationList()
+	userUC := newFakeUserUseCase(user, other)
+	uc := NewOAuthUseCase(newFakeClientRepo(newTestClient(), mobile), tokenRepo, userUC,
+		testSecret, 15*time.Minute, time.Hour, WithStatelessTokens(true), WithRevocationList(revocations))
+
+	login := func(t *testing.T, client *domain.Client, email, scope string) *domain.OAuthResponse {
+		resp, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypePassword,
+			ClientID:     client.ClientID,
+			ClientSecret: client.ClientSecret,
+			Username:     email,
+			Password:     "secreto123",
+			Scope:        scope,
+		})
+		require.NoError(t, err)
+		return resp
+	}
+
+	webRead := login(t, newTestClient(), user.Email, "read")
+	webWrite := login(t, newTestClient(), user.Email, "write")
+	mobileSession := login(t, mobile, user.Email, "read")
+	login(t, mobile, other.Email, "read")
+
+	// Sesiones que no deben listarse: expirada y de cliente sin usuario
+	now := time.Now()
+	require.NoError(t, tokenRepo.Create(&domain.Token{
+		UserID: user.ID.Hex(), ClientID: "cliente-antiguo", CreatedAt: now.Add(-48 * time.Hour),
+		ExpiresAt: now.Add(-47 * time.Hour), RefreshExpiresAt: now.Add(-time.Hour),
+	}))
+	require.NoError(t, tokenRepo.Create(&domain.Token{
+		ClientID: "cliente-prueba", CreatedAt: now, ExpiresAt: now.Add(time.Hour),
+	}))
+	// Sesión con un cliente que ya no existe
+	require.NoError(t, tokenRepo.Create(&domain.Token{
+		UserID: user.ID.Hex(), ClientID: "cliente-eliminado", Scopes: []string{"read"},
+		CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour), RefreshExpiresAt: now.Add(time.Hour),
+	}))
+
+	// La app móvil es la usada más recientemente
+	stored, err := tokenRepo.GetByRefreshToken(mobileSession.RefreshToken)
+	require.NoError(t, err)
+	stored.CreatedAt = now.Add(time.Minute)
+
+	t.Run("agrupa las sesiones activas por cliente", func(t *testing.T) {
+		clients, err := uc.GetAuthorizedClients(user.ID.Hex())
+		require.NoError(t, err)
+		require.Len(t, clients, 3)
+
+		assert.Equal(t, "app-movil", clients[0].ClientID)
+		assert.Equal(t, "App móvil", clients[0].ClientName)
+		assert.Equal(t, 1, clients[0].Sessions)
+
+		assert.Equal(t, "cliente-prueba", clients[1].ClientID)
+		assert.Equal(t, "Cliente de prueba", clients[1].ClientName)
+		assert.Equal(t, 2, clients[1].Sessions)
+		assert.Equal(t, []string{"read", "write"}, clients[1].Scopes)
+		assert.WithinDuration(t, now.Add(time.Hour), clients[1].ExpiresAt.Time, time.Minute, "la expiración más lejana es la del refresh token")
+
+		assert.Equal(t, "cliente-eliminado", clients[2].ClientID)
+		assert.Empty(t, clients[2].ClientName)
+	})
+
+	t.Run("revocar un cliente elimina solo sus sesiones", func(t *testing.T) {
+		removed, err := uc.RevokeClientAuthorization(user.ID.Hex(), "cliente-prueba")
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), removed)
+
+		for _, resp := range []*domain.OAuthResponse{webRead, webWrite} {
+			_, _, err := uc.ValidateToken(resp.AccessToken)
+			assert.EqualError(t, err, "token revocado")
+			_, err = tokenRepo.GetByRefreshToken(resp.RefreshToken)
+			assert.Error(t, err)
+		}
+		_, _, err = uc.ValidateToken(mobileSession.AccessToken)
+		assert.NoError(t, err)
+
+		clients, err := uc.GetAuthorizedClients(user.ID.Hex())
+		require.NoError(t, err)
+		require.Len(t, clients, 2)
+		assert.Equal(t, "app-movil", clients[0].ClientID)
+
+		// El otro usuario conserva su sesión con la app móvil
+		clients, err = uc.GetAuthorizedClients(other.ID.Hex())
+		require.NoError(t, err)
+		require.Len(t, clients, 1)
+	})
+
+	t.Run("sin sesiones con el cliente", func(t *testing.T) {
+		removed, err := uc.RevokeClientAuthorization(user.ID.Hex(), "cliente-prueba")
+		require.NoError(t, err)
+		assert.Zero(t, removed)
+	})
+}
+
+func TestGenerateTokenOAuthErrorCodes(t *testing.T) {
+	user := newTestUser("usuario@example.com", "secreto123")
+	machine := newTestClient()
+	machine.ClientID = "cliente-maquina"
+	machine.GrantTypes = []string{domain.GrantTypeClientCredentials}
+	uc := newTestOAuthUseCase(newFakeClientRepo(newTestClient(), machine), newFakeTokenRepo(), newFakeUserUseCase(user))
+
+	tests := []struct {
+		name string
+		req  *domain.OAuthRequest
+		code string
+	}{
+		{"grant no soportado", &domain.OAuthRequest{GrantType: "implicit", ClientID: "cliente-prueba", ClientSecret: "secreto-cliente"},
+			domain.ErrorUnsupportedGrantType},
+		{"secreto incorrecto", &domain.OAuthRequest{GrantType: domain.GrantTypeClientCredentials, ClientID: "cliente-prueba", ClientSecret: "incorrecto"},
+			domain.ErrorInvalidClient},
+		{"cliente desconocido", &domain.OAuthRequest{GrantType: domain.GrantTypeClientCredentials, ClientID: "desconocido", ClientSecret: "secreto"},
+			domain.ErrorInvalidClient},
+		{"grant no habilitado para el cliente", &domain.OAuthRequest{GrantType: domain.GrantTypePassword, ClientID: "cliente-maquina", ClientSecret: "secreto-cliente",
+			Username: user.Email, Password: "secreto123"}, domain.ErrorUnauthorizedClient},
+		{"contraseña incorrecta", &domain.OAuthRequest{GrantType: domain.GrantTypePassword, ClientID: "cliente-prueba", ClientSecret: "secreto-cliente",
+			Username: user.Email, Password: "incorrecta"}, domain.ErrorInvalidGrant},
+		{"sin credenciales de usuario", &domain.OAuthRequest{GrantType: domain.GrantTypePassword, ClientID: "cliente-prueba", ClientSecret: "secreto-cliente"},
+			domain.ErrorInvalidRequest},
+		{"sin refresh token", &domain.OAuthRequest{GrantType: domain.GrantTypeRefreshToken, ClientID: "cliente-prueba", ClientSecret: "secreto-cliente"},
+			domain.ErrorInvalidRequest},
+		{"refresh token desconocido", &domain.OAuthRequest{GrantType: domain.GrantTypeRefreshToken, ClientID: "cliente-prueba", ClientSecret: "secreto-cliente",
+			RefreshToken: "desconocido"}, domain.ErrorInvalidGrant},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := uc.GenerateToken(tt.req)
+
+			var oauthErr *domain.OAuthError
+			require.ErrorAs(t, err, &oauthErr)
+			assert.Equal(t, tt.code, oauthErr.Code)
+			assert.NotEmpty(t, oauthErr.Description)
+		})
+	}
+}
+
+func TestNewOAuthUseCaseOptions(t *testing.T) {
+	newUC := func(opts ...Option) *oauthUseCase {
+		return NewOAuthUseCase(newFakeClientRepo(newTestClient()), newFakeTokenRepo(), newFakeUserUseCase(),
+			testSecret, 15*time.Minute, time.Hour, opts...).(*oauthUseCase)
+	}
+
+	t.Run("sin opciones firma con HS256 y valida contra la sesión", func(t *testing.T) {
+		uc := newUC()
+		require.NotNil(t, uc.signer)
+		assert.Equal(t, utils.JWTAlgorithmHS256, uc.signer.Algorithm())
+		assert.False(t, uc.opaqueTokens)
+		assert.False(t, uc.statelessTokens)
+		assert.False(t, uc.strictRefresh)
+		assert.Nil(t, uc.permissionResolver)
+		assert.Empty(t, uc.enabledGrantTypes)
+	})
+
+	t.Run("aplica las opciones", func(t *testing.T) {
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		uc := newUC(
+			WithJWTSigner(utils.NewRS256Signer(privateKey)),
+			WithStatelessTokens(true),
+			WithStrictRefreshRotation(true),
+			WithEnabledGrantTypes(domain.GrantTypeClientCredentials),
+		)
+		assert.Equal(t, utils.JWTAlgorithmRS256, uc.signer.Algorithm())
+		assert.True(t, uc.statelessTokens)
+		assert.True(t, uc.strictRefresh)
+		assert.Equal(t, []string{domain.GrantTypeClientCredentials}, uc.enabledGrantTypes)
+	})
+
+	t.Run("los tokens opacos anulan el modo sin estado", func(t *testing.T) {
+		uc := newUC(WithStatelessTokens(true), WithOpaqueTokens(true))
+		assert.True(t, uc.opaqueTokens)
+		assert.False(t, uc.statelessTokens)
+	})
+}
+
+func TestClockSetsTokenTimestamps(t *testing.T) {
+	now := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	tokenRepo := newFakeTokenRepo()
+	uc := NewOAuthUseCase(newFakeClientRepo(newTestClient()), tokenRepo,
+		newFakeUserUseCase(newTestUser("usuario@example.com", "secreto123")),
+		testSecret, 15*time.Minute, time.Hour, WithClock(func() time.Time { return now }))
+
+	resp, err := uc.GenerateToken(&domain.OAuthRequest{
+		GrantType:    domain.GrantTypePassword,
+		ClientID:     "cliente-prueba",
+		ClientSecret: "secreto-cliente",
+		Username:     "usuario@example.com",
+		Password:     "secreto123",
+	})
+	require.NoError(t, err)
+
+	session, err := tokenRepo.GetByAccessToken(resp.AccessToken)
+	require.NoError(t, err)
+	loginAt := now
+	assert.Equal(t, loginAt, session.CreatedAt)
+	assert.Equal(t, loginAt, session.AuthTime)
+	assert.Equal(t, loginAt.Add(15*time.Minute), session.ExpiresAt)
+	assert.Equal(t, loginAt.Add(time.Hour), session.RefreshExpiresAt)
+
+	// Los claims del JWT usan el mismo reloj (el token no se valida: su emisión es ficticia)
+	claims := jwt.MapClaims{}
+	_, _, err = new(jwt.Parser).ParseUnverified(resp.AccessToken, claims)
+	require.NoError(t, err)
+	assert.Equal(t, float64(loginAt.Unix()), claims["iat"])
+	assert.Equal(t, float64(loginAt.Add(15*time.Minute).Unix()), claims["exp"])
+
+	now = now.Add(10 * time.Minute)
+	refreshed, err := uc.GenerateToken(&domain.OAuthRequest{
+		GrantType:    domain.GrantTypeRefreshToken,
+		ClientID:     "cliente-prueba",
+		ClientSecret: "secreto-cliente",
+		RefreshToken: resp.RefreshToken,
+	})
+	require.NoError(t, err)
+
+	session, err = tokenRepo.GetByAccessToken(refreshed.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, now, session.CreatedAt)
+	assert.Equal(t, loginAt, session.AuthTime, "refrescar no es una nueva autenticación")
+	assert.Equal(t, now.Add(15*time.Minute), session.ExpiresAt)
+	assert.Equal(t, now.Add(time.Hour), session.RefreshExpiresAt)
+}
+
+func TestEnabledGrantTypes(t *testing.T) {
+	newUC := func(opts ...Option) domain.OAuthUseCase {
+		return NewOAuthUseCase(newFakeClientRepo(newTestClient()), newFakeTokenRepo(), newFakeUserUseCase(),
+			testSecret, 15*time.Minute, time.Hour, opts...)
+	}
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		expected []string
+	}{
+		{"sin códigos de autorización", nil,
+			[]string{domain.GrantTypePassword, domain.GrantTypeClientCredentials, domain.GrantTypeRefreshToken}},
+		{"todos los soportados", []Option{WithAuthorizationCodes(newFakeAuthorizationCodeRepo())}, domain.SupportedGrantTypes},
+		{"lista global", []Option{
+			WithAuthorizationCodes(newFakeAuthorizationCodeRepo()),
+			WithEnabledGrantTypes(domain.GrantTypeRefreshToken, domain.GrantTypeAuthorizationCode),
+		}, []string{domain.GrantTypeAuthorizationCode, domain.GrantTypeRefreshToken}},
+		{"authorization_code habilitado sin códigos", []Option{
+			WithEnabledGrantTypes(domain.GrantTypeAuthorizationCode, domain.GrantTypeClientCredentials),
+		}, []string{domain.GrantTypeClientCredentials}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, newUC(tt.opts...).EnabledGrantTypes())
+		})
+	}
+}
+
+func TestSingleSession(t *testing.T) {
+	setup := func(opts ...Option) *oauthUseCase {
+		user := newTestUser("usuario@example.com", "secreto123")
+		return NewOAuthUseCase(newFakeClientRepo(newTestClient()), newFakeTokenRepo(), newFakeUserUseCase(user),
+			testSecret, 15*time.Minute, time.Hour, opts...).(*oauthUseCase)
+	}
+	login := func(t *testing.T, uc *oauthUseCase) *domain.OAuthResponse {
+		resp, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypePassword,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+			Username:     "usuario@example.com",
+			Password:     "secreto123",
+		})
+		require.NoError(t, err)
+		return resp
+	}
+	refresh := func(uc *oauthUseCase, refreshToken string) error {
+		_, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypeRefreshToken,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+			RefreshToken: refreshToken,
+		})
+		return err
+	}
+
+	t.Run("el segundo inicio de sesión invalida el primero", func(t *testing.T) {
+		uc := setup(WithSingleSession(true))
+		first, second := login(t, uc), login(t, uc)
+
+		_, _, err := uc.ValidateToken(first.AccessToken)
+		assert.ErrorIs(t, err, utils.ErrTokenInvalid)
+		assert.Error(t, refresh(uc, first.RefreshToken))
+
+		_, _, err = uc.ValidateToken(second.AccessToken)
+		assert.NoError(t, err)
+		assert.NoError(t, refresh(uc, second.RefreshToken))
+	})
+
+	t.Run("en modo sin estado revoca el access token anterior", func(t *testing.T) {
+		uc := setup(WithSingleSession(true), WithStatelessTokens(true), WithRevocationList(newFakeRevocationList()))
+		first, second := login(t, uc), login(t, uc)
+
+		_, _, err := uc.ValidateToken(first.AccessToken)
+		assert.ErrorIs(t, err, utils.ErrTokenRevoked)
+		_, _, err = uc.ValidateToken(second.AccessToken)
+		assert.NoError(t, err)
+	})
+
+	t.Run("desactivada se conservan las sesiones de otros dispositivos", func(t *testing.T) {
+		uc := setup()
+		first, second := login(t, uc), login(t, uc)
+
+		for _, resp := range []*domain.OAuthResponse{first, second} {
+			_, _, err := uc.ValidateToken(resp.AccessToken)
+			assert.NoError(t, err)
+		}
+	})
+}
+
+func TestScopeNarrowingReport(t *testing.T) {
+	clientToken := func(t *testing.T, uc domain.OAuthUseCase, scope string) *domain.OAuthResponse {
+		resp, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypeClientCredentials,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+			Scope:        scope,
+		})
+		require.NoError(t, err)
+		return resp
+	}
+	newUC := func(opts ...Option) domain.OAuthUseCase {
+		return NewOAuthUseCase(newFakeClientRepo(newTestClient()), newFakeTokenRepo(), newFakeUserUseCase(),
+			testSecret, 15*time.Minute, time.Hour, opts...)
+	}
+
+	tests := []struct {
+		name          string
+		scope         string
+		wantScope     string
+		wantRequested string
+	}{
+		{"concesión reducida", "read  admin", "read", "read admin"},
+		{"ningún scope permitido usa los por defecto", "admin", "read write", "admin"},
+		{"concesión completa", "write read", "write read", ""},
+		{"sin scopes solicitados", "", "read write", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := clientToken(t, newUC(WithScopeNarrowingReport(true)), tt.scope)
+			assert.Equal(t, tt.wantScope, resp.Scope)
+			assert.Equal(t, tt.wantRequested, resp.RequestedScope)
+		})
+	}
+
+	t.Run("desactivado la respuesta es la estándar", func(t *testing.T) {
+		resp := clientToken(t, newUC(), "read admin")
+		assert.Equal(t, "read", resp.Scope)
+		assert.Empty(t, resp.RequestedScope)
+
+		body, err := json.Marshal(resp)
+		require.NoError(t, err)
+		assert.NotContains(t, string(body), "requested_scope")
+	})
+}
+
+func TestRefreshTokenGrantKeepsOriginalScopes(t *testing.T) {
+	user := newTestUser("usuario@example.com", "secreto123")
+	uc := newTestOAuthUseCase(newFakeClientRepo(newTestClient()), newFakeTokenRepo(), newFakeUserUseCase(user))
+
+	login, err := uc.GenerateToken(&domain.OAuthRequest{
+		GrantType:    domain.GrantTypePassword,
+		ClientID:     "cliente-prueba",
+		ClientSecret: "secreto-cliente",
+		Username:     "usuario@example.com",
+		Password:     "secreto123",
+		Scope:        "read",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "read", login.Scope)
+
+	refreshToken := login.RefreshToken
+	refresh := func(scope string) (*domain.OAuthResponse, error) {
+		resp, err := uc.GenerateToken(&domain.OAuthRequest{
+			GrantType:    domain.GrantTypeRefreshToken,
+			ClientID:     "cliente-prueba",
+			ClientSecret: "secreto-cliente",
+			RefreshToken: refreshToken,
+			Scope:        scope,
+		})
+		if err == nil {
+			refreshToken = resp.RefreshToken
+		}
+		return resp, err
+	}
+
+	// Sin scope no se amplía a los scopes por defecto del cliente
+	resp, err := refresh("")
+	require.NoError(t, err)
+	assert.Equal(t, "read", resp.Scope)
+
+	resp, err = refresh("read write")
+	require.NoError(t, err)
+	assert.Equal(t, "read", resp.Scope)
+
+	for _, scope := range []string{"write", "desconocido"} {
+		_, err = refresh(scope)
+		var oauthErr *domain.OAuthError
+		require.ErrorAs(t, err, &oauthErr, scope)
+		assert.Equal(t, domain.ErrorInvalidScope, oauthErr.Code)
+	}
+}
@@ -1,11 +1,17 @@
 package delivery
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/black4ninja/mi-proyecto/internal/permission/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/middleware"
 	"github.com/black4ninja/mi-proyecto/pkg/utils"
 )
 
@@ -14,56 +20,74 @@ type PermissionHandler struct {
 	permissionUC domain.PermissionUseCase
 	roleUC       domain.RoleUseCase
 	userRoleUC   domain.UserRoleUseCase
+	paginator    *utils.Paginator
+	recorder     domain.PermissionChangeRecorder
 }
 
-// NewPermissionHandler crea un nuevo manejador de permisos
+// NewPermissionHandler crea un nuevo manejador de permisos.
+// Si paginator es nil se usan los tamaños de página por defecto. Si recorder no es nil, cada
+// cambio de permisos, roles o asignaciones se registra con el usuario que lo realizó.
 func NewPermissionHandler(
 	router *gin.RouterGroup,
 	permissionUC domain.PermissionUseCase,
 	roleUC domain.RoleUseCase,
 	userRoleUC domain.UserRoleUseCase,
+	paginator *utils.Paginator,
+	recorder domain.PermissionChangeRecorder,
 ) {
+	if paginator == nil {
+		paginator = utils.NewPaginator(utils.DefaultPageSize, utils.DefaultMaxSize)
+	}
 	handler := &PermissionHandler{
 		permissionUC: permissionUC,
 		roleUC:       roleUC,
 		userRoleUC:   userRoleUC,
-	}
-
-	// Rutas de permisos
-	permissions := router.Group("/permissions")
-	{
-		permissions.GET("/", handler.GetAllPermissions)
-		permissions.GET("/:id", handler.GetPermission)
-		permissions.GET("/code/:code", handler.GetPermissionByCode)
-		permissions.GET("/module/:module", handler.GetPermissionsByModule)
-		permissions.POST("/", handler.CreatePermission)
-		permissions.PUT("/:id", handler.UpdatePermission)
-		permissions.DELETE("/:id", handler.DeletePermission)
-	}
+		paginator:    paginator,
+		recorder:     recorder,
+	}
+
+	// Rutas de permisos. El router ya está montado bajo /permissions, por lo que se
+	// registran en su raíz. Las rutas raíz no llevan barra final, igual que en usuarios;
+	// Gin redirige las solicitudes con barra final a la ruta canónica.
+	router.GET("", handler.GetAllPermissions)
+	router.GET("/:id", handler.GetPermission)
+	router.GET("/code/:code", handler.GetPermissionByCode)
+	router.GET("/module/:module", handler.GetPermissionsByModule)
+	router.POST("", handler.CreatePermission)
+	router.POST("/validate-codes", handler.ValidateCodes)
+	router.POST("/code/:code/rename", handler.RenamePermissionCode)
+	router.PUT("/:id", handler.UpdatePermission)
+	router.DELETE("/:id", handler.DeletePermission)
 
 	// Rutas de roles
 	roles := router.Group("/roles")
 	{
-		roles.GET("/", handler.GetAllRoles)
+		roles.GET("", handler.GetAllRoles)
 		roles.GET("/:id", handler.GetRole)
 		roles.GET("/name/:name", handler.GetRoleByName)
-		roles.POST("/", handler.CreateRole)
+		roles.POST("", handler.CreateRole)
 		roles.PUT("/:id", handler.UpdateRole)
 		roles.DELETE("/:id", handler.DeleteRole)
 		roles.POST("/:id/permissions", handler.AddPermissionToRole)
 		roles.DELETE("/:id/permissions/:permissionCode", handler.RemovePermissionFromRole)
+		roles.PATCH("/:id/permissions", handler.UpdateRolePermissions)
+		roles.PUT("/:id/permissions", handler.SetRolePermissions)
 	}
 
 	// Rutas de asignación usuario-rol
 	userRoles := router.Group("/user-roles")
 	{
 		userRoles.GET("/:userID", handler.GetUserRoles)
+		userRoles.GET("/by-role/:roleID", handler.GetUsersByRole)
 		userRoles.POST("/assign-role", handler.AssignRoleToUser)
+		userRoles.POST("/preview-assign", handler.PreviewAssignRole)
+		userRoles.POST("/matrix", handler.GetPermissionMatrix)
 		userRoles.DELETE("/remove-role", handler.RemoveRoleFromUser)
 		userRoles.POST("/assign-permission", handler.AssignPermissionToUser)
 		userRoles.DELETE("/remove-permission", handler.RemovePermissionFromUser)
 		userRoles.GET("/:userID/permissions", handler.GetUserPermissions)
 		userRoles.GET("/:userID/has-permission/:permissionCode", handler.CheckUserPermission)
+		userRoles.POST("/rebuild-effective-permissions", handler.RebuildEffectivePermissions)
 	}
 }
 
@@ -75,18 +99,27 @@ func NewPermissionHandler(
 // @Produce json
 // @Param status query string false "Estado del permission (active, inactive, archived)"
 // @Param name query string false "Nombre del permission (búsqueda parcial)"
-// @Success 200 {object} utils.Response{data=[]domain.PermissionResponse} "Lista de permissions"
+// @Param created_from query string false "Fecha de creación desde (formato ISO8601)"
+// @Param created_to query string false "Fecha de creación hasta (formato ISO8601)"
+// @Param updated_from query string false "Fecha de actualización desde (formato ISO8601)"
+// @Param updated_to query string false "Fecha de actualización hasta (formato ISO8601)"
+// @Param page query int false "Página (desde 1)"
+// @Param limit query int false "Tamaño de página (se reduce al máximo configurado)"
+// @Success 200 {object} utils.Response{data=[]domain.PermissionResponse,pagination=utils.PaginationMeta} "Lista de permissions"
 // @Failure 500 {object} utils.Response "Error interno"
 // @Router /permissions [get]
 // @Security BearerAuth
 func (h *PermissionHandler) GetAllPermissions(c *gin.Context) {
-	permissions, err := h.permissionUC.GetAllPermissions()
+	filter := utils.DateRangeQueryFilter(c.Request.URL.Query(), "created_at", "updated_at")
+
+	page := h.paginator.Parse(c)
+	permissions, total, err := h.permissionUC.GetPermissionsPage(filter, page.Skip(), int64(page.Limit))
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		utils.ErrorResponse(c, http.StatusInternalServerError, publicError(err))
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Permisos obtenidos con éxito", permissions)
+	utils.PaginatedResponse(c, http.StatusOK, "Permisos obtenidos con éxito", permissions, h.paginator.Meta(page, total))
 }
 
 // GetPermission manejador para obtener un permiso por ID
@@ -106,7 +139,7 @@ func (h *PermissionHandler) GetPermission(c *gin.Context) {
 
 	permission, err := h.permissionUC.GetPermission(id)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		errorResponse(c, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -119,7 +152,7 @@ func (h *PermissionHandler) GetPermissionByCode(c *gin.Context) {
 
 	permission, err := h.permissionUC.GetPermissionByCode(code)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		errorResponse(c, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -132,7 +165,7 @@ func (h *PermissionHandler) GetPermissionsByModule(c *gin.Context) {
 
 	permissions, err := h.permissionUC.GetPermissionsByModule(module)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		utils.ErrorResponse(c, http.StatusInternalServerError, publicError(err))
 		return
 	}
 
@@ -148,6 +181,7 @@ func (h *PermissionHandler) GetPermissionsByModule(c *gin.Context) {
 // @Param permission body domain.CreatePermissionRequest true "Datos del permission"
 // @Success 201 {object} utils.Response{data=domain.PermissionResponse} "Permission creado"
 // @Failure 400 {object} utils.Response "Datos inválidos"
+// @Failure 422 {object} utils.Response "Regla de negocio no cumplida"
 // @Failure 500 {object} utils.Response "Error interno"
 // @Router /permissions [post]
 // @Security BearerAuth
@@ -158,15 +192,47 @@ func (h *PermissionHandler) CreatePermission(c *gin.Context) {
 		return
 	}
 
-	permission, err := h.permissionUC.CreatePermission(&req)
+	permission, err := h.permissionUC.CreatePermission(adminScope(c), &req)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		errorResponse(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if !h.recordChange(c, domain.ChangePermissionCreate, "permission:"+permission.Code, "") {
 		return
 	}
 
 	utils.SuccessResponse(c, http.StatusCreated, "Permiso creado con éxito", permission)
 }
 
+// ValidateCodes manejador para validar un lote de códigos de permiso
+// @Summary Validar códigos de permission
+// @Description Clasifica una lista de códigos en existentes, faltantes y mal formados
+// @Tags permissions
+// @Accept json
+// @Produce json
+// @Param codes body domain.ValidateCodesRequest true "Códigos a validar"
+// @Success 200 {object} utils.Response{data=domain.CodeValidationReport} "Reporte de validación"
+// @Failure 400 {object} utils.Response "Datos inválidos"
+// @Failure 500 {object} utils.Response "Error interno"
+// @Router /permissions/validate-codes [post]
+// @Security BearerAuth
+func (h *PermissionHandler) ValidateCodes(c *gin.Context) {
+	var req domain.ValidateCodesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	report, err := h.permissionUC.ValidateCodes(req.Codes)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, publicError(err))
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Códigos validados con éxito", report)
+}
+
 // UpdatePermission manejador para actualizar un permiso
 // @Summary Actualizar un permission
 // @Description Actualiza un permission existente
@@ -178,6 +244,7 @@ func (h *PermissionHandler) CreatePermission(c *gin.Context) {
 // @Success 200 {object} utils.Response{data=domain.PermissionResponse} "Permission actualizado"
 // @Failure 400 {object} utils.Response "Datos inválidos"
 // @Failure 404 {object} utils.Response "No encontrado"
+// @Failure 422 {object} utils.Response "Regla de negocio no cumplida"
 // @Failure 500 {object} utils.Response "Error interno"
 // @Router /permissions/{id} [put]
 // @Security BearerAuth
@@ -190,9 +257,13 @@ func (h *PermissionHandler) UpdatePermission(c *gin.Context) {
 		return
 	}
 
-	permission, err := h.permissionUC.UpdatePermission(id, &req)
+	permission, err := h.permissionUC.UpdatePermission(adminScope(c), id, &req)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		errorResponse(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if !h.recordChange(c, domain.ChangePermissionUpdate, "permission:"+permission.Code, "") {
 		return
 	}
 
@@ -201,37 +272,54 @@ func (h *PermissionHandler) UpdatePermission(c *gin.Context) {
 
 // DeletePermission manejador para eliminar un permiso
 // @Summary Eliminar un permission
-// @Description Elimina un permission por su ID
+// @Description Elimina un permission por su ID. Si algún rol o asignación de usuario lo referencia se rechaza listando los roles, salvo con force=true, que lo quita de todos ellos
 // @Tags permissions
 // @Accept json
 // @Produce json
 // @Param id path string true "ID del permission"
-// @Success 200 {object} utils.Response "Permission eliminado"
+// @Param force query bool false "Quitar el permission de los roles y asignaciones que lo referencian"
+// @Success 200 {object} utils.Response{data=domain.PermissionDeleteResult} "Permission eliminado"
 // @Failure 404 {object} utils.Response "No encontrado"
+// @Failure 422 {object} utils.Response "Permission en uso"
 // @Failure 500 {object} utils.Response "Error interno"
 // @Router /permissions/{id} [delete]
 // @Security BearerAuth
 func (h *PermissionHandler) DeletePermission(c *gin.Context) {
 	id := c.Param("id")
+	force := c.Query("force") == "true"
 
-	err := h.permissionUC.DeletePermission(id)
+	result, err := h.permissionUC.DeletePermission(adminScope(c), id, force)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		if errors.Is(err, domain.ErrPermissionNotFound) {
+			utils.NotFoundResponse(c, "Permiso")
+			return
+		}
+		errorResponse(c, http.StatusInternalServerError, err)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Permiso eliminado con éxito", nil)
+	details := fmt.Sprintf("force=%t roles_updated=%d user_roles_updated=%d", force, result.RolesUpdated, result.UserRolesUpdated)
+	if !h.recordChange(c, domain.ChangePermissionDelete, "permission:"+result.Code, details) {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Permiso eliminado con éxito", result)
 }
 
-// GetAllRoles manejador para obtener todos los roles
+// GetAllRoles manejador para obtener una página de roles (page y limit). Acepta
+// created_from/created_to y updated_from/updated_to (ISO8601) para filtrar por fecha de
+// creación o actualización.
 func (h *PermissionHandler) GetAllRoles(c *gin.Context) {
-	roles, err := h.roleUC.GetAllRoles()
+	filter := utils.DateRangeQueryFilter(c.Request.URL.Query(), "created_at", "updated_at")
+
+	page := h.paginator.Parse(c)
+	roles, total, err := h.roleUC.GetRolesPage(filter, page.Skip(), int64(page.Limit))
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		utils.ErrorResponse(c, http.StatusInternalServerError, publicError(err))
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Roles obtenidos con éxito", roles)
+	utils.PaginatedResponse(c, http.StatusOK, "Roles obtenidos con éxito", roles, h.paginator.Meta(page, total))
 }
 
 // GetRole manejador para obtener un rol por ID
@@ -240,7 +328,7 @@ func (h *PermissionHandler) GetRole(c *gin.Context) {
 
 	role, err := h.roleUC.GetRole(id)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		errorResponse(c, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -253,7 +341,7 @@ func (h *PermissionHandler) GetRoleByName(c *gin.Context) {
 
 	role, err := h.roleUC.GetRoleByName(name)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		errorResponse(c, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -268,9 +356,13 @@ func (h *PermissionHandler) CreateRole(c *gin.Context) {
 		return
 	}
 
-	role, err := h.roleUC.CreateRole(&req)
+	role, err := h.roleUC.CreateRole(adminScope(c), &req)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		errorResponse(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if !h.recordChange(c, domain.ChangeRoleCreate, "role:"+role.ID, "name="+role.Name) {
 		return
 	}
 
@@ -287,9 +379,20 @@ func (h *PermissionHandler) UpdateRole(c *gin.Context) {
 		return
 	}
 
-	role, err := h.roleUC.UpdateRole(id, &req)
+	unmodifiedSince, err := utils.ParseIfUnmodifiedSince(c.GetHeader("If-Unmodified-Since"))
+	if err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+	req.UnmodifiedSince = unmodifiedSince
+
+	role, err := h.roleUC.UpdateRole(adminScope(c), id, &req)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		errorResponse(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if !h.recordChange(c, domain.ChangeRoleUpdate, "role:"+id, "") {
 		return
 	}
 
@@ -300,9 +403,13 @@ func (h *PermissionHandler) UpdateRole(c *gin.Context) {
 func (h *PermissionHandler) DeleteRole(c *gin.Context) {
 	id := c.Param("id")
 
-	err := h.roleUC.DeleteRole(id)
+	err := h.roleUC.DeleteRole(adminScope(c), id)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		errorResponse(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	if !h.recordChange(c, domain.ChangeRoleDelete, "role:"+id, "") {
 		return
 	}
 
@@ -322,9 +429,13 @@ func (h *PermissionHandler) AddPermissionToRole(c *gin.Context) {
 		return
 	}
 
-	err := h.roleUC.AddPermissionToRole(id, req.PermissionCode)
+	err := h.roleUC.AddPermissionToRole(adminScope(c), id, req.PermissionCode)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		errorResponse(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if !h.recordChange(c, domain.ChangeRolePermissionAdd, "role:"+id, "permission="+req.PermissionCode) {
 		return
 	}
 
@@ -336,28 +447,114 @@ func (h *PermissionHandler) RemovePermissionFromRole(c *gin.Context) {
 	id := c.Param("id")
 	permissionCode := c.Param("permissionCode")
 
-	err := h.roleUC.RemovePermissionFromRole(id, permissionCode)
+	err := h.roleUC.RemovePermissionFromRole(adminScope(c), id, permissionCode)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		errorResponse(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if !h.recordChange(c, domain.ChangeRolePermissionRemove, "role:"+id, "permission="+permissionCode) {
 		return
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, "Permiso eliminado del rol con éxito", nil)
 }
 
+// UpdateRolePermissions manejador para añadir y quitar permisos de un rol en una sola llamada
+func (h *PermissionHandler) UpdateRolePermissions(c *gin.Context) {
+	id := c.Param("id")
+
+	var req domain.UpdateRolePermissionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	if len(req.Add) == 0 && len(req.Remove) == 0 {
+		utils.ValidationErrorResponse(c, "Debe indicar al menos un permiso en add o remove")
+		return
+	}
+
+	role, err := h.roleUC.UpdateRolePermissions(adminScope(c), id, &req)
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, err)
+		return
+	}
+
+	details := fmt.Sprintf("add=%s remove=%s", strings.Join(req.Add, ","), strings.Join(req.Remove, ","))
+	if !h.recordChange(c, domain.ChangeRolePermissions, "role:"+id, details) {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Permisos del rol actualizados con éxito", role)
+}
+
+// SetRolePermissions manejador para reemplazar todos los permisos de un rol en una sola llamada
+func (h *PermissionHandler) SetRolePermissions(c *gin.Context) {
+	id := c.Param("id")
+
+	var req domain.SetRolePermissionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	role, err := h.roleUC.SetRolePermissions(adminScope(c), id, req.Permissions)
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if !h.recordChange(c, domain.ChangeRolePermissionsSet, "role:"+id, "permissions="+strings.Join(req.Permissions, ",")) {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Permisos del rol reemplazados con éxito", role)
+}
+
 // GetUserRoles manejador para obtener los roles de un usuario
 func (h *PermissionHandler) GetUserRoles(c *gin.Context) {
 	userID := c.Param("userID")
 
 	userRoles, err := h.userRoleUC.GetUserRoles(userID)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		utils.ErrorResponse(c, http.StatusInternalServerError, publicError(err))
 		return
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, "Roles de usuario obtenidos con éxito", userRoles)
 }
 
+// GetUsersByRole manejador para obtener una página de los usuarios que tienen asignado un rol
+// @Summary Listar los usuarios de un rol
+// @Description Obtiene una página de los IDs de los usuarios que tienen asignado el rol directamente, ordenados. Omite a los usuarios con el rol vencido.
+// @Tags permissions
+// @Produce json
+// @Param roleID path string true "ID del rol"
+// @Param page query int false "Página (desde 1)"
+// @Param limit query int false "Tamaño de página (se reduce al máximo configurado)"
+// @Success 200 {object} utils.Response{data=domain.RoleUsersResponse,pagination=utils.PaginationMeta} "Usuarios del rol"
+// @Failure 404 {object} utils.Response "Rol no encontrado"
+// @Failure 500 {object} utils.Response "Error interno"
+// @Router /permissions/user-roles/by-role/{roleID} [get]
+// @Security BearerAuth
+func (h *PermissionHandler) GetUsersByRole(c *gin.Context) {
+	roleID := c.Param("roleID")
+
+	page := h.paginator.Parse(c)
+	users, err := h.userRoleUC.GetUsersByRole(roleID, page.Skip(), int64(page.Limit))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, domain.ErrRoleNotFound) {
+			status = http.StatusNotFound
+		}
+		utils.ErrorResponse(c, status, publicError(err))
+		return
+	}
+
+	utils.PaginatedResponse(c, http.StatusOK, "Usuarios del rol obtenidos con éxito", users, h.paginator.Meta(page, users.Total))
+}
+
 // AssignRoleToUser manejador para asignar un rol a un usuario
 func (h *PermissionHandler) AssignRoleToUser(c *gin.Context) {
 	var req domain.AssignRoleRequest
@@ -366,15 +563,40 @@ func (h *PermissionHandler) AssignRoleToUser(c *gin.Context) {
 		return
 	}
 
-	err := h.userRoleUC.AssignRoleToUser(&req)
+	err := h.userRoleUC.AssignRoleToUser(adminScope(c), &req)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		errorResponse(c, http.StatusBadRequest, err)
+		return
+	}
+
+	details := "role=" + req.RoleID
+	if req.ExpiresAt != nil {
+		details += " expires_at=" + req.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	if !h.recordChange(c, domain.ChangeRoleAssign, "user:"+req.UserID, details) {
 		return
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, "Rol asignado al usuario con éxito", nil)
 }
 
+// PreviewAssignRole manejador para consultar los permisos que un usuario ganaría al asignarle un rol
+func (h *PermissionHandler) PreviewAssignRole(c *gin.Context) {
+	var req domain.AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	preview, err := h.userRoleUC.PreviewAssignRole(&req)
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Vista previa de la asignación generada con éxito", preview)
+}
+
 // RemoveRoleFromUser manejador para eliminar un rol de un usuario
 func (h *PermissionHandler) RemoveRoleFromUser(c *gin.Context) {
 	var req domain.AssignRoleRequest
@@ -383,9 +605,13 @@ func (h *PermissionHandler) RemoveRoleFromUser(c *gin.Context) {
 		return
 	}
 
-	err := h.userRoleUC.RemoveRoleFromUser(&req)
+	err := h.userRoleUC.RemoveRoleFromUser(adminScope(c), &req)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		errorResponse(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if !h.recordChange(c, domain.ChangeRoleUnassign, "user:"+req.UserID, "role="+req.RoleID) {
 		return
 	}
 
@@ -400,9 +626,13 @@ func (h *PermissionHandler) AssignPermissionToUser(c *gin.Context) {
 		return
 	}
 
-	err := h.userRoleUC.AssignPermissionToUser(&req)
+	err := h.userRoleUC.AssignPermissionToUser(adminScope(c), &req)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		errorResponse(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if !h.recordChange(c, domain.ChangePermissionAssign, "user:"+req.UserID, "permission="+req.PermissionCode) {
 		return
 	}
 
@@ -417,9 +647,13 @@ func (h *PermissionHandler) RemovePermissionFromUser(c *gin.Context) {
 		return
 	}
 
-	err := h.userRoleUC.RemovePermissionFromUser(&req)
+	err := h.userRoleUC.RemovePermissionFromUser(adminScope(c), &req)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		errorResponse(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if !h.recordChange(c, domain.ChangePermissionUnassign, "user:"+req.UserID, "permission="+req.PermissionCode) {
 		return
 	}
 
@@ -432,13 +666,42 @@ func (h *PermissionHandler) GetUserPermissions(c *gin.Context) {
 
 	permissions, err := h.userRoleUC.GetUserPermissions(userID)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		utils.ErrorResponse(c, http.StatusInternalServerError, publicError(err))
 		return
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, "Permisos de usuario obtenidos con éxito", permissions)
 }
 
+// GetPermissionMatrix manejador para evaluar varios permisos de varios usuarios a la vez
+// @Summary Obtener la matriz de permisos de varios usuarios
+// @Description Indica para cada usuario si tiene cada permiso (por sus roles, permisos específicos o comodines). Sin permissions se evalúan todos los permisos registrados.
+// @Tags permissions
+// @Accept json
+// @Produce json
+// @Param request body domain.PermissionMatrixRequest true "Usuarios y códigos a evaluar"
+// @Success 200 {object} utils.Response{data=domain.PermissionMatrix} "Matriz de permisos por usuario"
+// @Failure 400 {object} utils.Response "Datos inválidos"
+// @Failure 422 {object} utils.Response "Demasiados usuarios"
+// @Failure 500 {object} utils.Response "Error interno"
+// @Router /permissions/user-roles/matrix [post]
+// @Security BearerAuth
+func (h *PermissionHandler) GetPermissionMatrix(c *gin.Context) {
+	var req domain.PermissionMatrixRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	matrix, err := h.userRoleUC.GetPermissionMatrix(req.UserIDs, req.Permissions)
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Matriz de permisos obtenida con éxito", matrix)
+}
+
 // CheckUserPermission manejador para verificar si un usuario tiene un permiso
 func (h *PermissionHandler) CheckUserPermission(c *gin.Context) {
 	userID := c.Param("userID")
@@ -446,7 +709,7 @@ func (h *PermissionHandler) CheckUserPermission(c *gin.Context) {
 
 	hasPermission, err := h.userRoleUC.HasPermission(userID, permissionCode)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		utils.ErrorResponse(c, http.StatusInternalServerError, publicError(err))
 		return
 	}
 
@@ -454,3 +717,216 @@ func (h *PermissionHandler) CheckUserPermission(c *gin.Context) {
 		"has_permission": hasPermission,
 	})
 }
+
+// RebuildEffectivePermissions manejador para recalcular los permisos materializados de todos los usuarios
+// @Summary Reconstruir los permisos efectivos materializados
+// @Description Recalcula y guarda los permisos efectivos (roles + específicos) de todas las asignaciones de usuario
+// @Tags permissions
+// @Produce json
+// @Success 200 {object} utils.Response{data=domain.EffectivePermissionsRebuildResult} "Permisos reconstruidos"
+// @Failure 403 {object} utils.Response "Fuera del ámbito de administración"
+// @Failure 500 {object} utils.Response "Error interno"
+// @Router /permissions/user-roles/rebuild-effective-permissions [post]
+// @Security BearerAuth
+func (h *PermissionHandler) RebuildEffectivePermissions(c *gin.Context) {
+	result, err := h.userRoleUC.RebuildEffectivePermissions(adminScope(c))
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Permisos efectivos reconstruidos con éxito", result)
+}
+
+// RenamePermissionCode manejador para cambiar el código de un permiso
+// @Summary Renombrar el código de un permission
+// @Description Cambia el código de un permission y lo reemplaza en todos los roles y asignaciones de usuario que lo referencian
+// @Tags permissions
+// @Accept json
+// @Produce json
+// @Param code path string true "Código actual del permission"
+// @Param request body domain.RenamePermissionCodeRequest true "Nuevo código"
+// @Success 200 {object} utils.Response{data=domain.PermissionRenameResult} "Código renombrado"
+// @Failure 400 {object} utils.Response "Datos inválidos"
+// @Failure 404 {object} utils.Response "No encontrado"
+// @Failure 422 {object} utils.Response "Código mal formado o en uso"
+// @Failure 500 {object} utils.Response "Error interno"
+// @Router /permissions/code/{code}/rename [post]
+// @Security BearerAuth
+func (h *PermissionHandler) RenamePermissionCode(c *gin.Context) {
+	var req domain.RenamePermissionCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	result, err := h.permissionUC.RenamePermissionCode(adminScope(c), c.Param("code"), req.NewCode)
+	if err != nil {
+		if errors.Is(err, domain.ErrPermissionNotFound) {
+			utils.NotFoundResponse(c, "Permiso")
+			return
+		}
+		errorResponse(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	if !h.recordChange(c, domain.ChangePermissionRename, "permission:"+result.OldCode, "new_code="+result.NewCode) {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Código de permiso renombrado con éxito", result)
+}
+
+// businessRuleErrors son los errores del dominio que indican una solicitud bien formada
+// pero inválida según las reglas de negocio; se responden con 422
+var businessRuleErrors = []error{
+	domain.ErrPermissionCodeExists,
+	domain.ErrInvalidPermission,
+	domain.ErrRoleNameExists,
+	domain.ErrInvalidRole,
+	domain.ErrSystemRoleImmutable,
+	domain.ErrMalformedPermission,
+	domain.ErrConflictingDelta,
+	domain.ErrRoleInUse,
+	domain.ErrRoleInheritanceCycle,
+	domain.ErrPermissionInUse,
+	domain.ErrMatrixTooLarge,
+	domain.ErrInvalidRoleExpiry,
+}
+
+// publicErrors son los errores del dominio cuyo mensaje puede mostrarse al cliente
+var publicErrors = []error{
+	utils.ErrVersionConflict,
+	domain.ErrPermissionCodeExists,
+	domain.ErrInvalidPermission,
+	domain.ErrRoleNameExists,
+	domain.ErrInvalidRole,
+	domain.ErrSystemRoleImmutable,
+	domain.ErrMalformedPermission,
+	domain.ErrConflictingDelta,
+	domain.ErrRoleInUse,
+	domain.ErrRoleInheritanceCycle,
+	domain.ErrOutOfAdminScope,
+	domain.ErrMatrixTooLarge,
+	domain.ErrInvalidRoleExpiry,
+	domain.ErrPermissionNotFound,
+	domain.ErrPermissionInUse,
+	domain.ErrRoleNotFound,
+}
+
+// recordChange registra un cambio ya aplicado con el usuario de la petición como actor. Si el
+// registro falla responde 500 y retorna false: el cambio se aplicó, pero no se da por exitoso
+// una operación que no quedó en la auditoría.
+func (h *PermissionHandler) recordChange(c *gin.Context, action, target, details string) bool {
+	if h.recorder == nil {
+		return true
+	}
+
+	change := &domain.PermissionChange{
+		ActorID: changeActor(c),
+		Action:  action,
+		Target:  target,
+		Details: details,
+	}
+	if err := h.recorder.RecordPermissionChange(change); err != nil {
+		log.Printf("[ERROR] cambio aplicado sin registro de auditoría actor=%s action=%s target=%s error=%v",
+			change.ActorID, action, target, err)
+		auditFailedResponse(c)
+		return false
+	}
+	return true
+}
+
+// auditFailedResponse responde 500 con el código audit_failed a un cambio que se aplicó pero no
+// quedó registrado en la auditoría
+func auditFailedResponse(c *gin.Context) {
+	utils.ErrorCodeResponse(c, http.StatusInternalServerError, "audit_failed",
+		"El cambio se aplicó pero no pudo registrarse en la auditoría")
+}
+
+// changeActor retorna el usuario autenticado o, en peticiones autenticadas con API key,
+// "apikey:<id>" (la misma identidad que guarda el middleware de API keys)
+func changeActor(c *gin.Context) string {
+	if userID, ok := utils.MustUserID(c); ok {
+		return userID
+	}
+	if keyID, ok := utils.ClaimString(c, utils.APIKeyIDContextKey); ok {
+		return middleware.APIKeyUserIDPrefix + keyID
+	}
+	return ""
+}
+
+// adminScope retorna el ámbito de administración delegada guardado por
+// PermissionMiddleware.ResolveAdminScope; nil (sin restricción) si no se resolvió
+func adminScope(c *gin.Context) *domain.AdminScope {
+	value, _ := c.Get(domain.AdminScopeContextKey)
+	scope, _ := value.(*domain.AdminScope)
+	return scope
+}
+
+// publicError retorna el mensaje a exponer al cliente. Si el error envuelve un error conocido
+// del dominio, se usa solo su mensaje y se omite la causa interna. Los errores no clasificados
+// se registran y el cliente recibe un mensaje genérico.
+func publicError(err error) string {
+	// Los roles que referencian un permiso en uso se muestran completos
+	var inUse *domain.PermissionInUseError
+	if errors.As(err, &inUse) {
+		return inUse.Error()
+	}
+	for _, known := range publicErrors {
+		if errors.Is(err, known) {
+			return known.Error()
+		}
+	}
+	log.Printf("[ERROR] error no clasificado en la API de permisos: %v", err)
+	return utils.InternalErrorMessage
+}
+
+// errorResponse responde con 500 y el código audit_failed si el cambio se aplicó sin quedar en la
+// auditoría, con 412 si la actualización condicional no se aplicó, con 403 si la
+// operación está fuera del ámbito del administrador, con 422 si err viola una regla de negocio
+// del dominio, con 404 si el rol o el permiso no existe y con statusCode para el resto de errores
+// conocidos. Los errores no clasificados responden 500.
+func errorResponse(c *gin.Context, statusCode int, err error) {
+	if errors.Is(err, domain.ErrAuditFailed) {
+		log.Printf("[ERROR] cambio aplicado sin registro de auditoría error=%v", err)
+		auditFailedResponse(c)
+		return
+	}
+	if errors.Is(err, utils.ErrVersionConflict) {
+		utils.PreconditionFailedResponse(c, publicError(err))
+		return
+	}
+	if errors.Is(err, domain.ErrOutOfAdminScope) {
+		utils.ErrorResponse(c, http.StatusForbidden, publicError(err))
+		return
+	}
+	for _, rule := range businessRuleErrors {
+		if errors.Is(err, rule) {
+			utils.UnprocessableEntityResponse(c, publicError(err))
+			return
+		}
+	}
+	if errors.Is(err, domain.ErrRoleNotFound) || errors.Is(err, domain.ErrPermissionNotFound) {
+		utils.ErrorResponse(c, http.StatusNotFound, publicError(err))
+		return
+	}
+	if !isPublicError(err) {
+		statusCode = http.StatusInternalServerError
+	}
+	utils.ErrorResponse(c, statusCode, publicError(err))
+}
+
+// isPublicError indica si err envuelve un error del dominio cuyo mensaje ve el cliente
+func isPublicError(err error) bool {
+	var inUse *domain.PermissionInUseError
+	if errors.As(err, &inUse) {
+		return true
+	}
+	for _, known := range publicErrors {
+		if errors.Is(err, known) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,965 @@
+package delivery_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/black4ninja/mi-proyecto/internal/permission/delivery"
+	"github.com/black4ninja/mi-proyecto/internal/permission/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// MockPermissionUseCase simula el caso de uso de permisos; los métodos no
+// implementados entran en pánico a través de la interfaz embebida
+type MockPermissionUseCase struct {
+	domain.PermissionUseCase
+	mock.Mock
+}
+
+func (m *MockPermissionUseCase) CreatePermission(scope *domain.AdminScope, req *domain.CreatePermissionRequest) (*domain.PermissionResponse, error) {
+	args := m.Called(scope, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.PermissionResponse), args.Error(1)
+}
+
+func (m *MockPermissionUseCase) GetPermission(id string) (*domain.PermissionResponse, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.PermissionResponse), args.Error(1)
+}
+
+func (m *MockPermissionUseCase) GetPermissionsPage(params map[string]interface{}, skip, limit int64) ([]*domain.PermissionResponse, int64, error) {
+	args := m.Called(params, skip, limit)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]*domain.PermissionResponse), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockPermissionUseCase) RenamePermissionCode(scope *domain.AdminScope, oldCode, newCode string) (*domain.PermissionRenameResult, error) {
+	args := m.Called(scope, oldCode, newCode)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.PermissionRenameResult), args.Error(1)
+}
+
+func (m *MockPermissionUseCase) DeletePermission(scope *domain.AdminScope, id string, force bool) (*domain.PermissionDeleteResult, error) {
+	args := m.Called(scope, id, force)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.PermissionDeleteResult), args.Error(1)
+}
+
+// MockRoleUseCase simula el caso de uso de roles
+type MockRoleUseCase struct {
+	domain.RoleUseCase
+	mock.Mock
+}
+
+func (m *MockRoleUseCase) GetRole(id string) (*domain.RoleResponse, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.RoleResponse), args.Error(1)
+}
+
+func (m *MockRoleUseCase) GetRoleByName(name string) (*domain.RoleResponse, error) {
+	args := m.Called(name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.RoleResponse), args.Error(1)
+}
+
+func (m *MockRoleUseCase) AddPermissionToRole(scope *domain.AdminScope, roleID string, permissionCode string) error {
+	return m.Called(scope, roleID, permissionCode).Error(0)
+}
+
+func (m *MockRoleUseCase) UpdateRolePermissions(scope *domain.AdminScope, roleID string, req *domain.UpdateRolePermissionsRequest) (*domain.RoleResponse, error) {
+	args := m.Called(scope, roleID, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.RoleResponse), args.Error(1)
+}
+
+func (m *MockRoleUseCase) GetRolesPage(params map[string]interface{}, skip, limit int64) ([]*domain.RoleResponse, int64, error) {
+	args := m.Called(params, skip, limit)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]*domain.RoleResponse), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockRoleUseCase) AddRolePermissions(scope *domain.AdminScope, roleID string, codes []string) (*domain.RoleResponse, error) {
+	args := m.Called(scope, roleID, codes)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.RoleResponse), args.Error(1)
+}
+
+func (m *MockRoleUseCase) RemoveRolePermissions(scope *domain.AdminScope, roleID string, codes []string) (*domain.RoleResponse, error) {
+	args := m.Called(scope, roleID, codes)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.RoleResponse), args.Error(1)
+}
+
+func (m *MockRoleUseCase) SetRolePermissions(scope *domain.AdminScope, roleID string, codes []string) (*domain.RoleResponse, error) {
+	args := m.Called(scope, roleID, codes)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.RoleResponse), args.Error(1)
+}
+
+// MockUserRoleUseCase simula el caso de uso de asignaciones usuario-rol
+type MockUserRoleUseCase struct {
+	domain.UserRoleUseCase
+	mock.Mock
+}
+
+func (m *MockUserRoleUseCase) GetUsersByRole(roleID string, skip, limit int64) (*domain.RoleUsersResponse, error) {
+	args := m.Called(roleID, skip, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.RoleUsersResponse), args.Error(1)
+}
+
+// newPermissionRouter monta el manejador bajo /api/permissions, igual que main
+func newPermissionRouter(permissionUC domain.PermissionUseCase, roleUC domain.RoleUseCase) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	delivery.NewPermissionHandler(r.Group("/api").Group("/permissions"), permissionUC, roleUC, nil, utils.NewPaginator(20, 100), nil)
+	return r
+}
+
+func TestPermissionHandlerRoutes(t *testing.T) {
+	r := newPermissionRouter(new(MockPermissionUseCase), new(MockRoleUseCase))
+
+	var routes []string
+	for _, route := range r.Routes() {
+		routes = append(routes, route.Method+" "+route.Path)
+	}
+
+	assert.ElementsMatch(t, []string{
+		"GET /api/permissions",
+		"GET /api/permissions/:id",
+		"GET /api/permissions/code/:code",
+		"GET /api/permissions/module/:module",
+		"POST /api/permissions",
+		"POST /api/permissions/validate-codes",
+		"POST /api/permissions/code/:code/rename",
+		"PUT /api/permissions/:id",
+		"DELETE /api/permissions/:id",
+		"GET /api/permissions/roles",
+		"GET /api/permissions/roles/:id",
+		"GET /api/permissions/roles/name/:name",
+		"POST /api/permissions/roles",
+		"PUT /api/permissions/roles/:id",
+		"DELETE /api/permissions/roles/:id",
+		"POST /api/permissions/roles/:id/permissions",
+		"DELETE /api/permissions/roles/:id/permissions/:permissionCode",
+		"PATCH /api/permissions/roles/:id/permissions",
+		"PUT /api/permissions/roles/:id/permissions",
+		"GET /api/permissions/user-roles/:userID",
+		"GET /api/permissions/user-roles/by-role/:roleID",
+		"POST /api/permissions/user-roles/assign-role",
+		"POST /api/permissions/user-roles/preview-assign",
+		"POST /api/permissions/user-roles/matrix",
+		"DELETE /api/permissions/user-roles/remove-role",
+		"POST /api/permissions/user-roles/assign-permission",
+		"DELETE /api/permissions/user-roles/remove-permission",
+		"GET /api/permissions/user-roles/:userID/permissions",
+		"GET /api/permissions/user-roles/:userID/has-permission/:permissionCode",
+		"POST /api/permissions/user-roles/rebuild-effective-permissions",
+	}, routes)
+
+	for _, route := range routes {
+		assert.NotContains(t, route, "/permissions/permissions", "ruta anidada dos veces")
+	}
+}
+
+func TestPermissionHandlerTrailingSlash(t *testing.T) {
+	t.Run("la barra final redirige a la ruta canónica", func(t *testing.T) {
+		r := newPermissionRouter(new(MockPermissionUseCase), new(MockRoleUseCase))
+
+		req, _ := http.NewRequest("GET", "/api/permissions/roles/", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
+		assert.Equal(t, "/api/permissions/roles", w.Header().Get("Location"))
+	})
+
+	t.Run("la raíz de roles no se confunde con un ID de permiso", func(t *testing.T) {
+		roleUC := new(MockRoleUseCase)
+		roleUC.On("GetRolesPage", mock.Anything, int64(0), int64(20)).Return([]*domain.RoleResponse{}, int64(0), nil)
+		r := newPermissionRouter(new(MockPermissionUseCase), roleUC)
+
+		req, _ := http.NewRequest("GET", "/api/permissions/roles", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		roleUC.AssertExpectations(t)
+	})
+}
+
+func (m *MockUserRoleUseCase) AssignRoleToUser(scope *domain.AdminScope, req *domain.AssignRoleRequest) error {
+	return m.Called(scope, req).Error(0)
+}
+
+func (m *MockPermissionUseCase) UpdatePermission(scope *domain.AdminScope, id string, req *domain.UpdatePermissionRequest) (*domain.PermissionResponse, error) {
+	args := m.Called(scope, id, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.PermissionResponse), args.Error(1)
+}
+
+func (m *MockRoleUseCase) CreateRole(scope *domain.AdminScope, req *domain.CreateRoleRequest) (*domain.RoleResponse, error) {
+	args := m.Called(scope, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.RoleResponse), args.Error(1)
+}
+
+func (m *MockRoleUseCase) UpdateRole(scope *domain.AdminScope, id string, req *domain.UpdateRoleRequest) (*domain.RoleResponse, error) {
+	args := m.Called(scope, id, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.RoleResponse), args.Error(1)
+}
+
+func (m *MockRoleUseCase) DeleteRole(scope *domain.AdminScope, id string) error {
+	return m.Called(scope, id).Error(0)
+}
+
+func (m *MockRoleUseCase) RemovePermissionFromRole(scope *domain.AdminScope, roleID string, permissionCode string) error {
+	return m.Called(scope, roleID, permissionCode).Error(0)
+}
+
+func (m *MockUserRoleUseCase) RemoveRoleFromUser(scope *domain.AdminScope, req *domain.AssignRoleRequest) error {
+	return m.Called(scope, req).Error(0)
+}
+
+func (m *MockUserRoleUseCase) AssignPermissionToUser(scope *domain.AdminScope, req *domain.AssignPermissionRequest) error {
+	return m.Called(scope, req).Error(0)
+}
+
+func (m *MockUserRoleUseCase) RemovePermissionFromUser(scope *domain.AdminScope, req *domain.AssignPermissionRequest) error {
+	return m.Called(scope, req).Error(0)
+}
+
+func TestPermissionChangeRecording(t *testing.T) {
+	newRouter := func(userRoleUC domain.UserRoleUseCase, recorder domain.PermissionChangeRecorder) *gin.Engine {
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		api := r.Group("/api")
+		api.Use(func(c *gin.Context) { c.Set(utils.UserIDContextKey, "admin-1") })
+		delivery.NewPermissionHandler(api.Group("/permissions"), new(MockPermissionUseCase), new(MockRoleUseCase), userRoleUC, nil, recorder)
+		return r
+	}
+	assign := func(r *gin.Engine) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/api/permissions/user-roles/assign-role", bytes.NewBufferString(`{"user_id":"usuario-7","role_id":"rol-1"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("registra el actor, la acción y el objetivo", func(t *testing.T) {
+		userRoleUC := new(MockUserRoleUseCase)
+		userRoleUC.On("AssignRoleToUser", mock.Anything, mock.Anything).Return(nil)
+		var changes []*domain.PermissionChange
+		recorder := domain.PermissionChangeRecorderFunc(func(change *domain.PermissionChange) error {
+			changes = append(changes, change)
+			return nil
+		})
+
+		w := assign(newRouter(userRoleUC, recorder))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []*domain.PermissionChange{{
+			ActorID: "admin-1", Action: domain.ChangeRoleAssign, Target: "user:usuario-7", Details: "role=rol-1",
+		}}, changes)
+	})
+
+	t.Run("un fallo al registrar no se da por exitoso", func(t *testing.T) {
+		userRoleUC := new(MockUserRoleUseCase)
+		userRoleUC.On("AssignRoleToUser", mock.Anything, mock.Anything).Return(nil)
+		recorder := domain.PermissionChangeRecorderFunc(func(change *domain.PermissionChange) error {
+			return errors.New("sin conexión")
+		})
+
+		w := assign(newRouter(userRoleUC, recorder))
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"audit_failed"`)
+	})
+
+	t.Run("con API key el actor es apikey:<id>", func(t *testing.T) {
+		userRoleUC := new(MockUserRoleUseCase)
+		userRoleUC.On("AssignRoleToUser", mock.Anything, mock.Anything).Return(nil)
+		var changes []*domain.PermissionChange
+		recorder := domain.PermissionChangeRecorderFunc(func(change *domain.PermissionChange) error {
+			changes = append(changes, change)
+			return nil
+		})
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		api := r.Group("/api")
+		api.Use(func(c *gin.Context) { c.Set(utils.APIKeyIDContextKey, "key-1") })
+		delivery.NewPermissionHandler(api.Group("/permissions"), new(MockPermissionUseCase), new(MockRoleUseCase), userRoleUC, nil, recorder)
+
+		w := assign(r)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, changes, 1)
+		assert.Equal(t, "apikey:key-1", changes[0].ActorID)
+	})
+
+	t.Run("los cambios rechazados no se registran", func(t *testing.T) {
+		userRoleUC := new(MockUserRoleUseCase)
+		userRoleUC.On("AssignRoleToUser", mock.Anything, mock.Anything).Return(domain.ErrInvalidRole)
+		recorder := domain.PermissionChangeRecorderFunc(func(change *domain.PermissionChange) error {
+			t.Fatalf("cambio registrado: %+v", change)
+			return nil
+		})
+
+		w := assign(newRouter(userRoleUC, recorder))
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	})
+
+	// Cada ruta que modifica permisos, roles o asignaciones deja una entrada con el usuario
+	t.Run("todas las rutas de cambio se registran", func(t *testing.T) {
+		permissionUC := new(MockPermissionUseCase)
+		permissionUC.On("CreatePermission", mock.Anything, mock.Anything).Return(&domain.PermissionResponse{Code: "users:read"}, nil)
+		permissionUC.On("UpdatePermission", mock.Anything, "p1", mock.Anything).Return(&domain.PermissionResponse{Code: "users:read"}, nil)
+		permissionUC.On("DeletePermission", mock.Anything, "p1", false).Return(&domain.PermissionDeleteResult{Code: "users:read"}, nil)
+		permissionUC.On("RenamePermissionCode", mock.Anything, "users:read", "users:view").
+			Return(&domain.PermissionRenameResult{OldCode: "users:read", NewCode: "users:view"}, nil)
+		roleUC := new(MockRoleUseCase)
+		roleUC.On("CreateRole", mock.Anything, mock.Anything).Return(&domain.RoleResponse{ID: "r1", Name: "editor"}, nil)
+		roleUC.On("UpdateRole", mock.Anything, "r1", mock.Anything).Return(&domain.RoleResponse{ID: "r1"}, nil)
+		roleUC.On("DeleteRole", mock.Anything, "r1").Return(nil)
+		roleUC.On("AddPermissionToRole", mock.Anything, "r1", "users:read").Return(nil)
+		roleUC.On("RemovePermissionFromRole", mock.Anything, "r1", "users:read").Return(nil)
+		roleUC.On("UpdateRolePermissions", mock.Anything, "r1", mock.Anything).Return(&domain.RoleResponse{ID: "r1"}, nil)
+		roleUC.On("SetRolePermissions", mock.Anything, "r1", []string{"users:read"}).Return(&domain.RoleResponse{ID: "r1"}, nil)
+		userRoleUC := new(MockUserRoleUseCase)
+		userRoleUC.On("AssignRoleToUser", mock.Anything, mock.Anything).Return(nil)
+		userRoleUC.On("RemoveRoleFromUser", mock.Anything, mock.Anything).Return(nil)
+		userRoleUC.On("AssignPermissionToUser", mock.Anything, mock.Anything).Return(nil)
+		userRoleUC.On("RemovePermissionFromUser", mock.Anything, mock.Anything).Return(nil)
+
+		var actions []string
+		recorder := domain.PermissionChangeRecorderFunc(func(change *domain.PermissionChange) error {
+			assert.Equal(t, "admin-1", change.ActorID)
+			actions = append(actions, change.Action)
+			return nil
+		})
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		api := r.Group("/api")
+		api.Use(func(c *gin.Context) { c.Set(utils.UserIDContextKey, "admin-1") })
+		delivery.NewPermissionHandler(api.Group("/permissions"), permissionUC, roleUC, userRoleUC, nil, recorder)
+
+		routes := []struct {
+			method, path, body, action string
+		}{
+			{"POST", "/api/permissions", `{"code":"users:read","module":"users","action":"read","name":"Ver"}`, domain.ChangePermissionCreate},
+			{"PUT", "/api/permissions/p1", `{"name":"Ver usuarios"}`, domain.ChangePermissionUpdate},
+			{"DELETE", "/api/permissions/p1", "", domain.ChangePermissionDelete},
+			{"POST", "/api/permissions/code/users:read/rename", `{"new_code":"users:view"}`, domain.ChangePermissionRename},
+			{"POST", "/api/permissions/roles", `{"name":"editor"}`, domain.ChangeRoleCreate},
+			{"PUT", "/api/permissions/roles/r1", `{"description":"Edita"}`, domain.ChangeRoleUpdate},
+			{"DELETE", "/api/permissions/roles/r1", "", domain.ChangeRoleDelete},
+			{"POST", "/api/permissions/roles/r1/permissions", `{"permission_code":"users:read"}`, domain.ChangeRolePermissionAdd},
+			{"DELETE", "/api/permissions/roles/r1/permissions/users:read", "", domain.ChangeRolePermissionRemove},
+			{"PATCH", "/api/permissions/roles/r1/permissions", `{"add":["users:read"]}`, domain.ChangeRolePermissions},
+			{"PUT", "/api/permissions/roles/r1/permissions", `{"permissions":["users:read"]}`, domain.ChangeRolePermissionsSet},
+			{"POST", "/api/permissions/user-roles/assign-role", `{"user_id":"u1","role_id":"r1"}`, domain.ChangeRoleAssign},
+			{"DELETE", "/api/permissions/user-roles/remove-role", `{"user_id":"u1","role_id":"r1"}`, domain.ChangeRoleUnassign},
+			{"POST", "/api/permissions/user-roles/assign-permission", `{"user_id":"u1","permission_code":"users:read"}`, domain.ChangePermissionAssign},
+			{"DELETE", "/api/permissions/user-roles/remove-permission", `{"user_id":"u1","permission_code":"users:read"}`, domain.ChangePermissionUnassign},
+		}
+		for _, route := range routes {
+			actions = nil
+			req, _ := http.NewRequest(route.method, route.path, bytes.NewBufferString(route.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Less(t, w.Code, 300, "%s %s: %s", route.method, route.path, w.Body.String())
+			assert.Equal(t, []string{route.action}, actions, "%s %s", route.method, route.path)
+		}
+	})
+}
+
+func TestAssignRoleWithExpiry(t *testing.T) {
+	newRouter := func(userRoleUC domain.UserRoleUseCase, recorder domain.PermissionChangeRecorder) *gin.Engine {
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		delivery.NewPermissionHandler(r.Group("/api").Group("/permissions"), new(MockPermissionUseCase), new(MockRoleUseCase), userRoleUC, nil, recorder)
+		return r
+	}
+	assign := func(r *gin.Engine, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/api/permissions/user-roles/assign-role", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("recibe el vencimiento y lo registra", func(t *testing.T) {
+		expiresAt := time.Date(2030, 1, 31, 18, 0, 0, 0, time.UTC)
+		userRoleUC := new(MockUserRoleUseCase)
+		userRoleUC.On("AssignRoleToUser", mock.Anything, mock.MatchedBy(func(req *domain.AssignRoleRequest) bool {
+			return req.ExpiresAt != nil && req.ExpiresAt.Equal(expiresAt)
+		})).Return(nil)
+		var details string
+		recorder := domain.PermissionChangeRecorderFunc(func(change *domain.PermissionChange) error {
+			details = change.Details
+			return nil
+		})
+
+		w := assign(newRouter(userRoleUC, recorder), `{"user_id":"usuario-7","role_id":"rol-1","expires_at":"2030-01-31T19:00:00+01:00"}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "role=rol-1 expires_at=2030-01-31T18:00:00Z", details)
+		userRoleUC.AssertExpectations(t)
+	})
+
+	t.Run("vencimiento pasado", func(t *testing.T) {
+		userRoleUC := new(MockUserRoleUseCase)
+		userRoleUC.On("AssignRoleToUser", mock.Anything, mock.Anything).Return(domain.ErrInvalidRoleExpiry)
+
+		w := assign(newRouter(userRoleUC, nil), `{"user_id":"usuario-7","role_id":"rol-1","expires_at":"2020-01-01T00:00:00Z"}`)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), domain.ErrInvalidRoleExpiry.Error())
+	})
+
+	t.Run("vencimiento con formato inválido", func(t *testing.T) {
+		w := assign(newRouter(new(MockUserRoleUseCase), nil), `{"user_id":"usuario-7","role_id":"rol-1","expires_at":"mañana"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestGetUsersByRole(t *testing.T) {
+	newRouter := func(userRoleUC domain.UserRoleUseCase) *gin.Engine {
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		delivery.NewPermissionHandler(r.Group("/api").Group("/permissions"), new(MockPermissionUseCase), new(MockRoleUseCase), userRoleUC, utils.NewPaginator(20, 100), nil)
+		return r
+	}
+
+	t.Run("lista los usuarios del rol", func(t *testing.T) {
+		userRoleUC := new(MockUserRoleUseCase)
+		userRoleUC.On("GetUsersByRole", "rol-1", int64(2), int64(2)).Return(&domain.RoleUsersResponse{
+			RoleID:  "rol-1",
+			UserIDs: []string{"ana", "luis"},
+			Total:   5,
+		}, nil)
+
+		req, _ := http.NewRequest("GET", "/api/permissions/user-roles/by-role/rol-1?page=2&limit=2", nil)
+		w := httptest.NewRecorder()
+		newRouter(userRoleUC).ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var body struct {
+			Data domain.RoleUsersResponse `json:"data"`
+			Meta utils.PaginationMeta     `json:"pagination"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, []string{"ana", "luis"}, body.Data.UserIDs)
+		assert.Equal(t, int64(5), body.Data.Total)
+		assert.Equal(t, 2, body.Meta.Page)
+		assert.Equal(t, int64(3), body.Meta.TotalPages)
+		userRoleUC.AssertExpectations(t)
+	})
+
+	t.Run("rol inexistente", func(t *testing.T) {
+		userRoleUC := new(MockUserRoleUseCase)
+		userRoleUC.On("GetUsersByRole", "no-existe", int64(0), int64(20)).Return(nil, fmt.Errorf("obtener rol no-existe: %w", domain.ErrRoleNotFound))
+
+		req, _ := http.NewRequest("GET", "/api/permissions/user-roles/by-role/no-existe", nil)
+		w := httptest.NewRecorder()
+		newRouter(userRoleUC).ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "rol no encontrado")
+		userRoleUC.AssertExpectations(t)
+	})
+
+	t.Run("error al consultar", func(t *testing.T) {
+		userRoleUC := new(MockUserRoleUseCase)
+		userRoleUC.On("GetUsersByRole", "rol-1", int64(0), int64(20)).Return(nil, errors.New("connection refused"))
+
+		req, _ := http.NewRequest("GET", "/api/permissions/user-roles/by-role/rol-1", nil)
+		w := httptest.NewRecorder()
+		newRouter(userRoleUC).ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.NotContains(t, w.Body.String(), "connection refused")
+		userRoleUC.AssertExpectations(t)
+	})
+}
+
+func (m *MockUserRoleUseCase) GetPermissionMatrix(userIDs []string, codes []string) (domain.PermissionMatrix, error) {
+	args := m.Called(userIDs, codes)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(domain.PermissionMatrix), args.Error(1)
+}
+
+func TestGetPermissionMatrix(t *testing.T) {
+	newRouter := func(userRoleUC domain.UserRoleUseCase) *gin.Engine {
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		delivery.NewPermissionHandler(r.Group("/api").Group("/permissions"), new(MockPermissionUseCase), new(MockRoleUseCase), userRoleUC, nil, nil)
+		return r
+	}
+	send := func(r *gin.Engine, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/api/permissions/user-roles/matrix", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("matriz de varios usuarios y códigos", func(t *testing.T) {
+		userRoleUC := new(MockUserRoleUseCase)
+		userRoleUC.On("GetPermissionMatrix", []string{"ana", "luis", "eva"}, []string{"users:read", "users:write"}).Return(domain.PermissionMatrix{
+			"ana":  {"users:read": true, "users:write": false},
+			"luis": {"users:read": true, "users:write": true},
+			"eva":  {"users:read": false, "users:write": false},
+		}, nil)
+
+		w := send(newRouter(userRoleUC), `{"user_ids":["ana","luis","eva"],"permissions":["users:read","users:write"]}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var body struct {
+			Data map[string]map[string]bool `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, map[string]map[string]bool{
+			"ana":  {"users:read": true, "users:write": false},
+			"luis": {"users:read": true, "users:write": true},
+			"eva":  {"users:read": false, "users:write": false},
+		}, body.Data)
+		userRoleUC.AssertExpectations(t)
+	})
+
+	t.Run("sin códigos", func(t *testing.T) {
+		userRoleUC := new(MockUserRoleUseCase)
+		userRoleUC.On("GetPermissionMatrix", []string{"ana"}, []string(nil)).Return(domain.PermissionMatrix{"ana": {"users:read": true}}, nil)
+
+		w := send(newRouter(userRoleUC), `{"user_ids":["ana"]}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		userRoleUC.AssertExpectations(t)
+	})
+
+	t.Run("sin usuarios", func(t *testing.T) {
+		w := send(newRouter(new(MockUserRoleUseCase)), `{"user_ids":[],"permissions":["users:read"]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("demasiados usuarios", func(t *testing.T) {
+		userRoleUC := new(MockUserRoleUseCase)
+		userRoleUC.On("GetPermissionMatrix", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w (se indicaron 501)", domain.ErrMatrixTooLarge))
+
+		w := send(newRouter(userRoleUC), `{"user_ids":["ana"]}`)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), domain.ErrMatrixTooLarge.Error())
+	})
+}
+
+func TestListDateRangeFilters(t *testing.T) {
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)
+	query := "?created_from=" + from.Format(time.RFC3339) + "&created_to=" + to.Format(time.RFC3339) +
+		"&updated_from=" + from.Format(time.RFC3339)
+	expected := map[string]interface{}{
+		"created_at": bson.M{"$gte": from, "$lte": to},
+		"updated_at": bson.M{"$gte": from},
+	}
+
+	t.Run("permisos", func(t *testing.T) {
+		permissionUC := new(MockPermissionUseCase)
+		permissionUC.On("GetPermissionsPage", expected, int64(0), int64(20)).Return([]*domain.PermissionResponse{}, int64(0), nil)
+		r := newPermissionRouter(permissionUC, new(MockRoleUseCase))
+
+		req, _ := http.NewRequest("GET", "/api/permissions"+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		permissionUC.AssertExpectations(t)
+	})
+
+	t.Run("roles", func(t *testing.T) {
+		roleUC := new(MockRoleUseCase)
+		roleUC.On("GetRolesPage", expected, int64(0), int64(20)).Return([]*domain.RoleResponse{}, int64(0), nil)
+		r := newPermissionRouter(new(MockPermissionUseCase), roleUC)
+
+		req, _ := http.NewRequest("GET", "/api/permissions/roles"+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		roleUC.AssertExpectations(t)
+	})
+
+	t.Run("sin parámetros obtiene todos", func(t *testing.T) {
+		roleUC := new(MockRoleUseCase)
+		roleUC.On("GetRolesPage", map[string]interface{}{}, int64(0), int64(20)).Return([]*domain.RoleResponse{}, int64(0), nil)
+		r := newPermissionRouter(new(MockPermissionUseCase), roleUC)
+
+		req, _ := http.NewRequest("GET", "/api/permissions/roles", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		roleUC.AssertExpectations(t)
+	})
+}
+
+func TestListPagination(t *testing.T) {
+	t.Run("permisos", func(t *testing.T) {
+		permissionUC := new(MockPermissionUseCase)
+		permissionUC.On("GetPermissionsPage", map[string]interface{}{}, int64(10), int64(5)).
+			Return([]*domain.PermissionResponse{{Code: "users:read"}}, int64(12), nil)
+		r := newPermissionRouter(permissionUC, new(MockRoleUseCase))
+
+		req, _ := http.NewRequest("GET", "/api/permissions?page=3&limit=5", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"users:read"`)
+		assert.Contains(t, w.Body.String(), `"pagination":{"total":12,"page":3,"limit":5,"total_pages":3,"requested_limit":5,"max_page_size":100,"clamped":false}`)
+		permissionUC.AssertExpectations(t)
+	})
+
+	t.Run("roles con limit mayor al máximo", func(t *testing.T) {
+		roleUC := new(MockRoleUseCase)
+		roleUC.On("GetRolesPage", map[string]interface{}{}, int64(0), int64(100)).
+			Return([]*domain.RoleResponse{}, int64(0), nil)
+		r := newPermissionRouter(new(MockPermissionUseCase), roleUC)
+
+		req, _ := http.NewRequest("GET", "/api/permissions/roles?limit=1000", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"data":[]`)
+		assert.Contains(t, w.Body.String(), `"clamped":true`)
+		roleUC.AssertExpectations(t)
+	})
+}
+
+func TestRenamePermissionCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		body   string
+	}{
+		{"éxito", nil, http.StatusOK, `"roles_updated":2`},
+		{"permiso inexistente", fmt.Errorf("renombrar permiso users:raed: %w", domain.ErrPermissionNotFound), http.StatusNotFound, "Permiso no encontrado"},
+		{"código en uso", domain.ErrPermissionCodeExists, http.StatusUnprocessableEntity, domain.ErrPermissionCodeExists.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			permissionUC := new(MockPermissionUseCase)
+			if tt.err != nil {
+				permissionUC.On("RenamePermissionCode", mock.Anything, "users:raed", "users:read").Return(nil, tt.err)
+			} else {
+				permissionUC.On("RenamePermissionCode", mock.Anything, "users:raed", "users:read").Return(&domain.PermissionRenameResult{
+					OldCode: "users:raed", NewCode: "users:read", RolesUpdated: 2, UserRolesUpdated: 5,
+				}, nil)
+			}
+			r := newPermissionRouter(permissionUC, new(MockRoleUseCase))
+
+			req, _ := http.NewRequest("POST", "/api/permissions/code/users:raed/rename", bytes.NewBufferString(`{"new_code":"users:read"}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Contains(t, w.Body.String(), tt.body)
+			permissionUC.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDeletePermission(t *testing.T) {
+	inUse := &domain.PermissionInUseError{
+		Code:                 "users:read",
+		PermissionReferences: domain.PermissionReferences{Roles: []string{"editor", "viewer"}},
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		force  bool
+		err    error
+		status int
+		body   string
+	}{
+		{"éxito", "", false, nil, http.StatusOK, `"code":"users:read"`},
+		{"en uso", "", false, fmt.Errorf("eliminar permiso: %w", inUse), http.StatusUnprocessableEntity, "asignado a los roles editor, viewer"},
+		{"forzado", "?force=true", true, nil, http.StatusOK, `"roles_updated":2`},
+		{"permiso inexistente", "?force=true", true, domain.ErrPermissionNotFound, http.StatusNotFound, "Permiso no encontrado"},
+		{"cascada sin registro de auditoría", "?force=true", true, fmt.Errorf("%w: sin conexión", domain.ErrAuditFailed), http.StatusInternalServerError, `"code":"audit_failed"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			permissionUC := new(MockPermissionUseCase)
+			if tt.err != nil {
+				permissionUC.On("DeletePermission", mock.Anything, "perm-1", tt.force).Return(nil, tt.err)
+			} else {
+				result := &domain.PermissionDeleteResult{Code: "users:read"}
+				if tt.force {
+					result.RolesUpdated, result.UserRolesUpdated = 2, 1
+				}
+				permissionUC.On("DeletePermission", mock.Anything, "perm-1", tt.force).Return(result, nil)
+			}
+			r := newPermissionRouter(permissionUC, new(MockRoleUseCase))
+
+			req, _ := http.NewRequest("DELETE", "/api/permissions/perm-1"+tt.query, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Contains(t, w.Body.String(), tt.body)
+			permissionUC.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPermissionHandlerValidationStatusCodes(t *testing.T) {
+	createBody := `{"code": "users:read", "name": "Ver usuarios", "module": "users", "action": "read"}`
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		setup      func(p *MockPermissionUseCase, r *MockRoleUseCase)
+		wantStatus int
+	}{
+		{
+			name:       "JSON mal formado",
+			method:     "POST",
+			path:       "/api/permissions",
+			body:       `{"code": `,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "código duplicado",
+			method: "POST",
+			path:   "/api/permissions",
+			body:   createBody,
+			setup: func(p *MockPermissionUseCase, r *MockRoleUseCase) {
+				p.On("CreatePermission", mock.Anything, mock.Anything).Return(nil, domain.ErrPermissionCodeExists)
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "código fuera de convención",
+			method: "POST",
+			path:   "/api/permissions",
+			body:   createBody,
+			setup: func(p *MockPermissionUseCase, r *MockRoleUseCase) {
+				p.On("CreatePermission", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w: Users", domain.ErrMalformedPermission))
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "permiso inexistente al añadirlo a un rol",
+			method: "POST",
+			path:   "/api/permissions/roles/rol-1/permissions",
+			body:   `{"permission_code": "users:fly"}`,
+			setup: func(p *MockPermissionUseCase, r *MockRoleUseCase) {
+				r.On("AddPermissionToRole", mock.Anything, "rol-1", "users:fly").Return(fmt.Errorf("%w: no encontrado", domain.ErrInvalidPermission))
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "delta de permisos vacío",
+			method:     "PATCH",
+			path:       "/api/permissions/roles/rol-1/permissions",
+			body:       `{"add": [], "remove": []}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "delta de permisos sobre un rol de sistema",
+			method: "PATCH",
+			path:   "/api/permissions/roles/rol-1/permissions",
+			body:   `{"add": ["users:read"]}`,
+			setup: func(p *MockPermissionUseCase, r *MockRoleUseCase) {
+				r.On("UpdateRolePermissions", mock.Anything, "rol-1", mock.Anything).Return(nil, domain.ErrSystemRoleImmutable)
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "reemplazo de permisos sin la lista",
+			method:     "PUT",
+			path:       "/api/permissions/roles/rol-1/permissions",
+			body:       `{}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "reemplazo de permisos con un código inexistente",
+			method: "PUT",
+			path:   "/api/permissions/roles/rol-1/permissions",
+			body:   `{"permissions": ["users:read", "users:fly"]}`,
+			setup: func(p *MockPermissionUseCase, r *MockRoleUseCase) {
+				r.On("SetRolePermissions", mock.Anything, "rol-1", []string{"users:read", "users:fly"}).Return(nil, fmt.Errorf("%w: users:fly", domain.ErrInvalidPermission))
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "los errores no clasificados responden 500",
+			method: "POST",
+			path:   "/api/permissions",
+			body:   createBody,
+			setup: func(p *MockPermissionUseCase, r *MockRoleUseCase) {
+				p.On("CreatePermission", mock.Anything, mock.Anything).Return(nil, errors.New("conexión perdida"))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:   "rol inexistente al añadirle un permiso",
+			method: "POST",
+			path:   "/api/permissions/roles/rol-1/permissions",
+			body:   `{"permission_code": "users:read"}`,
+			setup: func(p *MockPermissionUseCase, r *MockRoleUseCase) {
+				r.On("AddPermissionToRole", mock.Anything, "rol-1", "users:read").Return(fmt.Errorf("obtener rol rol-1: %w", domain.ErrRoleNotFound))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:   "permiso inexistente",
+			method: "GET",
+			path:   "/api/permissions/perm-1",
+			setup: func(p *MockPermissionUseCase, r *MockRoleUseCase) {
+				p.On("GetPermission", "perm-1").Return(nil, fmt.Errorf("obtener permiso perm-1: %w", domain.ErrPermissionNotFound))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:   "error al consultar un permiso",
+			method: "GET",
+			path:   "/api/permissions/perm-1",
+			setup: func(p *MockPermissionUseCase, r *MockRoleUseCase) {
+				p.On("GetPermission", "perm-1").Return(nil, fmt.Errorf("obtener permiso perm-1: %w", errors.New("connection refused")))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:   "rol inexistente",
+			method: "GET",
+			path:   "/api/permissions/roles/rol-1",
+			setup: func(p *MockPermissionUseCase, r *MockRoleUseCase) {
+				r.On("GetRole", "rol-1").Return(nil, domain.ErrRoleNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:   "error al consultar un rol por nombre",
+			method: "GET",
+			path:   "/api/permissions/roles/name/editor",
+			setup: func(p *MockPermissionUseCase, r *MockRoleUseCase) {
+				r.On("GetRoleByName", "editor").Return(nil, errors.New("connection refused"))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			permissionUC := new(MockPermissionUseCase)
+			roleUC := new(MockRoleUseCase)
+			if tt.setup != nil {
+				tt.setup(permissionUC, roleUC)
+			}
+
+			r := newPermissionRouter(permissionUC, roleUC)
+
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+
+			var response map[string]interface{}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, "error", response["status"])
+			permissionUC.AssertExpectations(t)
+			roleUC.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAdminScopeOutOfScope(t *testing.T) {
+	scope := domain.NewAdminScope([]string{domain.AdminScopePrefix + "finanzas"})
+	roleUC := new(MockRoleUseCase)
+	roleUC.On("AddPermissionToRole", scope, "rol-1", "users:read").
+		Return(fmt.Errorf("%w: users:read", domain.ErrOutOfAdminScope))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	api := r.Group("/api/permissions")
+	// Simula PermissionMiddleware.ResolveAdminScope
+	api.Use(func(c *gin.Context) {
+		c.Set(domain.AdminScopeContextKey, scope)
+		c.Next()
+	})
+	delivery.NewPermissionHandler(api, new(MockPermissionUseCase), roleUC, nil, nil, nil)
+
+	req, _ := http.NewRequest("POST", "/api/permissions/roles/rol-1/permissions", bytes.NewBufferString(`{"permission_code": "users:read"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), domain.ErrOutOfAdminScope.Error())
+	assert.NotContains(t, w.Body.String(), "users:read", "el detalle interno no se expone")
+	roleUC.AssertExpectations(t)
+}
@@ -0,0 +1,54 @@
+package domain
+
+// Acciones con las que se registran los cambios de permisos, roles y asignaciones
+const (
+	ChangePermissionCreate     = "permission.create"
+	ChangePermissionUpdate     = "permission.update"
+	ChangePermissionDelete     = "permission.delete"
+	ChangePermissionRename     = "permission.rename"
+	ChangeRoleCreate           = "role.create"
+	ChangeRoleUpdate           = "role.update"
+	ChangeRoleDelete           = "role.delete"
+	ChangeRolePermissionAdd    = "role.permission_add"
+	ChangeRolePermissionRemove = "role.permission_remove"
+	ChangeRolePermissions      = "role.permissions_update" // Altas y bajas en lote
+	ChangeRolePermissionsSet   = "role.permissions_set"    // Reemplazo del conjunto completo
+	ChangeRoleAssign           = "role.assign"
+	ChangeRoleUnassign         = "role.unassign"
+	ChangePermissionAssign     = "permission.assign"
+	ChangePermissionUnassign   = "permission.unassign"
+
+	// Cambios aplicados por el sistema, registrados con SystemActor
+	ChangeRoleUnassignAll   = "role.unassign_all"         // Limpieza de asignaciones al eliminar un rol
+	ChangePermissionCascade = "permission.cascade_remove" // Eliminación forzada de un permiso en uso
+	ChangeRoleExpire        = "role.expire"               // Barrido de roles vencidos
+	ChangeUserRolesClear    = "user_role.clear"           // Cuenta archivada o cerrada: se vacía su asignación
+	ChangeUserRolesDelete   = "user_role.delete"          // Usuario borrado: se elimina su asignación
+)
+
+// SystemActor es el actor de los cambios que no solicita directamente un usuario: los scripts de
+// inicialización y del manifiesto, los roles por defecto, el barrido de roles vencidos y los
+// efectos en cascada de una eliminación (cuyo autor consta en la entrada de la eliminación)
+const SystemActor = "system"
+
+// PermissionChange describe un cambio ya aplicado sobre permisos, roles o asignaciones
+type PermissionChange struct {
+	ActorID string // Usuario (o "apikey:<id>", o SystemActor) que realizó el cambio
+	Action  string // Una de las constantes Change*
+	Target  string // Recurso afectado, ej. "user:<id>", "role:<id>" o "permission:<código>"
+	Details string // Información adicional opcional, ej. "role=<id>"
+}
+
+// PermissionChangeRecorder registra los cambios de permisos, roles y asignaciones (ej. en el
+// registro de auditoría). Un error indica que el cambio se aplicó pero no quedó registrado.
+type PermissionChangeRecorder interface {
+	RecordPermissionChange(change *PermissionChange) error
+}
+
+// PermissionChangeRecorderFunc adapta una función a PermissionChangeRecorder
+type PermissionChangeRecorderFunc func(change *PermissionChange) error
+
+// RecordPermissionChange llama a f(change)
+func (f PermissionChangeRecorderFunc) RecordPermissionChange(change *PermissionChange) error {
+	return f(change)
+}
@@ -1,11 +1,112 @@
 package domain
 
 import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// Errores comunes del módulo de permisos. Los casos de uso los retornan directamente o
+// envueltos junto con la causa original; compárelos con errors.Is.
+var (
+	ErrPermissionCodeExists = errors.New("ya existe un permiso con este código")
+	ErrPermissionNotFound   = errors.New("permiso no encontrado")
+	ErrInvalidPermission    = errors.New("permiso no válido")
+	ErrRoleNameExists       = errors.New("ya existe un rol con este nombre")
+	ErrInvalidRole          = errors.New("rol no válido")
+	ErrRoleNotFound         = errors.New("rol no encontrado")
+	ErrSystemRoleImmutable  = errors.New("no se puede modificar un rol de sistema")
+	ErrMalformedPermission  = errors.New("el código de permiso no sigue la convención modulo:accion")
+	ErrConflictingDelta     = errors.New("un permiso no puede añadirse y eliminarse en la misma operación")
+	ErrRoleInUse            = errors.New("el rol está asignado a usuarios")
+	ErrPermissionInUse      = errors.New("el permiso está asignado a roles o usuarios")
+	ErrOutOfAdminScope      = errors.New("la operación incluye módulos fuera de su ámbito de administración")
+	ErrRoleInheritanceCycle = errors.New("la herencia de roles formaría un ciclo")
+	ErrInvalidRoleExpiry    = errors.New("el vencimiento del rol debe ser una fecha futura")
+	ErrAuditFailed          = errors.New("el cambio se aplicó pero no pudo registrarse en la auditoría")
+	ErrMatrixTooLarge       = fmt.Errorf("la matriz de permisos admite como máximo %d usuarios", MaxPermissionMatrixUsers)
 )
 
+// AdminScopePrefix es el prefijo de los permisos que delegan la administración de un módulo
+// (ej. "admin:scope:finanzas"). Un administrador con al menos uno de ellos solo puede gestionar
+// permisos, roles y asignaciones de esos módulos; "admin:scope:*" equivale a no tener restricción.
+const AdminScopePrefix = "admin:scope:"
+
+// AdminScopeContextKey es la clave del contexto de Gin donde el middleware de permisos guarda
+// el *AdminScope de quien hace la solicitud
+const AdminScopeContextKey = "adminScope"
+
+// AdminScope es el conjunto de módulos que un administrador delegado puede gestionar.
+// Un ámbito nil no tiene restricción.
+type AdminScope struct {
+	modules map[string]bool
+}
+
+// NewAdminScope obtiene el ámbito a partir de los permisos efectivos del administrador.
+// Retorna nil si no tiene permisos de ámbito o si alguno es "admin:scope:*".
+func NewAdminScope(permissions []string) *AdminScope {
+	modules := make(map[string]bool)
+	for _, p := range permissions {
+		module, ok := strings.CutPrefix(p, AdminScopePrefix)
+		if !ok || module == "" {
+			continue
+		}
+		if module == "*" {
+			return nil
+		}
+		modules[module] = true
+	}
+	if len(modules) == 0 {
+		return nil
+	}
+	return &AdminScope{modules: modules}
+}
+
+// AllowsModule indica si el módulo está dentro del ámbito
+func (s *AdminScope) AllowsModule(module string) bool {
+	return s == nil || s.modules[module]
+}
+
+// Check retorna ErrOutOfAdminScope si algún código pertenece a un módulo fuera del ámbito. El
+// módulo de un código es su primer segmento, también en comodines (ej. "finanzas:*").
+func (s *AdminScope) Check(codes ...string) error {
+	if s == nil {
+		return nil
+	}
+	for _, code := range codes {
+		module, _, _ := strings.Cut(code, ":")
+		if !s.modules[module] {
+			return fmt.Errorf("%w: %s", ErrOutOfAdminScope, code)
+		}
+	}
+	return nil
+}
+
+// permissionSegmentPattern define un segmento válido de un código de permiso (ej. "finanzas", "data_import")
+var permissionSegmentPattern = regexp.MustCompile(`^[a-z0-9]+([_-][a-z0-9]+)*$`)
+
+// ValidatePermissionCode verifica que un código siga la convención "modulo:accion" o
+// "modulo:submodulo:accion": al menos dos segmentos en minúsculas separados por ":".
+// Los comodines ("modulo:*") no son códigos de permiso válidos.
+func ValidatePermissionCode(code string) error {
+	segments := strings.Split(code, ":")
+	if len(segments) < 2 {
+		return fmt.Errorf("%w: %q requiere al menos módulo y acción", ErrMalformedPermission, code)
+	}
+	for _, segment := range segments {
+		if !permissionSegmentPattern.MatchString(segment) {
+			return fmt.Errorf("%w: segmento %q no válido en %q", ErrMalformedPermission, segment, code)
+		}
+	}
+	return nil
+}
+
 // Permission representa un permiso individual en el sistema
 // Permission representa la entidad de permission
 // @Description Entidad completa de permission
@@ -25,11 +126,13 @@ type PermissionRepository interface {
 	GetByID(id string) (*Permission, error)
 	GetByCode(code string) (*Permission, error)
 	GetByModule(module string) ([]*Permission, error)
-	GetAll() ([]*Permission, error)
+	GetAll(params map[string]interface{}) ([]*Permission, error)                            // params vacío obtiene todos
+	GetPage(params map[string]interface{}, skip, limit int64) ([]*Permission, int64, error) // Página de resultados y total
 	Create(permission *Permission) error
 	Update(permission *Permission) error
 	Delete(id string) error
 	GetByCodesArray(codes []string) ([]*Permission, error)
+	GetExistingCodes(codes []string) ([]string, error)
 }
 
 // CreatePermissionRequest representa la solicitud para crear un permiso
@@ -51,18 +154,120 @@ type UpdatePermissionRequest struct {
 	Description string `json:"description"`
 }
 
+// RenamePermissionCodeRequest representa la solicitud para cambiar el código de un permiso
+type RenamePermissionCodeRequest struct {
+	NewCode string `json:"new_code" binding:"required"`
+}
+
+// PermissionRenameResult resume un cambio de código y cuántas referencias se reescribieron
+type PermissionRenameResult struct {
+	OldCode          string `json:"old_code"`
+	NewCode          string `json:"new_code"`
+	RolesUpdated     int64  `json:"roles_updated"`
+	UserRolesUpdated int64  `json:"user_roles_updated"`
+}
+
+// PermissionCodeRenamer cambia el código de un permiso y reescribe sus referencias en roles y
+// asignaciones de usuario de forma atómica. Retorna ErrPermissionNotFound si oldCode no existe
+// y ErrPermissionCodeExists si newCode ya está en uso.
+type PermissionCodeRenamer interface {
+	RenameCode(oldCode, newCode string) (*PermissionRenameResult, error)
+}
+
+// PermissionReferences son los roles y asignaciones de usuario que incluyen un código de permiso.
+// Los comodines ("modulo:*") no cuentan como referencias.
+type PermissionReferences struct {
+	Roles           []string `json:"roles"`            // Nombres de los roles, ordenados
+	UserAssignments int64    `json:"user_assignments"` // Asignaciones que lo incluyen como permiso específico
+}
+
+// InUse indica si algún rol o asignación de usuario referencia el código
+func (r PermissionReferences) InUse() bool {
+	return len(r.Roles) > 0 || r.UserAssignments > 0
+}
+
+// PermissionInUseError se retorna al eliminar sin force un permiso que sigue referenciado.
+// errors.Is lo reconoce como ErrPermissionInUse.
+type PermissionInUseError struct {
+	Code string
+	PermissionReferences
+}
+
+// Error enumera las referencias, ej. "el permiso users:read está asignado a los roles editor,
+// viewer y a 2 asignaciones de usuario"
+func (e *PermissionInUseError) Error() string {
+	var parts []string
+	if len(e.Roles) > 0 {
+		parts = append(parts, "a los roles "+strings.Join(e.Roles, ", "))
+	}
+	if e.UserAssignments > 0 {
+		parts = append(parts, fmt.Sprintf("a %d asignaciones de usuario", e.UserAssignments))
+	}
+	return fmt.Sprintf("el permiso %s está asignado %s", e.Code, strings.Join(parts, " y "))
+}
+
+// Is permite usar errors.Is(err, ErrPermissionInUse)
+func (e *PermissionInUseError) Is(target error) bool {
+	return target == ErrPermissionInUse
+}
+
+// PermissionDeleteResult resume la eliminación de un permiso y de cuántos roles y asignaciones
+// de usuario se quitó
+type PermissionDeleteResult struct {
+	Code             string `json:"code"`
+	RolesUpdated     int64  `json:"roles_updated"`
+	UserRolesUpdated int64  `json:"user_roles_updated"`
+}
+
+// PermissionReferenceRemover consulta las referencias a un código de permiso y elimina el
+// permiso quitándolo de roles y asignaciones de usuario de forma atómica. DeleteCode y
+// DeleteUnreferenced retornan ErrPermissionNotFound si el código no existe.
+type PermissionReferenceRemover interface {
+	FindReferences(code string) (*PermissionReferences, error)
+	DeleteCode(code string) (*PermissionDeleteResult, error)
+	// DeleteUnreferenced elimina el permiso solo si nada lo referencia; si no, retorna
+	// *PermissionInUseError. La consulta y la eliminación son atómicas.
+	DeleteUnreferenced(code string) error
+}
+
+// PermissionCacheInvalidator descarta los permisos en caché de todos los usuarios, para los
+// cambios que pueden alterar los permisos efectivos de muchos usuarios a la vez
+type PermissionCacheInvalidator interface {
+	InvalidatePermissionCache()
+}
+
+// ValidateCodesRequest representa la solicitud para validar un lote de códigos de permiso
+type ValidateCodesRequest struct {
+	Codes []string `json:"codes" binding:"required"`
+}
+
+// MalformedCode describe un código que no sigue la convención y el motivo
+type MalformedCode struct {
+	Code   string `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// CodeValidationReport clasifica un lote de códigos de permiso.
+// Existing son códigos válidos registrados, Missing son códigos válidos sin registrar
+// y Malformed son códigos que no siguen la convención (no se consultan).
+type CodeValidationReport struct {
+	Existing  []string        `json:"existing"`
+	Missing   []string        `json:"missing"`
+	Malformed []MalformedCode `json:"malformed"`
+}
+
 // PermissionResponse representa la respuesta con datos de permisos
 // PermissionResponse representa la respuesta con datos de permission
 // @Description Estructura de respuesta para información de permission
 type PermissionResponse struct {
-	ID          string    `json:"id"`
-	Code        string    `json:"code"`
-	Module      string    `json:"module"`
-	Action      string    `json:"action"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          string          `json:"id"`
+	Code        string          `json:"code"`
+	Module      string          `json:"module"`
+	Action      string          `json:"action"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	CreatedAt   utils.Timestamp `json:"created_at"`
+	UpdatedAt   utils.Timestamp `json:"updated_at"`
 }
 
 // PermissionUseCase define el contrato para la capa de caso de uso de permisos
@@ -70,10 +275,18 @@ type PermissionUseCase interface {
 	GetPermission(id string) (*PermissionResponse, error)
 	GetPermissionByCode(code string) (*PermissionResponse, error)
 	GetPermissionsByModule(module string) ([]*PermissionResponse, error)
-	GetAllPermissions() ([]*PermissionResponse, error)
-	CreatePermission(req *CreatePermissionRequest) (*PermissionResponse, error)
-	UpdatePermission(id string, req *UpdatePermissionRequest) (*PermissionResponse, error)
-	DeletePermission(id string) error
+	GetAllPermissions(params map[string]interface{}) ([]*PermissionResponse, error)
+	GetPermissionsPage(params map[string]interface{}, skip, limit int64) ([]*PermissionResponse, int64, error)
+	// Las operaciones de gestión reciben el ámbito del administrador que las ejecuta; un ámbito
+	// nil (administrador sin restricción, scripts, procesos internos) no limita la operación
+	CreatePermission(scope *AdminScope, req *CreatePermissionRequest) (*PermissionResponse, error)
+	UpdatePermission(scope *AdminScope, id string, req *UpdatePermissionRequest) (*PermissionResponse, error)
+	// DeletePermission rechaza con *PermissionInUseError un permiso referenciado por roles o
+	// asignaciones de usuario; con force lo quita de todos ellos
+	DeletePermission(scope *AdminScope, id string, force bool) (*PermissionDeleteResult, error)
 	HasPermission(userID string, permissionCode string) (bool, error)
 	GetPermissionsByCodesArray(codes []string) ([]*PermissionResponse, error)
+	ValidateCodes(codes []string) (*CodeValidationReport, error)
+	// RenamePermissionCode cambia el código de un permiso y reescribe sus referencias
+	RenamePermissionCode(scope *AdminScope, oldCode, newCode string) (*PermissionRenameResult, error)
 }
@@ -1,9 +1,12 @@
 package domain
 
 import (
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
 )
 
 // Role representa un rol que agrupa múltiples permisos
@@ -11,8 +14,10 @@ type Role struct {
 	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	Name        string             `json:"name" bson:"name"`
 	Description string             `json:"description" bson:"description"`
-	Permissions []string           `json:"permissions" bson:"permissions"` // Lista de códigos de permisos
-	IsSystem    bool               `json:"is_system" bson:"is_system"`     // Indica si es un rol de sistema (no modificable)
+	Permissions []string           `json:"permissions" bson:"permissions"`                       // Lista de códigos de permisos
+	ParentRoles []string           `json:"parent_roles,omitempty" bson:"parent_roles,omitempty"` // IDs de los roles cuyos permisos hereda
+	IsSystem    bool               `json:"is_system" bson:"is_system"`                           // Indica si es un rol de sistema (no modificable)
+	Version     int64              `json:"version" bson:"version"`                               // Versión para control de concurrencia optimista
 	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
 }
@@ -25,50 +30,277 @@ type UserRole struct {
 	Permissions []string           `json:"permissions" bson:"permissions"` // Permisos específicos adicionales
 	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+
+	// EffectivePermissions es el conjunto materializado de permisos (roles + específicos);
+	// nil si debe recalcularse. Toda modificación de la asignación o de sus roles lo descarta
+	// e incrementa EffectiveRevision, que evita guardar un conjunto calculado con datos viejos.
+	EffectivePermissions []string `json:"-" bson:"effective_permissions"`
+	EffectiveRevision    int64    `json:"-" bson:"effective_revision"`
+
+	// RoleExpirations contiene el vencimiento de los roles asignados por tiempo limitado; un rol
+	// sin entrada no vence. Un rol vencido deja de otorgar permisos aunque siga en Roles hasta
+	// que UserRoleRepository.RemoveExpiredRoles lo quite.
+	RoleExpirations []RoleExpiration `json:"role_expirations,omitempty" bson:"role_expirations,omitempty"`
+}
+
+// RoleExpiration es el vencimiento de un rol asignado a un usuario
+type RoleExpiration struct {
+	RoleID    string    `json:"role_id" bson:"role_id"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+// RoleExpiresAt retorna el vencimiento del rol en la asignación, o nil si no vence
+func (ur *UserRole) RoleExpiresAt(roleID string) *time.Time {
+	for _, expiration := range ur.RoleExpirations {
+		if expiration.RoleID == roleID {
+			expiresAt := expiration.ExpiresAt
+			return &expiresAt
+		}
+	}
+	return nil
+}
+
+// ActiveRoles retorna los roles asignados que no vencieron en now, en el orden de asignación
+func (ur *UserRole) ActiveRoles(now time.Time) []string {
+	if len(ur.RoleExpirations) == 0 {
+		return ur.Roles
+	}
+
+	active := make([]string, 0, len(ur.Roles))
+	for _, roleID := range ur.Roles {
+		if expiresAt := ur.RoleExpiresAt(roleID); expiresAt == nil || now.Before(*expiresAt) {
+			active = append(active, roleID)
+		}
+	}
+	return active
+}
+
+// ExpiredRoles retorna los roles asignados que vencieron en now
+func (ur *UserRole) ExpiredRoles(now time.Time) []string {
+	var expired []string
+	for _, roleID := range ur.Roles {
+		if expiresAt := ur.RoleExpiresAt(roleID); expiresAt != nil && !now.Before(*expiresAt) {
+			expired = append(expired, roleID)
+		}
+	}
+	return expired
+}
+
+// EffectivePermissionsRebuildResult resume la reconstrucción de los permisos materializados
+type EffectivePermissionsRebuildResult struct {
+	Rebuilt int64 `json:"rebuilt"` // Asignaciones cuyo conjunto se recalculó
+}
+
+// RoleLookup obtiene varios roles por ID omitiendo los que no existen (ver RoleRepository.GetByIDs)
+type RoleLookup func(ids []string) ([]*Role, error)
+
+// WithAncestorRoles retorna los roles junto con todos los roles de los que heredan, directa o
+// indirectamente, sin duplicados y del más cercano al más lejano. Un rol ya visitado no se
+// vuelve a recorrer, de modo que un ciclo (A→B→A) termina; los padres inexistentes se ignoran.
+func WithAncestorRoles(roles []*Role, lookup RoleLookup) ([]*Role, error) {
+	visited := make(map[string]bool, len(roles))
+	result := make([]*Role, 0, len(roles))
+
+	pending := roles
+	for len(pending) > 0 {
+		var parentIDs []string
+		for _, role := range pending {
+			id := role.ID.Hex()
+			if visited[id] {
+				continue
+			}
+			visited[id] = true
+			result = append(result, role)
+			for _, parentID := range role.ParentRoles {
+				if !visited[parentID] {
+					parentIDs = append(parentIDs, parentID)
+				}
+			}
+		}
+		if len(parentIDs) == 0 {
+			break
+		}
+
+		parents, err := lookup(parentIDs)
+		if err != nil {
+			return nil, err
+		}
+		pending = parents
+	}
+
+	return result, nil
+}
+
+// RoleDescendants retorna los IDs de los roles de all que heredan de roleID, directa o
+// indirectamente (sin incluir roleID). Tolera ciclos igual que WithAncestorRoles.
+func RoleDescendants(all []*Role, roleID string) []string {
+	visited := map[string]bool{roleID: true}
+	descendants := []string{}
+
+	pending := []string{roleID}
+	for len(pending) > 0 {
+		parentID := pending[0]
+		pending = pending[1:]
+		for _, role := range all {
+			id := role.ID.Hex()
+			if visited[id] {
+				continue
+			}
+			for _, p := range role.ParentRoles {
+				if p == parentID {
+					visited[id] = true
+					descendants = append(descendants, id)
+					pending = append(pending, id)
+					break
+				}
+			}
+		}
+	}
+
+	return descendants
+}
+
+// RolePermissionCodes retorna sin duplicados los permisos directos de los roles
+func RolePermissionCodes(roles []*Role) []string {
+	seen := make(map[string]bool)
+	codes := []string{}
+	for _, role := range roles {
+		for _, p := range role.Permissions {
+			if !seen[p] {
+				seen[p] = true
+				codes = append(codes, p)
+			}
+		}
+	}
+	return codes
+}
+
+// RoleDeletePolicy define qué ocurre con las asignaciones de usuario al eliminar un rol
+type RoleDeletePolicy string
+
+const (
+	RoleDeleteCleanup RoleDeletePolicy = "cleanup" // Quita el rol de todas las asignaciones (por defecto)
+	RoleDeleteBlock   RoleDeletePolicy = "block"   // Impide eliminar un rol mientras esté asignado
+)
+
+// RoleDeleter elimina un rol comprobando sus asignaciones en la misma transacción, para la
+// política RoleDeleteBlock
+type RoleDeleter interface {
+	// DeleteUnassigned elimina el rol si ninguna asignación de usuario lo incluye; si no, retorna
+	// un error que envuelve ErrRoleInUse. Retorna ErrRoleNotFound si el rol no existe.
+	DeleteUnassigned(roleID string) error
+}
+
+// ParseRoleDeletePolicy convierte el valor de configuración en una política; los valores
+// desconocidos usan la limpieza de asignaciones
+func ParseRoleDeletePolicy(value string) RoleDeletePolicy {
+	if RoleDeletePolicy(strings.ToLower(strings.TrimSpace(value))) == RoleDeleteBlock {
+		return RoleDeleteBlock
+	}
+	return RoleDeleteCleanup
 }
 
 // RoleRepository define el contrato para la capa de persistencia de roles
 type RoleRepository interface {
 	GetByID(id string) (*Role, error)
+	GetByIDs(ids []string) ([]*Role, error) // Obtiene varios roles en una sola consulta; omite los que no existen
 	GetByName(name string) (*Role, error)
-	GetAll() ([]*Role, error)
+	GetAll(params map[string]interface{}) ([]*Role, error)                            // params vacío obtiene todos
+	GetPage(params map[string]interface{}, skip, limit int64) ([]*Role, int64, error) // Página de resultados y total
 	Create(role *Role) error
 	Update(role *Role) error
 	Delete(id string) error
 	AddPermission(roleID string, permissionCode string) error
 	RemovePermission(roleID string, permissionCode string) error
+	ApplyPermissionDelta(roleID string, add []string, remove []string) (*Role, error) // Aplica altas y bajas en una sola operación atómica
+	ReplacePermissions(roleID string, codes []string) (*Role, error)                  // Reemplaza el conjunto completo en una sola operación atómica
 }
 
 // UserRoleRepository define el contrato para la capa de persistencia de asignaciones usuario-rol
 type UserRoleRepository interface {
 	GetByUserID(userID string) (*UserRole, error)
+	// FindByUserID obtiene la asignación del usuario sin crearla: sin asignación retorna una vacía
+	// que no se guarda (para consultas de solo lectura)
+	FindByUserID(userID string) (*UserRole, error)
 	Create(userRole *UserRole) error
 	Update(userRole *UserRole) error
 	Delete(id string) error
+	DeleteByUserID(userID string) error // Elimina la asignación del usuario, si existe
 	AddRole(userID string, roleID string) error
+	// AddRoleWithExpiry asigna el rol como AddRole; con expiresAt deja de otorgar permisos en esa
+	// fecha. Un rol ya vencido se puede volver a asignar, con o sin vencimiento.
+	AddRoleWithExpiry(userID string, roleID string, expiresAt *time.Time) error
 	RemoveRole(userID string, roleID string) error
 	AddPermission(userID string, permissionCode string) error
 	RemovePermission(userID string, permissionCode string) error
 	GetUserPermissions(userID string) ([]string, error) // Devuelve todos los permisos de un usuario (roles + específicos)
+	CountByRole(roleID string) (int64, error)           // Cuenta las asignaciones que incluyen el rol
+	RemoveRoleFromAll(roleID string) (int64, error)     // Quita el rol de todas las asignaciones; retorna cuántas cambiaron
+	RemoveExpiredRoles(now time.Time) (int64, error)    // Quita los roles vencidos en now; retorna cuántas asignaciones cambiaron
+	// GetUsersByRole retorna una página de los IDs de los usuarios con el rol vigente, ordenados, y el total
+	GetUsersByRole(roleID string, skip, limit int64) ([]string, int64, error)
+	// EnsureForUser crea la asignación con roleIDs si no existe, en un único upsert; true si fue
+	// creada. Una asignación existente no se modifica.
+	EnsureForUser(userID string, roleIDs ...string) (bool, error)
+	// EnsureForUsers crea en una sola escritura las asignaciones que falten, con roleIDs; retorna
+	// los usuarios cuya asignación se creó
+	EnsureForUsers(userIDs []string, roleIDs ...string) ([]string, error)
+
+	// GetPermissionsByUserIDs devuelve los permisos de varios usuarios con una consulta de
+	// asignaciones y una de roles por nivel de herencia; los usuarios sin asignación tienen una
+	// lista vacía
+	GetPermissionsByUserIDs(userIDs []string) (map[string][]string, error)
+
+	// Permisos efectivos materializados
+	InvalidateEffectivePermissions(roleIDs ...string) (int64, error) // Descarta el conjunto de las asignaciones que incluyen alguno de los roles
+	RebuildEffectivePermissions() (int64, error)                     // Recalcula y guarda el conjunto de todas las asignaciones
+}
+
+// RoleUsersResponse representa los usuarios que tienen asignado un rol
+// @Description Usuarios con un rol asignado
+type RoleUsersResponse struct {
+	RoleID  string   `json:"role_id" example:"60f1e5e5e5e5e5e5e5e5e5e5"`
+	UserIDs []string `json:"user_ids"`          // IDs de los usuarios de la página, ordenados
+	Total   int64    `json:"total" example:"2"` // Total de usuarios con el rol
 }
 
 // CreateRoleRequest representa la solicitud para crear un rol
 type CreateRoleRequest struct {
 	Name        string   `json:"name" binding:"required"`
 	Description string   `json:"description"`
-	Permissions []string `json:"permissions"` // Lista de códigos de permisos
+	Permissions []string `json:"permissions"`  // Lista de códigos de permisos
+	ParentRoles []string `json:"parent_roles"` // IDs de los roles cuyos permisos hereda
 }
 
 // UpdateRoleRequest representa la solicitud para actualizar un rol
 type UpdateRoleRequest struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	// ParentRoles reemplaza los roles de los que hereda; sin el campo no cambian y [] los quita
+	ParentRoles []string `json:"parent_roles"`
+
+	// ExpectedVersion, si se indica, exige que el rol guardado tenga esa versión (412 si no)
+	ExpectedVersion *int64 `json:"expected_version"`
+	// UnmodifiedSince se toma de la cabecera If-Unmodified-Since
+	UnmodifiedSince *time.Time `json:"-"`
+}
+
+// UpdateRolePermissionsRequest representa la solicitud para añadir y quitar permisos de un rol en una sola llamada
+type UpdateRolePermissionsRequest struct {
+	Add    []string `json:"add"`    // Códigos de permisos a añadir
+	Remove []string `json:"remove"` // Códigos de permisos a quitar
+}
+
+// SetRolePermissionsRequest representa la solicitud para reemplazar todos los permisos de un rol
+type SetRolePermissionsRequest struct {
+	Permissions []string `json:"permissions" binding:"required"` // Conjunto completo de códigos; [] quita todos
 }
 
 // AssignRoleRequest representa la solicitud para asignar un rol a un usuario
 type AssignRoleRequest struct {
-	UserID string `json:"user_id" binding:"required"`
-	RoleID string `json:"role_id" binding:"required"`
+	UserID    string     `json:"user_id" binding:"required"`
+	RoleID    string     `json:"role_id" binding:"required"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // Vencimiento opcional (RFC3339); después deja de otorgar permisos
 }
 
 // AssignPermissionRequest representa la solicitud para asignar un permiso a un usuario
@@ -77,15 +309,30 @@ type AssignPermissionRequest struct {
 	PermissionCode string `json:"permission_code" binding:"required"`
 }
 
-// RoleResponse representa la respuesta con datos de roles
+// RoleResponse representa la respuesta con datos de roles. Permissions son los permisos
+// directos del rol; InheritedPermissions solo se incluye al consultar un rol individual.
 type RoleResponse struct {
-	ID          string                `json:"id"`
-	Name        string                `json:"name"`
-	Description string                `json:"description"`
-	Permissions []*PermissionResponse `json:"permissions"`
-	IsSystem    bool                  `json:"is_system"`
-	CreatedAt   time.Time             `json:"created_at"`
-	UpdatedAt   time.Time             `json:"updated_at"`
+	ID                   string                         `json:"id"`
+	Name                 string                         `json:"name"`
+	Description          string                         `json:"description"`
+	Permissions          []*PermissionResponse          `json:"permissions"`
+	ParentRoles          []string                       `json:"parent_roles,omitempty"`
+	InheritedPermissions []*InheritedPermissionResponse `json:"inherited_permissions,omitempty"`
+	IsSystem             bool                           `json:"is_system"`
+	Version              int64                          `json:"version"`
+	CreatedAt            utils.Timestamp                `json:"created_at"`
+	UpdatedAt            utils.Timestamp                `json:"updated_at"`
+
+	// Solo en los roles de un usuario asignados con vencimiento (ver UserRoleUseCase.GetUserRoles)
+	ExpiresAt *utils.Timestamp `json:"expires_at,omitempty" swaggertype:"string"`
+	ExpiresIn int64            `json:"expires_in,omitempty"` // Segundos de vigencia restantes
+}
+
+// InheritedPermissionResponse es un permiso que el rol obtiene de un rol del que hereda y que
+// no tiene como permiso directo
+type InheritedPermissionResponse struct {
+	*PermissionResponse
+	InheritedFrom string `json:"inherited_from"` // ID del rol más cercano que lo define
 }
 
 // UserRoleResponse representa la respuesta con datos de asignaciones usuario-rol
@@ -94,29 +341,83 @@ type UserRoleResponse struct {
 	UserID      string                `json:"user_id"`
 	Roles       []*RoleResponse       `json:"roles"`
 	Permissions []*PermissionResponse `json:"permissions"`
-	CreatedAt   time.Time             `json:"created_at"`
-	UpdatedAt   time.Time             `json:"updated_at"`
+	CreatedAt   utils.Timestamp       `json:"created_at"`
+	UpdatedAt   utils.Timestamp       `json:"updated_at"`
 }
 
+// RoleAssignmentPreview representa el efecto de asignar un rol a un usuario, sin aplicarlo
+type RoleAssignmentPreview struct {
+	UserID               string   `json:"user_id"`
+	RoleID               string   `json:"role_id"`
+	RoleName             string   `json:"role_name"`
+	AlreadyAssigned      bool     `json:"already_assigned"`
+	CurrentPermissions   []string `json:"current_permissions"`   // Permisos efectivos actuales
+	ResultingPermissions []string `json:"resulting_permissions"` // Permisos efectivos tras la asignación
+	AddedPermissions     []string `json:"added_permissions"`     // Permisos que el usuario ganaría
+}
+
+// MaxPermissionMatrixUsers es el máximo de usuarios distintos por consulta de la matriz de permisos
+const MaxPermissionMatrixUsers = 500
+
+// PermissionMatrixRequest representa la solicitud de la matriz de permisos de varios usuarios.
+// Sin Permissions se evalúan todos los permisos registrados.
+type PermissionMatrixRequest struct {
+	UserIDs     []string `json:"user_ids" binding:"required,min=1"`
+	Permissions []string `json:"permissions"` // Códigos a evaluar (opcional)
+}
+
+// PermissionMatrix indica, por ID de usuario y código de permiso, si el usuario tiene el permiso
+// (directamente, por sus roles o por un comodín)
+type PermissionMatrix map[string]map[string]bool
+
 // RoleUseCase define el contrato para la capa de caso de uso de roles
 type RoleUseCase interface {
 	GetRole(id string) (*RoleResponse, error)
 	GetRoleByName(name string) (*RoleResponse, error)
-	GetAllRoles() ([]*RoleResponse, error)
-	CreateRole(req *CreateRoleRequest) (*RoleResponse, error)
-	UpdateRole(id string, req *UpdateRoleRequest) (*RoleResponse, error)
-	DeleteRole(id string) error
-	AddPermissionToRole(roleID string, permissionCode string) error
-	RemovePermissionFromRole(roleID string, permissionCode string) error
+	GetAllRoles(params map[string]interface{}) ([]*RoleResponse, error)
+	GetRolesPage(params map[string]interface{}, skip, limit int64) ([]*RoleResponse, int64, error)
+	// Las operaciones de gestión reciben el ámbito igual que en PermissionUseCase: un administrador
+	// delegado solo gestiona roles compuestos únicamente por permisos de su ámbito
+	CreateRole(scope *AdminScope, req *CreateRoleRequest) (*RoleResponse, error)
+	UpdateRole(scope *AdminScope, id string, req *UpdateRoleRequest) (*RoleResponse, error)
+	DeleteRole(scope *AdminScope, id string) error
+	AddPermissionToRole(scope *AdminScope, roleID string, permissionCode string) error
+	RemovePermissionFromRole(scope *AdminScope, roleID string, permissionCode string) error
+	UpdateRolePermissions(scope *AdminScope, roleID string, req *UpdateRolePermissionsRequest) (*RoleResponse, error)
+	// AddRolePermissions y RemoveRolePermissions son las variantes por lotes de AddPermissionToRole
+	// y RemovePermissionFromRole; AddRolePermissions falla sin cambios si algún código no existe
+	AddRolePermissions(scope *AdminScope, roleID string, codes []string) (*RoleResponse, error)
+	RemoveRolePermissions(scope *AdminScope, roleID string, codes []string) (*RoleResponse, error)
+	// SetRolePermissions reemplaza todos los permisos del rol; falla sin cambios si algún código no existe
+	SetRolePermissions(scope *AdminScope, roleID string, codes []string) (*RoleResponse, error)
 }
 
 // UserRoleUseCase define el contrato para la capa de caso de uso de asignaciones usuario-rol
 type UserRoleUseCase interface {
 	GetUserRoles(userID string) (*UserRoleResponse, error)
-	AssignRoleToUser(req *AssignRoleRequest) error
-	RemoveRoleFromUser(req *AssignRoleRequest) error
-	AssignPermissionToUser(req *AssignPermissionRequest) error
-	RemovePermissionFromUser(req *AssignPermissionRequest) error
+	// Las asignaciones reciben el ámbito igual que en RoleUseCase
+	AssignRoleToUser(scope *AdminScope, req *AssignRoleRequest) error
+	PreviewAssignRole(req *AssignRoleRequest) (*RoleAssignmentPreview, error)
+	RemoveRoleFromUser(scope *AdminScope, req *AssignRoleRequest) error
+	AssignPermissionToUser(scope *AdminScope, req *AssignPermissionRequest) error
+	RemovePermissionFromUser(scope *AdminScope, req *AssignPermissionRequest) error
 	GetUserPermissions(userID string) ([]string, error)
+	// GetPermissionMatrix evalúa los códigos para cada usuario; sin códigos usa todos los registrados
+	GetPermissionMatrix(userIDs []string, codes []string) (PermissionMatrix, error)
+	// GetUsersByRole retorna una página de los usuarios que tienen asignado el rol directamente
+	GetUsersByRole(roleID string, skip, limit int64) (*RoleUsersResponse, error)
+	GetAdminScope(userID string) (*AdminScope, error) // Ámbito de administración delegada del usuario; nil sin restricción
 	HasPermission(userID string, permissionCode string) (bool, error)
+	// HasModuleAccess indica si el usuario tiene algún permiso del módulo ("module:...")
+	HasModuleAccess(userID string, module string) (bool, error)
+	EnsureUserRole(userID string) (bool, error)
+	// EnsureUserRoles garantiza en lote la asignación de los usuarios; retorna a quiénes se les creó
+	EnsureUserRoles(userIDs []string) ([]string, error)
+	ClearUserRoles(userID string) error  // Quita todos los roles y permisos del usuario (ej. al eliminar su cuenta)
+	DeleteUserRoles(userID string) error // Elimina la asignación del usuario (ej. al borrarlo definitivamente)
+	// PurgeExpiredRoles quita de las asignaciones los roles vencidos en now; retorna cuántas cambiaron
+	PurgeExpiredRoles(now time.Time) (int64, error)
+	// RebuildEffectivePermissions recalcula los permisos materializados de todos los usuarios;
+	// afecta a todos los módulos, por lo que un administrador delegado no puede ejecutarla
+	RebuildEffectivePermissions(scope *AdminScope) (*EffectivePermissionsRebuildResult, error)
 }
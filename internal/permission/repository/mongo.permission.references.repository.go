@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/black4ninja/mi-proyecto/internal/permission/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+type mongoPermissionReferenceRepository struct {
+	permissions *mongo.Collection
+	roles       *mongo.Collection
+	userRoles   *mongo.Collection
+	timeout     time.Duration
+}
+
+// NewMongoPermissionReferenceRepository crea el repositorio que consulta y elimina las
+// referencias a un código de permiso. Igual que en NewMongoPermissionRenameRepository, las tres
+// colecciones deben pertenecer al mismo cliente y MongoDB debe admitir transacciones.
+func NewMongoPermissionReferenceRepository(permissions, roles, userRoles *mongo.Collection) domain.PermissionReferenceRemover {
+	return &mongoPermissionReferenceRepository{
+		permissions: permissions,
+		roles:       roles,
+		userRoles:   userRoles,
+		timeout:     30 * time.Second,
+	}
+}
+
+// FindReferences obtiene los nombres de los roles que incluyen el código y cuántas asignaciones
+// de usuario lo tienen como permiso específico
+func (r *mongoPermissionReferenceRepository) FindReferences(code string) (*domain.PermissionReferences, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	return r.findReferences(ctx, code)
+}
+
+func (r *mongoPermissionReferenceRepository) findReferences(ctx context.Context, code string) (*domain.PermissionReferences, error) {
+	opts := options.Find().SetProjection(bson.M{"name": 1}).SetSort(bson.M{"name": 1})
+	cursor, err := r.roles.Find(ctx, bson.M{"permissions": code}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	references := &domain.PermissionReferences{Roles: []string{}}
+	for cursor.Next(ctx) {
+		var role struct {
+			Name string `bson:"name"`
+		}
+		if err := cursor.Decode(&role); err != nil {
+			return nil, err
+		}
+		references.Roles = append(references.Roles, role.Name)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	references.UserAssignments, err = r.userRoles.CountDocuments(ctx, bson.M{"permissions": code})
+	if err != nil {
+		return nil, err
+	}
+
+	return references, nil
+}
+
+// DeleteUnreferenced elimina el permiso si ningún rol ni asignación de usuario lo referencia;
+// si no, retorna *domain.PermissionInUseError. Las referencias se consultan en la misma
+// transacción que elimina el permiso.
+func (r *mongoPermissionReferenceRepository) DeleteUnreferenced(code string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	session, err := r.permissions.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		references, err := r.findReferences(sc, code)
+		if err != nil {
+			return nil, err
+		}
+		if references.InUse() {
+			return nil, &domain.PermissionInUseError{Code: code, PermissionReferences: *references}
+		}
+
+		deleted, err := r.permissions.DeleteOne(sc, bson.M{"code": code})
+		if err != nil {
+			return nil, err
+		}
+		if deleted.DeletedCount == 0 {
+			return nil, domain.ErrPermissionNotFound
+		}
+		return nil, nil
+	})
+	return err
+}
+
+// DeleteCode elimina el permiso y quita el código de los roles y de las asignaciones de usuario
+// que lo referencian. Si algún paso falla no se aplica ningún cambio.
+func (r *mongoPermissionReferenceRepository) DeleteCode(code string) (*domain.PermissionDeleteResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	session, err := r.permissions.Database().Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	now := time.Now()
+	result, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		deleted, err := r.permissions.DeleteOne(sc, bson.M{"code": code})
+		if err != nil {
+			return nil, err
+		}
+		if deleted.DeletedCount == 0 {
+			return nil, domain.ErrPermissionNotFound
+		}
+
+		roles, err := r.roles.UpdateMany(sc, bson.M{"permissions": code}, bson.M{
+			"$pull": bson.M{"permissions": code},
+			"$set":  bson.M{"updated_at": now},
+			"$inc":  bson.M{utils.VersionField: 1},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		userRoles, err := r.userRoles.UpdateMany(sc, bson.M{"permissions": code}, bson.M{
+			"$pull": bson.M{"permissions": code},
+			"$set":  bson.M{"updated_at": now},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// Los permisos materializados que incluyen el código (directo o por un rol) se descartan
+		if _, err := r.userRoles.UpdateMany(sc, bson.M{"effective_permissions": code}, withEffectiveInvalidation(bson.M{})); err != nil {
+			return nil, err
+		}
+
+		return &domain.PermissionDeleteResult{
+			Code:             code,
+			RolesUpdated:     roles.ModifiedCount,
+			UserRolesUpdated: userRoles.ModifiedCount,
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*domain.PermissionDeleteResult), nil
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/black4ninja/mi-proyecto/internal/permission/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+type mongoPermissionRenameRepository struct {
+	permissions *mongo.Collection
+	roles       *mongo.Collection
+	userRoles   *mongo.Collection
+	timeout     time.Duration
+}
+
+// NewMongoPermissionRenameRepository crea el repositorio que renombra códigos de permiso.
+// Las tres colecciones deben pertenecer al mismo cliente: se actualizan en una transacción,
+// por lo que MongoDB debe ejecutarse como replica set o cluster shardeado.
+func NewMongoPermissionRenameRepository(permissions, roles, userRoles *mongo.Collection) domain.PermissionCodeRenamer {
+	return &mongoPermissionRenameRepository{
+		permissions: permissions,
+		roles:       roles,
+		userRoles:   userRoles,
+		timeout:     30 * time.Second,
+	}
+}
+
+// RenameCode cambia el código del permiso y lo reemplaza en los roles y en las asignaciones
+// de usuario que lo referencian. Si algún paso falla no se aplica ningún cambio.
+func (r *mongoPermissionRenameRepository) RenameCode(oldCode, newCode string) (*domain.PermissionRenameResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	session, err := r.permissions.Database().Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	now := time.Now()
+	result, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		// Se repite la verificación de unicidad dentro de la transacción por si otro permiso
+		// tomó el código después de la validación del caso de uso
+		taken, err := r.permissions.CountDocuments(sc, bson.M{"code": newCode})
+		if err != nil {
+			return nil, err
+		}
+		if taken > 0 {
+			return nil, domain.ErrPermissionCodeExists
+		}
+
+		renamed, err := r.permissions.UpdateOne(sc, bson.M{"code": oldCode}, bson.M{
+			"$set": bson.M{"code": newCode, "updated_at": now},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if renamed.MatchedCount == 0 {
+			return nil, domain.ErrPermissionNotFound
+		}
+
+		roles, err := r.roles.UpdateMany(sc, bson.M{"permissions": oldCode}, renameReferenceUpdate(oldCode, newCode, now, true))
+		if err != nil {
+			return nil, err
+		}
+
+		userRoles, err := r.userRoles.UpdateMany(sc, bson.M{"permissions": oldCode}, renameReferenceUpdate(oldCode, newCode, now, false))
+		if err != nil {
+			return nil, err
+		}
+
+		// Los permisos materializados que incluyen el código viejo (directo o por un rol) se descartan
+		if _, err := r.userRoles.UpdateMany(sc, bson.M{"effective_permissions": oldCode}, withEffectiveInvalidation(bson.M{})); err != nil {
+			return nil, err
+		}
+
+		return &domain.PermissionRenameResult{
+			OldCode:          oldCode,
+			NewCode:          newCode,
+			RolesUpdated:     roles.ModifiedCount,
+			UserRolesUpdated: userRoles.ModifiedCount,
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*domain.PermissionRenameResult), nil
+}
+
+// renameReferenceUpdate reemplaza oldCode por newCode en el arreglo permissions sin duplicarlo
+// si el documento ya incluía newCode. Con versioned también incrementa la versión (roles).
+func renameReferenceUpdate(oldCode, newCode string, now time.Time, versioned bool) mongo.Pipeline {
+	set := bson.M{
+		"permissions": bson.M{"$setUnion": bson.A{
+			bson.M{"$setDifference": bson.A{"$permissions", bson.A{oldCode}}},
+			bson.A{newCode},
+		}},
+		"updated_at": now,
+	}
+	if versioned {
+		set[utils.VersionField] = bson.M{"$add": bson.A{
+			bson.M{"$ifNull": bson.A{"$" + utils.VersionField, 0}},
+			1,
+		}}
+	}
+	return mongo.Pipeline{{{Key: "$set", Value: set}}}
+}
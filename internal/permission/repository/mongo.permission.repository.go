@@ -31,16 +31,17 @@ func (r *mongoPermissionRepository) GetByID(id string) (*domain.Permission, erro
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
 
+	// Un ID mal formado no corresponde a ningún permiso
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, err
+		return nil, domain.ErrPermissionNotFound
 	}
 
 	var permission domain.Permission
 	err = r.collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&permission)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("permiso no encontrado")
+			return nil, domain.ErrPermissionNotFound
 		}
 		return nil, err
 	}
@@ -57,7 +58,7 @@ func (r *mongoPermissionRepository) GetByCode(code string) (*domain.Permission,
 	err := r.collection.FindOne(ctx, bson.M{"code": code}).Decode(&permission)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("permiso no encontrado")
+			return nil, domain.ErrPermissionNotFound
 		}
 		return nil, err
 	}
@@ -85,12 +86,17 @@ func (r *mongoPermissionRepository) GetByModule(module string) ([]*domain.Permis
 }
 
 // GetAll obtiene todos los permisos
-func (r *mongoPermissionRepository) GetAll() ([]*domain.Permission, error) {
+func (r *mongoPermissionRepository) GetAll(params map[string]interface{}) ([]*domain.Permission, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
 
+	filter := bson.M{}
+	for key, value := range params {
+		filter[key] = value
+	}
+
 	opts := options.Find().SetSort(bson.M{"module": 1, "code": 1})
-	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	cursor, err := r.collection.Find(ctx, filter, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -104,6 +110,36 @@ func (r *mongoPermissionRepository) GetAll() ([]*domain.Permission, error) {
 	return permissions, nil
 }
 
+// GetPage obtiene una página de permisos con el mismo orden que GetAll y el total de coincidencias
+func (r *mongoPermissionRepository) GetPage(params map[string]interface{}, skip, limit int64) ([]*domain.Permission, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	filter := bson.M{}
+	for key, value := range params {
+		filter[key] = value
+	}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "module", Value: 1}, {Key: "code", Value: 1}}).SetSkip(skip).SetLimit(limit)
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var permissions []*domain.Permission
+	if err := cursor.All(ctx, &permissions); err != nil {
+		return nil, 0, err
+	}
+
+	return permissions, total, nil
+}
+
 // Create crea un nuevo permiso
 func (r *mongoPermissionRepository) Create(permission *domain.Permission) error {
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
@@ -159,8 +195,13 @@ func (r *mongoPermissionRepository) Delete(id string) error {
 	return err
 }
 
-// GetByCodesArray obtiene permisos por array de códigos
+// GetByCodesArray obtiene permisos por array de códigos.
+// Una lista vacía o nil retorna una lista vacía (no nil) sin consultar la base de datos.
 func (r *mongoPermissionRepository) GetByCodesArray(codes []string) ([]*domain.Permission, error) {
+	if len(codes) == 0 {
+		return []*domain.Permission{}, nil
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
 
@@ -170,10 +211,41 @@ func (r *mongoPermissionRepository) GetByCodesArray(codes []string) ([]*domain.P
 	}
 	defer cursor.Close(ctx)
 
-	var permissions []*domain.Permission
+	permissions := []*domain.Permission{}
 	if err := cursor.All(ctx, &permissions); err != nil {
 		return nil, err
 	}
 
 	return permissions, nil
 }
+
+// GetExistingCodes retorna cuáles de los códigos indicados están registrados.
+// Solo se proyecta el campo code; una lista vacía no consulta la base de datos.
+func (r *mongoPermissionRepository) GetExistingCodes(codes []string) ([]string, error) {
+	if len(codes) == 0 {
+		return []string{}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	opts := options.Find().SetProjection(bson.M{"code": 1, "_id": 0})
+	cursor, err := r.collection.Find(ctx, bson.M{"code": bson.M{"$in": codes}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	existing := []string{}
+	for cursor.Next(ctx) {
+		var doc struct {
+			Code string `bson:"code"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		existing = append(existing, doc.Code)
+	}
+
+	return existing, cursor.Err()
+}
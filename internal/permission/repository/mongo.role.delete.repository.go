@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/black4ninja/mi-proyecto/internal/permission/domain"
+)
+
+type mongoRoleDeleteRepository struct {
+	roles     *mongo.Collection
+	userRoles *mongo.Collection
+	timeout   time.Duration
+}
+
+// NewMongoRoleDeleteRepository crea el repositorio que elimina roles no asignados. Igual que en
+// NewMongoPermissionReferenceRepository, las colecciones deben pertenecer al mismo cliente y
+// MongoDB debe admitir transacciones.
+func NewMongoRoleDeleteRepository(roles, userRoles *mongo.Collection) domain.RoleDeleter {
+	return &mongoRoleDeleteRepository{
+		roles:     roles,
+		userRoles: userRoles,
+		timeout:   30 * time.Second,
+	}
+}
+
+// DeleteUnassigned elimina el rol si ninguna asignación de usuario lo incluye. Las asignaciones
+// se cuentan en la misma transacción que elimina el rol, de modo que una asignación hecha entre
+// ambos pasos no quede apuntando a un rol eliminado.
+func (r *mongoRoleDeleteRepository) DeleteUnassigned(roleID string) error {
+	objID, err := primitive.ObjectIDFromHex(roleID)
+	if err != nil {
+		return domain.ErrRoleNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	session, err := r.roles.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		var role domain.Role
+		if err := r.roles.FindOne(sc, bson.M{"_id": objID}).Decode(&role); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, domain.ErrRoleNotFound
+			}
+			return nil, err
+		}
+		if role.IsSystem {
+			return nil, errors.New("no se puede eliminar un rol de sistema")
+		}
+
+		assigned, err := r.userRoles.CountDocuments(sc, bson.M{"roles": roleID})
+		if err != nil {
+			return nil, err
+		}
+		if assigned > 0 {
+			return nil, fmt.Errorf("%w: %d asignaciones", domain.ErrRoleInUse, assigned)
+		}
+
+		_, err = r.roles.DeleteOne(sc, bson.M{"_id": objID})
+		return nil, err
+	})
+	return err
+}
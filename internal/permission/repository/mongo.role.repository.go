@@ -11,6 +11,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"github.com/black4ninja/mi-proyecto/internal/permission/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
 )
 
 type mongoRoleRepository struct {
@@ -31,16 +32,17 @@ func (r *mongoRoleRepository) GetByID(id string) (*domain.Role, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
 
+	// Un ID mal formado no corresponde a ningún rol
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, err
+		return nil, domain.ErrRoleNotFound
 	}
 
 	var role domain.Role
 	err = r.collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&role)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("rol no encontrado")
+			return nil, domain.ErrRoleNotFound
 		}
 		return nil, err
 	}
@@ -48,6 +50,51 @@ func (r *mongoRoleRepository) GetByID(id string) (*domain.Role, error) {
 	return &role, nil
 }
 
+// GetByIDs obtiene varios roles con una sola consulta $in. Los IDs inválidos o
+// inexistentes se omiten y el resultado conserva el orden de ids.
+func (r *mongoRoleRepository) GetByIDs(ids []string) ([]*domain.Role, error) {
+	objIDs := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		objID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			continue
+		}
+		objIDs = append(objIDs, objID)
+	}
+	if len(objIDs) == 0 {
+		return []*domain.Role{}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, bson.M{"_id": bson.M{"$in": objIDs}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var found []*domain.Role
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[primitive.ObjectID]*domain.Role, len(found))
+	for _, role := range found {
+		byID[role.ID] = role
+	}
+
+	roles := make([]*domain.Role, 0, len(found))
+	for _, objID := range objIDs {
+		if role, ok := byID[objID]; ok {
+			roles = append(roles, role)
+			delete(byID, objID) // Evitar duplicados si ids repite un rol
+		}
+	}
+
+	return roles, nil
+}
+
 // GetByName obtiene un rol por su nombre
 func (r *mongoRoleRepository) GetByName(name string) (*domain.Role, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
@@ -57,7 +104,7 @@ func (r *mongoRoleRepository) GetByName(name string) (*domain.Role, error) {
 	err := r.collection.FindOne(ctx, bson.M{"name": name}).Decode(&role)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("rol no encontrado")
+			return nil, domain.ErrRoleNotFound
 		}
 		return nil, err
 	}
@@ -66,12 +113,17 @@ func (r *mongoRoleRepository) GetByName(name string) (*domain.Role, error) {
 }
 
 // GetAll obtiene todos los roles
-func (r *mongoRoleRepository) GetAll() ([]*domain.Role, error) {
+func (r *mongoRoleRepository) GetAll(params map[string]interface{}) ([]*domain.Role, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
 
+	filter := bson.M{}
+	for key, value := range params {
+		filter[key] = value
+	}
+
 	opts := options.Find().SetSort(bson.M{"name": 1})
-	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	cursor, err := r.collection.Find(ctx, filter, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -85,6 +137,36 @@ func (r *mongoRoleRepository) GetAll() ([]*domain.Role, error) {
 	return roles, nil
 }
 
+// GetPage obtiene una página de roles con el mismo orden que GetAll y el total de coincidencias
+func (r *mongoRoleRepository) GetPage(params map[string]interface{}, skip, limit int64) ([]*domain.Role, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	filter := bson.M{}
+	for key, value := range params {
+		filter[key] = value
+	}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}}).SetSkip(skip).SetLimit(limit)
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var roles []*domain.Role
+	if err := cursor.All(ctx, &roles); err != nil {
+		return nil, 0, err
+	}
+
+	return roles, total, nil
+}
+
 // Create crea un nuevo rol
 func (r *mongoRoleRepository) Create(role *domain.Role) error {
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
@@ -107,7 +189,7 @@ func (r *mongoRoleRepository) Create(role *domain.Role) error {
 	return err
 }
 
-// Update actualiza un rol existente
+// Update actualiza un rol existente. Guarda el updated_at que fijó el caso de uso.
 func (r *mongoRoleRepository) Update(role *domain.Role) error {
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
@@ -123,17 +205,32 @@ func (r *mongoRoleRepository) Update(role *domain.Role) error {
 		return errors.New("no se puede modificar un rol de sistema")
 	}
 
+	set := bson.M{
+		"name":        role.Name,
+		"description": role.Description,
+		"updated_at":  role.UpdatedAt,
+	}
 	update := bson.M{
-		"$set": bson.M{
-			"name":        role.Name,
-			"description": role.Description,
-			"updated_at":  time.Now(),
-		},
+		"$set": set,
+		"$inc": bson.M{utils.VersionField: 1},
+	}
+	if len(role.ParentRoles) > 0 {
+		set["parent_roles"] = role.ParentRoles
+	} else {
+		update["$unset"] = bson.M{"parent_roles": ""}
 	}
 
-	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": role.ID}, update)
+	// Solo se actualiza si nadie más lo modificó desde que se leyó (misma versión)
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": role.ID, utils.VersionField: utils.VersionFilter(role.Version)}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return utils.ErrVersionConflict
+	}
 
-	return err
+	role.Version++
+	return nil
 }
 
 // Delete elimina un rol
@@ -193,6 +290,7 @@ func (r *mongoRoleRepository) AddPermission(roleID string, permissionCode string
 		"$set": bson.M{
 			"updated_at": time.Now(),
 		},
+		"$inc": bson.M{utils.VersionField: 1},
 	}
 
 	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": objID}, update)
@@ -228,9 +326,98 @@ func (r *mongoRoleRepository) RemovePermission(roleID string, permissionCode str
 		"$set": bson.M{
 			"updated_at": time.Now(),
 		},
+		"$inc": bson.M{utils.VersionField: 1},
 	}
 
 	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": objID}, update)
 
 	return err
 }
+
+// ReplacePermissions reemplaza los permisos de un rol con una única actualización atómica y
+// devuelve el rol resultante. Los roles de sistema no se modifican.
+func (r *mongoRoleRepository) ReplacePermissions(roleID string, codes []string) (*domain.Role, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if codes == nil {
+		codes = []string{}
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"permissions": codes,
+			"updated_at":  time.Now(),
+		},
+		"$inc": bson.M{utils.VersionField: 1},
+	}
+
+	filter := bson.M{"_id": objID, "is_system": bson.M{"$ne": true}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var role domain.Role
+	err = r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&role)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, domain.ErrRoleNotFound
+		}
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+// ApplyPermissionDelta añade y quita permisos de un rol con una única actualización atómica
+// y devuelve el rol resultante. Los roles de sistema no se modifican. El conjunto resultante
+// no conserva el orden original de los permisos.
+func (r *mongoRoleRepository) ApplyPermissionDelta(roleID string, add []string, remove []string) (*domain.Role, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Un arreglo nulo anularía el resultado de los operadores de conjuntos
+	if add == nil {
+		add = []string{}
+	}
+	if remove == nil {
+		remove = []string{}
+	}
+
+	current := bson.M{"$ifNull": bson.A{"$permissions", bson.A{}}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"permissions": bson.M{"$setUnion": bson.A{
+				bson.M{"$setDifference": bson.A{current, remove}},
+				add,
+			}},
+			"updated_at": time.Now(),
+			utils.VersionField: bson.M{"$add": bson.A{
+				bson.M{"$ifNull": bson.A{"$" + utils.VersionField, 0}},
+				1,
+			}},
+		}}},
+	}
+
+	filter := bson.M{"_id": objID, "is_system": bson.M{"$ne": true}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var role domain.Role
+	err = r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&role)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, domain.ErrRoleNotFound
+		}
+		return nil, err
+	}
+
+	return &role, nil
+}
@@ -3,27 +3,41 @@ package repository
 import (
 	"context"
 	"errors"
+	"slices"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"github.com/black4ninja/mi-proyecto/internal/permission/domain"
 )
 
+const (
+	// rebuildTimeout limita la reconstrucción completa de los permisos materializados
+	rebuildTimeout = 5 * time.Minute
+	// rebuildBatchSize es la cantidad de asignaciones que se guardan por escritura en la reconstrucción
+	rebuildBatchSize = 500
+)
+
 type mongoUserRoleRepository struct {
-	collection *mongo.Collection
-	roleRepo   domain.RoleRepository
-	timeout    time.Duration
+	collection  *mongo.Collection
+	roleRepo    domain.RoleRepository
+	materialize bool
+	timeout     time.Duration
 }
 
-// NewMongoUserRoleRepository crea un nuevo repositorio de asignaciones usuario-rol con MongoDB
-func NewMongoUserRoleRepository(collection *mongo.Collection, roleRepo domain.RoleRepository) domain.UserRoleRepository {
+// NewMongoUserRoleRepository crea un nuevo repositorio de asignaciones usuario-rol con MongoDB.
+// Con materialize, GetUserPermissions lee el conjunto de permisos efectivos guardado en la
+// asignación y lo calcula y guarda solo cuando falta. Las modificaciones descartan el conjunto
+// en ambos modos, por lo que puede activarse en cualquier momento sin datos obsoletos.
+func NewMongoUserRoleRepository(collection *mongo.Collection, roleRepo domain.RoleRepository, materialize bool) domain.UserRoleRepository {
 	return &mongoUserRoleRepository{
-		collection: collection,
-		roleRepo:   roleRepo,
-		timeout:    10 * time.Second,
+		collection:  collection,
+		roleRepo:    roleRepo,
+		materialize: materialize,
+		timeout:     10 * time.Second,
 	}
 }
 
@@ -57,6 +71,104 @@ func (r *mongoUserRoleRepository) GetByUserID(userID string) (*domain.UserRole,
 	return &userRole, nil
 }
 
+// FindByUserID obtiene las asignaciones de rol de un usuario sin crearlas: si no existen
+// retorna una asignación vacía que no se guarda
+func (r *mongoUserRoleRepository) FindByUserID(userID string) (*domain.UserRole, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	var userRole domain.UserRole
+	err := r.collection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&userRole)
+	if err == mongo.ErrNoDocuments {
+		return &domain.UserRole{UserID: userID, Roles: []string{}, Permissions: []string{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &userRole, nil
+}
+
+// EnsureUserRoleIndexes crea el índice único sobre user_id, que impide asignaciones duplicadas
+// de un usuario (ej. dos upserts concurrentes). Es idempotente; falla si ya hay usuarios con más
+// de una asignación, que deben resolverse antes.
+func EnsureUserRoleIndexes(collection *mongo.Collection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// EnsureForUser crea la asignación del usuario con roleIDs si aún no existe, en un único upsert.
+// Retorna true si el documento fue creado en esta llamada; uno existente no se modifica.
+func (r *mongoUserRoleRepository) EnsureForUser(userID string, roleIDs ...string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	update := newUserRoleOnInsert(userID, roleIDs, time.Now())
+	result, err := r.collection.UpdateOne(ctx, bson.M{"user_id": userID}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return false, err
+	}
+
+	return result.UpsertedCount > 0, nil
+}
+
+// EnsureForUsers crea con un único BulkWrite las asignaciones que falten de userIDs, con roleIDs.
+// Retorna los usuarios cuya asignación fue creada en esta llamada.
+func (r *mongoUserRoleRepository) EnsureForUsers(userIDs []string, roleIDs ...string) ([]string, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	now := time.Now()
+	models := make([]mongo.WriteModel, 0, len(userIDs))
+	for _, userID := range userIDs {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"user_id": userID}).
+			SetUpdate(newUserRoleOnInsert(userID, roleIDs, now)).
+			SetUpsert(true))
+	}
+
+	result, err := r.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return nil, err
+	}
+
+	// UpsertedIDs se indexa por la posición de la operación, que coincide con la de userIDs
+	created := make([]string, 0, len(result.UpsertedIDs))
+	for index := range result.UpsertedIDs {
+		created = append(created, userIDs[index])
+	}
+	slices.Sort(created)
+	return created, nil
+}
+
+// newUserRoleOnInsert retorna el upsert que crea la asignación del usuario con roleIDs y sin
+// permisos específicos, solo si no existe
+func newUserRoleOnInsert(userID string, roleIDs []string, now time.Time) bson.M {
+	roles := []string{}
+	if len(roleIDs) > 0 {
+		roles = roleIDs
+	}
+	return bson.M{
+		"$setOnInsert": bson.M{
+			"user_id":     userID,
+			"roles":       roles,
+			"permissions": []string{},
+			"created_at":  now,
+			"updated_at":  now,
+		},
+	}
+}
+
 // Create crea una nueva asignación usuario-rol
 func (r *mongoUserRoleRepository) Create(userRole *domain.UserRole) error {
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
@@ -84,13 +196,14 @@ func (r *mongoUserRoleRepository) Update(userRole *domain.UserRole) error {
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
 
-	update := bson.M{
+	update := withEffectiveInvalidation(bson.M{
 		"$set": bson.M{
-			"roles":       userRole.Roles,
-			"permissions": userRole.Permissions,
-			"updated_at":  time.Now(),
+			"roles":            userRole.Roles,
+			"permissions":      userRole.Permissions,
+			"role_expirations": userRole.RoleExpirations,
+			"updated_at":       time.Now(),
 		},
-	}
+	})
 
 	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": userRole.ID}, update)
 
@@ -112,8 +225,22 @@ func (r *mongoUserRoleRepository) Delete(id string) error {
 	return err
 }
 
+// DeleteByUserID elimina la asignación del usuario; no falla si no existe
+func (r *mongoUserRoleRepository) DeleteByUserID(userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	_, err := r.collection.DeleteOne(ctx, bson.M{"user_id": userID})
+	return err
+}
+
 // AddRole añade un rol a un usuario
 func (r *mongoUserRoleRepository) AddRole(userID string, roleID string) error {
+	return r.AddRoleWithExpiry(userID, roleID, nil)
+}
+
+// AddRoleWithExpiry añade un rol a un usuario; con expiresAt el rol vence en esa fecha
+func (r *mongoUserRoleRepository) AddRoleWithExpiry(userID string, roleID string, expiresAt *time.Time) error {
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
 
@@ -132,44 +259,220 @@ func (r *mongoUserRoleRepository) AddRole(userID string, roleID string) error {
 	// Verificar si el rol ya está asignado
 	for _, rid := range userRole.Roles {
 		if rid == roleID {
-			return errors.New("el rol ya está asignado a este usuario")
+			return r.updateRoleExpiry(ctx, userRole, roleID, expiresAt)
 		}
 	}
 
 	// Añadir el rol
-	update := bson.M{
-		"$push": bson.M{
-			"roles": roleID,
-		},
+	push := bson.M{"roles": roleID}
+	if expiresAt != nil {
+		push["role_expirations"] = domain.RoleExpiration{RoleID: roleID, ExpiresAt: *expiresAt}
+	}
+	update := withEffectiveInvalidation(bson.M{
+		"$push": push,
 		"$set": bson.M{
 			"updated_at": time.Now(),
 		},
-	}
+	})
 
 	_, err = r.collection.UpdateOne(ctx, bson.M{"user_id": userID}, update)
 
 	return err
 }
 
+// updateRoleExpiry reemplaza el vencimiento de un rol ya asignado, vigente o vencido pero aún no
+// quitado: con expiresAt el rol vence en esa fecha y sin él deja de vencer. Asignar sin
+// vencimiento un rol que no vence retorna el error de rol ya asignado.
+func (r *mongoUserRoleRepository) updateRoleExpiry(ctx context.Context, userRole *domain.UserRole, roleID string, expiresAt *time.Time) error {
+	current := userRole.RoleExpiresAt(roleID)
+	if current == nil && expiresAt == nil {
+		return errors.New("el rol ya está asignado a este usuario")
+	}
+
+	set := bson.M{"updated_at": time.Now()}
+	update := bson.M{"$set": set}
+	var filter bson.M
+	switch {
+	case current == nil:
+		// El rol no vencía: se añade su vencimiento
+		filter = bson.M{"_id": userRole.ID, "role_expirations.role_id": bson.M{"$ne": roleID}}
+		update["$push"] = bson.M{"role_expirations": domain.RoleExpiration{RoleID: roleID, ExpiresAt: *expiresAt}}
+	case expiresAt != nil:
+		filter = bson.M{"_id": userRole.ID, "role_expirations.role_id": roleID}
+		set["role_expirations.$.expires_at"] = *expiresAt
+	default:
+		filter = bson.M{"_id": userRole.ID, "role_expirations.role_id": roleID}
+		update["$pull"] = bson.M{"role_expirations": bson.M{"role_id": roleID}}
+	}
+
+	_, err := r.collection.UpdateOne(ctx, filter, withEffectiveInvalidation(update))
+	return err
+}
+
 // RemoveRole elimina un rol de un usuario
 func (r *mongoUserRoleRepository) RemoveRole(userID string, roleID string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
 
-	update := bson.M{
+	update := withEffectiveInvalidation(bson.M{
 		"$pull": bson.M{
-			"roles": roleID,
+			"roles":            roleID,
+			"role_expirations": bson.M{"role_id": roleID},
 		},
 		"$set": bson.M{
 			"updated_at": time.Now(),
 		},
-	}
+	})
 
 	_, err := r.collection.UpdateOne(ctx, bson.M{"user_id": userID}, update)
 
 	return err
 }
 
+// CountByRole cuenta las asignaciones de usuario que incluyen el rol
+func (r *mongoUserRoleRepository) CountByRole(roleID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	return r.collection.CountDocuments(ctx, bson.M{"roles": roleID})
+}
+
+// GetUsersByRole obtiene una página de los IDs de los usuarios cuya asignación incluye el rol
+// vigente, ordenados, y el total. Un rol vencido que el barrido aún no quitó no cuenta.
+func (r *mongoUserRoleRepository) GetUsersByRole(roleID string, skip, limit int64) ([]string, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	filter := bson.M{
+		"roles": roleID,
+		"role_expirations": bson.M{"$not": bson.M{"$elemMatch": bson.M{
+			"role_id":    roleID,
+			"expires_at": bson.M{"$lte": time.Now()},
+		}}},
+	}
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetProjection(bson.M{"user_id": 1}).
+		SetSort(bson.D{{Key: "user_id", Value: 1}}).
+		SetSkip(skip).
+		SetLimit(limit)
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	userIDs := []string{}
+	for cursor.Next(ctx) {
+		var userRole domain.UserRole
+		if err := cursor.Decode(&userRole); err != nil {
+			return nil, 0, err
+		}
+		userIDs = append(userIDs, userRole.UserID)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return userIDs, total, nil
+}
+
+// RemoveRoleFromAll quita el rol de todas las asignaciones de usuario que lo incluyen
+func (r *mongoUserRoleRepository) RemoveRoleFromAll(roleID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	update := withEffectiveInvalidation(bson.M{
+		"$pull": bson.M{
+			"roles":            roleID,
+			"role_expirations": bson.M{"role_id": roleID},
+		},
+		"$set": bson.M{
+			"updated_at": time.Now(),
+		},
+	})
+
+	result, err := r.collection.UpdateMany(ctx, bson.M{"roles": roleID}, update)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+// RemoveExpiredRoles quita de las asignaciones los roles cuyo vencimiento es anterior o igual a
+// now, junto con su vencimiento. Una asignación modificada desde que se leyó no se cambia y se
+// limpia en el siguiente barrido; mientras tanto sus roles vencidos ya no otorgan permisos.
+func (r *mongoUserRoleRepository) RemoveExpiredRoles(now time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), rebuildTimeout)
+	defer cancel()
+
+	projection := bson.M{"roles": 1, "role_expirations": 1, "effective_revision": 1}
+	filter := bson.M{"role_expirations.expires_at": bson.M{"$lte": now}}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetProjection(projection))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var removed int64
+	models := make([]mongo.WriteModel, 0, rebuildBatchSize)
+	flush := func() error {
+		if len(models) == 0 {
+			return nil
+		}
+		result, err := r.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return err
+		}
+		removed += result.ModifiedCount
+		models = models[:0]
+		return nil
+	}
+
+	for cursor.Next(ctx) {
+		var userRole domain.UserRole
+		if err := cursor.Decode(&userRole); err != nil {
+			return removed, err
+		}
+
+		// También se descartan los vencimientos de roles que ya no están asignados
+		var expired []string
+		for _, expiration := range userRole.RoleExpirations {
+			if !now.Before(expiration.ExpiresAt) {
+				expired = append(expired, expiration.RoleID)
+			}
+		}
+
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(effectiveRevisionFilter(&userRole)).
+			SetUpdate(withEffectiveInvalidation(bson.M{
+				"$pull": bson.M{
+					"roles":            bson.M{"$in": expired},
+					"role_expirations": bson.M{"role_id": bson.M{"$in": expired}},
+				},
+				"$set": bson.M{"updated_at": now},
+			})))
+		if len(models) == rebuildBatchSize {
+			if err := flush(); err != nil {
+				return removed, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return removed, err
+	}
+	if err := flush(); err != nil {
+		return removed, err
+	}
+
+	return removed, nil
+}
+
 // AddPermission añade un permiso específico a un usuario
 func (r *mongoUserRoleRepository) AddPermission(userID string, permissionCode string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
@@ -189,14 +492,14 @@ func (r *mongoUserRoleRepository) AddPermission(userID string, permissionCode st
 	}
 
 	// Añadir el permiso
-	update := bson.M{
+	update := withEffectiveInvalidation(bson.M{
 		"$push": bson.M{
 			"permissions": permissionCode,
 		},
 		"$set": bson.M{
 			"updated_at": time.Now(),
 		},
-	}
+	})
 
 	_, err = r.collection.UpdateOne(ctx, bson.M{"user_id": userID}, update)
 
@@ -208,14 +511,14 @@ func (r *mongoUserRoleRepository) RemovePermission(userID string, permissionCode
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
 
-	update := bson.M{
+	update := withEffectiveInvalidation(bson.M{
 		"$pull": bson.M{
 			"permissions": permissionCode,
 		},
 		"$set": bson.M{
 			"updated_at": time.Now(),
 		},
-	}
+	})
 
 	_, err := r.collection.UpdateOne(ctx, bson.M{"user_id": userID}, update)
 
@@ -224,7 +527,7 @@ func (r *mongoUserRoleRepository) RemovePermission(userID string, permissionCode
 
 // GetUserPermissions obtiene todos los permisos de un usuario (combinando los de sus roles y los específicos)
 func (r *mongoUserRoleRepository) GetUserPermissions(userID string) ([]string, error) {
-	_, cancel := context.WithTimeout(context.Background(), r.timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
 
 	// Obtener asignación de usuario
@@ -233,21 +536,235 @@ func (r *mongoUserRoleRepository) GetUserPermissions(userID string) ([]string, e
 		return nil, err
 	}
 
-	// Conjunto para almacenar permisos únicos
-	permissionsSet := make(map[string]bool)
+	// El conjunto materializado no sirve si incluye roles que vencieron después de calcularlo
+	now := time.Now()
+	if r.materialize && userRole.EffectivePermissions != nil && len(userRole.ExpiredRoles(now)) == 0 {
+		return userRole.EffectivePermissions, nil
+	}
 
-	// Añadir permisos específicos del usuario
-	for _, p := range userRole.Permissions {
-		permissionsSet[p] = true
+	// Añadir permisos de los roles vigentes y de los roles de los que heredan (una consulta por
+	// nivel de herencia; los roles que no existen se ignoran)
+	roles, err := r.roleRepo.GetByIDs(userRole.ActiveRoles(now))
+	if err != nil {
+		return nil, err
+	}
+	roles, err = domain.WithAncestorRoles(roles, r.roleRepo.GetByIDs)
+	if err != nil {
+		return nil, err
+	}
+	permissions := effectivePermissions(userRole, roles)
+
+	if r.materialize {
+		// Si la asignación cambió desde que se leyó, el filtro no coincide y el conjunto no se
+		// guarda; un error tampoco impide responder: se recalcula en la próxima consulta
+		_, _ = r.collection.UpdateOne(ctx, effectiveRevisionFilter(userRole), bson.M{
+			"$set": bson.M{"effective_permissions": permissions},
+		})
+	}
+
+	return permissions, nil
+}
+
+// GetPermissionsByUserIDs obtiene los permisos de varios usuarios con una sola consulta de
+// asignaciones y una de roles por nivel de herencia, compartidas por todos los usuarios. Con
+// materialize usa los conjuntos guardados; los que faltan se calculan pero no se guardan, y los
+// usuarios sin asignación no la crean.
+func (r *mongoUserRoleRepository) GetPermissionsByUserIDs(userIDs []string) (map[string][]string, error) {
+	permissions := make(map[string][]string, len(userIDs))
+	for _, userID := range userIDs {
+		permissions[userID] = []string{}
+	}
+	if len(userIDs) == 0 {
+		return permissions, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": bson.M{"$in": userIDs}})
+	if err != nil {
+		return nil, err
+	}
+	var userRoles []*domain.UserRole
+	if err := cursor.All(ctx, &userRoles); err != nil {
+		return nil, err
+	}
+
+	// Asignaciones cuyo conjunto hay que calcular y los roles vigentes que necesitan
+	now := time.Now()
+	var pending []*domain.UserRole
+	var roleIDs []string
+	for _, userRole := range userRoles {
+		if r.materialize && userRole.EffectivePermissions != nil && len(userRole.ExpiredRoles(now)) == 0 {
+			permissions[userRole.UserID] = userRole.EffectivePermissions
+			continue
+		}
+		pending = append(pending, userRole)
+		roleIDs = append(roleIDs, userRole.ActiveRoles(now)...)
+	}
+	if len(pending) == 0 {
+		return permissions, nil
+	}
+
+	roles, err := r.roleRepo.GetByIDs(roleIDs)
+	if err != nil {
+		return nil, err
+	}
+	roles, err = domain.WithAncestorRoles(roles, r.roleRepo.GetByIDs)
+	if err != nil {
+		return nil, err
+	}
+	lookup := roleLookup(roles)
+
+	for _, userRole := range pending {
+		assigned, _ := lookup(userRole.ActiveRoles(now))
+		assigned, err = domain.WithAncestorRoles(assigned, lookup)
+		if err != nil {
+			return nil, err
+		}
+		permissions[userRole.UserID] = effectivePermissions(userRole, assigned)
+	}
+
+	return permissions, nil
+}
+
+// InvalidateEffectivePermissions descarta los permisos materializados de las asignaciones que
+// incluyen alguno de los roles; se usa cuando cambian los permisos de un rol o su herencia
+func (r *mongoUserRoleRepository) InvalidateEffectivePermissions(roleIDs ...string) (int64, error) {
+	if len(roleIDs) == 0 {
+		return 0, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	var filter bson.M
+	if len(roleIDs) == 1 {
+		filter = bson.M{"roles": roleIDs[0]}
+	} else {
+		filter = bson.M{"roles": bson.M{"$in": roleIDs}}
+	}
+
+	result, err := r.collection.UpdateMany(ctx, filter, withEffectiveInvalidation(bson.M{}))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+// RebuildEffectivePermissions recalcula y guarda los permisos efectivos de todas las
+// asignaciones. Los roles se leen al empezar; una asignación modificada durante la
+// reconstrucción no se sobrescribe y se recalcula en su próxima consulta. Un rol modificado
+// durante la reconstrucción pudo guardarse con sus permisos anteriores en asignaciones leídas
+// después de su invalidación: al terminar se vuelven a leer los roles y se invalidan las
+// asignaciones de los que cambiaron.
+func (r *mongoUserRoleRepository) RebuildEffectivePermissions() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), rebuildTimeout)
+	defer cancel()
+
+	roles, err := r.roleRepo.GetAll(nil)
+	if err != nil {
+		return 0, err
+	}
+	lookup := roleLookup(roles)
+
+	now := time.Now()
+	projection := bson.M{"roles": 1, "permissions": 1, "role_expirations": 1, "effective_revision": 1}
+	cursor, err := r.collection.Find(ctx, bson.M{}, options.Find().SetProjection(projection))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var rebuilt int64
+	models := make([]mongo.WriteModel, 0, rebuildBatchSize)
+	flush := func() error {
+		if len(models) == 0 {
+			return nil
+		}
+		result, err := r.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return err
+		}
+		rebuilt += result.MatchedCount
+		models = models[:0]
+		return nil
 	}
 
-	// Añadir permisos de cada rol
-	for _, roleID := range userRole.Roles {
-		role, err := r.roleRepo.GetByID(roleID)
+	for cursor.Next(ctx) {
+		var userRole domain.UserRole
+		if err := cursor.Decode(&userRole); err != nil {
+			return rebuilt, err
+		}
+
+		assigned, _ := lookup(userRole.ActiveRoles(now))
+		assigned, err = domain.WithAncestorRoles(assigned, lookup)
 		if err != nil {
-			continue // Ignorar roles que no existan
+			return rebuilt, err
 		}
 
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(effectiveRevisionFilter(&userRole)).
+			SetUpdate(bson.M{"$set": bson.M{"effective_permissions": effectivePermissions(&userRole, assigned)}}))
+		if len(models) == rebuildBatchSize {
+			if err := flush(); err != nil {
+				return rebuilt, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return rebuilt, err
+	}
+	if err := flush(); err != nil {
+		return rebuilt, err
+	}
+
+	current, err := r.roleRepo.GetAll(nil)
+	if err != nil {
+		return rebuilt, err
+	}
+	if changed := changedRoles(roles, current); len(changed) > 0 {
+		if _, err := r.InvalidateEffectivePermissions(changed...); err != nil {
+			return rebuilt, err
+		}
+	}
+
+	return rebuilt, nil
+}
+
+// changedRoles retorna los IDs de los roles creados, eliminados o modificados entre before y after
+func changedRoles(before, after []*domain.Role) []string {
+	previous := make(map[string]*domain.Role, len(before))
+	for _, role := range before {
+		previous[role.ID.Hex()] = role
+	}
+
+	var changed []string
+	for _, role := range after {
+		id := role.ID.Hex()
+		old, ok := previous[id]
+		delete(previous, id)
+		if !ok || old.Version != role.Version ||
+			!slices.Equal(old.Permissions, role.Permissions) || !slices.Equal(old.ParentRoles, role.ParentRoles) {
+			changed = append(changed, id)
+		}
+	}
+	for id := range previous {
+		changed = append(changed, id)
+	}
+	return changed
+}
+
+// effectivePermissions combina sin duplicados los permisos específicos de la asignación y
+// los de sus roles (incluidos los heredados, que el llamador añade a roles). Nunca retorna nil: un conjunto vacío también se materializa.
+func effectivePermissions(userRole *domain.UserRole, roles []*domain.Role) []string {
+	// Conjunto para almacenar permisos únicos
+	permissionsSet := make(map[string]bool)
+	for _, p := range userRole.Permissions {
+		permissionsSet[p] = true
+	}
+	for _, role := range roles {
 		for _, p := range role.Permissions {
 			permissionsSet[p] = true
 		}
@@ -258,6 +775,41 @@ func (r *mongoUserRoleRepository) GetUserPermissions(userID string) ([]string, e
 	for p := range permissionsSet {
 		permissions = append(permissions, p)
 	}
+	return permissions
+}
 
-	return permissions, nil
+// roleLookup retorna un domain.RoleLookup que busca en roles, ya leídos, en lugar de en MongoDB
+func roleLookup(roles []*domain.Role) domain.RoleLookup {
+	rolesByID := make(map[string]*domain.Role, len(roles))
+	for _, role := range roles {
+		rolesByID[role.ID.Hex()] = role
+	}
+	return func(ids []string) ([]*domain.Role, error) {
+		found := make([]*domain.Role, 0, len(ids))
+		for _, id := range ids {
+			if role, ok := rolesByID[id]; ok {
+				found = append(found, role)
+			}
+		}
+		return found, nil
+	}
+}
+
+// withEffectiveInvalidation añade a la actualización el descarte del conjunto materializado
+// y el incremento de su revisión. Toda escritura que cambie roles o permisos de una
+// asignación debe pasar por aquí.
+func withEffectiveInvalidation(update bson.M) bson.M {
+	update["$unset"] = bson.M{"effective_permissions": ""}
+	update["$inc"] = bson.M{"effective_revision": 1}
+	return update
+}
+
+// effectiveRevisionFilter selecciona la asignación solo si no cambió desde que se leyó
+func effectiveRevisionFilter(userRole *domain.UserRole) bson.M {
+	filter := bson.M{"_id": userRole.ID, "effective_revision": userRole.EffectiveRevision}
+	if userRole.EffectiveRevision == 0 {
+		// Las asignaciones que nunca se modificaron no tienen el campo
+		filter["effective_revision"] = bson.M{"$in": bson.A{int64(0), nil}}
+	}
+	return filter
 }
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/black4ninja/mi-proyecto/internal/permission/domain"
+)
+
+func TestFindReferences(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("roles por nombre y asignaciones de usuario", func(mt *mtest.T) {
+		repo := NewMongoPermissionReferenceRepository(mt.Coll, mt.Coll, mt.Coll)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch,
+				bson.D{{Key: "name", Value: "editor"}},
+				bson.D{{Key: "name", Value: "viewer"}},
+			),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "n", Value: int32(3)}}),
+		)
+
+		references, err := repo.FindReferences("users:read")
+		require.NoError(mt, err)
+		assert.Equal(mt, &domain.PermissionReferences{Roles: []string{"editor", "viewer"}, UserAssignments: 3}, references)
+
+		find := mt.GetStartedEvent().Command
+		assert.Equal(mt, "users:read", find.Lookup("filter", "permissions").StringValue())
+		assert.Equal(mt, int32(1), find.Lookup("sort", "name").Int32())
+	})
+
+	mt.Run("sin referencias", func(mt *mtest.T) {
+		repo := NewMongoPermissionReferenceRepository(mt.Coll, mt.Coll, mt.Coll)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "n", Value: int32(0)}}),
+		)
+
+		references, err := repo.FindReferences("users:read")
+		require.NoError(mt, err)
+		assert.False(mt, references.InUse())
+	})
+}
+
+func TestDeleteCode(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	updateResponse := func(n int32) bson.D {
+		return mtest.CreateSuccessResponse(bson.E{Key: "n", Value: n}, bson.E{Key: "nModified", Value: n})
+	}
+
+	mt.Run("quita el código de roles y asignaciones en una transacción", func(mt *mtest.T) {
+		repo := NewMongoPermissionReferenceRepository(mt.Coll, mt.Coll, mt.Coll)
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: int32(1)}), // delete
+			updateResponse(2),
+			updateResponse(3),
+			updateResponse(4),
+			mtest.CreateSuccessResponse(), // commitTransaction
+		)
+
+		result, err := repo.DeleteCode("users:read")
+		require.NoError(mt, err)
+		assert.Equal(mt, &domain.PermissionDeleteResult{Code: "users:read", RolesUpdated: 2, UserRolesUpdated: 3}, result)
+
+		var updates []bson.Raw
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName == "update" {
+				updates = append(updates, event.Command)
+			}
+			// Todas las operaciones forman parte de la misma transacción
+			if event.CommandName != "endSessions" {
+				assert.NotNil(mt, event.Command.Lookup("txnNumber").Value, event.CommandName)
+			}
+		}
+		require.Len(mt, updates, 3)
+
+		for _, update := range updates[:2] {
+			statement := update.Lookup("updates").Array().Index(0).Value().Document()
+			assert.Equal(mt, "users:read", statement.Lookup("q", "permissions").StringValue())
+			assert.Equal(mt, "users:read", statement.Lookup("u", "$pull", "permissions").StringValue())
+		}
+		// Solo los roles incrementan su versión
+		assert.Contains(mt, updates[0].String(), `"version"`)
+		assert.NotContains(mt, updates[1].String(), `"version"`)
+
+		// Se descartan los permisos materializados que incluían el código
+		invalidation := updates[2].Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(mt, "users:read", invalidation.Lookup("q", "effective_permissions").StringValue())
+		_, unset := invalidation.Lookup("u", "$unset", "effective_permissions").StringValueOK()
+		assert.True(mt, unset)
+	})
+
+	mt.Run("permiso inexistente", func(mt *mtest.T) {
+		repo := NewMongoPermissionReferenceRepository(mt.Coll, mt.Coll, mt.Coll)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: int32(0)}), mtest.CreateSuccessResponse())
+
+		_, err := repo.DeleteCode("users:fly")
+		assert.ErrorIs(mt, err, domain.ErrPermissionNotFound)
+	})
+}
+
+func TestDeleteUnreferenced(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("sin referencias elimina el permiso en la misma transacción", func(mt *mtest.T) {
+		repo := NewMongoPermissionReferenceRepository(mt.Coll, mt.Coll, mt.Coll)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "n", Value: int32(0)}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: int32(1)}), // delete
+			mtest.CreateSuccessResponse(),                                  // commitTransaction
+		)
+
+		require.NoError(mt, repo.DeleteUnreferenced("users:export"))
+
+		var commands []string
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName == "endSessions" {
+				continue
+			}
+			commands = append(commands, event.CommandName)
+			// La consulta de referencias y la eliminación forman parte de la misma transacción
+			assert.NotNil(mt, event.Command.Lookup("txnNumber").Value, event.CommandName)
+		}
+		assert.Equal(mt, []string{"find", "aggregate", "delete", "commitTransaction"}, commands)
+	})
+
+	mt.Run("referenciado se rechaza sin eliminar", func(mt *mtest.T) {
+		repo := NewMongoPermissionReferenceRepository(mt.Coll, mt.Coll, mt.Coll)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "name", Value: "editor"}}),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "n", Value: int32(2)}}),
+			mtest.CreateSuccessResponse(), // abortTransaction
+		)
+
+		err := repo.DeleteUnreferenced("users:read")
+		var inUse *domain.PermissionInUseError
+		require.ErrorAs(mt, err, &inUse)
+		assert.Equal(mt, []string{"editor"}, inUse.Roles)
+		assert.Equal(mt, int64(2), inUse.UserAssignments)
+
+		for _, event := range mt.GetAllStartedEvents() {
+			assert.NotEqual(mt, "delete", event.CommandName)
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/black4ninja/mi-proyecto/internal/permission/domain"
+)
+
+func TestRenameCode(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	countResponse := func(mt *mtest.T, n int32) bson.D {
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		return mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "n", Value: n}})
+	}
+	updateResponse := func(n int32) bson.D {
+		return mtest.CreateSuccessResponse(bson.E{Key: "n", Value: n}, bson.E{Key: "nModified", Value: n})
+	}
+
+	mt.Run("reescribe roles y asignaciones en una transacción", func(mt *mtest.T) {
+		repo := NewMongoPermissionRenameRepository(mt.Coll, mt.Coll, mt.Coll)
+		mt.AddMockResponses(
+			countResponse(mt, 0),
+			updateResponse(1),
+			updateResponse(2),
+			updateResponse(3),
+			updateResponse(4),
+			mtest.CreateSuccessResponse(), // commitTransaction
+		)
+
+		result, err := repo.RenameCode("users:raed", "users:read")
+		require.NoError(mt, err)
+		assert.Equal(mt, &domain.PermissionRenameResult{
+			OldCode: "users:raed", NewCode: "users:read", RolesUpdated: 2, UserRolesUpdated: 3,
+		}, result)
+
+		var updates []bson.Raw
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName == "update" {
+				updates = append(updates, event.Command)
+			}
+			// Todas las operaciones forman parte de la misma transacción
+			if event.CommandName != "endSessions" {
+				assert.NotNil(mt, event.Command.Lookup("txnNumber").Value, event.CommandName)
+			}
+		}
+		require.Len(mt, updates, 4)
+
+		permission := updates[0].Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(mt, "users:raed", permission.Lookup("q", "code").StringValue())
+		assert.Equal(mt, "users:read", permission.Lookup("u", "$set", "code").StringValue())
+
+		for _, update := range updates[1:3] {
+			statement := update.Lookup("updates").Array().Index(0).Value().Document()
+			assert.Equal(mt, "users:raed", statement.Lookup("q", "permissions").StringValue())
+			assert.Contains(mt, statement.Lookup("u").String(), `"$setDifference"`)
+		}
+		// Solo los roles incrementan su versión
+		assert.Contains(mt, updates[1].String(), `"version"`)
+		assert.NotContains(mt, updates[2].String(), `"version"`)
+
+		// Se descartan los permisos materializados que incluían el código viejo
+		invalidation := updates[3].Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(mt, "users:raed", invalidation.Lookup("q", "effective_permissions").StringValue())
+		_, unset := invalidation.Lookup("u", "$unset", "effective_permissions").StringValueOK()
+		assert.True(mt, unset)
+	})
+
+	mt.Run("código en uso", func(mt *mtest.T) {
+		repo := NewMongoPermissionRenameRepository(mt.Coll, mt.Coll, mt.Coll)
+		mt.AddMockResponses(countResponse(mt, 1), mtest.CreateSuccessResponse())
+
+		_, err := repo.RenameCode("users:raed", "users:read")
+		assert.ErrorIs(mt, err, domain.ErrPermissionCodeExists)
+	})
+
+	mt.Run("permiso inexistente", func(mt *mtest.T) {
+		repo := NewMongoPermissionRenameRepository(mt.Coll, mt.Coll, mt.Coll)
+		mt.AddMockResponses(countResponse(mt, 0), updateResponse(0), mtest.CreateSuccessResponse())
+
+		_, err := repo.RenameCode("users:fly", "users:flight")
+		assert.ErrorIs(mt, err, domain.ErrPermissionNotFound)
+	})
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestGetByCodesArray(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("lista vacía o nil no consulta la base de datos", func(mt *mtest.T) {
+		repo := NewMongoPermissionRepository(mt.Coll)
+
+		// Sin respuestas simuladas: cualquier consulta fallaría
+		for _, codes := range [][]string{nil, {}} {
+			permissions, err := repo.GetByCodesArray(codes)
+			require.NoError(mt, err)
+			require.NotNil(mt, permissions)
+			assert.Empty(mt, permissions)
+		}
+		assert.Empty(mt, mt.GetAllStartedEvents())
+	})
+
+	mt.Run("sin coincidencias retorna lista vacía", func(mt *mtest.T) {
+		repo := NewMongoPermissionRepository(mt.Coll)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch))
+
+		permissions, err := repo.GetByCodesArray([]string{"no:existe"})
+		require.NoError(mt, err)
+		require.NotNil(mt, permissions)
+		assert.Empty(mt, permissions)
+	})
+
+	mt.Run("retorna los permisos encontrados", func(mt *mtest.T) {
+		repo := NewMongoPermissionRepository(mt.Coll)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch,
+			bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "code", Value: "users:read"}},
+		))
+
+		permissions, err := repo.GetByCodesArray([]string{"users:read"})
+		require.NoError(mt, err)
+		require.Len(mt, permissions, 1)
+		assert.Equal(mt, "users:read", permissions[0].Code)
+	})
+}
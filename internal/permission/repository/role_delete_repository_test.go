@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/black4ninja/mi-proyecto/internal/permission/domain"
+)
+
+func TestDeleteUnassigned(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	roleID := primitive.NewObjectID()
+
+	mt.Run("sin asignaciones elimina el rol en la misma transacción", func(mt *mtest.T) {
+		repo := NewMongoRoleDeleteRepository(mt.Coll, mt.Coll)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "_id", Value: roleID}, {Key: "name", Value: "editor"}}),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "n", Value: int32(0)}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: int32(1)}), // delete
+			mtest.CreateSuccessResponse(), // commitTransaction
+		)
+
+		require.NoError(mt, repo.DeleteUnassigned(roleID.Hex()))
+
+		var commands []string
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName == "endSessions" {
+				continue
+			}
+			commands = append(commands, event.CommandName)
+			// La cuenta de asignaciones y la eliminación forman parte de la misma transacción
+			assert.NotNil(mt, event.Command.Lookup("txnNumber").Value, event.CommandName)
+		}
+		assert.Equal(mt, []string{"find", "aggregate", "delete", "commitTransaction"}, commands)
+	})
+
+	mt.Run("asignado se rechaza sin eliminar", func(mt *mtest.T) {
+		repo := NewMongoRoleDeleteRepository(mt.Coll, mt.Coll)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "_id", Value: roleID}, {Key: "name", Value: "editor"}}),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "n", Value: int32(3)}}),
+			mtest.CreateSuccessResponse(), // abortTransaction
+		)
+
+		err := repo.DeleteUnassigned(roleID.Hex())
+		assert.ErrorIs(mt, err, domain.ErrRoleInUse)
+		assert.Contains(mt, err.Error(), "3 asignaciones")
+
+		for _, event := range mt.GetAllStartedEvents() {
+			assert.NotEqual(mt, "delete", event.CommandName)
+		}
+	})
+
+	mt.Run("rol inexistente", func(mt *mtest.T) {
+		repo := NewMongoRoleDeleteRepository(mt.Coll, mt.Coll)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch),
+			mtest.CreateSuccessResponse(), // abortTransaction
+		)
+
+		assert.ErrorIs(mt, repo.DeleteUnassigned(roleID.Hex()), domain.ErrRoleNotFound)
+		assert.ErrorIs(mt, repo.DeleteUnassigned("no-es-hex"), domain.ErrRoleNotFound)
+	})
+}
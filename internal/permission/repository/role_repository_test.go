@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/black4ninja/mi-proyecto/internal/permission/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestApplyPermissionDelta(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("aplica altas y bajas en una sola actualización", func(mt *mtest.T) {
+		repo := NewMongoRoleRepository(mt.Coll)
+		roleID := primitive.NewObjectID()
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{
+			{Key: "_id", Value: roleID},
+			{Key: "name", Value: "editor"},
+			{Key: "permissions", Value: bson.A{"users:read", "reports:read"}},
+		}}))
+
+		role, err := repo.ApplyPermissionDelta(roleID.Hex(), []string{"reports:read"}, []string{"users:write"})
+		require.NoError(mt, err)
+		assert.Equal(mt, []string{"users:read", "reports:read"}, role.Permissions)
+
+		// Una sola orden findAndModify con una actualización por pipeline que excluye roles de sistema
+		started := mt.GetStartedEvent()
+		require.NotNil(mt, started)
+		assert.Equal(mt, "findAndModify", started.CommandName)
+		_, isPipeline := started.Command.Lookup("update").ArrayOK()
+		assert.True(mt, isPipeline)
+		_, guardsSystem := started.Command.Lookup("query", "is_system").DocumentOK()
+		assert.True(mt, guardsSystem)
+	})
+
+	mt.Run("rol inexistente o de sistema", func(mt *mtest.T) {
+		repo := NewMongoRoleRepository(mt.Coll)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+
+		_, err := repo.ApplyPermissionDelta(primitive.NewObjectID().Hex(), nil, []string{"users:read"})
+		assert.EqualError(mt, err, "rol no encontrado")
+	})
+}
+
+func TestReplacePermissions(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("reemplaza el conjunto en una sola actualización", func(mt *mtest.T) {
+		repo := NewMongoRoleRepository(mt.Coll)
+		roleID := primitive.NewObjectID()
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{
+			{Key: "_id", Value: roleID},
+			{Key: "name", Value: "editor"},
+			{Key: "permissions", Value: bson.A{}},
+		}}))
+
+		role, err := repo.ReplacePermissions(roleID.Hex(), nil)
+		require.NoError(mt, err)
+		assert.Empty(mt, role.Permissions)
+
+		started := mt.GetStartedEvent()
+		require.NotNil(mt, started)
+		assert.Equal(mt, "findAndModify", started.CommandName)
+		// Un conjunto nulo se guarda como arreglo vacío
+		_, isArray := started.Command.Lookup("update", "$set", "permissions").ArrayOK()
+		assert.True(mt, isArray)
+		_, guardsSystem := started.Command.Lookup("query", "is_system").DocumentOK()
+		assert.True(mt, guardsSystem)
+	})
+
+	mt.Run("rol inexistente o de sistema", func(mt *mtest.T) {
+		repo := NewMongoRoleRepository(mt.Coll)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+
+		_, err := repo.ReplacePermissions(primitive.NewObjectID().Hex(), []string{"users:read"})
+		assert.EqualError(mt, err, "rol no encontrado")
+	})
+}
+
+func TestUpdateRole(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("guarda el updated_at del caso de uso", func(mt *mtest.T) {
+		repo := NewMongoRoleRepository(mt.Coll)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		roleID := primitive.NewObjectID()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "_id", Value: roleID}, {Key: "name", Value: "editor"}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+
+		// Cerca del final de un segundo, un updated_at tomado después caería en el siguiente
+		updatedAt := time.Date(2024, 3, 1, 10, 0, 0, 999_000_000, time.UTC)
+		role := &domain.Role{ID: roleID, Name: "editor", Version: 2, UpdatedAt: updatedAt}
+		require.NoError(mt, repo.Update(role))
+		assert.Equal(mt, int64(3), role.Version)
+
+		mt.GetStartedEvent() // findOne del rol existente
+		started := mt.GetStartedEvent()
+		require.NotNil(mt, started)
+		stored := started.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set", "updated_at").Time()
+		assert.True(mt, updatedAt.Equal(stored))
+
+		// El cliente que reenvía la fecha recibida en If-Unmodified-Since no recibe un 412
+		unmodifiedSince := role.UpdatedAt.Truncate(time.Second)
+		assert.NoError(mt, utils.Precondition{UnmodifiedSince: &unmodifiedSince}.Check(role.Version, stored))
+	})
+}
+
+func TestGetByID(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("rol inexistente", func(mt *mtest.T) {
+		repo := NewMongoRoleRepository(mt.Coll)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch))
+
+		_, err := repo.GetByID(primitive.NewObjectID().Hex())
+		assert.ErrorIs(mt, err, domain.ErrRoleNotFound)
+	})
+
+	mt.Run("un ID mal formado no corresponde a ningún rol", func(mt *mtest.T) {
+		repo := NewMongoRoleRepository(mt.Coll)
+
+		_, err := repo.GetByID("no-es-un-id")
+		assert.ErrorIs(mt, err, domain.ErrRoleNotFound)
+		assert.Nil(mt, mt.GetStartedEvent())
+	})
+}
+
+func TestGetByIDs(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("una sola consulta $in que conserva el orden solicitado", func(mt *mtest.T) {
+		repo := NewMongoRoleRepository(mt.Coll)
+		first, second, missing := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		// MongoDB devuelve los documentos en su propio orden
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: second}, {Key: "name", Value: "editor"}},
+				bson.D{{Key: "_id", Value: first}, {Key: "name", Value: "lector"}},
+			),
+		)
+
+		roles, err := repo.GetByIDs([]string{first.Hex(), "no-es-un-id", missing.Hex(), second.Hex(), first.Hex()})
+		require.NoError(mt, err)
+		require.Len(mt, roles, 2)
+		assert.Equal(mt, "lector", roles[0].Name)
+		assert.Equal(mt, "editor", roles[1].Name)
+
+		started := mt.GetStartedEvent()
+		require.NotNil(mt, started)
+		assert.Equal(mt, "find", started.CommandName)
+		ids := started.Command.Lookup("filter", "_id", "$in").Array()
+		values, err := ids.Values()
+		require.NoError(mt, err)
+		// El ID inválido no se envía
+		assert.Len(mt, values, 4)
+	})
+
+	mt.Run("sin IDs válidos no consulta", func(mt *mtest.T) {
+		repo := NewMongoRoleRepository(mt.Coll)
+
+		roles, err := repo.GetByIDs([]string{"no-es-un-id"})
+		require.NoError(mt, err)
+		assert.Empty(mt, roles)
+		assert.Nil(mt, mt.GetStartedEvent())
+	})
+}
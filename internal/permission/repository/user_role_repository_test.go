@@ -0,0 +1,674 @@
+package repository
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestEnsureForUser(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("crea la asignación si no existe", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), false)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(
+			bson.E{Key: "n", Value: 1},
+			bson.E{Key: "nModified", Value: 0},
+			bson.E{Key: "upserted", Value: bson.A{bson.D{{Key: "index", Value: 0}, {Key: "_id", Value: primitive.NewObjectID()}}}},
+		))
+
+		created, err := repo.EnsureForUser("nuevo")
+		require.NoError(mt, err)
+		assert.True(mt, created)
+
+		// La operación es un upsert que solo inicializa campos al insertar
+		started := mt.GetStartedEvent()
+		require.NotNil(mt, started)
+		update := started.Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.True(mt, update.Lookup("upsert").Boolean())
+		_, hasSetOnInsert := update.Lookup("u").Document().Lookup("$setOnInsert").DocumentOK()
+		assert.True(mt, hasSetOnInsert)
+	})
+
+	mt.Run("crea la asignación con los roles iniciales en el mismo upsert", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), false)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(
+			bson.E{Key: "n", Value: 1},
+			bson.E{Key: "nModified", Value: 0},
+			bson.E{Key: "upserted", Value: bson.A{bson.D{{Key: "index", Value: 0}, {Key: "_id", Value: primitive.NewObjectID()}}}},
+		))
+
+		created, err := repo.EnsureForUser("nuevo", "rol-1", "rol-2")
+		require.NoError(mt, err)
+		assert.True(mt, created)
+
+		started := mt.GetStartedEvent()
+		require.NotNil(mt, started)
+		update := started.Command.Lookup("updates").Array().Index(0).Value().Document()
+		roles, err := update.Lookup("u", "$setOnInsert", "roles").Array().Values()
+		require.NoError(mt, err)
+		require.Len(mt, roles, 2)
+		assert.Equal(mt, "rol-1", roles[0].StringValue())
+		assert.Equal(mt, "rol-2", roles[1].StringValue())
+		assert.Nil(mt, mt.GetStartedEvent(), "una sola escritura")
+	})
+
+	mt.Run("no modifica una asignación existente", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), false)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(
+			bson.E{Key: "n", Value: 1},
+			bson.E{Key: "nModified", Value: 0},
+		))
+
+		created, err := repo.EnsureForUser("existente")
+		require.NoError(mt, err)
+		assert.False(mt, created)
+	})
+}
+
+func TestEnsureForUsers(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("crea en una escritura las asignaciones que faltan", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), false)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(
+			bson.E{Key: "n", Value: 3},
+			bson.E{Key: "nModified", Value: 0},
+			bson.E{Key: "upserted", Value: bson.A{
+				bson.D{{Key: "index", Value: 0}, {Key: "_id", Value: primitive.NewObjectID()}},
+				bson.D{{Key: "index", Value: 2}, {Key: "_id", Value: primitive.NewObjectID()}},
+			}},
+		))
+
+		created, err := repo.EnsureForUsers([]string{"nuevo-1", "existente", "nuevo-2"})
+		require.NoError(mt, err)
+		assert.Equal(mt, []string{"nuevo-1", "nuevo-2"}, created)
+
+		started := mt.GetStartedEvent()
+		require.NotNil(mt, started)
+		assert.Equal(mt, "update", started.CommandName)
+		updates, err := started.Command.Lookup("updates").Array().Values()
+		require.NoError(mt, err)
+		require.Len(mt, updates, 3)
+		for _, update := range updates {
+			assert.True(mt, update.Document().Lookup("upsert").Boolean())
+		}
+		assert.Nil(mt, mt.GetStartedEvent(), "una sola escritura")
+	})
+
+	mt.Run("sin usuarios no escribe", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), false)
+
+		created, err := repo.EnsureForUsers(nil)
+		require.NoError(mt, err)
+		assert.Empty(mt, created)
+		assert.Nil(mt, mt.GetStartedEvent())
+	})
+}
+
+func TestRemoveRoleFromAll(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("quita el rol de todas las asignaciones", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), false)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(
+			bson.E{Key: "n", Value: 3},
+			bson.E{Key: "nModified", Value: 3},
+		))
+
+		modified, err := repo.RemoveRoleFromAll("rol-1")
+		require.NoError(mt, err)
+		assert.Equal(mt, int64(3), modified)
+
+		// Una sola actualización múltiple que retira el ID con $pull
+		started := mt.GetStartedEvent()
+		require.NotNil(mt, started)
+		update := started.Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.True(mt, update.Lookup("multi").Boolean())
+		assert.Equal(mt, "rol-1", update.Lookup("q", "roles").StringValue())
+		assert.Equal(mt, "rol-1", update.Lookup("u", "$pull", "roles").StringValue())
+	})
+}
+
+func TestDeleteByUserID(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("elimina la asignación por user_id", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), false)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+
+		require.NoError(mt, repo.DeleteByUserID("borrado"))
+
+		started := mt.GetStartedEvent()
+		require.NotNil(mt, started)
+		deletion := started.Command.Lookup("deletes").Array().Index(0).Value().Document()
+		assert.Equal(mt, "borrado", deletion.Lookup("q", "user_id").StringValue())
+	})
+}
+
+func TestFindByUserID(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("sin asignación no la crea", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), false)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.user_roles", mtest.FirstBatch))
+
+		userRole, err := repo.FindByUserID("nuevo")
+		require.NoError(mt, err)
+		assert.Equal(mt, "nuevo", userRole.UserID)
+		assert.Empty(mt, userRole.Roles)
+
+		var commands []string
+		for started := mt.GetStartedEvent(); started != nil; started = mt.GetStartedEvent() {
+			commands = append(commands, started.CommandName)
+		}
+		assert.Equal(mt, []string{"find"}, commands, "solo se consulta, sin insertar")
+	})
+}
+
+func TestGetUsersByRole(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("obtiene los usuarios de las asignaciones que incluyen el rol", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), false)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "n", Value: int32(7)}}),
+			mtest.CreateCursorResponse(1, ns, mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "user_id", Value: "ana"}},
+				bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "user_id", Value: "luis"}},
+			),
+			mtest.CreateCursorResponse(0, ns, mtest.NextBatch),
+		)
+
+		userIDs, total, err := repo.GetUsersByRole("rol-1", 2, 2)
+		require.NoError(mt, err)
+		assert.Equal(mt, []string{"ana", "luis"}, userIDs)
+		assert.Equal(mt, int64(7), total)
+
+		// Consulta por el ID del rol dentro del arreglo, ordenada, paginada y solo con el user_id
+		started := mt.GetAllStartedEvents()[1]
+		assert.Equal(mt, int64(2), started.Command.Lookup("skip").AsInt64())
+		assert.Equal(mt, int64(2), started.Command.Lookup("limit").AsInt64())
+		assert.Equal(mt, "rol-1", started.Command.Lookup("filter", "roles").StringValue())
+		// Excluye las asignaciones en las que el rol ya venció
+		expired := started.Command.Lookup("filter", "role_expirations", "$not", "$elemMatch")
+		assert.Equal(mt, "rol-1", expired.Document().Lookup("role_id").StringValue())
+		_, hasLte := expired.Document().Lookup("expires_at").Document().LookupErr("$lte")
+		assert.NoError(mt, hasLte)
+		assert.Equal(mt, int32(1), started.Command.Lookup("sort", "user_id").Int32())
+		_, hasUserID := started.Command.Lookup("projection").Document().LookupErr("user_id")
+		assert.NoError(mt, hasUserID)
+	})
+
+	mt.Run("rol sin asignaciones", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), false)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "n", Value: int32(0)}}),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch),
+		)
+
+		userIDs, total, err := repo.GetUsersByRole("rol-1", 0, 20)
+		require.NoError(mt, err)
+		assert.Zero(mt, total)
+		assert.NotNil(mt, userIDs)
+		assert.Empty(mt, userIDs)
+	})
+}
+
+func TestEffectivePermissions(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	roleID := primitive.NewObjectID()
+	userRoleID := primitive.NewObjectID()
+	cursor := func(mt *mtest.T, docs ...bson.D) bson.D {
+		return mtest.CreateCursorResponse(0, mt.Coll.Database().Name()+"."+mt.Coll.Name(), mtest.FirstBatch, docs...)
+	}
+	userRoleDoc := func(effective interface{}, revision int64) bson.D {
+		return bson.D{
+			{Key: "_id", Value: userRoleID},
+			{Key: "user_id", Value: "usuario-1"},
+			{Key: "roles", Value: bson.A{roleID.Hex()}},
+			{Key: "permissions", Value: bson.A{"ventas:read"}},
+			{Key: "effective_permissions", Value: effective},
+			{Key: "effective_revision", Value: revision},
+		}
+	}
+	roleDoc := bson.D{{Key: "_id", Value: roleID}, {Key: "permissions", Value: bson.A{"finanzas:read", "ventas:read"}}}
+
+	mt.Run("lee el conjunto materializado sin consultar los roles", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), true)
+		mt.AddMockResponses(cursor(mt, userRoleDoc(bson.A{"finanzas:read", "ventas:read"}, 2)))
+
+		permissions, err := repo.GetUserPermissions("usuario-1")
+		require.NoError(mt, err)
+		assert.ElementsMatch(mt, []string{"finanzas:read", "ventas:read"}, permissions)
+		assert.Len(mt, mt.GetAllStartedEvents(), 1)
+	})
+
+	mt.Run("calcula y guarda el conjunto si falta", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), true)
+		mt.AddMockResponses(
+			cursor(mt, userRoleDoc(nil, 3)),
+			cursor(mt, roleDoc),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+
+		permissions, err := repo.GetUserPermissions("usuario-1")
+		require.NoError(mt, err)
+		assert.ElementsMatch(mt, []string{"finanzas:read", "ventas:read"}, permissions)
+
+		events := mt.GetAllStartedEvents()
+		require.Len(mt, events, 3)
+		update := events[2].Command.Lookup("updates").Array().Index(0).Value().Document()
+		// Solo se guarda si la asignación no cambió desde que se leyó
+		assert.Equal(mt, userRoleID, update.Lookup("q", "_id").ObjectID())
+		assert.Equal(mt, int64(3), update.Lookup("q", "effective_revision").Int64())
+		stored, err := update.Lookup("u", "$set", "effective_permissions").Array().Values()
+		require.NoError(mt, err)
+		assert.Len(mt, stored, 2)
+	})
+
+	mt.Run("sin materialización ignora el conjunto guardado", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), false)
+		mt.AddMockResponses(cursor(mt, userRoleDoc(bson.A{"obsoleto:read"}, 1)), cursor(mt, roleDoc))
+
+		permissions, err := repo.GetUserPermissions("usuario-1")
+		require.NoError(mt, err)
+		assert.ElementsMatch(mt, []string{"finanzas:read", "ventas:read"}, permissions)
+		assert.Len(mt, mt.GetAllStartedEvents(), 2)
+	})
+
+	mt.Run("las modificaciones descartan el conjunto", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), true)
+		success := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1})
+		mt.AddMockResponses(success, success, success)
+
+		require.NoError(mt, repo.RemoveRole("usuario-1", roleID.Hex()))
+		require.NoError(mt, repo.RemovePermission("usuario-1", "ventas:read"))
+		_, err := repo.InvalidateEffectivePermissions(roleID.Hex())
+		require.NoError(mt, err)
+
+		events := mt.GetAllStartedEvents()
+		require.Len(mt, events, 3)
+		for _, event := range events {
+			update := event.Command.Lookup("updates").Array().Index(0).Value().Document()
+			_, unset := update.Lookup("u", "$unset", "effective_permissions").StringValueOK()
+			assert.True(mt, unset)
+			assert.Equal(mt, int32(1), update.Lookup("u", "$inc", "effective_revision").Int32())
+		}
+		// La invalidación por rol alcanza a todas las asignaciones que lo incluyen
+		invalidation := events[2].Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.True(mt, invalidation.Lookup("multi").Boolean())
+		assert.Equal(mt, roleID.Hex(), invalidation.Lookup("q", "roles").StringValue())
+	})
+
+	mt.Run("incluye los permisos de los roles heredados", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), false)
+		parentID := primitive.NewObjectID()
+		child := bson.D{
+			{Key: "_id", Value: roleID},
+			{Key: "permissions", Value: bson.A{"finanzas:read"}},
+			{Key: "parent_roles", Value: bson.A{parentID.Hex()}},
+		}
+		// El padre hereda a su vez del hijo: el ciclo no se vuelve a consultar
+		parent := bson.D{
+			{Key: "_id", Value: parentID},
+			{Key: "permissions", Value: bson.A{"finanzas:write"}},
+			{Key: "parent_roles", Value: bson.A{roleID.Hex()}},
+		}
+		mt.AddMockResponses(cursor(mt, userRoleDoc(nil, 0)), cursor(mt, child), cursor(mt, parent))
+
+		permissions, err := repo.GetUserPermissions("usuario-1")
+		require.NoError(mt, err)
+		assert.ElementsMatch(mt, []string{"finanzas:read", "finanzas:write", "ventas:read"}, permissions)
+		assert.Len(mt, mt.GetAllStartedEvents(), 3)
+	})
+
+	mt.Run("la invalidación de varios roles usa un único filtro", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), true)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}, bson.E{Key: "nModified", Value: 2}))
+
+		modified, err := repo.InvalidateEffectivePermissions(roleID.Hex(), "otro-rol")
+		require.NoError(mt, err)
+		assert.Equal(mt, int64(2), modified)
+
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		values, err := update.Lookup("q", "roles", "$in").Array().Values()
+		require.NoError(mt, err)
+		assert.Len(mt, values, 2)
+
+		// Sin roles no hay nada que invalidar
+		modified, err = repo.InvalidateEffectivePermissions()
+		require.NoError(mt, err)
+		assert.Zero(mt, modified)
+	})
+
+	mt.Run("la reconstrucción recalcula todas las asignaciones", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), true)
+		withoutRoles := bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "roles", Value: bson.A{}},
+			{Key: "permissions", Value: bson.A{}},
+		}
+		mt.AddMockResponses(
+			cursor(mt, roleDoc),
+			cursor(mt, userRoleDoc(bson.A{"obsoleto:read"}, 5), withoutRoles),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}, bson.E{Key: "nModified", Value: 2}),
+			cursor(mt, roleDoc),
+		)
+
+		rebuilt, err := repo.RebuildEffectivePermissions()
+		require.NoError(mt, err)
+		assert.Equal(mt, int64(2), rebuilt)
+
+		// Sin roles modificados durante la reconstrucción no se invalida nada
+		events := mt.GetAllStartedEvents()
+		require.Len(mt, events, 4)
+		statements, err := events[2].Command.Lookup("updates").Array().Values()
+		require.NoError(mt, err)
+		require.Len(mt, statements, 2)
+
+		first := statements[0].Document()
+		assert.Equal(mt, int64(5), first.Lookup("q", "effective_revision").Int64())
+		values, err := first.Lookup("u", "$set", "effective_permissions").Array().Values()
+		require.NoError(mt, err)
+		var stored []string
+		for _, value := range values {
+			stored = append(stored, value.StringValue())
+		}
+		sort.Strings(stored)
+		assert.Equal(mt, []string{"finanzas:read", "ventas:read"}, stored)
+
+		// Una asignación sin roles ni permisos también se materializa, como conjunto vacío
+		second := statements[1].Document()
+		_, hasRevision := second.Lookup("q", "effective_revision", "$in").ArrayOK()
+		assert.True(mt, hasRevision)
+		empty, err := second.Lookup("u", "$set", "effective_permissions").Array().Values()
+		require.NoError(mt, err)
+		assert.Empty(mt, empty)
+	})
+
+	mt.Run("invalida las asignaciones de un rol modificado durante la reconstrucción", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), true)
+		updatedRole := bson.D{
+			{Key: "_id", Value: roleID},
+			{Key: "permissions", Value: bson.A{"finanzas:read"}},
+			{Key: "version", Value: int64(1)},
+		}
+		mt.AddMockResponses(
+			cursor(mt, roleDoc),
+			cursor(mt, userRoleDoc(nil, 0)),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			cursor(mt, updatedRole),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+
+		_, err := repo.RebuildEffectivePermissions()
+		require.NoError(mt, err)
+
+		events := mt.GetAllStartedEvents()
+		require.Len(mt, events, 5)
+		invalidation := events[4].Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(mt, roleID.Hex(), invalidation.Lookup("q", "roles").StringValue())
+		assert.Equal(mt, int64(1), invalidation.Lookup("u", "$inc", "effective_revision").AsInt64())
+	})
+}
+
+func TestGetPermissionsByUserIDs(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	cursor := func(mt *mtest.T, docs ...bson.D) bson.D {
+		return mtest.CreateCursorResponse(0, mt.Coll.Database().Name()+"."+mt.Coll.Name(), mtest.FirstBatch, docs...)
+	}
+	editorID := primitive.NewObjectID()
+	viewerID := primitive.NewObjectID()
+	userRoleDoc := func(userID string, roles bson.A, permissions bson.A, effective interface{}) bson.D {
+		return bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "user_id", Value: userID},
+			{Key: "roles", Value: roles},
+			{Key: "permissions", Value: permissions},
+			{Key: "effective_permissions", Value: effective},
+		}
+	}
+	editor := bson.D{
+		{Key: "_id", Value: editorID},
+		{Key: "permissions", Value: bson.A{"users:write"}},
+		{Key: "parent_roles", Value: bson.A{viewerID.Hex()}},
+	}
+	viewer := bson.D{{Key: "_id", Value: viewerID}, {Key: "permissions", Value: bson.A{"users:read"}}}
+
+	mt.Run("resuelve todos los usuarios con consultas compartidas", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), true)
+		mt.AddMockResponses(
+			cursor(mt,
+				userRoleDoc("ana", bson.A{editorID.Hex()}, bson.A{"audit:read"}, nil),
+				userRoleDoc("luis", bson.A{viewerID.Hex()}, bson.A{}, nil),
+				userRoleDoc("eva", bson.A{editorID.Hex()}, bson.A{}, bson.A{"reports:read"}),
+			),
+			cursor(mt, editor, viewer),
+			cursor(mt, viewer),
+		)
+
+		permissions, err := repo.GetPermissionsByUserIDs([]string{"ana", "luis", "eva", "sin-asignacion"})
+		require.NoError(mt, err)
+		require.Len(mt, permissions, 4)
+		assert.ElementsMatch(mt, []string{"audit:read", "users:write", "users:read"}, permissions["ana"])
+		assert.ElementsMatch(mt, []string{"users:read"}, permissions["luis"])
+		// El conjunto materializado se usa tal cual
+		assert.Equal(mt, []string{"reports:read"}, permissions["eva"])
+		assert.Equal(mt, []string{}, permissions["sin-asignacion"])
+
+		// Una consulta de asignaciones y una de roles por nivel de herencia, sin importar cuántos
+		// usuarios haya; los conjuntos calculados no se guardan
+		events := mt.GetAllStartedEvents()
+		require.Len(mt, events, 3)
+		values, err := events[0].Command.Lookup("filter", "user_id", "$in").Array().Values()
+		require.NoError(mt, err)
+		assert.Len(mt, values, 4)
+	})
+
+	mt.Run("sin usuarios no consulta", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), false)
+
+		permissions, err := repo.GetPermissionsByUserIDs(nil)
+		require.NoError(mt, err)
+		assert.Empty(mt, permissions)
+		assert.Empty(mt, mt.GetAllStartedEvents())
+	})
+}
+
+func TestRoleExpiry(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	cursor := func(mt *mtest.T, docs ...bson.D) bson.D {
+		return mtest.CreateCursorResponse(0, mt.Coll.Database().Name()+"."+mt.Coll.Name(), mtest.FirstBatch, docs...)
+	}
+	success := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1})
+	contractorID := primitive.NewObjectID()
+	staffID := primitive.NewObjectID()
+	userRoleID := primitive.NewObjectID()
+	userRoleDoc := func(roles bson.A, expirations bson.A, effective interface{}) bson.D {
+		return bson.D{
+			{Key: "_id", Value: userRoleID},
+			{Key: "user_id", Value: "ana"},
+			{Key: "roles", Value: roles},
+			{Key: "permissions", Value: bson.A{}},
+			{Key: "role_expirations", Value: expirations},
+			{Key: "effective_permissions", Value: effective},
+			{Key: "effective_revision", Value: int64(4)},
+		}
+	}
+	expiration := func(roleID primitive.ObjectID, expiresAt time.Time) bson.D {
+		return bson.D{{Key: "role_id", Value: roleID.Hex()}, {Key: "expires_at", Value: expiresAt}}
+	}
+	roleDoc := func(id primitive.ObjectID, permissions ...interface{}) bson.D {
+		return bson.D{{Key: "_id", Value: id}, {Key: "permissions", Value: bson.A(permissions)}}
+	}
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	mt.Run("asigna el rol con vencimiento", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), false)
+		mt.AddMockResponses(cursor(mt, roleDoc(contractorID)), cursor(mt, userRoleDoc(bson.A{}, bson.A{}, nil)), success)
+
+		require.NoError(mt, repo.AddRoleWithExpiry("ana", contractorID.Hex(), &future))
+
+		update := mt.GetAllStartedEvents()[2].Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(mt, contractorID.Hex(), update.Lookup("u", "$push", "roles").StringValue())
+		assert.Equal(mt, contractorID.Hex(), update.Lookup("u", "$push", "role_expirations", "role_id").StringValue())
+		assert.Equal(mt, future.UnixMilli(), update.Lookup("u", "$push", "role_expirations", "expires_at").DateTime())
+	})
+
+	mt.Run("un rol que no vence no se vuelve a asignar sin vencimiento", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), false)
+		mt.AddMockResponses(
+			cursor(mt, roleDoc(contractorID)),
+			cursor(mt, userRoleDoc(bson.A{contractorID.Hex()}, bson.A{}, nil)),
+		)
+
+		assert.Error(mt, repo.AddRoleWithExpiry("ana", contractorID.Hex(), nil))
+		assert.Len(mt, mt.GetAllStartedEvents(), 2)
+	})
+
+	mt.Run("actualiza el vencimiento de un rol vigente", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), false)
+		later := future.Add(24 * time.Hour)
+		mt.AddMockResponses(
+			cursor(mt, roleDoc(contractorID)),
+			cursor(mt, userRoleDoc(bson.A{contractorID.Hex()}, bson.A{expiration(contractorID, future)}, nil)),
+			success,
+		)
+
+		require.NoError(mt, repo.AddRoleWithExpiry("ana", contractorID.Hex(), &later))
+
+		update := mt.GetAllStartedEvents()[2].Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(mt, contractorID.Hex(), update.Lookup("q", "role_expirations.role_id").StringValue())
+		assert.Equal(mt, later.UnixMilli(), update.Lookup("u", "$set", "role_expirations.$.expires_at").DateTime())
+	})
+
+	mt.Run("quita el vencimiento de un rol vigente", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), false)
+		mt.AddMockResponses(
+			cursor(mt, roleDoc(contractorID)),
+			cursor(mt, userRoleDoc(bson.A{contractorID.Hex()}, bson.A{expiration(contractorID, future)}, nil)),
+			success,
+		)
+
+		require.NoError(mt, repo.AddRoleWithExpiry("ana", contractorID.Hex(), nil))
+
+		update := mt.GetAllStartedEvents()[2].Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(mt, contractorID.Hex(), update.Lookup("u", "$pull", "role_expirations", "role_id").StringValue())
+	})
+
+	mt.Run("añade vencimiento a un rol que no vencía", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), false)
+		mt.AddMockResponses(
+			cursor(mt, roleDoc(contractorID)),
+			cursor(mt, userRoleDoc(bson.A{contractorID.Hex()}, bson.A{}, nil)),
+			success,
+		)
+
+		require.NoError(mt, repo.AddRoleWithExpiry("ana", contractorID.Hex(), &future))
+
+		update := mt.GetAllStartedEvents()[2].Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(mt, contractorID.Hex(), update.Lookup("q", "role_expirations.role_id", "$ne").StringValue())
+		assert.Equal(mt, future.UnixMilli(), update.Lookup("u", "$push", "role_expirations", "expires_at").DateTime())
+		_, pushesRole := update.Lookup("u", "$push").Document().LookupErr("roles")
+		assert.Error(mt, pushesRole)
+	})
+
+	mt.Run("renueva un rol vencido", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), false)
+		mt.AddMockResponses(
+			cursor(mt, roleDoc(contractorID)),
+			cursor(mt, userRoleDoc(bson.A{contractorID.Hex()}, bson.A{expiration(contractorID, past)}, nil)),
+			success,
+		)
+
+		require.NoError(mt, repo.AddRoleWithExpiry("ana", contractorID.Hex(), &future))
+
+		update := mt.GetAllStartedEvents()[2].Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(mt, contractorID.Hex(), update.Lookup("q", "role_expirations.role_id").StringValue())
+		assert.Equal(mt, future.UnixMilli(), update.Lookup("u", "$set", "role_expirations.$.expires_at").DateTime())
+		_, unset := update.Lookup("u", "$unset", "effective_permissions").StringValueOK()
+		assert.True(mt, unset)
+	})
+
+	mt.Run("los roles vencidos no otorgan permisos", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), true)
+		// El conjunto materializado se calculó cuando el rol aún estaba vigente
+		mt.AddMockResponses(
+			cursor(mt, userRoleDoc(
+				bson.A{contractorID.Hex(), staffID.Hex()},
+				bson.A{expiration(contractorID, past), expiration(staffID, future)},
+				bson.A{"reports:read", "users:read"},
+			)),
+			cursor(mt, roleDoc(staffID, "users:read")),
+			success,
+		)
+
+		permissions, err := repo.GetUserPermissions("ana")
+		require.NoError(mt, err)
+		assert.Equal(mt, []string{"users:read"}, permissions)
+
+		// Solo se consulta el rol vigente
+		ids, err := mt.GetAllStartedEvents()[1].Command.Lookup("filter", "_id", "$in").Array().Values()
+		require.NoError(mt, err)
+		require.Len(mt, ids, 1)
+		assert.Equal(mt, staffID, ids[0].ObjectID())
+	})
+
+	mt.Run("el barrido quita los roles vencidos", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), false)
+		mt.AddMockResponses(
+			cursor(mt, userRoleDoc(
+				bson.A{contractorID.Hex(), staffID.Hex()},
+				bson.A{expiration(contractorID, past), expiration(staffID, future)},
+				nil,
+			)),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+
+		now := time.Now()
+		modified, err := repo.RemoveExpiredRoles(now)
+		require.NoError(mt, err)
+		assert.Equal(mt, int64(1), modified)
+
+		events := mt.GetAllStartedEvents()
+		require.Len(mt, events, 2)
+		assert.Equal(mt, now.UnixMilli(), events[0].Command.Lookup("filter", "role_expirations.expires_at", "$lte").DateTime())
+
+		update := events[1].Command.Lookup("updates").Array().Index(0).Value().Document()
+		// Solo si la asignación no cambió desde que se leyó
+		assert.Equal(mt, userRoleID, update.Lookup("q", "_id").ObjectID())
+		assert.Equal(mt, int64(4), update.Lookup("q", "effective_revision").Int64())
+		roles, err := update.Lookup("u", "$pull", "roles", "$in").Array().Values()
+		require.NoError(mt, err)
+		require.Len(mt, roles, 1)
+		assert.Equal(mt, contractorID.Hex(), roles[0].StringValue())
+		expirations, err := update.Lookup("u", "$pull", "role_expirations", "role_id", "$in").Array().Values()
+		require.NoError(mt, err)
+		assert.Len(mt, expirations, 1)
+		_, unset := update.Lookup("u", "$unset", "effective_permissions").StringValueOK()
+		assert.True(mt, unset)
+	})
+
+	mt.Run("quitar un rol quita su vencimiento", func(mt *mtest.T) {
+		repo := NewMongoUserRoleRepository(mt.Coll, NewMongoRoleRepository(mt.Coll), false)
+		mt.AddMockResponses(success)
+
+		require.NoError(mt, repo.RemoveRole("ana", contractorID.Hex()))
+
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(mt, contractorID.Hex(), update.Lookup("u", "$pull", "role_expirations", "role_id").StringValue())
+	})
+}
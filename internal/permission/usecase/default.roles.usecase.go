@@ -0,0 +1,86 @@
+package usecase
+
+import (
+	"fmt"
+
+	"github.com/black4ninja/mi-proyecto/internal/permission/domain"
+)
+
+// defaultRolesUseCase extiende el caso de uso de roles de usuario para crear la asignación de un
+// usuario nuevo con los roles por defecto
+type defaultRolesUseCase struct {
+	domain.UserRoleUseCase
+	userRoleRepo domain.UserRoleRepository
+	roleIDs      []string
+	recorder     domain.PermissionChangeRecorder
+}
+
+// WithDefaultRoles retorna userRoles con EnsureUserRole y EnsureUserRoles extendidos: la
+// asignación de un usuario que no la tenía se crea ya con los roles indicados por nombre, en el
+// mismo upsert, por lo que no puede quedar creada sin ellos. Los roles deben existir; si alguno
+// no existe retorna ErrInvalidRole. Sin nombres retorna userRoles sin cambios. Con
+// WithChangeRecorder cada rol asignado se registra con SystemActor.
+func WithDefaultRoles(
+	userRoles domain.UserRoleUseCase,
+	roleRepo domain.RoleRepository,
+	userRoleRepo domain.UserRoleRepository,
+	roleNames []string,
+	opts ...Option,
+) (domain.UserRoleUseCase, error) {
+	if len(roleNames) == 0 {
+		return userRoles, nil
+	}
+
+	roleIDs := make([]string, 0, len(roleNames))
+	for _, name := range roleNames {
+		role, err := roleRepo.GetByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: rol por defecto %q: %w", domain.ErrInvalidRole, name, err)
+		}
+		roleIDs = append(roleIDs, role.ID.Hex())
+	}
+
+	return &defaultRolesUseCase{
+		UserRoleUseCase: userRoles,
+		userRoleRepo:    userRoleRepo,
+		roleIDs:         roleIDs,
+		recorder:        newOptions(opts).recorder,
+	}, nil
+}
+
+// EnsureUserRole crea la asignación del usuario con los roles por defecto si no existe. Un
+// usuario que ya tenía asignación conserva sus roles.
+func (u *defaultRolesUseCase) EnsureUserRole(userID string) (bool, error) {
+	created, err := u.userRoleRepo.EnsureForUser(userID, u.roleIDs...)
+	if err != nil {
+		return false, fmt.Errorf("asegurar asignación del usuario %s: %w", userID, err)
+	}
+	if !created {
+		return false, nil
+	}
+	return true, u.recordDefaultRoles(userID)
+}
+
+// EnsureUserRoles crea en lote las asignaciones faltantes con los roles por defecto
+func (u *defaultRolesUseCase) EnsureUserRoles(userIDs []string) ([]string, error) {
+	created, err := u.userRoleRepo.EnsureForUsers(userIDs, u.roleIDs...)
+	if err != nil {
+		return nil, fmt.Errorf("asegurar asignaciones de %d usuarios: %w", len(userIDs), err)
+	}
+	for _, userID := range created {
+		if err := u.recordDefaultRoles(userID); err != nil {
+			return created, err
+		}
+	}
+	return created, nil
+}
+
+// recordDefaultRoles registra cada rol por defecto con el que se creó la asignación del usuario
+func (u *defaultRolesUseCase) recordDefaultRoles(userID string) error {
+	for _, roleID := range u.roleIDs {
+		if err := recordSystemChange(u.recorder, domain.ChangeRoleAssign, "user:"+userID, "role="+roleID+" default=true"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
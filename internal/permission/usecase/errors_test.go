@@ -0,0 +1,82 @@
+package usecase
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/black4ninja/mi-proyecto/internal/permission/domain"
+)
+
+func TestPermissionUseCaseSentinelErrors(t *testing.T) {
+	uc := NewPermissionUseCase(newFakePermissionRepo("users:read"), newFakeUserRoleRepo(), nil, nil)
+
+	_, err := uc.CreatePermission(nil, &domain.CreatePermissionRequest{Code: "users:read", Module: "users", Action: "read", Name: "Leer"})
+	assert.ErrorIs(t, err, domain.ErrPermissionCodeExists)
+
+	_, err = uc.GetPermission("desconocido")
+	assert.ErrorIs(t, err, errPermissionNotFound, "la causa del repositorio se conserva")
+}
+
+func TestRoleUseCaseWrapsCauses(t *testing.T) {
+	systemRole := &domain.Role{Name: "admin", IsSystem: true}
+	uc := NewRoleUseCase(newFakeRoleRepo(systemRole), newFakePermissionRepo("users:read"), newFakeUserRoleRepo(), domain.RoleDeleteCleanup)
+
+	t.Run("permiso inexistente", func(t *testing.T) {
+		_, err := uc.CreateRole(nil, &domain.CreateRoleRequest{Name: "editor", Permissions: []string{"users:read", "users:fly"}})
+
+		require.Error(t, err)
+		assert.ErrorIs(t, err, domain.ErrInvalidPermission)
+		assert.ErrorIs(t, err, errPermissionNotFound)
+		assert.Contains(t, err.Error(), "users:fly")
+	})
+
+	t.Run("nombre repetido", func(t *testing.T) {
+		_, err := uc.CreateRole(nil, &domain.CreateRoleRequest{Name: "admin"})
+		assert.ErrorIs(t, err, domain.ErrRoleNameExists)
+	})
+
+	t.Run("rol de sistema", func(t *testing.T) {
+		_, err := uc.UpdateRole(nil, systemRole.ID.Hex(), &domain.UpdateRoleRequest{Description: "cambio"})
+		assert.ErrorIs(t, err, domain.ErrSystemRoleImmutable)
+	})
+
+	t.Run("añadir permiso inexistente", func(t *testing.T) {
+		err := uc.AddPermissionToRole(nil, systemRole.ID.Hex(), "users:fly")
+		assert.ErrorIs(t, err, domain.ErrInvalidPermission)
+		assert.ErrorIs(t, err, errPermissionNotFound)
+	})
+
+	t.Run("un fallo al consultar el permiso no lo da por inexistente", func(t *testing.T) {
+		dbErr := errors.New("conexión perdida")
+		permissionRepo := newFakePermissionRepo("users:read")
+		permissionRepo.err = dbErr
+		uc := NewRoleUseCase(newFakeRoleRepo(&domain.Role{Name: "editor"}), permissionRepo, newFakeUserRoleRepo(), domain.RoleDeleteCleanup)
+
+		_, err := uc.CreateRole(nil, &domain.CreateRoleRequest{Name: "lector", Permissions: []string{"users:read"}})
+		assert.ErrorIs(t, err, dbErr)
+		assert.NotErrorIs(t, err, domain.ErrInvalidPermission)
+	})
+}
+
+func TestUserRoleUseCaseWrapsCauses(t *testing.T) {
+	userRoleRepo := newFakeUserRoleRepo()
+	uc := NewUserRoleUseCase(userRoleRepo, newFakeRoleRepo(), newFakePermissionRepo())
+
+	err := uc.AssignRoleToUser(nil, &domain.AssignRoleRequest{UserID: "usuario", RoleID: "no-existe"})
+	assert.ErrorIs(t, err, domain.ErrInvalidRole)
+	assert.ErrorIs(t, err, errRoleNotFound)
+
+	err = uc.AssignPermissionToUser(nil, &domain.AssignPermissionRequest{UserID: "usuario", PermissionCode: "users:fly"})
+	assert.ErrorIs(t, err, domain.ErrInvalidPermission)
+	assert.ErrorIs(t, err, errPermissionNotFound)
+
+	// Un fallo de infraestructura se propaga envuelto
+	dbErr := errors.New("conexión perdida")
+	userRoleRepo.err = dbErr
+	_, err = uc.HasPermission("usuario", "users:read")
+	assert.ErrorIs(t, err, dbErr)
+	assert.Contains(t, err.Error(), "usuario")
+}
@@ -0,0 +1,677 @@
+package usecase
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/black4ninja/mi-proyecto/internal/permission/domain"
+)
+
+// Errores de los repositorios simulados, para verificar que los casos de uso conservan la causa
+var (
+	errPermissionNotFound = domain.ErrPermissionNotFound
+	errRoleNotFound       = domain.ErrRoleNotFound
+)
+
+// fakePermissionRepo es un repositorio de permisos en memoria para pruebas
+type fakePermissionRepo struct {
+	permissions     map[string]*domain.Permission // por código
+	existingCalls   [][]string                    // códigos consultados en GetExistingCodes
+	codesArrayCalls int                           // llamadas a GetByCodesArray
+	err             error                         // si está definido, GetByCode falla con este error
+}
+
+func newFakePermissionRepo(codes ...string) *fakePermissionRepo {
+	repo := &fakePermissionRepo{permissions: make(map[string]*domain.Permission)}
+	for _, code := range codes {
+		repo.permissions[code] = &domain.Permission{ID: primitive.NewObjectID(), Code: code}
+	}
+	return repo
+}
+
+func (r *fakePermissionRepo) GetByID(id string) (*domain.Permission, error) {
+	for _, p := range r.permissions {
+		if p.ID.Hex() == id {
+			return p, nil
+		}
+	}
+	return nil, errPermissionNotFound
+}
+
+func (r *fakePermissionRepo) GetByCode(code string) (*domain.Permission, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	p, ok := r.permissions[code]
+	if !ok {
+		return nil, errPermissionNotFound
+	}
+	return p, nil
+}
+
+func (r *fakePermissionRepo) GetByModule(module string) ([]*domain.Permission, error) {
+	var result []*domain.Permission
+	for _, p := range r.permissions {
+		if p.Module == module {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+func (r *fakePermissionRepo) GetAll(params map[string]interface{}) ([]*domain.Permission, error) {
+	var result []*domain.Permission
+	for _, p := range r.permissions {
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+func (r *fakePermissionRepo) GetPage(params map[string]interface{}, skip, limit int64) ([]*domain.Permission, int64, error) {
+	all, _ := r.GetAll(params)
+	sort.Slice(all, func(i, j int) bool { return all[i].Code < all[j].Code })
+	return page(all, skip, limit), int64(len(all)), nil
+}
+
+func (r *fakePermissionRepo) Create(permission *domain.Permission) error {
+	permission.ID = primitive.NewObjectID()
+	r.permissions[permission.Code] = permission
+	return nil
+}
+
+func (r *fakePermissionRepo) Update(permission *domain.Permission) error {
+	r.permissions[permission.Code] = permission
+	return nil
+}
+
+func (r *fakePermissionRepo) Delete(id string) error {
+	for code, p := range r.permissions {
+		if p.ID.Hex() == id {
+			delete(r.permissions, code)
+		}
+	}
+	return nil
+}
+
+func (r *fakePermissionRepo) GetByCodesArray(codes []string) ([]*domain.Permission, error) {
+	r.codesArrayCalls++
+	result := []*domain.Permission{}
+	for code, p := range r.permissions {
+		if containsCode(codes, code) {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+func (r *fakePermissionRepo) GetExistingCodes(codes []string) ([]string, error) {
+	r.existingCalls = append(r.existingCalls, codes)
+	existing := []string{}
+	for _, code := range codes {
+		if _, ok := r.permissions[code]; ok {
+			existing = append(existing, code)
+		}
+	}
+	return existing, nil
+}
+
+func containsCode(codes []string, code string) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAnyCode indica si codes contiene alguno de wanted
+func hasAnyCode(codes []string, wanted []string) bool {
+	for _, code := range wanted {
+		if containsCode(codes, code) {
+			return true
+		}
+	}
+	return false
+}
+
+// fakeRoleRepo es un repositorio de roles en memoria para pruebas
+type fakeRoleRepo struct {
+	roles        map[string]*domain.Role // por ID
+	getByIDCalls int                     // llamadas individuales a GetByID
+}
+
+func newFakeRoleRepo(roles ...*domain.Role) *fakeRoleRepo {
+	repo := &fakeRoleRepo{roles: make(map[string]*domain.Role)}
+	for _, role := range roles {
+		if role.ID.IsZero() {
+			role.ID = primitive.NewObjectID()
+		}
+		repo.roles[role.ID.Hex()] = role
+	}
+	return repo
+}
+
+func (r *fakeRoleRepo) GetByID(id string) (*domain.Role, error) {
+	r.getByIDCalls++
+	return r.role(id)
+}
+
+func (r *fakeRoleRepo) role(id string) (*domain.Role, error) {
+	role, ok := r.roles[id]
+	if !ok {
+		return nil, errRoleNotFound
+	}
+	return role, nil
+}
+
+func (r *fakeRoleRepo) GetByIDs(ids []string) ([]*domain.Role, error) {
+	result := []*domain.Role{}
+	for _, id := range ids {
+		if role, ok := r.roles[id]; ok && !containsRole(result, role) {
+			result = append(result, role)
+		}
+	}
+	return result, nil
+}
+
+func containsRole(roles []*domain.Role, role *domain.Role) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *fakeRoleRepo) GetByName(name string) (*domain.Role, error) {
+	for _, role := range r.roles {
+		if role.Name == name {
+			return role, nil
+		}
+	}
+	return nil, errRoleNotFound
+}
+
+func (r *fakeRoleRepo) GetAll(params map[string]interface{}) ([]*domain.Role, error) {
+	var result []*domain.Role
+	for _, role := range r.roles {
+		result = append(result, role)
+	}
+	return result, nil
+}
+
+func (r *fakeRoleRepo) GetPage(params map[string]interface{}, skip, limit int64) ([]*domain.Role, int64, error) {
+	all, _ := r.GetAll(params)
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return page(all, skip, limit), int64(len(all)), nil
+}
+
+func (r *fakeRoleRepo) Create(role *domain.Role) error {
+	role.ID = primitive.NewObjectID()
+	r.roles[role.ID.Hex()] = role
+	return nil
+}
+
+func (r *fakeRoleRepo) Update(role *domain.Role) error {
+	role.Version++
+	r.roles[role.ID.Hex()] = role
+	return nil
+}
+
+func (r *fakeRoleRepo) Delete(id string) error {
+	role, err := r.role(id)
+	if err != nil {
+		return err
+	}
+	if role.IsSystem {
+		return errors.New("no se puede eliminar un rol de sistema")
+	}
+	delete(r.roles, id)
+	return nil
+}
+
+func (r *fakeRoleRepo) AddPermission(roleID string, permissionCode string) error {
+	role, err := r.role(roleID)
+	if err != nil {
+		return err
+	}
+	role.Permissions = append(role.Permissions, permissionCode)
+	return nil
+}
+
+func (r *fakeRoleRepo) RemovePermission(roleID string, permissionCode string) error {
+	role, err := r.role(roleID)
+	if err != nil {
+		return err
+	}
+	kept := role.Permissions[:0]
+	for _, p := range role.Permissions {
+		if p != permissionCode {
+			kept = append(kept, p)
+		}
+	}
+	role.Permissions = kept
+	return nil
+}
+
+func (r *fakeRoleRepo) ApplyPermissionDelta(roleID string, add []string, remove []string) (*domain.Role, error) {
+	role, err := r.role(roleID)
+	if err != nil {
+		return nil, err
+	}
+	// Mismo resultado que la actualización en MongoDB: (actuales - remove) ∪ add
+	result := make([]string, 0, len(role.Permissions)+len(add))
+	for _, p := range role.Permissions {
+		if !containsCode(remove, p) && !containsCode(result, p) {
+			result = append(result, p)
+		}
+	}
+	for _, p := range add {
+		if !containsCode(result, p) {
+			result = append(result, p)
+		}
+	}
+	role.Permissions = result
+	return role, nil
+}
+
+func (r *fakeRoleRepo) ReplacePermissions(roleID string, codes []string) (*domain.Role, error) {
+	role, err := r.role(roleID)
+	if err != nil {
+		return nil, err
+	}
+	role.Permissions = append([]string{}, codes...)
+	return role, nil
+}
+
+// fakeUserRoleRepo es un repositorio de asignaciones usuario-rol en memoria para pruebas.
+// Si err está definido, GetUserPermissions falla con ese error; si invalidateErr está
+// definido, InvalidateEffectivePermissions falla con ese error.
+type fakeUserRoleRepo struct {
+	userRoles     map[string]*domain.UserRole // por userID
+	err           error
+	invalidateErr error
+	batchLookups  int // Llamadas a GetPermissionsByUserIDs
+}
+
+func newFakeUserRoleRepo() *fakeUserRoleRepo {
+	return &fakeUserRoleRepo{userRoles: make(map[string]*domain.UserRole)}
+}
+
+func (r *fakeUserRoleRepo) GetByUserID(userID string) (*domain.UserRole, error) {
+	userRole, ok := r.userRoles[userID]
+	if !ok {
+		return nil, errors.New("asignación no encontrada")
+	}
+	return userRole, nil
+}
+
+func (r *fakeUserRoleRepo) FindByUserID(userID string) (*domain.UserRole, error) {
+	if userRole, ok := r.userRoles[userID]; ok {
+		return userRole, nil
+	}
+	return &domain.UserRole{UserID: userID, Roles: []string{}, Permissions: []string{}}, nil
+}
+
+func (r *fakeUserRoleRepo) Create(userRole *domain.UserRole) error {
+	userRole.ID = primitive.NewObjectID()
+	r.userRoles[userRole.UserID] = userRole
+	return nil
+}
+
+func (r *fakeUserRoleRepo) Update(userRole *domain.UserRole) error {
+	r.userRoles[userRole.UserID] = userRole
+	return nil
+}
+
+func (r *fakeUserRoleRepo) Delete(id string) error {
+	for userID, userRole := range r.userRoles {
+		if userRole.ID.Hex() == id {
+			delete(r.userRoles, userID)
+		}
+	}
+	return nil
+}
+
+func (r *fakeUserRoleRepo) DeleteByUserID(userID string) error {
+	delete(r.userRoles, userID)
+	return nil
+}
+
+func (r *fakeUserRoleRepo) userRole(userID string) *domain.UserRole {
+	userRole, ok := r.userRoles[userID]
+	if !ok {
+		userRole = &domain.UserRole{ID: primitive.NewObjectID(), UserID: userID}
+		r.userRoles[userID] = userRole
+	}
+	return userRole
+}
+
+func (r *fakeUserRoleRepo) AddRole(userID string, roleID string) error {
+	return r.AddRoleWithExpiry(userID, roleID, nil)
+}
+
+func (r *fakeUserRoleRepo) AddRoleWithExpiry(userID string, roleID string, expiresAt *time.Time) error {
+	userRole := r.userRole(userID)
+	userRole.Roles = append(userRole.Roles, roleID)
+	if expiresAt != nil {
+		userRole.RoleExpirations = append(userRole.RoleExpirations, domain.RoleExpiration{RoleID: roleID, ExpiresAt: *expiresAt})
+	}
+	return nil
+}
+
+func (r *fakeUserRoleRepo) RemoveRole(userID string, roleID string) error {
+	return nil
+}
+
+func (r *fakeUserRoleRepo) AddPermission(userID string, permissionCode string) error {
+	userRole := r.userRole(userID)
+	userRole.Permissions = append(userRole.Permissions, permissionCode)
+	return nil
+}
+
+func (r *fakeUserRoleRepo) RemovePermission(userID string, permissionCode string) error {
+	userRole, ok := r.userRoles[userID]
+	if !ok {
+		return nil
+	}
+	var kept []string
+	for _, code := range userRole.Permissions {
+		if code != permissionCode {
+			kept = append(kept, code)
+		}
+	}
+	userRole.Permissions = kept
+	return nil
+}
+
+func (r *fakeUserRoleRepo) EnsureForUsers(userIDs []string, roleIDs ...string) ([]string, error) {
+	var created []string
+	for _, userID := range userIDs {
+		ok, err := r.EnsureForUser(userID, roleIDs...)
+		if err != nil {
+			return created, err
+		}
+		if ok {
+			created = append(created, userID)
+		}
+	}
+	return created, nil
+}
+
+func (r *fakeUserRoleRepo) EnsureForUser(userID string, roleIDs ...string) (bool, error) {
+	if _, ok := r.userRoles[userID]; ok {
+		return false, nil
+	}
+	r.userRoles[userID] = &domain.UserRole{
+		ID:          primitive.NewObjectID(),
+		UserID:      userID,
+		Roles:       append([]string{}, roleIDs...),
+		Permissions: []string{},
+	}
+	return true, nil
+}
+
+func (r *fakeUserRoleRepo) CountByRole(roleID string) (int64, error) {
+	var count int64
+	for _, userRole := range r.userRoles {
+		if containsCode(userRole.Roles, roleID) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *fakeUserRoleRepo) GetUsersByRole(roleID string, skip, limit int64) ([]string, int64, error) {
+	userIDs := []string{}
+	for userID, userRole := range r.userRoles {
+		expiresAt := userRole.RoleExpiresAt(roleID)
+		if containsCode(userRole.Roles, roleID) && (expiresAt == nil || expiresAt.After(time.Now())) {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	sort.Strings(userIDs)
+	total := int64(len(userIDs))
+	userIDs = userIDs[min(skip, total):min(skip+limit, total)]
+	return userIDs, total, nil
+}
+
+func (r *fakeUserRoleRepo) RemoveRoleFromAll(roleID string) (int64, error) {
+	var modified int64
+	for _, userRole := range r.userRoles {
+		kept := make([]string, 0, len(userRole.Roles))
+		for _, id := range userRole.Roles {
+			if id != roleID {
+				kept = append(kept, id)
+			}
+		}
+		if len(kept) != len(userRole.Roles) {
+			userRole.Roles = kept
+			modified++
+		}
+	}
+	return modified, nil
+}
+
+func (r *fakeUserRoleRepo) GetUserPermissions(userID string) ([]string, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	userRole, ok := r.userRoles[userID]
+	if !ok {
+		return nil, nil
+	}
+	return userRole.Permissions, nil
+}
+
+func (r *fakeUserRoleRepo) GetPermissionsByUserIDs(userIDs []string) (map[string][]string, error) {
+	r.batchLookups++
+	if r.err != nil {
+		return nil, r.err
+	}
+	permissions := make(map[string][]string, len(userIDs))
+	for _, userID := range userIDs {
+		permissions[userID] = []string{}
+		if userRole, ok := r.userRoles[userID]; ok {
+			permissions[userID] = userRole.Permissions
+		}
+	}
+	return permissions, nil
+}
+
+func (r *fakeUserRoleRepo) RemoveExpiredRoles(now time.Time) (int64, error) {
+	var modified int64
+	for _, userRole := range r.userRoles {
+		expired := userRole.ExpiredRoles(now)
+		if len(expired) == 0 {
+			continue
+		}
+		userRole.Roles = userRole.ActiveRoles(now)
+		modified++
+	}
+	return modified, nil
+}
+
+func (r *fakeUserRoleRepo) InvalidateEffectivePermissions(roleIDs ...string) (int64, error) {
+	if r.invalidateErr != nil {
+		return 0, r.invalidateErr
+	}
+	var modified int64
+	for _, userRole := range r.userRoles {
+		if hasAnyCode(userRole.Roles, roleIDs) {
+			userRole.EffectivePermissions = nil
+			userRole.EffectiveRevision++
+			modified++
+		}
+	}
+	return modified, nil
+}
+
+func (r *fakeUserRoleRepo) RebuildEffectivePermissions() (int64, error) {
+	return int64(len(r.userRoles)), nil
+}
+
+// page retorna la porción [skip, skip+limit) de items
+func page[T any](items []T, skip, limit int64) []T {
+	if skip >= int64(len(items)) {
+		return nil
+	}
+	end := skip + limit
+	if end > int64(len(items)) {
+		end = int64(len(items))
+	}
+	return items[skip:end]
+}
+
+// fakePermissionRenamer renombra códigos sobre los repositorios en memoria
+type fakePermissionRenamer struct {
+	permissions *fakePermissionRepo
+	roles       *fakeRoleRepo
+	userRoles   *fakeUserRoleRepo
+}
+
+func (r *fakePermissionRenamer) RenameCode(oldCode, newCode string) (*domain.PermissionRenameResult, error) {
+	permission, ok := r.permissions.permissions[oldCode]
+	if !ok {
+		return nil, domain.ErrPermissionNotFound
+	}
+	if _, taken := r.permissions.permissions[newCode]; taken {
+		return nil, domain.ErrPermissionCodeExists
+	}
+	delete(r.permissions.permissions, oldCode)
+	permission.Code = newCode
+	r.permissions.permissions[newCode] = permission
+
+	result := &domain.PermissionRenameResult{OldCode: oldCode, NewCode: newCode}
+	for _, role := range r.roles.roles {
+		if renamed, ok := renameCode(role.Permissions, oldCode, newCode); ok {
+			role.Permissions = renamed
+			result.RolesUpdated++
+		}
+	}
+	for _, userRole := range r.userRoles.userRoles {
+		if renamed, ok := renameCode(userRole.Permissions, oldCode, newCode); ok {
+			userRole.Permissions = renamed
+			result.UserRolesUpdated++
+		}
+	}
+	return result, nil
+}
+
+// fakePermissionReferenceRemover consulta y quita referencias sobre los repositorios en memoria
+type fakePermissionReferenceRemover struct {
+	permissions *fakePermissionRepo
+	roles       *fakeRoleRepo
+	userRoles   *fakeUserRoleRepo
+}
+
+func (r *fakePermissionReferenceRemover) FindReferences(code string) (*domain.PermissionReferences, error) {
+	references := &domain.PermissionReferences{Roles: []string{}}
+	for _, role := range r.roles.roles {
+		if containsCode(role.Permissions, code) {
+			references.Roles = append(references.Roles, role.Name)
+		}
+	}
+	sort.Strings(references.Roles)
+	for _, userRole := range r.userRoles.userRoles {
+		if containsCode(userRole.Permissions, code) {
+			references.UserAssignments++
+		}
+	}
+	return references, nil
+}
+
+func (r *fakePermissionReferenceRemover) DeleteUnreferenced(code string) error {
+	if _, ok := r.permissions.permissions[code]; !ok {
+		return domain.ErrPermissionNotFound
+	}
+	references, err := r.FindReferences(code)
+	if err != nil {
+		return err
+	}
+	if references.InUse() {
+		return &domain.PermissionInUseError{Code: code, PermissionReferences: *references}
+	}
+	delete(r.permissions.permissions, code)
+	return nil
+}
+
+func (r *fakePermissionReferenceRemover) DeleteCode(code string) (*domain.PermissionDeleteResult, error) {
+	if _, ok := r.permissions.permissions[code]; !ok {
+		return nil, domain.ErrPermissionNotFound
+	}
+	delete(r.permissions.permissions, code)
+
+	result := &domain.PermissionDeleteResult{Code: code}
+	for id, role := range r.roles.roles {
+		if containsCode(role.Permissions, code) {
+			if err := r.roles.RemovePermission(id, code); err != nil {
+				return nil, err
+			}
+			result.RolesUpdated++
+		}
+	}
+	for userID, userRole := range r.userRoles.userRoles {
+		if containsCode(userRole.Permissions, code) {
+			if err := r.userRoles.RemovePermission(userID, code); err != nil {
+				return nil, err
+			}
+			result.UserRolesUpdated++
+		}
+	}
+	return result, nil
+}
+
+// renameCode reemplaza oldCode por newCode sin duplicarlo; ok indica si codes incluía oldCode
+func renameCode(codes []string, oldCode, newCode string) ([]string, bool) {
+	if !containsCode(codes, oldCode) {
+		return codes, false
+	}
+	var result []string
+	for _, code := range codes {
+		if code != oldCode && code != newCode {
+			result = append(result, code)
+		}
+	}
+	return append(result, newCode), true
+}
+
+// fakeCacheInvalidator cuenta las veces que se vació la caché de permisos
+type fakeCacheInvalidator struct {
+	calls int
+}
+
+func (c *fakeCacheInvalidator) InvalidatePermissionCache() {
+	c.calls++
+}
+
+// fakeRoleDeleter guarda los roles que se pidió eliminar; con err falla cada eliminación
+type fakeRoleDeleter struct {
+	deleted []string
+	err     error
+}
+
+func (d *fakeRoleDeleter) DeleteUnassigned(roleID string) error {
+	if d.err != nil {
+		return d.err
+	}
+	d.deleted = append(d.deleted, roleID)
+	return nil
+}
+
+// fakeChangeRecorder guarda los cambios registrados; con err falla cada registro
+type fakeChangeRecorder struct {
+	changes []domain.PermissionChange
+	err     error
+}
+
+func (r *fakeChangeRecorder) RecordPermissionChange(change *domain.PermissionChange) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.changes = append(r.changes, *change)
+	return nil
+}
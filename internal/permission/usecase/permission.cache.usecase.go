@@ -0,0 +1,212 @@
+package usecase
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/black4ninja/mi-proyecto/internal/permission/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// cachedPermissions son los permisos efectivos de un usuario guardados en memoria
+type cachedPermissions struct {
+	permissions []string
+	expiresAt   time.Time
+}
+
+// permissionCacheUseCase extiende el caso de uso de roles de usuario con una caché en memoria
+// de los permisos efectivos por usuario, para no consultar MongoDB en cada verificación
+type permissionCacheUseCase struct {
+	domain.UserRoleUseCase
+	ttl time.Duration
+	now func() time.Time
+
+	mu         sync.Mutex
+	entries    map[string]cachedPermissions
+	generation uint64 // Aumenta con cada invalidación
+	lastSweep  time.Time
+}
+
+// WithPermissionCache retorna userRoles con GetUserPermissions, HasPermission y GetAdminScope
+// servidos desde una caché en memoria durante ttl. Las asignaciones y remociones de roles y
+// permisos de un usuario descartan su entrada. El resultado implementa
+// domain.PermissionCacheInvalidator, para que los casos de uso de permisos y roles vacíen la
+// caché con WithCacheInvalidator. Con ttl <= 0 (ej. en pruebas) retorna userRoles sin caché.
+func WithPermissionCache(userRoles domain.UserRoleUseCase, ttl time.Duration) domain.UserRoleUseCase {
+	if ttl <= 0 {
+		return userRoles
+	}
+
+	return &permissionCacheUseCase{
+		UserRoleUseCase: userRoles,
+		ttl:             ttl,
+		now:             time.Now,
+		entries:         make(map[string]cachedPermissions),
+	}
+}
+
+// GetUserPermissions obtiene los permisos del usuario desde la caché o, si no están o
+// vencieron, desde el caso de uso extendido
+func (u *permissionCacheUseCase) GetUserPermissions(userID string) ([]string, error) {
+	u.mu.Lock()
+	entry, ok := u.entries[userID]
+	generation := u.generation
+	u.mu.Unlock()
+	if ok && u.now().Before(entry.expiresAt) {
+		return entry.permissions, nil
+	}
+
+	permissions, err := u.UserRoleUseCase.GetUserPermissions(userID)
+	if err != nil {
+		return nil, err
+	}
+	u.store(userID, permissions, generation)
+	return permissions, nil
+}
+
+// HasPermission verifica el permiso con los permisos en caché del usuario
+func (u *permissionCacheUseCase) HasPermission(userID string, permissionCode string) (bool, error) {
+	permissions, err := u.GetUserPermissions(userID)
+	if err != nil {
+		return false, fmt.Errorf("obtener permisos del usuario %s: %w", userID, err)
+	}
+	return grantsPermission(permissions, permissionCode), nil
+}
+
+// HasModuleAccess verifica el acceso al módulo con los permisos en caché del usuario
+func (u *permissionCacheUseCase) HasModuleAccess(userID string, module string) (bool, error) {
+	permissions, err := u.GetUserPermissions(userID)
+	if err != nil {
+		return false, fmt.Errorf("obtener permisos del usuario %s: %w", userID, err)
+	}
+	return utils.GrantsModuleAccess(permissions, module), nil
+}
+
+// GetAdminScope obtiene el ámbito de administración delegada con los permisos en caché
+func (u *permissionCacheUseCase) GetAdminScope(userID string) (*domain.AdminScope, error) {
+	permissions, err := u.GetUserPermissions(userID)
+	if err != nil {
+		return nil, fmt.Errorf("obtener permisos del usuario %s: %w", userID, err)
+	}
+	return domain.NewAdminScope(permissions), nil
+}
+
+// AssignRoleToUser asigna el rol y descarta los permisos en caché del usuario
+func (u *permissionCacheUseCase) AssignRoleToUser(scope *domain.AdminScope, req *domain.AssignRoleRequest) error {
+	defer u.invalidate(req.UserID)
+	return u.UserRoleUseCase.AssignRoleToUser(scope, req)
+}
+
+// RemoveRoleFromUser quita el rol y descarta los permisos en caché del usuario
+func (u *permissionCacheUseCase) RemoveRoleFromUser(scope *domain.AdminScope, req *domain.AssignRoleRequest) error {
+	defer u.invalidate(req.UserID)
+	return u.UserRoleUseCase.RemoveRoleFromUser(scope, req)
+}
+
+// AssignPermissionToUser asigna el permiso y descarta los permisos en caché del usuario
+func (u *permissionCacheUseCase) AssignPermissionToUser(scope *domain.AdminScope, req *domain.AssignPermissionRequest) error {
+	defer u.invalidate(req.UserID)
+	return u.UserRoleUseCase.AssignPermissionToUser(scope, req)
+}
+
+// RemovePermissionFromUser quita el permiso y descarta los permisos en caché del usuario
+func (u *permissionCacheUseCase) RemovePermissionFromUser(scope *domain.AdminScope, req *domain.AssignPermissionRequest) error {
+	defer u.invalidate(req.UserID)
+	return u.UserRoleUseCase.RemovePermissionFromUser(scope, req)
+}
+
+// EnsureUserRole crea la asignación del usuario; si se creó (ej. con roles por defecto) descarta
+// los permisos en caché del usuario
+func (u *permissionCacheUseCase) EnsureUserRole(userID string) (bool, error) {
+	created, err := u.UserRoleUseCase.EnsureUserRole(userID)
+	if created {
+		u.invalidate(userID)
+	}
+	return created, err
+}
+
+// EnsureUserRoles crea las asignaciones faltantes y descarta los permisos en caché de los
+// usuarios a los que se les creó
+func (u *permissionCacheUseCase) EnsureUserRoles(userIDs []string) ([]string, error) {
+	created, err := u.UserRoleUseCase.EnsureUserRoles(userIDs)
+	for _, userID := range created {
+		u.invalidate(userID)
+	}
+	return created, err
+}
+
+// ClearUserRoles quita los roles y permisos y descarta los permisos en caché del usuario
+func (u *permissionCacheUseCase) ClearUserRoles(userID string) error {
+	defer u.invalidate(userID)
+	return u.UserRoleUseCase.ClearUserRoles(userID)
+}
+
+// DeleteUserRoles elimina la asignación y descarta los permisos en caché del usuario
+func (u *permissionCacheUseCase) DeleteUserRoles(userID string) error {
+	defer u.invalidate(userID)
+	return u.UserRoleUseCase.DeleteUserRoles(userID)
+}
+
+// PurgeExpiredRoles quita los roles vencidos y, si cambió alguna asignación, vacía la caché
+func (u *permissionCacheUseCase) PurgeExpiredRoles(now time.Time) (int64, error) {
+	modified, err := u.UserRoleUseCase.PurgeExpiredRoles(now)
+	if modified > 0 {
+		u.clear()
+	}
+	return modified, err
+}
+
+// RebuildEffectivePermissions recalcula los permisos materializados y vacía la caché
+func (u *permissionCacheUseCase) RebuildEffectivePermissions(scope *domain.AdminScope) (*domain.EffectivePermissionsRebuildResult, error) {
+	result, err := u.UserRoleUseCase.RebuildEffectivePermissions(scope)
+	if err == nil {
+		u.clear()
+	}
+	return result, err
+}
+
+// InvalidatePermissionCache descarta los permisos en caché de todos los usuarios. Lo usan los
+// casos de uso de permisos y roles (ver WithCacheInvalidator).
+func (u *permissionCacheUseCase) InvalidatePermissionCache() {
+	u.clear()
+}
+
+// clear descarta los permisos en caché de todos los usuarios
+func (u *permissionCacheUseCase) clear() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.entries = make(map[string]cachedPermissions)
+	u.generation++
+}
+
+// invalidate descarta los permisos en caché del usuario. Se llama también si la modificación
+// falla, ya que pudo aplicarse en parte.
+func (u *permissionCacheUseCase) invalidate(userID string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.entries, userID)
+	u.generation++
+}
+
+// store guarda los permisos del usuario si no hubo invalidaciones desde que se leyeron
+// (generation); de lo contrario podrían ser anteriores al cambio. De paso elimina las
+// entradas vencidas, como mucho una vez por ttl.
+func (u *permissionCacheUseCase) store(userID string, permissions []string, generation uint64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.generation != generation {
+		return
+	}
+
+	now := u.now()
+	if now.Sub(u.lastSweep) >= u.ttl {
+		for id, entry := range u.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(u.entries, id)
+			}
+		}
+		u.lastSweep = now
+	}
+	u.entries[userID] = cachedPermissions{permissions: permissions, expiresAt: now.Add(u.ttl)}
+}
@@ -0,0 +1,78 @@
+package usecase
+
+import (
+	"fmt"
+
+	"github.com/black4ninja/mi-proyecto/internal/permission/domain"
+)
+
+// Option configura un ajuste opcional de los casos de uso de permisos, roles y asignaciones
+type Option func(*options)
+
+type options struct {
+	recorder domain.PermissionChangeRecorder
+	cache    domain.PermissionCacheInvalidator
+	deleter  domain.RoleDeleter
+}
+
+// WithChangeRecorder registra con recorder los cambios que los casos de uso aplican por su
+// cuenta, sin una petición que los registre: la limpieza de asignaciones al eliminar un rol, la
+// eliminación forzada de un permiso, los roles por defecto y el barrido de roles vencidos. Se
+// registran con domain.SystemActor como actor.
+func WithChangeRecorder(recorder domain.PermissionChangeRecorder) Option {
+	return func(o *options) {
+		o.recorder = recorder
+	}
+}
+
+// WithCacheInvalidator vacía con cache los permisos en caché (ej. la de WithPermissionCache)
+// tras los cambios que alteran los permisos efectivos de usuarios que no se conocen uno a uno:
+// la eliminación forzada de un permiso y los cambios en los permisos o la herencia de un rol,
+// incluida su eliminación. El barrido de roles vencidos la vacía desde la propia caché.
+func WithCacheInvalidator(cache domain.PermissionCacheInvalidator) Option {
+	return func(o *options) {
+		o.cache = cache
+	}
+}
+
+// WithRoleDeleter elimina los roles con deleter cuando la política es domain.RoleDeleteBlock, que
+// cuenta las asignaciones en la misma transacción que elimina el rol. Sin él se cuentan y se
+// elimina en dos pasos, y una asignación hecha entre ambos puede quedar apuntando al rol eliminado.
+func WithRoleDeleter(deleter domain.RoleDeleter) Option {
+	return func(o *options) {
+		o.deleter = deleter
+	}
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// invalidateCache vacía la caché de permisos; sin cache no hace nada
+func invalidateCache(cache domain.PermissionCacheInvalidator) {
+	if cache != nil {
+		cache.InvalidatePermissionCache()
+	}
+}
+
+// recordSystemChange registra un cambio ya aplicado por el sistema. Sin recorder no hace nada;
+// si el registro falla retorna un error que envuelve ErrAuditFailed.
+func recordSystemChange(recorder domain.PermissionChangeRecorder, action, target, details string) error {
+	if recorder == nil {
+		return nil
+	}
+	err := recorder.RecordPermissionChange(&domain.PermissionChange{
+		ActorID: domain.SystemActor,
+		Action:  action,
+		Target:  target,
+		Details: details,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: action=%s target=%s: %w", domain.ErrAuditFailed, action, target, err)
+	}
+	return nil
+}
@@ -2,21 +2,39 @@ package usecase
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/black4ninja/mi-proyecto/internal/permission/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
 )
 
 type permissionUseCase struct {
 	permissionRepo domain.PermissionRepository
 	userRoleRepo   domain.UserRoleRepository
+	renamer        domain.PermissionCodeRenamer
+	references     domain.PermissionReferenceRemover
+	recorder       domain.PermissionChangeRecorder
+	cache          domain.PermissionCacheInvalidator
 }
 
 // NewPermissionUseCase crea un nuevo caso de uso para permisos
-func NewPermissionUseCase(permissionRepo domain.PermissionRepository, userRoleRepo domain.UserRoleRepository) domain.PermissionUseCase {
+func NewPermissionUseCase(
+	permissionRepo domain.PermissionRepository,
+	userRoleRepo domain.UserRoleRepository,
+	renamer domain.PermissionCodeRenamer,
+	references domain.PermissionReferenceRemover,
+	opts ...Option,
+) domain.PermissionUseCase {
+	o := newOptions(opts)
 	return &permissionUseCase{
 		permissionRepo: permissionRepo,
 		userRoleRepo:   userRoleRepo,
+		renamer:        renamer,
+		references:     references,
+		recorder:       o.recorder,
+		cache:          o.cache,
 	}
 }
 
@@ -24,7 +42,7 @@ func NewPermissionUseCase(permissionRepo domain.PermissionRepository, userRoleRe
 func (u *permissionUseCase) GetPermission(id string) (*domain.PermissionResponse, error) {
 	permission, err := u.permissionRepo.GetByID(id)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("obtener permiso %s: %w", id, err)
 	}
 
 	return &domain.PermissionResponse{
@@ -34,8 +52,8 @@ func (u *permissionUseCase) GetPermission(id string) (*domain.PermissionResponse
 		Action:      permission.Action,
 		Name:        permission.Name,
 		Description: permission.Description,
-		CreatedAt:   permission.CreatedAt,
-		UpdatedAt:   permission.UpdatedAt,
+		CreatedAt:   utils.NewTimestamp(permission.CreatedAt),
+		UpdatedAt:   utils.NewTimestamp(permission.UpdatedAt),
 	}, nil
 }
 
@@ -43,7 +61,7 @@ func (u *permissionUseCase) GetPermission(id string) (*domain.PermissionResponse
 func (u *permissionUseCase) GetPermissionByCode(code string) (*domain.PermissionResponse, error) {
 	permission, err := u.permissionRepo.GetByCode(code)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("obtener permiso %s: %w", code, err)
 	}
 
 	return &domain.PermissionResponse{
@@ -53,8 +71,8 @@ func (u *permissionUseCase) GetPermissionByCode(code string) (*domain.Permission
 		Action:      permission.Action,
 		Name:        permission.Name,
 		Description: permission.Description,
-		CreatedAt:   permission.CreatedAt,
-		UpdatedAt:   permission.UpdatedAt,
+		CreatedAt:   utils.NewTimestamp(permission.CreatedAt),
+		UpdatedAt:   utils.NewTimestamp(permission.UpdatedAt),
 	}, nil
 }
 
@@ -62,7 +80,7 @@ func (u *permissionUseCase) GetPermissionByCode(code string) (*domain.Permission
 func (u *permissionUseCase) GetPermissionsByModule(module string) ([]*domain.PermissionResponse, error) {
 	permissions, err := u.permissionRepo.GetByModule(module)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("listar permisos del módulo %s: %w", module, err)
 	}
 
 	var response []*domain.PermissionResponse
@@ -74,22 +92,37 @@ func (u *permissionUseCase) GetPermissionsByModule(module string) ([]*domain.Per
 			Action:      p.Action,
 			Name:        p.Name,
 			Description: p.Description,
-			CreatedAt:   p.CreatedAt,
-			UpdatedAt:   p.UpdatedAt,
+			CreatedAt:   utils.NewTimestamp(p.CreatedAt),
+			UpdatedAt:   utils.NewTimestamp(p.UpdatedAt),
 		})
 	}
 
 	return response, nil
 }
 
-// GetAllPermissions obtiene todos los permisos
-func (u *permissionUseCase) GetAllPermissions() ([]*domain.PermissionResponse, error) {
-	permissions, err := u.permissionRepo.GetAll()
+// GetAllPermissions obtiene los permisos que coincidan con los parámetros (vacío = todos)
+func (u *permissionUseCase) GetAllPermissions(params map[string]interface{}) ([]*domain.PermissionResponse, error) {
+	permissions, err := u.permissionRepo.GetAll(params)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("listar permisos: %w", err)
 	}
 
-	var response []*domain.PermissionResponse
+	return permissionListResponse(permissions), nil
+}
+
+// GetPermissionsPage obtiene una página de permisos y el total de coincidencias
+func (u *permissionUseCase) GetPermissionsPage(params map[string]interface{}, skip, limit int64) ([]*domain.PermissionResponse, int64, error) {
+	permissions, total, err := u.permissionRepo.GetPage(params, skip, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("listar permisos: %w", err)
+	}
+
+	return permissionListResponse(permissions), total, nil
+}
+
+// permissionListResponse convierte una lista de permisos al formato de respuesta
+func permissionListResponse(permissions []*domain.Permission) []*domain.PermissionResponse {
+	response := make([]*domain.PermissionResponse, 0, len(permissions))
 	for _, p := range permissions {
 		response = append(response, &domain.PermissionResponse{
 			ID:          p.ID.Hex(),
@@ -98,20 +131,32 @@ func (u *permissionUseCase) GetAllPermissions() ([]*domain.PermissionResponse, e
 			Action:      p.Action,
 			Name:        p.Name,
 			Description: p.Description,
-			CreatedAt:   p.CreatedAt,
-			UpdatedAt:   p.UpdatedAt,
+			CreatedAt:   utils.NewTimestamp(p.CreatedAt),
+			UpdatedAt:   utils.NewTimestamp(p.UpdatedAt),
 		})
 	}
-
-	return response, nil
+	return response
 }
 
 // CreatePermission crea un nuevo permiso
-func (u *permissionUseCase) CreatePermission(req *domain.CreatePermissionRequest) (*domain.PermissionResponse, error) {
+func (u *permissionUseCase) CreatePermission(scope *domain.AdminScope, req *domain.CreatePermissionRequest) (*domain.PermissionResponse, error) {
+	// Validar que el código siga la convención
+	if err := domain.ValidatePermissionCode(req.Code); err != nil {
+		return nil, err
+	}
+
+	// Un administrador delegado solo crea permisos de sus módulos
+	if err := scope.Check(req.Code); err != nil {
+		return nil, err
+	}
+	if !scope.AllowsModule(req.Module) {
+		return nil, fmt.Errorf("%w: módulo %s", domain.ErrOutOfAdminScope, req.Module)
+	}
+
 	// Validar que el código sea único
 	existingPermission, err := u.permissionRepo.GetByCode(req.Code)
 	if err == nil && existingPermission != nil {
-		return nil, errors.New("ya existe un permiso con este código")
+		return nil, domain.ErrPermissionCodeExists
 	}
 
 	// Crear permiso
@@ -128,7 +173,7 @@ func (u *permissionUseCase) CreatePermission(req *domain.CreatePermissionRequest
 
 	err = u.permissionRepo.Create(permission)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("crear permiso %s: %w", req.Code, err)
 	}
 
 	return &domain.PermissionResponse{
@@ -138,16 +183,19 @@ func (u *permissionUseCase) CreatePermission(req *domain.CreatePermissionRequest
 		Action:      permission.Action,
 		Name:        permission.Name,
 		Description: permission.Description,
-		CreatedAt:   permission.CreatedAt,
-		UpdatedAt:   permission.UpdatedAt,
+		CreatedAt:   utils.NewTimestamp(permission.CreatedAt),
+		UpdatedAt:   utils.NewTimestamp(permission.UpdatedAt),
 	}, nil
 }
 
 // UpdatePermission actualiza un permiso existente
-func (u *permissionUseCase) UpdatePermission(id string, req *domain.UpdatePermissionRequest) (*domain.PermissionResponse, error) {
+func (u *permissionUseCase) UpdatePermission(scope *domain.AdminScope, id string, req *domain.UpdatePermissionRequest) (*domain.PermissionResponse, error) {
 	// Obtener permiso existente
 	permission, err := u.permissionRepo.GetByID(id)
 	if err != nil {
+		return nil, fmt.Errorf("obtener permiso %s: %w", id, err)
+	}
+	if err := scope.Check(permission.Code); err != nil {
 		return nil, err
 	}
 
@@ -165,7 +213,7 @@ func (u *permissionUseCase) UpdatePermission(id string, req *domain.UpdatePermis
 	// Guardar cambios
 	err = u.permissionRepo.Update(permission)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("actualizar permiso %s: %w", id, err)
 	}
 
 	return &domain.PermissionResponse{
@@ -175,14 +223,49 @@ func (u *permissionUseCase) UpdatePermission(id string, req *domain.UpdatePermis
 		Action:      permission.Action,
 		Name:        permission.Name,
 		Description: permission.Description,
-		CreatedAt:   permission.CreatedAt,
-		UpdatedAt:   permission.UpdatedAt,
+		CreatedAt:   utils.NewTimestamp(permission.CreatedAt),
+		UpdatedAt:   utils.NewTimestamp(permission.UpdatedAt),
 	}, nil
 }
 
-// DeletePermission elimina un permiso
-func (u *permissionUseCase) DeletePermission(id string) error {
-	return u.permissionRepo.Delete(id)
+// DeletePermission elimina un permiso. Si algún rol o asignación de usuario lo referencia, sin
+// force se rechaza con *PermissionInUseError para no dejar códigos colgantes; con force se quita
+// de todos ellos en la misma transacción que elimina el permiso y se vacía la caché de permisos.
+func (u *permissionUseCase) DeletePermission(scope *domain.AdminScope, id string, force bool) (*domain.PermissionDeleteResult, error) {
+	permission, err := u.permissionRepo.GetByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("obtener permiso %s: %w", id, err)
+	}
+	if err := scope.Check(permission.Code); err != nil {
+		return nil, err
+	}
+
+	if force {
+		result, err := u.references.DeleteCode(permission.Code)
+		if err != nil {
+			return nil, fmt.Errorf("eliminar permiso %s: %w", permission.Code, err)
+		}
+		if result.RolesUpdated > 0 || result.UserRolesUpdated > 0 {
+			invalidateCache(u.cache)
+			details := fmt.Sprintf("roles_updated=%d user_roles_updated=%d", result.RolesUpdated, result.UserRolesUpdated)
+			if err := recordSystemChange(u.recorder, domain.ChangePermissionCascade, "permission:"+permission.Code, details); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+
+	// Las referencias se consultan en la misma transacción que elimina el permiso, para que no
+	// se asigne entre la consulta y la eliminación
+	if err := u.references.DeleteUnreferenced(permission.Code); err != nil {
+		var inUse *domain.PermissionInUseError
+		if errors.As(err, &inUse) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("eliminar permiso %s: %w", permission.Code, err)
+	}
+
+	return &domain.PermissionDeleteResult{Code: permission.Code}, nil
 }
 
 // HasPermission verifica si un usuario tiene un permiso específico
@@ -190,32 +273,21 @@ func (u *permissionUseCase) HasPermission(userID string, permissionCode string)
 	// Obtener todos los permisos del usuario
 	permissions, err := u.userRoleRepo.GetUserPermissions(userID)
 	if err != nil {
-		return false, err
+		return false, fmt.Errorf("obtener permisos del usuario %s: %w", userID, err)
 	}
 
-	// Verificar si el permiso específico está en la lista
-	for _, p := range permissions {
-		if p == permissionCode {
-			return true, nil
-		}
-
-		// Comprobar permisos comodín (por ejemplo, "module:*" o "module:submodule:*")
-		if isWildcardMatch(p, permissionCode) {
-			return true, nil
-		}
-	}
-
-	return false, nil
+	return grantsPermission(permissions, permissionCode), nil
 }
 
 // GetPermissionsByCodesArray obtiene permisos por array de códigos
 func (u *permissionUseCase) GetPermissionsByCodesArray(codes []string) ([]*domain.PermissionResponse, error) {
 	permissions, err := u.permissionRepo.GetByCodesArray(codes)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("obtener permisos por código: %w", err)
 	}
 
-	var response []*domain.PermissionResponse
+	// Siempre se retorna una lista (posiblemente vacía) para que se serialice como [] y no como null
+	response := make([]*domain.PermissionResponse, 0, len(permissions))
 	for _, p := range permissions {
 		response = append(response, &domain.PermissionResponse{
 			ID:          p.ID.Hex(),
@@ -224,25 +296,84 @@ func (u *permissionUseCase) GetPermissionsByCodesArray(codes []string) ([]*domai
 			Action:      p.Action,
 			Name:        p.Name,
 			Description: p.Description,
-			CreatedAt:   p.CreatedAt,
-			UpdatedAt:   p.UpdatedAt,
+			CreatedAt:   utils.NewTimestamp(p.CreatedAt),
+			UpdatedAt:   utils.NewTimestamp(p.UpdatedAt),
 		})
 	}
 
 	return response, nil
 }
 
-// isWildcardMatch verifica si un permiso coincide con un comodín
-// Por ejemplo, "module:*" coincidiría con "module:action"
-func isWildcardMatch(pattern, permissionCode string) bool {
-	// Si el patrón termina en *, es un comodín
-	if len(pattern) > 2 && pattern[len(pattern)-1] == '*' {
-		// Quitar el * del final
-		prefix := pattern[:len(pattern)-1]
+// ValidateCodes clasifica un lote de códigos en existentes, faltantes y mal formados.
+// Los códigos repetidos se reportan una sola vez, en el orden en que aparecen.
+func (u *permissionUseCase) ValidateCodes(codes []string) (*domain.CodeValidationReport, error) {
+	report := &domain.CodeValidationReport{
+		Existing:  []string{},
+		Missing:   []string{},
+		Malformed: []domain.MalformedCode{},
+	}
 
-		// Si el permiso comienza con el prefijo, es una coincidencia
-		return len(permissionCode) >= len(prefix) && permissionCode[:len(prefix)] == prefix
+	seen := make(map[string]bool, len(codes))
+	var wellFormed []string
+	for _, code := range codes {
+		code = strings.TrimSpace(code)
+		if seen[code] {
+			continue
+		}
+		seen[code] = true
+
+		if err := domain.ValidatePermissionCode(code); err != nil {
+			report.Malformed = append(report.Malformed, domain.MalformedCode{Code: code, Reason: err.Error()})
+			continue
+		}
+		wellFormed = append(wellFormed, code)
+	}
+
+	existing, err := u.permissionRepo.GetExistingCodes(wellFormed)
+	if err != nil {
+		return nil, fmt.Errorf("consultar códigos existentes: %w", err)
+	}
+	found := make(map[string]bool, len(existing))
+	for _, code := range existing {
+		found[code] = true
+	}
+
+	for _, code := range wellFormed {
+		if found[code] {
+			report.Existing = append(report.Existing, code)
+		} else {
+			report.Missing = append(report.Missing, code)
+		}
+	}
+
+	return report, nil
+}
+
+// RenamePermissionCode cambia el código de un permiso (ej. para corregir una errata) y
+// reescribe en una sola transacción las referencias de roles y asignaciones de usuario, que
+// de otro modo quedarían huérfanas. Los comodines ("modulo:*") no se reescriben.
+func (u *permissionUseCase) RenamePermissionCode(scope *domain.AdminScope, oldCode, newCode string) (*domain.PermissionRenameResult, error) {
+	newCode = strings.TrimSpace(newCode)
+	if err := domain.ValidatePermissionCode(newCode); err != nil {
+		return nil, err
+	}
+	if newCode == oldCode {
+		return nil, fmt.Errorf("%w: el nuevo código es igual al actual", domain.ErrInvalidPermission)
+	}
+	// Un administrador delegado no puede mover un permiso a otro módulo ni traerlo de otro
+	if err := scope.Check(oldCode, newCode); err != nil {
+		return nil, err
+	}
+
+	existingPermission, err := u.permissionRepo.GetByCode(newCode)
+	if err == nil && existingPermission != nil {
+		return nil, domain.ErrPermissionCodeExists
+	}
+
+	result, err := u.renamer.RenameCode(oldCode, newCode)
+	if err != nil {
+		return nil, fmt.Errorf("renombrar permiso %s: %w", oldCode, err)
 	}
 
-	return false
+	return result, nil
 }
@@ -0,0 +1,1402 @@
+package usecase
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/black4ninja/mi-proyecto/internal/permission/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+func TestGetPermissionsByCodesArrayEmptyInput(t *testing.T) {
+	uc := NewPermissionUseCase(newFakePermissionRepo("users:read"), newFakeUserRoleRepo(), nil, nil)
+
+	for name, codes := range map[string][]string{"nil": nil, "vacío": {}} {
+		t.Run(name, func(t *testing.T) {
+			permissions, err := uc.GetPermissionsByCodesArray(codes)
+			require.NoError(t, err)
+			require.NotNil(t, permissions)
+			assert.Empty(t, permissions)
+
+			data, err := json.Marshal(permissions)
+			require.NoError(t, err)
+			assert.JSONEq(t, `[]`, string(data))
+		})
+	}
+}
+
+func TestRoleWithoutPermissionsSerializesEmptyList(t *testing.T) {
+	role := &domain.Role{Name: "vacío"}
+	uc := NewRoleUseCase(newFakeRoleRepo(role), newFakePermissionRepo("users:read"), newFakeUserRoleRepo(), domain.RoleDeleteCleanup)
+
+	response, err := uc.GetRole(role.ID.Hex())
+	require.NoError(t, err)
+
+	data, err := json.Marshal(response)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"permissions":[]`)
+}
+
+func TestGetRolesPage(t *testing.T) {
+	admin := &domain.Role{Name: "admin", Permissions: []string{"users:read"}}
+	editor := &domain.Role{Name: "editor"}
+	viewer := &domain.Role{Name: "viewer"}
+	uc := NewRoleUseCase(newFakeRoleRepo(viewer, admin, editor), newFakePermissionRepo("users:read"), newFakeUserRoleRepo(), domain.RoleDeleteCleanup)
+
+	roles, total, err := uc.GetRolesPage(nil, 0, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	require.Len(t, roles, 2)
+	assert.Equal(t, "admin", roles[0].Name)
+	require.Len(t, roles[0].Permissions, 1)
+	assert.Equal(t, "users:read", roles[0].Permissions[0].Code)
+
+	// Una página fuera de rango se serializa como lista vacía
+	roles, total, err = uc.GetRolesPage(nil, 4, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	data, err := json.Marshal(roles)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[]`, string(data))
+}
+
+func TestRenamePermissionCode(t *testing.T) {
+	setup := func() (domain.PermissionUseCase, domain.RoleUseCase, *fakeUserRoleRepo, *domain.Role) {
+		permissionRepo := newFakePermissionRepo("users:raed", "users:write")
+		editor := &domain.Role{Name: "editor", Permissions: []string{"users:raed", "users:write"}}
+		viewer := &domain.Role{Name: "viewer", Permissions: []string{"users:write"}}
+		roleRepo := newFakeRoleRepo(editor, viewer)
+		userRoleRepo := newFakeUserRoleRepo()
+		require.NoError(t, userRoleRepo.AddPermission("usuario-1", "users:raed"))
+		require.NoError(t, userRoleRepo.AddPermission("usuario-2", "users:write"))
+
+		renamer := &fakePermissionRenamer{permissions: permissionRepo, roles: roleRepo, userRoles: userRoleRepo}
+		return NewPermissionUseCase(permissionRepo, userRoleRepo, renamer, nil),
+			NewRoleUseCase(roleRepo, permissionRepo, userRoleRepo, domain.RoleDeleteCleanup),
+			userRoleRepo, editor
+	}
+
+	t.Run("las referencias siguen al nuevo código", func(t *testing.T) {
+		uc, roleUC, userRoleRepo, editor := setup()
+
+		result, err := uc.RenamePermissionCode(nil, "users:raed", " users:read ")
+		require.NoError(t, err)
+		assert.Equal(t, &domain.PermissionRenameResult{
+			OldCode: "users:raed", NewCode: "users:read", RolesUpdated: 1, UserRolesUpdated: 1,
+		}, result)
+
+		permission, err := uc.GetPermissionByCode("users:read")
+		require.NoError(t, err)
+		assert.Equal(t, "users:read", permission.Code)
+		_, err = uc.GetPermissionByCode("users:raed")
+		assert.Error(t, err)
+
+		role, err := roleUC.GetRole(editor.ID.Hex())
+		require.NoError(t, err)
+		var codes []string
+		for _, p := range role.Permissions {
+			codes = append(codes, p.Code)
+		}
+		assert.ElementsMatch(t, []string{"users:read", "users:write"}, codes)
+		assert.Equal(t, []string{"users:read"}, userRoleRepo.userRoles["usuario-1"].Permissions)
+		assert.Equal(t, []string{"users:write"}, userRoleRepo.userRoles["usuario-2"].Permissions)
+	})
+
+	t.Run("código mal formado", func(t *testing.T) {
+		uc, _, _, _ := setup()
+		_, err := uc.RenamePermissionCode(nil, "users:raed", "Users:Read")
+		assert.ErrorIs(t, err, domain.ErrMalformedPermission)
+	})
+
+	t.Run("código en uso", func(t *testing.T) {
+		uc, _, _, _ := setup()
+		_, err := uc.RenamePermissionCode(nil, "users:raed", "users:write")
+		assert.ErrorIs(t, err, domain.ErrPermissionCodeExists)
+	})
+
+	t.Run("mismo código", func(t *testing.T) {
+		uc, _, _, _ := setup()
+		_, err := uc.RenamePermissionCode(nil, "users:raed", "users:raed")
+		assert.ErrorIs(t, err, domain.ErrInvalidPermission)
+	})
+
+	t.Run("permiso inexistente", func(t *testing.T) {
+		uc, _, _, _ := setup()
+		_, err := uc.RenamePermissionCode(nil, "users:fly", "users:flight")
+		assert.ErrorIs(t, err, domain.ErrPermissionNotFound)
+	})
+}
+
+func TestDeletePermission(t *testing.T) {
+	cache := &fakeCacheInvalidator{}
+	setup := func() (domain.PermissionUseCase, *fakePermissionRepo, *fakeUserRoleRepo, *domain.Role, *domain.Role) {
+		cache.calls = 0
+		permissionRepo := newFakePermissionRepo("users:read", "users:write", "users:export")
+		editor := &domain.Role{Name: "editor", Permissions: []string{"users:read", "users:write"}}
+		viewer := &domain.Role{Name: "viewer", Permissions: []string{"users:read", "users:*"}}
+		roleRepo := newFakeRoleRepo(viewer, editor)
+		userRoleRepo := newFakeUserRoleRepo()
+		require.NoError(t, userRoleRepo.AddPermission("usuario-1", "users:read"))
+		require.NoError(t, userRoleRepo.AddPermission("usuario-1", "users:write"))
+
+		references := &fakePermissionReferenceRemover{permissions: permissionRepo, roles: roleRepo, userRoles: userRoleRepo}
+		return NewPermissionUseCase(permissionRepo, userRoleRepo, nil, references, WithCacheInvalidator(cache)),
+			permissionRepo, userRoleRepo, editor, viewer
+	}
+	idOf := func(repo *fakePermissionRepo, code string) string {
+		return repo.permissions[code].ID.Hex()
+	}
+
+	t.Run("sin force se rechaza listando los roles", func(t *testing.T) {
+		uc, permissionRepo, userRoleRepo, editor, viewer := setup()
+
+		_, err := uc.DeletePermission(nil, idOf(permissionRepo, "users:read"), false)
+		assert.ErrorIs(t, err, domain.ErrPermissionInUse)
+		var inUse *domain.PermissionInUseError
+		require.ErrorAs(t, err, &inUse)
+		assert.Equal(t, []string{"editor", "viewer"}, inUse.Roles)
+		assert.Equal(t, int64(1), inUse.UserAssignments)
+		assert.EqualError(t, err, "el permiso users:read está asignado a los roles editor, viewer y a 1 asignaciones de usuario")
+
+		// No se modificó nada
+		assert.Contains(t, permissionRepo.permissions, "users:read")
+		assert.Contains(t, editor.Permissions, "users:read")
+		assert.Contains(t, viewer.Permissions, "users:read")
+		assert.Contains(t, userRoleRepo.userRoles["usuario-1"].Permissions, "users:read")
+		assert.Zero(t, cache.calls)
+	})
+
+	t.Run("con force se quita de roles y asignaciones", func(t *testing.T) {
+		uc, permissionRepo, userRoleRepo, editor, viewer := setup()
+
+		result, err := uc.DeletePermission(nil, idOf(permissionRepo, "users:read"), true)
+		require.NoError(t, err)
+		assert.Equal(t, &domain.PermissionDeleteResult{Code: "users:read", RolesUpdated: 2, UserRolesUpdated: 1}, result)
+
+		assert.NotContains(t, permissionRepo.permissions, "users:read")
+		assert.Equal(t, []string{"users:write"}, editor.Permissions)
+		// Los comodines no son referencias al código
+		assert.Equal(t, []string{"users:*"}, viewer.Permissions)
+		assert.Equal(t, []string{"users:write"}, userRoleRepo.userRoles["usuario-1"].Permissions)
+		// Los permisos en caché de los usuarios con esos roles ya no son válidos
+		assert.Equal(t, 1, cache.calls)
+	})
+
+	t.Run("sin referencias se elimina sin force", func(t *testing.T) {
+		uc, permissionRepo, _, _, _ := setup()
+
+		result, err := uc.DeletePermission(nil, idOf(permissionRepo, "users:export"), false)
+		require.NoError(t, err)
+		assert.Equal(t, &domain.PermissionDeleteResult{Code: "users:export"}, result)
+		assert.NotContains(t, permissionRepo.permissions, "users:export")
+	})
+
+	t.Run("fuera del ámbito", func(t *testing.T) {
+		uc, permissionRepo, _, _, _ := setup()
+
+		scope := domain.NewAdminScope([]string{"admin:scope:finanzas"})
+		_, err := uc.DeletePermission(scope, idOf(permissionRepo, "users:export"), true)
+		assert.ErrorIs(t, err, domain.ErrOutOfAdminScope)
+		assert.Contains(t, permissionRepo.permissions, "users:export")
+	})
+}
+
+func TestValidateCodes(t *testing.T) {
+	repo := newFakePermissionRepo("users:read", "admin:data:import")
+	uc := NewPermissionUseCase(repo, newFakeUserRoleRepo(), nil, nil)
+
+	report, err := uc.ValidateCodes([]string{
+		"users:read",        // existente
+		"admin:data:import", // existente con submódulo
+		"users:fly",         // faltante
+		"users:read",        // duplicado
+		"users",             // sin acción
+		"Users:Read",        // mayúsculas
+		"users:*",           // comodín
+		"users::read",       // segmento vacío
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"users:read", "admin:data:import"}, report.Existing)
+	assert.Equal(t, []string{"users:fly"}, report.Missing)
+
+	var malformed []string
+	for _, m := range report.Malformed {
+		malformed = append(malformed, m.Code)
+		assert.NotEmpty(t, m.Reason)
+	}
+	assert.Equal(t, []string{"users", "Users:Read", "users:*", "users::read"}, malformed)
+
+	// Solo los códigos bien formados se consultan en el repositorio
+	require.Len(t, repo.existingCalls, 1)
+	assert.Equal(t, []string{"users:read", "admin:data:import", "users:fly"}, repo.existingCalls[0])
+}
+
+func TestValidateCodesEmptyReportSerializesLists(t *testing.T) {
+	uc := NewPermissionUseCase(newFakePermissionRepo(), newFakeUserRoleRepo(), nil, nil)
+
+	report, err := uc.ValidateCodes(nil)
+	require.NoError(t, err)
+
+	data, err := json.Marshal(report)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"existing":[],"missing":[],"malformed":[]}`, string(data))
+}
+
+func TestCreatePermissionRejectsMalformedCode(t *testing.T) {
+	uc := NewPermissionUseCase(newFakePermissionRepo(), newFakeUserRoleRepo(), nil, nil)
+
+	_, err := uc.CreatePermission(nil, &domain.CreatePermissionRequest{Code: "Usuarios Leer", Module: "users", Action: "read", Name: "Leer"})
+	assert.ErrorIs(t, err, domain.ErrMalformedPermission)
+}
+
+func TestEnsureUserRoleCreatesEmptyAssignment(t *testing.T) {
+	uc := NewUserRoleUseCase(newFakeUserRoleRepo(), newFakeRoleRepo(), newFakePermissionRepo("users:read"))
+
+	created, err := uc.EnsureUserRole("nuevo")
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	userRoles, err := uc.GetUserRoles("nuevo")
+	require.NoError(t, err)
+	assert.Empty(t, userRoles.Roles)
+	assert.Empty(t, userRoles.Permissions)
+
+	// Llamadas posteriores no reemplazan la asignación existente
+	require.NoError(t, uc.AssignPermissionToUser(nil, &domain.AssignPermissionRequest{UserID: "nuevo", PermissionCode: "users:read"}))
+	created, err = uc.EnsureUserRole("nuevo")
+	require.NoError(t, err)
+	assert.False(t, created)
+
+	permissions, err := uc.GetUserPermissions("nuevo")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"users:read"}, permissions)
+}
+
+func TestClearUserRoles(t *testing.T) {
+	userRoleRepo := newFakeUserRoleRepo()
+	uc := WithPermissionCache(NewUserRoleUseCase(userRoleRepo, newFakeRoleRepo(), newFakePermissionRepo("users:read")), 30*time.Second)
+	require.NoError(t, uc.AssignPermissionToUser(nil, &domain.AssignPermissionRequest{UserID: "ana", PermissionCode: "users:read"}))
+
+	allowed, err := uc.HasPermission("ana", "users:read")
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	require.NoError(t, uc.ClearUserRoles("ana"))
+	assert.Empty(t, userRoleRepo.userRoles["ana"].Roles)
+	assert.Empty(t, userRoleRepo.userRoles["ana"].Permissions)
+
+	// La caché no conserva los permisos quitados
+	allowed, err = uc.HasPermission("ana", "users:read")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+}
+
+func TestDeleteUserRoles(t *testing.T) {
+	userRoleRepo := newFakeUserRoleRepo()
+	uc := WithPermissionCache(NewUserRoleUseCase(userRoleRepo, newFakeRoleRepo(), newFakePermissionRepo("users:read")), 30*time.Second)
+	require.NoError(t, uc.AssignPermissionToUser(nil, &domain.AssignPermissionRequest{UserID: "ana", PermissionCode: "users:read"}))
+
+	allowed, err := uc.HasPermission("ana", "users:read")
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	require.NoError(t, uc.DeleteUserRoles("ana"))
+	assert.NotContains(t, userRoleRepo.userRoles, "ana")
+
+	allowed, err = uc.HasPermission("ana", "users:read")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+}
+
+func TestUpdateRolePermissions(t *testing.T) {
+	newUseCase := func() (domain.RoleUseCase, *domain.Role, *domain.Role) {
+		editor := &domain.Role{Name: "editor", Permissions: []string{"users:read", "users:write"}}
+		admin := &domain.Role{Name: "admin", Permissions: []string{"users:read"}, IsSystem: true}
+		repo := newFakeRoleRepo(editor, admin)
+		return NewRoleUseCase(repo, newFakePermissionRepo("users:read", "users:write", "reports:read"), newFakeUserRoleRepo(), domain.RoleDeleteCleanup), editor, admin
+	}
+	codes := func(role *domain.RoleResponse) []string {
+		var result []string
+		for _, p := range role.Permissions {
+			result = append(result, p.Code)
+		}
+		return result
+	}
+
+	t.Run("combina altas y bajas", func(t *testing.T) {
+		uc, editor, _ := newUseCase()
+		role, err := uc.UpdateRolePermissions(nil, editor.ID.Hex(), &domain.UpdateRolePermissionsRequest{
+			Add:    []string{"reports:read", "users:read"},
+			Remove: []string{"users:write"},
+		})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"users:read", "reports:read"}, codes(role))
+		assert.ElementsMatch(t, []string{"users:read", "reports:read"}, editor.Permissions)
+	})
+
+	t.Run("permiso inexistente no aplica ningún cambio", func(t *testing.T) {
+		uc, editor, _ := newUseCase()
+		_, err := uc.UpdateRolePermissions(nil, editor.ID.Hex(), &domain.UpdateRolePermissionsRequest{
+			Add:    []string{"users:fly"},
+			Remove: []string{"users:write"},
+		})
+		assert.ErrorIs(t, err, domain.ErrInvalidPermission)
+		assert.Equal(t, []string{"users:read", "users:write"}, editor.Permissions)
+	})
+
+	t.Run("mismo código en ambas listas", func(t *testing.T) {
+		uc, editor, _ := newUseCase()
+		_, err := uc.UpdateRolePermissions(nil, editor.ID.Hex(), &domain.UpdateRolePermissionsRequest{
+			Add:    []string{"reports:read"},
+			Remove: []string{"reports:read"},
+		})
+		assert.ErrorIs(t, err, domain.ErrConflictingDelta)
+	})
+
+	t.Run("rol de sistema", func(t *testing.T) {
+		uc, _, admin := newUseCase()
+		_, err := uc.UpdateRolePermissions(nil, admin.ID.Hex(), &domain.UpdateRolePermissionsRequest{
+			Remove: []string{"users:read"},
+		})
+		assert.ErrorIs(t, err, domain.ErrSystemRoleImmutable)
+		assert.Equal(t, []string{"users:read"}, admin.Permissions)
+	})
+}
+
+func TestSetRolePermissions(t *testing.T) {
+	newUseCase := func() (domain.RoleUseCase, *fakePermissionRepo, *domain.Role, *domain.Role) {
+		editor := &domain.Role{Name: "editor", Permissions: []string{"users:read", "users:write"}}
+		admin := &domain.Role{Name: "admin", Permissions: []string{"users:read"}, IsSystem: true}
+		permissionRepo := newFakePermissionRepo("users:read", "users:write", "reports:read", "reports:export")
+		return NewRoleUseCase(newFakeRoleRepo(editor, admin), permissionRepo, newFakeUserRoleRepo(), domain.RoleDeleteCleanup), permissionRepo, editor, admin
+	}
+
+	t.Run("reemplaza el conjunto completo", func(t *testing.T) {
+		uc, permissionRepo, editor, _ := newUseCase()
+		role, err := uc.SetRolePermissions(nil, editor.ID.Hex(), []string{"reports:read", "reports:export", "users:read", "reports:read"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"reports:read", "reports:export", "users:read"}, editor.Permissions)
+		assert.Len(t, role.Permissions, 3)
+		// Todos los códigos se validan en una sola consulta
+		assert.Len(t, permissionRepo.existingCalls, 1)
+	})
+
+	t.Run("lista vacía quita todos los permisos", func(t *testing.T) {
+		uc, _, editor, _ := newUseCase()
+		role, err := uc.SetRolePermissions(nil, editor.ID.Hex(), []string{})
+		require.NoError(t, err)
+		assert.Empty(t, editor.Permissions)
+		assert.Empty(t, role.Permissions)
+	})
+
+	t.Run("códigos inexistentes no aplican ningún cambio", func(t *testing.T) {
+		uc, _, editor, _ := newUseCase()
+		_, err := uc.SetRolePermissions(nil, editor.ID.Hex(), []string{"reports:read", "users:fly", "users:swim"})
+		assert.ErrorIs(t, err, domain.ErrInvalidPermission)
+		assert.ErrorContains(t, err, "users:fly, users:swim")
+		assert.Equal(t, []string{"users:read", "users:write"}, editor.Permissions)
+	})
+
+	t.Run("rol de sistema", func(t *testing.T) {
+		uc, _, _, admin := newUseCase()
+		_, err := uc.SetRolePermissions(nil, admin.ID.Hex(), []string{"reports:read"})
+		assert.ErrorIs(t, err, domain.ErrSystemRoleImmutable)
+		assert.Equal(t, []string{"users:read"}, admin.Permissions)
+	})
+
+	t.Run("fuera del ámbito", func(t *testing.T) {
+		uc, _, editor, _ := newUseCase()
+		scope := domain.NewAdminScope([]string{"admin:scope:users"})
+		_, err := uc.SetRolePermissions(scope, editor.ID.Hex(), []string{"users:read", "reports:read"})
+		assert.ErrorIs(t, err, domain.ErrOutOfAdminScope)
+		assert.Equal(t, []string{"users:read", "users:write"}, editor.Permissions)
+	})
+}
+
+func TestAddAndRemoveRolePermissions(t *testing.T) {
+	newUseCase := func() (domain.RoleUseCase, *fakePermissionRepo, *domain.Role, *domain.Role) {
+		editor := &domain.Role{Name: "editor", Permissions: []string{"users:read", "users:write"}}
+		admin := &domain.Role{Name: "admin", Permissions: []string{"users:read"}, IsSystem: true}
+		permissionRepo := newFakePermissionRepo("users:read", "users:write", "reports:read", "reports:export")
+		return NewRoleUseCase(newFakeRoleRepo(editor, admin), permissionRepo, newFakeUserRoleRepo(), domain.RoleDeleteCleanup), permissionRepo, editor, admin
+	}
+
+	t.Run("añade varios permisos validándolos en una sola consulta", func(t *testing.T) {
+		uc, permissionRepo, editor, _ := newUseCase()
+		role, err := uc.AddRolePermissions(nil, editor.ID.Hex(), []string{"reports:read", "reports:export", "users:read"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"users:read", "users:write", "reports:read", "reports:export"}, editor.Permissions)
+		assert.Len(t, role.Permissions, 4)
+		assert.Len(t, permissionRepo.existingCalls, 1)
+	})
+
+	t.Run("códigos inexistentes no aplican ningún cambio", func(t *testing.T) {
+		uc, _, editor, _ := newUseCase()
+		_, err := uc.AddRolePermissions(nil, editor.ID.Hex(), []string{"reports:read", "users:fly", "users:swim"})
+		assert.ErrorIs(t, err, domain.ErrInvalidPermission)
+		assert.ErrorContains(t, err, "users:fly, users:swim")
+		assert.Equal(t, []string{"users:read", "users:write"}, editor.Permissions)
+	})
+
+	t.Run("quita varios permisos, aunque ya no existan", func(t *testing.T) {
+		uc, permissionRepo, editor, _ := newUseCase()
+		editor.Permissions = append(editor.Permissions, "legacy:read")
+		role, err := uc.RemoveRolePermissions(nil, editor.ID.Hex(), []string{"users:write", "legacy:read", "reports:read"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"users:read"}, editor.Permissions)
+		assert.Len(t, role.Permissions, 1)
+		assert.Empty(t, permissionRepo.existingCalls, "quitar no consulta los códigos")
+	})
+
+	t.Run("rol de sistema", func(t *testing.T) {
+		uc, _, _, admin := newUseCase()
+		_, err := uc.AddRolePermissions(nil, admin.ID.Hex(), []string{"reports:read"})
+		assert.ErrorIs(t, err, domain.ErrSystemRoleImmutable)
+		_, err = uc.RemoveRolePermissions(nil, admin.ID.Hex(), []string{"users:read"})
+		assert.ErrorIs(t, err, domain.ErrSystemRoleImmutable)
+		assert.Equal(t, []string{"users:read"}, admin.Permissions)
+	})
+
+	t.Run("fuera del ámbito", func(t *testing.T) {
+		uc, _, editor, _ := newUseCase()
+		scope := domain.NewAdminScope([]string{"admin:scope:users"})
+		_, err := uc.AddRolePermissions(scope, editor.ID.Hex(), []string{"reports:read"})
+		assert.ErrorIs(t, err, domain.ErrOutOfAdminScope)
+		assert.Equal(t, []string{"users:read", "users:write"}, editor.Permissions)
+	})
+}
+
+func TestHasModuleAccess(t *testing.T) {
+	userRoleRepo := newFakeUserRoleRepo()
+	require.NoError(t, userRoleRepo.AddPermission("ana", "finanzas:read"))
+	require.NoError(t, userRoleRepo.AddPermission("luis", "inventario:*"))
+	require.NoError(t, userRoleRepo.AddPermission("eva", "finanzasx:read"))
+	require.NoError(t, userRoleRepo.AddPermission("root", "*"))
+	uc := NewUserRoleUseCase(userRoleRepo, newFakeRoleRepo(), newFakePermissionRepo())
+
+	tests := []struct {
+		name    string
+		userID  string
+		module  string
+		allowed bool
+	}{
+		{"permiso concreto del módulo", "ana", "finanzas", true},
+		{"comodín del módulo", "luis", "inventario", true},
+		{"permiso de otro módulo", "ana", "inventario", false},
+		{"módulo con el mismo prefijo", "eva", "finanzas", false},
+		{"módulo vacío", "ana", "", false},
+		{"usuario sin permisos", "sin-permisos", "finanzas", false},
+		{"comodín global", "root", "finanzas", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, err := uc.HasModuleAccess(tt.userID, tt.module)
+			require.NoError(t, err)
+			assert.Equal(t, tt.allowed, allowed)
+		})
+	}
+
+	// HasPermission conserva la semántica de comodines: "finanzas:read" no concede "finanzas:*"
+	allowed, err := uc.HasPermission("ana", "finanzas:*")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+}
+
+func TestGetUsersByRole(t *testing.T) {
+	editor := &domain.Role{Name: "editor"}
+	viewer := &domain.Role{Name: "viewer"}
+	roleRepo := newFakeRoleRepo(editor, viewer)
+	editorID, viewerID := editor.ID.Hex(), viewer.ID.Hex()
+	userRoleRepo := newFakeUserRoleRepo()
+	userRoleRepo.userRoles["luis"] = &domain.UserRole{UserID: "luis", Roles: []string{editorID}}
+	userRoleRepo.userRoles["ana"] = &domain.UserRole{UserID: "ana", Roles: []string{editorID, viewerID}}
+	userRoleRepo.userRoles["eva"] = &domain.UserRole{UserID: "eva", Roles: []string{viewerID}}
+	uc := NewUserRoleUseCase(userRoleRepo, roleRepo, newFakePermissionRepo())
+
+	users, err := uc.GetUsersByRole(editorID, 0, 20)
+	require.NoError(t, err)
+	assert.Equal(t, editorID, users.RoleID)
+	assert.Equal(t, []string{"ana", "luis"}, users.UserIDs)
+	assert.Equal(t, int64(2), users.Total)
+
+	users, err = uc.GetUsersByRole(viewerID, 0, 20)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ana", "eva"}, users.UserIDs)
+
+	t.Run("pagina los usuarios", func(t *testing.T) {
+		users, err := uc.GetUsersByRole(viewerID, 1, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"eva"}, users.UserIDs)
+		assert.Equal(t, int64(2), users.Total)
+	})
+
+	t.Run("omite a los usuarios con el rol vencido", func(t *testing.T) {
+		userRoleRepo.userRoles["eva"].RoleExpirations = []domain.RoleExpiration{{RoleID: viewerID, ExpiresAt: time.Now().Add(-time.Minute)}}
+		users, err := uc.GetUsersByRole(viewerID, 0, 20)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ana"}, users.UserIDs)
+	})
+
+	t.Run("rol sin usuarios", func(t *testing.T) {
+		delete(userRoleRepo.userRoles, "ana")
+		delete(userRoleRepo.userRoles, "eva")
+		users, err := uc.GetUsersByRole(viewerID, 0, 20)
+		require.NoError(t, err)
+		assert.NotNil(t, users.UserIDs)
+		assert.Empty(t, users.UserIDs)
+	})
+
+	t.Run("rol inexistente", func(t *testing.T) {
+		_, err := uc.GetUsersByRole("no-existe", 0, 20)
+		assert.ErrorIs(t, err, domain.ErrRoleNotFound)
+	})
+}
+
+func TestDeleteRoleAssignments(t *testing.T) {
+	setup := func(policy domain.RoleDeletePolicy) (domain.RoleUseCase, *fakeUserRoleRepo, *domain.Role, *domain.Role) {
+		editor := &domain.Role{Name: "editor"}
+		viewer := &domain.Role{Name: "viewer"}
+		roleRepo := newFakeRoleRepo(editor, viewer)
+		userRoleRepo := newFakeUserRoleRepo()
+		require.NoError(t, userRoleRepo.AddRole("ana", editor.ID.Hex()))
+		require.NoError(t, userRoleRepo.AddRole("ana", viewer.ID.Hex()))
+		require.NoError(t, userRoleRepo.AddRole("luis", editor.ID.Hex()))
+		uc := NewRoleUseCase(roleRepo, newFakePermissionRepo(), userRoleRepo, policy)
+		return uc, userRoleRepo, editor, viewer
+	}
+
+	t.Run("cleanup quita el rol de todas las asignaciones", func(t *testing.T) {
+		uc, userRoleRepo, editor, viewer := setup(domain.RoleDeleteCleanup)
+
+		require.NoError(t, uc.DeleteRole(nil, editor.ID.Hex()))
+
+		assert.Equal(t, []string{viewer.ID.Hex()}, userRoleRepo.userRoles["ana"].Roles)
+		assert.Empty(t, userRoleRepo.userRoles["luis"].Roles)
+	})
+
+	t.Run("block impide eliminar un rol asignado", func(t *testing.T) {
+		uc, userRoleRepo, editor, _ := setup(domain.RoleDeleteBlock)
+
+		err := uc.DeleteRole(nil, editor.ID.Hex())
+		assert.ErrorIs(t, err, domain.ErrRoleInUse)
+		assert.Contains(t, userRoleRepo.userRoles["luis"].Roles, editor.ID.Hex())
+		_, err = uc.GetRole(editor.ID.Hex())
+		assert.NoError(t, err, "el rol sigue existiendo")
+	})
+
+	t.Run("block con deleter comprueba y elimina en una sola operación", func(t *testing.T) {
+		editor := &domain.Role{Name: "editor"}
+		roleRepo := newFakeRoleRepo(editor)
+		deleter := &fakeRoleDeleter{}
+		uc := NewRoleUseCase(roleRepo, newFakePermissionRepo(), newFakeUserRoleRepo(), domain.RoleDeleteBlock, WithRoleDeleter(deleter))
+
+		require.NoError(t, uc.DeleteRole(nil, editor.ID.Hex()))
+		assert.Equal(t, []string{editor.ID.Hex()}, deleter.deleted)
+
+		deleter.err = fmt.Errorf("%w: 1 asignaciones", domain.ErrRoleInUse)
+		assert.ErrorIs(t, uc.DeleteRole(nil, editor.ID.Hex()), domain.ErrRoleInUse)
+	})
+
+	t.Run("un rol de sistema no se elimina ni se quita de las asignaciones", func(t *testing.T) {
+		admin := &domain.Role{Name: "admin", IsSystem: true}
+		userRoleRepo := newFakeUserRoleRepo()
+		roleRepo := newFakeRoleRepo(admin)
+		require.NoError(t, userRoleRepo.AddRole("ana", admin.ID.Hex()))
+		uc := NewRoleUseCase(roleRepo, newFakePermissionRepo(), userRoleRepo, domain.RoleDeleteCleanup)
+
+		assert.Error(t, uc.DeleteRole(nil, admin.ID.Hex()))
+		assert.Equal(t, []string{admin.ID.Hex()}, userRoleRepo.userRoles["ana"].Roles)
+	})
+}
+
+func TestEffectivePermissionsInvalidation(t *testing.T) {
+	cache := &fakeCacheInvalidator{}
+	var base *domain.Role
+	setup := func() (domain.RoleUseCase, *fakeUserRoleRepo, *domain.Role) {
+		cache.calls = 0
+		editor := &domain.Role{Name: "editor", Permissions: []string{"users:read"}}
+		base = &domain.Role{Name: "base", Permissions: []string{"users:write"}}
+		roleRepo := newFakeRoleRepo(editor, base)
+		userRoleRepo := newFakeUserRoleRepo()
+		require.NoError(t, userRoleRepo.AddRole("ana", editor.ID.Hex()))
+		require.NoError(t, userRoleRepo.AddPermission("luis", "users:read"))
+		// Ambos usuarios tienen su conjunto materializado
+		userRoleRepo.userRoles["ana"].EffectivePermissions = []string{"users:read"}
+		userRoleRepo.userRoles["luis"].EffectivePermissions = []string{"users:read"}
+		uc := NewRoleUseCase(roleRepo, newFakePermissionRepo("users:read", "users:write"), userRoleRepo, domain.RoleDeleteCleanup,
+			WithCacheInvalidator(cache))
+		return uc, userRoleRepo, editor
+	}
+
+	changes := map[string]func(uc domain.RoleUseCase, roleID string) error{
+		"añadir un permiso al rol": func(uc domain.RoleUseCase, roleID string) error {
+			return uc.AddPermissionToRole(nil, roleID, "users:write")
+		},
+		"quitar un permiso del rol": func(uc domain.RoleUseCase, roleID string) error {
+			return uc.RemovePermissionFromRole(nil, roleID, "users:read")
+		},
+		"aplicar altas y bajas al rol": func(uc domain.RoleUseCase, roleID string) error {
+			_, err := uc.UpdateRolePermissions(nil, roleID, &domain.UpdateRolePermissionsRequest{Add: []string{"users:write"}})
+			return err
+		},
+		"añadir varios permisos al rol": func(uc domain.RoleUseCase, roleID string) error {
+			_, err := uc.AddRolePermissions(nil, roleID, []string{"users:write"})
+			return err
+		},
+		"quitar varios permisos del rol": func(uc domain.RoleUseCase, roleID string) error {
+			_, err := uc.RemoveRolePermissions(nil, roleID, []string{"users:read"})
+			return err
+		},
+	}
+
+	for name, change := range changes {
+		t.Run(name, func(t *testing.T) {
+			uc, userRoleRepo, editor := setup()
+
+			require.NoError(t, change(uc, editor.ID.Hex()))
+
+			// Solo se descarta el conjunto de quienes tienen el rol
+			assert.Nil(t, userRoleRepo.userRoles["ana"].EffectivePermissions)
+			assert.Equal(t, []string{"users:read"}, userRoleRepo.userRoles["luis"].EffectivePermissions)
+			// Y los permisos en caché de la instancia
+			assert.Equal(t, 1, cache.calls)
+		})
+	}
+
+	t.Run("los cambios de permisos, herencia o la eliminación del rol vacían la caché", func(t *testing.T) {
+		roleChanges := map[string]func(uc domain.RoleUseCase, roleID string) error{
+			"reemplazar los permisos": func(uc domain.RoleUseCase, roleID string) error {
+				_, err := uc.SetRolePermissions(nil, roleID, []string{"users:write"})
+				return err
+			},
+			"cambiar la herencia": func(uc domain.RoleUseCase, roleID string) error {
+				_, err := uc.UpdateRole(nil, roleID, &domain.UpdateRoleRequest{ParentRoles: []string{base.ID.Hex()}})
+				return err
+			},
+			"eliminar el rol": func(uc domain.RoleUseCase, roleID string) error {
+				return uc.DeleteRole(nil, roleID)
+			},
+		}
+		for name, change := range roleChanges {
+			t.Run(name, func(t *testing.T) {
+				uc, _, editor := setup()
+
+				require.NoError(t, change(uc, editor.ID.Hex()))
+				assert.Equal(t, 1, cache.calls)
+			})
+		}
+	})
+
+	t.Run("un fallo al invalidar se informa", func(t *testing.T) {
+		uc, userRoleRepo, editor := setup()
+		userRoleRepo.invalidateErr = errors.New("conexión perdida")
+
+		err := uc.AddPermissionToRole(nil, editor.ID.Hex(), "users:write")
+		assert.ErrorIs(t, err, userRoleRepo.invalidateErr)
+		assert.Contains(t, editor.Permissions, "users:write", "el rol ya cambió")
+		assert.Equal(t, 1, cache.calls, "la caché se vacía aunque falle la invalidación")
+	})
+}
+
+func TestRebuildEffectivePermissions(t *testing.T) {
+	userRoleRepo := newFakeUserRoleRepo()
+	require.NoError(t, userRoleRepo.AddPermission("ana", "users:read"))
+	uc := NewUserRoleUseCase(userRoleRepo, newFakeRoleRepo(), newFakePermissionRepo())
+
+	result, err := uc.RebuildEffectivePermissions(nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.Rebuilt)
+
+	// Un administrador delegado no puede reconstruir los permisos de todos los módulos
+	_, err = uc.RebuildEffectivePermissions(domain.NewAdminScope([]string{domain.AdminScopePrefix + "finanzas"}))
+	assert.ErrorIs(t, err, domain.ErrOutOfAdminScope)
+}
+
+func TestDelegatedAdminScope(t *testing.T) {
+	finanzasRole := &domain.Role{Name: "contador", Permissions: []string{"finanzas:read", "finanzas:write"}}
+	mixedRole := &domain.Role{Name: "auditor", Permissions: []string{"finanzas:read", "users:read"}}
+	roleRepo := newFakeRoleRepo(finanzasRole, mixedRole)
+	permissionRepo := newFakePermissionRepo("finanzas:read", "finanzas:write", "finanzas:reports", "users:read", "admin:permissions")
+	userRoleRepo := newFakeUserRoleRepo()
+	require.NoError(t, userRoleRepo.AddPermission("finanzas-admin", "admin:permissions"))
+	require.NoError(t, userRoleRepo.AddPermission("finanzas-admin", domain.AdminScopePrefix+"finanzas"))
+	require.NoError(t, userRoleRepo.AddPermission("superadmin", "admin:permissions"))
+
+	userRoles := NewUserRoleUseCase(userRoleRepo, roleRepo, permissionRepo)
+	roles := NewRoleUseCase(roleRepo, permissionRepo, userRoleRepo, domain.RoleDeleteCleanup)
+	permissions := NewPermissionUseCase(permissionRepo, userRoleRepo, nil, nil)
+
+	scope, err := userRoles.GetAdminScope("finanzas-admin")
+	require.NoError(t, err)
+	require.NotNil(t, scope)
+
+	t.Run("sin permisos de ámbito no hay restricción", func(t *testing.T) {
+		unrestricted, err := userRoles.GetAdminScope("superadmin")
+		require.NoError(t, err)
+		assert.Nil(t, unrestricted)
+		assert.Nil(t, domain.NewAdminScope([]string{domain.AdminScopePrefix + "finanzas", domain.AdminScopePrefix + "*"}))
+	})
+
+	t.Run("gestiona permisos y roles de su módulo", func(t *testing.T) {
+		require.NoError(t, roles.AddPermissionToRole(scope, finanzasRole.ID.Hex(), "finanzas:reports"))
+		assert.Contains(t, finanzasRole.Permissions, "finanzas:reports")
+
+		created, err := roles.CreateRole(scope, &domain.CreateRoleRequest{Name: "tesorero", Permissions: []string{"finanzas:read"}})
+		require.NoError(t, err)
+		assert.Equal(t, "tesorero", created.Name)
+
+		_, err = permissions.CreatePermission(scope, &domain.CreatePermissionRequest{Code: "finanzas:export", Module: "finanzas", Action: "export", Name: "Exportar"})
+		require.NoError(t, err)
+
+		require.NoError(t, userRoles.AssignRoleToUser(scope, &domain.AssignRoleRequest{UserID: "ana", RoleID: finanzasRole.ID.Hex()}))
+	})
+
+	t.Run("rechaza lo que está fuera de su módulo", func(t *testing.T) {
+		err := roles.AddPermissionToRole(scope, finanzasRole.ID.Hex(), "users:read")
+		assert.ErrorIs(t, err, domain.ErrOutOfAdminScope)
+
+		// Un rol con permisos de otros módulos no se modifica aunque el cambio sea de finanzas
+		_, err = roles.UpdateRolePermissions(scope, mixedRole.ID.Hex(), &domain.UpdateRolePermissionsRequest{Add: []string{"finanzas:write"}})
+		assert.ErrorIs(t, err, domain.ErrOutOfAdminScope)
+		assert.Equal(t, []string{"finanzas:read", "users:read"}, mixedRole.Permissions)
+
+		assert.ErrorIs(t, roles.DeleteRole(scope, mixedRole.ID.Hex()), domain.ErrOutOfAdminScope)
+
+		_, err = permissions.CreatePermission(scope, &domain.CreatePermissionRequest{Code: "users:export", Module: "users", Action: "export", Name: "Exportar"})
+		assert.ErrorIs(t, err, domain.ErrOutOfAdminScope)
+
+		_, err = permissions.RenamePermissionCode(scope, "finanzas:reports", "users:reports")
+		assert.ErrorIs(t, err, domain.ErrOutOfAdminScope)
+
+		// Tampoco puede otorgarse permisos de administración fuera de su ámbito
+		err = userRoles.AssignPermissionToUser(scope, &domain.AssignPermissionRequest{UserID: "finanzas-admin", PermissionCode: "admin:permissions"})
+		assert.ErrorIs(t, err, domain.ErrOutOfAdminScope)
+		err = userRoles.AssignRoleToUser(scope, &domain.AssignRoleRequest{UserID: "finanzas-admin", RoleID: mixedRole.ID.Hex()})
+		assert.ErrorIs(t, err, domain.ErrOutOfAdminScope)
+	})
+
+	t.Run("sin ámbito el mismo cambio se permite", func(t *testing.T) {
+		require.NoError(t, roles.AddPermissionToRole(nil, mixedRole.ID.Hex(), "finanzas:write"))
+	})
+}
+
+func TestRoleInheritance(t *testing.T) {
+	setup := func() (domain.RoleUseCase, *fakeRoleRepo, *fakeUserRoleRepo, *domain.Role, *domain.Role) {
+		viewer := &domain.Role{Name: "viewer", Permissions: []string{"users:read"}}
+		editor := &domain.Role{Name: "editor", Permissions: []string{"users:write"}}
+		roleRepo := newFakeRoleRepo(viewer, editor)
+		editor.ParentRoles = []string{viewer.ID.Hex()}
+		userRoleRepo := newFakeUserRoleRepo()
+		uc := NewRoleUseCase(roleRepo, newFakePermissionRepo("users:read", "users:write", "users:delete"), userRoleRepo, domain.RoleDeleteCleanup)
+		return uc, roleRepo, userRoleRepo, viewer, editor
+	}
+
+	t.Run("el detalle separa permisos directos y heredados", func(t *testing.T) {
+		uc, roleRepo, _, viewer, editor := setup()
+		admin := &domain.Role{Name: "admin", Permissions: []string{"users:delete", "users:read"}, ParentRoles: []string{editor.ID.Hex()}}
+		require.NoError(t, roleRepo.Create(admin))
+
+		response, err := uc.GetRole(admin.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, []string{editor.ID.Hex()}, response.ParentRoles)
+		require.Len(t, response.Permissions, 2)
+
+		// users:read es directo aunque también se herede; users:write se atribuye a editor
+		require.Len(t, response.InheritedPermissions, 1)
+		assert.Equal(t, "users:write", response.InheritedPermissions[0].Code)
+		assert.Equal(t, editor.ID.Hex(), response.InheritedPermissions[0].InheritedFrom)
+
+		_, err = uc.GetRole(viewer.ID.Hex())
+		require.NoError(t, err)
+	})
+
+	t.Run("rechaza los ciclos", func(t *testing.T) {
+		uc, _, _, viewer, editor := setup()
+
+		// editor ya hereda de viewer: viewer no puede heredar de editor (A→B→A)
+		_, err := uc.UpdateRole(nil, viewer.ID.Hex(), &domain.UpdateRoleRequest{ParentRoles: []string{editor.ID.Hex()}})
+		assert.ErrorIs(t, err, domain.ErrRoleInheritanceCycle)
+		assert.Empty(t, viewer.ParentRoles)
+
+		_, err = uc.UpdateRole(nil, viewer.ID.Hex(), &domain.UpdateRoleRequest{ParentRoles: []string{viewer.ID.Hex()}})
+		assert.ErrorIs(t, err, domain.ErrRoleInheritanceCycle)
+	})
+
+	t.Run("valida que los roles padre existan", func(t *testing.T) {
+		uc, _, _, viewer, _ := setup()
+
+		_, err := uc.CreateRole(nil, &domain.CreateRoleRequest{Name: "auditor", ParentRoles: []string{"000000000000000000000000"}})
+		assert.ErrorIs(t, err, domain.ErrInvalidRole)
+
+		created, err := uc.CreateRole(nil, &domain.CreateRoleRequest{Name: "auditor", ParentRoles: []string{viewer.ID.Hex(), viewer.ID.Hex()}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{viewer.ID.Hex()}, created.ParentRoles)
+	})
+
+	t.Run("un ciclo ya guardado no bloquea la resolución", func(t *testing.T) {
+		_, roleRepo, _, viewer, editor := setup()
+		viewer.ParentRoles = []string{editor.ID.Hex()}
+
+		roles, err := domain.WithAncestorRoles([]*domain.Role{editor}, roleRepo.GetByIDs)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"users:read", "users:write"}, domain.RolePermissionCodes(roles))
+	})
+
+	t.Run("cambiar la herencia invalida a los usuarios de los roles descendientes", func(t *testing.T) {
+		uc, roleRepo, userRoleRepo, viewer, editor := setup()
+		base := &domain.Role{Name: "base", Permissions: []string{"users:delete"}}
+		require.NoError(t, roleRepo.Create(base))
+		require.NoError(t, userRoleRepo.AddRole("ana", editor.ID.Hex()))
+		require.NoError(t, userRoleRepo.AddPermission("luis", "users:read"))
+		userRoleRepo.userRoles["ana"].EffectivePermissions = []string{"users:read", "users:write"}
+		userRoleRepo.userRoles["luis"].EffectivePermissions = []string{"users:read"}
+
+		_, err := uc.UpdateRole(nil, viewer.ID.Hex(), &domain.UpdateRoleRequest{ParentRoles: []string{base.ID.Hex()}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{base.ID.Hex()}, viewer.ParentRoles)
+
+		assert.Nil(t, userRoleRepo.userRoles["ana"].EffectivePermissions)
+		assert.Equal(t, []string{"users:read"}, userRoleRepo.userRoles["luis"].EffectivePermissions)
+	})
+
+	t.Run("un administrador delegado no hereda roles fuera de su ámbito", func(t *testing.T) {
+		uc, roleRepo, _, viewer, _ := setup()
+		scope := domain.NewAdminScope([]string{domain.AdminScopePrefix + "finanzas"})
+
+		_, err := uc.CreateRole(scope, &domain.CreateRoleRequest{Name: "tesorero", ParentRoles: []string{viewer.ID.Hex()}})
+		assert.ErrorIs(t, err, domain.ErrOutOfAdminScope)
+
+		// Sus permisos directos son de finanzas, pero los heredados también cuentan
+		contador := &domain.Role{Name: "contador", Permissions: []string{"finanzas:read"}, ParentRoles: []string{viewer.ID.Hex()}}
+		require.NoError(t, roleRepo.Create(contador))
+		_, err = uc.UpdateRole(scope, contador.ID.Hex(), &domain.UpdateRoleRequest{Description: "x"})
+		assert.ErrorIs(t, err, domain.ErrOutOfAdminScope)
+	})
+}
+
+func TestParseRoleDeletePolicy(t *testing.T) {
+	assert.Equal(t, domain.RoleDeleteBlock, domain.ParseRoleDeletePolicy(" Block "))
+	assert.Equal(t, domain.RoleDeleteCleanup, domain.ParseRoleDeletePolicy("cleanup"))
+	assert.Equal(t, domain.RoleDeleteCleanup, domain.ParseRoleDeletePolicy("desconocido"))
+}
+
+func TestPreviewAssignRole(t *testing.T) {
+	reporter := &domain.Role{Name: "reporter", Permissions: []string{"reports:read", "users:read", "users:write", "audit:read"}}
+	userRoleRepo := newFakeUserRoleRepo()
+	require.NoError(t, userRoleRepo.AddPermission("ana", "users:read"))
+	require.NoError(t, userRoleRepo.AddPermission("ana", "reports:*"))
+	uc := NewUserRoleUseCase(userRoleRepo, newFakeRoleRepo(reporter), newFakePermissionRepo())
+
+	preview, err := uc.PreviewAssignRole(&domain.AssignRoleRequest{UserID: "ana", RoleID: reporter.ID.Hex()})
+	require.NoError(t, err)
+
+	assert.Equal(t, "reporter", preview.RoleName)
+	assert.False(t, preview.AlreadyAssigned)
+	assert.Equal(t, []string{"reports:*", "users:read"}, preview.CurrentPermissions)
+	assert.Equal(t, []string{"audit:read", "reports:*", "reports:read", "users:read", "users:write"}, preview.ResultingPermissions)
+	assert.Equal(t, []string{"audit:read", "users:write"}, preview.AddedPermissions,
+		"los permisos ya presentes o cubiertos por un comodín no son nuevos")
+
+	// La vista previa no modifica la asignación
+	assert.Empty(t, userRoleRepo.userRoles["ana"].Roles)
+
+	t.Run("rol inexistente", func(t *testing.T) {
+		_, err := uc.PreviewAssignRole(&domain.AssignRoleRequest{UserID: "ana", RoleID: "no-existe"})
+		assert.ErrorIs(t, err, domain.ErrInvalidRole)
+	})
+
+	t.Run("rol ya asignado no añade permisos", func(t *testing.T) {
+		editor := &domain.Role{Name: "editor", Permissions: []string{"users:read"}}
+		repo := newFakeUserRoleRepo()
+		roleRepo := newFakeRoleRepo(editor)
+		require.NoError(t, repo.AddRole("luis", editor.ID.Hex()))
+		require.NoError(t, repo.AddPermission("luis", "users:read"))
+
+		preview, err := NewUserRoleUseCase(repo, roleRepo, newFakePermissionRepo()).
+			PreviewAssignRole(&domain.AssignRoleRequest{UserID: "luis", RoleID: editor.ID.Hex()})
+		require.NoError(t, err)
+		assert.True(t, preview.AlreadyAssigned)
+		assert.Empty(t, preview.AddedPermissions)
+	})
+
+	t.Run("usuario sin asignación no la crea", func(t *testing.T) {
+		preview, err := uc.PreviewAssignRole(&domain.AssignRoleRequest{UserID: "nuevo", RoleID: reporter.ID.Hex()})
+		require.NoError(t, err)
+		assert.Empty(t, preview.CurrentPermissions)
+		assert.NotContains(t, userRoleRepo.userRoles, "nuevo", "la vista previa es de solo lectura")
+	})
+}
+
+func TestUpdateRoleVersionConflict(t *testing.T) {
+	role := &domain.Role{Name: "editor", Version: 3}
+	uc := NewRoleUseCase(newFakeRoleRepo(role), newFakePermissionRepo(), newFakeUserRoleRepo(), domain.RoleDeleteCleanup)
+
+	stale := int64(2)
+	_, err := uc.UpdateRole(nil, role.ID.Hex(), &domain.UpdateRoleRequest{Description: "cambio", ExpectedVersion: &stale})
+	assert.ErrorIs(t, err, utils.ErrVersionConflict)
+	assert.Empty(t, role.Description)
+
+	current := int64(3)
+	updated, err := uc.UpdateRole(nil, role.ID.Hex(), &domain.UpdateRoleRequest{Description: "cambio", ExpectedVersion: &current})
+	require.NoError(t, err)
+	assert.Equal(t, "cambio", updated.Description)
+	assert.Equal(t, int64(4), updated.Version)
+}
+
+// newUserRoleFixture crea un usuario con varios roles que comparten permisos,
+// un rol inexistente y un permiso específico
+func newUserRoleFixture(roleCount int) (*fakeUserRoleRepo, *fakeRoleRepo, *fakePermissionRepo) {
+	permissionRepo := newFakePermissionRepo("users:read", "users:write", "reports:read", "audit:read")
+	roleRepo := newFakeRoleRepo()
+	userRoleRepo := newFakeUserRoleRepo()
+
+	codes := []string{"users:read", "users:write", "reports:read"}
+	for i := 0; i < roleCount; i++ {
+		role := &domain.Role{Name: fmt.Sprintf("rol-%d", i), Permissions: codes[:1+i%len(codes)]}
+		_ = roleRepo.Create(role)
+		_ = userRoleRepo.AddRole("u1", role.ID.Hex())
+	}
+	_ = userRoleRepo.AddRole("u1", "rol-eliminado")
+	_ = userRoleRepo.AddPermission("u1", "audit:read")
+
+	return userRoleRepo, roleRepo, permissionRepo
+}
+
+func TestGetUserRolesBatchesQueries(t *testing.T) {
+	userRoleRepo, roleRepo, permissionRepo := newUserRoleFixture(3)
+	uc := NewUserRoleUseCase(userRoleRepo, roleRepo, permissionRepo)
+
+	response, err := uc.GetUserRoles("u1")
+	require.NoError(t, err)
+
+	// El rol inexistente se omite y los demás conservan el orden de asignación
+	require.Len(t, response.Roles, 3)
+	var names []string
+	for _, role := range response.Roles {
+		names = append(names, role.Name)
+	}
+	assert.Equal(t, []string{"rol-0", "rol-1", "rol-2"}, names)
+
+	var rolePermissions []string
+	for _, p := range response.Roles[2].Permissions {
+		rolePermissions = append(rolePermissions, p.Code)
+	}
+	assert.Equal(t, []string{"users:read", "users:write", "reports:read"}, rolePermissions)
+	require.Len(t, response.Permissions, 1)
+	assert.Equal(t, "audit:read", response.Permissions[0].Code)
+
+	// Una consulta de roles y una de permisos, sin importar cuántos roles tenga el usuario
+	assert.Zero(t, roleRepo.getByIDCalls)
+	assert.Equal(t, 1, permissionRepo.codesArrayCalls)
+}
+
+func TestGetPermissionMatrix(t *testing.T) {
+	newUseCase := func() (domain.UserRoleUseCase, *fakeUserRoleRepo) {
+		userRoleRepo := newFakeUserRoleRepo()
+		userRoleRepo.userRoles["ana"] = &domain.UserRole{UserID: "ana", Permissions: []string{"users:read", "reports:*"}}
+		userRoleRepo.userRoles["luis"] = &domain.UserRole{UserID: "luis", Permissions: []string{"*"}}
+		userRoleRepo.userRoles["eva"] = &domain.UserRole{UserID: "eva", Permissions: []string{"users:write"}}
+		permissionRepo := newFakePermissionRepo("users:read", "users:write", "reports:export")
+		return NewUserRoleUseCase(userRoleRepo, newFakeRoleRepo(), permissionRepo), userRoleRepo
+	}
+
+	t.Run("códigos indicados", func(t *testing.T) {
+		uc, userRoleRepo := newUseCase()
+
+		matrix, err := uc.GetPermissionMatrix(
+			[]string{"ana", "luis", "eva", "sin-asignacion", "ana", " "},
+			[]string{"users:read", "reports:export", "users:read"},
+		)
+		require.NoError(t, err)
+		assert.Equal(t, domain.PermissionMatrix{
+			"ana":            {"users:read": true, "reports:export": true},
+			"luis":           {"users:read": true, "reports:export": true},
+			"eva":            {"users:read": false, "reports:export": false},
+			"sin-asignacion": {"users:read": false, "reports:export": false},
+		}, matrix)
+		// Una sola consulta para todos los usuarios
+		assert.Equal(t, 1, userRoleRepo.batchLookups)
+	})
+
+	t.Run("sin códigos usa los permisos registrados", func(t *testing.T) {
+		uc, _ := newUseCase()
+
+		matrix, err := uc.GetPermissionMatrix([]string{"ana", "eva"}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, domain.PermissionMatrix{
+			"ana": {"users:read": true, "users:write": false, "reports:export": true},
+			"eva": {"users:read": false, "users:write": true, "reports:export": false},
+		}, matrix)
+	})
+
+	t.Run("demasiados usuarios", func(t *testing.T) {
+		uc, userRoleRepo := newUseCase()
+		userIDs := make([]string, domain.MaxPermissionMatrixUsers+1)
+		for i := range userIDs {
+			userIDs[i] = fmt.Sprintf("u%d", i)
+		}
+
+		_, err := uc.GetPermissionMatrix(userIDs, []string{"users:read"})
+		assert.ErrorIs(t, err, domain.ErrMatrixTooLarge)
+		assert.Zero(t, userRoleRepo.batchLookups)
+	})
+
+	t.Run("error del repositorio", func(t *testing.T) {
+		uc, userRoleRepo := newUseCase()
+		dbErr := errors.New("conexión perdida")
+		userRoleRepo.err = dbErr
+
+		_, err := uc.GetPermissionMatrix([]string{"ana"}, []string{"users:read"})
+		assert.ErrorIs(t, err, dbErr)
+	})
+}
+
+func TestAssignRoleWithExpiry(t *testing.T) {
+	contractor := &domain.Role{Name: "contratista", Permissions: []string{"reports:read"}}
+	staff := &domain.Role{Name: "personal", Permissions: []string{"users:read"}}
+	expired := &domain.Role{Name: "auditor", Permissions: []string{"audit:read"}}
+	newUseCase := func() (domain.UserRoleUseCase, *fakeUserRoleRepo) {
+		userRoleRepo := newFakeUserRoleRepo()
+		roleRepo := newFakeRoleRepo(contractor, staff, expired)
+		permissionRepo := newFakePermissionRepo("reports:read", "users:read", "audit:read")
+		return NewUserRoleUseCase(userRoleRepo, roleRepo, permissionRepo), userRoleRepo
+	}
+
+	t.Run("guarda el vencimiento y muestra la vigencia restante", func(t *testing.T) {
+		uc, userRoleRepo := newUseCase()
+		expiresAt := time.Now().Add(48 * time.Hour)
+
+		require.NoError(t, uc.AssignRoleToUser(nil, &domain.AssignRoleRequest{UserID: "ana", RoleID: contractor.ID.Hex(), ExpiresAt: &expiresAt}))
+		require.NoError(t, uc.AssignRoleToUser(nil, &domain.AssignRoleRequest{UserID: "ana", RoleID: staff.ID.Hex()}))
+		// Un rol ya vencido, pendiente del barrido
+		userRole := userRoleRepo.userRoles["ana"]
+		userRole.Roles = append(userRole.Roles, expired.ID.Hex())
+		userRole.RoleExpirations = append(userRole.RoleExpirations, domain.RoleExpiration{RoleID: expired.ID.Hex(), ExpiresAt: time.Now().Add(-time.Minute)})
+
+		response, err := uc.GetUserRoles("ana")
+		require.NoError(t, err)
+
+		require.Len(t, response.Roles, 2, "el rol vencido se omite")
+		assert.Equal(t, "contratista", response.Roles[0].Name)
+		require.NotNil(t, response.Roles[0].ExpiresAt)
+		assert.WithinDuration(t, expiresAt, response.Roles[0].ExpiresAt.Time, time.Millisecond)
+		assert.InDelta(t, (48 * time.Hour).Seconds(), float64(response.Roles[0].ExpiresIn), 5)
+
+		assert.Equal(t, "personal", response.Roles[1].Name)
+		assert.Nil(t, response.Roles[1].ExpiresAt)
+		assert.Zero(t, response.Roles[1].ExpiresIn)
+	})
+
+	t.Run("rechaza un vencimiento pasado", func(t *testing.T) {
+		uc, userRoleRepo := newUseCase()
+		past := time.Now().Add(-time.Hour)
+
+		err := uc.AssignRoleToUser(nil, &domain.AssignRoleRequest{UserID: "ana", RoleID: contractor.ID.Hex(), ExpiresAt: &past})
+		assert.ErrorIs(t, err, domain.ErrInvalidRoleExpiry)
+		assert.NotContains(t, userRoleRepo.userRoles, "ana")
+	})
+}
+
+func BenchmarkGetUserRoles(b *testing.B) {
+	userRoleRepo, roleRepo, permissionRepo := newUserRoleFixture(20)
+	uc := NewUserRoleUseCase(userRoleRepo, roleRepo, permissionRepo)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := uc.GetUserRoles("u1"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestWithDefaultRoles(t *testing.T) {
+	baseline := &domain.Role{Name: "Usuario", Permissions: []string{"profile:read"}}
+	roleRepo := newFakeRoleRepo(baseline)
+
+	t.Run("rol por defecto inexistente", func(t *testing.T) {
+		_, err := WithDefaultRoles(NewUserRoleUseCase(newFakeUserRoleRepo(), roleRepo, newFakePermissionRepo()),
+			roleRepo, newFakeUserRoleRepo(), []string{"Usuario", "No existe"})
+		assert.ErrorIs(t, err, domain.ErrInvalidRole)
+		assert.Contains(t, err.Error(), "No existe")
+	})
+
+	t.Run("sin roles por defecto no cambia el comportamiento", func(t *testing.T) {
+		userRoleRepo := newFakeUserRoleRepo()
+		uc, err := WithDefaultRoles(NewUserRoleUseCase(userRoleRepo, roleRepo, newFakePermissionRepo()), roleRepo, userRoleRepo, nil)
+		require.NoError(t, err)
+
+		created, err := uc.EnsureUserRole("nuevo")
+		require.NoError(t, err)
+		assert.True(t, created)
+		assert.Empty(t, userRoleRepo.userRoles["nuevo"].Roles)
+	})
+
+	t.Run("el usuario registrado recibe los roles por defecto", func(t *testing.T) {
+		userRoleRepo := newFakeUserRoleRepo()
+		uc, err := WithDefaultRoles(NewUserRoleUseCase(userRoleRepo, roleRepo, newFakePermissionRepo()),
+			roleRepo, userRoleRepo, []string{"Usuario"})
+		require.NoError(t, err)
+
+		created, err := uc.EnsureUserRole("nuevo")
+		require.NoError(t, err)
+		assert.True(t, created)
+		assert.Equal(t, []string{baseline.ID.Hex()}, userRoleRepo.userRoles["nuevo"].Roles)
+	})
+
+	t.Run("en lote solo reciben los roles los usuarios sin asignación", func(t *testing.T) {
+		userRoleRepo := newFakeUserRoleRepo()
+		_ = userRoleRepo.AddRole("existente", "otro-rol")
+		uc, err := WithDefaultRoles(NewUserRoleUseCase(userRoleRepo, roleRepo, newFakePermissionRepo()),
+			roleRepo, userRoleRepo, []string{"Usuario"})
+		require.NoError(t, err)
+
+		created, err := uc.EnsureUserRoles([]string{"existente", "nuevo"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"nuevo"}, created)
+		assert.Equal(t, []string{baseline.ID.Hex()}, userRoleRepo.userRoles["nuevo"].Roles)
+		assert.Equal(t, []string{"otro-rol"}, userRoleRepo.userRoles["existente"].Roles)
+	})
+
+	t.Run("un usuario con asignación conserva sus roles", func(t *testing.T) {
+		userRoleRepo := newFakeUserRoleRepo()
+		_ = userRoleRepo.AddRole("existente", "otro-rol")
+		uc, err := WithDefaultRoles(NewUserRoleUseCase(userRoleRepo, roleRepo, newFakePermissionRepo()),
+			roleRepo, userRoleRepo, []string{"Usuario"})
+		require.NoError(t, err)
+
+		created, err := uc.EnsureUserRole("existente")
+		require.NoError(t, err)
+		assert.False(t, created)
+		assert.Equal(t, []string{"otro-rol"}, userRoleRepo.userRoles["existente"].Roles)
+	})
+}
+
+func TestSystemChangesAreRecorded(t *testing.T) {
+	systemChange := func(action, target, details string) domain.PermissionChange {
+		return domain.PermissionChange{ActorID: domain.SystemActor, Action: action, Target: target, Details: details}
+	}
+
+	t.Run("limpieza de asignaciones al eliminar un rol", func(t *testing.T) {
+		editor := &domain.Role{Name: "editor"}
+		roleRepo := newFakeRoleRepo(editor)
+		userRoleRepo := newFakeUserRoleRepo()
+		require.NoError(t, userRoleRepo.AddRole("ana", editor.ID.Hex()))
+		require.NoError(t, userRoleRepo.AddRole("luis", editor.ID.Hex()))
+		recorder := &fakeChangeRecorder{}
+		uc := NewRoleUseCase(roleRepo, newFakePermissionRepo(), userRoleRepo, domain.RoleDeleteCleanup,
+			WithChangeRecorder(recorder))
+
+		require.NoError(t, uc.DeleteRole(nil, editor.ID.Hex()))
+		assert.Equal(t, []domain.PermissionChange{
+			systemChange(domain.ChangeRoleUnassignAll, "role:"+editor.ID.Hex(), "users_updated=2"),
+		}, recorder.changes)
+	})
+
+	t.Run("eliminación forzada de un permiso en uso", func(t *testing.T) {
+		permissionRepo := newFakePermissionRepo("users:read", "users:export")
+		roleRepo := newFakeRoleRepo(&domain.Role{Name: "editor", Permissions: []string{"users:read"}})
+		userRoleRepo := newFakeUserRoleRepo()
+		references := &fakePermissionReferenceRemover{permissions: permissionRepo, roles: roleRepo, userRoles: userRoleRepo}
+		recorder := &fakeChangeRecorder{}
+		uc := NewPermissionUseCase(permissionRepo, userRoleRepo, nil, references, WithChangeRecorder(recorder))
+
+		_, err := uc.DeletePermission(nil, permissionRepo.permissions["users:read"].ID.Hex(), true)
+		require.NoError(t, err)
+		// Sin referencias no hay efectos en cascada que registrar
+		_, err = uc.DeletePermission(nil, permissionRepo.permissions["users:export"].ID.Hex(), true)
+		require.NoError(t, err)
+
+		assert.Equal(t, []domain.PermissionChange{
+			systemChange(domain.ChangePermissionCascade, "permission:users:read", "roles_updated=1 user_roles_updated=0"),
+		}, recorder.changes)
+	})
+
+	t.Run("roles por defecto", func(t *testing.T) {
+		baseline := &domain.Role{Name: "Usuario"}
+		roleRepo := newFakeRoleRepo(baseline)
+		recorder := &fakeChangeRecorder{}
+		userRoleRepo := newFakeUserRoleRepo()
+		uc, err := WithDefaultRoles(NewUserRoleUseCase(userRoleRepo, roleRepo, newFakePermissionRepo()),
+			roleRepo, userRoleRepo, []string{"Usuario"}, WithChangeRecorder(recorder))
+		require.NoError(t, err)
+
+		_, err = uc.EnsureUserRole("nuevo")
+		require.NoError(t, err)
+		assert.Equal(t, []domain.PermissionChange{
+			systemChange(domain.ChangeRoleAssign, "user:nuevo", "role="+baseline.ID.Hex()+" default=true"),
+		}, recorder.changes)
+	})
+
+	t.Run("barrido de roles vencidos", func(t *testing.T) {
+		userRoleRepo := newFakeUserRoleRepo()
+		userRoleRepo.userRoles["ana"] = &domain.UserRole{
+			UserID:          "ana",
+			Roles:           []string{"contratista"},
+			RoleExpirations: []domain.RoleExpiration{{RoleID: "contratista", ExpiresAt: time.Now().Add(-time.Minute)}},
+		}
+		recorder := &fakeChangeRecorder{}
+		uc := NewUserRoleUseCase(userRoleRepo, newFakeRoleRepo(), newFakePermissionRepo(), WithChangeRecorder(recorder))
+
+		modified, err := uc.PurgeExpiredRoles(time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), modified)
+		assert.Empty(t, userRoleRepo.userRoles["ana"].Roles)
+
+		// Un barrido sin cambios no se registra
+		_, err = uc.PurgeExpiredRoles(time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, []domain.PermissionChange{
+			systemChange(domain.ChangeRoleExpire, "user_roles", "user_roles_updated=1"),
+		}, recorder.changes)
+	})
+
+	t.Run("asignación de una cuenta archivada o borrada", func(t *testing.T) {
+		userRoleRepo := newFakeUserRoleRepo()
+		require.NoError(t, userRoleRepo.AddRole("ana", "editor"))
+		require.NoError(t, userRoleRepo.AddPermission("ana", "users:read"))
+		recorder := &fakeChangeRecorder{}
+		uc := NewUserRoleUseCase(userRoleRepo, newFakeRoleRepo(), newFakePermissionRepo(), WithChangeRecorder(recorder))
+
+		require.NoError(t, uc.ClearUserRoles("ana"))
+		// Una asignación ya vacía no se registra
+		require.NoError(t, uc.ClearUserRoles("ana"))
+		require.NoError(t, uc.DeleteUserRoles("ana"))
+		assert.Equal(t, []domain.PermissionChange{
+			systemChange(domain.ChangeUserRolesClear, "user:ana", "roles=editor permissions=users:read"),
+			systemChange(domain.ChangeUserRolesDelete, "user:ana", ""),
+		}, recorder.changes)
+	})
+
+	t.Run("un fallo del registro se reporta con el cambio ya aplicado", func(t *testing.T) {
+		editor := &domain.Role{Name: "editor"}
+		roleRepo := newFakeRoleRepo(editor)
+		userRoleRepo := newFakeUserRoleRepo()
+		require.NoError(t, userRoleRepo.AddRole("ana", editor.ID.Hex()))
+		uc := NewRoleUseCase(roleRepo, newFakePermissionRepo(), userRoleRepo, domain.RoleDeleteCleanup,
+			WithChangeRecorder(&fakeChangeRecorder{err: errors.New("sin conexión")}))
+
+		err := uc.DeleteRole(nil, editor.ID.Hex())
+		assert.ErrorIs(t, err, domain.ErrAuditFailed)
+		assert.Empty(t, userRoleRepo.userRoles["ana"].Roles)
+		_, err = uc.GetRole(editor.ID.Hex())
+		assert.Error(t, err, "el rol ya se eliminó")
+	})
+}
+
+// countingUserRoleUseCase cuenta las consultas de permisos que llegan al caso de uso extendido
+type countingUserRoleUseCase struct {
+	domain.UserRoleUseCase
+	lookups int
+}
+
+func (u *countingUserRoleUseCase) GetUserPermissions(userID string) ([]string, error) {
+	u.lookups++
+	return u.UserRoleUseCase.GetUserPermissions(userID)
+}
+
+func TestWithPermissionCache(t *testing.T) {
+	setup := func() (domain.UserRoleUseCase, *permissionCacheUseCase, *countingUserRoleUseCase, *fakeUserRoleRepo) {
+		userRoleRepo := newFakeUserRoleRepo()
+		require.NoError(t, userRoleRepo.AddPermission("ana", "users:read"))
+		inner := &countingUserRoleUseCase{
+			UserRoleUseCase: NewUserRoleUseCase(userRoleRepo, newFakeRoleRepo(), newFakePermissionRepo("users:read", "users:write")),
+		}
+		uc := WithPermissionCache(inner, 30*time.Second)
+		return uc, uc.(*permissionCacheUseCase), inner, userRoleRepo
+	}
+
+	t.Run("sin ttl no hay caché", func(t *testing.T) {
+		inner := NewUserRoleUseCase(newFakeUserRoleRepo(), newFakeRoleRepo(), newFakePermissionRepo())
+		assert.Same(t, inner, WithPermissionCache(inner, 0))
+	})
+
+	t.Run("las verificaciones repetidas no consultan el repositorio", func(t *testing.T) {
+		uc, _, inner, _ := setup()
+
+		for i := 0; i < 3; i++ {
+			allowed, err := uc.HasPermission("ana", "users:read")
+			require.NoError(t, err)
+			assert.True(t, allowed)
+		}
+		_, err := uc.GetAdminScope("ana")
+		require.NoError(t, err)
+		assert.Equal(t, 1, inner.lookups)
+	})
+
+	t.Run("las entradas vencen tras el ttl", func(t *testing.T) {
+		uc, cache, inner, userRoleRepo := setup()
+		now := time.Now()
+		cache.now = func() time.Time { return now }
+
+		_, err := uc.GetUserPermissions("ana")
+		require.NoError(t, err)
+
+		// Un cambio hecho por otra vía se ve al vencer la entrada
+		require.NoError(t, userRoleRepo.AddPermission("ana", "users:write"))
+		allowed, err := uc.HasPermission("ana", "users:write")
+		require.NoError(t, err)
+		assert.False(t, allowed)
+
+		now = now.Add(30 * time.Second)
+		allowed, err = uc.HasPermission("ana", "users:write")
+		require.NoError(t, err)
+		assert.True(t, allowed)
+		assert.Equal(t, 2, inner.lookups)
+	})
+
+	t.Run("las modificaciones del usuario descartan su entrada", func(t *testing.T) {
+		uc, _, inner, _ := setup()
+		_, err := uc.GetUserPermissions("luis")
+		require.NoError(t, err)
+
+		require.NoError(t, uc.AssignPermissionToUser(nil, &domain.AssignPermissionRequest{UserID: "ana", PermissionCode: "users:write"}))
+		allowed, err := uc.HasPermission("ana", "users:write")
+		require.NoError(t, err)
+		assert.True(t, allowed)
+
+		require.NoError(t, uc.RemovePermissionFromUser(nil, &domain.AssignPermissionRequest{UserID: "ana", PermissionCode: "users:write"}))
+		allowed, err = uc.HasPermission("ana", "users:write")
+		require.NoError(t, err)
+		assert.False(t, allowed)
+
+		// La entrada de otro usuario no se consulta de nuevo
+		_, err = uc.GetUserPermissions("luis")
+		require.NoError(t, err)
+		assert.Equal(t, 3, inner.lookups)
+	})
+
+	t.Run("InvalidatePermissionCache descarta todas las entradas", func(t *testing.T) {
+		uc, _, inner, userRoleRepo := setup()
+		_, err := uc.GetUserPermissions("ana")
+		require.NoError(t, err)
+
+		// Ej. un permiso eliminado con force desde el caso de uso de permisos
+		require.NoError(t, userRoleRepo.RemovePermission("ana", "users:read"))
+		uc.(domain.PermissionCacheInvalidator).InvalidatePermissionCache()
+		allowed, err := uc.HasPermission("ana", "users:read")
+		require.NoError(t, err)
+		assert.False(t, allowed)
+		assert.Equal(t, 2, inner.lookups)
+	})
+
+	t.Run("los errores no se guardan", func(t *testing.T) {
+		uc, _, inner, userRoleRepo := setup()
+		userRoleRepo.err = errors.New("conexión perdida")
+
+		_, err := uc.HasPermission("ana", "users:read")
+		assert.ErrorIs(t, err, userRoleRepo.err)
+
+		userRoleRepo.err = nil
+		allowed, err := uc.HasPermission("ana", "users:read")
+		require.NoError(t, err)
+		assert.True(t, allowed)
+		assert.Equal(t, 2, inner.lookups)
+	})
+}
@@ -2,21 +2,43 @@ package usecase
 
 import (
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/black4ninja/mi-proyecto/internal/permission/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
 )
 
 type roleUseCase struct {
 	roleRepo       domain.RoleRepository
 	permissionRepo domain.PermissionRepository
+	userRoleRepo   domain.UserRoleRepository
+	deletePolicy   domain.RoleDeletePolicy
+	recorder       domain.PermissionChangeRecorder
+	cache          domain.PermissionCacheInvalidator
+	deleter        domain.RoleDeleter
 }
 
-// NewRoleUseCase crea un nuevo caso de uso para roles
-func NewRoleUseCase(roleRepo domain.RoleRepository, permissionRepo domain.PermissionRepository) domain.RoleUseCase {
+// NewRoleUseCase crea un nuevo caso de uso para roles. deletePolicy define qué ocurre con
+// las asignaciones de usuario al eliminar un rol.
+func NewRoleUseCase(
+	roleRepo domain.RoleRepository,
+	permissionRepo domain.PermissionRepository,
+	userRoleRepo domain.UserRoleRepository,
+	deletePolicy domain.RoleDeletePolicy,
+	opts ...Option,
+) domain.RoleUseCase {
+	o := newOptions(opts)
 	return &roleUseCase{
 		roleRepo:       roleRepo,
 		permissionRepo: permissionRepo,
+		userRoleRepo:   userRoleRepo,
+		deletePolicy:   deletePolicy,
+		recorder:       o.recorder,
+		cache:          o.cache,
+		deleter:        o.deleter,
 	}
 }
 
@@ -24,88 +46,96 @@ func NewRoleUseCase(roleRepo domain.RoleRepository, permissionRepo domain.Permis
 func (u *roleUseCase) GetRole(id string) (*domain.RoleResponse, error) {
 	role, err := u.roleRepo.GetByID(id)
 	if err != nil {
-		return nil, err
-	}
-
-	// Obtener los permisos asociados
-	permissions, err := u.permissionRepo.GetByCodesArray(role.Permissions)
-	if err != nil {
-		return nil, err
-	}
-
-	// Convertir permisos al formato de respuesta
-	var permissionsResponse []*domain.PermissionResponse
-	for _, p := range permissions {
-		permissionsResponse = append(permissionsResponse, &domain.PermissionResponse{
-			ID:          p.ID.Hex(),
-			Code:        p.Code,
-			Module:      p.Module,
-			Action:      p.Action,
-			Name:        p.Name,
-			Description: p.Description,
-			CreatedAt:   p.CreatedAt,
-			UpdatedAt:   p.UpdatedAt,
-		})
+		return nil, fmt.Errorf("obtener rol %s: %w", id, err)
 	}
 
-	return &domain.RoleResponse{
-		ID:          role.ID.Hex(),
-		Name:        role.Name,
-		Description: role.Description,
-		Permissions: permissionsResponse,
-		IsSystem:    role.IsSystem,
-		CreatedAt:   role.CreatedAt,
-		UpdatedAt:   role.UpdatedAt,
-	}, nil
+	return u.roleDetailResponse(role)
 }
 
 // GetRoleByName obtiene un rol por su nombre
 func (u *roleUseCase) GetRoleByName(name string) (*domain.RoleResponse, error) {
 	role, err := u.roleRepo.GetByName(name)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("obtener rol %s: %w", name, err)
 	}
 
-	// Obtener los permisos asociados
-	permissions, err := u.permissionRepo.GetByCodesArray(role.Permissions)
+	return u.roleDetailResponse(role)
+}
+
+// roleDetailResponse convierte un rol al formato de respuesta, separando sus permisos directos
+// de los que hereda de sus roles padre
+func (u *roleUseCase) roleDetailResponse(role *domain.Role) (*domain.RoleResponse, error) {
+	roles, err := domain.WithAncestorRoles([]*domain.Role{role}, u.roleRepo.GetByIDs)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("obtener roles heredados de %s: %w", role.Name, err)
 	}
 
-	// Convertir permisos al formato de respuesta
-	var permissionsResponse []*domain.PermissionResponse
+	// Una sola consulta para los permisos directos y los heredados
+	permissions, err := u.permissionRepo.GetByCodesArray(domain.RolePermissionCodes(roles))
+	if err != nil {
+		return nil, fmt.Errorf("obtener permisos del rol %s: %w", role.Name, err)
+	}
+	permissionsByCode := make(map[string]*domain.Permission, len(permissions))
 	for _, p := range permissions {
-		permissionsResponse = append(permissionsResponse, &domain.PermissionResponse{
-			ID:          p.ID.Hex(),
-			Code:        p.Code,
-			Module:      p.Module,
-			Action:      p.Action,
-			Name:        p.Name,
-			Description: p.Description,
-			CreatedAt:   p.CreatedAt,
-			UpdatedAt:   p.UpdatedAt,
-		})
+		permissionsByCode[p.Code] = p
+	}
+
+	// Cada permiso heredado se atribuye al rol más cercano que lo define
+	var inherited []*domain.InheritedPermissionResponse
+	seen := make(map[string]bool, len(role.Permissions))
+	for _, code := range role.Permissions {
+		seen[code] = true
+	}
+	for _, ancestor := range roles[1:] {
+		for _, response := range permissionResponses(ancestor.Permissions, permissionsByCode) {
+			if seen[response.Code] {
+				continue
+			}
+			seen[response.Code] = true
+			inherited = append(inherited, &domain.InheritedPermissionResponse{
+				PermissionResponse: response,
+				InheritedFrom:      ancestor.ID.Hex(),
+			})
+		}
 	}
 
 	return &domain.RoleResponse{
-		ID:          role.ID.Hex(),
-		Name:        role.Name,
-		Description: role.Description,
-		Permissions: permissionsResponse,
-		IsSystem:    role.IsSystem,
-		CreatedAt:   role.CreatedAt,
-		UpdatedAt:   role.UpdatedAt,
+		ID:                   role.ID.Hex(),
+		Name:                 role.Name,
+		Description:          role.Description,
+		Permissions:          permissionResponses(role.Permissions, permissionsByCode),
+		ParentRoles:          role.ParentRoles,
+		InheritedPermissions: inherited,
+		IsSystem:             role.IsSystem,
+		Version:              role.Version,
+		CreatedAt:            utils.NewTimestamp(role.CreatedAt),
+		UpdatedAt:            utils.NewTimestamp(role.UpdatedAt),
 	}, nil
 }
 
-// GetAllRoles obtiene todos los roles
-func (u *roleUseCase) GetAllRoles() ([]*domain.RoleResponse, error) {
-	roles, err := u.roleRepo.GetAll()
+// GetAllRoles obtiene los roles que coincidan con los parámetros (vacío = todos)
+func (u *roleUseCase) GetAllRoles(params map[string]interface{}) ([]*domain.RoleResponse, error) {
+	roles, err := u.roleRepo.GetAll(params)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("listar roles: %w", err)
 	}
 
-	var response []*domain.RoleResponse
+	return u.roleListResponse(roles), nil
+}
+
+// GetRolesPage obtiene una página de roles y el total de coincidencias
+func (u *roleUseCase) GetRolesPage(params map[string]interface{}, skip, limit int64) ([]*domain.RoleResponse, int64, error) {
+	roles, total, err := u.roleRepo.GetPage(params, skip, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("listar roles: %w", err)
+	}
+
+	return u.roleListResponse(roles), total, nil
+}
+
+// roleListResponse convierte una lista de roles al formato de respuesta con sus permisos
+func (u *roleUseCase) roleListResponse(roles []*domain.Role) []*domain.RoleResponse {
+	response := make([]*domain.RoleResponse, 0, len(roles))
 
 	// Para cada rol, obtener sus permisos
 	for _, role := range roles {
@@ -115,57 +145,59 @@ func (u *roleUseCase) GetAllRoles() ([]*domain.RoleResponse, error) {
 			continue // Ignorar errores y seguir con el siguiente rol
 		}
 
-		// Convertir permisos al formato de respuesta
-		var permissionsResponse []*domain.PermissionResponse
-		for _, p := range permissions {
-			permissionsResponse = append(permissionsResponse, &domain.PermissionResponse{
-				ID:          p.ID.Hex(),
-				Code:        p.Code,
-				Module:      p.Module,
-				Action:      p.Action,
-				Name:        p.Name,
-				Description: p.Description,
-				CreatedAt:   p.CreatedAt,
-				UpdatedAt:   p.UpdatedAt,
-			})
-		}
-
 		response = append(response, &domain.RoleResponse{
 			ID:          role.ID.Hex(),
 			Name:        role.Name,
 			Description: role.Description,
-			Permissions: permissionsResponse,
+			Permissions: permissionListResponse(permissions),
+			ParentRoles: role.ParentRoles,
 			IsSystem:    role.IsSystem,
-			CreatedAt:   role.CreatedAt,
-			UpdatedAt:   role.UpdatedAt,
+			Version:     role.Version,
+			CreatedAt:   utils.NewTimestamp(role.CreatedAt),
+			UpdatedAt:   utils.NewTimestamp(role.UpdatedAt),
 		})
 	}
 
-	return response, nil
+	return response
 }
 
 // CreateRole crea un nuevo rol
-func (u *roleUseCase) CreateRole(req *domain.CreateRoleRequest) (*domain.RoleResponse, error) {
+func (u *roleUseCase) CreateRole(scope *domain.AdminScope, req *domain.CreateRoleRequest) (*domain.RoleResponse, error) {
+	// Un administrador delegado solo crea roles con permisos de sus módulos
+	if err := scope.Check(req.Permissions...); err != nil {
+		return nil, err
+	}
+
 	// Verificar que no exista un rol con el mismo nombre
 	existingRole, err := u.roleRepo.GetByName(req.Name)
 	if err == nil && existingRole != nil {
-		return nil, errors.New("ya existe un rol con este nombre")
+		return nil, domain.ErrRoleNameExists
 	}
 
 	// Verificar que los permisos existan
 	for _, pCode := range req.Permissions {
 		_, err := u.permissionRepo.GetByCode(pCode)
+		if errors.Is(err, domain.ErrPermissionNotFound) {
+			return nil, fmt.Errorf("%w: %s: %w", domain.ErrInvalidPermission, pCode, err)
+		}
 		if err != nil {
-			return nil, errors.New("permiso no válido: " + pCode)
+			return nil, fmt.Errorf("obtener permiso %s: %w", pCode, err)
 		}
 	}
 
+	// Un rol nuevo no tiene roles hijos, por lo que sus padres no pueden formar un ciclo
+	parentRoles, err := u.validateParentRoles(scope, "", req.ParentRoles)
+	if err != nil {
+		return nil, err
+	}
+
 	// Crear rol
 	now := time.Now()
 	role := &domain.Role{
 		Name:        req.Name,
 		Description: req.Description,
 		Permissions: req.Permissions,
+		ParentRoles: parentRoles,
 		IsSystem:    false, // No es un rol de sistema
 		CreatedAt:   now,
 		UpdatedAt:   now,
@@ -173,7 +205,7 @@ func (u *roleUseCase) CreateRole(req *domain.CreateRoleRequest) (*domain.RoleRes
 
 	err = u.roleRepo.Create(role)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("crear rol %s: %w", req.Name, err)
 	}
 
 	// Obtener los permisos para la respuesta
@@ -185,14 +217,16 @@ func (u *roleUseCase) CreateRole(req *domain.CreateRoleRequest) (*domain.RoleRes
 			Name:        role.Name,
 			Description: role.Description,
 			Permissions: []*domain.PermissionResponse{},
+			ParentRoles: role.ParentRoles,
 			IsSystem:    role.IsSystem,
-			CreatedAt:   role.CreatedAt,
-			UpdatedAt:   role.UpdatedAt,
+			Version:     role.Version,
+			CreatedAt:   utils.NewTimestamp(role.CreatedAt),
+			UpdatedAt:   utils.NewTimestamp(role.UpdatedAt),
 		}, nil
 	}
 
 	// Convertir permisos al formato de respuesta
-	var permissionsResponse []*domain.PermissionResponse
+	permissionsResponse := make([]*domain.PermissionResponse, 0, len(permissions))
 	for _, p := range permissions {
 		permissionsResponse = append(permissionsResponse, &domain.PermissionResponse{
 			ID:          p.ID.Hex(),
@@ -201,8 +235,8 @@ func (u *roleUseCase) CreateRole(req *domain.CreateRoleRequest) (*domain.RoleRes
 			Action:      p.Action,
 			Name:        p.Name,
 			Description: p.Description,
-			CreatedAt:   p.CreatedAt,
-			UpdatedAt:   p.UpdatedAt,
+			CreatedAt:   utils.NewTimestamp(p.CreatedAt),
+			UpdatedAt:   utils.NewTimestamp(p.UpdatedAt),
 		})
 	}
 
@@ -211,23 +245,35 @@ func (u *roleUseCase) CreateRole(req *domain.CreateRoleRequest) (*domain.RoleRes
 		Name:        role.Name,
 		Description: role.Description,
 		Permissions: permissionsResponse,
+		ParentRoles: role.ParentRoles,
 		IsSystem:    role.IsSystem,
-		CreatedAt:   role.CreatedAt,
-		UpdatedAt:   role.UpdatedAt,
+		Version:     role.Version,
+		CreatedAt:   utils.NewTimestamp(role.CreatedAt),
+		UpdatedAt:   utils.NewTimestamp(role.UpdatedAt),
 	}, nil
 }
 
 // UpdateRole actualiza un rol existente
-func (u *roleUseCase) UpdateRole(id string, req *domain.UpdateRoleRequest) (*domain.RoleResponse, error) {
+func (u *roleUseCase) UpdateRole(scope *domain.AdminScope, id string, req *domain.UpdateRoleRequest) (*domain.RoleResponse, error) {
 	// Obtener rol existente
 	role, err := u.roleRepo.GetByID(id)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("obtener rol %s: %w", id, err)
 	}
 
 	// Verificar que no sea un rol de sistema
 	if role.IsSystem {
-		return nil, errors.New("no se puede modificar un rol de sistema")
+		return nil, domain.ErrSystemRoleImmutable
+	}
+
+	if err := checkInheritedScope(u.roleRepo, scope, role); err != nil {
+		return nil, err
+	}
+
+	// Rechazar la edición si el rol cambió desde que el cliente lo leyó
+	precondition := utils.Precondition{ExpectedVersion: req.ExpectedVersion, UnmodifiedSince: req.UnmodifiedSince}
+	if err := precondition.Check(role.Version, role.UpdatedAt); err != nil {
+		return nil, err
 	}
 
 	// Actualizar campos
@@ -235,7 +281,7 @@ func (u *roleUseCase) UpdateRole(id string, req *domain.UpdateRoleRequest) (*dom
 		// Verificar que no exista otro rol con el nuevo nombre
 		existingRole, err := u.roleRepo.GetByName(req.Name)
 		if err == nil && existingRole != nil && existingRole.ID.Hex() != id {
-			return nil, errors.New("ya existe un rol con este nombre")
+			return nil, domain.ErrRoleNameExists
 		}
 
 		role.Name = req.Name
@@ -245,12 +291,29 @@ func (u *roleUseCase) UpdateRole(id string, req *domain.UpdateRoleRequest) (*dom
 		role.Description = req.Description
 	}
 
+	parentsChanged := false
+	if req.ParentRoles != nil {
+		parentRoles, err := u.validateParentRoles(scope, id, req.ParentRoles)
+		if err != nil {
+			return nil, err
+		}
+		parentsChanged = !sameRoleIDs(role.ParentRoles, parentRoles)
+		role.ParentRoles = parentRoles
+	}
+
 	role.UpdatedAt = time.Now()
 
 	// Guardar cambios
 	err = u.roleRepo.Update(role)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("actualizar rol %s: %w", id, err)
+	}
+
+	// Cambiar la herencia cambia los permisos de los usuarios del rol y de sus descendientes
+	if parentsChanged {
+		if err := u.invalidateEffectivePermissions(id); err != nil {
+			return nil, err
+		}
 	}
 
 	// Obtener los permisos para la respuesta
@@ -262,14 +325,16 @@ func (u *roleUseCase) UpdateRole(id string, req *domain.UpdateRoleRequest) (*dom
 			Name:        role.Name,
 			Description: role.Description,
 			Permissions: []*domain.PermissionResponse{},
+			ParentRoles: role.ParentRoles,
 			IsSystem:    role.IsSystem,
-			CreatedAt:   role.CreatedAt,
-			UpdatedAt:   role.UpdatedAt,
+			Version:     role.Version,
+			CreatedAt:   utils.NewTimestamp(role.CreatedAt),
+			UpdatedAt:   utils.NewTimestamp(role.UpdatedAt),
 		}, nil
 	}
 
 	// Convertir permisos al formato de respuesta
-	var permissionsResponse []*domain.PermissionResponse
+	permissionsResponse := make([]*domain.PermissionResponse, 0, len(permissions))
 	for _, p := range permissions {
 		permissionsResponse = append(permissionsResponse, &domain.PermissionResponse{
 			ID:          p.ID.Hex(),
@@ -278,8 +343,8 @@ func (u *roleUseCase) UpdateRole(id string, req *domain.UpdateRoleRequest) (*dom
 			Action:      p.Action,
 			Name:        p.Name,
 			Description: p.Description,
-			CreatedAt:   p.CreatedAt,
-			UpdatedAt:   p.UpdatedAt,
+			CreatedAt:   utils.NewTimestamp(p.CreatedAt),
+			UpdatedAt:   utils.NewTimestamp(p.UpdatedAt),
 		})
 	}
 
@@ -288,29 +353,399 @@ func (u *roleUseCase) UpdateRole(id string, req *domain.UpdateRoleRequest) (*dom
 		Name:        role.Name,
 		Description: role.Description,
 		Permissions: permissionsResponse,
+		ParentRoles: role.ParentRoles,
 		IsSystem:    role.IsSystem,
-		CreatedAt:   role.CreatedAt,
-		UpdatedAt:   role.UpdatedAt,
+		Version:     role.Version,
+		CreatedAt:   utils.NewTimestamp(role.CreatedAt),
+		UpdatedAt:   utils.NewTimestamp(role.UpdatedAt),
 	}, nil
 }
 
-// DeleteRole elimina un rol
-func (u *roleUseCase) DeleteRole(id string) error {
-	return u.roleRepo.Delete(id)
+// DeleteRole elimina un rol. Según la política configurada, se rechaza si está asignado
+// o se quita de todas las asignaciones para no dejar referencias colgantes.
+func (u *roleUseCase) DeleteRole(scope *domain.AdminScope, id string) error {
+	if err := checkRoleScope(u.roleRepo, scope, id); err != nil {
+		return err
+	}
+
+	if u.deletePolicy == domain.RoleDeleteBlock && u.deleter != nil {
+		if err := u.deleter.DeleteUnassigned(id); err != nil {
+			return err
+		}
+		// Los roles que heredaban de él pierden sus permisos
+		return u.invalidateEffectivePermissions(id)
+	}
+	if u.deletePolicy == domain.RoleDeleteBlock {
+		assigned, err := u.userRoleRepo.CountByRole(id)
+		if err != nil {
+			return fmt.Errorf("contar asignaciones del rol %s: %w", id, err)
+		}
+		if assigned > 0 {
+			return fmt.Errorf("%w: %d asignaciones", domain.ErrRoleInUse, assigned)
+		}
+		if err := u.roleRepo.Delete(id); err != nil {
+			return err
+		}
+		// Los roles que heredaban de él pierden sus permisos
+		return u.invalidateEffectivePermissions(id)
+	}
+
+	// Eliminar primero el rol: si falla (ej. rol de sistema) las asignaciones no se tocan
+	if err := u.roleRepo.Delete(id); err != nil {
+		return err
+	}
+
+	removed, err := u.userRoleRepo.RemoveRoleFromAll(id)
+	if err != nil {
+		return fmt.Errorf("quitar el rol %s de las asignaciones: %w", id, err)
+	}
+	if err := u.invalidateEffectivePermissions(id); err != nil {
+		return err
+	}
+	if removed == 0 {
+		return nil
+	}
+	return recordSystemChange(u.recorder, domain.ChangeRoleUnassignAll, "role:"+id, fmt.Sprintf("users_updated=%d", removed))
 }
 
 // AddPermissionToRole añade un permiso a un rol
-func (u *roleUseCase) AddPermissionToRole(roleID string, permissionCode string) error {
+func (u *roleUseCase) AddPermissionToRole(scope *domain.AdminScope, roleID string, permissionCode string) error {
+	if err := scope.Check(permissionCode); err != nil {
+		return err
+	}
+	if err := checkRoleScope(u.roleRepo, scope, roleID); err != nil {
+		return err
+	}
+
 	// Verificar que el permiso exista
 	_, err := u.permissionRepo.GetByCode(permissionCode)
+	if errors.Is(err, domain.ErrPermissionNotFound) {
+		return fmt.Errorf("%w: %s: %w", domain.ErrInvalidPermission, permissionCode, err)
+	}
 	if err != nil {
-		return errors.New("permiso no válido: " + permissionCode)
+		return fmt.Errorf("obtener permiso %s: %w", permissionCode, err)
+	}
+
+	if err := u.roleRepo.AddPermission(roleID, permissionCode); err != nil {
+		return err
 	}
 
-	return u.roleRepo.AddPermission(roleID, permissionCode)
+	return u.invalidateEffectivePermissions(roleID)
 }
 
 // RemovePermissionFromRole elimina un permiso de un rol
-func (u *roleUseCase) RemovePermissionFromRole(roleID string, permissionCode string) error {
-	return u.roleRepo.RemovePermission(roleID, permissionCode)
+func (u *roleUseCase) RemovePermissionFromRole(scope *domain.AdminScope, roleID string, permissionCode string) error {
+	if err := scope.Check(permissionCode); err != nil {
+		return err
+	}
+	if err := checkRoleScope(u.roleRepo, scope, roleID); err != nil {
+		return err
+	}
+
+	if err := u.roleRepo.RemovePermission(roleID, permissionCode); err != nil {
+		return err
+	}
+
+	return u.invalidateEffectivePermissions(roleID)
+}
+
+// UpdateRolePermissions añade y quita permisos de un rol en una sola operación y devuelve
+// el rol con el conjunto de permisos resultante
+func (u *roleUseCase) UpdateRolePermissions(scope *domain.AdminScope, roleID string, req *domain.UpdateRolePermissionsRequest) (*domain.RoleResponse, error) {
+	// Un mismo código no puede aparecer en ambas listas
+	for _, pCode := range req.Add {
+		for _, removed := range req.Remove {
+			if pCode == removed {
+				return nil, fmt.Errorf("%w: %s", domain.ErrConflictingDelta, pCode)
+			}
+		}
+	}
+
+	return u.applyPermissionDelta(scope, roleID, req.Add, req.Remove)
+}
+
+// AddRolePermissions añade varios permisos a un rol en una sola operación y devuelve el rol
+// resultante. Se verifica antes que existan todos los códigos y, si falta alguno, se rechaza
+// indicándolos sin modificar el rol. Los permisos que el rol ya tiene se ignoran.
+func (u *roleUseCase) AddRolePermissions(scope *domain.AdminScope, roleID string, codes []string) (*domain.RoleResponse, error) {
+	return u.applyPermissionDelta(scope, roleID, codes, nil)
+}
+
+// RemoveRolePermissions quita varios permisos de un rol en una sola operación y devuelve el rol
+// resultante. No se exige que los códigos existan, para poder quitar permisos ya eliminados; los
+// que el rol no tiene se ignoran.
+func (u *roleUseCase) RemoveRolePermissions(scope *domain.AdminScope, roleID string, codes []string) (*domain.RoleResponse, error) {
+	return u.applyPermissionDelta(scope, roleID, nil, codes)
+}
+
+// applyPermissionDelta añade add y quita remove de los permisos del rol en una sola escritura,
+// tras verificar el rol, el ámbito del administrador y que existan todos los códigos de add
+func (u *roleUseCase) applyPermissionDelta(scope *domain.AdminScope, roleID string, add, remove []string) (*domain.RoleResponse, error) {
+	role, err := u.roleRepo.GetByID(roleID)
+	if err != nil {
+		return nil, fmt.Errorf("obtener rol %s: %w", roleID, err)
+	}
+
+	// Verificar que no sea un rol de sistema
+	if role.IsSystem {
+		return nil, domain.ErrSystemRoleImmutable
+	}
+
+	// El rol y los permisos de la operación deben pertenecer al ámbito del administrador
+	if err := checkInheritedScope(u.roleRepo, scope, role); err != nil {
+		return nil, err
+	}
+	for _, codes := range [][]string{add, remove} {
+		if err := scope.Check(codes...); err != nil {
+			return nil, err
+		}
+	}
+
+	// Verificar que los permisos a añadir existan
+	if err := u.checkPermissionCodesExist(add); err != nil {
+		return nil, err
+	}
+
+	role, err = u.roleRepo.ApplyPermissionDelta(roleID, add, remove)
+	if err != nil {
+		return nil, fmt.Errorf("actualizar permisos del rol %s: %w", roleID, err)
+	}
+	if err := u.invalidateEffectivePermissions(roleID); err != nil {
+		return nil, err
+	}
+
+	return u.roleWithPermissions(role)
+}
+
+// checkPermissionCodesExist verifica en una sola consulta que existan todos los códigos; si falta
+// alguno retorna domain.ErrInvalidPermission indicándolos
+func (u *roleUseCase) checkPermissionCodesExist(codes []string) error {
+	if len(codes) == 0 {
+		return nil
+	}
+	existing, err := u.permissionRepo.GetExistingCodes(codes)
+	if err != nil {
+		return fmt.Errorf("consultar códigos existentes: %w", err)
+	}
+	var missing []string
+	for _, code := range codes {
+		if !slices.Contains(existing, code) && !slices.Contains(missing, code) {
+			missing = append(missing, code)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", domain.ErrInvalidPermission, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// SetRolePermissions reemplaza el conjunto completo de permisos de un rol (ej. al sembrar un
+// rol nuevo) y devuelve el rol resultante. Se verifica antes que existan todos los códigos y,
+// si falta alguno, se rechaza indicándolos sin modificar el rol. Los códigos repetidos se
+// guardan una sola vez.
+func (u *roleUseCase) SetRolePermissions(scope *domain.AdminScope, roleID string, codes []string) (*domain.RoleResponse, error) {
+	unique := make([]string, 0, len(codes))
+	for _, code := range codes {
+		if !slices.Contains(unique, code) {
+			unique = append(unique, code)
+		}
+	}
+
+	role, err := u.roleRepo.GetByID(roleID)
+	if err != nil {
+		return nil, fmt.Errorf("obtener rol %s: %w", roleID, err)
+	}
+	if role.IsSystem {
+		return nil, domain.ErrSystemRoleImmutable
+	}
+
+	// Tanto los permisos actuales del rol como los nuevos deben pertenecer al ámbito
+	if err := checkInheritedScope(u.roleRepo, scope, role); err != nil {
+		return nil, err
+	}
+	if err := scope.Check(unique...); err != nil {
+		return nil, err
+	}
+
+	if err := u.checkPermissionCodesExist(unique); err != nil {
+		return nil, err
+	}
+
+	role, err = u.roleRepo.ReplacePermissions(roleID, unique)
+	if err != nil {
+		return nil, fmt.Errorf("reemplazar permisos del rol %s: %w", roleID, err)
+	}
+	if err := u.invalidateEffectivePermissions(roleID); err != nil {
+		return nil, err
+	}
+
+	return u.roleWithPermissions(role)
+}
+
+// roleWithPermissions convierte el rol al formato de respuesta con el detalle de sus permisos directos
+func (u *roleUseCase) roleWithPermissions(role *domain.Role) (*domain.RoleResponse, error) {
+	// Obtener los permisos para la respuesta
+	permissions, err := u.permissionRepo.GetByCodesArray(role.Permissions)
+	if err != nil {
+		return nil, fmt.Errorf("obtener permisos del rol %s: %w", role.Name, err)
+	}
+
+	// Convertir permisos al formato de respuesta
+	permissionsResponse := make([]*domain.PermissionResponse, 0, len(permissions))
+	for _, p := range permissions {
+		permissionsResponse = append(permissionsResponse, &domain.PermissionResponse{
+			ID:          p.ID.Hex(),
+			Code:        p.Code,
+			Module:      p.Module,
+			Action:      p.Action,
+			Name:        p.Name,
+			Description: p.Description,
+			CreatedAt:   utils.NewTimestamp(p.CreatedAt),
+			UpdatedAt:   utils.NewTimestamp(p.UpdatedAt),
+		})
+	}
+
+	return &domain.RoleResponse{
+		ID:          role.ID.Hex(),
+		Name:        role.Name,
+		Description: role.Description,
+		Permissions: permissionsResponse,
+		ParentRoles: role.ParentRoles,
+		IsSystem:    role.IsSystem,
+		Version:     role.Version,
+		CreatedAt:   utils.NewTimestamp(role.CreatedAt),
+		UpdatedAt:   utils.NewTimestamp(role.UpdatedAt),
+	}, nil
+}
+
+// checkRoleScope verifica que el rol esté compuesto únicamente por permisos del ámbito,
+// incluidos los heredados. Sin ámbito no consulta el rol.
+func checkRoleScope(roleRepo domain.RoleRepository, scope *domain.AdminScope, roleID string) error {
+	if scope == nil {
+		return nil
+	}
+
+	role, err := roleRepo.GetByID(roleID)
+	if err != nil {
+		return fmt.Errorf("obtener rol %s: %w", roleID, err)
+	}
+	return checkInheritedScope(roleRepo, scope, role)
+}
+
+// checkInheritedScope verifica que los permisos del rol, incluidos los heredados, pertenezcan
+// al ámbito. Sin ámbito no consulta los roles padre.
+func checkInheritedScope(roleRepo domain.RoleRepository, scope *domain.AdminScope, role *domain.Role) error {
+	if scope == nil {
+		return nil
+	}
+
+	permissions, err := inheritedRolePermissions(roleRepo, role)
+	if err != nil {
+		return err
+	}
+	return scope.Check(permissions...)
+}
+
+// inheritedRolePermissions retorna los permisos del rol junto con los que hereda de sus roles
+// padre, sin duplicados
+func inheritedRolePermissions(roleRepo domain.RoleRepository, role *domain.Role) ([]string, error) {
+	if len(role.ParentRoles) == 0 {
+		return role.Permissions, nil
+	}
+
+	roles, err := domain.WithAncestorRoles([]*domain.Role{role}, roleRepo.GetByIDs)
+	if err != nil {
+		return nil, fmt.Errorf("obtener roles heredados de %s: %w", role.Name, err)
+	}
+	return domain.RolePermissionCodes(roles), nil
+}
+
+// validateParentRoles verifica los roles padre de roleID ("" si el rol aún no existe) y los
+// retorna sin duplicados: deben existir, no pueden incluir al propio rol ni heredar de él (un
+// ciclo como A→B→A) y, con ámbito, sus permisos deben pertenecer al ámbito del administrador.
+func (u *roleUseCase) validateParentRoles(scope *domain.AdminScope, roleID string, parentIDs []string) ([]string, error) {
+	unique := make([]string, 0, len(parentIDs))
+	seen := make(map[string]bool)
+	for _, parentID := range parentIDs {
+		if parentID == roleID {
+			return nil, fmt.Errorf("%w: el rol no puede heredar de sí mismo", domain.ErrRoleInheritanceCycle)
+		}
+		if !seen[parentID] {
+			seen[parentID] = true
+			unique = append(unique, parentID)
+		}
+	}
+	if len(unique) == 0 {
+		return nil, nil
+	}
+
+	parents, err := u.roleRepo.GetByIDs(unique)
+	if err != nil {
+		return nil, fmt.Errorf("obtener roles padre: %w", err)
+	}
+	if len(parents) != len(unique) {
+		for _, parentID := range unique {
+			found := false
+			for _, parent := range parents {
+				found = found || parent.ID.Hex() == parentID
+			}
+			if !found {
+				return nil, fmt.Errorf("%w: rol padre %s no encontrado", domain.ErrInvalidRole, parentID)
+			}
+		}
+	}
+
+	ancestors, err := domain.WithAncestorRoles(parents, u.roleRepo.GetByIDs)
+	if err != nil {
+		return nil, fmt.Errorf("obtener roles heredados: %w", err)
+	}
+	for _, ancestor := range ancestors {
+		if ancestor.ID.Hex() == roleID {
+			return nil, fmt.Errorf("%w: %s ya hereda de este rol", domain.ErrRoleInheritanceCycle, ancestor.Name)
+		}
+	}
+
+	// Heredar un rol otorga sus permisos: un administrador delegado solo hereda roles de su ámbito
+	if err := scope.Check(domain.RolePermissionCodes(ancestors)...); err != nil {
+		return nil, err
+	}
+
+	return unique, nil
+}
+
+// sameRoleIDs indica si ambas listas contienen los mismos roles, sin importar el orden
+func sameRoleIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	ids := make(map[string]bool, len(a))
+	for _, id := range a {
+		ids[id] = true
+	}
+	for _, id := range b {
+		if !ids[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// invalidateEffectivePermissions descarta los permisos materializados de los usuarios con el
+// rol o con un rol que herede de él tras cambiar sus permisos, y vacía la caché de permisos.
+// Si falla, el rol ya cambió: el error indica que hay que reconstruir los permisos
+// materializados para no seguir usando el conjunto anterior.
+func (u *roleUseCase) invalidateEffectivePermissions(roleID string) error {
+	// La caché se vacía también si la invalidación falla
+	defer invalidateCache(u.cache)
+
+	roles, err := u.roleRepo.GetAll(nil)
+	if err != nil {
+		return fmt.Errorf("invalidar permisos efectivos de los usuarios del rol %s: %w", roleID, err)
+	}
+
+	roleIDs := append([]string{roleID}, domain.RoleDescendants(roles, roleID)...)
+	if _, err := u.userRoleRepo.InvalidateEffectivePermissions(roleIDs...); err != nil {
+		return fmt.Errorf("invalidar permisos efectivos de los usuarios del rol %s: %w", roleID, err)
+	}
+	return nil
 }
@@ -2,14 +2,21 @@ package usecase
 
 import (
 	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/black4ninja/mi-proyecto/internal/permission/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
 )
 
 type userRoleUseCase struct {
 	userRoleRepo   domain.UserRoleRepository
 	roleRepo       domain.RoleRepository
 	permissionRepo domain.PermissionRepository
+	recorder       domain.PermissionChangeRecorder
 }
 
 // NewUserRoleUseCase crea un nuevo caso de uso para asignaciones usuario-rol
@@ -17,140 +24,225 @@ func NewUserRoleUseCase(
 	userRoleRepo domain.UserRoleRepository,
 	roleRepo domain.RoleRepository,
 	permissionRepo domain.PermissionRepository,
+	opts ...Option,
 ) domain.UserRoleUseCase {
+	o := newOptions(opts)
 	return &userRoleUseCase{
 		userRoleRepo:   userRoleRepo,
 		roleRepo:       roleRepo,
 		permissionRepo: permissionRepo,
+		recorder:       o.recorder,
 	}
 }
 
-// GetUserRoles obtiene los roles y permisos asignados a un usuario
+// GetUserRoles obtiene los roles vigentes y permisos asignados a un usuario. Los roles con
+// vencimiento incluyen la fecha y los segundos de vigencia restantes.
 func (u *userRoleUseCase) GetUserRoles(userID string) (*domain.UserRoleResponse, error) {
 	// Obtener asignación de usuario
 	userRole, err := u.userRoleRepo.GetByUserID(userID)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("obtener roles del usuario %s: %w", userID, err)
 	}
 
-	// Obtener roles
-	var roles []*domain.RoleResponse
-	for _, roleID := range userRole.Roles {
-		role, err := u.roleRepo.GetByID(roleID)
-		if err != nil {
-			continue // Ignorar roles que no existan
-		}
-
-		// Obtener permisos del rol
-		permissions, err := u.permissionRepo.GetByCodesArray(role.Permissions)
-		if err != nil {
-			// Si hay error, añadir el rol sin permisos
-			roles = append(roles, &domain.RoleResponse{
-				ID:          role.ID.Hex(),
-				Name:        role.Name,
-				Description: role.Description,
-				Permissions: []*domain.PermissionResponse{},
-				IsSystem:    role.IsSystem,
-				CreatedAt:   role.CreatedAt,
-				UpdatedAt:   role.UpdatedAt,
-			})
-			continue
-		}
+	// Obtener roles en una sola consulta (los que no existan o hayan vencido se ignoran)
+	now := time.Now()
+	assigned, err := u.roleRepo.GetByIDs(userRole.ActiveRoles(now))
+	if err != nil {
+		return nil, fmt.Errorf("obtener roles del usuario %s: %w", userID, err)
+	}
 
-		// Convertir permisos al formato de respuesta
-		var permissionsResponse []*domain.PermissionResponse
+	// Obtener en una sola consulta los permisos de todos los roles y los específicos del usuario
+	codes := append([]string{}, userRole.Permissions...)
+	for _, role := range assigned {
+		codes = append(codes, role.Permissions...)
+	}
+	permissionsByCode := make(map[string]*domain.Permission)
+	permissions, err := u.permissionRepo.GetByCodesArray(codes)
+	if err == nil {
 		for _, p := range permissions {
-			permissionsResponse = append(permissionsResponse, &domain.PermissionResponse{
-				ID:          p.ID.Hex(),
-				Code:        p.Code,
-				Module:      p.Module,
-				Action:      p.Action,
-				Name:        p.Name,
-				Description: p.Description,
-				CreatedAt:   p.CreatedAt,
-				UpdatedAt:   p.UpdatedAt,
-			})
+			permissionsByCode[p.Code] = p
 		}
+	}
+	// Si hay error, los roles y el usuario se devuelven sin permisos
 
-		roles = append(roles, &domain.RoleResponse{
+	roles := make([]*domain.RoleResponse, 0, len(assigned))
+	for _, role := range assigned {
+		response := &domain.RoleResponse{
 			ID:          role.ID.Hex(),
 			Name:        role.Name,
 			Description: role.Description,
-			Permissions: permissionsResponse,
+			Permissions: permissionResponses(role.Permissions, permissionsByCode),
 			IsSystem:    role.IsSystem,
-			CreatedAt:   role.CreatedAt,
-			UpdatedAt:   role.UpdatedAt,
-		})
+			Version:     role.Version,
+			CreatedAt:   utils.NewTimestamp(role.CreatedAt),
+			UpdatedAt:   utils.NewTimestamp(role.UpdatedAt),
+		}
+		if expiresAt := userRole.RoleExpiresAt(response.ID); expiresAt != nil {
+			timestamp := utils.NewTimestamp(*expiresAt)
+			response.ExpiresAt = &timestamp
+			response.ExpiresIn = int64(expiresAt.Sub(now).Seconds())
+		}
+		roles = append(roles, response)
 	}
 
-	// Obtener permisos específicos del usuario
-	permissions, err := u.permissionRepo.GetByCodesArray(userRole.Permissions)
-	if err != nil {
-		// Si hay error, devolver sin permisos específicos
-		return &domain.UserRoleResponse{
-			ID:          userRole.ID.Hex(),
-			UserID:      userRole.UserID,
-			Roles:       roles,
-			Permissions: []*domain.PermissionResponse{},
-			CreatedAt:   userRole.CreatedAt,
-			UpdatedAt:   userRole.UpdatedAt,
-		}, nil
-	}
+	return &domain.UserRoleResponse{
+		ID:          userRole.ID.Hex(),
+		UserID:      userRole.UserID,
+		Roles:       roles,
+		Permissions: permissionResponses(userRole.Permissions, permissionsByCode),
+		CreatedAt:   utils.NewTimestamp(userRole.CreatedAt),
+		UpdatedAt:   utils.NewTimestamp(userRole.UpdatedAt),
+	}, nil
+}
 
-	// Convertir permisos al formato de respuesta
-	var permissionsResponse []*domain.PermissionResponse
-	for _, p := range permissions {
-		permissionsResponse = append(permissionsResponse, &domain.PermissionResponse{
+// permissionResponses convierte los códigos a su formato de respuesta, en el orden dado
+// y omitiendo duplicados y códigos sin permiso registrado
+func permissionResponses(codes []string, permissionsByCode map[string]*domain.Permission) []*domain.PermissionResponse {
+	response := make([]*domain.PermissionResponse, 0, len(codes))
+	seen := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		p, ok := permissionsByCode[code]
+		if !ok || seen[code] {
+			continue
+		}
+		seen[code] = true
+		response = append(response, &domain.PermissionResponse{
 			ID:          p.ID.Hex(),
 			Code:        p.Code,
 			Module:      p.Module,
 			Action:      p.Action,
 			Name:        p.Name,
 			Description: p.Description,
-			CreatedAt:   p.CreatedAt,
-			UpdatedAt:   p.UpdatedAt,
+			CreatedAt:   utils.NewTimestamp(p.CreatedAt),
+			UpdatedAt:   utils.NewTimestamp(p.UpdatedAt),
 		})
 	}
+	return response
+}
 
-	return &domain.UserRoleResponse{
-		ID:          userRole.ID.Hex(),
-		UserID:      userRole.UserID,
-		Roles:       roles,
-		Permissions: permissionsResponse,
-		CreatedAt:   userRole.CreatedAt,
-		UpdatedAt:   userRole.UpdatedAt,
-	}, nil
+// AssignRoleToUser asigna un rol a un usuario, opcionalmente hasta req.ExpiresAt
+func (u *userRoleUseCase) AssignRoleToUser(scope *domain.AdminScope, req *domain.AssignRoleRequest) error {
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return domain.ErrInvalidRoleExpiry
+	}
+
+	// Verificar que el rol exista
+	role, err := u.roleRepo.GetByID(req.RoleID)
+	if err != nil {
+		return fmt.Errorf("%w: %w", domain.ErrInvalidRole, err)
+	}
+
+	// Un administrador delegado solo asigna roles compuestos por permisos de su ámbito,
+	// incluidos los que el rol hereda
+	if err := checkInheritedScope(u.roleRepo, scope, role); err != nil {
+		return err
+	}
+
+	return u.userRoleRepo.AddRoleWithExpiry(req.UserID, req.RoleID, req.ExpiresAt)
 }
 
-// AssignRoleToUser asigna un rol a un usuario
-func (u *userRoleUseCase) AssignRoleToUser(req *domain.AssignRoleRequest) error {
+// PreviewAssignRole calcula los permisos que el usuario ganaría al recibir el rol, sin
+// guardar ningún cambio. Un permiso ya cubierto por un comodín del usuario no cuenta como nuevo.
+func (u *userRoleUseCase) PreviewAssignRole(req *domain.AssignRoleRequest) (*domain.RoleAssignmentPreview, error) {
 	// Verificar que el rol exista
-	_, err := u.roleRepo.GetByID(req.RoleID)
+	role, err := u.roleRepo.GetByID(req.RoleID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", domain.ErrInvalidRole, err)
+	}
+
+	rolePermissions, err := inheritedRolePermissions(u.roleRepo, role)
+	if err != nil {
+		return nil, err
+	}
+
+	// Solo lecturas: la vista previa no crea la asignación ni guarda los permisos materializados
+	permissionsByUser, err := u.userRoleRepo.GetPermissionsByUserIDs([]string{req.UserID})
+	if err != nil {
+		return nil, fmt.Errorf("obtener permisos del usuario %s: %w", req.UserID, err)
+	}
+	current := permissionsByUser[req.UserID]
+
+	userRole, err := u.userRoleRepo.FindByUserID(req.UserID)
 	if err != nil {
-		return errors.New("rol no válido")
+		return nil, fmt.Errorf("obtener roles del usuario %s: %w", req.UserID, err)
 	}
+	alreadyAssigned := slices.Contains(userRole.ActiveRoles(time.Now()), req.RoleID)
 
-	return u.userRoleRepo.AddRole(req.UserID, req.RoleID)
+	currentSet := make(map[string]bool, len(current))
+	for _, p := range current {
+		currentSet[p] = true
+	}
+
+	resulting := append([]string{}, current...)
+	added := []string{}
+	for _, p := range rolePermissions {
+		if currentSet[p] {
+			continue
+		}
+		currentSet[p] = true
+		resulting = append(resulting, p)
+
+		covered := false
+		for _, held := range current {
+			if utils.PermissionMatches(held, p) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			added = append(added, p)
+		}
+	}
+
+	currentSorted := append([]string{}, current...)
+	sort.Strings(currentSorted)
+	sort.Strings(resulting)
+	sort.Strings(added)
+
+	return &domain.RoleAssignmentPreview{
+		UserID:               req.UserID,
+		RoleID:               role.ID.Hex(),
+		RoleName:             role.Name,
+		AlreadyAssigned:      alreadyAssigned,
+		CurrentPermissions:   currentSorted,
+		ResultingPermissions: resulting,
+		AddedPermissions:     added,
+	}, nil
 }
 
 // RemoveRoleFromUser elimina un rol de un usuario
-func (u *userRoleUseCase) RemoveRoleFromUser(req *domain.AssignRoleRequest) error {
+func (u *userRoleUseCase) RemoveRoleFromUser(scope *domain.AdminScope, req *domain.AssignRoleRequest) error {
+	if err := checkRoleScope(u.roleRepo, scope, req.RoleID); err != nil {
+		return err
+	}
+
 	return u.userRoleRepo.RemoveRole(req.UserID, req.RoleID)
 }
 
 // AssignPermissionToUser asigna un permiso específico a un usuario
-func (u *userRoleUseCase) AssignPermissionToUser(req *domain.AssignPermissionRequest) error {
+func (u *userRoleUseCase) AssignPermissionToUser(scope *domain.AdminScope, req *domain.AssignPermissionRequest) error {
+	if err := scope.Check(req.PermissionCode); err != nil {
+		return err
+	}
+
 	// Verificar que el permiso exista
 	_, err := u.permissionRepo.GetByCode(req.PermissionCode)
+	if errors.Is(err, domain.ErrPermissionNotFound) {
+		return fmt.Errorf("%w: %w", domain.ErrInvalidPermission, err)
+	}
 	if err != nil {
-		return errors.New("permiso no válido")
+		return fmt.Errorf("obtener permiso %s: %w", req.PermissionCode, err)
 	}
 
 	return u.userRoleRepo.AddPermission(req.UserID, req.PermissionCode)
 }
 
 // RemovePermissionFromUser elimina un permiso específico de un usuario
-func (u *userRoleUseCase) RemovePermissionFromUser(req *domain.AssignPermissionRequest) error {
+func (u *userRoleUseCase) RemovePermissionFromUser(scope *domain.AdminScope, req *domain.AssignPermissionRequest) error {
+	if err := scope.Check(req.PermissionCode); err != nil {
+		return err
+	}
+
 	return u.userRoleRepo.RemovePermission(req.UserID, req.PermissionCode)
 }
 
@@ -159,25 +251,196 @@ func (u *userRoleUseCase) GetUserPermissions(userID string) ([]string, error) {
 	return u.userRoleRepo.GetUserPermissions(userID)
 }
 
+// GetPermissionMatrix evalúa los códigos para cada usuario (los IDs y códigos vacíos o repetidos
+// se omiten) con una consulta en lote de sus permisos. Sin códigos se evalúan todos los permisos
+// registrados. Retorna ErrMatrixTooLarge si hay más de MaxPermissionMatrixUsers usuarios.
+func (u *userRoleUseCase) GetPermissionMatrix(userIDs []string, codes []string) (domain.PermissionMatrix, error) {
+	userIDs = uniqueNonEmpty(userIDs)
+	if len(userIDs) > domain.MaxPermissionMatrixUsers {
+		return nil, fmt.Errorf("%w (se indicaron %d)", domain.ErrMatrixTooLarge, len(userIDs))
+	}
+
+	codes = uniqueNonEmpty(codes)
+	if len(codes) == 0 {
+		registered, err := u.permissionRepo.GetAll(map[string]interface{}{})
+		if err != nil {
+			return nil, fmt.Errorf("obtener permisos registrados: %w", err)
+		}
+		for _, p := range registered {
+			codes = append(codes, p.Code)
+		}
+	}
+
+	permissionsByUser, err := u.userRoleRepo.GetPermissionsByUserIDs(userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("obtener permisos de %d usuarios: %w", len(userIDs), err)
+	}
+
+	matrix := make(domain.PermissionMatrix, len(userIDs))
+	for _, userID := range userIDs {
+		row := make(map[string]bool, len(codes))
+		for _, code := range codes {
+			row[code] = grantsPermission(permissionsByUser[userID], code)
+		}
+		matrix[userID] = row
+	}
+	return matrix, nil
+}
+
+// uniqueNonEmpty retorna los valores sin espacios alrededor, en su orden y omitiendo los vacíos
+// y los repetidos
+func uniqueNonEmpty(values []string) []string {
+	unique := make([]string, 0, len(values))
+	seen := make(map[string]bool, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		unique = append(unique, value)
+	}
+	return unique
+}
+
+// GetUsersByRole obtiene una página de los usuarios que tienen asignado el rol directamente (no
+// incluye a los que lo reciben por herencia de otro rol). Si el rol no existe retorna
+// domain.ErrRoleNotFound.
+func (u *userRoleUseCase) GetUsersByRole(roleID string, skip, limit int64) (*domain.RoleUsersResponse, error) {
+	if _, err := u.roleRepo.GetByID(roleID); err != nil {
+		return nil, fmt.Errorf("obtener rol %s: %w", roleID, err)
+	}
+
+	userIDs, total, err := u.userRoleRepo.GetUsersByRole(roleID, skip, limit)
+	if err != nil {
+		return nil, fmt.Errorf("obtener usuarios del rol %s: %w", roleID, err)
+	}
+
+	return &domain.RoleUsersResponse{
+		RoleID:  roleID,
+		UserIDs: userIDs,
+		Total:   total,
+	}, nil
+}
+
+// GetAdminScope obtiene el ámbito de administración delegada del usuario a partir de sus
+// permisos efectivos (admin:scope:<modulo>); nil si no tiene restricción
+func (u *userRoleUseCase) GetAdminScope(userID string) (*domain.AdminScope, error) {
+	permissions, err := u.userRoleRepo.GetUserPermissions(userID)
+	if err != nil {
+		return nil, fmt.Errorf("obtener permisos del usuario %s: %w", userID, err)
+	}
+	return domain.NewAdminScope(permissions), nil
+}
+
+// EnsureUserRole garantiza que el usuario tenga un documento de asignación (vacío si es nuevo)
+func (u *userRoleUseCase) EnsureUserRole(userID string) (bool, error) {
+	created, err := u.userRoleRepo.EnsureForUser(userID)
+	if err != nil {
+		return false, fmt.Errorf("asegurar asignación del usuario %s: %w", userID, err)
+	}
+	return created, nil
+}
+
+// EnsureUserRoles garantiza en una sola escritura que los usuarios tengan su documento de
+// asignación; retorna los usuarios a los que se les creó
+func (u *userRoleUseCase) EnsureUserRoles(userIDs []string) ([]string, error) {
+	created, err := u.userRoleRepo.EnsureForUsers(userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("asegurar asignaciones de %d usuarios: %w", len(userIDs), err)
+	}
+	return created, nil
+}
+
+// ClearUserRoles quita todos los roles y permisos específicos del usuario. La asignación vacía se
+// conserva; no recibe ámbito porque no es una operación de gestión (la usa la eliminación de cuentas).
+func (u *userRoleUseCase) ClearUserRoles(userID string) error {
+	userRole, err := u.userRoleRepo.GetByUserID(userID)
+	if err != nil {
+		return fmt.Errorf("obtener asignación del usuario %s: %w", userID, err)
+	}
+	if len(userRole.Roles) == 0 && len(userRole.Permissions) == 0 {
+		return nil
+	}
+
+	details := fmt.Sprintf("roles=%s permissions=%s", strings.Join(userRole.Roles, ","), strings.Join(userRole.Permissions, ","))
+	userRole.Roles = []string{}
+	userRole.Permissions = []string{}
+	userRole.RoleExpirations = nil
+	if err := u.userRoleRepo.Update(userRole); err != nil {
+		return fmt.Errorf("actualizar asignación del usuario %s: %w", userID, err)
+	}
+	return recordSystemChange(u.recorder, domain.ChangeUserRolesClear, "user:"+userID, details)
+}
+
+// DeleteUserRoles elimina la asignación del usuario borrado, con sus roles y permisos. Como
+// ClearUserRoles, no recibe ámbito: la usa el borrado de usuarios.
+func (u *userRoleUseCase) DeleteUserRoles(userID string) error {
+	if err := u.userRoleRepo.DeleteByUserID(userID); err != nil {
+		return fmt.Errorf("eliminar asignación del usuario %s: %w", userID, err)
+	}
+	return recordSystemChange(u.recorder, domain.ChangeUserRolesDelete, "user:"+userID, "")
+}
+
+// PurgeExpiredRoles quita de las asignaciones los roles vencidos en now y registra el barrido
+// si cambió alguna asignación. Retorna cuántas asignaciones cambiaron.
+func (u *userRoleUseCase) PurgeExpiredRoles(now time.Time) (int64, error) {
+	modified, err := u.userRoleRepo.RemoveExpiredRoles(now)
+	if err != nil {
+		return modified, fmt.Errorf("quitar roles vencidos: %w", err)
+	}
+	if modified > 0 {
+		details := fmt.Sprintf("user_roles_updated=%d", modified)
+		if err := recordSystemChange(u.recorder, domain.ChangeRoleExpire, "user_roles", details); err != nil {
+			return modified, err
+		}
+	}
+	return modified, nil
+}
+
+// RebuildEffectivePermissions recalcula los permisos materializados de todas las asignaciones
+func (u *userRoleUseCase) RebuildEffectivePermissions(scope *domain.AdminScope) (*domain.EffectivePermissionsRebuildResult, error) {
+	if scope != nil {
+		return nil, fmt.Errorf("%w: la reconstrucción afecta a todos los módulos", domain.ErrOutOfAdminScope)
+	}
+
+	rebuilt, err := u.userRoleRepo.RebuildEffectivePermissions()
+	if err != nil {
+		return nil, fmt.Errorf("reconstruir permisos efectivos (%d asignaciones procesadas): %w", rebuilt, err)
+	}
+	return &domain.EffectivePermissionsRebuildResult{Rebuilt: rebuilt}, nil
+}
+
 // HasPermission verifica si un usuario tiene un permiso específico
 func (u *userRoleUseCase) HasPermission(userID string, permissionCode string) (bool, error) {
-	// Obtener todos los permisos del usuario
+	// Obtener todos los permisos del usuario (el conjunto materializado si está activo)
 	permissions, err := u.userRoleRepo.GetUserPermissions(userID)
 	if err != nil {
-		return false, err
+		return false, fmt.Errorf("obtener permisos del usuario %s: %w", userID, err)
 	}
 
-	// Verificar si el permiso específico está en la lista
-	for _, p := range permissions {
-		if p == permissionCode {
-			return true, nil
-		}
+	return grantsPermission(permissions, permissionCode), nil
+}
+
+// HasModuleAccess verifica si un usuario tiene algún permiso del módulo, concreto
+// (ej. "finanzas:read") o comodín (ej. "finanzas:*")
+func (u *userRoleUseCase) HasModuleAccess(userID string, module string) (bool, error) {
+	permissions, err := u.userRoleRepo.GetUserPermissions(userID)
+	if err != nil {
+		return false, fmt.Errorf("obtener permisos del usuario %s: %w", userID, err)
+	}
+
+	return utils.GrantsModuleAccess(permissions, module), nil
+}
 
-		// Comprobar permisos comodín (por ejemplo, "module:*" o "module:submodule:*")
-		if isWildcardMatch(p, permissionCode) {
-			return true, nil
+// grantsPermission indica si permissions incluye permissionCode, directamente o por un comodín
+// ("*", "module:*" o "module:submodule:*")
+func grantsPermission(permissions []string, permissionCode string) bool {
+	for _, p := range permissions {
+		if utils.PermissionMatches(p, permissionCode) {
+			return true
 		}
 	}
 
-	return false, nil
+	return false
 }
@@ -1,7 +1,14 @@
 package delivery
 
 import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
@@ -9,29 +16,134 @@ import (
 	"github.com/black4ninja/mi-proyecto/pkg/utils"
 )
 
+// maxUserImportBytes limita el tamaño del cuerpo de una importación de usuarios
+const maxUserImportBytes = 5 << 20
+
 // UserHandler maneja las peticiones HTTP para usuarios
 type UserHandler struct {
 	userUseCase domain.UserUseCase
+	paginator   *utils.Paginator
 }
 
-// NewUserHandler crea un nuevo manejador de usuarios
-func NewUserHandler(router *gin.RouterGroup, useCase domain.UserUseCase) {
+// NewUserHandler crea un nuevo manejador de usuarios.
+// Si paginator es nil se usan los tamaños de página por defecto. accessMiddleware se aplica a las
+// rutas /:id para decidir quién accede a cada usuario (ej. PermissionMiddleware.RequireSelfOrPermission);
+// si es nil no se aplica. sensitiveMiddlewares se aplican solo a las operaciones sensibles
+// (ej. OAuthMiddleware.RequireRecentAuth para el cambio de contraseña).
+func NewUserHandler(router *gin.RouterGroup, useCase domain.UserUseCase, paginator *utils.Paginator, accessMiddleware gin.HandlerFunc, sensitiveMiddlewares ...gin.HandlerFunc) {
+	if paginator == nil {
+		paginator = utils.NewPaginator(utils.DefaultPageSize, utils.DefaultMaxSize)
+	}
 	handler := &UserHandler{
 		userUseCase: useCase,
+		paginator:   paginator,
 	}
 
 	// Rutas públicas
 	// Ninguna en este caso
 
-	// Rutas protegidas
-	router.GET("/", handler.GetAllUsers)
-	router.GET("/:id", handler.GetUser)
-	router.POST("/", handler.CreateUser)
-	router.PUT("/:id", handler.UpdateUser)
-	router.DELETE("/:id", handler.DeleteUser)
-	router.PUT("/:id/archive", handler.ArchiveUser)
-	router.POST("/change-password", handler.ChangePassword)
+	// Rutas protegidas (el listado y la creación se registran con NewUserManagementHandler)
+	var accessMiddlewares []gin.HandlerFunc
+	if accessMiddleware != nil {
+		accessMiddlewares = append(accessMiddlewares, accessMiddleware)
+	}
+	router.GET("/:id", append(accessMiddlewares, handler.GetUser)...)
+	router.PUT("/:id", append(accessMiddlewares, handler.UpdateUser)...)
+	router.DELETE("/:id", append(accessMiddlewares, handler.DeleteUser)...)
+	router.PUT("/:id/archive", append(accessMiddlewares, handler.ArchiveUser)...)
+	router.POST("/change-password", append(sensitiveMiddlewares, handler.ChangePassword)...)
 	router.GET("/me", handler.GetProfile)
+	router.DELETE("/me", append(sensitiveMiddlewares, handler.DeleteOwnAccount)...)
+	router.POST("/me/2fa", append(sensitiveMiddlewares, handler.EnableTwoFactor)...)
+	router.POST("/me/2fa/verify", append(sensitiveMiddlewares, handler.VerifyTwoFactor)...)
+	router.POST("/me/2fa/disable", append(sensitiveMiddlewares, handler.DisableTwoFactor)...)
+}
+
+// NewUserManagementHandler registra el listado y la creación de usuarios. El grupo recibido debe
+// estar protegido con un permiso administrativo (ej. admin:users): el listado expone a todos los
+// usuarios y la creación admite skip_verification. Si paginator es nil se usan los tamaños de
+// página por defecto.
+func NewUserManagementHandler(router *gin.RouterGroup, useCase domain.UserUseCase, paginator *utils.Paginator) {
+	if paginator == nil {
+		paginator = utils.NewPaginator(utils.DefaultPageSize, utils.DefaultMaxSize)
+	}
+	handler := &UserHandler{
+		userUseCase: useCase,
+		paginator:   paginator,
+	}
+
+	router.GET("", handler.GetAllUsers)
+	router.POST("", handler.CreateUser)
+}
+
+// NewUserAdminHandler registra las rutas administrativas de usuarios.
+// El grupo recibido debe estar protegido con un permiso administrativo (ej. admin:users).
+func NewUserAdminHandler(router *gin.RouterGroup, useCase domain.UserUseCase) {
+	handler := &UserHandler{
+		userUseCase: useCase,
+	}
+
+	router.POST("/diagnose-login", handler.DiagnoseLogin)
+}
+
+// NewUserRestoreHandler registra la restauración de usuarios archivados. El grupo recibido debe
+// estar protegido con un permiso administrativo (ej. admin:users): un usuario archivado no
+// puede reactivarse a sí mismo.
+func NewUserRestoreHandler(router *gin.RouterGroup, useCase domain.UserUseCase) {
+	handler := &UserHandler{
+		userUseCase: useCase,
+	}
+
+	router.PUT("/:id/restore", handler.RestoreUser)
+}
+
+// NewUserImportHandler registra la importación masiva de usuarios. El grupo recibido debe estar
+// protegido con un permiso administrativo (ej. admin:users) y aceptar cuerpos JSON y CSV.
+func NewUserImportHandler(router *gin.RouterGroup, useCase domain.UserUseCase) {
+	handler := &UserHandler{
+		userUseCase: useCase,
+	}
+
+	router.POST("/import", handler.ImportUsers)
+}
+
+// NewEmailVerificationHandler registra la ruta pública de verificación de email
+func NewEmailVerificationHandler(router *gin.RouterGroup, useCase domain.UserUseCase) {
+	handler := &UserHandler{
+		userUseCase: useCase,
+	}
+
+	router.GET("/verify-email", handler.VerifyEmail)
+}
+
+// NewVerificationResendHandler registra la ruta pública de reenvío del email de verificación. El
+// grupo recibido debe aceptar solo cuerpos JSON.
+func NewVerificationResendHandler(router *gin.RouterGroup, useCase domain.UserUseCase) {
+	handler := &UserHandler{
+		userUseCase: useCase,
+	}
+
+	router.POST("/resend-verification", handler.ResendVerification)
+}
+
+// NewRegistrationHandler registra la ruta pública de registro de usuarios. El grupo recibido debe
+// aceptar solo cuerpos JSON.
+func NewRegistrationHandler(router *gin.RouterGroup, useCase domain.UserUseCase) {
+	handler := &UserHandler{
+		userUseCase: useCase,
+	}
+
+	router.POST("/register", handler.Register)
+}
+
+// NewPasswordResetHandler registra las rutas públicas de recuperación de contraseña
+func NewPasswordResetHandler(router *gin.RouterGroup, useCase domain.UserUseCase) {
+	handler := &UserHandler{
+		userUseCase: useCase,
+	}
+
+	router.POST("/forgot-password", handler.ForgotPassword)
+	router.POST("/reset-password", handler.ResetPassword)
 }
 
 // @Summary Obtener todos los usuarios
@@ -39,13 +151,19 @@ func NewUserHandler(router *gin.RouterGroup, useCase domain.UserUseCase) {
 // @Tags usuarios
 // @Accept json
 // @Produce json
-// @Param status query string false "Estado del usuario (active, inactive, archived)"
-// @Param role query string false "Rol del usuario"
+// @Param status query string false "Estados del usuario separados por coma (active, inactive, archived)"
+// @Param role query string false "Roles del usuario separados por coma (admin, user, moderator)"
 // @Param name query string false "Nombre del usuario (búsqueda parcial)"
 // @Param email query string false "Email del usuario (búsqueda parcial)"
+// @Param metadata.{clave} query string false "Filtra por un atributo de metadatos (ej. metadata.department=ventas)"
 // @Param created_from query string false "Fecha de creación desde (formato ISO8601)"
 // @Param created_to query string false "Fecha de creación hasta (formato ISO8601)"
-// @Success 200 {object} utils.Response{data=[]domain.UserResponse} "Lista de usuarios"
+// @Param page query int false "Página (desde 1)"
+// @Param limit query int false "Tamaño de página (se reduce al máximo configurado)"
+// @Param cursor query string false "Paginación por cursor: vacío para la primera página, luego el next_cursor recibido (ignora page)"
+// @Success 200 {object} utils.Response{data=[]domain.UserResponse,pagination=utils.PaginationMeta} "Lista de usuarios (pagination es utils.CursorMeta con ?cursor)"
+// @Failure 400 {object} utils.Response "Cursor inválido"
+// @Failure 403 {object} utils.Response "Sin permiso admin:users"
 // @Failure 500 {object} utils.Response "Error interno"
 // @Router /users [get]
 // @Security BearerAuth
@@ -53,12 +171,12 @@ func (h *UserHandler) GetAllUsers(c *gin.Context) {
 	// Extraer todos los parámetros de consulta
 	queryParams := make(map[string]string)
 
-	// Parámetros básicos
-	if status := c.Query("status"); status != "" {
-		queryParams["status"] = status
+	// Parámetros básicos (status y role aceptan varios valores: ?status=active,inactive o ?status=active&status=inactive)
+	if statuses := c.QueryArray("status"); len(statuses) > 0 {
+		queryParams["status"] = strings.Join(statuses, ",")
 	}
-	if role := c.Query("role"); role != "" {
-		queryParams["role"] = role
+	if roles := c.QueryArray("role"); len(roles) > 0 {
+		queryParams["role"] = strings.Join(roles, ",")
 	}
 	if name := c.Query("name"); name != "" {
 		queryParams["name"] = name
@@ -99,6 +217,11 @@ func (h *UserHandler) GetAllUsers(c *gin.Context) {
 		}
 	}
 
+	// Filtros por metadatos personalizados (?metadata.department=ventas)
+	for field, value := range utils.MetadataFilter(c.Request.URL.Query()) {
+		filter[field] = value
+	}
+
 	// Añadir filtros adicionales de acuerdo a la lógica de negocio
 	// Por ejemplo, para usuarios no archivados cuando no se especifica estatus
 	if _, hasStatus := filter["status"]; !hasStatus {
@@ -112,14 +235,30 @@ func (h *UserHandler) GetAllUsers(c *gin.Context) {
 		delete(filter, "status")
 	}
 
-	// Obtener todos los usuarios con los filtros aplicados
-	users, err := h.userUseCase.GetAllUsers(filter)
+	// Obtener la página solicitada con los filtros aplicados. Con ?cursor (vacío para la primera
+	// página) se pagina por cursor en lugar de por número de página.
+	page := h.paginator.Parse(c)
+	if cursor, keyset := c.GetQuery("cursor"); keyset {
+		users, next, err := h.userUseCase.GetUsersAfter(filter, cursor, int64(page.Limit))
+		if err != nil {
+			if errors.Is(err, utils.ErrInvalidCursor) {
+				utils.ValidationErrorResponse(c, err.Error())
+				return
+			}
+			utils.ErrorResponse(c, http.StatusInternalServerError, publicError(err))
+			return
+		}
+		utils.CursorPaginatedResponse(c, http.StatusOK, "Usuarios obtenidos con éxito", usersForCaller(c, users), h.paginator.CursorMeta(page, next))
+		return
+	}
+
+	result, err := h.userUseCase.GetAllUsers(filter, page.Skip(), int64(page.Limit))
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		utils.ErrorResponse(c, http.StatusInternalServerError, publicError(err))
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Usuarios obtenidos con éxito", users)
+	utils.PaginatedResponse(c, http.StatusOK, "Usuarios obtenidos con éxito", usersForCaller(c, result.Items), h.paginator.Meta(page, result.Total))
 }
 
 // @Summary Obtener un usuario
@@ -129,7 +268,8 @@ func (h *UserHandler) GetAllUsers(c *gin.Context) {
 // @Produce json
 // @Param id path string true "ID del usuario"
 // @Success 200 {object} utils.Response{data=domain.UserResponse} "Usuario obtenido"
-// @Failure 404 {object} utils.Response "Usuario no encontrado"
+// @Failure 403 {object} utils.Response "Usuario ajeno sin permiso admin:users (con USER_ACCESS_DENIAL=403)"
+// @Failure 404 {object} utils.Response "Usuario no encontrado o ajeno sin permiso admin:users"
 // @Failure 500 {object} utils.Response "Error interno"
 // @Router /users/{id} [get]
 // @Security BearerAuth
@@ -138,11 +278,15 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 
 	user, err := h.userUseCase.GetUser(id)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, domain.ErrUserNotFound) {
+			statusCode = http.StatusNotFound
+		}
+		utils.ErrorResponse(c, statusCode, publicError(err))
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Usuario obtenido con éxito", user)
+	utils.SuccessResponse(c, http.StatusOK, "Usuario obtenido con éxito", userForCaller(c, user))
 }
 
 // @Summary Crear un usuario
@@ -153,6 +297,8 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 // @Param user body domain.CreateUserRequest true "Datos del usuario"
 // @Success 201 {object} utils.Response{data=domain.UserResponse} "Usuario creado"
 // @Failure 400 {object} utils.Response "Datos inválidos"
+// @Failure 403 {object} utils.Response "Sin permiso admin:users"
+// @Failure 422 {object} utils.Response "Regla de negocio no cumplida"
 // @Failure 500 {object} utils.Response "Error interno"
 // @Router /users [post]
 // @Security BearerAuth
@@ -165,14 +311,44 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 
 	user, err := h.userUseCase.CreateUser(&req)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		errorResponse(c, http.StatusBadRequest, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Usuario creado con éxito", userForCaller(c, user))
+}
+
+// @Summary Registrar un usuario
+// @Description Crea una cuenta desde el registro público. Se ignora skip_verification: solo un administrador puede omitir la verificación de email.
+// @Tags usuarios
+// @Accept json
+// @Produce json
+// @Param user body domain.CreateUserRequest true "Datos del usuario"
+// @Success 201 {object} utils.Response{data=domain.UserResponse} "Usuario creado"
+// @Failure 400 {object} utils.Response "Datos inválidos"
+// @Failure 422 {object} utils.Response "Regla de negocio no cumplida"
+// @Failure 500 {object} utils.Response "Error interno"
+// @Router /register [post]
+func (h *UserHandler) Register(c *gin.Context) {
+	var req domain.CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+	// Solo un administrador puede omitir la verificación de email
+	req.SkipVerification = false
+
+	user, err := h.userUseCase.CreateUser(&req)
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, err)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusCreated, "Usuario creado con éxito", user)
+	utils.SuccessResponse(c, http.StatusCreated, "Usuario creado con éxito", userForCaller(c, user))
 }
 
-// UpdateUser manejador para actualizar un usuario
+// UpdateUser manejador para actualizar un usuario. Sin domain.AdminPermission el propio usuario
+// no puede cambiar su estado ni su rol: status y role se ignoran.
 func (h *UserHandler) UpdateUser(c *gin.Context) {
 	id := c.Param("id")
 
@@ -181,45 +357,83 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		utils.ValidationErrorResponse(c, err.Error())
 		return
 	}
+	if userID, _ := utils.MustUserID(c); userID == id && !utils.HasGrantedPermission(c, domain.AdminPermission) {
+		req.Status, req.Role = "", ""
+	}
+
+	unmodifiedSince, err := utils.ParseIfUnmodifiedSince(c.GetHeader("If-Unmodified-Since"))
+	if err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+	req.UnmodifiedSince = unmodifiedSince
 
 	user, err := h.userUseCase.UpdateUser(id, &req)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		errorResponse(c, http.StatusBadRequest, err)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Usuario actualizado con éxito", user)
+	utils.SuccessResponse(c, http.StatusOK, "Usuario actualizado con éxito", userForCaller(c, user))
 }
 
-// DeleteUser manejador para eliminar un usuario
+// DeleteUser manejador para eliminar un usuario. Sin domain.AdminPermission el propio usuario no
+// puede eliminarse por esta ruta: debe usar DELETE /me, que confirma la contraseña y archiva la cuenta.
 func (h *UserHandler) DeleteUser(c *gin.Context) {
 	id := c.Param("id")
 
+	if userID, _ := utils.MustUserID(c); userID == id && !utils.HasGrantedPermission(c, domain.AdminPermission) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Para eliminar tu propia cuenta usa DELETE /api/users/me")
+		return
+	}
+
 	if err := h.userUseCase.DeleteUser(id); err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		errorResponse(c, http.StatusInternalServerError, err)
 		return
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, "Usuario eliminado con éxito", nil)
 }
 
-// ArchiveUser manejador para archivar un usuario
+// ArchiveUser manejador para archivar un usuario. Sin admin:users un usuario no puede archivarse
+// a sí mismo: no podría restaurar su cuenta y omitiría la confirmación de DELETE /api/users/me.
 func (h *UserHandler) ArchiveUser(c *gin.Context) {
 	id := c.Param("id")
 
+	if userID, _ := utils.MustUserID(c); userID == id && !utils.HasGrantedPermission(c, domain.AdminPermission) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Para cerrar tu propia cuenta usa DELETE /api/users/me")
+		return
+	}
+
 	if err := h.userUseCase.ArchiveUser(id); err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		errorResponse(c, http.StatusInternalServerError, err)
 		return
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, "Usuario archivado con éxito", nil)
 }
 
+// RestoreUser manejador para restaurar un usuario archivado
+func (h *UserHandler) RestoreUser(c *gin.Context) {
+	id := c.Param("id")
+
+	if err := h.userUseCase.RestoreUser(id); err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, publicError(err))
+			return
+		}
+		errorResponse(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Usuario restaurado con éxito", nil)
+}
+
 // ChangePassword manejador para cambiar la contraseña
 func (h *UserHandler) ChangePassword(c *gin.Context) {
 	// Obtener el ID del usuario del token (middleware)
-	userID, exists := c.Get("userID")
-	if !exists {
+	userID, ok := utils.MustUserID(c)
+	if !ok {
 		utils.ErrorResponse(c, http.StatusUnauthorized, "No autorizado")
 		return
 	}
@@ -230,28 +444,491 @@ func (h *UserHandler) ChangePassword(c *gin.Context) {
 		return
 	}
 
-	if err := h.userUseCase.ChangePassword(userID.(string), &req); err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	if err := h.userUseCase.ChangePassword(userID, &req); err != nil {
+		errorResponse(c, http.StatusBadRequest, err)
 		return
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, "Contraseña cambiada con éxito", nil)
 }
 
+// EnableTwoFactor genera el secreto TOTP del usuario autenticado. La verificación en dos pasos
+// queda activa al confirmar el primer código en /me/2fa/verify.
+func (h *UserHandler) EnableTwoFactor(c *gin.Context) {
+	userID, ok := utils.MustUserID(c)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "No autorizado")
+		return
+	}
+
+	setup, err := h.userUseCase.EnableTwoFactor(userID)
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Secreto de verificación en dos pasos generado", setup)
+}
+
+// VerifyTwoFactor valida un código TOTP del usuario autenticado; el primero activa la verificación en dos pasos
+func (h *UserHandler) VerifyTwoFactor(c *gin.Context) {
+	userID, ok := utils.MustUserID(c)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "No autorizado")
+		return
+	}
+
+	var req domain.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	if err := h.userUseCase.VerifyTwoFactor(userID, req.Code); err != nil {
+		errorResponse(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Código de verificación válido", nil)
+}
+
+// DisableTwoFactor desactiva la verificación en dos pasos del usuario autenticado con un código válido
+func (h *UserHandler) DisableTwoFactor(c *gin.Context) {
+	userID, ok := utils.MustUserID(c)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "No autorizado")
+		return
+	}
+
+	var req domain.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	if err := h.userUseCase.DisableTwoFactor(userID, req.Code); err != nil {
+		errorResponse(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Verificación en dos pasos desactivada", nil)
+}
+
+// DeleteOwnAccount elimina la cuenta del usuario autenticado tras confirmar su contraseña
+func (h *UserHandler) DeleteOwnAccount(c *gin.Context) {
+	userID, ok := utils.MustUserID(c)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "No autorizado")
+		return
+	}
+
+	var req domain.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	if err := h.userUseCase.DeleteOwnAccount(userID, &req); err != nil {
+		errorResponse(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Cuenta eliminada con éxito", nil)
+}
+
 // GetProfile obtiene el perfil del usuario autenticado
 func (h *UserHandler) GetProfile(c *gin.Context) {
 	// Obtener el ID del usuario del token (middleware)
-	userID, exists := c.Get("userID")
-	if !exists {
+	userID, ok := utils.MustUserID(c)
+	if !ok {
 		utils.ErrorResponse(c, http.StatusUnauthorized, "No autorizado")
 		return
 	}
 
-	user, err := h.userUseCase.GetUser(userID.(string))
+	user, err := h.userUseCase.GetUser(userID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, publicError(err))
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Perfil obtenido con éxito", userForCaller(c, user))
+}
+
+// @Summary Importar usuarios
+// @Description Crea usuarios a partir de un arreglo JSON o de un CSV (text/csv) con encabezado email,name,password,role y columnas metadata.{clave} opcionales. Sin password se genera una contraseña temporal que el usuario debe cambiar. Las filas inválidas no impiden crear las demás.
+// @Tags usuarios
+// @Accept json
+// @Accept text/csv
+// @Produce json
+// @Param users body []domain.UserImportRecord true "Usuarios a importar"
+// @Success 200 {object} utils.Response{data=domain.UserImportResponse} "Resultado por fila"
+// @Failure 400 {object} utils.Response "Cuerpo inválido"
+// @Failure 422 {object} utils.Response "Demasiadas filas"
+// @Failure 500 {object} utils.Response "Error interno"
+// @Router /users/import [post]
+// @Security BearerAuth
+func (h *UserHandler) ImportUsers(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUserImportBytes)
+
+	var records []*domain.UserImportRecord
+	var err error
+	if mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type")); strings.EqualFold(mediaType, "text/csv") {
+		records, err = parseUserImportCSV(c.Request.Body)
+	} else {
+		err = c.ShouldBindJSON(&records)
+	}
+	if err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+	if len(records) == 0 {
+		utils.ValidationErrorResponse(c, "la importación no contiene usuarios")
+		return
+	}
+
+	result, err := h.userUseCase.ImportUsers(records)
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Importación completada", result)
+}
+
+// parseUserImportCSV lee los registros de un CSV cuyo primer renglón es el encabezado.
+// Columnas: email y name (obligatorias), password, role y metadata.{clave}. Se ignora el BOM
+// UTF-8 con el que algunas hojas de cálculo exportan el archivo.
+func parseUserImportCSV(r io.Reader) ([]*domain.UserImportRecord, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("leer encabezado CSV: %w", err)
+	}
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	columns := make(map[string]bool, len(header))
+	for i, column := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(column))
+		switch column := header[i]; {
+		case column == "email", column == "name", column == "password", column == "role":
+		case strings.HasPrefix(column, "metadata.") && len(column) > len("metadata."):
+		default:
+			return nil, fmt.Errorf("columna CSV desconocida: %s", column)
+		}
+		columns[header[i]] = true
+	}
+	for _, required := range []string{"email", "name"} {
+		if !columns[required] {
+			return nil, fmt.Errorf("falta la columna CSV obligatoria: %s", required)
+		}
+	}
+
+	var records []*domain.UserImportRecord
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("leer CSV: %w", err)
+		}
+
+		record := &domain.UserImportRecord{}
+		for i, value := range row {
+			value = strings.TrimSpace(value)
+			switch column := header[i]; column {
+			case "email":
+				record.Email = value
+			case "name":
+				record.Name = value
+			case "password":
+				record.Password = value
+			case "role":
+				record.Role = value
+			default:
+				if value == "" {
+					continue
+				}
+				if record.Metadata == nil {
+					record.Metadata = make(map[string]interface{})
+				}
+				record.Metadata[strings.TrimPrefix(column, "metadata.")] = value
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// @Summary Verificar email
+// @Description Activa la cuenta pendiente con el token recibido al registrarse
+// @Tags usuarios
+// @Produce json
+// @Param token query string true "Token de verificación"
+// @Success 200 {object} utils.Response "Email verificado"
+// @Failure 400 {object} utils.Response "Token requerido"
+// @Failure 422 {object} utils.Response "Token inválido o expirado"
+// @Failure 500 {object} utils.Response "Error interno"
+// @Router /verify-email [get]
+func (h *UserHandler) VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		utils.ValidationErrorResponse(c, "token requerido")
+		return
+	}
+
+	if err := h.userUseCase.VerifyEmail(token); err != nil {
+		errorResponse(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Email verificado con éxito", nil)
+}
+
+// @Summary Reenviar verificación de email
+// @Description Envía un token de verificación nuevo al usuario pendiente con ese email; el anterior deja de servir. Entre dos envíos al mismo usuario debe pasar el cooldown configurado. La respuesta es la misma exista o no el email.
+// @Tags usuarios
+// @Accept json
+// @Produce json
+// @Param request body domain.ResendVerificationRequest true "Email de la cuenta"
+// @Success 200 {object} utils.Response "Solicitud recibida"
+// @Failure 400 {object} utils.Response "Datos inválidos"
+// @Failure 503 {object} utils.Response "Verificación no disponible"
+// @Failure 500 {object} utils.Response "Error interno"
+// @Router /resend-verification [post]
+func (h *UserHandler) ResendVerification(c *gin.Context) {
+	var req domain.ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	if err := h.userUseCase.ResendVerification(req.Email); err != nil {
+		if errors.Is(err, domain.ErrEmailVerificationDisabled) {
+			utils.ErrorResponse(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		utils.InternalErrorResponse(c)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Si el email tiene una verificación pendiente, recibirás un nuevo enlace", nil)
+}
+
+// @Summary Solicitar restablecimiento de contraseña
+// @Description Envía un token de restablecimiento al usuario activo con ese email. La respuesta es la misma exista o no el email.
+// @Tags usuarios
+// @Accept json
+// @Produce json
+// @Param request body domain.ForgotPasswordRequest true "Email de la cuenta"
+// @Success 200 {object} utils.Response "Solicitud recibida"
+// @Failure 400 {object} utils.Response "Datos inválidos"
+// @Failure 503 {object} utils.Response "Restablecimiento no disponible"
+// @Failure 500 {object} utils.Response "Error interno"
+// @Router /forgot-password [post]
+func (h *UserHandler) ForgotPassword(c *gin.Context) {
+	var req domain.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	if err := h.userUseCase.RequestPasswordReset(req.Email); err != nil {
+		if errors.Is(err, domain.ErrPasswordResetDisabled) {
+			utils.ErrorResponse(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		utils.InternalErrorResponse(c)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Si el email está registrado, recibirás las instrucciones para restablecer la contraseña", nil)
+}
+
+// @Summary Restablecer contraseña
+// @Description Fija una nueva contraseña con el token recibido. El token solo puede usarse una vez.
+// @Tags usuarios
+// @Accept json
+// @Produce json
+// @Param request body domain.ResetPasswordRequest true "Token y nueva contraseña"
+// @Success 200 {object} utils.Response "Contraseña restablecida"
+// @Failure 400 {object} utils.Response "Datos inválidos"
+// @Failure 422 {object} utils.Response "Token inválido o expirado"
+// @Failure 500 {object} utils.Response "Error interno"
+// @Router /reset-password [post]
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	var req domain.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	if err := h.userUseCase.ResetPassword(req.Token, req.NewPassword); err != nil {
+		errorResponse(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Contraseña restablecida con éxito", nil)
+}
+
+// @Summary Diagnosticar inicio de sesión
+// @Description Reporta el motivo real por el que un usuario no puede iniciar sesión (solo administradores)
+// @Tags usuarios
+// @Accept json
+// @Produce json
+// @Param diagnosis body domain.LoginDiagnosisRequest true "Email y contraseña opcional"
+// @Success 200 {object} utils.Response{data=domain.LoginDiagnosisResponse} "Diagnóstico"
+// @Failure 400 {object} utils.Response "Datos inválidos"
+// @Failure 500 {object} utils.Response "Error interno"
+// @Router /users/admin/diagnose-login [post]
+// @Security BearerAuth
+func (h *UserHandler) DiagnoseLogin(c *gin.Context) {
+	var req domain.LoginDiagnosisRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	diagnosis, err := h.userUseCase.DiagnoseLogin(&req)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		utils.ErrorResponse(c, http.StatusInternalServerError, publicError(err))
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Diagnóstico completado", diagnosis)
+}
+
+// businessRuleErrors son los errores del dominio que indican una solicitud bien formada
+// pero inválida según las reglas de negocio; se responden con 422
+var businessRuleErrors = []error{
+	domain.ErrEmailAlreadyRegistered,
+	domain.ErrInvalidUserStatus,
+	domain.ErrIncorrectOldPassword,
+	domain.ErrInvalidResetToken,
+	domain.ErrImportTooLarge,
+	domain.ErrInvalidVerifyToken,
+	domain.ErrUserNotArchived,
+	domain.ErrRestoreEmailInUse,
+	domain.ErrInvalidOTP,
+	domain.ErrTwoFactorNotEnabled,
+	domain.ErrTwoFactorEnabled,
+	domain.ErrPasswordConfirmation,
+	utils.ErrInvalidMetadata,
+	utils.ErrWeakPassword,
+}
+
+// publicErrors son los errores del dominio cuyo mensaje puede mostrarse al cliente
+var publicErrors = []error{
+	utils.ErrVersionConflict,
+	domain.ErrUserNotFound,
+	domain.ErrEmailAlreadyRegistered,
+	domain.ErrInvalidCredentials,
+	domain.ErrUserInactive,
+	domain.ErrIncorrectOldPassword,
+	domain.ErrInvalidUserStatus,
+	domain.ErrInvalidResetToken,
+	domain.ErrInvalidVerifyToken,
+	domain.ErrEmailNotVerified,
+	domain.ErrUserNotArchived,
+	domain.ErrRestoreEmailInUse,
+	domain.ErrInvalidOTP,
+	domain.ErrTwoFactorNotEnabled,
+	domain.ErrTwoFactorEnabled,
+	domain.ErrPasswordConfirmation,
+	domain.ErrInvalidPassword,
+	domain.ErrTwoFactorLocked,
+	domain.ErrPasswordResetDisabled,
+	domain.ErrEmailVerificationDisabled,
+	domain.ErrImportTooLarge,
+	domain.ErrOTPRequired,
+	utils.ErrInvalidMetadata,
+	utils.ErrWeakPassword,
+	utils.ErrInvalidCursor,
+}
+
+// publicError retorna el mensaje a exponer al cliente. Si el error envuelve un error conocido
+// del dominio, se usa solo su mensaje y se omite el contexto interno agregado por el caso de uso.
+// Los errores no clasificados (ej. de la base de datos) se registran y el cliente recibe un
+// mensaje genérico, para no exponer detalles internos.
+func publicError(err error) string {
+	// Los requisitos incumplidos de la contraseña se muestran completos
+	var weak *utils.PasswordStrengthError
+	if errors.As(err, &weak) {
+		return weak.Error()
+	}
+	for _, known := range publicErrors {
+		if errors.Is(err, known) {
+			return known.Error()
+		}
+	}
+	log.Printf("[ERROR] error no clasificado en la API de usuarios: %v", err)
+	return utils.InternalErrorMessage
+}
+
+// errorResponse responde con 404 si el usuario no existe, con 412 si la actualización condicional
+// no se aplicó, con 429 si la verificación en dos pasos está bloqueada por fallos, con 422 si err
+// viola una regla de negocio del dominio y con statusCode para el resto de errores conocidos. Los
+// errores no clasificados responden 500.
+func errorResponse(c *gin.Context, statusCode int, err error) {
+	if errors.Is(err, domain.ErrUserNotFound) {
+		utils.ErrorResponse(c, http.StatusNotFound, publicError(err))
 		return
 	}
+	if errors.Is(err, utils.ErrVersionConflict) {
+		utils.PreconditionFailedResponse(c, publicError(err))
+		return
+	}
+	if errors.Is(err, domain.ErrTwoFactorLocked) {
+		utils.ErrorResponse(c, http.StatusTooManyRequests, publicError(err))
+		return
+	}
+	for _, rule := range businessRuleErrors {
+		if errors.Is(err, rule) {
+			utils.UnprocessableEntityResponse(c, publicError(err))
+			return
+		}
+	}
+	if !isPublicError(err) {
+		statusCode = http.StatusInternalServerError
+	}
+	utils.ErrorResponse(c, statusCode, publicError(err))
+}
+
+// isPublicError indica si err envuelve un error del dominio cuyo mensaje ve el cliente
+func isPublicError(err error) bool {
+	var weak *utils.PasswordStrengthError
+	if errors.As(err, &weak) {
+		return true
+	}
+	for _, known := range publicErrors {
+		if errors.Is(err, known) {
+			return true
+		}
+	}
+	return false
+}
 
-	utils.SuccessResponse(c, http.StatusOK, "Perfil obtenido con éxito", user)
+// userForCaller oculta last_login_at y last_login_ip si el middleware de permisos no verificó
+// domain.AdminPermission para quien hace la petición: solo los administradores los ven
+func userForCaller(c *gin.Context, user *domain.UserResponse) *domain.UserResponse {
+	if user == nil || utils.HasGrantedPermission(c, domain.AdminPermission) {
+		return user
+	}
+	visible := *user
+	visible.LastLoginAt = nil
+	visible.LastLoginIP = ""
+	return &visible
+}
+
+// usersForCaller aplica userForCaller a cada usuario de un listado
+func usersForCaller(c *gin.Context, users []*domain.UserResponse) []*domain.UserResponse {
+	if utils.HasGrantedPermission(c, domain.AdminPermission) {
+		return users
+	}
+	visible := make([]*domain.UserResponse, len(users))
+	for i, user := range users {
+		visible[i] = userForCaller(c, user)
+	}
+	return visible
 }
@@ -4,18 +4,23 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	"github.com/black4ninja/mi-proyecto/internal/user/delivery"
 	"github.com/black4ninja/mi-proyecto/internal/user/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
 )
 
 // Caso de uso simulado (mock) para pruebas
@@ -39,9 +44,20 @@ func (m *MockUserUseCase) GetUserByEmail(email string) (*domain.User, error) {
 	return args.Get(0).(*domain.User), args.Error(1)
 }
 
-func (m *MockUserUseCase) GetAllUsers(filters bson.M) ([]*domain.UserResponse, error) {
-	args := m.Called(filters)
-	return args.Get(0).([]*domain.UserResponse), args.Error(1)
+func (m *MockUserUseCase) GetAllUsers(filters map[string]interface{}, skip, limit int64) (*domain.PaginatedResult, error) {
+	args := m.Called(filters, skip, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.PaginatedResult), args.Error(1)
+}
+
+func (m *MockUserUseCase) GetUsersAfter(filters map[string]interface{}, cursor string, limit int64) ([]*domain.UserResponse, string, error) {
+	args := m.Called(filters, cursor, limit)
+	if args.Get(0) == nil {
+		return nil, "", args.Error(2)
+	}
+	return args.Get(0).([]*domain.UserResponse), args.String(1), args.Error(2)
 }
 
 func (m *MockUserUseCase) CreateUser(req *domain.CreateUserRequest) (*domain.UserResponse, error) {
@@ -70,6 +86,34 @@ func (m *MockUserUseCase) ArchiveUser(id string) error {
 	return args.Error(0)
 }
 
+func (m *MockUserUseCase) DeleteOwnAccount(userID string, req *domain.DeleteAccountRequest) error {
+	args := m.Called(userID, req)
+	return args.Error(0)
+}
+
+func (m *MockUserUseCase) RestoreUser(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockUserUseCase) EnableTwoFactor(userID string) (*domain.TwoFactorSetup, error) {
+	args := m.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.TwoFactorSetup), args.Error(1)
+}
+
+func (m *MockUserUseCase) VerifyTwoFactor(userID string, code string) error {
+	args := m.Called(userID, code)
+	return args.Error(0)
+}
+
+func (m *MockUserUseCase) DisableTwoFactor(userID string, code string) error {
+	args := m.Called(userID, code)
+	return args.Error(0)
+}
+
 func (m *MockUserUseCase) ChangePassword(userID string, req *domain.ChangePasswordRequest) error {
 	args := m.Called(userID, req)
 	return args.Error(0)
@@ -88,6 +132,11 @@ func (m *MockUserUseCase) UpdateRefreshToken(userID string, refreshToken string)
 	return args.Error(0)
 }
 
+func (m *MockUserUseCase) RecordLogin(userID string, ip string) error {
+	args := m.Called(userID, ip)
+	return args.Error(0)
+}
+
 func (m *MockUserUseCase) GetUserByRefreshToken(refreshToken string) (*domain.User, error) {
 	args := m.Called(refreshToken)
 	if args.Get(0) == nil {
@@ -96,6 +145,47 @@ func (m *MockUserUseCase) GetUserByRefreshToken(refreshToken string) (*domain.Us
 	return args.Get(0).(*domain.User), args.Error(1)
 }
 
+func (m *MockUserUseCase) DiagnoseLogin(req *domain.LoginDiagnosisRequest) (*domain.LoginDiagnosisResponse, error) {
+	args := m.Called(req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.LoginDiagnosisResponse), args.Error(1)
+}
+
+func (m *MockUserUseCase) ReconcileRoleAssignments() (int, error) {
+	args := m.Called()
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockUserUseCase) ImportUsers(records []*domain.UserImportRecord) (*domain.UserImportResponse, error) {
+	args := m.Called(records)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.UserImportResponse), args.Error(1)
+}
+
+func (m *MockUserUseCase) VerifyEmail(token string) error {
+	args := m.Called(token)
+	return args.Error(0)
+}
+
+func (m *MockUserUseCase) ResendVerification(email string) error {
+	args := m.Called(email)
+	return args.Error(0)
+}
+
+func (m *MockUserUseCase) RequestPasswordReset(email string) error {
+	args := m.Called(email)
+	return args.Error(0)
+}
+
+func (m *MockUserUseCase) ResetPassword(token string, newPassword string) error {
+	args := m.Called(token, newPassword)
+	return args.Error(0)
+}
+
 // Configuración para pruebas HTTP
 func setupRouter() *gin.Engine {
 	gin.SetMode(gin.TestMode)
@@ -113,7 +203,8 @@ func TestCreateUserHandler(t *testing.T) {
 	userGroup := r.Group("/api/users")
 
 	// Registrar handler
-	delivery.NewUserHandler(userGroup, mockUseCase)
+	delivery.NewUserHandler(userGroup, mockUseCase, nil, nil)
+	delivery.NewUserManagementHandler(userGroup, mockUseCase, nil)
 
 	// Datos de prueba
 	createUserReq := domain.CreateUserRequest{
@@ -174,7 +265,8 @@ func TestGetUserHandler(t *testing.T) {
 	userGroup := r.Group("/api/users")
 
 	// Registrar handler
-	delivery.NewUserHandler(userGroup, mockUseCase)
+	delivery.NewUserHandler(userGroup, mockUseCase, nil, nil)
+	delivery.NewUserManagementHandler(userGroup, mockUseCase, nil)
 
 	// Datos de prueba
 	userID := primitive.NewObjectID()
@@ -226,13 +318,14 @@ func TestGetUserHandlerNotFound(t *testing.T) {
 	userGroup := r.Group("/api/users")
 
 	// Registrar handler
-	delivery.NewUserHandler(userGroup, mockUseCase)
+	delivery.NewUserHandler(userGroup, mockUseCase, nil, nil)
+	delivery.NewUserManagementHandler(userGroup, mockUseCase, nil)
 
 	// Datos de prueba
 	userID := primitive.NewObjectID().Hex()
 
 	// Configurar comportamiento esperado del mock
-	mockUseCase.On("GetUser", userID).Return(nil, errors.New("usuario no encontrado"))
+	mockUseCase.On("GetUser", userID).Return(nil, fmt.Errorf("obtener usuario %s: %w", userID, domain.ErrUserNotFound))
 
 	// Crear solicitud HTTP
 	req, _ := http.NewRequest("GET", "/api/users/"+userID, nil)
@@ -251,8 +344,1022 @@ func TestGetUserHandlerNotFound(t *testing.T) {
 
 	// Verificar estructura de respuesta
 	assert.Equal(t, "error", response["status"])
-	assert.Contains(t, response["error"], "no encontrado")
+	assert.Equal(t, "usuario no encontrado", response["error"])
 
 	// Verificar que se llamó al caso de uso como esperamos
 	mockUseCase.AssertExpectations(t)
 }
+
+func TestGetUserHandlerHidesInternalErrors(t *testing.T) {
+	mockUseCase := new(MockUserUseCase)
+	r := setupRouter()
+	delivery.NewUserHandler(r.Group("/api/users"), mockUseCase, nil, nil)
+
+	userID := primitive.NewObjectID().Hex()
+	mockUseCase.On("GetUser", userID).Return(nil, fmt.Errorf("obtener usuario %s: %w", userID,
+		errors.New("server selection error: mongo-1.interno:27017")))
+
+	req, _ := http.NewRequest("GET", "/api/users/"+userID, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, utils.InternalErrorMessage, response["error"])
+	assert.NotContains(t, w.Body.String(), "mongo-1")
+}
+
+func TestGetAllUsersHandlerClampsPageSize(t *testing.T) {
+	mockUseCase := new(MockUserUseCase)
+
+	r := setupRouter()
+	userGroup := r.Group("/api/users")
+	delivery.NewUserHandler(userGroup, mockUseCase, utils.NewPaginator(20, 50), nil)
+	delivery.NewUserManagementHandler(userGroup, mockUseCase, utils.NewPaginator(20, 50))
+
+	users := []*domain.UserResponse{{ID: primitive.NewObjectID().Hex(), Email: "test@example.com"}}
+	// Página 2 con el límite reducido a 50: skip=50, limit=50
+	mockUseCase.On("GetAllUsers", mock.Anything, int64(50), int64(50)).Return(&domain.PaginatedResult{Items: users, Total: 120}, nil)
+
+	req, _ := http.NewRequest("GET", "/api/users?limit=1000000&page=2", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	meta, ok := response["pagination"].(map[string]interface{})
+	assert.True(t, ok)
+	assert.Equal(t, float64(50), meta["limit"])
+	assert.Equal(t, float64(1000000), meta["requested_limit"])
+	assert.Equal(t, float64(50), meta["max_page_size"])
+	assert.Equal(t, true, meta["clamped"])
+	assert.Equal(t, float64(120), meta["total"])
+	assert.Equal(t, float64(3), meta["total_pages"])
+
+	mockUseCase.AssertExpectations(t)
+}
+
+func TestGetAllUsersHandlerMultiValueFilters(t *testing.T) {
+	mockUseCase := new(MockUserUseCase)
+
+	r := setupRouter()
+	userGroup := r.Group("/api/users")
+	delivery.NewUserHandler(userGroup, mockUseCase, nil, nil)
+	delivery.NewUserManagementHandler(userGroup, mockUseCase, nil)
+
+	expectedFilter := map[string]interface{}{
+		"status": bson.M{"$in": []interface{}{"active", "inactive"}},
+		"role":   bson.M{"$in": []interface{}{"admin", "moderator"}},
+	}
+	mockUseCase.On("GetAllUsers", mock.MatchedBy(func(filter map[string]interface{}) bool {
+		return assert.ObjectsAreEqual(expectedFilter, filter)
+	}), int64(0), int64(20)).Return(&domain.PaginatedResult{Items: []*domain.UserResponse{}}, nil)
+
+	// Se combinan la forma separada por coma y los parámetros repetidos
+	req, _ := http.NewRequest("GET", "/api/users?status=active,inactive&role=admin&role=moderator&role=superuser", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockUseCase.AssertExpectations(t)
+}
+
+func TestGetAllUsersHandlerMetadataFilter(t *testing.T) {
+	mockUseCase := new(MockUserUseCase)
+
+	r := setupRouter()
+	userGroup := r.Group("/api/users")
+	delivery.NewUserHandler(userGroup, mockUseCase, nil, nil)
+	delivery.NewUserManagementHandler(userGroup, mockUseCase, nil)
+
+	expectedFilter := map[string]interface{}{
+		"status":              "active",
+		"metadata.department": "ventas",
+	}
+	mockUseCase.On("GetAllUsers", mock.MatchedBy(func(filter map[string]interface{}) bool {
+		return assert.ObjectsAreEqual(expectedFilter, filter)
+	}), int64(0), int64(20)).Return(&domain.PaginatedResult{Items: []*domain.UserResponse{
+		{ID: "1", Email: "ventas@example.com", Metadata: map[string]interface{}{"department": "ventas"}},
+	}, Total: 1}, nil)
+
+	// Las claves con caracteres de operador se ignoran
+	req, _ := http.NewRequest("GET", "/api/users?metadata.department=ventas&metadata.$where=1", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"metadata":{"department":"ventas"}`)
+	mockUseCase.AssertExpectations(t)
+}
+
+func TestUserHandlerValidationStatusCodes(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		setup      func(m *MockUserUseCase)
+		wantStatus int
+	}{
+		{
+			name:       "JSON mal formado",
+			method:     "POST",
+			path:       "/api/users",
+			body:       `{"email": "test@example.com",`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "campo requerido ausente",
+			method:     "POST",
+			path:       "/api/users",
+			body:       `{"email": "test@example.com", "password": "password123"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "email duplicado",
+			method: "POST",
+			path:   "/api/users",
+			body:   `{"email": "test@example.com", "name": "Test", "password": "password123"}`,
+			setup: func(m *MockUserUseCase) {
+				m.On("CreateUser", mock.Anything).Return(nil, domain.ErrEmailAlreadyRegistered)
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "metadatos no válidos",
+			method: "POST",
+			path:   "/api/users",
+			body:   `{"email": "test@example.com", "name": "Test", "password": "password123"}`,
+			setup: func(m *MockUserUseCase) {
+				m.On("CreateUser", mock.Anything).Return(nil, fmt.Errorf("%w: clave no válida", utils.ErrInvalidMetadata))
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "estado no válido",
+			method: "PUT",
+			path:   "/api/users/" + primitive.NewObjectID().Hex(),
+			body:   `{"status": "eliminado"}`,
+			setup: func(m *MockUserUseCase) {
+				m.On("UpdateUser", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w: eliminado", domain.ErrInvalidUserStatus))
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "versión desactualizada",
+			method: "PUT",
+			path:   "/api/users/" + primitive.NewObjectID().Hex(),
+			body:   `{"name": "Otro", "expected_version": 2}`,
+			setup: func(m *MockUserUseCase) {
+				m.On("UpdateUser", mock.Anything, mock.MatchedBy(func(req *domain.UpdateUserRequest) bool {
+					return req.ExpectedVersion != nil && *req.ExpectedVersion == 2
+				})).Return(nil, utils.ErrVersionConflict)
+			},
+			wantStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:   "actualizar un usuario inexistente",
+			method: "PUT",
+			path:   "/api/users/" + primitive.NewObjectID().Hex(),
+			body:   `{"name": "Otro"}`,
+			setup: func(m *MockUserUseCase) {
+				m.On("UpdateUser", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("obtener usuario: %w", domain.ErrUserNotFound))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:   "eliminar un usuario inexistente",
+			method: "DELETE",
+			path:   "/api/users/123",
+			setup: func(m *MockUserUseCase) {
+				m.On("DeleteUser", "123").Return(fmt.Errorf("obtener usuario 123: %w", domain.ErrUserNotFound))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:   "archivar un usuario inexistente",
+			method: "PUT",
+			path:   "/api/users/123/archive",
+			setup: func(m *MockUserUseCase) {
+				m.On("ArchiveUser", "123").Return(fmt.Errorf("obtener usuario 123: %w", domain.ErrUserNotFound))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:   "errores no clasificados responden 500",
+			method: "PUT",
+			path:   "/api/users/" + primitive.NewObjectID().Hex(),
+			body:   `{"name": "Otro"}`,
+			setup: func(m *MockUserUseCase) {
+				m.On("UpdateUser", mock.Anything, mock.Anything).Return(nil, errors.New("connection refused"))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUseCase := new(MockUserUseCase)
+			if tt.setup != nil {
+				tt.setup(mockUseCase)
+			}
+
+			r := setupRouter()
+			delivery.NewUserHandler(r.Group("/api/users"), mockUseCase, nil, nil)
+			delivery.NewUserManagementHandler(r.Group("/api/users"), mockUseCase, nil)
+
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+
+			var response map[string]interface{}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, "error", response["status"])
+			mockUseCase.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUpdateUserHandlerSelfCannotChangeStatusOrRole(t *testing.T) {
+	id := primitive.NewObjectID().Hex()
+	tests := []struct {
+		name       string
+		context    map[string]interface{}
+		wantStatus string
+		wantRole   string
+	}{
+		{"el propio usuario", map[string]interface{}{utils.UserIDContextKey: id}, "", ""},
+		{"el propio usuario administrador", map[string]interface{}{
+			utils.UserIDContextKey:             id,
+			utils.GrantedPermissionsContextKey: []string{domain.AdminPermission},
+		}, "inactive", "admin"},
+		{"un administrador sobre otro usuario", map[string]interface{}{
+			utils.UserIDContextKey:             "admin-1",
+			utils.GrantedPermissionsContextKey: []string{domain.AdminPermission},
+		}, "inactive", "admin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUseCase := new(MockUserUseCase)
+			mockUseCase.On("UpdateUser", id, mock.MatchedBy(func(req *domain.UpdateUserRequest) bool {
+				return req.Name == "Nuevo" && req.Status == tt.wantStatus && req.Role == tt.wantRole
+			})).Return(&domain.UserResponse{ID: id}, nil)
+
+			r := setupRouter()
+			group := r.Group("/api/users", func(c *gin.Context) {
+				for key, value := range tt.context {
+					c.Set(key, value)
+				}
+			})
+			delivery.NewUserHandler(group, mockUseCase, nil, nil)
+
+			req, _ := http.NewRequest("PUT", "/api/users/"+id, bytes.NewBufferString(`{"name": "Nuevo", "status": "inactive", "role": "admin"}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			mockUseCase.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDeleteUserHandlerSelfRequiresAdmin(t *testing.T) {
+	id := primitive.NewObjectID().Hex()
+	tests := []struct {
+		name       string
+		context    map[string]interface{}
+		wantCode   int
+		wantDelete bool
+	}{
+		{"el propio usuario", map[string]interface{}{utils.UserIDContextKey: id}, http.StatusForbidden, false},
+		{"el propio usuario administrador", map[string]interface{}{
+			utils.UserIDContextKey:             id,
+			utils.GrantedPermissionsContextKey: []string{domain.AdminPermission},
+		}, http.StatusOK, true},
+		{"un administrador sobre otro usuario", map[string]interface{}{
+			utils.UserIDContextKey:             "admin-1",
+			utils.GrantedPermissionsContextKey: []string{domain.AdminPermission},
+		}, http.StatusOK, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUseCase := new(MockUserUseCase)
+			if tt.wantDelete {
+				mockUseCase.On("DeleteUser", id).Return(nil)
+			}
+
+			r := setupRouter()
+			group := r.Group("/api/users", func(c *gin.Context) {
+				for key, value := range tt.context {
+					c.Set(key, value)
+				}
+			})
+			delivery.NewUserHandler(group, mockUseCase, nil, nil)
+
+			req, _ := http.NewRequest("DELETE", "/api/users/"+id, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			mockUseCase.AssertExpectations(t)
+		})
+	}
+}
+
+func TestArchiveUserHandlerSelfRequiresAdmin(t *testing.T) {
+	id := primitive.NewObjectID().Hex()
+	tests := []struct {
+		name        string
+		granted     []string
+		wantCode    int
+		wantArchive bool
+	}{
+		{"el propio usuario", nil, http.StatusForbidden, false},
+		{"el propio usuario administrador", []string{domain.AdminPermission}, http.StatusOK, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUseCase := new(MockUserUseCase)
+			if tt.wantArchive {
+				mockUseCase.On("ArchiveUser", id).Return(nil)
+			}
+
+			r := setupRouter()
+			group := r.Group("/api/users", func(c *gin.Context) {
+				c.Set(utils.UserIDContextKey, id)
+				if tt.granted != nil {
+					c.Set(utils.GrantedPermissionsContextKey, tt.granted)
+				}
+			})
+			delivery.NewUserHandler(group, mockUseCase, nil, nil)
+
+			req, _ := http.NewRequest("PUT", "/api/users/"+id+"/archive", nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			mockUseCase.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetUserHandlerShowsLoginActivityToAdmins(t *testing.T) {
+	id := primitive.NewObjectID().Hex()
+	lastLogin := utils.NewTimestamp(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+
+	for name, tt := range map[string]struct {
+		granted   []string
+		wantLogin bool
+	}{
+		"el propio usuario": {nil, false},
+		"administrador":     {[]string{domain.AdminPermission}, true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mockUseCase := new(MockUserUseCase)
+			mockUseCase.On("GetUser", id).Return(&domain.UserResponse{ID: id, LastLoginAt: &lastLogin, LastLoginIP: "203.0.113.10"}, nil)
+
+			r := setupRouter()
+			group := r.Group("/api/users", func(c *gin.Context) {
+				c.Set(utils.UserIDContextKey, id)
+				if tt.granted != nil {
+					c.Set(utils.GrantedPermissionsContextKey, tt.granted)
+				}
+			})
+			delivery.NewUserHandler(group, mockUseCase, nil, nil)
+
+			req, _ := http.NewRequest("GET", "/api/users/"+id, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.wantLogin, strings.Contains(w.Body.String(), "203.0.113.10"))
+			assert.Equal(t, tt.wantLogin, strings.Contains(w.Body.String(), "last_login_at"))
+		})
+	}
+}
+
+func TestGetProfileHandlerRequiresUserID(t *testing.T) {
+	tests := []struct {
+		name       string
+		userID     interface{}
+		wantStatus int
+	}{
+		{name: "sin usuario en el contexto", wantStatus: http.StatusUnauthorized},
+		{name: "usuario con tipo incorrecto", userID: 123, wantStatus: http.StatusUnauthorized},
+		{name: "usuario autenticado", userID: "60f1e5e5e5e5e5e5e5e5e5e5", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUseCase := new(MockUserUseCase)
+			if tt.wantStatus == http.StatusOK {
+				mockUseCase.On("GetUser", tt.userID).Return(&domain.UserResponse{ID: tt.userID.(string)}, nil)
+			}
+
+			r := setupRouter()
+			group := r.Group("/api/users")
+			group.Use(func(c *gin.Context) {
+				if tt.userID != nil {
+					c.Set(utils.UserIDContextKey, tt.userID)
+				}
+			})
+			delivery.NewUserHandler(group, mockUseCase, nil, nil)
+			delivery.NewUserManagementHandler(group, mockUseCase, nil)
+
+			req, _ := http.NewRequest("GET", "/api/users/me", nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			mockUseCase.AssertExpectations(t)
+		})
+	}
+}
+
+func TestImportUsersHandler(t *testing.T) {
+	imported := &domain.UserImportResponse{Created: 1, Failed: 1}
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        []*domain.UserImportRecord
+		useCaseErr  error
+		wantStatus  int
+	}{
+		{
+			name:        "arreglo JSON",
+			contentType: "application/json",
+			body:        `[{"email":"ana@example.com","name":"Ana","password":"secreto123"},{"email":"mal","name":"Mal"}]`,
+			want: []*domain.UserImportRecord{
+				{Email: "ana@example.com", Name: "Ana", Password: "secreto123"},
+				{Email: "mal", Name: "Mal"},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "CSV con metadatos",
+			contentType: "text/csv; charset=utf-8",
+			body:        "Email,Name,Role,metadata.department\nana@example.com,Ana,moderator,ventas\nmal,Mal,,\n",
+			want: []*domain.UserImportRecord{
+				{Email: "ana@example.com", Name: "Ana", Role: "moderator", Metadata: map[string]interface{}{"department": "ventas"}},
+				{Email: "mal", Name: "Mal"},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "CSV con BOM",
+			contentType: "text/csv",
+			body:        "\ufeffemail,name\nana@example.com,Ana\n",
+			want:        []*domain.UserImportRecord{{Email: "ana@example.com", Name: "Ana"}},
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "CSV sin la columna email",
+			contentType: "text/csv",
+			body:        "name,password\nAna,secreto123\n",
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "CSV sin la columna name",
+			contentType: "text/csv",
+			body:        "email\nana@example.com\n",
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "CSV con columna desconocida",
+			contentType: "text/csv",
+			body:        "email,name,edad\nana@example.com,Ana,30\n",
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "importación vacía",
+			contentType: "application/json",
+			body:        `[]`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "demasiadas filas",
+			contentType: "application/json",
+			body:        `[{"email":"ana@example.com","name":"Ana"}]`,
+			want:        []*domain.UserImportRecord{{Email: "ana@example.com", Name: "Ana"}},
+			useCaseErr:  domain.ErrImportTooLarge,
+			wantStatus:  http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUseCase := new(MockUserUseCase)
+			if tt.want != nil {
+				if tt.useCaseErr != nil {
+					mockUseCase.On("ImportUsers", tt.want).Return(nil, tt.useCaseErr)
+				} else {
+					mockUseCase.On("ImportUsers", tt.want).Return(imported, nil)
+				}
+			}
+
+			r := setupRouter()
+			delivery.NewUserImportHandler(r.Group("/api/users"), mockUseCase)
+
+			req, _ := http.NewRequest("POST", "/api/users/import", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			mockUseCase.AssertExpectations(t)
+		})
+	}
+}
+
+func TestVerifyEmailHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		useCaseErr error
+		wantStatus int
+	}{
+		{name: "sin token", query: "", wantStatus: http.StatusBadRequest},
+		{name: "token inválido o expirado", query: "?token=abc", useCaseErr: domain.ErrInvalidVerifyToken, wantStatus: http.StatusUnprocessableEntity},
+		{name: "token vigente", query: "?token=abc", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUseCase := new(MockUserUseCase)
+			if tt.query != "" {
+				mockUseCase.On("VerifyEmail", "abc").Return(tt.useCaseErr)
+			}
+
+			r := setupRouter()
+			delivery.NewEmailVerificationHandler(r.Group("/api"), mockUseCase)
+
+			req, _ := http.NewRequest("GET", "/api/verify-email"+tt.query, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			mockUseCase.AssertExpectations(t)
+		})
+	}
+}
+
+func TestTwoFactorHandlers(t *testing.T) {
+	const userID = "60f1e5e5e5e5e5e5e5e5e5e5"
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		setup      func(m *MockUserUseCase)
+		wantStatus int
+	}{
+		{
+			name: "activar",
+			path: "/api/users/me/2fa",
+			setup: func(m *MockUserUseCase) {
+				m.On("EnableTwoFactor", userID).Return(&domain.TwoFactorSetup{Secret: "JBSWY3DPEHPK3PXP"}, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "activar con la verificación ya activa",
+			path: "/api/users/me/2fa",
+			setup: func(m *MockUserUseCase) {
+				m.On("EnableTwoFactor", userID).Return(nil, domain.ErrTwoFactorEnabled)
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "verificar",
+			path: "/api/users/me/2fa/verify",
+			body: `{"code":"123456"}`,
+			setup: func(m *MockUserUseCase) {
+				m.On("VerifyTwoFactor", userID, "123456").Return(nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "verificar con un código incorrecto",
+			path: "/api/users/me/2fa/verify",
+			body: `{"code":"000000"}`,
+			setup: func(m *MockUserUseCase) {
+				m.On("VerifyTwoFactor", userID, "000000").Return(domain.ErrInvalidOTP)
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "verificar con la verificación bloqueada",
+			path: "/api/users/me/2fa/verify",
+			body: `{"code":"123456"}`,
+			setup: func(m *MockUserUseCase) {
+				m.On("VerifyTwoFactor", userID, "123456").Return(domain.ErrTwoFactorLocked)
+			},
+			wantStatus: http.StatusTooManyRequests,
+		},
+		{
+			name:       "verificar sin código",
+			path:       "/api/users/me/2fa/verify",
+			body:       `{}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "desactivar sin la verificación activa",
+			path: "/api/users/me/2fa/disable",
+			body: `{"code":"123456"}`,
+			setup: func(m *MockUserUseCase) {
+				m.On("DisableTwoFactor", userID, "123456").Return(domain.ErrTwoFactorNotEnabled)
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUseCase := new(MockUserUseCase)
+			if tt.setup != nil {
+				tt.setup(mockUseCase)
+			}
+
+			r := setupRouter()
+			group := r.Group("/api/users")
+			group.Use(func(c *gin.Context) {
+				c.Set(utils.UserIDContextKey, userID)
+			})
+			delivery.NewUserHandler(group, mockUseCase, nil, nil)
+			delivery.NewUserManagementHandler(group, mockUseCase, nil)
+
+			req, _ := http.NewRequest("POST", tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			mockUseCase.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDeleteOwnAccountHandler(t *testing.T) {
+	const userID = "60f1e5e5e5e5e5e5e5e5e5e5"
+	tests := []struct {
+		name       string
+		body       string
+		useCaseErr error
+		wantStatus int
+	}{
+		{name: "contraseña confirmada", body: `{"password":"secreto123"}`, wantStatus: http.StatusOK},
+		{name: "contraseña incorrecta", body: `{"password":"otra"}`, useCaseErr: domain.ErrPasswordConfirmation, wantStatus: http.StatusUnprocessableEntity},
+		{name: "sin contraseña", body: `{}`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUseCase := new(MockUserUseCase)
+			if tt.body != `{}` {
+				mockUseCase.On("DeleteOwnAccount", userID, mock.AnythingOfType("*domain.DeleteAccountRequest")).Return(tt.useCaseErr)
+			}
+
+			r := setupRouter()
+			group := r.Group("/api/users")
+			group.Use(func(c *gin.Context) {
+				c.Set(utils.UserIDContextKey, userID)
+			})
+			delivery.NewUserHandler(group, mockUseCase, nil, nil)
+			delivery.NewUserManagementHandler(group, mockUseCase, nil)
+
+			req, _ := http.NewRequest("DELETE", "/api/users/me", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			mockUseCase.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRestoreUserHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		useCaseErr error
+		wantStatus int
+	}{
+		{name: "usuario archivado", wantStatus: http.StatusOK},
+		{name: "usuario inexistente", useCaseErr: domain.ErrUserNotFound, wantStatus: http.StatusNotFound},
+		{name: "usuario no archivado", useCaseErr: domain.ErrUserNotArchived, wantStatus: http.StatusUnprocessableEntity},
+		{name: "email en uso por otra cuenta", useCaseErr: domain.ErrRestoreEmailInUse, wantStatus: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUseCase := new(MockUserUseCase)
+			mockUseCase.On("RestoreUser", "123").Return(tt.useCaseErr)
+
+			r := setupRouter()
+			delivery.NewUserRestoreHandler(r.Group("/api/users"), mockUseCase)
+
+			req, _ := http.NewRequest("PUT", "/api/users/123/restore", nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			mockUseCase.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPasswordResetHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		setup      func(m *MockUserUseCase)
+		wantStatus int
+	}{
+		{
+			name:       "forgot-password con email inválido",
+			path:       "/api/forgot-password",
+			body:       `{"email":"no-es-email"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "forgot-password responde igual exista o no el email",
+			path: "/api/forgot-password",
+			body: `{"email":"nadie@example.com"}`,
+			setup: func(m *MockUserUseCase) {
+				m.On("RequestPasswordReset", "nadie@example.com").Return(nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "forgot-password sin sender configurado",
+			path: "/api/forgot-password",
+			body: `{"email":"usuario@example.com"}`,
+			setup: func(m *MockUserUseCase) {
+				m.On("RequestPasswordReset", "usuario@example.com").Return(domain.ErrPasswordResetDisabled)
+			},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name: "resend-verification responde igual exista o no el email",
+			path: "/api/resend-verification",
+			body: `{"email":"nadie@example.com"}`,
+			setup: func(m *MockUserUseCase) {
+				m.On("ResendVerification", "nadie@example.com").Return(nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "resend-verification sin verificación configurada",
+			path: "/api/resend-verification",
+			body: `{"email":"usuario@example.com"}`,
+			setup: func(m *MockUserUseCase) {
+				m.On("ResendVerification", "usuario@example.com").Return(domain.ErrEmailVerificationDisabled)
+			},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "reset-password sin contraseña",
+			path:       "/api/reset-password",
+			body:       `{"token":"abc"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			// La longitud la valida la política de contraseñas del caso de uso
+			name: "reset-password con contraseña débil",
+			path: "/api/reset-password",
+			body: `{"token":"abc","new_password":"123"}`,
+			setup: func(m *MockUserUseCase) {
+				m.On("ResetPassword", "abc", "123").Return(utils.ValidatePasswordStrength("123", utils.DefaultPasswordPolicy()))
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "reset-password con token expirado",
+			path: "/api/reset-password",
+			body: `{"token":"abc","new_password":"nueva123"}`,
+			setup: func(m *MockUserUseCase) {
+				m.On("ResetPassword", "abc", "nueva123").Return(domain.ErrInvalidResetToken)
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "reset-password correcto",
+			path: "/api/reset-password",
+			body: `{"token":"abc","new_password":"nueva123"}`,
+			setup: func(m *MockUserUseCase) {
+				m.On("ResetPassword", "abc", "nueva123").Return(nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUseCase := new(MockUserUseCase)
+			if tt.setup != nil {
+				tt.setup(mockUseCase)
+			}
+
+			r := setupRouter()
+			delivery.NewPasswordResetHandler(r.Group("/api"), mockUseCase)
+			delivery.NewVerificationResendHandler(r.Group("/api"), mockUseCase)
+
+			req, _ := http.NewRequest("POST", tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			mockUseCase.AssertExpectations(t)
+		})
+	}
+}
+
+func TestWeakPasswordResponse(t *testing.T) {
+	mockUseCase := new(MockUserUseCase)
+	policy := utils.PasswordPolicy{MinLength: 10, RequireSymbol: true}
+	mockUseCase.On("CreateUser", mock.Anything).Return(nil, utils.ValidatePasswordStrength("secreto123", policy))
+
+	r := setupRouter()
+	delivery.NewUserHandler(r.Group("/api/users"), mockUseCase, nil, nil)
+	delivery.NewUserManagementHandler(r.Group("/api/users"), mockUseCase, nil)
+
+	req, _ := http.NewRequest("POST", "/api/users", bytes.NewBufferString(`{"email":"nuevo@example.com","name":"Nuevo","password":"secreto123"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	// El cliente recibe todos los requisitos incumplidos, no solo el mensaje genérico
+	assert.Equal(t, "la contraseña debe incluir un símbolo", response["error"])
+	mockUseCase.AssertExpectations(t)
+}
+
+func TestRegisterHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantCode  int
+		wantError string
+	}{
+		{"registro exitoso", nil, http.StatusCreated, ""},
+		{"email ya registrado", fmt.Errorf("crear usuario: %w", domain.ErrEmailAlreadyRegistered), http.StatusUnprocessableEntity, domain.ErrEmailAlreadyRegistered.Error()},
+		{"contraseña débil", utils.ValidatePasswordStrength("secreto123", utils.PasswordPolicy{MinLength: 10, RequireSymbol: true}), http.StatusUnprocessableEntity, "la contraseña debe incluir un símbolo"},
+		{"error de la base de datos", fmt.Errorf("verificar email: %w", errors.New("connection refused")), http.StatusInternalServerError, utils.InternalErrorMessage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUseCase := new(MockUserUseCase)
+			// El registro público nunca omite la verificación de email
+			withoutSkip := mock.MatchedBy(func(req *domain.CreateUserRequest) bool { return !req.SkipVerification })
+			if tt.err != nil {
+				mockUseCase.On("CreateUser", withoutSkip).Return(nil, tt.err)
+			} else {
+				mockUseCase.On("CreateUser", withoutSkip).Return(&domain.UserResponse{ID: "user-1", Email: "nuevo@example.com"}, nil)
+			}
+
+			r := setupRouter()
+			delivery.NewRegistrationHandler(r.Group("/api"), mockUseCase)
+
+			req, _ := http.NewRequest("POST", "/api/register", bytes.NewBufferString(`{"email":"nuevo@example.com","name":"Nuevo","password":"secreto123","skip_verification":true}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantError != "" {
+				var response map[string]interface{}
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tt.wantError, response["error"])
+			}
+			mockUseCase.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUpdateUserIfUnmodifiedSince(t *testing.T) {
+	id := primitive.NewObjectID().Hex()
+	since := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	t.Run("la cabecera se pasa al caso de uso", func(t *testing.T) {
+		mockUseCase := new(MockUserUseCase)
+		mockUseCase.On("UpdateUser", id, mock.MatchedBy(func(req *domain.UpdateUserRequest) bool {
+			return req.UnmodifiedSince != nil && req.UnmodifiedSince.Equal(since)
+		})).Return(&domain.UserResponse{ID: id, Version: 4}, nil)
+
+		r := setupRouter()
+		delivery.NewUserHandler(r.Group("/api/users"), mockUseCase, nil, nil)
+		delivery.NewUserManagementHandler(r.Group("/api/users"), mockUseCase, nil)
+
+		req, _ := http.NewRequest("PUT", "/api/users/"+id, bytes.NewBufferString(`{"name": "Otro"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Unmodified-Since", since.Format(http.TimeFormat))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockUseCase.AssertExpectations(t)
+	})
+
+	t.Run("una fecha inválida se rechaza", func(t *testing.T) {
+		mockUseCase := new(MockUserUseCase)
+		r := setupRouter()
+		delivery.NewUserHandler(r.Group("/api/users"), mockUseCase, nil, nil)
+		delivery.NewUserManagementHandler(r.Group("/api/users"), mockUseCase, nil)
+
+		req, _ := http.NewRequest("PUT", "/api/users/"+id, bytes.NewBufferString(`{"name": "Otro"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Unmodified-Since", "ayer")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		mockUseCase.AssertNotCalled(t, "UpdateUser", mock.Anything, mock.Anything)
+	})
+}
+
+func TestGetAllUsersHandlerCursorPagination(t *testing.T) {
+	users := []*domain.UserResponse{{ID: primitive.NewObjectID().Hex(), Email: "test@example.com"}}
+
+	t.Run("primera página con cursor vacío", func(t *testing.T) {
+		mockUseCase := new(MockUserUseCase)
+		r := setupRouter()
+		delivery.NewUserHandler(r.Group("/api/users"), mockUseCase, utils.NewPaginator(20, 50), nil)
+		delivery.NewUserManagementHandler(r.Group("/api/users"), mockUseCase, utils.NewPaginator(20, 50))
+		mockUseCase.On("GetUsersAfter", mock.Anything, "", int64(10)).Return(users, "siguiente", nil)
+
+		req, _ := http.NewRequest("GET", "/api/users?cursor=&limit=10&page=3", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Meta utils.CursorMeta `json:"pagination"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, utils.CursorMeta{Limit: 10, RequestedLimit: 10, MaxPageSize: 50, NextCursor: "siguiente", HasMore: true}, response.Meta)
+		mockUseCase.AssertNotCalled(t, "GetAllUsers", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("última página", func(t *testing.T) {
+		mockUseCase := new(MockUserUseCase)
+		r := setupRouter()
+		delivery.NewUserHandler(r.Group("/api/users"), mockUseCase, nil, nil)
+		delivery.NewUserManagementHandler(r.Group("/api/users"), mockUseCase, nil)
+		mockUseCase.On("GetUsersAfter", mock.Anything, "abc", int64(20)).Return(users, "", nil)
+
+		req, _ := http.NewRequest("GET", "/api/users?cursor=abc", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"has_more":false`)
+		assert.NotContains(t, w.Body.String(), "next_cursor")
+	})
+
+	t.Run("cursor inválido", func(t *testing.T) {
+		mockUseCase := new(MockUserUseCase)
+		r := setupRouter()
+		delivery.NewUserHandler(r.Group("/api/users"), mockUseCase, nil, nil)
+		delivery.NewUserManagementHandler(r.Group("/api/users"), mockUseCase, nil)
+		mockUseCase.On("GetUsersAfter", mock.Anything, "roto", int64(20)).Return(nil, "", utils.ErrInvalidCursor)
+
+		req, _ := http.NewRequest("GET", "/api/users?cursor=roto", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), utils.ErrInvalidCursor.Error())
+	})
+}
+
+func TestUserHandlerLeavesManagementRoutesOut(t *testing.T) {
+	// El listado y la creación solo existen si se registran con NewUserManagementHandler, que main
+	// protege con admin:users
+	mockUseCase := new(MockUserUseCase)
+	r := setupRouter()
+	delivery.NewUserHandler(r.Group("/api/users"), mockUseCase, nil, nil)
+
+	for _, method := range []string{"GET", "POST"} {
+		req, _ := http.NewRequest(method, "/api/users", bytes.NewBufferString(`{}`))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code, method)
+	}
+	mockUseCase.AssertExpectations(t)
+}
@@ -1,8 +1,13 @@
 package domain
 
 import (
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"errors"
+	"strings"
 	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
 )
 
 // Constantes para el estado del usuario
@@ -10,81 +15,436 @@ const (
 	UserStatusActive   = "active"
 	UserStatusInactive = "inactive"
 	UserStatusArchived = "archived"
+	UserStatusPending  = "pending" // Registrado, pendiente de verificar el email
+)
+
+// AdminPermission es el permiso para administrar a otros usuarios: listarlos, crearlos y editar
+// su estado o rol
+const AdminPermission = "admin:users"
+
+// Errores comunes del módulo de usuarios. Los casos de uso los retornan directamente o
+// envueltos con fmt.Errorf("...: %w", err); compárelos con errors.Is.
+var (
+	ErrUserNotFound              = errors.New("usuario no encontrado")
+	ErrEmailAlreadyRegistered    = errors.New("el email ya está registrado")
+	ErrInvalidCredentials        = errors.New("credenciales inválidas")
+	ErrUserInactive              = errors.New("usuario inactivo")
+	ErrInvalidPassword           = errors.New("contraseña incorrecta")
+	ErrIncorrectOldPassword      = errors.New("contraseña antigua incorrecta")
+	ErrInvalidUserStatus         = errors.New("estado de usuario no válido")
+	ErrInvalidResetToken         = errors.New("token de restablecimiento inválido o expirado")
+	ErrPasswordResetDisabled     = errors.New("restablecimiento de contraseña no disponible")
+	ErrEmailVerificationDisabled = errors.New("verificación de email no disponible")
+	ErrImportTooLarge            = errors.New("la importación supera el máximo de filas permitido")
+	ErrEmailNotVerified          = errors.New("email no verificado")
+	ErrInvalidVerifyToken        = errors.New("token de verificación inválido o expirado")
+	ErrUserNotArchived           = errors.New("el usuario no está archivado")
+	ErrRestoreEmailInUse         = errors.New("otra cuenta activa ya usa el email del usuario archivado")
+	ErrOTPRequired               = errors.New("se requiere el código de verificación en dos pasos")
+	ErrInvalidOTP                = errors.New("código de verificación en dos pasos inválido")
+	ErrTwoFactorNotEnabled       = errors.New("la verificación en dos pasos no está configurada")
+	ErrTwoFactorEnabled          = errors.New("la verificación en dos pasos ya está activa")
+	ErrPasswordConfirmation      = errors.New("la contraseña de confirmación no es correcta")
+	ErrTwoFactorLocked           = errors.New("demasiados códigos de verificación inválidos; intente de nuevo más tarde")
+	ErrPasswordChangeRequired    = errors.New("debe cambiar la contraseña temporal: envíe new_password")
+	ErrPasswordUnchanged         = errors.New("la nueva contraseña debe ser distinta de la temporal")
+)
+
+// MaxUserImportRows es el máximo de filas aceptadas en una importación de usuarios
+const MaxUserImportRows = 1000
+
+// Resultados de cada fila de una importación de usuarios
+const (
+	UserImportCreated = "created"
+	UserImportFailed  = "failed"
 )
 
+// CredentialError es el error de ValidateCredentials cuando las credenciales no son válidas.
+// Su mensaje es siempre el de ErrInvalidCredentials para no revelar el motivo al cliente, pero
+// errors.Is reconoce tanto ErrInvalidCredentials como el motivo (ErrUserNotFound,
+// ErrUserInactive o ErrInvalidPassword) para que los llamadores internos lo registren.
+type CredentialError struct {
+	Reason error
+}
+
+// Error retorna el mensaje opaco de credenciales inválidas
+func (e *CredentialError) Error() string {
+	return ErrInvalidCredentials.Error()
+}
+
+// Is permite comparar el error con ErrInvalidCredentials
+func (e *CredentialError) Is(target error) bool {
+	return target == ErrInvalidCredentials
+}
+
+// Unwrap retorna el motivo del fallo
+func (e *CredentialError) Unwrap() error {
+	return e.Reason
+}
+
+// CredentialFailureReason traduce un error de ValidateCredentials al motivo usado en el
+// diagnóstico de inicio de sesión (not_found, inactive, bad_password, unverified, otp_required,
+// bad_otp) o "error" si
+// el fallo no se debe a las credenciales (ej. la base de datos no respondió)
+func CredentialFailureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrEmailNotVerified):
+		return LoginDiagnosisUnverified
+	case errors.Is(err, ErrUserNotFound):
+		return LoginDiagnosisNotFound
+	case errors.Is(err, ErrUserInactive):
+		return LoginDiagnosisInactive
+	case errors.Is(err, ErrInvalidPassword):
+		return LoginDiagnosisBadPassword
+	case errors.Is(err, ErrOTPRequired):
+		return LoginDiagnosisOTPRequired
+	case errors.Is(err, ErrInvalidOTP), errors.Is(err, ErrTwoFactorLocked):
+		return LoginDiagnosisBadOTP
+	case errors.Is(err, ErrPasswordChangeRequired), errors.Is(err, ErrPasswordUnchanged), errors.Is(err, utils.ErrWeakPassword):
+		return LoginDiagnosisPasswordChange
+	default:
+		return "error"
+	}
+}
+
+// IsValidUserStatus indica si status es uno de los estados de usuario conocidos
+func IsValidUserStatus(status string) bool {
+	switch status {
+	case UserStatusActive, UserStatusInactive, UserStatusArchived, UserStatusPending:
+		return true
+	}
+	return false
+}
+
+// NormalizeEmail retorna el email en minúsculas y sin espacios alrededor. Los emails se guardan
+// y se buscan normalizados, por lo que dos direcciones que solo difieren en mayúsculas son la misma cuenta.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
 // User representa la entidad de usuario
 // @Description Entidad completa de usuario
 type User struct {
-	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty" example:"60f1e5e5e5e5e5e5e5e5e5e5"`  // ID único del usuario
-	Email        string             `json:"email" bson:"email" example:"usuario@example.com"`            // Email del usuario
-	Name         string             `json:"name" bson:"name" example:"Juan Pérez"`                       // Nombre completo del usuario
-	Password     string             `json:"-" bson:"password"`                                           // Contraseña hasheada (no incluida en JSON)
-	Status       string             `json:"status" bson:"status" example:"active"`                       // Estado: active, inactive, archived
-	Role         string             `json:"role" bson:"role" example:"user"`                             // Rol del usuario
-	RefreshToken string             `json:"-" bson:"refresh_token,omitempty"`                            // Token de refresco (no incluido en JSON)
-	CreatedAt    time.Time          `json:"created_at" bson:"created_at" example:"2023-07-10T15:04:05Z"` // Fecha de creación
-	UpdatedAt    time.Time          `json:"updated_at" bson:"updated_at" example:"2023-07-10T15:04:05Z"` // Fecha de última actualización
-	ArchivedAt   *time.Time         `json:"archived_at,omitempty" bson:"archived_at,omitempty"`          // Fecha de archivado (si aplica)
+	ID                     primitive.ObjectID     `json:"id" bson:"_id,omitempty" example:"60f1e5e5e5e5e5e5e5e5e5e5"`  // ID único del usuario
+	Email                  string                 `json:"email" bson:"email" example:"usuario@example.com"`            // Email del usuario
+	Name                   string                 `json:"name" bson:"name" example:"Juan Pérez"`                       // Nombre completo del usuario
+	Password               string                 `json:"-" bson:"password"`                                           // Contraseña hasheada (no incluida en JSON)
+	Status                 string                 `json:"status" bson:"status" example:"active"`                       // Estado: active, inactive, archived, pending
+	Role                   string                 `json:"role" bson:"role" example:"user"`                             // Rol del usuario
+	RefreshToken           string                 `json:"-" bson:"refresh_token,omitempty"`                            // Token de refresco (no incluido en JSON)
+	PasswordResetToken     string                 `json:"-" bson:"password_reset_token,omitempty"`                     // Hash del token de restablecimiento de contraseña pendiente
+	PasswordResetExpiresAt *time.Time             `json:"-" bson:"password_reset_expires_at,omitempty"`                // Expiración del token de restablecimiento
+	VerifyToken            string                 `json:"-" bson:"verify_token,omitempty"`                             // Hash del token de verificación de email pendiente
+	VerifyExpiresAt        *time.Time             `json:"-" bson:"verify_expires_at,omitempty"`                        // Expiración del token de verificación
+	VerifySentAt           *time.Time             `json:"-" bson:"verify_sent_at,omitempty"`                           // Último envío del token de verificación
+	MustChangePassword     bool                   `json:"must_change_password" bson:"must_change_password,omitempty"`  // Debe cambiar la contraseña temporal asignada
+	CreatedAt              time.Time              `json:"created_at" bson:"created_at" example:"2023-07-10T15:04:05Z"` // Fecha de creación
+	UpdatedAt              time.Time              `json:"updated_at" bson:"updated_at" example:"2023-07-10T15:04:05Z"` // Fecha de última actualización
+	ArchivedAt             *time.Time             `json:"archived_at,omitempty" bson:"archived_at,omitempty"`          // Fecha de archivado (si aplica)
+	LastLoginAt            *time.Time             `json:"last_login_at,omitempty" bson:"last_login_at,omitempty"`      // Último inicio de sesión con contraseña
+	LastLoginIP            string                 `json:"last_login_ip,omitempty" bson:"last_login_ip,omitempty"`      // IP del cliente en el último inicio de sesión
+	Metadata               map[string]interface{} `json:"metadata,omitempty" bson:"metadata,omitempty"`                // Atributos personalizados (ej. departamento)
+	Version                int64                  `json:"version" bson:"version"`                                      // Versión para control de concurrencia optimista
+	TwoFactorSecret        string                 `json:"-" bson:"two_factor_secret,omitempty"`                        // Secreto TOTP (base32, cifrado); pendiente de confirmar mientras TwoFactorEnabled sea false
+	TwoFactorEnabled       bool                   `json:"two_factor_enabled" bson:"two_factor_enabled,omitempty"`      // El grant password exige un código TOTP
+	TwoFactorLastStep      int64                  `json:"-" bson:"two_factor_last_step,omitempty"`                     // Último periodo TOTP aceptado; sus códigos no se aceptan otra vez
+	TwoFactorFailures      int                    `json:"-" bson:"two_factor_failures,omitempty"`                      // Códigos inválidos consecutivos
+	TwoFactorLockedUntil   *time.Time             `json:"-" bson:"two_factor_locked_until,omitempty"`                  // Hasta cuándo se rechazan los códigos tras demasiados fallos
 }
 
 // CreateUserRequest representa la solicitud para crear un usuario
 type CreateUserRequest struct {
-	Email    string `json:"email" binding:"required,email"`
-	Name     string `json:"name" binding:"required"`
-	Password string `json:"password" binding:"required,min=6"`
-	Role     string `json:"role"`
+	Email    string                 `json:"email" binding:"required,email"`
+	Name     string                 `json:"name" binding:"required"`
+	Password string                 `json:"password" binding:"required"` // Validada con la política de contraseñas
+	Role     string                 `json:"role"`
+	Metadata map[string]interface{} `json:"metadata"` // Atributos personalizados opcionales
+
+	// SkipVerification crea el usuario activo sin verificar su email (solo administradores;
+	// el registro público lo ignora)
+	SkipVerification bool `json:"skip_verification"`
 }
 
 // UpdateUserRequest representa la solicitud para actualizar un usuario
 type UpdateUserRequest struct {
-	Name   string `json:"name"`
-	Email  string `json:"email" binding:"omitempty,email"`
-	Status string `json:"status"`
-	Role   string `json:"role"`
+	Name     string                 `json:"name"`
+	Email    string                 `json:"email" binding:"omitempty,email"`
+	Status   string                 `json:"status"`
+	Role     string                 `json:"role"`
+	Metadata map[string]interface{} `json:"metadata"` // Cambios de metadatos; una clave con null se elimina
+
+	// ExpectedVersion, si se indica, exige que el usuario guardado tenga esa versión (412 si no)
+	ExpectedVersion *int64 `json:"expected_version"`
+	// UnmodifiedSince se toma de la cabecera If-Unmodified-Since
+	UnmodifiedSince *time.Time `json:"-"`
 }
 
 // ChangePasswordRequest representa la solicitud para cambiar contraseña
 type ChangePasswordRequest struct {
 	OldPassword string `json:"old_password" binding:"required"`
-	NewPassword string `json:"new_password" binding:"required,min=6"`
+	NewPassword string `json:"new_password" binding:"required"` // Validada con la política de contraseñas
+}
+
+// DeleteAccountRequest representa la solicitud de un usuario para eliminar su propia cuenta
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"` // Contraseña actual, para confirmar la eliminación
+}
+
+// UserImportRecord representa una fila de la importación masiva de usuarios.
+// Sin password se genera una contraseña temporal y el usuario debe cambiarla.
+type UserImportRecord struct {
+	Email    string                 `json:"email" example:"usuario@example.com"`
+	Name     string                 `json:"name" example:"Juan Pérez"`
+	Password string                 `json:"password,omitempty"`
+	Role     string                 `json:"role,omitempty" example:"user"` // Rol por defecto: user. No asigna roles de permisos
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// UserImportResult es el resultado de una fila de la importación
+type UserImportResult struct {
+	Row               int    `json:"row" example:"1"`                                 // Número de fila (desde 1, sin contar el encabezado CSV)
+	Email             string `json:"email" example:"usuario@example.com"`             // Email de la fila
+	Status            string `json:"status" example:"created"`                        // created o failed
+	ID                string `json:"id,omitempty" example:"60f1e5e5e5e5e5e5e5e5e5e5"` // ID del usuario creado
+	TemporaryPassword string `json:"temporary_password,omitempty"`                    // Contraseña temporal generada (solo se muestra aquí)
+	Error             string `json:"error,omitempty" example:"el email ya está registrado"`
+}
+
+// UserImportResponse resume una importación masiva de usuarios
+// @Description Resultado por fila de la importación de usuarios
+type UserImportResponse struct {
+	Created int                 `json:"created" example:"8"`
+	Failed  int                 `json:"failed" example:"2"`
+	Results []*UserImportResult `json:"results"`
+}
+
+// ResendVerificationRequest representa la solicitud de reenvío del email de verificación
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ForgotPasswordRequest representa la solicitud de restablecimiento de contraseña
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest representa la solicitud para fijar una nueva contraseña con el token recibido
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"` // Validada con la política de contraseñas
+}
+
+// Constantes para el diagnóstico de inicio de sesión
+const (
+	LoginDiagnosisOK          = "ok"
+	LoginDiagnosisNotFound    = "not_found"
+	LoginDiagnosisInactive    = "inactive"
+	LoginDiagnosisBadPassword = "bad_password"
+	LoginDiagnosisUnverified  = "unverified"
+	LoginDiagnosisOTPRequired = "otp_required" // Contraseña correcta sin el código de verificación en dos pasos
+	LoginDiagnosisBadOTP      = "bad_otp"      // Contraseña correcta con un código de verificación inválido
+	// Contraseña temporal correcta sin una nueva contraseña válida
+	LoginDiagnosisPasswordChange = "password_change_required"
+)
+
+// LoginDiagnosisRequest representa la solicitud de diagnóstico de inicio de sesión
+type LoginDiagnosisRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password"` // Opcional: si se omite no se verifica la contraseña
+}
+
+// LoginDiagnosisResponse representa el motivo real por el que un inicio de sesión falla o tiene éxito
+// @Description Resultado del diagnóstico de inicio de sesión (solo administradores)
+type LoginDiagnosisResponse struct {
+	Email  string `json:"email" example:"usuario@example.com"` // Email consultado
+	Reason string `json:"reason" example:"inactive"`           // ok, not_found, inactive, bad_password, unverified
+	Status string `json:"status,omitempty" example:"archived"` // Estado actual del usuario (si existe)
 }
 
 // UserResponse representa la respuesta con datos de usuario
 // @Description Estructura de respuesta para información de usuario
 type UserResponse struct {
-	ID        string    `json:"id" example:"60f1e5e5e5e5e5e5e5e5e5e5"`     // ID único del usuario
-	Email     string    `json:"email" example:"usuario@example.com"`       // Email del usuario
-	Name      string    `json:"name" example:"Juan Pérez"`                 // Nombre completo del usuario
-	Status    string    `json:"status" example:"active"`                   // Estado: active, inactive, archived
-	Role      string    `json:"role" example:"user"`                       // Rol del usuario
-	CreatedAt time.Time `json:"created_at" example:"2023-07-10T15:04:05Z"` // Fecha de creación
-	UpdatedAt time.Time `json:"updated_at" example:"2023-07-10T15:04:05Z"` // Fecha de última actualización
+	ID                 string                 `json:"id" example:"60f1e5e5e5e5e5e5e5e5e5e5"`                                                 // ID único del usuario
+	Email              string                 `json:"email" example:"usuario@example.com"`                                                   // Email del usuario
+	Name               string                 `json:"name" example:"Juan Pérez"`                                                             // Nombre completo del usuario
+	Status             string                 `json:"status" example:"active"`                                                               // Estado: active, inactive, archived, pending
+	Role               string                 `json:"role" example:"user"`                                                                   // Rol del usuario
+	CreatedAt          utils.Timestamp        `json:"created_at" swaggertype:"string" format:"date-time" example:"2023-07-10T15:04:05.000Z"` // Fecha de creación
+	UpdatedAt          utils.Timestamp        `json:"updated_at" swaggertype:"string" format:"date-time" example:"2023-07-10T15:04:05.000Z"` // Fecha de última actualización
+	Metadata           map[string]interface{} `json:"metadata,omitempty"`                                                                    // Atributos personalizados
+	Version            int64                  `json:"version" example:"3"`                                                                   // Versión a enviar como expected_version al actualizar
+	MustChangePassword bool                   `json:"must_change_password,omitempty"`                                                        // Debe cambiar la contraseña temporal antes de seguir
+	LastLoginAt        *utils.Timestamp       `json:"last_login_at,omitempty" swaggertype:"string" format:"date-time"`                       // Último inicio de sesión con contraseña (solo lectura, solo para admin:users)
+	LastLoginIP        string                 `json:"last_login_ip,omitempty" example:"203.0.113.10"`                                        // IP del cliente en el último inicio de sesión (solo lectura, solo para admin:users)
+	TwoFactorEnabled   bool                   `json:"two_factor_enabled"`                                                                    // El inicio de sesión exige un código TOTP (solo lectura)
+}
+
+// PaginatedResult es una página de usuarios junto con el total de coincidencias del filtro,
+// para que el cliente pueda construir los controles de paginación
+type PaginatedResult struct {
+	Items []*UserResponse // Usuarios de la página solicitada
+	Total int64           // Total de usuarios que coinciden con el filtro
+}
+
+// TwoFactorSetup contiene el secreto TOTP recién generado para configurar la aplicación de autenticación
+// @Description Secreto y URI otpauth:// de la verificación en dos pasos
+type TwoFactorSetup struct {
+	Secret          string `json:"secret" example:"JBSWY3DPEHPK3PXP"`                                             // Secreto en base32 para ingresarlo a mano
+	ProvisioningURI string `json:"provisioning_uri" example:"otpauth://totp/mi-proyecto:usuario@example.com?..."` // URI para generar el código QR
+}
+
+// TwoFactorCodeRequest representa la solicitud con un código de verificación en dos pasos
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
 }
 
 // UserRepository define el contrato para la capa de persistencia
 type UserRepository interface {
 	GetByID(id string) (*User, error)
 	GetByEmail(email string) (*User, error)
-	GetAll(params map[string]interface{}) ([]*User, error)
+	GetPage(params map[string]interface{}, skip, limit int64) ([]*User, int64, error) // Página de resultados y total
+	// GetPageAfter obtiene hasta limit usuarios posteriores al cursor (nil = desde el inicio) en el
+	// orden utils.KeysetSort e indica si quedan más resultados
+	GetPageAfter(params map[string]interface{}, after *utils.KeysetCursor, limit int64) ([]*User, bool, error)
 	Create(user *User) error
+	// CreateMany inserta los usuarios en una escritura masiva no ordenada. Retorna el error de
+	// cada usuario en su misma posición (nil si se insertó); un email repetido da ErrEmailAlreadyRegistered
+	CreateMany(users []*User) ([]error, error)
+	GetExistingEmails(emails []string) (map[string]bool, error) // Emails de la lista que ya están registrados
 	Update(user *User) error
 	Delete(id string) error
 	Archive(id string) error
+	// Restore reactiva un usuario archivado; retorna ErrUserNotArchived si no lo está
+	Restore(id string) error
+	// EmailInUse indica si otro usuario no archivado usa el email, sin distinguir mayúsculas
+	EmailInUse(email string, excludeID string) (bool, error)
 	UpdateRefreshToken(userID string, refreshToken string) error
+	// UpdateLastLogin registra la fecha y la IP del último inicio de sesión sin modificar
+	// updated_at ni la versión: no es un cambio del usuario
+	UpdateLastLogin(userID string, at time.Time, ip string) error
 	GetByRefreshToken(refreshToken string) (*User, error)
+	ForEach(params map[string]interface{}, batchSize int, fn func(user *User) error) error // Iteración por lotes para tareas de mantenimiento
+	SetPasswordResetToken(userID string, tokenHash string, expiresAt time.Time) error
+	// ConsumePasswordResetToken reemplaza la contraseña del usuario con el token vigente (hash) y
+	// descarta el token en la misma operación; retorna ErrInvalidResetToken si no hay coincidencia
+	ConsumePasswordResetToken(tokenHash string, passwordHash string, now time.Time) (*User, error)
+	// ConsumeVerifyToken activa al usuario pendiente cuyo token de verificación vigente (hash)
+	// coincide y descarta el token; retorna ErrInvalidVerifyToken si no hay coincidencia
+	ConsumeVerifyToken(tokenHash string, now time.Time) (*User, error)
+	// RenewVerifyToken reemplaza el token de verificación del usuario pendiente si el último envío
+	// fue hace al menos cooldown; retorna false si el usuario no está pendiente o no pasó el cooldown
+	RenewVerifyToken(userID string, tokenHash string, expiresAt time.Time, now time.Time, cooldown time.Duration) (bool, error)
+	// SetTwoFactor guarda el secreto TOTP y si está activo; un secreto vacío elimina ambos
+	SetTwoFactor(userID string, secret string, enabled bool) error
+	// AcceptTwoFactorStep registra step como último periodo TOTP aceptado y reinicia los fallos,
+	// solo si es posterior al último registrado; retorna false si el código ya se había usado
+	AcceptTwoFactorStep(userID string, step int64) (bool, error)
+	// RecordTwoFactorFailure cuenta un código inválido; al llegar a maxAttempts bloquea la
+	// verificación hasta lockedUntil y reinicia la cuenta
+	RecordTwoFactorFailure(userID string, maxAttempts int, lockedUntil time.Time) error
 }
 
 // UserUseCase define el contrato para la capa de casos de uso
 type UserUseCase interface {
 	GetUser(id string) (*UserResponse, error)
 	GetUserByEmail(email string) (*User, error)
-	GetAllUsers(params map[string]interface{}) ([]*UserResponse, error)
+	// GetAllUsers obtiene una página de usuarios y el total de coincidencias del filtro
+	GetAllUsers(params map[string]interface{}, skip, limit int64) (*PaginatedResult, error)
+	GetUsersAfter(params map[string]interface{}, cursor string, limit int64) ([]*UserResponse, string, error) // Paginación por cursor; retorna el cursor siguiente
 	CreateUser(req *CreateUserRequest) (*UserResponse, error)
 	UpdateUser(id string, req *UpdateUserRequest) (*UserResponse, error)
 	DeleteUser(id string) error
 	ArchiveUser(id string) error
+	RestoreUser(id string) error // Reactiva un usuario archivado si su email no lo usa otra cuenta
 	ChangePassword(userID string, req *ChangePasswordRequest) error
 	ValidateCredentials(email string, password string) (*User, error)
 	UpdateRefreshToken(userID string, refreshToken string) error
+	RecordLogin(userID string, ip string) error // Registra un inicio de sesión exitoso (fecha e IP)
 	GetUserByRefreshToken(refreshToken string) (*User, error)
+	DiagnoseLogin(req *LoginDiagnosisRequest) (*LoginDiagnosisResponse, error)
+	ReconcileRoleAssignments() (int, error)                               // Crea las asignaciones de rol faltantes; retorna cuántas se crearon
+	ImportUsers(records []*UserImportRecord) (*UserImportResponse, error) // Crea los registros válidos y reporta el resultado por fila
+	VerifyEmail(token string) error                                       // Activa el usuario pendiente con un token de verificación vigente
+	ResendVerification(email string) error                                // No revela si el email existe: sin usuario pendiente o en cooldown no hace nada
+	RequestPasswordReset(email string) error                              // No revela si el email existe: sin usuario activo no hace nada
+	ResetPassword(token string, newPassword string) error
+	// EnableTwoFactor genera un secreto TOTP nuevo; la verificación queda activa al confirmar
+	// el primer código con VerifyTwoFactor
+	EnableTwoFactor(userID string) (*TwoFactorSetup, error)
+	VerifyTwoFactor(userID string, code string) error  // Valida un código TOTP; retorna ErrInvalidOTP si no corresponde
+	DisableTwoFactor(userID string, code string) error // Exige un código válido para desactivarla
+	// DeleteOwnAccount archiva la cuenta del propio usuario tras confirmar su contraseña y revoca
+	// sus sesiones y asignaciones de roles; retorna ErrPasswordConfirmation si no coincide
+	DeleteOwnAccount(userID string, req *DeleteAccountRequest) error
+}
+
+// EmailVerificationSender entrega al usuario recién registrado el token para verificar su
+// email. token es el valor en claro; solo se guarda su hash.
+type EmailVerificationSender interface {
+	SendEmailVerification(user *User, token string, expiresAt time.Time) error
+}
+
+// EmailVerificationSenderFunc permite usar una función como EmailVerificationSender
+type EmailVerificationSenderFunc func(user *User, token string, expiresAt time.Time) error
+
+// SendEmailVerification llama a f
+func (f EmailVerificationSenderFunc) SendEmailVerification(user *User, token string, expiresAt time.Time) error {
+	return f(user, token, expiresAt)
+}
+
+// PasswordResetSender entrega al usuario el token de restablecimiento de contraseña
+// (ej. por email). token es el valor en claro; solo se guarda su hash.
+type PasswordResetSender interface {
+	SendPasswordReset(user *User, token string, expiresAt time.Time) error
+}
+
+// PasswordResetSenderFunc permite usar una función como PasswordResetSender
+type PasswordResetSenderFunc func(user *User, token string, expiresAt time.Time) error
+
+// SendPasswordReset llama a f
+func (f PasswordResetSenderFunc) SendPasswordReset(user *User, token string, expiresAt time.Time) error {
+	return f(user, token, expiresAt)
+}
+
+// TokenRevoker revoca todas las sesiones de un usuario y retorna cuántas estaban activas.
+// Lo implementa el caso de uso de OAuth.
+type TokenRevoker interface {
+	RevokeUserTokens(userID string) (int64, error)
+}
+
+// TokenRevokerFunc permite usar una función como TokenRevoker
+type TokenRevokerFunc func(userID string) (int64, error)
+
+// RevokeUserTokens llama a f
+func (f TokenRevokerFunc) RevokeUserTokens(userID string) (int64, error) {
+	return f(userID)
+}
+
+// RoleAssignmentInitializer garantiza que un usuario tenga su documento de asignación de roles.
+// Lo implementa el caso de uso de roles de usuario del módulo de permisos.
+type RoleAssignmentInitializer interface {
+	EnsureUserRole(userID string) (bool, error)
+	EnsureUserRoles(userIDs []string) ([]string, error) // En lote; retorna los usuarios cuya asignación se creó
+}
+
+// RoleAssignmentRemover quita los roles y permisos asignados a un usuario: ClearUserRoles vacía la
+// asignación (cuentas archivadas) y DeleteUserRoles la elimina (usuarios borrados).
+// Lo implementa el caso de uso de roles de usuario del módulo de permisos.
+type RoleAssignmentRemover interface {
+	ClearUserRoles(userID string) error
+	DeleteUserRoles(userID string) error
+}
+
+// AccountDeletionRecorder recibe el evento de cada cuenta eliminada por su propio usuario
+// (ej. para registrarlo en la auditoría)
+type AccountDeletionRecorder interface {
+	RecordAccountDeletion(userID string)
+}
+
+// AccountDeletionRecorderFunc permite usar una función como AccountDeletionRecorder
+type AccountDeletionRecorderFunc func(userID string)
+
+// RecordAccountDeletion llama a f
+func (f AccountDeletionRecorderFunc) RecordAccountDeletion(userID string) {
+	f(userID)
 }
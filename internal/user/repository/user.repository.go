@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -11,6 +12,14 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"github.com/black4ninja/mi-proyecto/internal/user/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+const (
+	// defaultBatchSize es el tamaño de lote por defecto para ForEach
+	defaultBatchSize = 500
+	// maxBatchRetries es el número de reintentos por lote antes de abortar ForEach
+	maxBatchRetries = 3
 )
 
 type mongoUserRepository struct {
@@ -26,6 +35,72 @@ func NewMongoUserRepository(collection *mongo.Collection) domain.UserRepository
 	}
 }
 
+// EnsureUserIndexes crea el índice (created_at, _id) que usa la paginación por cursor de
+// GetPageAfter y el índice único sobre el email. Es idempotente; el índice de email falla si ya
+// hay usuarios con el mismo email, que deben resolverse antes.
+func EnsureUserIndexes(collection *mongo.Collection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Mismo orden que GetPage y GetPageAfter, para no ordenar cada página en memoria. Se crea
+	// aparte para que un email repetido no lo impida.
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("índice de paginación: %w", err)
+	}
+
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("índice único de email: %w", err)
+	}
+	return nil
+}
+
+// NormalizeStoredEmails pasa a minúsculas los emails guardados con mayúsculas antes de que se
+// normalizaran, para que las búsquedas (que usan el email normalizado) los encuentren. Retorna
+// cuántos se migraron y los IDs de los usuarios que no pudieron migrarse porque otro usuario ya tiene la
+// versión en minúsculas; esos duplicados deben resolverse a mano. Es idempotente.
+func NormalizeStoredEmails(collection *mongo.Collection) (int64, []string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.M{"email": bson.M{"$regex": "[A-Z]"}},
+		options.Find().SetProjection(bson.M{"email": 1}))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var migrated int64
+	var conflicts []string
+	for cursor.Next(ctx) {
+		var legacy domain.User
+		if err := cursor.Decode(&legacy); err != nil {
+			return migrated, conflicts, err
+		}
+		// El filtro por el valor anterior evita sobrescribir un email cambiado en paralelo
+		result, err := collection.UpdateOne(ctx,
+			bson.M{"_id": legacy.ID, "email": legacy.Email},
+			bson.M{"$set": bson.M{"email": domain.NormalizeEmail(legacy.Email)}},
+		)
+		if mongo.IsDuplicateKeyError(err) {
+			conflicts = append(conflicts, legacy.ID.Hex())
+			continue
+		}
+		if err != nil {
+			return migrated, conflicts, err
+		}
+		migrated += result.ModifiedCount
+	}
+
+	return migrated, conflicts, cursor.Err()
+}
+
 // GetByID obtiene un usuario por su ID
 func (r *mongoUserRepository) GetByID(id string) (*domain.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
@@ -40,7 +115,7 @@ func (r *mongoUserRepository) GetByID(id string) (*domain.User, error) {
 	err = r.collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&user)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("usuario no encontrado")
+			return nil, domain.ErrUserNotFound
 		}
 		return nil, err
 	}
@@ -57,7 +132,7 @@ func (r *mongoUserRepository) GetByEmail(email string) (*domain.User, error) {
 	err := r.collection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("usuario no encontrado")
+			return nil, domain.ErrUserNotFound
 		}
 		return nil, err
 	}
@@ -65,8 +140,8 @@ func (r *mongoUserRepository) GetByEmail(email string) (*domain.User, error) {
 	return &user, nil
 }
 
-// GetAll obtiene todos los usuarios que coincidan con los parámetros dados
-func (r *mongoUserRepository) GetAll(params map[string]interface{}) ([]*domain.User, error) {
+// GetPage obtiene una página de usuarios que coincidan con los parámetros y el total de coincidencias
+func (r *mongoUserRepository) GetPage(params map[string]interface{}, skip, limit int64) ([]*domain.User, int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
 
@@ -76,21 +151,67 @@ func (r *mongoUserRepository) GetAll(params map[string]interface{}) ([]*domain.U
 		filter[key] = value
 	}
 
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	opts := options.Find()
-	opts.SetSort(bson.M{"created_at": -1})
+	opts.SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+	opts.SetSkip(skip)
+	opts.SetLimit(limit)
 
 	cursor, err := r.collection.Find(ctx, filter, opts)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer cursor.Close(ctx)
 
 	var users []*domain.User
 	if err := cursor.All(ctx, &users); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return users, nil
+	return users, total, nil
+}
+
+// GetPageAfter obtiene una página de usuarios por cursor (keyset). En lugar de omitir documentos
+// con skip filtra por created_at e _id a partir del cursor, por lo que el costo no crece con la
+// profundidad de la página. Se lee un documento extra para saber si hay más resultados.
+func (r *mongoUserRepository) GetPageAfter(params map[string]interface{}, after *utils.KeysetCursor, limit int64) ([]*domain.User, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	// Construir filtro
+	filter := bson.M{}
+	for key, value := range params {
+		filter[key] = value
+	}
+	if after != nil {
+		// $and evita que el filtro del cursor reemplace un rango de created_at ya presente
+		filter = bson.M{"$and": []bson.M{filter, after.Filter()}}
+	}
+
+	opts := options.Find()
+	opts.SetSort(utils.KeysetSort)
+	opts.SetLimit(limit + 1)
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, false, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []*domain.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, false, err
+	}
+
+	hasMore := int64(len(users)) > limit
+	if hasMore {
+		users = users[:limit]
+	}
+	return users, hasMore, nil
 }
 
 // Create crea un nuevo usuario
@@ -100,30 +221,118 @@ func (r *mongoUserRepository) Create(user *domain.User) error {
 
 	user.ID = primitive.NewObjectID()
 	_, err := r.collection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return domain.ErrEmailAlreadyRegistered
+	}
 	return err
 }
 
-// Update actualiza un usuario existente
+// CreateMany inserta los usuarios con una escritura no ordenada: un documento rechazado (ej. por
+// el índice único de email) no impide insertar los demás
+func (r *mongoUserRepository) CreateMany(users []*domain.User) ([]error, error) {
+	errs := make([]error, len(users))
+	if len(users) == 0 {
+		return errs, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	documents := make([]interface{}, len(users))
+	for i, user := range users {
+		user.ID = primitive.NewObjectID()
+		documents[i] = user
+	}
+
+	_, err := r.collection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+	if err == nil {
+		return errs, nil
+	}
+
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || len(bulkErr.WriteErrors) == 0 {
+		return nil, err
+	}
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Index < 0 || writeErr.Index >= len(users) {
+			continue
+		}
+		if mongo.IsDuplicateKeyError(writeErr) {
+			errs[writeErr.Index] = domain.ErrEmailAlreadyRegistered
+		} else {
+			errs[writeErr.Index] = writeErr
+		}
+	}
+	return errs, nil
+}
+
+// GetExistingEmails retorna cuáles de los emails indicados ya pertenecen a un usuario
+func (r *mongoUserRepository) GetExistingEmails(emails []string) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	if len(emails) == 0 {
+		return existing, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	opts := options.Find().SetProjection(bson.M{"email": 1})
+	cursor, err := r.collection.Find(ctx, bson.M{"email": bson.M{"$in": emails}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var user domain.User
+		if err := cursor.Decode(&user); err != nil {
+			return nil, err
+		}
+		existing[user.Email] = true
+	}
+	return existing, cursor.Err()
+}
+
+// Update actualiza un usuario existente. Guarda el updated_at que fijó el caso de uso con su reloj.
 func (r *mongoUserRepository) Update(user *domain.User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
 
 	update := bson.M{
 		"$set": bson.M{
-			"name":       user.Name,
-			"email":      user.Email,
-			"status":     user.Status,
-			"role":       user.Role,
-			"updated_at": time.Now(),
+			"name":                 user.Name,
+			"email":                user.Email,
+			"password":             user.Password,
+			"status":               user.Status,
+			"role":                 user.Role,
+			"must_change_password": user.MustChangePassword,
+			"updated_at":           user.UpdatedAt,
 		},
+		"$inc": bson.M{utils.VersionField: 1},
 	}
 
-	_, err := r.collection.UpdateOne(
+	// Sin metadatos se elimina el subdocumento en lugar de guardarlo vacío
+	if len(user.Metadata) > 0 {
+		update["$set"].(bson.M)["metadata"] = user.Metadata
+	} else {
+		update["$unset"] = bson.M{"metadata": ""}
+	}
+
+	// Solo se actualiza si nadie más lo modificó desde que se leyó (misma versión)
+	result, err := r.collection.UpdateOne(
 		ctx,
-		bson.M{"_id": user.ID},
+		bson.M{"_id": user.ID, utils.VersionField: utils.VersionFilter(user.Version)},
 		update,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return utils.ErrVersionConflict
+	}
+
+	user.Version++
+	return nil
 }
 
 // Delete elimina un usuario
@@ -157,13 +366,68 @@ func (r *mongoUserRepository) Archive(id string) error {
 			"archived_at": now,
 			"updated_at":  now,
 		},
+		"$inc": bson.M{utils.VersionField: 1},
 	}
 
 	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": objID}, update)
 	return err
 }
 
-// UpdateRefreshToken actualiza el token de refresco de un usuario
+// Restore reactiva un usuario archivado. El filtro por estado evita reactivar un usuario
+// que otra solicitud ya restauró o que nunca estuvo archivado.
+func (r *mongoUserRepository) Restore(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"status":     domain.UserStatusActive,
+			"updated_at": time.Now(),
+		},
+		"$unset": bson.M{"archived_at": ""},
+		"$inc":   bson.M{utils.VersionField: 1},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objID, "status": domain.UserStatusArchived}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return domain.ErrUserNotArchived
+	}
+	return nil
+}
+
+// EmailInUse indica si un usuario no archivado distinto de excludeID tiene el email dado. Compara
+// sin distinguir mayúsculas: el índice único de email sí las distingue y pueden quedar emails
+// antiguos que NormalizeStoredEmails no pudo pasar a minúsculas.
+func (r *mongoUserRepository) EmailInUse(email string, excludeID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	filter := bson.M{
+		"email":  email,
+		"status": bson.M{"$ne": domain.UserStatusArchived},
+	}
+	if objID, err := primitive.ObjectIDFromHex(excludeID); err == nil {
+		filter["_id"] = bson.M{"$ne": objID}
+	}
+
+	opts := options.Count().SetLimit(1).SetCollation(&options.Collation{Locale: "en", Strength: 2})
+	count, err := r.collection.CountDocuments(ctx, filter, opts)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// UpdateRefreshToken actualiza el token de refresco de un usuario. Como UpdateLastLogin, no
+// modifica updated_at: cada inicio de sesión o refresco invalidaría If-Unmodified-Since.
 func (r *mongoUserRepository) UpdateRefreshToken(userID string, refreshToken string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
@@ -176,7 +440,6 @@ func (r *mongoUserRepository) UpdateRefreshToken(userID string, refreshToken str
 	update := bson.M{
 		"$set": bson.M{
 			"refresh_token": refreshToken,
-			"updated_at":    time.Now(),
 		},
 	}
 
@@ -184,6 +447,129 @@ func (r *mongoUserRepository) UpdateRefreshToken(userID string, refreshToken str
 	return err
 }
 
+// UpdateLastLogin registra el último inicio de sesión. No modifica updated_at ni la versión
+// para no invalidar las actualizaciones condicionales de los clientes.
+func (r *mongoUserRepository) UpdateLastLogin(userID string, at time.Time, ip string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"last_login_at": at,
+			"last_login_ip": ip,
+		},
+	}
+
+	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": objID}, update)
+	return err
+}
+
+// SetTwoFactor guarda el secreto TOTP del usuario y si la verificación en dos pasos está activa.
+// Con un secreto vacío elimina ambos campos.
+func (r *mongoUserRepository) SetTwoFactor(userID string, secret string, enabled bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"two_factor_secret":  secret,
+			"two_factor_enabled": enabled,
+			"updated_at":         time.Now(),
+		},
+	}
+	if secret == "" {
+		update = bson.M{
+			"$unset": bson.M{
+				"two_factor_secret":       "",
+				"two_factor_enabled":      "",
+				"two_factor_last_step":    "",
+				"two_factor_failures":     "",
+				"two_factor_locked_until": "",
+			},
+			"$set": bson.M{"updated_at": time.Now()},
+		}
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+// AcceptTwoFactorStep registra step como último periodo TOTP aceptado si es posterior al
+// guardado. El filtro hace la comprobación atómica: dos peticiones con el mismo código no
+// pueden aceptarse ambas.
+func (r *mongoUserRepository) AcceptTwoFactorStep(userID string, step int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return false, err
+	}
+
+	filter := bson.M{
+		"_id": objID,
+		"$or": bson.A{
+			bson.M{"two_factor_last_step": bson.M{"$lt": step}},
+			bson.M{"two_factor_last_step": bson.M{"$exists": false}},
+		},
+	}
+	update := bson.M{
+		"$set":   bson.M{"two_factor_last_step": step},
+		"$unset": bson.M{"two_factor_failures": "", "two_factor_locked_until": ""},
+	}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// RecordTwoFactorFailure incrementa los códigos inválidos del usuario y, al llegar a
+// maxAttempts, bloquea la verificación hasta lockedUntil y reinicia la cuenta. Usa una
+// actualización con pipeline para que el conteo y el bloqueo sean atómicos.
+func (r *mongoUserRepository) RecordTwoFactorFailure(userID string, maxAttempts int, lockedUntil time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+
+	failures := bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$two_factor_failures", 0}}, 1}}
+	locked := bson.M{"$gte": bson.A{failures, maxAttempts}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"two_factor_locked_until": bson.M{"$cond": bson.A{locked, lockedUntil, "$two_factor_locked_until"}},
+			"two_factor_failures":     bson.M{"$cond": bson.A{locked, 0, failures}},
+		}}},
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
 // GetByRefreshToken obtiene un usuario por su token de refresco
 func (r *mongoUserRepository) GetByRefreshToken(refreshToken string) (*domain.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
@@ -200,3 +586,192 @@ func (r *mongoUserRepository) GetByRefreshToken(refreshToken string) (*domain.Us
 
 	return &user, nil
 }
+
+// SetPasswordResetToken guarda el hash del token de restablecimiento y su expiración,
+// reemplazando cualquier token anterior
+func (r *mongoUserRepository) SetPasswordResetToken(userID string, tokenHash string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{
+		"$set": bson.M{
+			"password_reset_token":      tokenHash,
+			"password_reset_expires_at": expiresAt,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+// ConsumePasswordResetToken fija la nueva contraseña del usuario cuyo token vigente coincide y
+// elimina el token en la misma operación, de modo que solo puede usarse una vez
+func (r *mongoUserRepository) ConsumePasswordResetToken(tokenHash string, passwordHash string, now time.Time) (*domain.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	filter := bson.M{
+		"password_reset_token":      tokenHash,
+		"password_reset_expires_at": bson.M{"$gt": now},
+	}
+	update := bson.M{
+		"$set":   bson.M{"password": passwordHash, "updated_at": now},
+		"$unset": bson.M{"password_reset_token": "", "password_reset_expires_at": "", "must_change_password": ""},
+		"$inc":   bson.M{utils.VersionField: 1},
+	}
+
+	var user domain.User
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, domain.ErrInvalidResetToken
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// ConsumeVerifyToken activa al usuario pendiente cuyo token de verificación vigente coincide y
+// elimina el token en la misma operación
+func (r *mongoUserRepository) ConsumeVerifyToken(tokenHash string, now time.Time) (*domain.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	filter := bson.M{
+		"verify_token":      tokenHash,
+		"verify_expires_at": bson.M{"$gt": now},
+		"status":            domain.UserStatusPending,
+	}
+	update := bson.M{
+		"$set":   bson.M{"status": domain.UserStatusActive, "updated_at": now},
+		"$unset": bson.M{"verify_token": "", "verify_expires_at": "", "verify_sent_at": ""},
+		"$inc":   bson.M{utils.VersionField: 1},
+	}
+
+	var user domain.User
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, domain.ErrInvalidVerifyToken
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// RenewVerifyToken reemplaza el token de verificación del usuario pendiente y registra el envío,
+// solo si el anterior fue hace al menos cooldown (o no consta); retorna false en otro caso
+func (r *mongoUserRepository) RenewVerifyToken(userID string, tokenHash string, expiresAt time.Time, now time.Time, cooldown time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return false, err
+	}
+
+	filter := bson.M{
+		"_id":    objID,
+		"status": domain.UserStatusPending,
+		"$or": bson.A{
+			bson.M{"verify_sent_at": bson.M{"$lte": now.Add(-cooldown)}},
+			bson.M{"verify_sent_at": bson.M{"$exists": false}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{"verify_token": tokenHash, "verify_expires_at": expiresAt, "verify_sent_at": now},
+	}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// ForEach recorre los usuarios que coincidan con los parámetros en lotes ordenados por _id,
+// llamando a fn por cada uno. Cada lote es una consulta independiente (paginación por _id),
+// por lo que la memoria está acotada y un lote fallido se reintenta sin reiniciar el recorrido.
+// Si fn retorna un error, el recorrido se detiene y se retorna ese error.
+func (r *mongoUserRepository) ForEach(params map[string]interface{}, batchSize int, fn func(user *domain.User) error) error {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	baseFilter := bson.M{}
+	for key, value := range params {
+		baseFilter[key] = value
+	}
+
+	var lastID primitive.ObjectID
+	for {
+		filter := baseFilter
+		if !lastID.IsZero() {
+			filter = bson.M{"$and": []bson.M{baseFilter, {"_id": bson.M{"$gt": lastID}}}}
+		}
+
+		batch, err := r.findBatchWithRetry(filter, batchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, user := range batch {
+			if err := fn(user); err != nil {
+				return err
+			}
+		}
+
+		if len(batch) < batchSize {
+			return nil
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+}
+
+// findBatchWithRetry obtiene un lote de usuarios reintentando ante errores transitorios
+func (r *mongoUserRepository) findBatchWithRetry(filter bson.M, batchSize int) ([]*domain.User, error) {
+	var lastErr error
+	for attempt := 0; attempt < maxBatchRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+		}
+
+		batch, err := r.findBatch(filter, batchSize)
+		if err == nil {
+			return batch, nil
+		}
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// findBatch obtiene un único lote de usuarios ordenado por _id
+func (r *mongoUserRepository) findBatch(filter bson.M, batchSize int) ([]*domain.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"_id": 1}).SetLimit(int64(batchSize))
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []*domain.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
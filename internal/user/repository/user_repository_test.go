@@ -0,0 +1,471 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/black4ninja/mi-proyecto/internal/user/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// userDoc construye un documento de usuario tal como lo devolvería MongoDB
+func userDoc(email string) bson.D {
+	return bson.D{
+		{Key: "_id", Value: primitive.NewObjectID()},
+		{Key: "email", Value: email},
+		{Key: "status", Value: domain.UserStatusActive},
+	}
+}
+
+func TestForEachIteratesInBatches(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("recorre todos los lotes", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+
+		// Conjunto sembrado de 3 usuarios servido en lotes de 2
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, userDoc("a@example.com"), userDoc("b@example.com")),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, userDoc("c@example.com")),
+		)
+
+		var emails []string
+		err := repo.ForEach(nil, 2, func(user *domain.User) error {
+			emails = append(emails, user.Email)
+			return nil
+		})
+
+		require.NoError(mt, err)
+		assert.Equal(mt, []string{"a@example.com", "b@example.com", "c@example.com"}, emails)
+	})
+
+	mt.Run("reintenta un lote fallido", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+
+		mt.AddMockResponses(
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 11600, Message: "interrupted"}),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, userDoc("a@example.com")),
+		)
+
+		count := 0
+		err := repo.ForEach(nil, 2, func(user *domain.User) error {
+			count++
+			return nil
+		})
+
+		require.NoError(mt, err)
+		assert.Equal(mt, 1, count)
+	})
+
+	mt.Run("se detiene si el callback falla", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, userDoc("a@example.com"), userDoc("b@example.com")),
+		)
+
+		stop := errors.New("detener")
+		count := 0
+		err := repo.ForEach(nil, 2, func(user *domain.User) error {
+			count++
+			return stop
+		})
+
+		assert.ErrorIs(mt, err, stop)
+		assert.Equal(mt, 1, count)
+	})
+}
+
+func TestUpdateChecksVersion(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("incrementa la versión al actualizar", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(
+			bson.E{Key: "n", Value: 1},
+			bson.E{Key: "nModified", Value: 1},
+		))
+
+		updatedAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+		user := &domain.User{ID: primitive.NewObjectID(), Email: "a@example.com", Version: 2, UpdatedAt: updatedAt}
+		require.NoError(mt, repo.Update(user))
+		assert.Equal(mt, int64(3), user.Version)
+
+		started := mt.GetStartedEvent()
+		require.NotNil(mt, started)
+		update := started.Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(mt, int64(2), update.Lookup("q", "version").Int64())
+		assert.Equal(mt, int32(1), update.Lookup("u", "$inc", "version").Int32())
+		assert.True(mt, updatedAt.Equal(update.Lookup("u", "$set", "updated_at").Time()), "se guarda el updated_at del caso de uso")
+	})
+
+	mt.Run("una versión desactualizada no sobrescribe", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(
+			bson.E{Key: "n", Value: 0},
+			bson.E{Key: "nModified", Value: 0},
+		))
+
+		user := &domain.User{ID: primitive.NewObjectID(), Email: "a@example.com", Version: 1}
+		err := repo.Update(user)
+		assert.ErrorIs(mt, err, utils.ErrVersionConflict)
+		assert.Equal(mt, int64(1), user.Version)
+	})
+}
+
+func TestEnsureUserIndexes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("crea el índice de paginación y el de email", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+
+		require.NoError(mt, EnsureUserIndexes(mt.Coll))
+
+		events := mt.GetAllStartedEvents()
+		require.Len(mt, events, 2)
+		// El índice sigue el orden de la paginación por cursor
+		pagination := events[0].Command.Lookup("indexes").Array().Index(0).Value().Document()
+		assert.Equal(mt, int32(-1), pagination.Lookup("key", "created_at").Int32())
+		assert.Equal(mt, int32(-1), pagination.Lookup("key", "_id").Int32())
+		email := events[1].Command.Lookup("indexes").Array().Index(0).Value().Document()
+		assert.Equal(mt, int32(1), email.Lookup("key", "email").Int32())
+		assert.True(mt, email.Lookup("unique").Boolean())
+	})
+
+	mt.Run("un email repetido no impide el índice de paginación", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 11000, Message: "E11000 duplicate key"}),
+		)
+
+		err := EnsureUserIndexes(mt.Coll)
+		assert.ErrorContains(mt, err, "email")
+		assert.Len(mt, mt.GetAllStartedEvents(), 2)
+	})
+}
+
+func TestGetPageAfter(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("filtra por el cursor sin skip y detecta si hay más resultados", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+
+		// limit 2: el repositorio pide 3 documentos para saber si hay otra página
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch,
+			userDoc("a@example.com"), userDoc("b@example.com"), userDoc("c@example.com")))
+
+		createdAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+		after := utils.NewKeysetCursor(createdAt, primitive.NewObjectID())
+		users, hasMore, err := repo.GetPageAfter(map[string]interface{}{"status": domain.UserStatusActive}, &after, 2)
+
+		require.NoError(mt, err)
+		assert.True(mt, hasMore)
+		require.Len(mt, users, 2)
+		assert.Equal(mt, "b@example.com", users[1].Email)
+
+		command := mt.GetStartedEvent().Command
+		assert.Equal(mt, int64(3), command.Lookup("limit").Int64())
+		_, hasSkip := command.Lookup("skip").Int64OK()
+		assert.False(mt, hasSkip)
+
+		sort := command.Lookup("sort").Document()
+		assert.Equal(mt, int32(-1), sort.Lookup("created_at").Int32())
+		assert.Equal(mt, int32(-1), sort.Lookup("_id").Int32())
+
+		// El filtro del cursor se combina con $and sin reemplazar los filtros existentes
+		and := command.Lookup("filter", "$and").Array()
+		assert.Equal(mt, domain.UserStatusActive, and.Index(0).Value().Document().Lookup("status").StringValue())
+		keyset := and.Index(1).Value().Document().Lookup("$or").Array()
+		assert.Equal(mt, after.ID, keyset.Index(1).Value().Document().Lookup("_id", "$lt").ObjectID())
+	})
+
+	mt.Run("última página sin cursor", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, userDoc("a@example.com")))
+
+		users, hasMore, err := repo.GetPageAfter(map[string]interface{}{}, nil, 2)
+
+		require.NoError(mt, err)
+		assert.False(mt, hasMore)
+		assert.Len(mt, users, 1)
+		_, hasAnd := mt.GetStartedEvent().Command.Lookup("filter").Document().Lookup("$and").ArrayOK()
+		assert.False(mt, hasAnd)
+	})
+}
+
+func TestConsumePasswordResetToken(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("exige un token vigente y lo descarta", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "value", Value: userDoc("a@example.com")},
+		})
+		now := time.Now().Truncate(time.Millisecond)
+
+		user, err := repo.ConsumePasswordResetToken("hash-token", "hash-password", now)
+		require.NoError(mt, err)
+		assert.Equal(mt, "a@example.com", user.Email)
+
+		command := mt.GetStartedEvent().Command
+		assert.Equal(mt, "hash-token", command.Lookup("query", "password_reset_token").StringValue())
+		assert.True(mt, now.Equal(command.Lookup("query", "password_reset_expires_at", "$gt").Time()))
+		assert.Equal(mt, "hash-password", command.Lookup("update", "$set", "password").StringValue())
+		_, err = command.Lookup("update", "$unset").Document().LookupErr("password_reset_token")
+		assert.NoError(mt, err)
+	})
+
+	mt.Run("token inexistente o expirado", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: nil}})
+
+		_, err := repo.ConsumePasswordResetToken("hash-token", "hash-password", time.Now())
+		assert.ErrorIs(mt, err, domain.ErrInvalidResetToken)
+	})
+}
+
+func TestUpdateLastLogin(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("registra fecha e IP sin modificar la versión", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		at := time.Now().Truncate(time.Millisecond)
+
+		require.NoError(mt, repo.UpdateLastLogin(primitive.NewObjectID().Hex(), at, "203.0.113.10"))
+
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+		assert.True(mt, at.Equal(update.Lookup("$set", "last_login_at").Time()))
+		assert.Equal(mt, "203.0.113.10", update.Lookup("$set", "last_login_ip").StringValue())
+		_, err := update.Lookup("$set").Document().LookupErr("updated_at")
+		assert.Error(mt, err, "un inicio de sesión no es una modificación del usuario")
+		_, err = update.LookupErr("$inc")
+		assert.Error(mt, err)
+	})
+}
+
+func TestUpdateRefreshToken(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("guarda el token sin modificar updated_at", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		require.NoError(mt, repo.UpdateRefreshToken(primitive.NewObjectID().Hex(), "hash-token"))
+
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+		assert.Equal(mt, "hash-token", update.Lookup("$set", "refresh_token").StringValue())
+		_, err := update.Lookup("$set").Document().LookupErr("updated_at")
+		assert.Error(mt, err, "un inicio de sesión no es una modificación del usuario")
+	})
+}
+
+func TestRestore(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("reactiva solo usuarios archivados", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		require.NoError(mt, repo.Restore(primitive.NewObjectID().Hex()))
+
+		statement := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(mt, domain.UserStatusArchived, statement.Lookup("q", "status").StringValue())
+		update := statement.Lookup("u").Document()
+		assert.Equal(mt, domain.UserStatusActive, update.Lookup("$set", "status").StringValue())
+		_, err := update.Lookup("$unset").Document().LookupErr("archived_at")
+		assert.NoError(mt, err)
+		assert.Equal(mt, int32(1), update.Lookup("$inc", utils.VersionField).Int32())
+	})
+
+	mt.Run("sin coincidencia el usuario no estaba archivado", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+
+		assert.ErrorIs(mt, repo.Restore(primitive.NewObjectID().Hex()), domain.ErrUserNotArchived)
+	})
+}
+
+func TestEmailInUse(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("compara sin distinguir mayúsculas y excluye archivados y al propio usuario", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.users", mtest.FirstBatch, bson.D{{Key: "n", Value: int32(1)}}))
+
+		excludeID := primitive.NewObjectID()
+		inUse, err := repo.EmailInUse("compartido@example.com", excludeID.Hex())
+		require.NoError(mt, err)
+		assert.True(mt, inUse)
+
+		command := mt.GetStartedEvent().Command
+		match := command.Lookup("pipeline").Array().Index(0).Value().Document().Lookup("$match").Document()
+		assert.Equal(mt, "compartido@example.com", match.Lookup("email").StringValue())
+		assert.Equal(mt, domain.UserStatusArchived, match.Lookup("status", "$ne").StringValue())
+		assert.Equal(mt, excludeID, match.Lookup("_id", "$ne").ObjectID())
+		assert.Equal(mt, int32(2), command.Lookup("collation", "strength").Int32())
+	})
+}
+
+func TestCreateManyReportsRejectedRows(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("un email repetido no impide insertar los demás", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{
+			Index:   1,
+			Code:    11000,
+			Message: "E11000 duplicate key error collection: users index: email_1",
+		}))
+		users := []*domain.User{{Email: "a@example.com"}, {Email: "b@example.com"}, {Email: "c@example.com"}}
+
+		errs, err := repo.CreateMany(users)
+		require.NoError(mt, err)
+		require.Len(mt, errs, 3)
+		assert.NoError(mt, errs[0])
+		assert.ErrorIs(mt, errs[1], domain.ErrEmailAlreadyRegistered)
+		assert.NoError(mt, errs[2])
+
+		command := mt.GetStartedEvent().Command
+		assert.False(mt, command.Lookup("ordered").Boolean(), "la escritura masiva no debe detenerse en el primer error")
+		documents, err := command.Lookup("documents").Array().Values()
+		require.NoError(mt, err)
+		assert.Len(mt, documents, 3)
+	})
+}
+
+func TestConsumeVerifyToken(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("activa solo usuarios pendientes con el token vigente", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "value", Value: userDoc("a@example.com")},
+		})
+		now := time.Now().Truncate(time.Millisecond)
+
+		_, err := repo.ConsumeVerifyToken("hash-token", now)
+		require.NoError(mt, err)
+
+		command := mt.GetStartedEvent().Command
+		assert.Equal(mt, "hash-token", command.Lookup("query", "verify_token").StringValue())
+		assert.Equal(mt, domain.UserStatusPending, command.Lookup("query", "status").StringValue())
+		assert.True(mt, now.Equal(command.Lookup("query", "verify_expires_at", "$gt").Time()))
+		assert.Equal(mt, domain.UserStatusActive, command.Lookup("update", "$set", "status").StringValue())
+	})
+
+	mt.Run("token inexistente o expirado", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: nil}})
+
+		_, err := repo.ConsumeVerifyToken("hash-token", time.Now())
+		assert.ErrorIs(mt, err, domain.ErrInvalidVerifyToken)
+	})
+}
+
+func TestRenewVerifyToken(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	userID := primitive.NewObjectID().Hex()
+	now := time.Now().Truncate(time.Millisecond)
+
+	mt.Run("renueva el token fuera del cooldown", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}})
+
+		renewed, err := repo.RenewVerifyToken(userID, "hash-token", now.Add(24*time.Hour), now, 5*time.Minute)
+		require.NoError(mt, err)
+		assert.True(mt, renewed)
+
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(mt, domain.UserStatusPending, update.Lookup("q", "status").StringValue())
+		cutoff := update.Lookup("q", "$or").Array().Index(0).Value().Document().Lookup("verify_sent_at", "$lte").Time()
+		assert.True(mt, now.Add(-5*time.Minute).Equal(cutoff))
+		assert.Equal(mt, "hash-token", update.Lookup("u", "$set", "verify_token").StringValue())
+		assert.True(mt, now.Equal(update.Lookup("u", "$set", "verify_sent_at").Time()))
+	})
+
+	mt.Run("dentro del cooldown no modifica nada", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 0}, {Key: "nModified", Value: 0}})
+
+		renewed, err := repo.RenewVerifyToken(userID, "hash-token", now.Add(24*time.Hour), now, 5*time.Minute)
+		require.NoError(mt, err)
+		assert.False(mt, renewed)
+	})
+}
+
+func TestNormalizeStoredEmails(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("pasa a minúsculas y reporta los que ya existen en minúsculas", func(mt *mtest.T) {
+		migratedID := primitive.NewObjectID()
+		conflictID := primitive.NewObjectID()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.users", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: migratedID}, {Key: "email", Value: "Ana@Example.com"}},
+				bson.D{{Key: "_id", Value: conflictID}, {Key: "email", Value: "LUIS@example.com"}},
+			),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{
+				Index:   0,
+				Code:    11000,
+				Message: "E11000 duplicate key error collection: users index: email_1",
+			}),
+		)
+
+		migrated, conflicts, err := NormalizeStoredEmails(mt.Coll)
+		require.NoError(mt, err)
+		assert.Equal(mt, int64(1), migrated)
+		assert.Equal(mt, []string{conflictID.Hex()}, conflicts)
+
+		events := mt.GetAllStartedEvents()
+		require.Len(mt, events, 3)
+		update := events[1].Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(mt, "Ana@Example.com", update.Lookup("q", "email").StringValue())
+		assert.Equal(mt, "ana@example.com", update.Lookup("u", "$set", "email").StringValue())
+	})
+}
+
+func TestAcceptTwoFactorStep(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("solo acepta un periodo posterior al último", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		accepted, err := repo.AcceptTwoFactorStep(primitive.NewObjectID().Hex(), 42)
+		require.NoError(mt, err)
+		assert.True(mt, accepted)
+
+		statement := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		condition := statement.Lookup("q", "$or").Array().Index(0).Value().Document()
+		assert.Equal(mt, int64(42), condition.Lookup("two_factor_last_step", "$lt").Int64())
+		update := statement.Lookup("u").Document()
+		assert.Equal(mt, int64(42), update.Lookup("$set", "two_factor_last_step").Int64())
+		_, err = update.Lookup("$unset").Document().LookupErr("two_factor_failures")
+		assert.NoError(mt, err)
+	})
+
+	mt.Run("sin coincidencia el código ya se usó", func(mt *mtest.T) {
+		repo := NewMongoUserRepository(mt.Coll)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+
+		accepted, err := repo.AcceptTwoFactorStep(primitive.NewObjectID().Hex(), 42)
+		require.NoError(mt, err)
+		assert.False(mt, accepted)
+	})
+}
@@ -0,0 +1,407 @@
+package usecase
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/black4ninja/mi-proyecto/internal/user/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// fakeUserRepo es un repositorio de usuarios en memoria para pruebas.
+// Si err está definido, las búsquedas por ID y email fallan con ese error.
+type fakeUserRepo struct {
+	users map[string]*domain.User
+	err   error
+}
+
+func newFakeUserRepo(users ...*domain.User) *fakeUserRepo {
+	repo := &fakeUserRepo{users: make(map[string]*domain.User)}
+	for _, user := range users {
+		if user.ID.IsZero() {
+			user.ID = primitive.NewObjectID()
+		}
+		repo.users[user.ID.Hex()] = user
+	}
+	return repo
+}
+
+func (r *fakeUserRepo) GetByID(id string) (*domain.User, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	user, ok := r.users[id]
+	if !ok {
+		return nil, domain.ErrUserNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (r *fakeUserRepo) GetByEmail(email string) (*domain.User, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	for _, user := range r.users {
+		if user.Email == email {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, domain.ErrUserNotFound
+}
+
+// matching filtra en memoria por status, el único parámetro que usan las pruebas
+func (r *fakeUserRepo) matching(params map[string]interface{}) ([]*domain.User, error) {
+	var users []*domain.User
+	for _, user := range r.users {
+		if status, ok := params["status"].(string); ok && user.Status != status {
+			continue
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func (r *fakeUserRepo) GetPage(params map[string]interface{}, skip, limit int64) ([]*domain.User, int64, error) {
+	users, _ := r.matching(params)
+	total := int64(len(users))
+	if skip >= total {
+		return nil, total, nil
+	}
+	end := skip + limit
+	if end > total {
+		end = total
+	}
+	return users[skip:end], total, nil
+}
+
+// GetPageAfter aplica en memoria el mismo orden (created_at e _id descendentes) y la misma
+// condición de cursor que el repositorio de MongoDB
+func (r *fakeUserRepo) GetPageAfter(params map[string]interface{}, after *utils.KeysetCursor, limit int64) ([]*domain.User, bool, error) {
+	users, _ := r.matching(params)
+	sort.Slice(users, func(i, j int) bool {
+		return keysetBefore(users[i], users[j].CreatedAt, users[j].ID)
+	})
+
+	var page []*domain.User
+	for _, user := range users {
+		if after != nil && !keysetBefore(&domain.User{CreatedAt: after.CreatedAt, ID: after.ID}, user.CreatedAt, user.ID) {
+			continue
+		}
+		page = append(page, user)
+	}
+
+	if int64(len(page)) > limit {
+		return page[:limit], true, nil
+	}
+	return page, false, nil
+}
+
+// keysetBefore indica si user va antes que (createdAt, id) en el orden de la paginación por cursor
+func keysetBefore(user *domain.User, createdAt time.Time, id primitive.ObjectID) bool {
+	if !user.CreatedAt.Equal(createdAt) {
+		return user.CreatedAt.After(createdAt)
+	}
+	return bytes.Compare(user.ID[:], id[:]) > 0
+}
+
+func (r *fakeUserRepo) Create(user *domain.User) error {
+	user.ID = primitive.NewObjectID()
+	r.users[user.ID.Hex()] = user
+	return nil
+}
+
+// CreateMany inserta cada usuario salvo los que repiten un email, como el índice único de MongoDB
+func (r *fakeUserRepo) CreateMany(users []*domain.User) ([]error, error) {
+	errs := make([]error, len(users))
+	for i, user := range users {
+		if _, err := r.GetByEmail(user.Email); err == nil {
+			errs[i] = domain.ErrEmailAlreadyRegistered
+			continue
+		}
+		user.ID = primitive.NewObjectID()
+		r.users[user.ID.Hex()] = user
+	}
+	return errs, nil
+}
+
+func (r *fakeUserRepo) GetExistingEmails(emails []string) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	for _, email := range emails {
+		if _, err := r.GetByEmail(email); err == nil {
+			existing[email] = true
+		}
+	}
+	return existing, nil
+}
+
+func (r *fakeUserRepo) Update(user *domain.User) error {
+	// Misma comprobación de versión que el repositorio de MongoDB
+	if stored, ok := r.users[user.ID.Hex()]; !ok || stored.Version != user.Version {
+		return utils.ErrVersionConflict
+	}
+	user.Version++
+	copied := *user
+	r.users[user.ID.Hex()] = &copied
+	return nil
+}
+
+func (r *fakeUserRepo) Delete(id string) error {
+	delete(r.users, id)
+	return nil
+}
+
+func (r *fakeUserRepo) Archive(id string) error {
+	user, ok := r.users[id]
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+	now := time.Now()
+	user.Status = domain.UserStatusArchived
+	user.ArchivedAt = &now
+	user.Version++
+	return nil
+}
+
+func (r *fakeUserRepo) Restore(id string) error {
+	user, ok := r.users[id]
+	if !ok || user.Status != domain.UserStatusArchived {
+		return domain.ErrUserNotArchived
+	}
+	user.Status = domain.UserStatusActive
+	user.ArchivedAt = nil
+	user.Version++
+	return nil
+}
+
+func (r *fakeUserRepo) EmailInUse(email string, excludeID string) (bool, error) {
+	for id, user := range r.users {
+		if id != excludeID && strings.EqualFold(user.Email, email) && user.Status != domain.UserStatusArchived {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *fakeUserRepo) UpdateRefreshToken(userID string, refreshToken string) error {
+	user, ok := r.users[userID]
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+	user.RefreshToken = refreshToken
+	return nil
+}
+
+func (r *fakeUserRepo) UpdateLastLogin(userID string, at time.Time, ip string) error {
+	user, ok := r.users[userID]
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+	user.LastLoginAt = &at
+	user.LastLoginIP = ip
+	return nil
+}
+
+func (r *fakeUserRepo) SetTwoFactor(userID string, secret string, enabled bool) error {
+	user, ok := r.users[userID]
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+	user.TwoFactorSecret = secret
+	user.TwoFactorEnabled = enabled
+	if secret == "" {
+		user.TwoFactorLastStep = 0
+		user.TwoFactorFailures = 0
+		user.TwoFactorLockedUntil = nil
+	}
+	return nil
+}
+
+func (r *fakeUserRepo) AcceptTwoFactorStep(userID string, step int64) (bool, error) {
+	user, ok := r.users[userID]
+	if !ok {
+		return false, domain.ErrUserNotFound
+	}
+	if step <= user.TwoFactorLastStep {
+		return false, nil
+	}
+	user.TwoFactorLastStep = step
+	user.TwoFactorFailures = 0
+	user.TwoFactorLockedUntil = nil
+	return true, nil
+}
+
+func (r *fakeUserRepo) RecordTwoFactorFailure(userID string, maxAttempts int, lockedUntil time.Time) error {
+	user, ok := r.users[userID]
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+	user.TwoFactorFailures++
+	if user.TwoFactorFailures >= maxAttempts {
+		user.TwoFactorLockedUntil = &lockedUntil
+		user.TwoFactorFailures = 0
+	}
+	return nil
+}
+
+func (r *fakeUserRepo) GetByRefreshToken(refreshToken string) (*domain.User, error) {
+	for _, user := range r.users {
+		if user.RefreshToken == refreshToken {
+			return user, nil
+		}
+	}
+	return nil, domain.ErrUserNotFound
+}
+
+func (r *fakeUserRepo) ForEach(params map[string]interface{}, batchSize int, fn func(user *domain.User) error) error {
+	users, _ := r.matching(params)
+	for _, user := range users {
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *fakeUserRepo) SetPasswordResetToken(userID string, tokenHash string, expiresAt time.Time) error {
+	user, ok := r.users[userID]
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+	user.PasswordResetToken = tokenHash
+	user.PasswordResetExpiresAt = &expiresAt
+	return nil
+}
+
+func (r *fakeUserRepo) ConsumePasswordResetToken(tokenHash string, passwordHash string, now time.Time) (*domain.User, error) {
+	for _, user := range r.users {
+		if user.PasswordResetToken == tokenHash && user.PasswordResetExpiresAt != nil && user.PasswordResetExpiresAt.After(now) {
+			user.Password = passwordHash
+			user.PasswordResetToken = ""
+			user.PasswordResetExpiresAt = nil
+			user.Version++
+			return user, nil
+		}
+	}
+	return nil, domain.ErrInvalidResetToken
+}
+
+func (r *fakeUserRepo) ConsumeVerifyToken(tokenHash string, now time.Time) (*domain.User, error) {
+	for _, user := range r.users {
+		if user.Status == domain.UserStatusPending && user.VerifyToken == tokenHash &&
+			user.VerifyExpiresAt != nil && user.VerifyExpiresAt.After(now) {
+			user.Status = domain.UserStatusActive
+			user.VerifyToken = ""
+			user.VerifyExpiresAt = nil
+			user.VerifySentAt = nil
+			user.Version++
+			return user, nil
+		}
+	}
+	return nil, domain.ErrInvalidVerifyToken
+}
+
+func (r *fakeUserRepo) RenewVerifyToken(userID string, tokenHash string, expiresAt time.Time, now time.Time, cooldown time.Duration) (bool, error) {
+	for _, user := range r.users {
+		if user.ID.Hex() != userID || user.Status != domain.UserStatusPending {
+			continue
+		}
+		if user.VerifySentAt != nil && user.VerifySentAt.After(now.Add(-cooldown)) {
+			return false, nil
+		}
+		user.VerifyToken = tokenHash
+		user.VerifyExpiresAt = &expiresAt
+		user.VerifySentAt = &now
+		return true, nil
+	}
+	return false, nil
+}
+
+// fakeVerificationSender guarda el último token de verificación enviado por email
+type fakeVerificationSender struct {
+	tokens map[string]string
+}
+
+func newFakeVerificationSender() *fakeVerificationSender {
+	return &fakeVerificationSender{tokens: make(map[string]string)}
+}
+
+func (s *fakeVerificationSender) SendEmailVerification(user *domain.User, token string, expiresAt time.Time) error {
+	s.tokens[user.Email] = token
+	return nil
+}
+
+// fakePasswordResetSender guarda el último token enviado por usuario
+type fakePasswordResetSender struct {
+	tokens map[string]string
+}
+
+func newFakePasswordResetSender() *fakePasswordResetSender {
+	return &fakePasswordResetSender{tokens: make(map[string]string)}
+}
+
+func (s *fakePasswordResetSender) SendPasswordReset(user *domain.User, token string, expiresAt time.Time) error {
+	s.tokens[user.Email] = token
+	return nil
+}
+
+// fakeRoleInitializer registra las asignaciones de rol creadas, vaciadas y eliminadas por
+// usuario. Si err está definido, todos sus métodos fallan con ese error.
+type fakeRoleInitializer struct {
+	assigned map[string]bool
+	cleared  []string
+	deleted  []string
+	batches  int
+	err      error
+}
+
+func newFakeRoleInitializer() *fakeRoleInitializer {
+	return &fakeRoleInitializer{assigned: make(map[string]bool)}
+}
+
+func (f *fakeRoleInitializer) EnsureUserRole(userID string) (bool, error) {
+	if f.err != nil {
+		return false, f.err
+	}
+	if f.assigned[userID] {
+		return false, nil
+	}
+	f.assigned[userID] = true
+	return true, nil
+}
+
+func (f *fakeRoleInitializer) EnsureUserRoles(userIDs []string) ([]string, error) {
+	f.batches++
+	var created []string
+	for _, userID := range userIDs {
+		ok, err := f.EnsureUserRole(userID)
+		if err != nil {
+			return created, err
+		}
+		if ok {
+			created = append(created, userID)
+		}
+	}
+	return created, nil
+}
+
+func (f *fakeRoleInitializer) ClearUserRoles(userID string) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.cleared = append(f.cleared, userID)
+	return nil
+}
+
+func (f *fakeRoleInitializer) DeleteUserRoles(userID string) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.deleted = append(f.deleted, userID)
+	return nil
+}
@@ -0,0 +1,121 @@
+package usecase
+
+import (
+	"time"
+
+	"github.com/black4ninja/mi-proyecto/internal/user/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// Option configura una dependencia o un ajuste opcional del caso de uso de usuarios
+type Option func(*userUseCase)
+
+// WithRoleInitializer crea la asignación de roles vacía de cada usuario nuevo y permite
+// reconciliar los usuarios que no la tengan
+func WithRoleInitializer(initializer domain.RoleAssignmentInitializer) Option {
+	return func(u *userUseCase) {
+		u.roleInitializer = initializer
+	}
+}
+
+// WithTokenRevoker revoca las sesiones de los usuarios archivados o desactivados para que sus
+// tokens dejen de ser válidos antes de expirar
+func WithTokenRevoker(revoker domain.TokenRevoker) Option {
+	return func(u *userUseCase) {
+		u.tokenRevoker = revoker
+	}
+}
+
+// WithRoleAssignmentRemover quita los roles y permisos de los usuarios que eliminan su cuenta o
+// que un administrador borra
+func WithRoleAssignmentRemover(remover domain.RoleAssignmentRemover) Option {
+	return func(u *userUseCase) {
+		u.roleRemover = remover
+	}
+}
+
+// WithAccountDeletionRecorder recibe el evento de cada cuenta eliminada por su propio usuario
+func WithAccountDeletionRecorder(recorder domain.AccountDeletionRecorder) Option {
+	return func(u *userUseCase) {
+		u.deletions = recorder
+	}
+}
+
+// WithPasswordReset entrega los tokens de restablecimiento de contraseña con sender, vigentes
+// durante ttl (0 = una hora). Sin esta opción RequestPasswordReset retorna ErrPasswordResetDisabled.
+func WithPasswordReset(sender domain.PasswordResetSender, ttl time.Duration) Option {
+	return func(u *userUseCase) {
+		u.resetSender = sender
+		if ttl > 0 {
+			u.passwordResetTTL = ttl
+		}
+	}
+}
+
+// WithEmailVerification activa la verificación de email: los usuarios nuevos quedan pendientes
+// hasta usar el token que reciben con sender (salvo SkipVerification), vigente durante ttl
+// (0 = 24 horas)
+func WithEmailVerification(sender domain.EmailVerificationSender, ttl time.Duration) Option {
+	return func(u *userUseCase) {
+		u.verifySender = sender
+		if ttl > 0 {
+			u.verifyTTL = ttl
+		}
+	}
+}
+
+// WithVerificationResendCooldown define el tiempo mínimo entre dos envíos del token de
+// verificación al mismo usuario (0 = cinco minutos)
+func WithVerificationResendCooldown(cooldown time.Duration) Option {
+	return func(u *userUseCase) {
+		if cooldown > 0 {
+			u.verifyResendCooldown = cooldown
+		}
+	}
+}
+
+// WithPasswordPolicy define las reglas de complejidad de las contraseñas nuevas
+// (por defecto utils.DefaultPasswordPolicy)
+func WithPasswordPolicy(policy utils.PasswordPolicy) Option {
+	return func(u *userUseCase) {
+		u.passwordPolicy = policy
+	}
+}
+
+// WithTwoFactor define el emisor de las URIs otpauth:// ("" = mi-proyecto) y la cantidad de
+// periodos TOTP (30 s) aceptados antes y después del actual para tolerar desfases de reloj
+// (0 = solo el periodo actual)
+func WithTwoFactor(issuer string, window int) Option {
+	return func(u *userUseCase) {
+		if issuer != "" {
+			u.twoFactorIssuer = issuer
+		}
+		u.twoFactorWindow = window
+	}
+}
+
+// WithTwoFactorEncryption cifra con box los secretos TOTP guardados. Sin esta opción se guardan
+// sin cifrar; los guardados así antes de configurarla se siguen leyendo.
+func WithTwoFactorEncryption(box *utils.SecretBox) Option {
+	return func(u *userUseCase) {
+		u.twoFactorBox = box
+	}
+}
+
+// WithTwoFactorLockout bloquea la verificación en dos pasos del usuario durante lockout tras
+// maxAttempts códigos inválidos consecutivos (por defecto 5 y 15 minutos; 0 = sin bloqueo)
+func WithTwoFactorLockout(maxAttempts int, lockout time.Duration) Option {
+	return func(u *userUseCase) {
+		u.twoFactorMaxAttempts = maxAttempts
+		if lockout > 0 {
+			u.twoFactorLockout = lockout
+		}
+	}
+}
+
+// WithClock reemplaza el reloj usado para las vigencias de los tokens y los códigos TOTP
+func WithClock(now func() time.Time) Option {
+	return func(u *userUseCase) {
+		u.now = now
+	}
+}
@@ -2,82 +2,195 @@ package usecase
 
 import (
 	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/black4ninja/mi-proyecto/internal/user/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+const (
+	// defaultPasswordResetTTL es la vigencia del token de restablecimiento si no se configura otra
+	defaultPasswordResetTTL = time.Hour
+	// defaultVerifyTTL es la vigencia del token de verificación de email si no se configura otra
+	defaultVerifyTTL = 24 * time.Hour
+	// defaultVerifyResendCooldown es el tiempo mínimo entre dos envíos del token de verificación
+	defaultVerifyResendCooldown = 5 * time.Minute
+	// defaultTwoFactorIssuer es el emisor que muestran las aplicaciones de autenticación si no se configura otro
+	defaultTwoFactorIssuer = "mi-proyecto"
+	// defaultTwoFactorMaxAttempts y defaultTwoFactorLockout limitan los códigos TOTP inválidos
+	defaultTwoFactorMaxAttempts = 5
+	defaultTwoFactorLockout     = 15 * time.Minute
+	// reconcileBatchSize es la cantidad de usuarios cuyas asignaciones se aseguran por escritura
+	reconcileBatchSize = 500
 )
 
 type userUseCase struct {
-	userRepo domain.UserRepository
+	userRepo             domain.UserRepository
+	roleInitializer      domain.RoleAssignmentInitializer
+	tokenRevoker         domain.TokenRevoker
+	roleRemover          domain.RoleAssignmentRemover
+	deletions            domain.AccountDeletionRecorder
+	resetSender          domain.PasswordResetSender
+	passwordResetTTL     time.Duration
+	verifySender         domain.EmailVerificationSender
+	verifyTTL            time.Duration
+	verifyResendCooldown time.Duration
+	passwordPolicy       utils.PasswordPolicy
+	twoFactorIssuer      string
+	twoFactorWindow      int
+	twoFactorBox         *utils.SecretBox
+	twoFactorMaxAttempts int
+	twoFactorLockout     time.Duration
+	now                  func() time.Time
 }
 
-// NewUserUseCase crea un nuevo caso de uso para usuarios
-func NewUserUseCase(userRepo domain.UserRepository) domain.UserUseCase {
-	return &userUseCase{
-		userRepo: userRepo,
+// NewUserUseCase crea un nuevo caso de uso para usuarios. Las dependencias y ajustes opcionales
+// se indican con opciones (ver Option).
+func NewUserUseCase(userRepo domain.UserRepository, opts ...Option) domain.UserUseCase {
+	u := &userUseCase{
+		userRepo:             userRepo,
+		passwordResetTTL:     defaultPasswordResetTTL,
+		verifyTTL:            defaultVerifyTTL,
+		verifyResendCooldown: defaultVerifyResendCooldown,
+		passwordPolicy:       utils.DefaultPasswordPolicy(),
+		twoFactorIssuer:      defaultTwoFactorIssuer,
+		twoFactorMaxAttempts: defaultTwoFactorMaxAttempts,
+		twoFactorLockout:     defaultTwoFactorLockout,
+		now:                  time.Now,
+	}
+	for _, opt := range opts {
+		opt(u)
 	}
+	return u
 }
 
 // GetUser obtiene un usuario por su ID
 func (u *userUseCase) GetUser(id string) (*domain.UserResponse, error) {
 	user, err := u.userRepo.GetByID(id)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("obtener usuario %s: %w", id, err)
 	}
 
 	return &domain.UserResponse{
-		ID:        user.ID.Hex(),
-		Email:     user.Email,
-		Name:      user.Name,
-		Status:    user.Status,
-		Role:      user.Role,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
+		ID:                 user.ID.Hex(),
+		Email:              user.Email,
+		Name:               user.Name,
+		Status:             user.Status,
+		Role:               user.Role,
+		Version:            user.Version,
+		Metadata:           user.Metadata,
+		CreatedAt:          utils.NewTimestamp(user.CreatedAt),
+		UpdatedAt:          utils.NewTimestamp(user.UpdatedAt),
+		MustChangePassword: user.MustChangePassword,
+		LastLoginAt:        lastLoginAt(user),
+		LastLoginIP:        user.LastLoginIP,
+		TwoFactorEnabled:   user.TwoFactorEnabled,
 	}, nil
 }
 
 // GetUserByEmail obtiene un usuario por su email
 func (u *userUseCase) GetUserByEmail(email string) (*domain.User, error) {
-	return u.userRepo.GetByEmail(email)
+	return u.userRepo.GetByEmail(domain.NormalizeEmail(email))
 }
 
-// GetAllUsers obtiene todos los usuarios
-func (u *userUseCase) GetAllUsers(params map[string]interface{}) ([]*domain.UserResponse, error) {
-	users, err := u.userRepo.GetAll(params)
+// GetAllUsers obtiene una página de usuarios (omitiendo skip y con hasta limit resultados) y el
+// total de coincidencias
+func (u *userUseCase) GetAllUsers(params map[string]interface{}, skip, limit int64) (*domain.PaginatedResult, error) {
+	users, total, err := u.userRepo.GetPage(params, skip, limit)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("listar usuarios: %w", err)
+	}
+
+	return &domain.PaginatedResult{Items: userPageResponse(users), Total: total}, nil
+}
+
+// GetUsersAfter obtiene una página de usuarios por cursor (keyset). cursor vacío obtiene la
+// primera página; el cursor retornado está vacío cuando no quedan más resultados.
+func (u *userUseCase) GetUsersAfter(params map[string]interface{}, cursor string, limit int64) ([]*domain.UserResponse, string, error) {
+	var after *utils.KeysetCursor
+	if cursor != "" {
+		decoded, err := utils.DecodeKeysetCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		after = &decoded
 	}
 
-	var response []*domain.UserResponse
+	users, hasMore, err := u.userRepo.GetPageAfter(params, after, limit)
+	if err != nil {
+		return nil, "", fmt.Errorf("listar usuarios: %w", err)
+	}
+
+	next := ""
+	if hasMore && len(users) > 0 {
+		last := users[len(users)-1]
+		next = utils.NewKeysetCursor(last.CreatedAt, last.ID).Encode()
+	}
+	return userPageResponse(users), next, nil
+}
+
+// lastLoginAt retorna la fecha del último inicio de sesión para la respuesta, o nil si el
+// usuario nunca inició sesión
+func lastLoginAt(user *domain.User) *utils.Timestamp {
+	if user.LastLoginAt == nil {
+		return nil
+	}
+	at := utils.NewTimestamp(*user.LastLoginAt)
+	return &at
+}
+
+// userPageResponse convierte una página de usuarios en su representación de respuesta
+func userPageResponse(users []*domain.User) []*domain.UserResponse {
+	response := make([]*domain.UserResponse, 0, len(users))
 	for _, user := range users {
 		response = append(response, &domain.UserResponse{
-			ID:        user.ID.Hex(),
-			Email:     user.Email,
-			Name:      user.Name,
-			Status:    user.Status,
-			Role:      user.Role,
-			CreatedAt: user.CreatedAt,
-			UpdatedAt: user.UpdatedAt,
+			ID:                 user.ID.Hex(),
+			Email:              user.Email,
+			Name:               user.Name,
+			Status:             user.Status,
+			Role:               user.Role,
+			Version:            user.Version,
+			Metadata:           user.Metadata,
+			CreatedAt:          utils.NewTimestamp(user.CreatedAt),
+			UpdatedAt:          utils.NewTimestamp(user.UpdatedAt),
+			MustChangePassword: user.MustChangePassword,
+			LastLoginAt:        lastLoginAt(user),
+			LastLoginIP:        user.LastLoginIP,
+			TwoFactorEnabled:   user.TwoFactorEnabled,
 		})
 	}
-
-	return response, nil
+	return response
 }
 
 // CreateUser crea un nuevo usuario
 func (u *userUseCase) CreateUser(req *domain.CreateUserRequest) (*domain.UserResponse, error) {
-	// Verificar si el email ya existe
-	existingUser, err := u.userRepo.GetByEmail(req.Email)
-	if err == nil && existingUser != nil {
-		return nil, errors.New("el email ya está registrado")
+	if err := utils.ValidatePasswordStrength(req.Password, u.passwordPolicy); err != nil {
+		return nil, err
+	}
+
+	// Validar metadatos personalizados
+	if len(req.Metadata) > 0 {
+		if err := utils.ValidateMetadata(req.Metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	// Verificar si el email ya existe (sin distinguir mayúsculas)
+	req.Email = domain.NormalizeEmail(req.Email)
+	if err := u.ensureEmailAvailable(req.Email); err != nil {
+		return nil, err
 	}
 
 	// Hashear contraseña
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("hashear contraseña: %w", err)
 	}
 
 	// Establecer rol por defecto si no se proporciona
@@ -87,45 +200,231 @@ func (u *userUseCase) CreateUser(req *domain.CreateUserRequest) (*domain.UserRes
 	}
 
 	// Crear usuario
-	now := time.Now()
+	now := u.now()
 	user := &domain.User{
 		Email:     req.Email,
 		Name:      req.Name,
 		Password:  string(hashedPassword),
 		Status:    domain.UserStatusActive,
 		Role:      role,
+		Metadata:  req.Metadata,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
 
+	// Con la verificación activa el usuario queda pendiente hasta confirmar su email
+	var verifyToken string
+	if u.verifySender != nil && !req.SkipVerification {
+		if verifyToken, err = utils.GenerateRandomToken(32); err != nil {
+			return nil, fmt.Errorf("generar token de verificación: %w", err)
+		}
+		expiresAt := now.Add(u.verifyTTL)
+		user.Status = domain.UserStatusPending
+		user.VerifyToken = utils.HashToken(verifyToken)
+		user.VerifyExpiresAt = &expiresAt
+		user.VerifySentAt = &now
+	}
+
 	if err := u.userRepo.Create(user); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("crear usuario: %w", err)
+	}
+
+	// Un fallo al enviar no revierte el usuario: un administrador puede activarlo
+	if verifyToken != "" {
+		if err := u.verifySender.SendEmailVerification(user, verifyToken, *user.VerifyExpiresAt); err != nil {
+			log.Printf("[WARN] no se pudo enviar la verificación de email user=%s error=%v", user.ID.Hex(), err)
+		}
+	}
+
+	// Crear la asignación de roles vacía. Un fallo no revierte el usuario:
+	// la reconciliación periódica crea las asignaciones faltantes.
+	if u.roleInitializer != nil {
+		if _, err := u.roleInitializer.EnsureUserRole(user.ID.Hex()); err != nil {
+			log.Printf("[WARN] no se pudo crear la asignación de roles user=%s error=%v", user.ID.Hex(), err)
+		}
 	}
 
 	return &domain.UserResponse{
-		ID:        user.ID.Hex(),
-		Email:     user.Email,
-		Name:      user.Name,
-		Status:    user.Status,
-		Role:      user.Role,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
+		ID:                 user.ID.Hex(),
+		Email:              user.Email,
+		Name:               user.Name,
+		Status:             user.Status,
+		Role:               user.Role,
+		Version:            user.Version,
+		Metadata:           user.Metadata,
+		CreatedAt:          utils.NewTimestamp(user.CreatedAt),
+		UpdatedAt:          utils.NewTimestamp(user.UpdatedAt),
+		MustChangePassword: user.MustChangePassword,
+		LastLoginAt:        lastLoginAt(user),
+		LastLoginIP:        user.LastLoginIP,
+		TwoFactorEnabled:   user.TwoFactorEnabled,
 	}, nil
 }
 
+// ImportUsers crea los usuarios de una importación masiva. Cada registro se valida por separado
+// y los válidos se insertan en una sola escritura masiva; el resultado indica por fila si se creó
+// el usuario o por qué no. Los registros sin contraseña reciben una temporal que deben cambiar.
+func (u *userUseCase) ImportUsers(records []*domain.UserImportRecord) (*domain.UserImportResponse, error) {
+	if len(records) > domain.MaxUserImportRows {
+		return nil, fmt.Errorf("%w (%d)", domain.ErrImportTooLarge, domain.MaxUserImportRows)
+	}
+
+	response := &domain.UserImportResponse{Results: make([]*domain.UserImportResult, len(records))}
+	emails := make([]string, 0, len(records))
+	for i, record := range records {
+		record.Email = domain.NormalizeEmail(record.Email)
+		record.Name = strings.TrimSpace(record.Name)
+		response.Results[i] = &domain.UserImportResult{Row: i + 1, Email: record.Email}
+		emails = append(emails, record.Email)
+	}
+
+	existing, err := u.userRepo.GetExistingEmails(emails)
+	if err != nil {
+		return nil, fmt.Errorf("verificar emails de la importación: %w", err)
+	}
+
+	// Validar y preparar los registros; los inválidos no se envían a la base de datos
+	var users []*domain.User
+	var pending []*domain.UserImportResult
+	seen := make(map[string]bool, len(records))
+	now := u.now()
+	for i, record := range records {
+		result := response.Results[i]
+		if err := u.validateImportRecord(record); err != nil {
+			result.Error = err.Error()
+			continue
+		}
+		if existing[record.Email] {
+			result.Error = domain.ErrEmailAlreadyRegistered.Error()
+			continue
+		}
+		if seen[record.Email] {
+			result.Error = "email repetido en la importación"
+			continue
+		}
+		seen[record.Email] = true
+
+		password := record.Password
+		temporary := password == ""
+		if temporary {
+			if password, err = utils.GeneratePassword(u.passwordPolicy); err != nil {
+				return nil, fmt.Errorf("generar contraseña temporal: %w", err)
+			}
+		}
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, fmt.Errorf("hashear contraseña: %w", err)
+		}
+		if temporary {
+			result.TemporaryPassword = password
+		}
+
+		// El rol heredado solo se guarda en el usuario; los roles de permisos (user_roles) no se
+		// asignan desde la importación, que solo exige admin:users
+		role := strings.TrimSpace(record.Role)
+		if role == "" {
+			role = "user"
+		}
+
+		users = append(users, &domain.User{
+			Email:              record.Email,
+			Name:               record.Name,
+			Password:           string(hashedPassword),
+			Status:             domain.UserStatusActive,
+			Role:               role,
+			Metadata:           record.Metadata,
+			MustChangePassword: temporary,
+			CreatedAt:          now,
+			UpdatedAt:          now,
+		})
+		pending = append(pending, result)
+	}
+
+	insertErrs, err := u.userRepo.CreateMany(users)
+	if err != nil {
+		return nil, fmt.Errorf("importar usuarios: %w", err)
+	}
+
+	for i, user := range users {
+		result := pending[i]
+		if insertErrs[i] != nil {
+			// El índice único de email rechaza los registrados después de la verificación
+			if !errors.Is(insertErrs[i], domain.ErrEmailAlreadyRegistered) {
+				log.Printf("[WARN] no se pudo importar el usuario row=%d error=%v", result.Row, insertErrs[i])
+			}
+			result.Error = publicImportError(insertErrs[i])
+			result.TemporaryPassword = ""
+			continue
+		}
+
+		result.ID = user.ID.Hex()
+		if u.roleInitializer != nil {
+			if _, err := u.roleInitializer.EnsureUserRole(result.ID); err != nil {
+				log.Printf("[WARN] no se pudo crear la asignación de roles user=%s error=%v", result.ID, err)
+			}
+		}
+	}
+
+	for _, result := range response.Results {
+		if result.Error != "" {
+			result.Status = domain.UserImportFailed
+			response.Failed++
+		} else {
+			result.Status = domain.UserImportCreated
+			response.Created++
+		}
+	}
+	return response, nil
+}
+
+// validateImportRecord aplica a una fila de importación las mismas reglas que CreateUserRequest
+func (u *userUseCase) validateImportRecord(record *domain.UserImportRecord) error {
+	if address, err := mail.ParseAddress(record.Email); err != nil || address.Address != record.Email {
+		return errors.New("email inválido")
+	}
+	if record.Name == "" {
+		return errors.New("el nombre es obligatorio")
+	}
+	if record.Password != "" {
+		if err := utils.ValidatePasswordStrength(record.Password, u.passwordPolicy); err != nil {
+			return err
+		}
+	}
+	if len(record.Metadata) > 0 {
+		if err := utils.ValidateMetadata(record.Metadata); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publicImportError retorna el mensaje de un fallo de inserción que puede mostrarse en el resultado
+func publicImportError(err error) string {
+	if errors.Is(err, domain.ErrEmailAlreadyRegistered) {
+		return domain.ErrEmailAlreadyRegistered.Error()
+	}
+	return "no se pudo crear el usuario"
+}
+
 // UpdateUser actualiza un usuario existente
 func (u *userUseCase) UpdateUser(id string, req *domain.UpdateUserRequest) (*domain.UserResponse, error) {
 	// Obtener usuario existente
 	user, err := u.userRepo.GetByID(id)
 	if err != nil {
+		return nil, fmt.Errorf("obtener usuario %s: %w", id, err)
+	}
+
+	// Rechazar la edición si el usuario cambió desde que el cliente lo leyó
+	precondition := utils.Precondition{ExpectedVersion: req.ExpectedVersion, UnmodifiedSince: req.UnmodifiedSince}
+	if err := precondition.Check(user.Version, user.UpdatedAt); err != nil {
 		return nil, err
 	}
 
 	// Verificar si se intenta cambiar el email y si ya existe
+	req.Email = domain.NormalizeEmail(req.Email)
 	if req.Email != "" && req.Email != user.Email {
-		existingUser, err := u.userRepo.GetByEmail(req.Email)
-		if err == nil && existingUser != nil {
-			return nil, errors.New("el email ya está registrado")
+		if err := u.ensureEmailAvailable(req.Email); err != nil {
+			return nil, err
 		}
 		user.Email = req.Email
 	}
@@ -135,7 +434,12 @@ func (u *userUseCase) UpdateUser(id string, req *domain.UpdateUserRequest) (*dom
 		user.Name = req.Name
 	}
 
+	deactivated := false
 	if req.Status != "" {
+		if !domain.IsValidUserStatus(req.Status) {
+			return nil, fmt.Errorf("%w: %s", domain.ErrInvalidUserStatus, req.Status)
+		}
+		deactivated = user.Status == domain.UserStatusActive && req.Status != domain.UserStatusActive
 		user.Status = req.Status
 	}
 
@@ -143,31 +447,137 @@ func (u *userUseCase) UpdateUser(id string, req *domain.UpdateUserRequest) (*dom
 		user.Role = req.Role
 	}
 
-	user.UpdatedAt = time.Now()
+	if req.Metadata != nil {
+		metadata := utils.MergeMetadata(user.Metadata, req.Metadata)
+		if err := utils.ValidateMetadata(metadata); err != nil {
+			return nil, err
+		}
+		user.Metadata = metadata
+	}
+
+	user.UpdatedAt = u.now()
 
 	if err := u.userRepo.Update(user); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("actualizar usuario %s: %w", id, err)
+	}
+
+	// Un usuario desactivado no conserva sus sesiones
+	if deactivated {
+		if err := u.revokeTokens(id); err != nil {
+			return nil, err
+		}
 	}
 
 	return &domain.UserResponse{
-		ID:        user.ID.Hex(),
-		Email:     user.Email,
-		Name:      user.Name,
-		Status:    user.Status,
-		Role:      user.Role,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
+		ID:                 user.ID.Hex(),
+		Email:              user.Email,
+		Name:               user.Name,
+		Status:             user.Status,
+		Role:               user.Role,
+		Version:            user.Version,
+		Metadata:           user.Metadata,
+		CreatedAt:          utils.NewTimestamp(user.CreatedAt),
+		UpdatedAt:          utils.NewTimestamp(user.UpdatedAt),
+		MustChangePassword: user.MustChangePassword,
+		LastLoginAt:        lastLoginAt(user),
+		LastLoginIP:        user.LastLoginIP,
+		TwoFactorEnabled:   user.TwoFactorEnabled,
 	}, nil
 }
 
-// DeleteUser elimina un usuario
+// DeleteUser elimina un usuario, revoca sus sesiones y elimina su asignación de roles. Si falla
+// un paso posterior al borrado, el usuario ya no existe y el error indica qué quedó pendiente.
 func (u *userUseCase) DeleteUser(id string) error {
-	return u.userRepo.Delete(id)
+	if err := u.userRepo.Delete(id); err != nil {
+		return err
+	}
+	if err := u.revokeTokens(id); err != nil {
+		return err
+	}
+	if u.roleRemover != nil {
+		if err := u.roleRemover.DeleteUserRoles(id); err != nil {
+			return fmt.Errorf("eliminar roles del usuario %s: %w", id, err)
+		}
+	}
+	return nil
 }
 
-// ArchiveUser archiva un usuario
+// ArchiveUser archiva un usuario y revoca sus sesiones
 func (u *userUseCase) ArchiveUser(id string) error {
-	return u.userRepo.Archive(id)
+	if err := u.userRepo.Archive(id); err != nil {
+		return err
+	}
+	return u.revokeTokens(id)
+}
+
+// revokeTokens revoca las sesiones del usuario que dejó de estar activo o cambió de credenciales.
+// Si falla, el cambio ya se guardó: el error indica que sus tokens pueden seguir siendo válidos
+// hasta expirar.
+func (u *userUseCase) revokeTokens(userID string) error {
+	if u.tokenRevoker == nil {
+		return nil
+	}
+	if _, err := u.tokenRevoker.RevokeUserTokens(userID); err != nil {
+		return fmt.Errorf("revocar tokens del usuario %s: %w", userID, err)
+	}
+	return nil
+}
+
+// DeleteOwnAccount elimina la cuenta del usuario autenticado. Es un borrado lógico: la cuenta
+// queda archivada, sin sesiones ni asignaciones de roles. Si falla un paso posterior al
+// archivado, la cuenta ya no puede iniciar sesión y el error indica qué quedó pendiente.
+func (u *userUseCase) DeleteOwnAccount(userID string, req *domain.DeleteAccountRequest) error {
+	user, err := u.userRepo.GetByID(userID)
+	if err != nil {
+		return fmt.Errorf("obtener usuario %s: %w", userID, err)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		return domain.ErrPasswordConfirmation
+	}
+
+	if err := u.userRepo.Archive(userID); err != nil {
+		return fmt.Errorf("archivar usuario %s: %w", userID, err)
+	}
+	if err := u.revokeTokens(userID); err != nil {
+		return err
+	}
+	if u.roleRemover != nil {
+		if err := u.roleRemover.ClearUserRoles(userID); err != nil {
+			return fmt.Errorf("quitar roles del usuario %s: %w", userID, err)
+		}
+	}
+
+	if u.deletions != nil {
+		u.deletions.RecordAccountDeletion(userID)
+	}
+	return nil
+}
+
+// RestoreUser reactiva un usuario archivado. Mientras estuvo archivado otra cuenta pudo quedar
+// activa con el mismo email (el índice único distingue mayúsculas y puede no existir); en ese
+// caso no se restaura para no duplicarlo.
+func (u *userUseCase) RestoreUser(id string) error {
+	user, err := u.userRepo.GetByID(id)
+	if err != nil {
+		return fmt.Errorf("obtener usuario %s: %w", id, err)
+	}
+	if user.Status != domain.UserStatusArchived {
+		return domain.ErrUserNotArchived
+	}
+
+	inUse, err := u.userRepo.EmailInUse(user.Email, id)
+	if err != nil {
+		return fmt.Errorf("verificar email del usuario %s: %w", id, err)
+	}
+	if inUse {
+		return domain.ErrRestoreEmailInUse
+	}
+
+	if err := u.userRepo.Restore(id); err != nil {
+		return fmt.Errorf("restaurar usuario %s: %w", id, err)
+	}
+	return nil
 }
 
 // ChangePassword cambia la contraseña de un usuario
@@ -175,54 +585,393 @@ func (u *userUseCase) ChangePassword(userID string, req *domain.ChangePasswordRe
 	// Obtener usuario
 	user, err := u.userRepo.GetByID(userID)
 	if err != nil {
-		return err
+		return fmt.Errorf("obtener usuario %s: %w", userID, err)
 	}
 
 	// Verificar contraseña antigua
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.OldPassword)); err != nil {
-		return errors.New("contraseña antigua incorrecta")
+		return domain.ErrIncorrectOldPassword
+	}
+
+	if err := utils.ValidatePasswordStrength(req.NewPassword, u.passwordPolicy); err != nil {
+		return err
 	}
 
 	// Hashear nueva contraseña
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
 	if err != nil {
-		return err
+		return fmt.Errorf("hashear contraseña: %w", err)
 	}
 
-	// Actualizar contraseña
+	// Actualizar contraseña; con ella deja de ser temporal
 	user.Password = string(hashedPassword)
-	user.UpdatedAt = time.Now()
+	user.MustChangePassword = false
+	user.UpdatedAt = u.now()
 
-	return u.userRepo.Update(user)
+	if err := u.userRepo.Update(user); err != nil {
+		return fmt.Errorf("actualizar contraseña del usuario %s: %w", userID, err)
+	}
+	return nil
 }
 
-// ValidateCredentials valida las credenciales de un usuario
-func (u *userUseCase) ValidateCredentials(email string, password string) (*domain.User, error) {
-	// Buscar usuario
-	user, err := u.userRepo.GetByEmail(email)
+// VerifyEmail activa al usuario pendiente con el token de verificación recibido al registrarse.
+// Un token desconocido, usado o expirado retorna ErrInvalidVerifyToken.
+func (u *userUseCase) VerifyEmail(token string) error {
+	if token == "" {
+		return domain.ErrInvalidVerifyToken
+	}
+
+	if _, err := u.userRepo.ConsumeVerifyToken(utils.HashToken(token), u.now()); err != nil {
+		if errors.Is(err, domain.ErrInvalidVerifyToken) {
+			return err
+		}
+		return fmt.Errorf("verificar email: %w", err)
+	}
+	return nil
+}
+
+// ResendVerification genera un token de verificación nuevo para el usuario pendiente con ese
+// email y lo entrega con el EmailVerificationSender; el token anterior deja de servir. Si el email
+// no pertenece a un usuario pendiente, o el último envío fue hace menos del cooldown configurado,
+// no hace nada y retorna nil, para no revelar qué emails están registrados.
+func (u *userUseCase) ResendVerification(email string) error {
+	if u.verifySender == nil {
+		return domain.ErrEmailVerificationDisabled
+	}
+
+	user, err := u.userRepo.GetByEmail(domain.NormalizeEmail(email))
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return nil
+		}
+		return fmt.Errorf("reenviar verificación de email: %w", err)
+	}
+	if user.Status != domain.UserStatusPending {
+		return nil
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return fmt.Errorf("generar token de verificación: %w", err)
+	}
+	now := u.now()
+	expiresAt := now.Add(u.verifyTTL)
+
+	// El cooldown se comprueba en la misma operación que guarda el token, de modo que dos
+	// solicitudes simultáneas no envíen dos emails
+	renewed, err := u.userRepo.RenewVerifyToken(user.ID.Hex(), utils.HashToken(token), expiresAt, now, u.verifyResendCooldown)
 	if err != nil {
-		return nil, errors.New("credenciales inválidas")
+		return fmt.Errorf("guardar token de verificación del usuario %s: %w", user.ID.Hex(), err)
+	}
+	if !renewed {
+		return nil
 	}
 
-	// Verificar si el usuario está activo
+	if err := u.verifySender.SendEmailVerification(user, token, expiresAt); err != nil {
+		return fmt.Errorf("enviar verificación de email al usuario %s: %w", user.ID.Hex(), err)
+	}
+	return nil
+}
+
+// RequestPasswordReset genera un token de restablecimiento para el usuario activo con ese email
+// y lo entrega con el PasswordResetSender. Si el email no pertenece a un usuario activo no hace
+// nada y retorna nil, para no revelar qué emails están registrados.
+func (u *userUseCase) RequestPasswordReset(email string) error {
+	if u.resetSender == nil {
+		return domain.ErrPasswordResetDisabled
+	}
+
+	user, err := u.userRepo.GetByEmail(domain.NormalizeEmail(email))
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return nil
+		}
+		return fmt.Errorf("solicitar restablecimiento de contraseña: %w", err)
+	}
 	if user.Status != domain.UserStatusActive {
-		return nil, errors.New("usuario inactivo")
+		return nil
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return fmt.Errorf("generar token de restablecimiento: %w", err)
+	}
+	expiresAt := u.now().Add(u.passwordResetTTL)
+
+	// Solo se guarda el hash: quien lea la base de datos no puede usar el token
+	if err := u.userRepo.SetPasswordResetToken(user.ID.Hex(), utils.HashToken(token), expiresAt); err != nil {
+		return fmt.Errorf("guardar token de restablecimiento del usuario %s: %w", user.ID.Hex(), err)
+	}
+
+	if err := u.resetSender.SendPasswordReset(user, token, expiresAt); err != nil {
+		return fmt.Errorf("enviar token de restablecimiento al usuario %s: %w", user.ID.Hex(), err)
+	}
+	return nil
+}
+
+// ResetPassword fija una nueva contraseña con un token de restablecimiento vigente y revoca las
+// sesiones abiertas, que pueden ser de quien conocía la contraseña anterior. El token se descarta
+// al usarse; un token desconocido, usado o expirado retorna ErrInvalidResetToken.
+func (u *userUseCase) ResetPassword(token string, newPassword string) error {
+	if token == "" {
+		return domain.ErrInvalidResetToken
+	}
+	// La contraseña se valida antes de consumir el token para poder reintentar con otra
+	if err := utils.ValidatePasswordStrength(newPassword, u.passwordPolicy); err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("hashear contraseña: %w", err)
+	}
+
+	user, err := u.userRepo.ConsumePasswordResetToken(utils.HashToken(token), string(hashedPassword), u.now())
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidResetToken) {
+			return err
+		}
+		return fmt.Errorf("restablecer contraseña: %w", err)
+	}
+	return u.revokeTokens(user.ID.Hex())
+}
+
+// ValidateCredentials valida las credenciales de un usuario. Los fallos de credenciales se
+// retornan como *domain.CredentialError: el mensaje es siempre "credenciales inválidas" y el
+// motivo (ErrUserNotFound, ErrUserInactive o ErrInvalidPassword) se obtiene con errors.Is.
+func (u *userUseCase) ValidateCredentials(email string, password string) (*domain.User, error) {
+	// Buscar usuario. Otros errores se envuelven para conservar la causa sin cambiar el mensaje.
+	user, err := u.userRepo.GetByEmail(domain.NormalizeEmail(email))
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return nil, &domain.CredentialError{Reason: domain.ErrUserNotFound}
+		}
+		return nil, fmt.Errorf("%w: %w", domain.ErrInvalidCredentials, err)
+	}
+
+	// Verificar si el usuario está activo. Un usuario pendiente de verificación se trata aparte.
+	if user.Status != domain.UserStatusActive && user.Status != domain.UserStatusPending {
+		return nil, &domain.CredentialError{Reason: domain.ErrUserInactive}
 	}
 
 	// Verificar contraseña
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return nil, errors.New("credenciales inválidas")
+		return nil, &domain.CredentialError{Reason: domain.ErrInvalidPassword}
+	}
+
+	// Solo quien conoce la contraseña sabe que falta verificar el email: no revela si la cuenta existe
+	if user.Status == domain.UserStatusPending {
+		return nil, domain.ErrEmailNotVerified
 	}
 
 	return user, nil
 }
 
+// DiagnoseLogin reporta el motivo real de un fallo de inicio de sesión.
+// Solo debe exponerse a administradores; el flujo público (ValidateCredentials) sigue siendo opaco.
+func (u *userUseCase) DiagnoseLogin(req *domain.LoginDiagnosisRequest) (*domain.LoginDiagnosisResponse, error) {
+	response := &domain.LoginDiagnosisResponse{Email: req.Email}
+
+	user, err := u.userRepo.GetByEmail(domain.NormalizeEmail(req.Email))
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			response.Reason = domain.LoginDiagnosisNotFound
+			return response, nil
+		}
+		return nil, fmt.Errorf("diagnosticar inicio de sesión: %w", err)
+	}
+
+	response.Status = user.Status
+	if user.Status == domain.UserStatusPending {
+		response.Reason = domain.LoginDiagnosisUnverified
+		return response, nil
+	}
+	if user.Status != domain.UserStatusActive {
+		response.Reason = domain.LoginDiagnosisInactive
+		return response, nil
+	}
+
+	if req.Password != "" {
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+			response.Reason = domain.LoginDiagnosisBadPassword
+			return response, nil
+		}
+	}
+
+	response.Reason = domain.LoginDiagnosisOK
+	return response, nil
+}
+
+// EnableTwoFactor genera un secreto TOTP nuevo para el usuario. La verificación en dos pasos no
+// se exige hasta confirmar el primer código con VerifyTwoFactor; volver a llamarlo antes de
+// confirmar reemplaza el secreto pendiente.
+func (u *userUseCase) EnableTwoFactor(userID string) (*domain.TwoFactorSetup, error) {
+	user, err := u.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("obtener usuario %s: %w", userID, err)
+	}
+	if user.TwoFactorEnabled {
+		return nil, domain.ErrTwoFactorEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, fmt.Errorf("generar secreto TOTP: %w", err)
+	}
+	stored := secret
+	if u.twoFactorBox != nil {
+		if stored, err = u.twoFactorBox.Seal(secret); err != nil {
+			return nil, fmt.Errorf("cifrar secreto TOTP: %w", err)
+		}
+	}
+	if err := u.userRepo.SetTwoFactor(userID, stored, false); err != nil {
+		return nil, fmt.Errorf("guardar secreto TOTP del usuario %s: %w", userID, err)
+	}
+
+	return &domain.TwoFactorSetup{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(u.twoFactorIssuer, user.Email, secret),
+	}, nil
+}
+
+// VerifyTwoFactor valida un código TOTP del usuario. Si el secreto estaba pendiente de
+// confirmar, el primer código válido activa la verificación en dos pasos.
+func (u *userUseCase) VerifyTwoFactor(userID string, code string) error {
+	user, err := u.userRepo.GetByID(userID)
+	if err != nil {
+		return fmt.Errorf("obtener usuario %s: %w", userID, err)
+	}
+	if user.TwoFactorSecret == "" {
+		return domain.ErrTwoFactorNotEnabled
+	}
+	if err := u.checkTwoFactorCode(user, code); err != nil {
+		return err
+	}
+
+	if !user.TwoFactorEnabled {
+		if err := u.userRepo.SetTwoFactor(userID, user.TwoFactorSecret, true); err != nil {
+			return fmt.Errorf("activar verificación en dos pasos del usuario %s: %w", userID, err)
+		}
+	}
+	return nil
+}
+
+// DisableTwoFactor desactiva la verificación en dos pasos y descarta el secreto. Exige un
+// código válido para que una sesión robada no pueda desactivarla.
+func (u *userUseCase) DisableTwoFactor(userID string, code string) error {
+	user, err := u.userRepo.GetByID(userID)
+	if err != nil {
+		return fmt.Errorf("obtener usuario %s: %w", userID, err)
+	}
+	if !user.TwoFactorEnabled {
+		return domain.ErrTwoFactorNotEnabled
+	}
+	if err := u.checkTwoFactorCode(user, code); err != nil {
+		return err
+	}
+
+	if err := u.userRepo.SetTwoFactor(userID, "", false); err != nil {
+		return fmt.Errorf("desactivar verificación en dos pasos del usuario %s: %w", userID, err)
+	}
+	return nil
+}
+
+// checkTwoFactorCode valida un código TOTP del usuario. Mientras la verificación esté bloqueada
+// por fallos retorna ErrTwoFactorLocked sin evaluar el código. Un código de un periodo igual o
+// anterior al último aceptado se rechaza, para que no pueda reutilizarse (RFC 6238 §5.2), y
+// cada código rechazado cuenta para el bloqueo.
+func (u *userUseCase) checkTwoFactorCode(user *domain.User, code string) error {
+	userID := user.ID.Hex()
+	now := u.now()
+	if user.TwoFactorLockedUntil != nil && now.Before(*user.TwoFactorLockedUntil) {
+		return domain.ErrTwoFactorLocked
+	}
+
+	secret := user.TwoFactorSecret
+	if u.twoFactorBox != nil {
+		var err error
+		if secret, err = u.twoFactorBox.Open(secret); err != nil {
+			return fmt.Errorf("descifrar secreto TOTP del usuario %s: %w", userID, err)
+		}
+	}
+
+	if step, ok := utils.MatchTOTP(secret, code, now, u.twoFactorWindow); ok && step > user.TwoFactorLastStep {
+		accepted, err := u.userRepo.AcceptTwoFactorStep(userID, step)
+		if err != nil {
+			return fmt.Errorf("registrar código TOTP del usuario %s: %w", userID, err)
+		}
+		if accepted {
+			return nil
+		}
+	}
+
+	if u.twoFactorMaxAttempts > 0 {
+		if err := u.userRepo.RecordTwoFactorFailure(userID, u.twoFactorMaxAttempts, now.Add(u.twoFactorLockout)); err != nil {
+			return fmt.Errorf("registrar código TOTP inválido del usuario %s: %w", userID, err)
+		}
+	}
+	return domain.ErrInvalidOTP
+}
+
+// ensureEmailAvailable retorna ErrEmailAlreadyRegistered si el email ya pertenece a un usuario.
+// Solo ErrUserNotFound indica que el email está libre; otros errores se propagan envueltos.
+func (u *userUseCase) ensureEmailAvailable(email string) error {
+	_, err := u.userRepo.GetByEmail(email)
+	if err == nil {
+		return domain.ErrEmailAlreadyRegistered
+	}
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return nil
+	}
+	return fmt.Errorf("verificar email: %w", err)
+}
+
 // UpdateRefreshToken actualiza el token de refresco de un usuario
 func (u *userUseCase) UpdateRefreshToken(userID string, refreshToken string) error {
 	return u.userRepo.UpdateRefreshToken(userID, refreshToken)
 }
 
+// RecordLogin registra la fecha y la IP del cliente de un inicio de sesión exitoso
+func (u *userUseCase) RecordLogin(userID string, ip string) error {
+	return u.userRepo.UpdateLastLogin(userID, u.now(), ip)
+}
+
 // GetUserByRefreshToken obtiene un usuario por su token de refresco
 func (u *userUseCase) GetUserByRefreshToken(refreshToken string) (*domain.User, error) {
 	return u.userRepo.GetByRefreshToken(refreshToken)
 }
+
+// ReconcileRoleAssignments recorre todos los usuarios y crea la asignación de roles de los que no
+// la tengan, con una escritura por lote de reconcileBatchSize usuarios
+func (u *userUseCase) ReconcileRoleAssignments() (int, error) {
+	if u.roleInitializer == nil {
+		return 0, nil
+	}
+
+	created := 0
+	userIDs := make([]string, 0, reconcileBatchSize)
+	flush := func() error {
+		if len(userIDs) == 0 {
+			return nil
+		}
+		ensured, err := u.roleInitializer.EnsureUserRoles(userIDs)
+		created += len(ensured)
+		if err != nil {
+			return fmt.Errorf("reconciliar asignaciones de %d usuarios: %w", len(userIDs), err)
+		}
+		userIDs = userIDs[:0]
+		return nil
+	}
+
+	err := u.userRepo.ForEach(nil, reconcileBatchSize, func(user *domain.User) error {
+		userIDs = append(userIDs, user.ID.Hex())
+		if len(userIDs) == reconcileBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return created, err
+	}
+	return created, flush()
+}
@@ -0,0 +1,1142 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/black4ninja/mi-proyecto/internal/user/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// newStoredUser crea un usuario con la contraseña hasheada y el estado indicado
+func newStoredUser(email, password, status string) *domain.User {
+	hash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	return &domain.User{
+		Email:    email,
+		Name:     "Usuario de prueba",
+		Password: string(hash),
+		Status:   status,
+		Role:     "user",
+	}
+}
+
+func TestDiagnoseLogin(t *testing.T) {
+	repo := newFakeUserRepo(
+		newStoredUser("activo@example.com", "secreto123", domain.UserStatusActive),
+		newStoredUser("archivado@example.com", "secreto123", domain.UserStatusArchived),
+	)
+	uc := NewUserUseCase(repo)
+
+	tests := []struct {
+		name   string
+		req    domain.LoginDiagnosisRequest
+		reason string
+		status string
+	}{
+		{"no encontrado", domain.LoginDiagnosisRequest{Email: "nadie@example.com", Password: "x"}, domain.LoginDiagnosisNotFound, ""},
+		{"inactivo", domain.LoginDiagnosisRequest{Email: "archivado@example.com", Password: "secreto123"}, domain.LoginDiagnosisInactive, domain.UserStatusArchived},
+		{"contraseña incorrecta", domain.LoginDiagnosisRequest{Email: "activo@example.com", Password: "otra"}, domain.LoginDiagnosisBadPassword, domain.UserStatusActive},
+		{"correcto", domain.LoginDiagnosisRequest{Email: "activo@example.com", Password: "secreto123"}, domain.LoginDiagnosisOK, domain.UserStatusActive},
+		{"sin contraseña", domain.LoginDiagnosisRequest{Email: "activo@example.com"}, domain.LoginDiagnosisOK, domain.UserStatusActive},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagnosis, err := uc.DiagnoseLogin(&tt.req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.reason, diagnosis.Reason)
+			assert.Equal(t, tt.status, diagnosis.Status)
+		})
+	}
+}
+
+func TestValidateCredentialsStaysOpaque(t *testing.T) {
+	repo := newFakeUserRepo(newStoredUser("activo@example.com", "secreto123", domain.UserStatusActive))
+	uc := NewUserUseCase(repo)
+
+	_, errNotFound := uc.ValidateCredentials("nadie@example.com", "secreto123")
+	_, errBadPassword := uc.ValidateCredentials("activo@example.com", "otra")
+
+	require.Error(t, errNotFound)
+	require.Error(t, errBadPassword)
+	assert.Equal(t, errNotFound.Error(), errBadPassword.Error())
+}
+
+func TestValidateCredentialsFailureReasons(t *testing.T) {
+	repo := newFakeUserRepo(
+		newStoredUser("activo@example.com", "secreto123", domain.UserStatusActive),
+		newStoredUser("inactivo@example.com", "secreto123", domain.UserStatusInactive),
+	)
+	uc := NewUserUseCase(repo)
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		reason   error
+		label    string
+	}{
+		{"usuario inexistente", "nadie@example.com", "secreto123", domain.ErrUserNotFound, domain.LoginDiagnosisNotFound},
+		{"usuario inactivo", "inactivo@example.com", "secreto123", domain.ErrUserInactive, domain.LoginDiagnosisInactive},
+		{"contraseña incorrecta", "activo@example.com", "otra", domain.ErrInvalidPassword, domain.LoginDiagnosisBadPassword},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := uc.ValidateCredentials(tt.email, tt.password)
+
+			assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
+			assert.ErrorIs(t, err, tt.reason)
+			// El mensaje es el mismo en todos los casos: el motivo solo es visible internamente
+			assert.Equal(t, domain.ErrInvalidCredentials.Error(), err.Error())
+			assert.Equal(t, tt.label, domain.CredentialFailureReason(err))
+		})
+	}
+
+	t.Run("fallo del repositorio", func(t *testing.T) {
+		failing := newFakeUserRepo()
+		failing.err = errors.New("conexión perdida")
+
+		_, err := NewUserUseCase(failing).ValidateCredentials("activo@example.com", "secreto123")
+		assert.Equal(t, "error", domain.CredentialFailureReason(err))
+	})
+}
+
+func TestImportUsers(t *testing.T) {
+	repo := newFakeUserRepo(newStoredUser("existente@example.com", "secreto123", domain.UserStatusActive))
+	roles := newFakeRoleInitializer()
+	uc := NewUserUseCase(repo, WithRoleInitializer(roles))
+
+	response, err := uc.ImportUsers([]*domain.UserImportRecord{
+		{Email: "ana@example.com", Name: "Ana", Password: "secreto123", Role: "moderator"},
+		{Email: " beto@example.com ", Name: "Beto", Metadata: map[string]interface{}{"department": "ventas"}},
+		{Email: "no-es-email", Name: "Inválido", Password: "secreto123"},
+		{Email: "sin-nombre@example.com", Password: "secreto123"},
+		{Email: "corta@example.com", Name: "Corta", Password: "123"},
+		{Email: "existente@example.com", Name: "Existente", Password: "secreto123"},
+		{Email: "ana@example.com", Name: "Ana otra vez", Password: "secreto123"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, response.Created)
+	assert.Equal(t, 5, response.Failed)
+	require.Len(t, response.Results, 7)
+
+	errorsByRow := make(map[int]string)
+	for _, result := range response.Results {
+		if result.Status == domain.UserImportFailed {
+			errorsByRow[result.Row] = result.Error
+			assert.Empty(t, result.ID)
+		}
+	}
+	assert.Equal(t, map[int]string{
+		3: "email inválido",
+		4: "el nombre es obligatorio",
+		5: "la contraseña debe tener al menos 6 caracteres",
+		6: "el email ya está registrado",
+		7: "email repetido en la importación",
+	}, errorsByRow)
+
+	t.Run("con contraseña indicada", func(t *testing.T) {
+		result := response.Results[0]
+		assert.Equal(t, domain.UserImportCreated, result.Status)
+		assert.Empty(t, result.TemporaryPassword)
+
+		user, err := uc.ValidateCredentials("ana@example.com", "secreto123")
+		require.NoError(t, err)
+		assert.Equal(t, "moderator", user.Role)
+		assert.False(t, user.MustChangePassword)
+		assert.True(t, roles.assigned[result.ID])
+	})
+
+	t.Run("sin contraseña recibe una temporal", func(t *testing.T) {
+		result := response.Results[1]
+		assert.Equal(t, domain.UserImportCreated, result.Status)
+		assert.Equal(t, "beto@example.com", result.Email)
+		require.NotEmpty(t, result.TemporaryPassword)
+
+		user, err := uc.ValidateCredentials("beto@example.com", result.TemporaryPassword)
+		require.NoError(t, err)
+		assert.Equal(t, "user", user.Role)
+		assert.True(t, user.MustChangePassword)
+		assert.Equal(t, "ventas", user.Metadata["department"])
+
+		// Al cambiar la contraseña deja de ser temporal
+		require.NoError(t, uc.ChangePassword(result.ID, &domain.ChangePasswordRequest{OldPassword: result.TemporaryPassword, NewPassword: "propia123"}))
+		profile, err := uc.GetUser(result.ID)
+		require.NoError(t, err)
+		assert.False(t, profile.MustChangePassword)
+	})
+
+	t.Run("el rol no otorga permisos", func(t *testing.T) {
+		// La importación solo exige admin:users: una fila con role=admin no debe asignar roles de
+		// permisos, solo la asignación vacía (y los roles por defecto) de cualquier usuario nuevo
+		scoped := newFakeRoleInitializer()
+		response, err := NewUserUseCase(newFakeUserRepo(), WithRoleInitializer(scoped)).ImportUsers([]*domain.UserImportRecord{
+			{Email: "escalada@example.com", Name: "Escalada", Password: "secreto123", Role: "admin"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, response.Created)
+
+		result := response.Results[0]
+		assert.Equal(t, map[string]bool{result.ID: true}, scoped.assigned)
+		assert.Empty(t, scoped.cleared)
+		assert.Empty(t, scoped.deleted)
+	})
+
+	t.Run("la contraseña temporal cumple la política", func(t *testing.T) {
+		policy := utils.PasswordPolicy{MinLength: 12, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true}
+		strict := NewUserUseCase(newFakeUserRepo(), WithPasswordPolicy(policy))
+
+		response, err := strict.ImportUsers([]*domain.UserImportRecord{{Email: "carla@example.com", Name: "Carla"}})
+		require.NoError(t, err)
+		require.Equal(t, 1, response.Created)
+		assert.NoError(t, utils.ValidatePasswordStrength(response.Results[0].TemporaryPassword, policy))
+	})
+
+	t.Run("demasiadas filas", func(t *testing.T) {
+		records := make([]*domain.UserImportRecord, domain.MaxUserImportRows+1)
+		_, err := uc.ImportUsers(records)
+		assert.ErrorIs(t, err, domain.ErrImportTooLarge)
+	})
+}
+
+func TestEmailVerification(t *testing.T) {
+	repo := newFakeUserRepo()
+	sender := newFakeVerificationSender()
+	uc := NewUserUseCase(repo, WithEmailVerification(sender, 0))
+
+	t.Run("el usuario registrado queda pendiente hasta verificar", func(t *testing.T) {
+		created, err := uc.CreateUser(&domain.CreateUserRequest{Email: "nuevo@example.com", Name: "Nuevo", Password: "secreto123"})
+		require.NoError(t, err)
+		assert.Equal(t, domain.UserStatusPending, created.Status)
+
+		token := sender.tokens["nuevo@example.com"]
+		require.NotEmpty(t, token)
+		stored := repo.users[created.ID]
+		assert.Equal(t, utils.HashToken(token), stored.VerifyToken, "solo se guarda el hash del token")
+		require.NotNil(t, stored.VerifyExpiresAt)
+		assert.WithinDuration(t, time.Now().Add(24*time.Hour), *stored.VerifyExpiresAt, time.Minute)
+
+		// Con la contraseña correcta el error indica que falta verificar; con otra es opaco
+		_, err = uc.ValidateCredentials("nuevo@example.com", "secreto123")
+		assert.ErrorIs(t, err, domain.ErrEmailNotVerified)
+		assert.Equal(t, domain.LoginDiagnosisUnverified, domain.CredentialFailureReason(err))
+		_, err = uc.ValidateCredentials("nuevo@example.com", "otra")
+		assert.ErrorIs(t, err, domain.ErrInvalidPassword)
+
+		diagnosis, err := uc.DiagnoseLogin(&domain.LoginDiagnosisRequest{Email: "nuevo@example.com"})
+		require.NoError(t, err)
+		assert.Equal(t, domain.LoginDiagnosisUnverified, diagnosis.Reason)
+
+		require.NoError(t, uc.VerifyEmail(token))
+		user, err := uc.ValidateCredentials("nuevo@example.com", "secreto123")
+		require.NoError(t, err)
+		assert.Equal(t, domain.UserStatusActive, user.Status)
+
+		assert.ErrorIs(t, uc.VerifyEmail(token), domain.ErrInvalidVerifyToken, "el token solo sirve una vez")
+	})
+
+	t.Run("token expirado", func(t *testing.T) {
+		created, err := uc.CreateUser(&domain.CreateUserRequest{Email: "tarde@example.com", Name: "Tarde", Password: "secreto123"})
+		require.NoError(t, err)
+		expired := time.Now().Add(-time.Second)
+		repo.users[created.ID].VerifyExpiresAt = &expired
+
+		assert.ErrorIs(t, uc.VerifyEmail(sender.tokens["tarde@example.com"]), domain.ErrInvalidVerifyToken)
+		assert.ErrorIs(t, uc.VerifyEmail(""), domain.ErrInvalidVerifyToken)
+	})
+
+	t.Run("un administrador puede omitir la verificación", func(t *testing.T) {
+		created, err := uc.CreateUser(&domain.CreateUserRequest{
+			Email: "admin-creado@example.com", Name: "Creado", Password: "secreto123", SkipVerification: true,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, domain.UserStatusActive, created.Status)
+		assert.NotContains(t, sender.tokens, "admin-creado@example.com")
+	})
+
+	t.Run("sin sender los usuarios se crean activos", func(t *testing.T) {
+		created, err := NewUserUseCase(repo).CreateUser(&domain.CreateUserRequest{
+			Email: "directo@example.com", Name: "Directo", Password: "secreto123",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, domain.UserStatusActive, created.Status)
+	})
+}
+
+func TestResendVerification(t *testing.T) {
+	repo := newFakeUserRepo()
+	sender := newFakeVerificationSender()
+	now := time.Now()
+	uc := NewUserUseCase(repo, WithEmailVerification(sender, 0), WithVerificationResendCooldown(10*time.Minute),
+		WithClock(func() time.Time { return now }))
+
+	created, err := uc.CreateUser(&domain.CreateUserRequest{Email: "pendiente@example.com", Name: "Pendiente", Password: "secreto123"})
+	require.NoError(t, err)
+	first := sender.tokens["pendiente@example.com"]
+
+	t.Run("dentro del cooldown no reenvía", func(t *testing.T) {
+		now = now.Add(time.Minute)
+		require.NoError(t, uc.ResendVerification("Pendiente@Example.com"))
+		assert.Equal(t, first, sender.tokens["pendiente@example.com"])
+	})
+
+	t.Run("pasado el cooldown envía un token nuevo y el anterior deja de servir", func(t *testing.T) {
+		now = now.Add(10 * time.Minute)
+		require.NoError(t, uc.ResendVerification("pendiente@example.com"))
+		second := sender.tokens["pendiente@example.com"]
+		require.NotEqual(t, first, second)
+		assert.Equal(t, utils.HashToken(second), repo.users[created.ID].VerifyToken)
+
+		assert.ErrorIs(t, uc.VerifyEmail(first), domain.ErrInvalidVerifyToken)
+		require.NoError(t, uc.VerifyEmail(second))
+	})
+
+	t.Run("usuarios activos o inexistentes no reciben nada", func(t *testing.T) {
+		now = now.Add(time.Hour)
+		delete(sender.tokens, "pendiente@example.com")
+		require.NoError(t, uc.ResendVerification("pendiente@example.com"))
+		require.NoError(t, uc.ResendVerification("nadie@example.com"))
+		assert.Empty(t, sender.tokens)
+	})
+
+	t.Run("sin verificación configurada", func(t *testing.T) {
+		assert.ErrorIs(t, NewUserUseCase(repo).ResendVerification("pendiente@example.com"), domain.ErrEmailVerificationDisabled)
+	})
+}
+
+func TestPasswordReset(t *testing.T) {
+	active := newStoredUser("activo@example.com", "secreto123", domain.UserStatusActive)
+	inactive := newStoredUser("inactivo@example.com", "secreto123", domain.UserStatusInactive)
+	repo := newFakeUserRepo(active, inactive)
+	sender := newFakePasswordResetSender()
+	var revoked []string
+	uc := NewUserUseCase(repo, WithPasswordReset(sender, 0), WithTokenRevoker(domain.TokenRevokerFunc(func(userID string) (int64, error) {
+		revoked = append(revoked, userID)
+		return 1, nil
+	})))
+
+	t.Run("sin sender no está disponible", func(t *testing.T) {
+		err := NewUserUseCase(repo).RequestPasswordReset("activo@example.com")
+		assert.ErrorIs(t, err, domain.ErrPasswordResetDisabled)
+	})
+
+	t.Run("email desconocido o usuario inactivo no generan token", func(t *testing.T) {
+		require.NoError(t, uc.RequestPasswordReset("nadie@example.com"))
+		require.NoError(t, uc.RequestPasswordReset("inactivo@example.com"))
+		assert.Empty(t, sender.tokens)
+		assert.Empty(t, inactive.PasswordResetToken)
+	})
+
+	t.Run("el token permite cambiar la contraseña una sola vez", func(t *testing.T) {
+		require.NoError(t, uc.RequestPasswordReset("activo@example.com"))
+		token := sender.tokens["activo@example.com"]
+		require.NotEmpty(t, token)
+
+		stored := repo.users[active.ID.Hex()]
+		assert.Equal(t, utils.HashToken(token), stored.PasswordResetToken, "solo se guarda el hash del token")
+		require.NotNil(t, stored.PasswordResetExpiresAt)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), *stored.PasswordResetExpiresAt, time.Minute)
+
+		require.NoError(t, uc.ResetPassword(token, "nueva123"))
+		_, err := uc.ValidateCredentials("activo@example.com", "nueva123")
+		require.NoError(t, err)
+		assert.Equal(t, []string{active.ID.Hex()}, revoked, "el restablecimiento cierra las sesiones abiertas")
+
+		assert.ErrorIs(t, uc.ResetPassword(token, "otra123"), domain.ErrInvalidResetToken)
+		assert.Len(t, revoked, 1)
+	})
+
+	t.Run("token expirado", func(t *testing.T) {
+		require.NoError(t, uc.RequestPasswordReset("activo@example.com"))
+		token := sender.tokens["activo@example.com"]
+		expired := time.Now().Add(-time.Second)
+		repo.users[active.ID.Hex()].PasswordResetExpiresAt = &expired
+
+		assert.ErrorIs(t, uc.ResetPassword(token, "nueva456"), domain.ErrInvalidResetToken)
+	})
+
+	t.Run("token vacío o desconocido", func(t *testing.T) {
+		assert.ErrorIs(t, uc.ResetPassword("", "nueva123"), domain.ErrInvalidResetToken)
+		assert.ErrorIs(t, uc.ResetPassword("no-existe", "nueva123"), domain.ErrInvalidResetToken)
+	})
+
+	t.Run("la vigencia usa el reloj configurado", func(t *testing.T) {
+		now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+		clocked := NewUserUseCase(repo, WithPasswordReset(sender, 0), WithClock(func() time.Time { return now }))
+
+		require.NoError(t, clocked.RequestPasswordReset("activo@example.com"))
+		stored := repo.users[active.ID.Hex()]
+		require.NotNil(t, stored.PasswordResetExpiresAt)
+		assert.Equal(t, now.Add(time.Hour), *stored.PasswordResetExpiresAt)
+
+		// Con el reloj después de la vigencia el token ya no es válido
+		now = now.Add(2 * time.Hour)
+		assert.ErrorIs(t, clocked.ResetPassword(sender.tokens["activo@example.com"], "nueva789"), domain.ErrInvalidResetToken)
+	})
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := utils.PasswordPolicy{MinLength: 8, RequireDigit: true}
+	user := newStoredUser("usuario@example.com", "secreto123", domain.UserStatusActive)
+	repo := newFakeUserRepo(user)
+	sender := newFakePasswordResetSender()
+	uc := NewUserUseCase(repo, WithPasswordPolicy(policy), WithPasswordReset(sender, 0))
+
+	t.Run("alta de usuario", func(t *testing.T) {
+		_, err := uc.CreateUser(&domain.CreateUserRequest{Email: "nuevo@example.com", Name: "Nuevo", Password: "sindigitos"})
+		assert.ErrorIs(t, err, utils.ErrWeakPassword)
+		assert.EqualError(t, err, "la contraseña debe incluir un dígito")
+		assert.Len(t, repo.users, 1, "no se crea el usuario")
+
+		_, err = uc.CreateUser(&domain.CreateUserRequest{Email: "nuevo@example.com", Name: "Nuevo", Password: "valida123"})
+		assert.NoError(t, err)
+	})
+
+	t.Run("cambio de contraseña", func(t *testing.T) {
+		err := uc.ChangePassword(user.ID.Hex(), &domain.ChangePasswordRequest{OldPassword: "secreto123", NewPassword: "corta1"})
+		assert.ErrorIs(t, err, utils.ErrWeakPassword)
+		_, err = uc.ValidateCredentials("usuario@example.com", "secreto123")
+		assert.NoError(t, err, "la contraseña anterior sigue vigente")
+	})
+
+	t.Run("restablecimiento", func(t *testing.T) {
+		require.NoError(t, uc.RequestPasswordReset("usuario@example.com"))
+		token := sender.tokens["usuario@example.com"]
+
+		assert.ErrorIs(t, uc.ResetPassword(token, "123456"), utils.ErrWeakPassword)
+		// Una contraseña rechazada no consume el token
+		assert.NoError(t, uc.ResetPassword(token, "restablecida1"))
+	})
+
+	t.Run("importación", func(t *testing.T) {
+		response, err := uc.ImportUsers([]*domain.UserImportRecord{{Email: "importado@example.com", Name: "Importado", Password: "sindigitos"}})
+		require.NoError(t, err)
+		assert.Equal(t, "la contraseña debe incluir un dígito", response.Results[0].Error)
+	})
+}
+
+func TestUserUseCaseErrorsUnwrap(t *testing.T) {
+	t.Run("email duplicado", func(t *testing.T) {
+		uc := NewUserUseCase(newFakeUserRepo(newStoredUser("activo@example.com", "secreto123", domain.UserStatusActive)))
+
+		_, err := uc.CreateUser(&domain.CreateUserRequest{Email: "activo@example.com", Name: "Otro", Password: "secreto123"})
+		assert.ErrorIs(t, err, domain.ErrEmailAlreadyRegistered)
+		assert.Equal(t, "el email ya está registrado", err.Error())
+	})
+
+	t.Run("usuario inexistente conserva ErrUserNotFound", func(t *testing.T) {
+		uc := NewUserUseCase(newFakeUserRepo())
+
+		_, err := uc.GetUser("no-existe")
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+		assert.Contains(t, err.Error(), "no-existe")
+	})
+
+	t.Run("fallo del repositorio no se confunde con email libre", func(t *testing.T) {
+		dbErr := errors.New("conexión perdida")
+		repo := newFakeUserRepo()
+		repo.err = dbErr
+		uc := NewUserUseCase(repo)
+
+		_, err := uc.CreateUser(&domain.CreateUserRequest{Email: "nuevo@example.com", Name: "Nuevo", Password: "secreto123"})
+		assert.ErrorIs(t, err, dbErr)
+		assert.Empty(t, repo.users, "no se debe crear el usuario")
+	})
+
+	t.Run("credenciales conservan la causa sin cambiar el mensaje", func(t *testing.T) {
+		dbErr := errors.New("conexión perdida")
+		repo := newFakeUserRepo()
+		repo.err = dbErr
+		uc := NewUserUseCase(repo)
+
+		_, err := uc.ValidateCredentials("activo@example.com", "secreto123")
+		assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
+		assert.ErrorIs(t, err, dbErr)
+	})
+
+	t.Run("contraseña antigua incorrecta", func(t *testing.T) {
+		user := newStoredUser("activo@example.com", "secreto123", domain.UserStatusActive)
+		uc := NewUserUseCase(newFakeUserRepo(user))
+
+		err := uc.ChangePassword(user.ID.Hex(), &domain.ChangePasswordRequest{OldPassword: "otra", NewPassword: "nueva123"})
+		assert.ErrorIs(t, err, domain.ErrIncorrectOldPassword)
+	})
+}
+
+func TestUserMetadata(t *testing.T) {
+	repo := newFakeUserRepo()
+	uc := NewUserUseCase(repo)
+
+	created, err := uc.CreateUser(&domain.CreateUserRequest{
+		Email:    "meta@example.com",
+		Name:     "Con metadatos",
+		Password: "secreto123",
+		Metadata: map[string]interface{}{"department": "ventas", "employee_id": 1234.0},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "ventas", created.Metadata["department"])
+
+	t.Run("actualizar combina y elimina claves", func(t *testing.T) {
+		updated, err := uc.UpdateUser(created.ID, &domain.UpdateUserRequest{
+			Metadata: map[string]interface{}{"department": "soporte", "employee_id": nil},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"department": "soporte"}, updated.Metadata)
+
+		fetched, err := uc.GetUser(created.ID)
+		require.NoError(t, err)
+		assert.Equal(t, updated.Metadata, fetched.Metadata)
+	})
+
+	t.Run("actualizar sin metadatos los conserva", func(t *testing.T) {
+		updated, err := uc.UpdateUser(created.ID, &domain.UpdateUserRequest{Name: "Otro nombre"})
+		require.NoError(t, err)
+		assert.Equal(t, "soporte", updated.Metadata["department"])
+	})
+
+	t.Run("rechaza claves no válidas", func(t *testing.T) {
+		_, err := uc.CreateUser(&domain.CreateUserRequest{
+			Email:    "otro@example.com",
+			Name:     "Otro",
+			Password: "secreto123",
+			Metadata: map[string]interface{}{"$set": "x"},
+		})
+		assert.ErrorIs(t, err, utils.ErrInvalidMetadata)
+
+		_, err = uc.UpdateUser(created.ID, &domain.UpdateUserRequest{
+			Metadata: map[string]interface{}{"a.b": "x"},
+		})
+		assert.ErrorIs(t, err, utils.ErrInvalidMetadata)
+	})
+
+	t.Run("rechaza superar el límite de claves tras combinar", func(t *testing.T) {
+		changes := make(map[string]interface{})
+		for i := 0; i < utils.MaxMetadataKeys; i++ {
+			changes[fmt.Sprintf("clave%d", i)] = i
+		}
+		_, err := uc.UpdateUser(created.ID, &domain.UpdateUserRequest{Metadata: changes})
+		assert.ErrorIs(t, err, utils.ErrInvalidMetadata)
+	})
+}
+
+func TestGetAllUsersPaginates(t *testing.T) {
+	uc := NewUserUseCase(newFakeUserRepo(
+		newStoredUser("uno@example.com", "secreto123", domain.UserStatusActive),
+		newStoredUser("dos@example.com", "secreto123", domain.UserStatusActive),
+		newStoredUser("tres@example.com", "secreto123", domain.UserStatusActive),
+		newStoredUser("inactivo@example.com", "secreto123", domain.UserStatusInactive),
+	))
+
+	result, err := uc.GetAllUsers(map[string]interface{}{"status": domain.UserStatusActive}, 2, 2)
+	require.NoError(t, err)
+	assert.Len(t, result.Items, 1, "la última página solo tiene el usuario restante")
+	assert.Equal(t, int64(3), result.Total, "el total cuenta todas las coincidencias, no solo la página")
+}
+
+func TestRecordLogin(t *testing.T) {
+	user := newStoredUser("usuario@example.com", "secreto123", domain.UserStatusActive)
+	user.Version = 3
+	uc := NewUserUseCase(newFakeUserRepo(user))
+
+	result, err := uc.GetAllUsers(nil, 0, 10)
+	require.NoError(t, err)
+	users := result.Items
+	require.Len(t, users, 1)
+	assert.Nil(t, users[0].LastLoginAt, "sin inicios de sesión no se informa la fecha")
+
+	before := time.Now()
+	require.NoError(t, uc.RecordLogin(user.ID.Hex(), "203.0.113.10"))
+
+	result, err = uc.GetAllUsers(nil, 0, 10)
+	require.NoError(t, err)
+	users = result.Items
+	require.NotNil(t, users[0].LastLoginAt)
+	assert.False(t, users[0].LastLoginAt.Before(before))
+	assert.Equal(t, "203.0.113.10", users[0].LastLoginIP)
+	assert.Equal(t, int64(3), users[0].Version, "registrar el inicio de sesión no cambia la versión")
+}
+
+func TestClockSetsPersistedTimestamps(t *testing.T) {
+	now := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	repo := newFakeUserRepo()
+	uc := NewUserUseCase(repo, WithClock(func() time.Time { return now }))
+
+	created, err := uc.CreateUser(&domain.CreateUserRequest{Email: "reloj@example.com", Name: "Reloj", Password: "secreto123"})
+	require.NoError(t, err)
+	assert.Equal(t, now, repo.users[created.ID].CreatedAt)
+	assert.Equal(t, now, repo.users[created.ID].UpdatedAt)
+
+	now = now.Add(time.Hour)
+	_, err = uc.UpdateUser(created.ID, &domain.UpdateUserRequest{Name: "Reloj actualizado"})
+	require.NoError(t, err)
+	assert.Equal(t, now, repo.users[created.ID].UpdatedAt)
+
+	now = now.Add(time.Hour)
+	require.NoError(t, uc.ChangePassword(created.ID, &domain.ChangePasswordRequest{OldPassword: "secreto123", NewPassword: "otroSecreto456"}))
+	assert.Equal(t, now, repo.users[created.ID].UpdatedAt)
+
+	now = now.Add(time.Hour)
+	require.NoError(t, uc.RecordLogin(created.ID, "203.0.113.10"))
+	require.NotNil(t, repo.users[created.ID].LastLoginAt)
+	assert.Equal(t, now, *repo.users[created.ID].LastLoginAt)
+
+	now = now.Add(time.Hour)
+	_, err = uc.ImportUsers([]*domain.UserImportRecord{{Email: "importado@example.com", Name: "Importado"}})
+	require.NoError(t, err)
+	imported, err := repo.GetByEmail("importado@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, now, imported.CreatedAt)
+	assert.Equal(t, now, imported.UpdatedAt)
+}
+
+func TestRestoreUser(t *testing.T) {
+	t.Run("reactiva un usuario archivado", func(t *testing.T) {
+		archived := newStoredUser("archivado@example.com", "secreto123", domain.UserStatusArchived)
+		repo := newFakeUserRepo(archived)
+		uc := NewUserUseCase(repo)
+
+		require.NoError(t, uc.RestoreUser(archived.ID.Hex()))
+		assert.Equal(t, domain.UserStatusActive, repo.users[archived.ID.Hex()].Status)
+		assert.Nil(t, repo.users[archived.ID.Hex()].ArchivedAt)
+	})
+
+	t.Run("un usuario no archivado no se restaura", func(t *testing.T) {
+		active := newStoredUser("activo@example.com", "secreto123", domain.UserStatusActive)
+		uc := NewUserUseCase(newFakeUserRepo(active))
+
+		assert.ErrorIs(t, uc.RestoreUser(active.ID.Hex()), domain.ErrUserNotArchived)
+	})
+
+	t.Run("otra cuenta activa usa el email", func(t *testing.T) {
+		archived := newStoredUser("Compartido@Example.com", "secreto123", domain.UserStatusArchived)
+		active := newStoredUser("compartido@example.com", "secreto123", domain.UserStatusActive)
+		repo := newFakeUserRepo(archived, active)
+		uc := NewUserUseCase(repo)
+
+		assert.ErrorIs(t, uc.RestoreUser(archived.ID.Hex()), domain.ErrRestoreEmailInUse)
+		assert.Equal(t, domain.UserStatusArchived, repo.users[archived.ID.Hex()].Status)
+	})
+
+	t.Run("otra cuenta archivada con el email no lo impide", func(t *testing.T) {
+		archived := newStoredUser("compartido@example.com", "secreto123", domain.UserStatusArchived)
+		other := newStoredUser("compartido@example.com", "secreto123", domain.UserStatusArchived)
+		repo := newFakeUserRepo(archived, other)
+		uc := NewUserUseCase(repo)
+
+		require.NoError(t, uc.RestoreUser(archived.ID.Hex()))
+		assert.Equal(t, domain.UserStatusActive, repo.users[archived.ID.Hex()].Status)
+	})
+
+	t.Run("usuario inexistente", func(t *testing.T) {
+		uc := NewUserUseCase(newFakeUserRepo())
+
+		assert.ErrorIs(t, uc.RestoreUser("no-existe"), domain.ErrUserNotFound)
+	})
+}
+
+func TestDeactivationRevokesTokens(t *testing.T) {
+	setup := func(revokeErr error) (domain.UserUseCase, *domain.User, *[]string) {
+		user := newStoredUser("activo@example.com", "secreto123", domain.UserStatusActive)
+		var revoked []string
+		uc := NewUserUseCase(newFakeUserRepo(user), WithTokenRevoker(domain.TokenRevokerFunc(func(userID string) (int64, error) {
+			revoked = append(revoked, userID)
+			return 1, revokeErr
+		})))
+		return uc, user, &revoked
+	}
+
+	t.Run("archivar revoca las sesiones", func(t *testing.T) {
+		uc, user, revoked := setup(nil)
+
+		require.NoError(t, uc.ArchiveUser(user.ID.Hex()))
+		assert.Equal(t, []string{user.ID.Hex()}, *revoked)
+
+		// Un usuario inexistente no llega a revocarse
+		assert.ErrorIs(t, uc.ArchiveUser("no-existe"), domain.ErrUserNotFound)
+		assert.Len(t, *revoked, 1)
+	})
+
+	t.Run("desactivar revoca las sesiones", func(t *testing.T) {
+		uc, user, revoked := setup(nil)
+
+		_, err := uc.UpdateUser(user.ID.Hex(), &domain.UpdateUserRequest{Name: "Otro nombre"})
+		require.NoError(t, err)
+		assert.Empty(t, *revoked)
+
+		_, err = uc.UpdateUser(user.ID.Hex(), &domain.UpdateUserRequest{Status: domain.UserStatusInactive})
+		require.NoError(t, err)
+		assert.Equal(t, []string{user.ID.Hex()}, *revoked)
+
+		// Reactivar no revoca nada
+		_, err = uc.UpdateUser(user.ID.Hex(), &domain.UpdateUserRequest{Status: domain.UserStatusActive})
+		require.NoError(t, err)
+		assert.Len(t, *revoked, 1)
+	})
+
+	t.Run("un fallo al revocar se informa", func(t *testing.T) {
+		revokeErr := errors.New("conexión perdida")
+		uc, user, _ := setup(revokeErr)
+
+		err := uc.ArchiveUser(user.ID.Hex())
+		assert.ErrorIs(t, err, revokeErr)
+		assert.Equal(t, domain.UserStatusArchived, user.Status, "el usuario ya se archivó")
+	})
+}
+
+func TestDeleteUserRemovesSessionsAndRoles(t *testing.T) {
+	user := newStoredUser("activo@example.com", "secreto123", domain.UserStatusActive)
+	repo := newFakeUserRepo(user)
+	roles := newFakeRoleInitializer()
+	var revoked []string
+	uc := NewUserUseCase(repo, WithRoleAssignmentRemover(roles),
+		WithTokenRevoker(domain.TokenRevokerFunc(func(userID string) (int64, error) {
+			revoked = append(revoked, userID)
+			return 1, nil
+		})))
+
+	require.NoError(t, uc.DeleteUser(user.ID.Hex()))
+	assert.NotContains(t, repo.users, user.ID.Hex())
+	assert.Equal(t, []string{user.ID.Hex()}, revoked)
+	assert.Equal(t, []string{user.ID.Hex()}, roles.deleted)
+}
+
+func TestDeleteOwnAccount(t *testing.T) {
+	setup := func() (domain.UserUseCase, *domain.User, *[]string, *fakeRoleInitializer, *[]string) {
+		user := newStoredUser("activo@example.com", "secreto123", domain.UserStatusActive)
+		var revoked, deleted []string
+		roles := newFakeRoleInitializer()
+		uc := NewUserUseCase(newFakeUserRepo(user),
+			WithTokenRevoker(domain.TokenRevokerFunc(func(userID string) (int64, error) {
+				revoked = append(revoked, userID)
+				return 1, nil
+			})),
+			WithRoleAssignmentRemover(roles),
+			WithAccountDeletionRecorder(domain.AccountDeletionRecorderFunc(func(userID string) {
+				deleted = append(deleted, userID)
+			})),
+		)
+		return uc, user, &revoked, roles, &deleted
+	}
+
+	t.Run("con la contraseña correcta", func(t *testing.T) {
+		uc, user, revoked, roles, deleted := setup()
+		userID := user.ID.Hex()
+
+		require.NoError(t, uc.DeleteOwnAccount(userID, &domain.DeleteAccountRequest{Password: "secreto123"}))
+		assert.Equal(t, domain.UserStatusArchived, user.Status)
+		assert.NotNil(t, user.ArchivedAt)
+		assert.Equal(t, []string{userID}, *revoked)
+		assert.Equal(t, []string{userID}, roles.cleared)
+		assert.Equal(t, []string{userID}, *deleted)
+
+		// La cuenta eliminada ya no puede iniciar sesión
+		_, err := uc.ValidateCredentials("activo@example.com", "secreto123")
+		assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
+	})
+
+	t.Run("con una contraseña incorrecta", func(t *testing.T) {
+		uc, user, revoked, roles, deleted := setup()
+
+		err := uc.DeleteOwnAccount(user.ID.Hex(), &domain.DeleteAccountRequest{Password: "otra-clave"})
+		assert.ErrorIs(t, err, domain.ErrPasswordConfirmation)
+		assert.Equal(t, domain.UserStatusActive, user.Status)
+		assert.Empty(t, *revoked)
+		assert.Empty(t, roles.cleared)
+		assert.Empty(t, *deleted)
+	})
+
+	t.Run("un fallo al quitar los roles se informa", func(t *testing.T) {
+		uc, user, _, roles, deleted := setup()
+		roles.err = errors.New("conexión perdida")
+
+		err := uc.DeleteOwnAccount(user.ID.Hex(), &domain.DeleteAccountRequest{Password: "secreto123"})
+		assert.ErrorIs(t, err, roles.err)
+		assert.Equal(t, domain.UserStatusArchived, user.Status, "la cuenta ya se archivó")
+		assert.Empty(t, *deleted)
+	})
+}
+
+func TestTwoFactor(t *testing.T) {
+	now := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	user := newStoredUser("ana@example.com", "secreto123", domain.UserStatusActive)
+	repo := newFakeUserRepo(user)
+	uc := NewUserUseCase(repo, WithTwoFactor("", 1), WithClock(func() time.Time { return now }))
+	userID := user.ID.Hex()
+
+	// Sin secreto no hay nada que verificar ni desactivar
+	assert.ErrorIs(t, uc.VerifyTwoFactor(userID, "123456"), domain.ErrTwoFactorNotEnabled)
+	assert.ErrorIs(t, uc.DisableTwoFactor(userID, "123456"), domain.ErrTwoFactorNotEnabled)
+
+	setup, err := uc.EnableTwoFactor(userID)
+	require.NoError(t, err)
+	assert.NotEmpty(t, setup.Secret)
+	assert.Contains(t, setup.ProvisioningURI, "otpauth://totp/mi-proyecto:ana@example.com")
+	// El secreto queda pendiente hasta confirmar el primer código
+	assert.Equal(t, setup.Secret, repo.users[userID].TwoFactorSecret)
+	assert.False(t, repo.users[userID].TwoFactorEnabled)
+
+	assert.ErrorIs(t, uc.VerifyTwoFactor(userID, "000000"), domain.ErrInvalidOTP)
+	assert.False(t, repo.users[userID].TwoFactorEnabled)
+
+	code, err := utils.TOTPCode(setup.Secret, now)
+	require.NoError(t, err)
+	require.NoError(t, uc.VerifyTwoFactor(userID, code))
+	assert.True(t, repo.users[userID].TwoFactorEnabled)
+
+	t.Run("un código aceptado no se acepta otra vez", func(t *testing.T) {
+		assert.ErrorIs(t, uc.VerifyTwoFactor(userID, code), domain.ErrInvalidOTP)
+
+		// Tampoco uno de un periodo anterior dentro de la ventana
+		previous, err := utils.TOTPCode(setup.Secret, now.Add(-utils.TOTPPeriod))
+		require.NoError(t, err)
+		assert.ErrorIs(t, uc.VerifyTwoFactor(userID, previous), domain.ErrInvalidOTP)
+	})
+
+	t.Run("ventana de tolerancia", func(t *testing.T) {
+		now = now.Add(2 * utils.TOTPPeriod)
+		previous, err := utils.TOTPCode(setup.Secret, now.Add(-utils.TOTPPeriod))
+		require.NoError(t, err)
+		assert.NoError(t, uc.VerifyTwoFactor(userID, previous))
+
+		now = now.Add(3 * utils.TOTPPeriod)
+		stale, err := utils.TOTPCode(setup.Secret, now.Add(-2*utils.TOTPPeriod))
+		require.NoError(t, err)
+		assert.ErrorIs(t, uc.VerifyTwoFactor(userID, stale), domain.ErrInvalidOTP)
+	})
+
+	t.Run("no se regenera un secreto activo", func(t *testing.T) {
+		_, err := uc.EnableTwoFactor(userID)
+		assert.ErrorIs(t, err, domain.ErrTwoFactorEnabled)
+		assert.Equal(t, setup.Secret, repo.users[userID].TwoFactorSecret)
+	})
+
+	t.Run("desactivar exige un código válido", func(t *testing.T) {
+		assert.ErrorIs(t, uc.DisableTwoFactor(userID, "000000"), domain.ErrInvalidOTP)
+		assert.True(t, repo.users[userID].TwoFactorEnabled)
+
+		now = now.Add(utils.TOTPPeriod)
+		current, err := utils.TOTPCode(setup.Secret, now)
+		require.NoError(t, err)
+		require.NoError(t, uc.DisableTwoFactor(userID, current))
+		assert.False(t, repo.users[userID].TwoFactorEnabled)
+		assert.Empty(t, repo.users[userID].TwoFactorSecret)
+	})
+}
+
+func TestTwoFactorLockout(t *testing.T) {
+	now := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	user := newStoredUser("ana@example.com", "secreto123", domain.UserStatusActive)
+	repo := newFakeUserRepo(user)
+	uc := NewUserUseCase(repo, WithTwoFactorLockout(3, 10*time.Minute), WithClock(func() time.Time { return now }))
+	userID := user.ID.Hex()
+
+	setup, err := uc.EnableTwoFactor(userID)
+	require.NoError(t, err)
+	code, err := utils.TOTPCode(setup.Secret, now)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		assert.ErrorIs(t, uc.VerifyTwoFactor(userID, "000000"), domain.ErrInvalidOTP)
+	}
+	// Bloqueada, ni siquiera el código correcto se acepta
+	assert.ErrorIs(t, uc.VerifyTwoFactor(userID, code), domain.ErrTwoFactorLocked)
+	assert.False(t, repo.users[userID].TwoFactorEnabled)
+
+	now = now.Add(10 * time.Minute)
+	code, err = utils.TOTPCode(setup.Secret, now)
+	require.NoError(t, err)
+	require.NoError(t, uc.VerifyTwoFactor(userID, code))
+	assert.True(t, repo.users[userID].TwoFactorEnabled)
+	assert.Zero(t, repo.users[userID].TwoFactorFailures)
+}
+
+func TestTwoFactorEncryptsSecret(t *testing.T) {
+	now := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	user := newStoredUser("ana@example.com", "secreto123", domain.UserStatusActive)
+	repo := newFakeUserRepo(user)
+	box, err := utils.NewSecretBox("clave-de-prueba")
+	require.NoError(t, err)
+	uc := NewUserUseCase(repo, WithTwoFactorEncryption(box), WithClock(func() time.Time { return now }))
+	userID := user.ID.Hex()
+
+	setup, err := uc.EnableTwoFactor(userID)
+	require.NoError(t, err)
+	stored := repo.users[userID].TwoFactorSecret
+	assert.NotContains(t, stored, setup.Secret)
+	opened, err := box.Open(stored)
+	require.NoError(t, err)
+	assert.Equal(t, setup.Secret, opened)
+
+	code, err := utils.TOTPCode(setup.Secret, now)
+	require.NoError(t, err)
+	require.NoError(t, uc.VerifyTwoFactor(userID, code))
+
+	t.Run("secreto guardado antes de cifrar", func(t *testing.T) {
+		repo.users[userID].TwoFactorSecret = setup.Secret
+		now = now.Add(utils.TOTPPeriod)
+		code, err := utils.TOTPCode(setup.Secret, now)
+		require.NoError(t, err)
+		assert.NoError(t, uc.VerifyTwoFactor(userID, code))
+	})
+}
+
+func TestCreateUserInitializesRoleAssignment(t *testing.T) {
+	req := &domain.CreateUserRequest{Email: "nuevo@example.com", Name: "Nuevo", Password: "secreto123"}
+
+	t.Run("el usuario nuevo tiene asignación de inmediato", func(t *testing.T) {
+		initializer := newFakeRoleInitializer()
+		uc := NewUserUseCase(newFakeUserRepo(), WithRoleInitializer(initializer))
+
+		created, err := uc.CreateUser(req)
+		require.NoError(t, err)
+		assert.True(t, initializer.assigned[created.ID])
+	})
+
+	t.Run("un fallo al crear la asignación no impide crear el usuario", func(t *testing.T) {
+		initializer := newFakeRoleInitializer()
+		initializer.err = errors.New("sin conexión")
+		repo := newFakeUserRepo()
+		uc := NewUserUseCase(repo, WithRoleInitializer(initializer))
+
+		created, err := uc.CreateUser(req)
+		require.NoError(t, err)
+		assert.Contains(t, repo.users, created.ID)
+	})
+}
+
+func TestReconcileRoleAssignments(t *testing.T) {
+	withAssignment := newStoredUser("con@example.com", "secreto123", domain.UserStatusActive)
+	withoutAssignment := newStoredUser("sin@example.com", "secreto123", domain.UserStatusActive)
+	archived := newStoredUser("archivado@example.com", "secreto123", domain.UserStatusArchived)
+	repo := newFakeUserRepo(withAssignment, withoutAssignment, archived)
+
+	initializer := newFakeRoleInitializer()
+	initializer.assigned[withAssignment.ID.Hex()] = true
+	uc := NewUserUseCase(repo, WithRoleInitializer(initializer))
+
+	created, err := uc.ReconcileRoleAssignments()
+	require.NoError(t, err)
+	assert.Equal(t, 2, created)
+	assert.Equal(t, 1, initializer.batches, "los usuarios se aseguran en una sola escritura por lote")
+	assert.True(t, initializer.assigned[withoutAssignment.ID.Hex()])
+	assert.True(t, initializer.assigned[archived.ID.Hex()])
+
+	// Una segunda ejecución no encuentra usuarios pendientes
+	created, err = uc.ReconcileRoleAssignments()
+	require.NoError(t, err)
+	assert.Zero(t, created)
+
+	t.Run("propaga errores del inicializador", func(t *testing.T) {
+		cause := errors.New("sin conexión")
+		initializer.err = cause
+		_, err := uc.ReconcileRoleAssignments()
+		assert.ErrorIs(t, err, cause)
+	})
+
+	t.Run("sin inicializador no hace nada", func(t *testing.T) {
+		created, err := NewUserUseCase(repo).ReconcileRoleAssignments()
+		require.NoError(t, err)
+		assert.Zero(t, created)
+	})
+}
+
+func TestEmailCaseInsensitive(t *testing.T) {
+	repo := newFakeUserRepo()
+	uc := NewUserUseCase(repo)
+
+	created, err := uc.CreateUser(&domain.CreateUserRequest{Email: " Ana@Example.com ", Name: "Ana", Password: "secreto123"})
+	require.NoError(t, err)
+	assert.Equal(t, "ana@example.com", created.Email)
+
+	t.Run("rechaza registrar el mismo email con otras mayúsculas", func(t *testing.T) {
+		_, err := uc.CreateUser(&domain.CreateUserRequest{Email: "ANA@example.COM", Name: "Otra Ana", Password: "secreto123"})
+		assert.ErrorIs(t, err, domain.ErrEmailAlreadyRegistered)
+		assert.Len(t, repo.users, 1)
+	})
+
+	t.Run("las búsquedas ignoran las mayúsculas", func(t *testing.T) {
+		user, err := uc.ValidateCredentials("ANA@EXAMPLE.COM", "secreto123")
+		require.NoError(t, err)
+		assert.Equal(t, created.ID, user.ID.Hex())
+
+		user, err = uc.GetUserByEmail("Ana@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, created.ID, user.ID.Hex())
+	})
+
+	t.Run("la edición normaliza el email y detecta duplicados", func(t *testing.T) {
+		other, err := uc.CreateUser(&domain.CreateUserRequest{Email: "luis@example.com", Name: "Luis", Password: "secreto123"})
+		require.NoError(t, err)
+
+		_, err = uc.UpdateUser(other.ID, &domain.UpdateUserRequest{Email: "ANA@example.com"})
+		assert.ErrorIs(t, err, domain.ErrEmailAlreadyRegistered)
+
+		updated, err := uc.UpdateUser(other.ID, &domain.UpdateUserRequest{Email: "Luis.Perez@Example.com"})
+		require.NoError(t, err)
+		assert.Equal(t, "luis.perez@example.com", updated.Email)
+	})
+}
+
+func TestUpdateUserRejectsUnknownStatus(t *testing.T) {
+	user := newStoredUser("activo@example.com", "secreto123", domain.UserStatusActive)
+	repo := newFakeUserRepo(user)
+	uc := NewUserUseCase(repo)
+
+	_, err := uc.UpdateUser(user.ID.Hex(), &domain.UpdateUserRequest{Status: "eliminado"})
+	assert.ErrorIs(t, err, domain.ErrInvalidUserStatus)
+	assert.Equal(t, domain.UserStatusActive, repo.users[user.ID.Hex()].Status)
+
+	updated, err := uc.UpdateUser(user.ID.Hex(), &domain.UpdateUserRequest{Status: domain.UserStatusInactive})
+	require.NoError(t, err)
+	assert.Equal(t, domain.UserStatusInactive, updated.Status)
+}
+
+func TestUpdateUserOptimisticConcurrency(t *testing.T) {
+	user := newStoredUser("activo@example.com", "secreto123", domain.UserStatusActive)
+	repo := newFakeUserRepo(user)
+	uc := NewUserUseCase(repo)
+
+	read, err := uc.GetUser(user.ID.Hex())
+	require.NoError(t, err)
+	version := read.Version
+
+	// El primer administrador guarda con la versión que leyó
+	updated, err := uc.UpdateUser(user.ID.Hex(), &domain.UpdateUserRequest{Name: "Primero", ExpectedVersion: &version})
+	require.NoError(t, err)
+	assert.Equal(t, version+1, updated.Version)
+
+	// El segundo, con la misma versión, ya no puede sobrescribir el cambio
+	_, err = uc.UpdateUser(user.ID.Hex(), &domain.UpdateUserRequest{Name: "Segundo", ExpectedVersion: &version})
+	assert.ErrorIs(t, err, utils.ErrVersionConflict)
+	assert.Equal(t, "Primero", repo.users[user.ID.Hex()].Name)
+
+	t.Run("If-Unmodified-Since anterior a la última modificación", func(t *testing.T) {
+		before := repo.users[user.ID.Hex()].UpdatedAt.Add(-time.Minute)
+		_, err := uc.UpdateUser(user.ID.Hex(), &domain.UpdateUserRequest{Name: "Tercero", UnmodifiedSince: &before})
+		assert.ErrorIs(t, err, utils.ErrVersionConflict)
+
+		after := repo.users[user.ID.Hex()].UpdatedAt.Add(time.Minute)
+		_, err = uc.UpdateUser(user.ID.Hex(), &domain.UpdateUserRequest{Name: "Tercero", UnmodifiedSince: &after})
+		assert.NoError(t, err)
+	})
+
+	t.Run("un inicio de sesión no invalida If-Unmodified-Since", func(t *testing.T) {
+		read, err := uc.GetUser(user.ID.Hex())
+		require.NoError(t, err)
+		unmodifiedSince := read.UpdatedAt.Time
+
+		require.NoError(t, uc.UpdateRefreshToken(user.ID.Hex(), "hash-token"))
+		require.NoError(t, uc.RecordLogin(user.ID.Hex(), "203.0.113.10"))
+
+		_, err = uc.UpdateUser(user.ID.Hex(), &domain.UpdateUserRequest{Name: "Cuarto", UnmodifiedSince: &unmodifiedSince})
+		assert.NoError(t, err)
+	})
+}
+
+func TestGetUsersAfterIteratesWithoutSkipsOrDuplicates(t *testing.T) {
+	// Varios usuarios comparten created_at: el _id desempata. Las fechas tienen precisión de
+	// milisegundos, igual que en MongoDB.
+	base := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	var users []*domain.User
+	for i := 0; i < 23; i++ {
+		user := newStoredUser(fmt.Sprintf("usuario%02d@example.com", i), "secreto123", domain.UserStatusActive)
+		user.CreatedAt = base.Add(-time.Duration(i/3) * time.Minute) // Grupos de 3: las páginas de 4 cortan empates
+		users = append(users, user)
+	}
+	repo := newFakeUserRepo(users...)
+	uc := NewUserUseCase(repo)
+	filter := map[string]interface{}{"status": domain.UserStatusActive}
+
+	seen := make(map[string]int)
+	var order []*domain.UserResponse
+	cursor := ""
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 10, "la iteración debe terminar")
+
+		page, next, err := uc.GetUsersAfter(filter, cursor, 4)
+		require.NoError(t, err)
+		for _, user := range page {
+			seen[user.Email]++
+			order = append(order, user)
+		}
+
+		// Los usuarios creados durante la iteración quedan antes del cursor y no alteran
+		// las páginas siguientes
+		newer := newStoredUser(fmt.Sprintf("nuevo%02d@example.com", pages), "secreto123", domain.UserStatusActive)
+		newer.CreatedAt = base.Add(time.Hour)
+		require.NoError(t, repo.Create(newer))
+
+		if next == "" {
+			assert.Len(t, page, 3, "la última página contiene el resto")
+			break
+		}
+		assert.Len(t, page, 4)
+		cursor = next
+	}
+
+	require.Len(t, seen, len(users), "cada usuario original aparece")
+	for _, user := range users {
+		assert.Equal(t, 1, seen[user.Email], "%s debe aparecer exactamente una vez", user.Email)
+	}
+	for i := 1; i < len(order); i++ {
+		assert.False(t, order[i].CreatedAt.After(order[i-1].CreatedAt.Time), "orden descendente por created_at")
+	}
+}
+
+func TestGetUsersAfterRejectsInvalidCursor(t *testing.T) {
+	uc := NewUserUseCase(newFakeUserRepo())
+
+	_, _, err := uc.GetUsersAfter(nil, "no-es-un-cursor", 10)
+	assert.ErrorIs(t, err, utils.ErrInvalidCursor)
+}
+
+func TestNewUserUseCaseOptions(t *testing.T) {
+	repo := newFakeUserRepo()
+
+	t.Run("sin opciones usa los valores por defecto", func(t *testing.T) {
+		uc := NewUserUseCase(repo).(*userUseCase)
+		assert.Equal(t, defaultPasswordResetTTL, uc.passwordResetTTL)
+		assert.Equal(t, defaultVerifyTTL, uc.verifyTTL)
+		assert.Equal(t, utils.DefaultPasswordPolicy(), uc.passwordPolicy)
+		assert.Equal(t, defaultTwoFactorIssuer, uc.twoFactorIssuer)
+		assert.Zero(t, uc.twoFactorWindow)
+		assert.Nil(t, uc.resetSender)
+		assert.Nil(t, uc.verifySender)
+		assert.Nil(t, uc.roleInitializer)
+		assert.Nil(t, uc.tokenRevoker)
+		assert.NotNil(t, uc.now)
+	})
+
+	t.Run("aplica las opciones", func(t *testing.T) {
+		now := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+		sender := newFakePasswordResetSender()
+		policy := utils.PasswordPolicy{MinLength: 12}
+		uc := NewUserUseCase(repo,
+			WithPasswordReset(sender, 10*time.Minute),
+			WithPasswordPolicy(policy),
+			WithTwoFactor("empresa", 2),
+			WithClock(func() time.Time { return now }),
+		).(*userUseCase)
+		assert.Equal(t, 10*time.Minute, uc.passwordResetTTL)
+		assert.Same(t, sender, uc.resetSender)
+		assert.Equal(t, policy, uc.passwordPolicy)
+		assert.Equal(t, "empresa", uc.twoFactorIssuer)
+		assert.Equal(t, 2, uc.twoFactorWindow)
+		assert.Equal(t, now, uc.now())
+	})
+
+	t.Run("vigencia y emisor vacíos conservan los valores por defecto", func(t *testing.T) {
+		uc := NewUserUseCase(repo, WithPasswordReset(newFakePasswordResetSender(), 0), WithTwoFactor("", 1)).(*userUseCase)
+		assert.Equal(t, defaultPasswordResetTTL, uc.passwordResetTTL)
+		assert.Equal(t, defaultTwoFactorIssuer, uc.twoFactorIssuer)
+		assert.Equal(t, 1, uc.twoFactorWindow)
+	})
+}
@@ -37,6 +37,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 
 	oauthDelivery "github.com/black4ninja/mi-proyecto/internal/oauth/delivery"
+	oauthDomain "github.com/black4ninja/mi-proyecto/internal/oauth/domain"
 	oauthRepo "github.com/black4ninja/mi-proyecto/internal/oauth/repository"
 	oauthUseCase "github.com/black4ninja/mi-proyecto/internal/oauth/usecase"
 	userDelivery "github.com/black4ninja/mi-proyecto/internal/user/delivery"
@@ -46,9 +47,15 @@ import (
 	"github.com/black4ninja/mi-proyecto/pkg/middleware"
 
 	permissionDelivery "github.com/black4ninja/mi-proyecto/internal/permission/delivery"
+	permissionDomain "github.com/black4ninja/mi-proyecto/internal/permission/domain"
 	permissionRepo "github.com/black4ninja/mi-proyecto/internal/permission/repository"
 	permissionUseCase "github.com/black4ninja/mi-proyecto/internal/permission/usecase"
 
+	auditDelivery "github.com/black4ninja/mi-proyecto/internal/audit/delivery"
+	auditDomain "github.com/black4ninja/mi-proyecto/internal/audit/domain"
+	auditRepo "github.com/black4ninja/mi-proyecto/internal/audit/repository"
+	auditUseCase "github.com/black4ninja/mi-proyecto/internal/audit/usecase"
+
 	_ "github.com/black4ninja/mi-proyecto/docs" // Importa los archivos generados por swag
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
@@ -60,6 +67,21 @@ func main() {
 		log.Println("Archivo .env no encontrado, usando variables de entorno del sistema")
 	}
 
+	// Cargar configuración de la aplicación
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Error al cargar la configuración: %v", err)
+	}
+
+	// Verificar TLS y cookies antes de iniciar (en producción exige TLS salvo TLS_ENFORCEMENT=warn)
+	securityWarnings, err := cfg.CheckTransportSecurity()
+	if err != nil {
+		log.Fatalf("Configuración de seguridad no válida: %v", err)
+	}
+	for _, warning := range securityWarnings {
+		log.Printf("[WARN] %s", warning)
+	}
+
 	// Configurar MongoDB
 	mongoURI := getEnv("MONGO_URI", "mongodb://localhost:27017")
 	mongoDBName := getEnv("MONGO_DB", "my_database")
@@ -77,8 +99,12 @@ func main() {
 		log.Fatalf("Error al conectar a MongoDB: %v", err)
 	}
 
+	// Las tareas en segundo plano se detienen al recibir la señal de cierre, antes de cerrar MongoDB
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
 	// Configurar cierre de conexión al terminar
-	setupGracefulShutdown(mongoClient)
+	setupGracefulShutdown(mongoClient, stopBackground)
 
 	// Configurar modo de Gin basado en entorno
 	if getEnv("ENV", "development") == "production" {
@@ -91,26 +117,150 @@ func main() {
 	permissionCollection := mongoClient.Database(mongoDBName).Collection("permissions")
 	roleCollection := mongoClient.Database(mongoDBName).Collection("roles")
 	userRoleCollection := mongoClient.Database(mongoDBName).Collection("user_roles")
+	auditLogCollection := mongoClient.Database(mongoDBName).Collection("audit_logs")
 
 	// ------ INICIALIZACIÓN DE REPOSITORIOS ------
 	// Repositorios de usuario
 	userRepository := userRepo.NewMongoUserRepository(userCollection)
+	if err := userRepo.EnsureUserIndexes(userCollection); err != nil {
+		log.Printf("[WARN] no se pudieron crear los índices de usuarios error=%v", err)
+	}
+	if migrated, conflicts, err := userRepo.NormalizeStoredEmails(userCollection); err != nil {
+		log.Printf("[WARN] no se pudieron normalizar los emails de usuarios error=%v", err)
+	} else {
+		if migrated > 0 {
+			log.Printf("Emails de usuarios normalizados a minúsculas: %d", migrated)
+		}
+		for _, id := range conflicts {
+			log.Printf("[WARN] el email del usuario no se normalizó: otro usuario ya lo usa en minúsculas user=%s", id)
+		}
+	}
 	permissionRepository := permissionRepo.NewMongoPermissionRepository(permissionCollection)
 	roleRepository := permissionRepo.NewMongoRoleRepository(roleCollection)
-	userRoleRepository := permissionRepo.NewMongoUserRoleRepository(userRoleCollection, roleRepository)
+	userRoleRepository := permissionRepo.NewMongoUserRoleRepository(userRoleCollection, roleRepository, cfg.EffectivePermissionsCache)
+	if err := permissionRepo.EnsureUserRoleIndexes(userRoleCollection); err != nil {
+		log.Printf("[WARN] no se pudo crear el índice único de asignaciones de rol por usuario error=%v", err)
+	}
+	auditLogRepository := auditRepo.NewMongoAuditLogRepository(auditLogCollection)
 
 	// Repositorios de OAuth
 	clientCollection := config.GetCollection(mongoClient, mongoDBName, "oauth_clients")
 	tokenCollection := config.GetCollection(mongoClient, mongoDBName, "oauth_tokens")
 	clientRepository := oauthRepo.NewMongoClientRepository(clientCollection)
-	tokenRepository := oauthRepo.NewMongoTokenRepository(tokenCollection)
+	if migrated, err := oauthRepo.MigratePlaintextClientSecrets(clientCollection); err != nil {
+		log.Printf("[WARN] no se pudieron hashear los secretos de cliente en texto plano error=%v", err)
+	} else if migrated > 0 {
+		log.Printf("Secretos de cliente OAuth migrados a bcrypt: %d", migrated)
+	}
+	tokenRepository := oauthRepo.NewMongoTokenRepository(tokenCollection, cfg.TokenPlaintextLookup)
+	if migrated, err := oauthRepo.MigratePlaintextTokens(tokenCollection); err != nil {
+		log.Printf("[WARN] no se pudieron hashear los tokens guardados en texto plano error=%v", err)
+	} else if migrated > 0 {
+		log.Printf("Sesiones OAuth migradas a tokens hasheados: %d", migrated)
+	}
+	if cfg.TokenPurgeTTLIndex {
+		if err := oauthRepo.EnsureTokenTTLIndex(tokenCollection); err != nil {
+			log.Printf("[WARN] no se pudo crear el índice TTL de tokens error=%v", err)
+		}
+	}
+	authorizationCodeCollection := config.GetCollection(mongoClient, mongoDBName, "oauth_authorization_codes")
+	authorizationCodeRepository := oauthRepo.NewMongoAuthorizationCodeRepository(authorizationCodeCollection)
+	if err := oauthRepo.EnsureAuthorizationCodeIndexes(authorizationCodeCollection); err != nil {
+		log.Printf("[WARN] no se pudieron crear los índices de códigos de autorización error=%v", err)
+	}
+	revokedTokenCollection := config.GetCollection(mongoClient, mongoDBName, "oauth_revoked_tokens")
+	revocationList := oauthRepo.NewMongoRevocationList(revokedTokenCollection)
+	if cfg.StatelessAccessTokens {
+		if err := oauthRepo.EnsureRevocationIndexes(revokedTokenCollection); err != nil {
+			log.Printf("[WARN] no se pudo crear el índice TTL de tokens revocados error=%v", err)
+		}
+	}
 
 	// ------ INICIALIZACIÓN DE CASOS DE USO ------
 	// Caso de uso de usuario
-	userService := userUseCase.NewUserUseCase(userRepository)
-	permissionService := permissionUseCase.NewPermissionUseCase(permissionRepository, userRoleRepository)
-	roleService := permissionUseCase.NewRoleUseCase(roleRepository, permissionRepository)
-	userRoleService := permissionUseCase.NewUserRoleUseCase(userRoleRepository, roleRepository, permissionRepository)
+	// Los usuarios nuevos reciben los roles por defecto al crear su asignación
+	// Los cambios que aplican los casos de uso por su cuenta (roles por defecto, barrido de roles
+	// vencidos, efectos en cascada) se registran en la auditoría con el actor "system"
+	auditLogService := auditUseCase.NewAuditLogUseCase(auditLogRepository)
+	permissionChanges := permissionUseCase.WithChangeRecorder(auditPermissionChanges(auditLogService))
+	userRoleService, err := permissionUseCase.WithDefaultRoles(
+		permissionUseCase.NewUserRoleUseCase(userRoleRepository, roleRepository, permissionRepository, permissionChanges),
+		roleRepository, userRoleRepository, cfg.DefaultUserRoles, permissionChanges)
+	if err != nil {
+		log.Fatalf("DEFAULT_USER_ROLES no válido: %v", err)
+	}
+	// Las verificaciones de permisos usan una caché en memoria por usuario, que los casos de uso
+	// de permisos y roles vacían tras los cambios que afectan a muchos usuarios
+	userRoleService = permissionUseCase.WithPermissionCache(userRoleService, cfg.PermissionCacheTTL)
+	permissionOptions := []permissionUseCase.Option{
+		permissionChanges,
+		permissionUseCase.WithRoleDeleter(permissionRepo.NewMongoRoleDeleteRepository(roleCollection, userRoleCollection)),
+	}
+	if cache, ok := userRoleService.(permissionDomain.PermissionCacheInvalidator); ok {
+		permissionOptions = append(permissionOptions, permissionUseCase.WithCacheInvalidator(cache))
+	}
+	var passwordResetSender domain.PasswordResetSender
+	if cfg.PasswordResetLogTokens {
+		log.Printf("[WARN] PASSWORD_RESET_LOG_TOKENS activo: los tokens de restablecimiento se escriben en el log")
+		passwordResetSender = domain.PasswordResetSenderFunc(logPasswordResetToken)
+	}
+	var verificationSender domain.EmailVerificationSender
+	if cfg.EmailVerificationLogTokens {
+		log.Printf("[WARN] EMAIL_VERIFICATION_LOG_TOKENS activo: los tokens de verificación de email se escriben en el log")
+		verificationSender = domain.EmailVerificationSenderFunc(logEmailVerificationToken)
+	}
+	// Los secretos TOTP se guardan cifrados con su propia clave (obligatoria en producción)
+	var twoFactorBox *utils.SecretBox
+	if cfg.TwoFactorEncryptionKey == "" {
+		log.Printf("[WARN] TWO_FACTOR_ENCRYPTION_KEY no configurada: los secretos TOTP se guardan sin cifrar")
+	} else if twoFactorBox, err = utils.NewSecretBox(cfg.TwoFactorEncryptionKey); err != nil {
+		log.Fatalf("TWO_FACTOR_ENCRYPTION_KEY no válida: %v", err)
+	}
+
+	// El caso de uso de OAuth depende del de usuarios: la revocación de sesiones al archivar o
+	// desactivar un usuario lo usa una vez creado
+	var oauthService oauthDomain.OAuthUseCase
+	userService := userUseCase.NewUserUseCase(userRepository,
+		userUseCase.WithRoleInitializer(userRoleService),
+		userUseCase.WithTokenRevoker(domain.TokenRevokerFunc(func(userID string) (int64, error) {
+			return oauthService.RevokeUserTokens(userID)
+		})),
+		userUseCase.WithRoleAssignmentRemover(userRoleService),
+		userUseCase.WithAccountDeletionRecorder(auditAccountDeletions(auditLogService)),
+		userUseCase.WithPasswordReset(passwordResetSender, cfg.PasswordResetTTL),
+		userUseCase.WithEmailVerification(verificationSender, cfg.EmailVerificationTTL),
+		userUseCase.WithVerificationResendCooldown(cfg.EmailVerificationCooldown),
+		userUseCase.WithPasswordPolicy(utils.PasswordPolicy{
+			MinLength:     cfg.PasswordMinLength,
+			RequireUpper:  cfg.PasswordRequireUpper,
+			RequireLower:  cfg.PasswordRequireLower,
+			RequireDigit:  cfg.PasswordRequireDigit,
+			RequireSymbol: cfg.PasswordRequireSymbol,
+			Blocklist:     cfg.PasswordBlocklist,
+		}),
+		userUseCase.WithTwoFactor(cfg.TwoFactorIssuer, cfg.TwoFactorWindow),
+		userUseCase.WithTwoFactorEncryption(twoFactorBox),
+		userUseCase.WithTwoFactorLockout(cfg.TwoFactorMaxAttempts, cfg.TwoFactorLockout),
+	)
+	permissionService := permissionUseCase.NewPermissionUseCase(permissionRepository, userRoleRepository,
+		permissionRepo.NewMongoPermissionRenameRepository(permissionCollection, roleCollection, userRoleCollection),
+		permissionRepo.NewMongoPermissionReferenceRepository(permissionCollection, roleCollection, userRoleCollection),
+		permissionOptions...)
+	roleService := permissionUseCase.NewRoleUseCase(roleRepository, permissionRepository, userRoleRepository,
+		permissionDomain.ParseRoleDeletePolicy(cfg.RoleDeletePolicy), permissionOptions...)
+
+	// Reconciliar en segundo plano las asignaciones de rol faltantes
+	go runRoleAssignmentReconciliation(backgroundCtx, userService, cfg.UserRoleReconcileInterval)
+
+	// Eliminar periódicamente las sesiones OAuth expiradas
+	if cfg.TokenPurgeInterval > 0 {
+		go runExpiredTokenPurge(backgroundCtx, tokenRepository, cfg.TokenPurgeInterval)
+	}
+
+	// Quitar periódicamente de las asignaciones los roles vencidos
+	if cfg.ExpiredRolePurgeInterval > 0 {
+		go runExpiredRolePurge(backgroundCtx, userRoleService, cfg.ExpiredRolePurgeInterval)
+	}
 
 	// Configuración de OAuth
 	jwtSecret := getEnv("JWT_SECRET", "mi_secret_super_seguro")
@@ -134,24 +284,116 @@ func main() {
 		refreshExpiration = 1 * time.Hour
 	}
 
+	// Firma de los access tokens: HS256 con JWT_SECRET o RS256 con una clave privada
+	var jwtSigner *utils.JWTSigner
+	switch cfg.JWTSigningMethod {
+	case utils.JWTAlgorithmHS256:
+		jwtSigner = utils.NewHS256Signer(jwtSecret)
+	case utils.JWTAlgorithmRS256:
+		privateKey, err := utils.LoadRSAPrivateKey(cfg.JWTPrivateKeyFile)
+		if err != nil {
+			log.Fatalf("Error al cargar la clave privada JWT (JWT_PRIVATE_KEY_FILE): %v", err)
+		}
+		jwtSigner = utils.NewRS256Signer(privateKey)
+	default:
+		log.Fatalf("JWT_SIGNING_METHOD no soportado: %s (use HS256 o RS256)", cfg.JWTSigningMethod)
+	}
+
 	// Caso de uso de OAuth
-	oauthService := oauthUseCase.NewOAuthUseCase(
+	oauthService = oauthUseCase.NewOAuthUseCase(
 		clientRepository,
 		tokenRepository,
 		userService,
 		jwtSecret,
 		tokenExpiration,
 		refreshExpiration,
+		oauthUseCase.WithPermissionResolver(userRoleService),
+		oauthUseCase.WithUserProfile(cfg.LoginIncludeProfile),
+		oauthUseCase.WithOpaqueTokens(cfg.OpaqueAccessTokens),
+		oauthUseCase.WithStatelessTokens(cfg.StatelessAccessTokens),
+		oauthUseCase.WithRevocationList(revocationList),
+		oauthUseCase.WithEnabledGrantTypes(cfg.EnabledGrantTypes...),
+		oauthUseCase.WithClientClaims(cfg.TokenClientClaims),
+		oauthUseCase.WithAuthorizationCodes(authorizationCodeRepository),
+		oauthUseCase.WithStrictRefreshRotation(cfg.StrictRefreshRotation),
+		oauthUseCase.WithJWTSigner(jwtSigner),
+		oauthUseCase.WithDeviceBinding(oauthDomain.ParseDeviceBindingMode(cfg.DeviceBinding)),
+		oauthUseCase.WithLoginFailureRecorder(auditLoginFailures(auditLogService)),
+		oauthUseCase.WithUserStatusCheck(cfg.TokenCheckUserStatus),
+		oauthUseCase.WithSingleSession(cfg.SingleActiveSession),
+		oauthUseCase.WithScopeNarrowingReport(cfg.ReportScopeNarrowing),
 	)
 
+	// Administración de clientes OAuth
+	clientService := oauthUseCase.NewClientUseCase(clientRepository, oauthService)
+	// El secreto del cliente por defecto solo se guarda como hash y se muestra una única vez en el
+	// log; sin OAUTH_BOOTSTRAP_LOG_SECRET no se crea, para no dejar un cliente inutilizable
+	if cfg.OAuthBootstrapClient && !cfg.OAuthBootstrapLogSecret {
+		log.Printf("[WARN] OAUTH_BOOTSTRAP_CLIENT requiere OAUTH_BOOTSTRAP_LOG_SECRET=true: no se crea el cliente OAuth por defecto")
+	} else if cfg.OAuthBootstrapClient {
+		bootstrapDefaultClient(clientService)
+	}
+
+	// API keys para clientes de servicio (opcional)
+	var apiKeyService oauthDomain.APIKeyUseCase
+	if cfg.APIKeysEnabled {
+		apiKeyCollection := config.GetCollection(mongoClient, mongoDBName, "api_keys")
+		if err := oauthRepo.EnsureAPIKeyIndexes(apiKeyCollection); err != nil {
+			log.Printf("[WARN] no se pudo crear el índice de API keys error=%v", err)
+		}
+		apiKeyService = oauthUseCase.NewAPIKeyUseCase(oauthRepo.NewMongoAPIKeyRepository(apiKeyCollection), userRoleService, permissionRepository)
+	}
+
 	// ------ INICIALIZACIÓN DE MIDDLEWARES ------
 	// Middleware de OAuth
 	oauthMiddleware := middleware.NewOAuthMiddleware(oauthService)
+	authMiddleware := oauthMiddleware.Protected()
+	if apiKeyService != nil {
+		// Las rutas protegidas aceptan también el header X-API-Key
+		authMiddleware = middleware.NewAPIKeyMiddleware(apiKeyService).Or(authMiddleware)
+	}
 	permissionMiddleware := middleware.NewPermissionMiddleware(userRoleService)
+	permissionMiddleware.SetDenialLogging(middleware.ParseDenialLogLevel(cfg.PermissionDenialLog), nil)
+	accessPolicy := utils.NewAccessPolicy()
+	accessPolicy.Set(utils.ResourceAdmin, utils.ParseAccessDenialMode(cfg.AdminAccessDenial, utils.AccessDenialForbidden))
+	accessPolicy.Set(utils.ResourceUser, utils.ParseAccessDenialMode(cfg.UserAccessDenial, utils.AccessDenialNotFound))
+	permissionMiddleware.SetAccessPolicy(accessPolicy)
+
+	// Middleware de rate limit (almacenamiento en memoria)
+	rateLimiter := middleware.NewRateLimiter(middleware.NewMemoryRateLimitStore())
+	rateLimiter.SetHeaders(cfg.RateLimitHeaders)
+	tokenRateLimit := middleware.TokenRateLimitConfig{
+		Default: middleware.RateLimitRule{Requests: cfg.TokenRateLimitRequests, Window: cfg.TokenRateLimitWindow},
+		Scopes:  make(map[string]middleware.RateLimitRule),
+	}
+	for scope, requests := range cfg.TokenRateLimitScopes {
+		tokenRateLimit.Scopes[scope] = middleware.RateLimitRule{Requests: requests, Window: cfg.TokenRateLimitWindow}
+	}
+	// Rutas públicas (login, registro, recuperación de contraseña) por IP; protegidas por usuario
+	publicRateLimit := rateLimiter.Limit("public", middleware.RateLimitRule{Requests: cfg.PublicRateLimitRequests, Window: cfg.PublicRateLimitWindow})
+	userRateLimit := rateLimiter.Limit("user", middleware.RateLimitRule{Requests: cfg.UserRateLimitRequests, Window: cfg.UserRateLimitWindow})
 
 	// ------ CONFIGURACIÓN DE RUTAS ------
 	// Inicializar router de Gin
-	router := gin.Default()
+	router := gin.New()
+	// RequestLogger primero: reemplaza el logger de gin.Default y asigna el X-Request-ID que
+	// incluyen los errores; Recovery después, para que los pánicos se registren como 500
+	router.Use(middleware.RequestLogger(nil), gin.Recovery())
+	// Sin TRUSTED_PROXIES no se acepta X-Forwarded-For de nadie (Gin confía en todos por defecto),
+	// para que la IP del rate limit no pueda falsificarse
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("TRUSTED_PROXIES no válido: %v", err)
+	}
+	router.Use(middleware.ErrorFormat(cfg.ErrorFormat))
+	if len(cfg.CORSAllowedOrigins) > 0 {
+		router.Use(middleware.NewCORS(middleware.CORSConfig{
+			AllowedOrigins:   cfg.CORSAllowedOrigins,
+			AllowedMethods:   cfg.CORSAllowedMethods,
+			AllowedHeaders:   cfg.CORSAllowedHeaders,
+			AllowCredentials: cfg.CORSAllowCredentials,
+			MaxAge:           cfg.CORSMaxAge,
+		}))
+	}
 	// Rutas base
 	router.GET("/", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -166,43 +408,118 @@ func main() {
 		})
 	})
 
-	router.POST("/api/register", func(c *gin.Context) {
-		var req domain.CreateUserRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			utils.ValidationErrorResponse(c, err.Error())
-			return
-		}
-
-		user, err := userService.CreateUser(&req)
-		if err != nil {
-			utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
-			return
-		}
-
-		utils.SuccessResponse(c, http.StatusCreated, "Usuario creado con éxito", user)
-	})
+	registerRoutes := router.Group("/api")
+	registerRoutes.Use(publicRateLimit, middleware.RequireJSON())
+	userDelivery.NewRegistrationHandler(registerRoutes, userService)
 
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	publicRoutes := router.Group("/api")
+	publicRoutes.Use(publicRateLimit)
 	{
 		// Rutas de OAuth (públicas)
 		oauthRoutes := publicRoutes.Group("/oauth")
-		oauthDelivery.NewOAuthHandler(oauthRoutes, oauthService)
+		oauthDelivery.NewOAuthHandler(oauthRoutes, oauthService,
+			middleware.RequireJSONOrForm(),
+			rateLimiter.LimitTokenByScope(tokenRateLimit),
+		)
+		// Documento de descubrimiento (RFC 8414) en la raíz, con las rutas de oauthRoutes. En
+		// producción sus URLs no se toman de los headers de la solicitud: sin OAUTH_ISSUER no se publica
+		if cfg.OAuthIssuer == "" && cfg.IsProduction() {
+			log.Printf("[WARN] OAUTH_ISSUER no configurado: no se publica /.well-known/oauth-authorization-server")
+		} else {
+			oauthDelivery.NewOAuthMetadataHandler(router, oauthService, oauthRoutes.BasePath(), cfg.OAuthIssuer)
+		}
+
+		// Recuperación de contraseña (pública)
+		passwordResetRoutes := publicRoutes.Group("")
+		passwordResetRoutes.Use(middleware.RequireJSON())
+		userDelivery.NewPasswordResetHandler(passwordResetRoutes, userService)
+		userDelivery.NewVerificationResendHandler(passwordResetRoutes, userService)
+
+		// Verificación de email (pública)
+		userDelivery.NewEmailVerificationHandler(publicRoutes, userService)
 	}
 
+	// Importación masiva de usuarios: acepta JSON o CSV, por eso no usa el grupo api (solo JSON)
+	userImportRoutes := router.Group("/api/users")
+	userImportRoutes.Use(middleware.PrivateCache())
+	userImportRoutes.Use(authMiddleware)
+	userImportRoutes.Use(userRateLimit)
+	userImportRoutes.Use(middleware.RequireContentType(middleware.ContentTypeJSON, middleware.ContentTypeCSV))
+	userImportRoutes.Use(permissionMiddleware.RequirePermission("admin:users"))
+	userDelivery.NewUserImportHandler(userImportRoutes, userService)
+
 	// Grupo de rutas para la API
 	api := router.Group("/api")
-	api.Use(oauthMiddleware.Protected()) // Protección aplicada solo a este grupo
+	api.Use(middleware.PrivateCache()) // Las respuestas dependen de las credenciales: sin cachés compartidas
+	api.Use(authMiddleware)            // Protección aplicada solo a este grupo
+	api.Use(userRateLimit)             // Después de authMiddleware: limita por usuario
+	api.Use(middleware.RequireJSON())  // Los endpoints de escritura solo aceptan JSON
 	{
+		// Rutas de OAuth que requieren sesión
+		oauthSessionRoutes := api.Group("/oauth")
+		oauthDelivery.NewOAuthSessionHandler(oauthSessionRoutes, oauthService)
+
+		// Rutas administrativas de tokens
+		oauthAdminRoutes := oauthSessionRoutes.Group("")
+		oauthAdminRoutes.Use(permissionMiddleware.RequirePermission("admin:tokens"))
+		oauthDelivery.NewOAuthAdminHandler(oauthAdminRoutes, oauthService)
+
+		// Rutas administrativas de clientes OAuth
+		clientAdminRoutes := oauthSessionRoutes.Group("")
+		clientAdminRoutes.Use(permissionMiddleware.RequirePermission("admin:clients"))
+		oauthDelivery.NewClientAdminHandler(clientAdminRoutes, clientService)
+
+		// Rutas administrativas de API keys
+		if apiKeyService != nil {
+			apiKeyAdminRoutes := oauthSessionRoutes.Group("")
+			apiKeyAdminRoutes.Use(permissionMiddleware.RequirePermission("admin:api-keys"))
+			oauthDelivery.NewAPIKeyAdminHandler(apiKeyAdminRoutes, apiKeyService)
+		}
+
 		// Rutas de usuarios
 		userRoutes := api.Group("/users")
-		userDelivery.NewUserHandler(userRoutes, userService)
+		var sensitiveUserMiddlewares []gin.HandlerFunc
+		if cfg.SensitiveAuthMaxAge > 0 {
+			sensitiveUserMiddlewares = append(sensitiveUserMiddlewares, oauthMiddleware.RequireRecentAuth(cfg.SensitiveAuthMaxAge))
+		}
+		// Cada usuario accede a su propio registro; a los demás solo con admin:users. La respuesta
+		// 404 usa el mismo mensaje que un usuario inexistente para no revelar su existencia.
+		userAccessMiddleware := permissionMiddleware.RequireSelfOrPermission("id", domain.AdminPermission, domain.ErrUserNotFound.Error())
+		userDelivery.NewUserHandler(userRoutes, userService, utils.NewPaginator(cfg.DefaultPageSize, cfg.MaxPageSize),
+			userAccessMiddleware, sensitiveUserMiddlewares...)
+
+		// Aplicaciones conectadas del usuario autenticado
+		oauthDelivery.NewOAuthUserHandler(userRoutes.Group("/me"), oauthService)
+
+		// Rutas administrativas de usuarios
+		userAdminRoutes := userRoutes.Group("/admin")
+		userAdminRoutes.Use(permissionMiddleware.RequirePermission(domain.AdminPermission))
+		userDelivery.NewUserAdminHandler(userAdminRoutes, userService)
+
+		// Listado, creación y restauración de usuarios: solo administradores (la creación admite
+		// skip_verification y un usuario archivado no puede reactivarse a sí mismo)
+		userManagementRoutes := userRoutes.Group("")
+		userManagementRoutes.Use(permissionMiddleware.RequirePermission(domain.AdminPermission))
+		userDelivery.NewUserManagementHandler(userManagementRoutes, userService, utils.NewPaginator(cfg.DefaultPageSize, cfg.MaxPageSize))
+		userDelivery.NewUserRestoreHandler(userManagementRoutes, userService)
 
 		// Rutas de permisos
 		permissionRoutes := api.Group("/permissions")
 		permissionRoutes.Use(permissionMiddleware.RequirePermission("admin:permissions"))
-		permissionDelivery.NewPermissionHandler(permissionRoutes, permissionService, roleService, userRoleService)
+		if cfg.DelegatedAdminScopes {
+			permissionRoutes.Use(permissionMiddleware.ResolveAdminScope())
+		}
+		permissionDelivery.NewPermissionHandler(permissionRoutes, permissionService, roleService, userRoleService,
+			utils.NewPaginator(cfg.DefaultPageSize, cfg.MaxPageSize), auditPermissionChanges(auditLogService))
+
+		// Rutas de auditoría; /audit se conserva como alias de /audit-logs
+		for _, path := range []string{"/audit-logs", "/audit"} {
+			auditRoutes := api.Group(path)
+			auditRoutes.Use(permissionMiddleware.RequirePermission("admin:audit"))
+			auditDelivery.NewAuditHandler(auditRoutes, auditLogService, utils.NewPaginator(cfg.DefaultPageSize, cfg.MaxPageSize))
+		}
 	}
 
 	// ------ EJEMPLOS DE USO DEL MIDDLEWARE DE PERMISOS ------
@@ -237,14 +554,22 @@ func main() {
 
 	// Configurar servidor HTTP
 	srv := &http.Server{
-		Addr:    ":" + port,
-		Handler: router,
+		Addr:      ":" + port,
+		Handler:   router,
+		TLSConfig: cfg.ServerTLSConfig(),
 	}
 
 	// Iniciar el servidor en una goroutine
 	go func() {
-		log.Printf("Servidor iniciando en el puerto %s...\n", port)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if srv.TLSConfig != nil {
+			log.Printf("Servidor iniciando con TLS en el puerto %s...\n", port)
+			err = srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			log.Printf("Servidor iniciando en el puerto %s...\n", port)
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Error al iniciar el servidor: %v", err)
 		}
 	}()
@@ -273,12 +598,160 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
-// setupGracefulShutdown configura el cierre correcto de MongoDB
-func setupGracefulShutdown(client *mongo.Client) {
+// runRoleAssignmentReconciliation crea las asignaciones de rol faltantes al iniciar y,
+// si interval es mayor que cero, de forma periódica hasta que se cancele ctx
+func runRoleAssignmentReconciliation(ctx context.Context, userService domain.UserUseCase, interval time.Duration) {
+	var ticker *time.Ticker
+	for {
+		created, err := userService.ReconcileRoleAssignments()
+		if err != nil {
+			log.Printf("Error al reconciliar asignaciones de rol: %v", err)
+		} else if created > 0 {
+			log.Printf("Asignaciones de rol creadas para %d usuarios sin asignación", created)
+		}
+
+		if interval <= 0 {
+			return
+		}
+		if ticker == nil {
+			ticker = time.NewTicker(interval)
+			defer ticker.Stop()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runExpiredTokenPurge elimina cada interval las sesiones cuyo access token y refresh token
+// expiraron, hasta que se cancele ctx
+func runExpiredTokenPurge(ctx context.Context, tokenRepository oauthDomain.TokenRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := tokenRepository.DeleteExpired(time.Now())
+		if err != nil {
+			log.Printf("[ERROR] no se pudieron eliminar los tokens expirados error=%v", err)
+		} else if deleted > 0 {
+			log.Printf("Tokens expirados eliminados: %d", deleted)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runExpiredRolePurge quita cada interval los roles cuyo vencimiento ya pasó, hasta que se
+// cancele ctx
+func runExpiredRolePurge(ctx context.Context, userRoleService permissionDomain.UserRoleUseCase, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		modified, err := userRoleService.PurgeExpiredRoles(time.Now())
+		if err != nil {
+			log.Printf("[ERROR] no se pudieron quitar los roles vencidos error=%v", err)
+		} else if modified > 0 {
+			log.Printf("Asignaciones con roles vencidos actualizadas: %d", modified)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// logPasswordResetToken escribe el token de restablecimiento en el log en lugar de enviarlo.
+// Solo para desarrollo: cualquiera con acceso a los logs puede restablecer la contraseña.
+func logPasswordResetToken(user *domain.User, token string, expiresAt time.Time) error {
+	log.Printf("[INFO] token de restablecimiento de contraseña user=%s email=%s token=%s expires_at=%s",
+		user.ID.Hex(), user.Email, token, expiresAt.Format(time.RFC3339))
+	return nil
+}
+
+// logEmailVerificationToken escribe el token de verificación de email en el log en lugar de
+// enviarlo. Solo para desarrollo.
+func logEmailVerificationToken(user *domain.User, token string, expiresAt time.Time) error {
+	log.Printf("[INFO] token de verificación de email user=%s email=%s token=%s expires_at=%s",
+		user.ID.Hex(), user.Email, token, expiresAt.Format(time.RFC3339))
+	return nil
+}
+
+// auditLoginFailures registra en la auditoría los inicios de sesión fallidos con su motivo
+func auditLoginFailures(auditLogService auditDomain.AuditLogUseCase) oauthDomain.LoginFailureRecorder {
+	return oauthDomain.LoginFailureRecorderFunc(func(clientID, username, reason string) {
+		err := auditLogService.Record(&auditDomain.AuditLog{
+			ActorID: username,
+			Action:  "auth.login_failed",
+			Target:  "client:" + clientID,
+			Details: "reason=" + reason,
+		})
+		if err != nil {
+			log.Printf("[WARN] no se pudo auditar el inicio de sesión fallido client_id=%s error=%v", clientID, err)
+		}
+	})
+}
+
+// auditAccountDeletions registra en la auditoría las cuentas eliminadas por su propio usuario
+func auditAccountDeletions(auditLogService auditDomain.AuditLogUseCase) domain.AccountDeletionRecorder {
+	return domain.AccountDeletionRecorderFunc(func(userID string) {
+		err := auditLogService.Record(&auditDomain.AuditLog{
+			ActorID: userID,
+			Action:  "user.account_deleted",
+			Target:  "user:" + userID,
+		})
+		if err != nil {
+			log.Printf("[WARN] no se pudo auditar la eliminación de la cuenta user=%s error=%v", userID, err)
+		}
+	})
+}
+
+// auditPermissionChanges registra en la auditoría los cambios de permisos, roles y asignaciones.
+// A diferencia de los demás registros, el error se retorna: el manejador no da por exitoso un
+// cambio que no quedó auditado.
+func auditPermissionChanges(auditLogService auditDomain.AuditLogUseCase) permissionDomain.PermissionChangeRecorder {
+	return permissionDomain.PermissionChangeRecorderFunc(func(change *permissionDomain.PermissionChange) error {
+		return auditLogService.Record(&auditDomain.AuditLog{
+			ActorID: change.ActorID,
+			Action:  change.Action,
+			Target:  change.Target,
+			Details: change.Details,
+		})
+	})
+}
+
+// bootstrapDefaultClient crea el cliente OAuth por defecto si no existe ninguno y muestra sus
+// credenciales una sola vez: el secreto solo se guarda como hash y no puede recuperarse después
+func bootstrapDefaultClient(clientService oauthDomain.ClientUseCase) {
+	client, err := clientService.EnsureDefaultClient()
+	if err != nil {
+		log.Printf("[WARN] no se pudo crear el cliente OAuth por defecto error=%v", err)
+		return
+	}
+	if client == nil {
+		return
+	}
+
+	log.Printf("[INFO] cliente OAuth por defecto creado client_id=%s scopes=%v grant_types=%v",
+		client.ClientID, client.Scopes, client.GrantTypes)
+	log.Printf("[WARN] guarde el secreto del cliente por defecto, no volverá a mostrarse client_id=%s client_secret=%s",
+		client.ClientID, client.ClientSecret)
+}
+
+// setupGracefulShutdown configura el cierre correcto de MongoDB: al recibir la señal detiene las
+// tareas en segundo plano con stopBackground y luego cierra la conexión
+func setupGracefulShutdown(client *mongo.Client, stopBackground context.CancelFunc) {
 	go func() {
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 		<-quit
+		stopBackground()
 		log.Println("Cerrando la conexión a MongoDB...")
 		if err := client.Disconnect(context.Background()); err != nil {
 			log.Fatalf("Error al cerrar la conexión a MongoDB: %v", err)
@@ -1,10 +1,15 @@
 package config
 
 import (
-	"github.com/joho/godotenv"
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/joho/godotenv"
 )
 
 // Config almacena toda la configuración de la aplicación
@@ -23,9 +28,162 @@ type Config struct {
 	TokenExp   time.Duration
 	RefreshExp time.Duration
 
+	// Firma de los access tokens JWT: "HS256" (JWTSecret) o "RS256" (clave privada en JWTPrivateKeyFile)
+	JWTSigningMethod  string
+	JWTPrivateKeyFile string
+
 	// Cliente OAuth (solo si tu aplicación es también un cliente)
 	OAuthClientID     string
 	OAuthClientSecret string
+
+	// Incluir el perfil del usuario en la respuesta del grant password
+	LoginIncludeProfile bool
+
+	// Emitir access tokens opacos (aleatorios) en lugar de JWT
+	OpaqueAccessTokens bool
+
+	// Validar los access tokens JWT sin consultar la sesión (revocación mediante lista de JTI)
+	StatelessAccessTokens bool
+
+	// Incluir client_id y client_name del cliente emisor como claims del access token
+	TokenClientClaims bool
+
+	// Refresh tokens de un solo uso estricto (eliminación atómica del token anterior)
+	StrictRefreshRotation bool
+
+	// Verificar en cada petición que el usuario del access token siga activo
+	TokenCheckUserStatus bool
+
+	// Una sola sesión activa por usuario: cada inicio de sesión revoca las anteriores
+	SingleActiveSession bool
+
+	// Informar en la respuesta de token los scopes solicitados cuando se concede un subconjunto
+	ReportScopeNarrowing bool
+
+	// Validación del device_id al refrescar: off, warn o enforce (revoca la familia de tokens)
+	DeviceBinding string
+
+	// Crear un cliente OAuth por defecto al iniciar si no existe ninguno
+	OAuthBootstrapClient bool
+	// Confirma que el client_secret del cliente por defecto puede escribirse en el log, única vez
+	// en que se muestra; sin ella OAuthBootstrapClient no crea el cliente
+	OAuthBootstrapLogSecret bool
+
+	// Aceptar API keys (header X-API-Key) como alternativa a los tokens OAuth
+	APIKeysEnabled bool
+
+	// Limpieza de sesiones expiradas de oauth_tokens
+	TokenPurgeInterval time.Duration // Intervalo del barrido periódico (0 = desactivado)
+	TokenPurgeTTLIndex bool          // Crear un índice TTL para que MongoDB las elimine
+
+	// Aceptar sesiones con tokens guardados en texto plano (transición al almacenamiento hasheado)
+	TokenPlaintextLookup bool
+
+	// Tipos de concesión habilitados para todos los clientes (vacío = todos los implementados)
+	EnabledGrantTypes []string
+
+	// URL pública del servidor de autorización en el documento de metadatos. Vacía, fuera de producción
+	// se usa el host de la solicitud y en producción el documento no se publica
+	OAuthIssuer string
+
+	// Antigüedad máxima de la autenticación para operaciones sensibles (0 = sin exigencia)
+	SensitiveAuthMaxAge time.Duration
+
+	// Política de contraseñas de los usuarios
+	PasswordMinLength     int      // Longitud mínima
+	PasswordRequireUpper  bool     // Exigir una letra mayúscula
+	PasswordRequireLower  bool     // Exigir una letra minúscula
+	PasswordRequireDigit  bool     // Exigir un dígito
+	PasswordRequireSymbol bool     // Exigir un símbolo
+	PasswordBlocklist     []string // Contraseñas prohibidas además de las comunes incluidas
+
+	// Verificación en dos pasos (TOTP)
+	TwoFactorIssuer string // Emisor que muestran las aplicaciones de autenticación
+	TwoFactorWindow int    // Periodos de 30 s aceptados antes y después del actual
+	// Clave con la que se cifran los secretos TOTP guardados; obligatoria en producción y distinta
+	// de JWTSecret ("" = sin cifrar, solo fuera de producción)
+	TwoFactorEncryptionKey string
+	TwoFactorMaxAttempts   int           // Códigos inválidos consecutivos antes del bloqueo (0 = sin bloqueo)
+	TwoFactorLockout       time.Duration // Duración del bloqueo
+
+	// Restablecimiento de contraseña
+	PasswordResetTTL       time.Duration // Vigencia del token de restablecimiento
+	PasswordResetLogTokens bool          // Escribir los tokens en el log en lugar de enviarlos (solo desarrollo)
+
+	// Verificación de email de los usuarios registrados
+	EmailVerificationTTL       time.Duration // Vigencia del token de verificación
+	EmailVerificationCooldown  time.Duration // Tiempo mínimo entre dos envíos del token de verificación al mismo usuario
+	EmailVerificationLogTokens bool          // Activar la verificación escribiendo los tokens en el log (solo desarrollo)
+
+	// Rate limit del endpoint de tokens
+	TokenRateLimitRequests int            // Solicitudes permitidas por ventana (0 = sin límite)
+	TokenRateLimitWindow   time.Duration  // Duración de la ventana
+	TokenRateLimitScopes   map[string]int // Límites más estrictos por scope (ej. "admin=5,write=10")
+	RateLimitHeaders       bool           // Enviar headers X-RateLimit-* con el estado del límite (opcional)
+
+	// Rate limit por IP de las rutas públicas y por usuario de las protegidas (0 solicitudes = sin límite)
+	PublicRateLimitRequests int
+	PublicRateLimitWindow   time.Duration
+	UserRateLimitRequests   int
+	UserRateLimitWindow     time.Duration
+
+	// Paginación
+	DefaultPageSize int // Tamaño de página cuando el cliente no indica limit
+	MaxPageSize     int // Tamaño máximo de página; solicitudes mayores se reducen a este valor
+
+	// Registro de permisos denegados: "off", "summary" o "verbose"
+	PermissionDenialLog string
+
+	// Formato de las respuestas de error: "envelope" (Response) o "problem" (RFC 7807)
+	ErrorFormat string
+
+	// TLS: en el propio servidor (certificado y clave) o terminado en un proxy de confianza
+	TLSCertFile         string
+	TLSKeyFile          string
+	TLSMinVersion       string   // "1.2" o "1.3"
+	TLSProxyTermination bool     // Un proxy inverso termina TLS y envía X-Forwarded-Proto
+	TrustedProxies      []string // IPs o CIDR de los proxies cuyos headers X-Forwarded-* se aceptan
+	TLSEnforcement      string   // Sin TLS en producción: "fail" (no inicia) o "warn" (solo advierte)
+
+	// Atributos de las cookies que emite la API
+	CookieSecure   bool
+	CookieSameSite string // "lax", "strict" o "none"
+	CookieDomain   string
+
+	// CORS para clientes de navegador (sin orígenes el middleware no se registra)
+	CORSAllowedOrigins   []string
+	CORSAllowedMethods   []string // Vacío = middleware.DefaultCORSMethods
+	CORSAllowedHeaders   []string // Vacío = middleware.DefaultCORSHeaders
+	CORSAllowCredentials bool
+	CORSMaxAge           time.Duration
+
+	// Respuesta a un acceso denegado: "403" (revela que el recurso existe) o "404" (lo oculta)
+	AdminAccessDenial string // APIs administrativas
+	UserAccessDenial  string // Recursos de otro usuario (ej. /api/users/:id)
+
+	// Intervalo de reconciliación de asignaciones de rol (0 = solo al iniciar)
+	UserRoleReconcileInterval time.Duration
+
+	// Intervalo del barrido que quita los roles asignados con vencimiento ya vencidos (0 = desactivado;
+	// los roles vencidos dejan de otorgar permisos aunque no se quiten)
+	ExpiredRolePurgeInterval time.Duration
+
+	// Nombres de los roles asignados automáticamente a los usuarios nuevos
+	DefaultUserRoles []string
+
+	// Qué hacer con las asignaciones al eliminar un rol: "cleanup" (quitarlo) o "block" (impedirlo)
+	RoleDeletePolicy string
+
+	// Administración delegada: limita a los administradores con permisos admin:scope:<modulo>
+	// a gestionar permisos, roles y asignaciones de esos módulos
+	DelegatedAdminScopes bool
+
+	// Guarda en cada asignación usuario-rol sus permisos efectivos para no resolver los roles
+	// en cada verificación
+	EffectivePermissionsCache bool
+
+	// Vigencia de la caché en memoria de los permisos de cada usuario (0 = sin caché)
+	PermissionCacheTTL time.Duration
 }
 
 // LoadConfig carga la configuración desde variables de entorno
@@ -44,11 +202,139 @@ func LoadConfig() (*Config, error) {
 		TokenExp:     time.Duration(getEnvAsInt("TOKEN_EXP", 2)) * time.Hour,
 		RefreshExp:   time.Duration(getEnvAsInt("REFRESH_EXP", 7*24)) * time.Hour, // 7 días
 
+		JWTSigningMethod:  strings.ToUpper(getEnv("JWT_SIGNING_METHOD", "HS256")),
+		JWTPrivateKeyFile: getEnv("JWT_PRIVATE_KEY_FILE", ""),
+
+		LoginIncludeProfile:     getEnvAsBool("LOGIN_INCLUDE_PROFILE", false),
+		OpaqueAccessTokens:      getEnvAsBool("OPAQUE_ACCESS_TOKENS", false),
+		StatelessAccessTokens:   getEnvAsBool("STATELESS_ACCESS_TOKENS", false),
+		TokenClientClaims:       getEnvAsBool("TOKEN_CLIENT_CLAIMS", false),
+		StrictRefreshRotation:   getEnvAsBool("STRICT_REFRESH_ROTATION", false),
+		TokenCheckUserStatus:    getEnvAsBool("TOKEN_CHECK_USER_STATUS", false),
+		SingleActiveSession:     getEnvAsBool("SINGLE_ACTIVE_SESSION", false),
+		ReportScopeNarrowing:    getEnvAsBool("OAUTH_REPORT_SCOPE_NARROWING", false),
+		DeviceBinding:           getEnv("DEVICE_BINDING", "off"),
+		APIKeysEnabled:          getEnvAsBool("API_KEYS_ENABLED", false),
+		OAuthBootstrapClient:    getEnvAsBool("OAUTH_BOOTSTRAP_CLIENT", false),
+		OAuthBootstrapLogSecret: getEnvAsBool("OAUTH_BOOTSTRAP_LOG_SECRET", false),
+		TokenPurgeInterval:      time.Duration(getEnvAsInt("TOKEN_PURGE_INTERVAL", 60)) * time.Minute,
+		TokenPurgeTTLIndex:      getEnvAsBool("TOKEN_PURGE_TTL_INDEX", false),
+		TokenPlaintextLookup:    getEnvAsBool("TOKEN_PLAINTEXT_LOOKUP", true),
+		EnabledGrantTypes:       getEnvAsList("OAUTH_ENABLED_GRANT_TYPES", nil),
+		OAuthIssuer:             getEnv("OAUTH_ISSUER", ""),
+		SensitiveAuthMaxAge:     time.Duration(getEnvAsInt("SENSITIVE_AUTH_MAX_AGE", 0)) * time.Minute,
+
+		PasswordMinLength:     getEnvAsInt("PASSWORD_MIN_LENGTH", 6),
+		PasswordRequireUpper:  getEnvAsBool("PASSWORD_REQUIRE_UPPER", false),
+		PasswordRequireLower:  getEnvAsBool("PASSWORD_REQUIRE_LOWER", false),
+		PasswordRequireDigit:  getEnvAsBool("PASSWORD_REQUIRE_DIGIT", false),
+		PasswordRequireSymbol: getEnvAsBool("PASSWORD_REQUIRE_SYMBOL", false),
+		PasswordBlocklist:     getEnvAsList("PASSWORD_BLOCKLIST", nil),
+
+		TwoFactorIssuer:        getEnv("TWO_FACTOR_ISSUER", "mi-proyecto"),
+		TwoFactorWindow:        getEnvAsInt("TWO_FACTOR_WINDOW", 1),
+		TwoFactorEncryptionKey: getEnv("TWO_FACTOR_ENCRYPTION_KEY", ""),
+		TwoFactorMaxAttempts:   getEnvAsInt("TWO_FACTOR_MAX_ATTEMPTS", 5),
+		TwoFactorLockout:       time.Duration(getEnvAsInt("TWO_FACTOR_LOCKOUT", 15)) * time.Minute,
+
+		PasswordResetTTL:       time.Duration(getEnvAsInt("PASSWORD_RESET_TTL", 60)) * time.Minute,
+		PasswordResetLogTokens: getEnvAsBool("PASSWORD_RESET_LOG_TOKENS", false),
+
+		EmailVerificationTTL:       time.Duration(getEnvAsInt("EMAIL_VERIFICATION_TTL", 24)) * time.Hour,
+		EmailVerificationCooldown:  time.Duration(getEnvAsInt("EMAIL_VERIFICATION_RESEND_COOLDOWN", 5)) * time.Minute,
+		EmailVerificationLogTokens: getEnvAsBool("EMAIL_VERIFICATION_LOG_TOKENS", false),
+
+		TokenRateLimitRequests: getEnvAsInt("RATE_LIMIT_TOKEN_REQUESTS", 30),
+		TokenRateLimitWindow:   time.Duration(getEnvAsInt("RATE_LIMIT_TOKEN_WINDOW", 60)) * time.Second,
+		TokenRateLimitScopes:   getEnvAsIntMap("RATE_LIMIT_TOKEN_SCOPES", map[string]int{"admin": 5}),
+		RateLimitHeaders:       getEnvAsBool("RATE_LIMIT_HEADERS", false),
+
+		PublicRateLimitRequests: getEnvAsInt("RATE_LIMIT_PUBLIC_REQUESTS", 60),
+		PublicRateLimitWindow:   time.Duration(getEnvAsInt("RATE_LIMIT_PUBLIC_WINDOW", 60)) * time.Second,
+		UserRateLimitRequests:   getEnvAsInt("RATE_LIMIT_USER_REQUESTS", 300),
+		UserRateLimitWindow:     time.Duration(getEnvAsInt("RATE_LIMIT_USER_WINDOW", 60)) * time.Second,
+
+		DefaultPageSize: getEnvAsInt("PAGE_SIZE_DEFAULT", 20),
+		MaxPageSize:     getEnvAsInt("PAGE_SIZE_MAX", 100),
+
+		PermissionDenialLog: getEnv("PERMISSION_DENIAL_LOG", "summary"),
+		ErrorFormat:         getEnv("ERROR_FORMAT", "envelope"),
+		AdminAccessDenial:   getEnv("ADMIN_ACCESS_DENIAL", "403"),
+		UserAccessDenial:    getEnv("USER_ACCESS_DENIAL", "404"),
+
+		TLSCertFile:         getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:          getEnv("TLS_KEY_FILE", ""),
+		TLSMinVersion:       getEnv("TLS_MIN_VERSION", "1.2"),
+		TLSProxyTermination: getEnvAsBool("TLS_PROXY_TERMINATION", false),
+		TrustedProxies:      getEnvAsList("TRUSTED_PROXIES", nil),
+		TLSEnforcement:      strings.ToLower(getEnv("TLS_ENFORCEMENT", TLSEnforcementFail)),
+
+		CookieSecure:   getEnvAsBool("COOKIE_SECURE", true),
+		CookieSameSite: getEnv("COOKIE_SAMESITE", "lax"),
+		CookieDomain:   getEnv("COOKIE_DOMAIN", ""),
+
+		CORSAllowedOrigins:   getEnvAsList("CORS_ALLOWED_ORIGINS", nil),
+		CORSAllowedMethods:   getEnvAsList("CORS_ALLOWED_METHODS", nil),
+		CORSAllowedHeaders:   getEnvAsList("CORS_ALLOWED_HEADERS", nil),
+		CORSAllowCredentials: getEnvAsBool("CORS_ALLOW_CREDENTIALS", false),
+		CORSMaxAge:           time.Duration(getEnvAsInt("CORS_MAX_AGE", 600)) * time.Second,
+
+		UserRoleReconcileInterval: time.Duration(getEnvAsInt("USER_ROLE_RECONCILE_INTERVAL", 60)) * time.Minute,
+		ExpiredRolePurgeInterval:  time.Duration(getEnvAsInt("EXPIRED_ROLE_PURGE_INTERVAL", 15)) * time.Minute,
+		RoleDeletePolicy:          getEnv("ROLE_DELETE_POLICY", "cleanup"),
+		DefaultUserRoles:          getEnvAsList("DEFAULT_USER_ROLES", nil),
+		DelegatedAdminScopes:      getEnvAsBool("DELEGATED_ADMIN_SCOPES", false),
+		EffectivePermissionsCache: getEnvAsBool("EFFECTIVE_PERMISSIONS_CACHE", false),
+		PermissionCacheTTL:        time.Duration(getEnvAsInt("PERMISSION_CACHE_TTL", 30)) * time.Second,
+	}
+
+	// bcrypt solo usa los primeros 72 bytes, por lo que ninguna contraseña más larga se acepta
+	if config.PasswordMinLength > 72 {
+		return nil, errors.New("PASSWORD_MIN_LENGTH no puede ser mayor que 72")
+	}
+
+	// La clave de los secretos TOTP nunca se deriva de la de firma: quien conozca JWT_SECRET (o su
+	// valor por defecto) podría descifrarlos
+	if config.TwoFactorEncryptionKey == "" && config.IsProduction() {
+		return nil, errors.New("TWO_FACTOR_ENCRYPTION_KEY es obligatoria en producción")
+	}
+	if config.TwoFactorEncryptionKey != "" && config.TwoFactorEncryptionKey == config.JWTSecret {
+		return nil, errors.New("TWO_FACTOR_ENCRYPTION_KEY debe ser distinta de JWT_SECRET")
+	}
+
+	if config.OAuthIssuer != "" {
+		if err := validateOAuthIssuer(config.OAuthIssuer, config.IsProduction()); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.CORSAllowCredentials {
+		for _, origin := range config.CORSAllowedOrigins {
+			if strings.TrimSpace(origin) == "*" {
+				return nil, errors.New("CORS_ALLOW_CREDENTIALS=true no admite \"*\" en CORS_ALLOWED_ORIGINS: indique los orígenes exactos")
+			}
+		}
 	}
 
 	return config, nil
 }
 
+// validateOAuthIssuer verifica que OAUTH_ISSUER sea una URL absoluta sin consulta ni fragmento
+// (RFC 8414 §2); en producción además debe usar https
+func validateOAuthIssuer(issuer string, production bool) error {
+	parsed, err := url.Parse(issuer)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+		return fmt.Errorf("OAUTH_ISSUER no válido: %s (use la URL pública del servidor, ej. https://api.ejemplo.com)", issuer)
+	}
+	if parsed.RawQuery != "" || parsed.Fragment != "" {
+		return fmt.Errorf("OAUTH_ISSUER no puede incluir consulta ni fragmento: %s", issuer)
+	}
+	if production && parsed.Scheme != "https" {
+		return fmt.Errorf("OAUTH_ISSUER debe usar https en producción: %s", issuer)
+	}
+	return nil
+}
+
 // getEnv obtiene una variable de entorno o retorna un valor por defecto
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists && value != "" {
@@ -77,6 +363,44 @@ func getEnvAsBool(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
+// getEnvAsList obtiene una variable de entorno con formato "a,b,c" como lista o retorna un
+// valor por defecto. Las entradas vacías se ignoran.
+func getEnvAsList(key string, defaultValue []string) []string {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return defaultValue
+	}
+
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// getEnvAsIntMap obtiene una variable de entorno con formato "clave=valor,clave=valor"
+// como mapa de enteros o retorna un valor por defecto. Las entradas mal formadas se ignoran.
+func getEnvAsIntMap(key string, defaultValue map[string]int) map[string]int {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return defaultValue
+	}
+
+	result := make(map[string]int)
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if intValue, err := strconv.Atoi(strings.TrimSpace(parts[1])); err == nil {
+			result[strings.TrimSpace(parts[0])] = intValue
+		}
+	}
+	return result
+}
+
 // IsDevelopment verifica si estamos en entorno de desarrollo
 func (c *Config) IsDevelopment() bool {
 	return c.Env == "development"
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfigCORS(t *testing.T) {
+	t.Run("comodín con credenciales", func(t *testing.T) {
+		t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.ejemplo.com, *")
+		t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+
+		_, err := LoadConfig()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "CORS_ALLOWED_ORIGINS")
+	})
+
+	t.Run("orígenes exactos con credenciales", func(t *testing.T) {
+		t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.ejemplo.com")
+		t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+
+		cfg, err := LoadConfig()
+		require.NoError(t, err)
+		assert.True(t, cfg.CORSAllowCredentials)
+	})
+
+	t.Run("comodín sin credenciales", func(t *testing.T) {
+		t.Setenv("CORS_ALLOWED_ORIGINS", "*")
+		t.Setenv("CORS_ALLOW_CREDENTIALS", "false")
+
+		_, err := LoadConfig()
+		assert.NoError(t, err)
+	})
+}
+
+func TestLoadConfigPasswordMinLength(t *testing.T) {
+	t.Setenv("PASSWORD_MIN_LENGTH", "73")
+
+	_, err := LoadConfig()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "PASSWORD_MIN_LENGTH")
+}
+
+func TestLoadConfigTwoFactorEncryptionKey(t *testing.T) {
+	t.Run("sin clave en producción", func(t *testing.T) {
+		t.Setenv("ENV", "production")
+		t.Setenv("TWO_FACTOR_ENCRYPTION_KEY", "")
+
+		_, err := LoadConfig()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "TWO_FACTOR_ENCRYPTION_KEY")
+	})
+
+	t.Run("sin clave fuera de producción", func(t *testing.T) {
+		t.Setenv("ENV", "development")
+		t.Setenv("TWO_FACTOR_ENCRYPTION_KEY", "")
+
+		cfg, err := LoadConfig()
+		require.NoError(t, err)
+		assert.Empty(t, cfg.TwoFactorEncryptionKey)
+	})
+
+	t.Run("igual a JWT_SECRET", func(t *testing.T) {
+		t.Setenv("JWT_SECRET", "compartida")
+		t.Setenv("TWO_FACTOR_ENCRYPTION_KEY", "compartida")
+
+		_, err := LoadConfig()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "JWT_SECRET")
+	})
+
+	t.Run("clave propia", func(t *testing.T) {
+		t.Setenv("ENV", "production")
+		t.Setenv("TWO_FACTOR_ENCRYPTION_KEY", "clave-totp")
+
+		cfg, err := LoadConfig()
+		require.NoError(t, err)
+		assert.Equal(t, "clave-totp", cfg.TwoFactorEncryptionKey)
+	})
+}
+
+func TestLoadConfigOAuthIssuer(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		issuer  string
+		wantErr bool
+	}{
+		{"sin OAUTH_ISSUER en producción", "production", "", false},
+		{"https en producción", "production", "https://api.ejemplo.com", false},
+		{"http en producción", "production", "http://api.ejemplo.com", true},
+		{"http en desarrollo", "development", "http://localhost:3000", false},
+		{"sin esquema", "development", "api.ejemplo.com", true},
+		{"con consulta", "development", "https://api.ejemplo.com?tenant=1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENV", tt.env)
+			t.Setenv("OAUTH_ISSUER", tt.issuer)
+			t.Setenv("TWO_FACTOR_ENCRYPTION_KEY", "clave-totp")
+
+			_, err := LoadConfig()
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "OAUTH_ISSUER")
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// Valores de TLS_ENFORCEMENT
+const (
+	TLSEnforcementFail = "fail" // No iniciar en producción sin TLS
+	TLSEnforcementWarn = "warn" // Iniciar y registrar una advertencia
+)
+
+// ErrInsecureTransport indica que en producción no consta que las conexiones usen TLS
+var ErrInsecureTransport = errors.New("en producción las conexiones deben usar TLS")
+
+// tlsVersions son los valores admitidos de TLS_MIN_VERSION
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// CheckTransportSecurity verifica al iniciar la configuración de TLS y cookies. En producción
+// exige TLS en el propio servidor (TLS_CERT_FILE y TLS_KEY_FILE) o terminado en un proxy de
+// confianza (TLS_PROXY_TERMINATION con TRUSTED_PROXIES); si no consta retorna
+// ErrInsecureTransport, o lo agrega a las advertencias con TLS_ENFORCEMENT=warn. Los valores no
+// válidos se rechazan en cualquier entorno.
+func (c *Config) CheckTransportSecurity() (warnings []string, err error) {
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return nil, errors.New("TLS_CERT_FILE y TLS_KEY_FILE deben configurarse juntos")
+	}
+	if _, ok := tlsVersions[c.TLSMinVersion]; !ok {
+		return nil, fmt.Errorf("TLS_MIN_VERSION no válido: %s (use 1.2 o 1.3)", c.TLSMinVersion)
+	}
+	if c.TLSEnforcement != TLSEnforcementFail && c.TLSEnforcement != TLSEnforcementWarn {
+		return nil, fmt.Errorf("TLS_ENFORCEMENT no válido: %s (use fail o warn)", c.TLSEnforcement)
+	}
+	sameSite, err := utils.ParseSameSite(c.CookieSameSite)
+	if err != nil {
+		return nil, fmt.Errorf("COOKIE_SAMESITE: %w", err)
+	}
+	if sameSite == http.SameSiteNoneMode && !c.CookieSecure {
+		return nil, errors.New("COOKIE_SAMESITE=none requiere COOKIE_SECURE=true")
+	}
+
+	if !c.IsProduction() {
+		return nil, nil
+	}
+
+	var insecure error
+	switch {
+	case c.TLSCertFile != "":
+	case c.TLSProxyTermination && len(c.TrustedProxies) == 0:
+		insecure = fmt.Errorf("%w: TLS_PROXY_TERMINATION requiere TRUSTED_PROXIES con las direcciones del proxy", ErrInsecureTransport)
+	case !c.TLSProxyTermination:
+		insecure = fmt.Errorf("%w: configure TLS_CERT_FILE y TLS_KEY_FILE, o TLS_PROXY_TERMINATION=true y TRUSTED_PROXIES", ErrInsecureTransport)
+	}
+	if insecure != nil {
+		if c.TLSEnforcement == TLSEnforcementFail {
+			return nil, insecure
+		}
+		warnings = append(warnings, insecure.Error())
+	}
+	if !c.CookieSecure {
+		warnings = append(warnings, "COOKIE_SECURE=false: las cookies también se enviarán por HTTP")
+	}
+	return warnings, nil
+}
+
+// ServerTLSConfig retorna la configuración TLS del servidor, o nil si no sirve TLS directamente
+// (sin TLS_CERT_FILE). Debe llamarse después de CheckTransportSecurity.
+func (c *Config) ServerTLSConfig() *tls.Config {
+	if c.TLSCertFile == "" {
+		return nil
+	}
+	minVersion, ok := tlsVersions[c.TLSMinVersion]
+	if !ok {
+		minVersion = tls.VersionTLS12
+	}
+	return &tls.Config{MinVersion: minVersion}
+}
+
+// CookieOptions retorna los atributos con los que la API emite sus cookies (ver
+// utils.CookieOptions). Un COOKIE_SAMESITE no válido se reemplaza por Lax.
+func (c *Config) CookieOptions() utils.CookieOptions {
+	options := utils.DefaultCookieOptions()
+	options.Domain = c.CookieDomain
+	options.Secure = c.CookieSecure
+	if sameSite, err := utils.ParseSameSite(c.CookieSameSite); err == nil {
+		options.SameSite = sameSite
+	}
+	return options
+}
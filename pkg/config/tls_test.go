@@ -0,0 +1,102 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// transportConfig retorna una configuración de producción con los valores por defecto de
+// LoadConfig y sin TLS
+func transportConfig(change func(c *Config)) *Config {
+	c := &Config{
+		Env:            "production",
+		TLSMinVersion:  "1.2",
+		TLSEnforcement: TLSEnforcementFail,
+		CookieSecure:   true,
+		CookieSameSite: "lax",
+	}
+	if change != nil {
+		change(c)
+	}
+	return c
+}
+
+func TestCheckTransportSecurity(t *testing.T) {
+	tests := []struct {
+		name             string
+		change           func(c *Config)
+		wantInsecure     bool
+		wantErr          bool
+		expectedWarnings int
+	}{
+		{"producción sin TLS", nil, true, true, 0},
+		{"producción sin TLS con TLS_ENFORCEMENT=warn", func(c *Config) { c.TLSEnforcement = TLSEnforcementWarn }, false, false, 1},
+		{"TLS en el servidor", func(c *Config) { c.TLSCertFile, c.TLSKeyFile = "cert.pem", "key.pem" }, false, false, 0},
+		{"proxy de confianza", func(c *Config) {
+			c.TLSProxyTermination = true
+			c.TrustedProxies = []string{"10.0.0.0/8"}
+		}, false, false, 0},
+		{"proxy sin TRUSTED_PROXIES", func(c *Config) { c.TLSProxyTermination = true }, true, true, 0},
+		{"TRUSTED_PROXIES sin TLS_PROXY_TERMINATION", func(c *Config) { c.TrustedProxies = []string{"10.0.0.1"} }, true, true, 0},
+		{"COOKIE_SECURE=false en producción advierte", func(c *Config) {
+			c.TLSCertFile, c.TLSKeyFile = "cert.pem", "key.pem"
+			c.CookieSecure = false
+		}, false, false, 1},
+		{"desarrollo sin TLS", func(c *Config) { c.Env = "development" }, false, false, 0},
+		{"certificado sin clave", func(c *Config) {
+			c.Env = "development"
+			c.TLSCertFile = "cert.pem"
+		}, false, true, 0},
+		{"versión mínima no válida", func(c *Config) {
+			c.Env = "development"
+			c.TLSMinVersion = "1.0"
+		}, false, true, 0},
+		{"TLS_ENFORCEMENT no válido", func(c *Config) { c.TLSEnforcement = "ignore" }, false, true, 0},
+		{"SameSite=None sin Secure", func(c *Config) {
+			c.Env = "development"
+			c.CookieSameSite = "none"
+			c.CookieSecure = false
+		}, false, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, err := transportConfig(tt.change).CheckTransportSecurity()
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Equal(t, tt.wantInsecure, errors.Is(err, ErrInsecureTransport))
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, warnings, tt.expectedWarnings)
+		})
+	}
+}
+
+func TestServerTLSConfig(t *testing.T) {
+	assert.Nil(t, transportConfig(nil).ServerTLSConfig())
+
+	c := transportConfig(func(c *Config) {
+		c.TLSCertFile, c.TLSKeyFile = "cert.pem", "key.pem"
+		c.TLSMinVersion = "1.3"
+	})
+	require.NotNil(t, c.ServerTLSConfig())
+	assert.Equal(t, uint16(tls.VersionTLS13), c.ServerTLSConfig().MinVersion)
+}
+
+func TestConfigCookieOptions(t *testing.T) {
+	options := transportConfig(func(c *Config) {
+		c.CookieDomain = "ejemplo.com"
+		c.CookieSameSite = "Strict"
+	}).CookieOptions()
+
+	assert.Equal(t, "ejemplo.com", options.Domain)
+	assert.True(t, options.Secure)
+	assert.True(t, options.HttpOnly)
+	assert.Equal(t, http.SameSiteStrictMode, options.SameSite)
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/black4ninja/mi-proyecto/internal/oauth/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// APIKeyHeader es el header con el que los clientes de servicio envían su API key
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyUserIDPrefix antecede al ID de la API key en la identidad sintética guardada en el
+// contexto (userID), para que no se confunda con el ID de un usuario real
+const APIKeyUserIDPrefix = "apikey:"
+
+// APIKeyMiddleware autentica peticiones con una API key en lugar de un token OAuth.
+// Deja en el contexto las mismas claves que OAuthMiddleware.Protected (userID, scopes,
+// permissions), de modo que RequireScope y PermissionMiddleware funcionan sin cambios.
+type APIKeyMiddleware struct {
+	apiKeyUseCase domain.APIKeyUseCase
+}
+
+// NewAPIKeyMiddleware crea un nuevo middleware de API keys
+func NewAPIKeyMiddleware(apiKeyUseCase domain.APIKeyUseCase) *APIKeyMiddleware {
+	return &APIKeyMiddleware{
+		apiKeyUseCase: apiKeyUseCase,
+	}
+}
+
+// Protected protege rutas exigiendo una API key válida en el header X-API-Key
+func (m *APIKeyMiddleware) Protected() gin.HandlerFunc {
+	return m.Or(func(c *gin.Context) {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "No autorizado: API key no proporcionada")
+		c.Abort()
+	})
+}
+
+// Or autentica con la API key si la petición incluye el header X-API-Key y, si no,
+// delega en fallback (normalmente OAuthMiddleware.Protected), de modo que una misma
+// ruta acepte ambos métodos de autenticación
+func (m *APIKeyMiddleware) Or(fallback gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(APIKeyHeader)
+		if key == "" {
+			fallback(c)
+			return
+		}
+
+		apiKey, err := m.apiKeyUseCase.Authenticate(key)
+		if err != nil {
+			if errors.Is(err, domain.ErrInvalidAPIKey) || errors.Is(err, domain.ErrAPIKeyRevoked) || errors.Is(err, domain.ErrAPIKeyExpired) {
+				utils.ErrorResponse(c, http.StatusUnauthorized, "No autorizado: "+err.Error())
+			} else {
+				log.Printf("[ERROR] no se pudo validar la API key error=%v", err)
+				utils.ErrorResponse(c, http.StatusInternalServerError, "Error al validar la API key")
+			}
+			c.Abort()
+			return
+		}
+
+		// Identidad sintética: equivalente a los claims de un access token
+		c.Set(AuthenticatedContextKey, true)
+		c.Set(utils.UserIDContextKey, APIKeyUserIDPrefix+apiKey.ID.Hex())
+		c.Set(utils.APIKeyIDContextKey, apiKey.ID.Hex())
+		c.Set("scopes", apiKey.Scopes)
+		c.Set("permissions", apiKey.Permissions)
+
+		c.Next()
+	}
+}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/black4ninja/mi-proyecto/internal/oauth/domain"
+	permDomain "github.com/black4ninja/mi-proyecto/internal/permission/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// fakeAPIKeyUseCase autentica las claves configuradas; el resto de métodos entra en
+// pánico a través de la interfaz embebida
+type fakeAPIKeyUseCase struct {
+	domain.APIKeyUseCase
+	keys map[string]*domain.APIKey
+	errs map[string]error
+}
+
+func (f *fakeAPIKeyUseCase) Authenticate(key string) (*domain.APIKey, error) {
+	if err, ok := f.errs[key]; ok {
+		return nil, err
+	}
+	if apiKey, ok := f.keys[key]; ok {
+		return apiKey, nil
+	}
+	return nil, domain.ErrInvalidAPIKey
+}
+
+// panicUserRoleUseCase falla la prueba si se consultan los roles de la identidad sintética
+type panicUserRoleUseCase struct {
+	permDomain.UserRoleUseCase
+	t *testing.T
+}
+
+func (f *panicUserRoleUseCase) HasPermission(userID string, permissionCode string) (bool, error) {
+	f.t.Errorf("no se deben consultar roles para la API key (user=%s permission=%s)", userID, permissionCode)
+	return false, nil
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	keyID := primitive.NewObjectID()
+	useCase := &fakeAPIKeyUseCase{
+		keys: map[string]*domain.APIKey{
+			"ak_valida": {
+				ID:          keyID,
+				Scopes:      []string{"read"},
+				Permissions: []string{"inventario:*"},
+			},
+		},
+		errs: map[string]error{
+			"ak_revocada": domain.ErrAPIKeyRevoked,
+			"ak_vencida":  domain.ErrAPIKeyExpired,
+			"ak_fallo":    errors.New("timeout de mongo"),
+		},
+	}
+	apiKeys := NewAPIKeyMiddleware(useCase)
+	oauth := NewOAuthMiddleware(&fakeOAuthUseCase{claims: map[string]interface{}{"scopes": []string{"write"}}})
+	permissions := NewPermissionMiddleware(&panicUserRoleUseCase{t: t})
+	permissions.SetDenialLogging(DenialLogOff, nil)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/solo-api-key", apiKeys.Protected(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user": c.GetString(utils.UserIDContextKey)})
+	})
+	r.GET("/inventario", apiKeys.Protected(), oauth.RequireScope("read"),
+		permissions.RequirePermission("inventario:read"), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+	r.GET("/finanzas", apiKeys.Protected(), permissions.RequirePermission("finanzas:read"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.GET("/mixta", apiKeys.Or(oauth.Protected()), oauth.RequireScope("write"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		path       string
+		headers    map[string]string
+		wantStatus int
+	}{
+		{"clave válida", "/solo-api-key", map[string]string{APIKeyHeader: "ak_valida"}, http.StatusOK},
+		{"clave revocada", "/solo-api-key", map[string]string{APIKeyHeader: "ak_revocada"}, http.StatusUnauthorized},
+		{"clave vencida", "/solo-api-key", map[string]string{APIKeyHeader: "ak_vencida"}, http.StatusUnauthorized},
+		{"clave desconocida", "/solo-api-key", map[string]string{APIKeyHeader: "ak_otra"}, http.StatusUnauthorized},
+		{"sin clave", "/solo-api-key", nil, http.StatusUnauthorized},
+		{"error al validar", "/solo-api-key", map[string]string{APIKeyHeader: "ak_fallo"}, http.StatusInternalServerError},
+		{"scope y permiso comodín de la clave", "/inventario", map[string]string{APIKeyHeader: "ak_valida"}, http.StatusOK},
+		{"permiso no asignado a la clave", "/finanzas", map[string]string{APIKeyHeader: "ak_valida"}, http.StatusForbidden},
+		{"ruta mixta con token OAuth", "/mixta", map[string]string{"Authorization": "Bearer token"}, http.StatusOK},
+		{"ruta mixta con clave sin el scope", "/mixta", map[string]string{APIKeyHeader: "ak_valida"}, http.StatusForbidden},
+		{"ruta mixta sin credenciales", "/mixta", nil, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+			if tt.path == "/solo-api-key" && tt.wantStatus == http.StatusOK {
+				assert.Contains(t, w.Body.String(), APIKeyUserIDPrefix+keyID.Hex())
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PrivateCacheControl impide que las cachés compartidas (proxies, CDN) guarden la respuesta y
+// obliga al navegador a revalidarla antes de reutilizarla
+const PrivateCacheControl = "private, no-cache"
+
+// privateCacheVary son los headers de credenciales de los que depende la respuesta
+var privateCacheVary = []string{"Authorization", APIKeyHeader}
+
+// PrivateCache marca las respuestas de las rutas protegidas como privadas (ver
+// SetPrivateCacheHeaders). Se registra antes del middleware de autenticación para que también
+// las respuestas 401 lleven los headers.
+func PrivateCache() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		SetPrivateCacheHeaders(c)
+		c.Next()
+	}
+}
+
+// SetPrivateCacheHeaders establece Cache-Control: private, no-cache y añade Authorization y
+// X-API-Key a Vary, de modo que una caché compartida no entregue a un usuario los listados o
+// recursos de otro. Conserva los valores de Vary ya presentes y no los duplica.
+func SetPrivateCacheHeaders(c *gin.Context) {
+	header := c.Writer.Header()
+	header.Set("Cache-Control", PrivateCacheControl)
+	addVary(header, privateCacheVary...)
+}
+
+// addVary añade a Vary los headers que aún no incluye
+func addVary(header http.Header, names ...string) {
+	for _, name := range names {
+		if !hasVary(header, name) {
+			header.Add("Vary", name)
+		}
+	}
+}
+
+// hasVary indica si Vary ya incluye el header indicado (o "*")
+func hasVary(header http.Header, name string) bool {
+	for _, value := range header.Values("Vary") {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if field == "*" || strings.EqualFold(field, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
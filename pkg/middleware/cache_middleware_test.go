@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// setupPrivateCacheRouter registra un listado y un recurso protegidos por un middleware de
+// autenticación de prueba que solo acepta "Bearer valid"
+func setupPrivateCacheRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	auth := func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "Bearer valid" {
+			utils.ErrorResponse(c, http.StatusUnauthorized, "No autorizado")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+
+	api := r.Group("/api", PrivateCache(), auth)
+	api.GET("/items", func(c *gin.Context) {
+		utils.PaginatedResponse(c, http.StatusOK, "Items", []string{"a"}, utils.PaginationMeta{})
+	})
+	api.GET("/items/:id", func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		utils.SuccessResponse(c, http.StatusOK, "Item", gin.H{"id": c.Param("id")})
+	})
+	return r
+}
+
+func TestPrivateCache(t *testing.T) {
+	r := setupPrivateCacheRouter()
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		expectedCode  int
+		expectedVary  []string
+	}{
+		{"listado autenticado", "/api/items?page=2", "Bearer valid", http.StatusOK, []string{"Authorization", "X-API-Key"}},
+		{"recurso autenticado conserva Vary", "/api/items/1", "Bearer valid", http.StatusOK, []string{"Authorization", "X-API-Key", "Accept-Encoding"}},
+		{"sin credenciales", "/api/items", "", http.StatusUnauthorized, []string{"Authorization", "X-API-Key"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, "private, no-cache", w.Header().Get("Cache-Control"))
+			assert.ElementsMatch(t, tt.expectedVary, w.Header().Values("Vary"))
+		})
+	}
+}
+
+func TestSetPrivateCacheHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("no duplica Vary", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Writer.Header().Set("Vary", "accept-encoding, authorization")
+
+		SetPrivateCacheHeaders(c)
+		SetPrivateCacheHeaders(c)
+
+		assert.Equal(t, []string{"accept-encoding, authorization", "X-API-Key"}, c.Writer.Header().Values("Vary"))
+		assert.Equal(t, PrivateCacheControl, c.Writer.Header().Get("Cache-Control"))
+	})
+
+	t.Run("Vary comodín", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Writer.Header().Set("Vary", "*")
+
+		SetPrivateCacheHeaders(c)
+
+		assert.Equal(t, []string{"*"}, c.Writer.Header().Values("Vary"))
+	})
+}
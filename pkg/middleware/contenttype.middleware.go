@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// Tipos de contenido aceptados por los endpoints de escritura
+const (
+	ContentTypeJSON = "application/json"
+	ContentTypeForm = "application/x-www-form-urlencoded"
+	ContentTypeCSV  = "text/csv"
+)
+
+// RequireJSON rechaza con 415 las solicitudes de escritura cuyo cuerpo no sea JSON
+func RequireJSON() gin.HandlerFunc {
+	return RequireContentType(ContentTypeJSON)
+}
+
+// RequireJSONOrForm acepta cuerpos JSON o de formulario (ej. endpoint de tokens OAuth)
+func RequireJSONOrForm() gin.HandlerFunc {
+	return RequireContentType(ContentTypeJSON, ContentTypeForm)
+}
+
+// RequireContentType rechaza con 415 Unsupported Media Type las solicitudes POST, PUT y PATCH
+// con cuerpo cuyo Content-Type no esté entre los permitidos. Los parámetros del tipo
+// (ej. charset) se ignoran. Las solicitudes sin cuerpo y los demás métodos no se validan.
+func RequireContentType(allowed ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isWriteMethod(c.Request.Method) || !hasBody(c.Request) {
+			c.Next()
+			return
+		}
+
+		mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+		if err == nil {
+			for _, contentType := range allowed {
+				if strings.EqualFold(mediaType, contentType) {
+					c.Next()
+					return
+				}
+			}
+		}
+
+		utils.ErrorResponse(c, http.StatusUnsupportedMediaType,
+			"Content-Type no soportado: se espera "+strings.Join(allowed, " o "))
+		c.Abort()
+	}
+}
+
+// isWriteMethod indica si el método HTTP modifica recursos con un cuerpo
+func isWriteMethod(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch
+}
+
+// hasBody indica si la solicitud trae cuerpo (ContentLength -1 significa desconocido)
+func hasBody(req *http.Request) bool {
+	return req.Body != nil && req.Body != http.NoBody && req.ContentLength != 0
+}
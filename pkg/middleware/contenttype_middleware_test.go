@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupContentTypeRouter registra rutas de escritura protegidas por el middleware indicado
+func setupContentTypeRouter(m gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.POST("/resource", m, ok)
+	r.PUT("/resource", m, ok)
+	r.GET("/resource", m, ok)
+	return r
+}
+
+func sendWithContentType(r *gin.Engine, method, contentType, body string) int {
+	req, _ := http.NewRequest(method, "/resource", strings.NewReader(body))
+	if body == "" {
+		req, _ = http.NewRequest(method, "/resource", nil)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRequireJSON(t *testing.T) {
+	r := setupContentTypeRouter(RequireJSON())
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		expected    int
+	}{
+		{"json", "POST", "application/json", `{"a":1}`, http.StatusOK},
+		{"json con charset", "PUT", "application/json; charset=utf-8", `{"a":1}`, http.StatusOK},
+		{"json en mayúsculas", "POST", "Application/JSON", `{"a":1}`, http.StatusOK},
+		{"formulario", "POST", "application/x-www-form-urlencoded", "a=1", http.StatusUnsupportedMediaType},
+		{"texto plano", "PUT", "text/plain", "hola", http.StatusUnsupportedMediaType},
+		{"sin content-type", "POST", "", `{"a":1}`, http.StatusUnsupportedMediaType},
+		{"sin cuerpo", "PUT", "", "", http.StatusOK},
+		{"lectura", "GET", "text/plain", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, sendWithContentType(r, tt.method, tt.contentType, tt.body))
+		})
+	}
+}
+
+func TestRequireJSONOrForm(t *testing.T) {
+	r := setupContentTypeRouter(RequireJSONOrForm())
+
+	assert.Equal(t, http.StatusOK, sendWithContentType(r, "POST", "application/json", `{"a":1}`))
+	assert.Equal(t, http.StatusOK, sendWithContentType(r, "POST", "application/x-www-form-urlencoded", "a=1"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, sendWithContentType(r, "POST", "multipart/form-data; boundary=x", "--x--"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, sendWithContentType(r, "POST", "text/xml", "<a/>"))
+}
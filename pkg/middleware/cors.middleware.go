@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Valores por defecto de CORSConfig
+var (
+	DefaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	DefaultCORSHeaders = []string{"Authorization", "Content-Type", APIKeyHeader, "If-Unmodified-Since"}
+)
+
+// CORSConfig configura los orígenes de navegador que pueden consumir la API
+type CORSConfig struct {
+	AllowedOrigins   []string      // Orígenes exactos (ej. "https://app.ejemplo.com"); "*" admite cualquiera sin credenciales
+	AllowedMethods   []string      // Métodos admitidos en las solicitudes preflight (vacío = DefaultCORSMethods)
+	AllowedHeaders   []string      // Headers que el navegador puede enviar (vacío = DefaultCORSHeaders)
+	AllowCredentials bool          // Permite enviar cookies y credenciales HTTP desde el navegador
+	MaxAge           time.Duration // Tiempo que el navegador guarda la respuesta preflight (0 = no se indica)
+}
+
+// NewCORS retorna un middleware que aplica CORS según config. Debe registrarse con router.Use
+// antes que las rutas, para que también atienda las solicitudes preflight (OPTIONS) de rutas
+// que no declaran ese método: las responde con 204 sin llegar a los handlers, o con 403 si el
+// origen no está permitido. Access-Control-Allow-Origin repite el origen de la solicitud solo
+// cuando está en la lista, o es "*" si la lista lo incluye. Con AllowCredentials se ignora "*"
+// (LoadConfig rechaza esa combinación): nunca se repite un origen que no esté en la lista.
+func NewCORS(config CORSConfig) gin.HandlerFunc {
+	origins := make(map[string]bool, len(config.AllowedOrigins))
+	anyOrigin := false
+	for _, origin := range config.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+		if origin == "*" {
+			anyOrigin = !config.AllowCredentials
+		} else if origin != "" {
+			origins[origin] = true
+		}
+	}
+
+	methods := config.AllowedMethods
+	if len(methods) == 0 {
+		methods = DefaultCORSMethods
+	}
+	headers := config.AllowedHeaders
+	if len(headers) == 0 {
+		headers = DefaultCORSHeaders
+	}
+	allowMethods := strings.ToUpper(strings.Join(methods, ", "))
+	allowHeaders := strings.Join(headers, ", ")
+	maxAge := ""
+	if config.MaxAge > 0 {
+		maxAge = strconv.Itoa(int(config.MaxAge.Seconds()))
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		// La respuesta depende del origen salvo que se responda "*" a todos
+		if !anyOrigin {
+			addVary(header, "Origin")
+		}
+		if preflight {
+			addVary(header, "Access-Control-Request-Method", "Access-Control-Request-Headers")
+		}
+
+		if !anyOrigin && !origins[strings.ToLower(origin)] {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			// Sin headers CORS el navegador no entrega la respuesta a la aplicación
+			c.Next()
+			return
+		}
+
+		if anyOrigin {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if config.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			c.Next()
+			return
+		}
+
+		header.Set("Access-Control-Allow-Methods", allowMethods)
+		header.Set("Access-Control-Allow-Headers", allowHeaders)
+		if maxAge != "" {
+			header.Set("Access-Control-Max-Age", maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupCORSRouter registra el middleware de forma global, igual que main, y una ruta de
+// escritura sin handler OPTIONS
+func setupCORSRouter(config CORSConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(NewCORS(config))
+	r.POST("/api/items", func(c *gin.Context) { c.Status(http.StatusCreated) })
+	return r
+}
+
+func sendCORS(r *gin.Engine, method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, "/api/items", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORSPreflight(t *testing.T) {
+	r := setupCORSRouter(CORSConfig{
+		AllowedOrigins:   []string{"https://app.ejemplo.com/"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+	preflight := map[string]string{
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "authorization, content-type",
+	}
+
+	t.Run("origen permitido", func(t *testing.T) {
+		w := sendCORS(r, http.MethodOptions, "https://app.ejemplo.com", preflight)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "https://app.ejemplo.com", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Equal(t, "GET, POST, PUT, PATCH, DELETE", w.Header().Get("Access-Control-Allow-Methods"))
+		assert.Equal(t, "Authorization, Content-Type, X-API-Key, If-Unmodified-Since", w.Header().Get("Access-Control-Allow-Headers"))
+		assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+		assert.ElementsMatch(t, []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}, w.Header().Values("Vary"))
+		assert.Empty(t, w.Body.String())
+	})
+
+	t.Run("origen no permitido", func(t *testing.T) {
+		w := sendCORS(r, http.MethodOptions, "https://otro.ejemplo.com", preflight)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Methods"))
+	})
+
+	t.Run("OPTIONS sin Access-Control-Request-Method no es preflight", func(t *testing.T) {
+		w := sendCORS(r, http.MethodOptions, "https://app.ejemplo.com", nil)
+
+		assert.NotEqual(t, http.StatusNoContent, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Methods"))
+	})
+}
+
+func TestCORSRequests(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         CORSConfig
+		origin         string
+		expectedOrigin string
+		expectedVary   []string
+	}{
+		{"origen permitido", CORSConfig{AllowedOrigins: []string{"https://app.ejemplo.com"}}, "https://App.Ejemplo.com", "https://App.Ejemplo.com", []string{"Origin"}},
+		{"origen no permitido", CORSConfig{AllowedOrigins: []string{"https://app.ejemplo.com"}}, "https://otro.ejemplo.com", "", []string{"Origin"}},
+		{"sin Origin", CORSConfig{AllowedOrigins: []string{"https://app.ejemplo.com"}}, "", "", nil},
+		{"comodín sin credenciales", CORSConfig{AllowedOrigins: []string{"*"}}, "https://otro.ejemplo.com", "*", nil},
+		{"comodín con credenciales no repite el origen", CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}, "https://otro.ejemplo.com", "", []string{"Origin"}},
+		{"comodín con credenciales solo admite la lista", CORSConfig{AllowedOrigins: []string{"*", "https://app.ejemplo.com"}, AllowCredentials: true}, "https://app.ejemplo.com", "https://app.ejemplo.com", []string{"Origin"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := sendCORS(setupCORSRouter(tt.config), http.MethodPost, tt.origin, nil)
+
+			// El handler se ejecuta siempre: el navegador decide con los headers
+			assert.Equal(t, http.StatusCreated, w.Code)
+			assert.Equal(t, tt.expectedOrigin, w.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tt.expectedVary, w.Header().Values("Vary"))
+			assert.Empty(t, w.Header().Get("Access-Control-Allow-Methods"))
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// ErrorFormat establece el formato de las respuestas de error de las rutas (ver
+// utils.ParseErrorFormat). Con utils.ErrorFormatEnvelope los clientes aún pueden pedir
+// problem+json por petición con el header Accept.
+func ErrorFormat(format string) gin.HandlerFunc {
+	format = utils.ParseErrorFormat(format)
+	return func(c *gin.Context) {
+		c.Set(utils.ErrorFormatContextKey, format)
+		c.Next()
+	}
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+func TestErrorFormat(t *testing.T) {
+	tests := []struct {
+		format      string
+		contentType string
+	}{
+		{format: "problem", contentType: utils.ProblemContentType},
+		{format: "envelope", contentType: "application/json"},
+		{format: "", contentType: "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(ErrorFormat(tt.format))
+			r.POST("/resource", RequireJSON(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/resource", strings.NewReader("texto"))
+			req.Header.Set("Content-Type", "text/plain")
+			r.ServeHTTP(w, req)
+
+			// Los errores de los middlewares también respetan el formato configurado
+			assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+			assert.Equal(t, tt.contentType+"; charset=utf-8", w.Header().Get("Content-Type"))
+		})
+	}
+}
@@ -2,7 +2,9 @@ package middleware
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -10,15 +12,22 @@ import (
 	"github.com/black4ninja/mi-proyecto/pkg/utils"
 )
 
+// AuthenticatedContextKey se establece en el contexto cuando Protected valida el token.
+// Permite a los middlewares posteriores distinguir una petición sin token de una ruta
+// en la que el middleware de autenticación no se registró.
+const AuthenticatedContextKey = "authenticated"
+
 // OAuthMiddleware maneja la autenticación a nivel de middleware
 type OAuthMiddleware struct {
 	oauthUseCase domain.OAuthUseCase
+	now          func() time.Time
 }
 
 // NewOAuthMiddleware crea un nuevo middleware de OAuth
 func NewOAuthMiddleware(oauthUseCase domain.OAuthUseCase) *OAuthMiddleware {
 	return &OAuthMiddleware{
 		oauthUseCase: oauthUseCase,
+		now:          time.Now,
 	}
 }
 
@@ -44,16 +53,22 @@ func (m *OAuthMiddleware) Protected() gin.HandlerFunc {
 		// Obtener el token
 		accessToken := parts[1]
 
-		// Validar el token
+		// Validar el token. El cliente recibe un código y un mensaje estables según el tipo de
+		// fallo (expirado, mal formado o inválido), nunca el error interno.
 		userID, claims, err := m.oauthUseCase.ValidateToken(accessToken)
 		if err != nil {
-			utils.ErrorResponse(c, http.StatusUnauthorized, err.Error())
+			code, message := utils.TokenErrorCode(err)
+			// RFC 6750 §3: los errores de token de acceso indican el esquema y el código
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			utils.ErrorCodeResponse(c, http.StatusUnauthorized, code, message)
 			c.Abort()
 			return
 		}
 
-		// Almacenar el userID en el contexto
-		c.Set("userID", userID)
+		// Almacenar el userID y el token en el contexto
+		c.Set(AuthenticatedContextKey, true)
+		c.Set(utils.UserIDContextKey, userID)
+		c.Set("accessToken", accessToken)
 
 		// Almacenar claims en el contexto
 		if claims != nil {
@@ -93,7 +108,7 @@ func (m *OAuthMiddleware) RequireScope(scope string) gin.HandlerFunc {
 func (m *OAuthMiddleware) RequireRole(role string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Verificar si hay rol en el contexto
-		userRole, exists := c.Get("role")
+		userRole, exists := utils.ClaimString(c, "role")
 		if !exists {
 			utils.ErrorResponse(c, http.StatusForbidden, "Acceso denegado: no se encontró rol")
 			c.Abort()
@@ -101,7 +116,7 @@ func (m *OAuthMiddleware) RequireRole(role string) gin.HandlerFunc {
 		}
 
 		// Verificar si el rol es el requerido
-		if userRole.(string) != role {
+		if userRole != role {
 			utils.ErrorResponse(c, http.StatusForbidden, "Acceso denegado: rol requerido "+role)
 			c.Abort()
 			return
@@ -111,6 +126,27 @@ func (m *OAuthMiddleware) RequireRole(role string) gin.HandlerFunc {
 	}
 }
 
+// RequireRecentAuth exige que el usuario se haya autenticado hace menos de maxAge (claim auth_time).
+// Se aplica a rutas sensibles (ej. cambio de contraseña) después de Protected. Los tokens sin
+// auth_time, como los emitidos antes de existir el claim, también deben reautenticarse.
+func (m *OAuthMiddleware) RequireRecentAuth(maxAge time.Duration) gin.HandlerFunc {
+	maxAgeSeconds := strconv.Itoa(int(maxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		authTime, ok := utils.ClaimTime(c, "auth_time")
+		if !ok || m.now().Sub(authTime) > maxAge {
+			// Desafío de autenticación escalonada (RFC 9470): el cliente debe volver a pedir credenciales
+			c.Header("WWW-Authenticate", `Bearer error="insufficient_user_authentication", `+
+				`error_description="Se requiere una autenticación reciente", max_age=`+maxAgeSeconds)
+			utils.ErrorResponse(c, http.StatusUnauthorized, "Se requiere una autenticación reciente, inicie sesión nuevamente")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
 // contains verifica si un slice contiene un elemento
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/black4ninja/mi-proyecto/internal/oauth/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// fakeOAuthUseCase valida cualquier token retornando los claims configurados, o err si se
+// definió; el resto de métodos entra en pánico a través de la interfaz embebida
+type fakeOAuthUseCase struct {
+	domain.OAuthUseCase
+	claims map[string]interface{}
+	err    error
+}
+
+func (f *fakeOAuthUseCase) ValidateToken(accessToken string) (string, map[string]interface{}, error) {
+	if f.err != nil {
+		return "", nil, f.err
+	}
+	return "usuario-1", f.claims, nil
+}
+
+func TestProtectedTokenErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantCode    string
+		wantMessage string
+	}{
+		{"expirado", utils.ErrTokenExpired, utils.TokenErrorExpired, "token expirado"},
+		{"mal formado", utils.ErrTokenMalformed, utils.TokenErrorMalformed, "token con formato inválido"},
+		{"firma inválida", utils.ErrTokenInvalid, utils.TokenErrorInvalid, "token inválido"},
+		{"revocado", utils.ErrTokenRevoked, utils.TokenErrorInvalid, "token revocado"},
+		{"error interno", errors.New("token is malformed: could not base64 decode header"), utils.TokenErrorInvalid, "token inválido"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			m := NewOAuthMiddleware(&fakeOAuthUseCase{err: tt.err})
+			r.GET("/privado", m.Protected(), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req, _ := http.NewRequest("GET", "/privado", nil)
+			req.Header.Set("Authorization", "Bearer token")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.Equal(t, `Bearer error="invalid_token"`, w.Header().Get("WWW-Authenticate"))
+			var body utils.Response
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, tt.wantCode, body.Code)
+			assert.Equal(t, tt.wantMessage, body.Error)
+		})
+	}
+}
+
+func TestRequireRecentAuth(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		claims     map[string]interface{}
+		wantStatus int
+	}{
+		{
+			name:       "autenticación reciente",
+			claims:     map[string]interface{}{"auth_time": float64(now.Add(-2 * time.Minute).Unix())},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "autenticación antigua",
+			claims:     map[string]interface{}{"auth_time": float64(now.Add(-6 * time.Minute).Unix())},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "token sin auth_time",
+			claims:     map[string]interface{}{"iat": float64(now.Unix())},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "auth_time con tipo incorrecto",
+			claims:     map[string]interface{}{"auth_time": "ayer"},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewOAuthMiddleware(&fakeOAuthUseCase{claims: tt.claims})
+			m.now = func() time.Time { return now }
+
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.POST("/change-password", m.Protected(), m.RequireRecentAuth(5*time.Minute), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req, _ := http.NewRequest("POST", "/change-password", nil)
+			req.Header.Set("Authorization", "Bearer token")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusUnauthorized {
+				challenge := w.Header().Get("WWW-Authenticate")
+				assert.Contains(t, challenge, `error="insufficient_user_authentication"`)
+				assert.Contains(t, challenge, "max_age=300")
+			} else {
+				assert.Empty(t, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
@@ -1,22 +1,231 @@
 package middleware
 
 import (
+	"log"
 	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/black4ninja/mi-proyecto/internal/permission/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
 )
 
+// DenialLogLevel controla el detalle con el que se registran los permisos denegados
+type DenialLogLevel int
+
+const (
+	DenialLogOff     DenialLogLevel = iota // No se registran denegaciones
+	DenialLogSummary                       // Usuario, permiso requerido, ruta y fecha
+	DenialLogVerbose                       // Además método, IP del cliente y error de verificación
+)
+
+// ParseDenialLogLevel convierte "off", "summary" o "verbose" en un DenialLogLevel.
+// Un valor desconocido retorna DenialLogSummary.
+func ParseDenialLogLevel(value string) DenialLogLevel {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "off", "none", "false":
+		return DenialLogOff
+	case "verbose", "debug":
+		return DenialLogVerbose
+	default:
+		return DenialLogSummary
+	}
+}
+
+// AuthorizationDenial describe un intento de acceso rechazado por falta de permisos
+type AuthorizationDenial struct {
+	UserID     string
+	Permission string
+	Method     string
+	Route      string
+	ClientIP   string
+	Timestamp  time.Time
+	Err        error // Error al verificar el permiso, si lo hubo
+}
+
+// DenialListener recibe cada denegación (ej. para enviarla a un sistema de monitoreo)
+type DenialListener func(denial AuthorizationDenial)
+
 // PermissionMiddleware es un middleware para verificar permisos
 type PermissionMiddleware struct {
 	userRoleUseCase domain.UserRoleUseCase
+	denialLogLevel  DenialLogLevel
+	logger          *log.Logger
+	listeners       []DenialListener
+	accessPolicy    *utils.AccessPolicy
+	warnedRoutes    sync.Map // Rutas ya advertidas por una cadena de middlewares mal configurada
 }
 
-// NewPermissionMiddleware crea un nuevo middleware de permisos
+// adminNotFoundMessage es el mensaje de las APIs administrativas denegadas en modo 404
+const adminNotFoundMessage = "Recurso no encontrado"
+
+// NewPermissionMiddleware crea un nuevo middleware de permisos.
+// Por defecto registra las denegaciones en modo resumen con el logger estándar
+// y responde según utils.NewAccessPolicy.
 func NewPermissionMiddleware(userRoleUseCase domain.UserRoleUseCase) *PermissionMiddleware {
 	return &PermissionMiddleware{
 		userRoleUseCase: userRoleUseCase,
+		denialLogLevel:  DenialLogSummary,
+		logger:          log.Default(),
+		accessPolicy:    utils.NewAccessPolicy(),
+	}
+}
+
+// SetAccessPolicy configura si las denegaciones responden 403 o 404 por tipo de recurso.
+// Si policy es nil se mantiene la actual.
+func (m *PermissionMiddleware) SetAccessPolicy(policy *utils.AccessPolicy) {
+	if policy != nil {
+		m.accessPolicy = policy
+	}
+}
+
+// SetDenialLogging configura el nivel de detalle y el logger de las denegaciones.
+// Si logger es nil se mantiene el actual.
+func (m *PermissionMiddleware) SetDenialLogging(level DenialLogLevel, logger *log.Logger) {
+	m.denialLogLevel = level
+	if logger != nil {
+		m.logger = logger
+	}
+}
+
+// OnDenial registra un listener que se invoca en cada denegación,
+// independientemente del nivel de log configurado
+func (m *PermissionMiddleware) OnDenial(listener DenialListener) {
+	m.listeners = append(m.listeners, listener)
+}
+
+// reportDenial registra la denegación y notifica a los listeners
+func (m *PermissionMiddleware) reportDenial(c *gin.Context, userID, permission string, err error) {
+	denial := AuthorizationDenial{
+		UserID:     userID,
+		Permission: permission,
+		Method:     c.Request.Method,
+		Route:      c.FullPath(),
+		ClientIP:   c.ClientIP(),
+		Timestamp:  time.Now().UTC(),
+		Err:        err,
+	}
+	if denial.Route == "" {
+		denial.Route = c.Request.URL.Path
+	}
+
+	switch m.denialLogLevel {
+	case DenialLogSummary:
+		m.logger.Printf("[WARN] permiso denegado user=%s permission=%s route=%s time=%s",
+			denial.UserID, denial.Permission, denial.Route, denial.Timestamp.Format(time.RFC3339))
+	case DenialLogVerbose:
+		m.logger.Printf("[WARN] permiso denegado user=%s permission=%s method=%s route=%s ip=%s time=%s error=%v",
+			denial.UserID, denial.Permission, denial.Method, denial.Route, denial.ClientIP,
+			denial.Timestamp.Format(time.RFC3339), denial.Err)
+	}
+
+	for _, listener := range m.listeners {
+		listener(denial)
+	}
+}
+
+// authenticatedUser obtiene el ID de usuario establecido por el middleware de autenticación.
+// Si no hay usuario responde y aborta la petición: 401 si la autenticación se ejecutó sin
+// identificar al usuario, o 500 si el middleware de autenticación nunca se ejecutó en la ruta.
+func (m *PermissionMiddleware) authenticatedUser(c *gin.Context) (string, bool) {
+	if userID, ok := utils.MustUserID(c); ok {
+		return userID, true
+	}
+
+	if _, authenticated := c.Get(AuthenticatedContextKey); authenticated {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "No autenticado")
+		c.Abort()
+		return "", false
+	}
+
+	// Cadena mal configurada: se advierte una sola vez por ruta para no saturar el log
+	route := c.FullPath()
+	if route == "" {
+		route = c.Request.URL.Path
+	}
+	if _, warned := m.warnedRoutes.LoadOrStore(route, true); !warned {
+		m.logger.Printf("[WARN] middleware de permisos sin autenticación previa en route=%s: "+
+			"registre OAuthMiddleware.Protected() antes de PermissionMiddleware en la ruta o grupo", route)
+	}
+
+	utils.ErrorResponse(c, http.StatusInternalServerError, "Error de configuración de autorización")
+	c.Abort()
+	return "", false
+}
+
+// hasPermission verifica un permiso del usuario autenticado. Las peticiones autenticadas con
+// API key no tienen roles: se verifican contra los permisos asignados a la clave, con la misma
+// semántica de comodines (utils.PermissionMatches) que el caso de uso de roles.
+func (m *PermissionMiddleware) hasPermission(c *gin.Context, userID, permissionCode string) (bool, error) {
+	if _, viaAPIKey := c.Get(utils.APIKeyIDContextKey); !viaAPIKey {
+		return m.userRoleUseCase.HasPermission(userID, permissionCode)
+	}
+
+	value, _ := c.Get("permissions")
+	granted, _ := value.([]string)
+	for _, p := range granted {
+		if utils.PermissionMatches(p, permissionCode) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// grantPermission agrega permissionCode a los permisos concedidos de la petición
+// (utils.GrantedPermissionsContextKey)
+func grantPermission(c *gin.Context, permissionCode string) {
+	value, _ := c.Get(utils.GrantedPermissionsContextKey)
+	granted, _ := value.([]string)
+	c.Set(utils.GrantedPermissionsContextKey, append(slices.Clip(granted), permissionCode))
+}
+
+// hasModuleAccess verifica que el usuario autenticado tenga algún permiso del módulo
+// ("module:..."). Con API key se revisan los permisos asignados a la clave.
+func (m *PermissionMiddleware) hasModuleAccess(c *gin.Context, userID, module string) (bool, error) {
+	if _, viaAPIKey := c.Get(utils.APIKeyIDContextKey); !viaAPIKey {
+		return m.userRoleUseCase.HasModuleAccess(userID, module)
+	}
+
+	value, _ := c.Get("permissions")
+	granted, _ := value.([]string)
+	return utils.GrantsModuleAccess(granted, module), nil
+}
+
+// ResolveAdminScope guarda en el contexto (domain.AdminScopeContextKey) el ámbito de
+// administración delegada del usuario, que los manejadores de permisos pasan a los casos de
+// uso. Con API key el ámbito se obtiene de los permisos de la clave. Sin este middleware las
+// operaciones de gestión no tienen restricción de módulos.
+func (m *PermissionMiddleware) ResolveAdminScope() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := m.authenticatedUser(c)
+		if !ok {
+			return
+		}
+
+		var scope *domain.AdminScope
+		if _, viaAPIKey := c.Get(utils.APIKeyIDContextKey); viaAPIKey {
+			value, _ := c.Get("permissions")
+			granted, _ := value.([]string)
+			scope = domain.NewAdminScope(granted)
+		} else {
+			var err error
+			scope, err = m.userRoleUseCase.GetAdminScope(userID)
+			if err != nil {
+				m.logger.Printf("[ERROR] no se pudo obtener el ámbito de administración user=%s error=%v", userID, err)
+				utils.InternalErrorResponse(c)
+				c.Abort()
+				return
+			}
+		}
+
+		if scope != nil {
+			c.Set(domain.AdminScopeContextKey, scope)
+		}
+		c.Next()
 	}
 }
 
@@ -24,27 +233,21 @@ func NewPermissionMiddleware(userRoleUseCase domain.UserRoleUseCase) *Permission
 func (m *PermissionMiddleware) RequirePermission(permissionCode string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Obtener el ID de usuario del contexto (establecido por el middleware de autenticación)
-		userID, exists := c.Get("userID")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"status": "error",
-				"error":  "No autenticado",
-			})
-			c.Abort()
+		userID, ok := m.authenticatedUser(c)
+		if !ok {
 			return
 		}
 
 		// Verificar permiso
-		hasPermission, err := m.userRoleUseCase.HasPermission(userID.(string), permissionCode)
+		hasPermission, err := m.hasPermission(c, userID, permissionCode)
 		if err != nil || !hasPermission {
-			c.JSON(http.StatusForbidden, gin.H{
-				"status": "error",
-				"error":  "Permiso denegado: se requiere " + permissionCode,
-			})
+			m.reportDenial(c, userID, permissionCode, err)
+			m.accessPolicy.DeniedResponse(c, utils.ResourceAdmin, "Permiso denegado: se requiere "+permissionCode, adminNotFoundMessage)
 			c.Abort()
 			return
 		}
 
+		grantPermission(c, permissionCode)
 		c.Next()
 	}
 }
@@ -53,30 +256,24 @@ func (m *PermissionMiddleware) RequirePermission(permissionCode string) gin.Hand
 func (m *PermissionMiddleware) RequireAnyPermission(permissionCodes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Obtener el ID de usuario del contexto (establecido por el middleware de autenticación)
-		userID, exists := c.Get("userID")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"status": "error",
-				"error":  "No autenticado",
-			})
-			c.Abort()
+		userID, ok := m.authenticatedUser(c)
+		if !ok {
 			return
 		}
 
 		// Verificar si tiene al menos uno de los permisos
 		for _, permissionCode := range permissionCodes {
-			hasPermission, err := m.userRoleUseCase.HasPermission(userID.(string), permissionCode)
+			hasPermission, err := m.hasPermission(c, userID, permissionCode)
 			if err == nil && hasPermission {
+				grantPermission(c, permissionCode)
 				c.Next()
 				return
 			}
 		}
 
 		// Si no tiene ninguno de los permisos
-		c.JSON(http.StatusForbidden, gin.H{
-			"status": "error",
-			"error":  "Permiso denegado: se requiere al menos uno de los permisos especificados",
-		})
+		m.reportDenial(c, userID, strings.Join(permissionCodes, "|"), nil)
+		m.accessPolicy.DeniedResponse(c, utils.ResourceAdmin, "Permiso denegado: se requiere al menos uno de los permisos especificados", adminNotFoundMessage)
 		c.Abort()
 	}
 }
@@ -85,59 +282,83 @@ func (m *PermissionMiddleware) RequireAnyPermission(permissionCodes ...string) g
 func (m *PermissionMiddleware) RequireAllPermissions(permissionCodes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Obtener el ID de usuario del contexto (establecido por el middleware de autenticación)
-		userID, exists := c.Get("userID")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"status": "error",
-				"error":  "No autenticado",
-			})
-			c.Abort()
+		userID, ok := m.authenticatedUser(c)
+		if !ok {
 			return
 		}
 
 		// Verificar que tenga todos los permisos
 		for _, permissionCode := range permissionCodes {
-			hasPermission, err := m.userRoleUseCase.HasPermission(userID.(string), permissionCode)
+			hasPermission, err := m.hasPermission(c, userID, permissionCode)
 			if err != nil || !hasPermission {
-				c.JSON(http.StatusForbidden, gin.H{
-					"status": "error",
-					"error":  "Permiso denegado: se requieren todos los permisos especificados",
-				})
+				m.reportDenial(c, userID, permissionCode, err)
+				m.accessPolicy.DeniedResponse(c, utils.ResourceAdmin, "Permiso denegado: se requieren todos los permisos especificados", adminNotFoundMessage)
 				c.Abort()
 				return
 			}
 		}
 
+		for _, permissionCode := range permissionCodes {
+			grantPermission(c, permissionCode)
+		}
 		c.Next()
 	}
 }
 
-// RequireModuleAccess verifica que el usuario tenga acceso a un módulo completo
+// RequireModuleAccess verifica que el usuario tenga acceso a un módulo: basta con cualquier
+// permiso del módulo, concreto ("finanzas:read") o comodín ("finanzas:*")
 func (m *PermissionMiddleware) RequireModuleAccess(module string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Obtener el ID de usuario del contexto (establecido por el middleware de autenticación)
-		userID, exists := c.Get("userID")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"status": "error",
-				"error":  "No autenticado",
-			})
-			c.Abort()
+		userID, ok := m.authenticatedUser(c)
+		if !ok {
 			return
 		}
 
 		// Verificar acceso al módulo (permisos que comienzan con "module:")
 		moduleWildcard := module + ":*"
-		hasPermission, err := m.userRoleUseCase.HasPermission(userID.(string), moduleWildcard)
+		hasPermission, err := m.hasModuleAccess(c, userID, module)
+		if err != nil || !hasPermission {
+			m.reportDenial(c, userID, moduleWildcard, err)
+			m.accessPolicy.DeniedResponse(c, utils.ResourceAdmin, "Permiso denegado: se requiere acceso al módulo "+module, adminNotFoundMessage)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireSelfOrPermission permite el acceso cuando el parámetro de ruta param coincide con el
+// usuario autenticado (recurso propio) o cuando el usuario tiene permissionCode. Si no, responde
+// según la política de utils.ResourceUser: 403, o 404 con notFoundMessage para no revelar que el
+// recurso existe; notFoundMessage debe ser el mismo que responde el handler si no existe.
+// Si el usuario tiene permissionCode lo registra con utils.GrantedPermissionsContextKey también en
+// el recurso propio, para que el handler distinga al administrador del propio usuario.
+func (m *PermissionMiddleware) RequireSelfOrPermission(param, permissionCode, notFoundMessage string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := m.authenticatedUser(c)
+		if !ok {
+			return
+		}
+
+		hasPermission, err := m.hasPermission(c, userID, permissionCode)
+		if c.Param(param) == userID {
+			if err == nil && hasPermission {
+				grantPermission(c, permissionCode)
+			}
+			c.Next()
+			return
+		}
+
 		if err != nil || !hasPermission {
-			c.JSON(http.StatusForbidden, gin.H{
-				"status": "error",
-				"error":  "Permiso denegado: se requiere acceso al módulo " + module,
-			})
+			m.reportDenial(c, userID, permissionCode, err)
+			m.accessPolicy.DeniedResponse(c, utils.ResourceUser, "Permiso denegado: se requiere "+permissionCode, notFoundMessage)
 			c.Abort()
 			return
 		}
 
+		grantPermission(c, permissionCode)
 		c.Next()
 	}
 }
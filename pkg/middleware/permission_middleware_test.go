@@ -0,0 +1,418 @@
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/black4ninja/mi-proyecto/internal/permission/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// fakeUserRoleUseCase concede solo los permisos configurados;
+// el resto de métodos entra en pánico a través de la interfaz embebida
+type fakeUserRoleUseCase struct {
+	domain.UserRoleUseCase
+	granted map[string]bool
+}
+
+func (f *fakeUserRoleUseCase) HasPermission(userID string, permissionCode string) (bool, error) {
+	return f.granted[permissionCode], nil
+}
+
+func (f *fakeUserRoleUseCase) HasModuleAccess(userID string, module string) (bool, error) {
+	for code, ok := range f.granted {
+		if ok && strings.HasPrefix(code, module+":") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeUserRoleUseCase) GetAdminScope(userID string) (*domain.AdminScope, error) {
+	var permissions []string
+	for code, ok := range f.granted {
+		if ok {
+			permissions = append(permissions, code)
+		}
+	}
+	return domain.NewAdminScope(permissions), nil
+}
+
+// setupPermissionRouter registra una ruta protegida con un usuario autenticado simulado
+func setupPermissionRouter(m *PermissionMiddleware, permission string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/users/:id", func(c *gin.Context) {
+		c.Set("userID", "usuario-123")
+		c.Next()
+	}, m.RequirePermission(permission), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return r
+}
+
+func TestRequirePermissionReportsDenial(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewPermissionMiddleware(&fakeUserRoleUseCase{granted: map[string]bool{}})
+	m.SetDenialLogging(DenialLogSummary, log.New(&buf, "", 0))
+
+	var denials []AuthorizationDenial
+	m.OnDenial(func(denial AuthorizationDenial) {
+		denials = append(denials, denial)
+	})
+
+	r := setupPermissionRouter(m, "admin:users")
+	req, _ := http.NewRequest("GET", "/api/users/42", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, buf.String(), "[WARN]")
+	assert.Contains(t, buf.String(), "user=usuario-123")
+	assert.Contains(t, buf.String(), "permission=admin:users")
+	assert.Contains(t, buf.String(), "route=/api/users/:id")
+
+	require.Len(t, denials, 1)
+	assert.Equal(t, "usuario-123", denials[0].UserID)
+	assert.Equal(t, "admin:users", denials[0].Permission)
+	assert.Equal(t, "/api/users/:id", denials[0].Route)
+	assert.False(t, denials[0].Timestamp.IsZero())
+}
+
+func TestRequirePermissionDenialLogLevels(t *testing.T) {
+	t.Run("off no registra pero notifica", func(t *testing.T) {
+		var buf bytes.Buffer
+		m := NewPermissionMiddleware(&fakeUserRoleUseCase{granted: map[string]bool{}})
+		m.SetDenialLogging(DenialLogOff, log.New(&buf, "", 0))
+		notified := 0
+		m.OnDenial(func(AuthorizationDenial) { notified++ })
+
+		req, _ := http.NewRequest("GET", "/api/users/42", nil)
+		setupPermissionRouter(m, "admin:users").ServeHTTP(httptest.NewRecorder(), req)
+
+		assert.Empty(t, buf.String())
+		assert.Equal(t, 1, notified)
+	})
+
+	t.Run("verbose incluye método e IP", func(t *testing.T) {
+		var buf bytes.Buffer
+		m := NewPermissionMiddleware(&fakeUserRoleUseCase{granted: map[string]bool{}})
+		m.SetDenialLogging(DenialLogVerbose, log.New(&buf, "", 0))
+
+		req, _ := http.NewRequest("GET", "/api/users/42", nil)
+		setupPermissionRouter(m, "admin:users").ServeHTTP(httptest.NewRecorder(), req)
+
+		assert.Contains(t, buf.String(), "method=GET")
+		assert.Contains(t, buf.String(), "ip=")
+	})
+
+	t.Run("acceso permitido no registra", func(t *testing.T) {
+		var buf bytes.Buffer
+		m := NewPermissionMiddleware(&fakeUserRoleUseCase{granted: map[string]bool{"admin:users": true}})
+		m.SetDenialLogging(DenialLogVerbose, log.New(&buf, "", 0))
+
+		req, _ := http.NewRequest("GET", "/api/users/42", nil)
+		w := httptest.NewRecorder()
+		setupPermissionRouter(m, "admin:users").ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, buf.String())
+	})
+}
+
+func TestParseDenialLogLevel(t *testing.T) {
+	assert.Equal(t, DenialLogOff, ParseDenialLogLevel("off"))
+	assert.Equal(t, DenialLogVerbose, ParseDenialLogLevel("VERBOSE"))
+	assert.Equal(t, DenialLogSummary, ParseDenialLogLevel("summary"))
+	assert.Equal(t, DenialLogSummary, ParseDenialLogLevel("desconocido"))
+}
+
+func TestRequirePermissionWithoutAuthMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewPermissionMiddleware(&fakeUserRoleUseCase{granted: map[string]bool{"admin:users": true}})
+	m.SetDenialLogging(DenialLogSummary, log.New(&buf, "", 0))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	// Ruta mal configurada: no se registró el middleware de autenticación
+	r.GET("/api/users/:id", m.RequirePermission("admin:users"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", "/api/users/42", nil)
+		req.Header.Set("Authorization", "Bearer token-valido")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.NotContains(t, w.Body.String(), "No autenticado")
+	}
+
+	assert.Contains(t, buf.String(), "OAuthMiddleware.Protected()")
+	assert.Contains(t, buf.String(), "route=/api/users/:id")
+	assert.Equal(t, 1, strings.Count(buf.String(), "[WARN]"), "la advertencia se registra una sola vez por ruta")
+}
+
+func TestRequirePermissionAuthenticatedWithoutUser(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewPermissionMiddleware(&fakeUserRoleUseCase{granted: map[string]bool{}})
+	m.SetDenialLogging(DenialLogSummary, log.New(&buf, "", 0))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/users/:id", func(c *gin.Context) {
+		// El middleware de autenticación se ejecutó pero no identificó al usuario
+		c.Set(AuthenticatedContextKey, true)
+		c.Next()
+	}, m.RequirePermission("admin:users"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest("GET", "/api/users/42", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "No autenticado")
+	assert.Empty(t, buf.String())
+}
+
+func TestRequireSelfOrPermissionRecordsGrant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name        string
+		granted     map[string]bool
+		path        string
+		wantGranted bool
+	}{
+		{"propio usuario sin permiso", nil, "/api/users/usuario-123", false},
+		{"propio usuario administrador", map[string]bool{"admin:users": true}, "/api/users/usuario-123", true},
+		{"otro usuario con permiso", map[string]bool{"admin:users": true}, "/api/users/otro", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewPermissionMiddleware(&fakeUserRoleUseCase{granted: tt.granted})
+			var granted bool
+			r := gin.New()
+			r.GET("/api/users/:id", func(c *gin.Context) {
+				c.Set("userID", "usuario-123")
+			}, m.RequireSelfOrPermission("id", "admin:users", "usuario no encontrado"), func(c *gin.Context) {
+				granted = utils.HasGrantedPermission(c, "admin:users")
+				c.Status(http.StatusOK)
+			})
+
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.wantGranted, granted)
+		})
+	}
+}
+
+func TestRequireAnyAndAllPermissionsRecordGrants(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := NewPermissionMiddleware(&fakeUserRoleUseCase{granted: map[string]bool{"admin:users": true, "users:export": true}})
+	tests := []struct {
+		name        string
+		middleware  gin.HandlerFunc
+		wantGranted map[string]bool
+	}{
+		{"any registra el permiso que coincidió", m.RequireAnyPermission("admin:roles", "admin:users", "users:export"),
+			map[string]bool{"admin:roles": false, "admin:users": true, "users:export": false}},
+		{"all registra todos los permisos", m.RequireAllPermissions("admin:users", "users:export"),
+			map[string]bool{"admin:users": true, "users:export": true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			granted := map[string]bool{}
+			r := gin.New()
+			r.GET("/api/users", func(c *gin.Context) {
+				c.Set("userID", "usuario-123")
+			}, tt.middleware, func(c *gin.Context) {
+				for code := range tt.wantGranted {
+					granted[code] = utils.HasGrantedPermission(c, code)
+				}
+				c.Status(http.StatusOK)
+			})
+
+			req, _ := http.NewRequest("GET", "/api/users", nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.wantGranted, granted)
+		})
+	}
+}
+
+func TestAccessDenialPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newRouter := func(m *PermissionMiddleware) *gin.Engine {
+		r := gin.New()
+		authenticated := func(c *gin.Context) {
+			c.Set("userID", "usuario-123")
+			c.Next()
+		}
+		ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+		r.GET("/api/users/:id", authenticated, m.RequireSelfOrPermission("id", "admin:users", "usuario no encontrado"), ok)
+		r.GET("/api/audit", authenticated, m.RequirePermission("admin:audit"), ok)
+		return r
+	}
+
+	tests := []struct {
+		name       string
+		modes      map[utils.ResourceType]utils.AccessDenialMode // Cambios sobre la política por defecto
+		granted    map[string]bool
+		path       string
+		wantStatus int
+		wantError  string
+	}{
+		{name: "el propio usuario accede", path: "/api/users/usuario-123", wantStatus: http.StatusOK},
+		{name: "otro usuario con permiso", granted: map[string]bool{"admin:users": true}, path: "/api/users/otro", wantStatus: http.StatusOK},
+		{name: "por defecto un usuario ajeno se oculta", path: "/api/users/otro", wantStatus: http.StatusNotFound, wantError: "usuario no encontrado"},
+		{name: "usuario ajeno en modo 403", modes: map[utils.ResourceType]utils.AccessDenialMode{utils.ResourceUser: utils.AccessDenialForbidden}, path: "/api/users/otro", wantStatus: http.StatusForbidden, wantError: "Permiso denegado: se requiere admin:users"},
+		{name: "por defecto la API administrativa responde 403", path: "/api/audit", wantStatus: http.StatusForbidden, wantError: "Permiso denegado: se requiere admin:audit"},
+		{name: "API administrativa en modo 404", modes: map[utils.ResourceType]utils.AccessDenialMode{utils.ResourceAdmin: utils.AccessDenialNotFound}, path: "/api/audit", wantStatus: http.StatusNotFound, wantError: adminNotFoundMessage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewPermissionMiddleware(&fakeUserRoleUseCase{granted: tt.granted})
+			m.SetDenialLogging(DenialLogOff, nil)
+			policy := utils.NewAccessPolicy()
+			for resource, mode := range tt.modes {
+				policy.Set(resource, mode)
+			}
+			m.SetAccessPolicy(policy)
+
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+			newRouter(m).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantError != "" {
+				assert.Contains(t, w.Body.String(), tt.wantError)
+			}
+		})
+	}
+}
+
+func TestRequireModuleAccess(t *testing.T) {
+	newRouter := func(m *PermissionMiddleware, auth gin.HandlerFunc) *gin.Engine {
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		r.GET("/api/finanzas/reportes", auth, m.RequireModuleAccess("finanzas"), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		return r
+	}
+	serve := func(r *gin.Engine) int {
+		req, _ := http.NewRequest("GET", "/api/finanzas/reportes", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	asUser := func(c *gin.Context) {
+		c.Set(utils.UserIDContextKey, "usuario-123")
+		c.Next()
+	}
+
+	tests := []struct {
+		name    string
+		granted map[string]bool
+		want    int
+	}{
+		{"permiso concreto del módulo", map[string]bool{"finanzas:read": true}, http.StatusOK},
+		{"comodín del módulo", map[string]bool{"finanzas:*": true}, http.StatusOK},
+		{"permisos de otro módulo", map[string]bool{"inventario:read": true}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewPermissionMiddleware(&fakeUserRoleUseCase{granted: tt.granted})
+			assert.Equal(t, tt.want, serve(newRouter(m, asUser)))
+		})
+	}
+
+	t.Run("API key con un permiso del módulo", func(t *testing.T) {
+		m := NewPermissionMiddleware(&fakeUserRoleUseCase{})
+		r := newRouter(m, func(c *gin.Context) {
+			c.Set(utils.UserIDContextKey, APIKeyUserIDPrefix+"clave-1")
+			c.Set(utils.APIKeyIDContextKey, "clave-1")
+			c.Set("permissions", []string{"finanzas:read"})
+			c.Next()
+		})
+		assert.Equal(t, http.StatusOK, serve(r))
+	})
+}
+
+func TestResolveAdminScope(t *testing.T) {
+	newRouter := func(m *PermissionMiddleware, auth gin.HandlerFunc) (*gin.Engine, **domain.AdminScope) {
+		gin.SetMode(gin.TestMode)
+		var resolved *domain.AdminScope
+		r := gin.New()
+		r.POST("/api/permissions", auth, m.ResolveAdminScope(), func(c *gin.Context) {
+			value, _ := c.Get(domain.AdminScopeContextKey)
+			resolved, _ = value.(*domain.AdminScope)
+			c.Status(http.StatusOK)
+		})
+		return r, &resolved
+	}
+	serve := func(r *gin.Engine) int {
+		req, _ := http.NewRequest("POST", "/api/permissions", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	asUser := func(c *gin.Context) {
+		c.Set(utils.UserIDContextKey, "usuario-123")
+		c.Next()
+	}
+
+	t.Run("administrador delegado", func(t *testing.T) {
+		m := NewPermissionMiddleware(&fakeUserRoleUseCase{granted: map[string]bool{
+			"admin:permissions":                  true,
+			domain.AdminScopePrefix + "finanzas": true,
+		}})
+		r, resolved := newRouter(m, asUser)
+
+		require.Equal(t, http.StatusOK, serve(r))
+		require.NotNil(t, *resolved)
+		assert.True(t, (*resolved).AllowsModule("finanzas"))
+		assert.False(t, (*resolved).AllowsModule("users"))
+	})
+
+	t.Run("administrador sin restricción", func(t *testing.T) {
+		m := NewPermissionMiddleware(&fakeUserRoleUseCase{granted: map[string]bool{"admin:permissions": true}})
+		r, resolved := newRouter(m, asUser)
+
+		require.Equal(t, http.StatusOK, serve(r))
+		assert.Nil(t, *resolved)
+	})
+
+	t.Run("API key con ámbito", func(t *testing.T) {
+		m := NewPermissionMiddleware(&fakeUserRoleUseCase{})
+		r, resolved := newRouter(m, func(c *gin.Context) {
+			c.Set(utils.UserIDContextKey, APIKeyUserIDPrefix+"clave-1")
+			c.Set(utils.APIKeyIDContextKey, "clave-1")
+			c.Set("permissions", []string{"admin:permissions", domain.AdminScopePrefix + "inventario"})
+			c.Next()
+		})
+
+		require.Equal(t, http.StatusOK, serve(r))
+		require.NotNil(t, *resolved)
+		assert.True(t, (*resolved).AllowsModule("inventario"))
+	})
+}
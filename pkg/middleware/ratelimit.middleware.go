@@ -0,0 +1,303 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// RateLimitRule define cuántas solicitudes se permiten por ventana de tiempo
+type RateLimitRule struct {
+	Requests int
+	Window   time.Duration
+}
+
+// rate retorna las solicitudes permitidas por segundo (para comparar reglas).
+// Una regla sin solicitudes o sin ventana se considera ilimitada.
+func (r RateLimitRule) rate() float64 {
+	if r.Requests <= 0 || r.Window <= 0 {
+		return math.Inf(1)
+	}
+	return float64(r.Requests) / r.Window.Seconds()
+}
+
+// RateLimitResult representa el estado del bucket tras consumir una solicitud
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration // Tiempo hasta poder realizar otra solicitud (si fue rechazada)
+	ResetAfter time.Duration // Tiempo hasta que el bucket vuelva a estar lleno
+}
+
+// RateLimitStore define el contrato para el almacenamiento de los contadores de rate limit.
+// La implementación por defecto es en memoria; puede sustituirse (ej. Redis) sin cambiar el middleware.
+type RateLimitStore interface {
+	Take(key string, rule RateLimitRule) RateLimitResult
+}
+
+// tokenBucket representa el estado de un bucket individual
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+	fullAt   time.Time // Momento en que vuelve a estar lleno si no recibe solicitudes
+}
+
+// memoryStoreSweepInterval es cada cuánto se descartan los buckets que ya se rellenaron
+const memoryStoreSweepInterval = time.Minute
+
+// MemoryRateLimitStore implementa RateLimitStore con token buckets en memoria. Los buckets
+// llenos se descartan periódicamente: equivalen a uno nuevo, y con claves por IP el mapa
+// crecería sin límite.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryRateLimitStore crea un nuevo almacenamiento de rate limit en memoria
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// Take consume una solicitud del bucket identificado por key
+func (s *MemoryRateLimitStore) Take(key string, rule RateLimitRule) RateLimitResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+	capacity := float64(rule.Requests)
+	refillPerSecond := rule.rate()
+
+	bucket, exists := s.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{tokens: capacity, lastSeen: now}
+		s.buckets[key] = bucket
+	}
+
+	// Rellenar el bucket según el tiempo transcurrido
+	elapsed := now.Sub(bucket.lastSeen).Seconds()
+	bucket.tokens = math.Min(capacity, bucket.tokens+elapsed*refillPerSecond)
+	bucket.lastSeen = now
+
+	result := RateLimitResult{Limit: rule.Requests}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - bucket.tokens) / refillPerSecond)
+	}
+
+	result.Remaining = int(math.Floor(bucket.tokens))
+	result.ResetAfter = secondsToDuration((capacity - bucket.tokens) / refillPerSecond)
+	bucket.fullAt = now.Add(result.ResetAfter)
+
+	return result
+}
+
+// sweep descarta los buckets ya rellenados, como máximo una vez por memoryStoreSweepInterval
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < memoryStoreSweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, bucket := range s.buckets {
+		if !now.Before(bucket.fullAt) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// secondsToDuration convierte segundos fraccionarios a time.Duration
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// RateLimiter es un middleware para limitar la tasa de solicitudes
+type RateLimiter struct {
+	store       RateLimitStore
+	sendHeaders bool
+}
+
+// NewRateLimiter crea un nuevo middleware de rate limit con el almacenamiento indicado
+func NewRateLimiter(store RateLimitStore) *RateLimiter {
+	if store == nil {
+		store = NewMemoryRateLimitStore()
+	}
+	return &RateLimiter{
+		store: store,
+	}
+}
+
+// SetHeaders activa los headers X-RateLimit-Limit, X-RateLimit-Remaining y X-RateLimit-Reset
+// en las respuestas limitadas, para que los clientes puedan regular su ritmo de solicitudes.
+// Retry-After se envía siempre en las respuestas 429.
+func (m *RateLimiter) SetHeaders(enabled bool) {
+	m.sendHeaders = enabled
+}
+
+// Limit limita las solicitudes por usuario autenticado o, si no hay sesión, por IP del cliente.
+// Identifica al usuario con utils.UserIDContextKey, por lo que en las rutas protegidas debe
+// registrarse después del middleware de autenticación. name separa los contadores de cada
+// grupo de rutas; una regla sin solicitudes no limita.
+func (m *RateLimiter) Limit(name string, rule RateLimitRule) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rule.Requests <= 0 {
+			c.Next()
+			return
+		}
+
+		result := m.store.Take(name+":"+rateLimitSubject(c), rule)
+		if m.sendHeaders {
+			setRateLimitHeaders(c, result)
+		}
+		if !result.Allowed {
+			rejectRateLimited(c, result)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// rateLimitSubject identifica a quien realiza la solicitud: "user:<id>" o "ip:<ip>".
+// La IP se obtiene con c.ClientIP, que solo considera X-Forwarded-For de los proxies de confianza.
+func rateLimitSubject(c *gin.Context) string {
+	if userID := c.GetString(utils.UserIDContextKey); userID != "" {
+		return "user:" + userID
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// TokenRateLimitConfig define los límites del endpoint de tokens.
+// Default se aplica a cualquier solicitud; Scopes define límites más estrictos
+// para scopes privilegiados (ej. "admin").
+type TokenRateLimitConfig struct {
+	Default RateLimitRule
+	Scopes  map[string]RateLimitRule
+}
+
+// maxTokenRequestBytes limita el cuerpo que LimitTokenByScope lee antes del handler
+const maxTokenRequestBytes = 64 << 10
+
+// LimitTokenByScope limita las solicitudes al endpoint de tokens por cliente, IP y scope
+// solicitado, de modo que quien envía un client_id ajeno desde otra IP no agota el límite del
+// cliente legítimo. Si se solicitan varios scopes con límite propio, se aplica el más estricto.
+// Un cuerpo de más de maxTokenRequestBytes se rechaza con 413.
+func (m *RateLimiter) LimitTokenByScope(config TokenRateLimitConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientID, scope, err := peekTokenRequest(c)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, "La solicitud es demasiado grande")
+			c.Abort()
+			return
+		}
+
+		rule := config.Default
+		bucket := "default"
+		for _, s := range strings.Fields(scope) {
+			scopeRule, exists := config.Scopes[s]
+			if exists && scopeRule.rate() < rule.rate() {
+				rule = scopeRule
+				bucket = "scope:" + s
+			}
+		}
+
+		if rule.Requests <= 0 {
+			c.Next()
+			return
+		}
+
+		result := m.store.Take("token:"+clientID+":"+c.ClientIP()+":"+bucket, rule)
+		if m.sendHeaders {
+			setRateLimitHeaders(c, result)
+		}
+		if !result.Allowed {
+			rejectRateLimited(c, result)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// setRateLimitHeaders informa el estado del bucket. X-RateLimit-Reset son los segundos
+// hasta que el bucket vuelva a estar lleno.
+func setRateLimitHeaders(c *gin.Context, result RateLimitResult) {
+	c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.ResetAfter.Seconds()))))
+}
+
+// rejectRateLimited responde 429 con el header Retry-After
+func rejectRateLimited(c *gin.Context, result RateLimitResult) {
+	retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	utils.ErrorResponse(c, http.StatusTooManyRequests, "Demasiadas solicitudes, intente de nuevo más tarde")
+	c.Abort()
+}
+
+// peekTokenRequest lee client_id y scope del cuerpo sin consumirlo para el handler.
+// Soporta cuerpos JSON y application/x-www-form-urlencoded; si el cliente se autentica
+// con HTTP Basic, el client_id del encabezado tiene prioridad. Solo retorna error si no pudo
+// leerse el cuerpo (ej. *http.MaxBytesError).
+func peekTokenRequest(c *gin.Context) (string, string, error) {
+	clientID, scope, err := peekTokenBody(c)
+	if err != nil {
+		return "", "", err
+	}
+	if basicID, _, ok := utils.ClientBasicAuth(c.Request); ok {
+		clientID = basicID
+	}
+	return clientID, scope, nil
+}
+
+// peekTokenBody lee client_id y scope del cuerpo, de hasta maxTokenRequestBytes, y lo restaura
+// para el handler
+func peekTokenBody(c *gin.Context) (string, string, error) {
+	if c.Request.Body == nil {
+		return "", "", nil
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxTokenRequestBytes))
+	if err != nil {
+		return "", "", err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	if strings.HasPrefix(c.ContentType(), "application/x-www-form-urlencoded") {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return "", "", nil
+		}
+		return values.Get("client_id"), values.Get("scope"), nil
+	}
+
+	var payload struct {
+		ClientID string `json:"client_id"`
+		Scope    string `json:"scope"`
+	}
+	_ = json.Unmarshal(body, &payload)
+	return payload.ClientID, payload.Scope, nil
+}
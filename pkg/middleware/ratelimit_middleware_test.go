@@ -0,0 +1,284 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// setupTokenRouter registra un endpoint de tokens simulado detrás del rate limit por scope
+func setupTokenRouter(limiter *RateLimiter, config TokenRateLimitConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/oauth/token", limiter.LimitTokenByScope(config), func(c *gin.Context) {
+		var body struct {
+			Scope string `json:"scope" form:"scope"`
+		}
+		// El handler debe poder leer el cuerpo completo tras el middleware
+		if err := c.ShouldBind(&body); err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"scope": body.Scope})
+	})
+	return r
+}
+
+func postToken(r *gin.Engine, contentType, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/oauth/token", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestLimitTokenByScopeDifferentiatesScopes(t *testing.T) {
+	config := TokenRateLimitConfig{
+		Default: RateLimitRule{Requests: 5, Window: time.Minute},
+		Scopes: map[string]RateLimitRule{
+			"admin": {Requests: 2, Window: time.Minute},
+		},
+	}
+	r := setupTokenRouter(NewRateLimiter(NewMemoryRateLimitStore()), config)
+
+	adminBody := `{"client_id":"cliente","scope":"read admin"}`
+	readBody := `{"client_id":"cliente","scope":"read"}`
+
+	// El scope admin se agota tras 2 solicitudes
+	assert.Equal(t, http.StatusOK, postToken(r, "application/json", adminBody).Code)
+	assert.Equal(t, http.StatusOK, postToken(r, "application/json", adminBody).Code)
+	w := postToken(r, "application/json", adminBody)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// El scope de solo lectura mantiene su propio límite, más amplio
+	for i := 0; i < 5; i++ {
+		w := postToken(r, "application/json", readBody)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"scope":"read"`)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, postToken(r, "application/json", readBody).Code)
+}
+
+func TestLimitTokenByScopeReadsFormBodies(t *testing.T) {
+	config := TokenRateLimitConfig{
+		Scopes: map[string]RateLimitRule{
+			"admin": {Requests: 1, Window: time.Minute},
+		},
+	}
+	r := setupTokenRouter(NewRateLimiter(nil), config)
+
+	form := "client_id=cliente&scope=admin"
+	w := postToken(r, "application/x-www-form-urlencoded", form)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"scope":"admin"`)
+	assert.Equal(t, http.StatusTooManyRequests, postToken(r, "application/x-www-form-urlencoded", form).Code)
+
+	// Sin límite por defecto, otros scopes no se limitan
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, http.StatusOK, postToken(r, "application/x-www-form-urlencoded", "client_id=cliente&scope=read").Code)
+	}
+}
+
+func TestLimitTokenByScopeSeparatesClientIPs(t *testing.T) {
+	config := TokenRateLimitConfig{Default: RateLimitRule{Requests: 1, Window: time.Minute}}
+	r := setupTokenRouter(NewRateLimiter(nil), config)
+
+	send := func(remoteAddr string) int {
+		req, _ := http.NewRequest("POST", "/oauth/token", strings.NewReader(`{"client_id":"cliente"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send("203.0.113.1:1234"))
+	assert.Equal(t, http.StatusTooManyRequests, send("203.0.113.1:1234"))
+	// Otra IP con el mismo client_id no queda bloqueada
+	assert.Equal(t, http.StatusOK, send("198.51.100.7:1234"))
+}
+
+func TestLimitTokenByScopeRejectsLargeBodies(t *testing.T) {
+	r := setupTokenRouter(NewRateLimiter(nil), TokenRateLimitConfig{})
+
+	body := `{"client_id":"cliente","scope":"` + strings.Repeat("a", maxTokenRequestBytes) + `"}`
+	assert.Equal(t, http.StatusRequestEntityTooLarge, postToken(r, "application/json", body).Code)
+	assert.Equal(t, http.StatusOK, postToken(r, "application/json", `{"client_id":"cliente"}`).Code)
+}
+
+func TestMemoryRateLimitStoreRefills(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+	rule := RateLimitRule{Requests: 2, Window: 10 * time.Second}
+
+	assert.True(t, store.Take("k", rule).Allowed)
+	assert.True(t, store.Take("k", rule).Allowed)
+
+	denied := store.Take("k", rule)
+	assert.False(t, denied.Allowed)
+	assert.Equal(t, 5*time.Second, denied.RetryAfter)
+
+	// Tras 5 segundos se recupera una solicitud
+	now = now.Add(5 * time.Second)
+	assert.True(t, store.Take("k", rule).Allowed)
+}
+
+func TestLimitTokenByScopeRateLimitHeaders(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+	limiter := NewRateLimiter(store)
+	limiter.SetHeaders(true)
+
+	config := TokenRateLimitConfig{Default: RateLimitRule{Requests: 2, Window: 10 * time.Second}}
+	r := setupTokenRouter(limiter, config)
+	body := `{"client_id":"cliente","scope":"read"}`
+
+	w := postToken(r, "application/json", body)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "5", w.Header().Get("X-RateLimit-Reset"))
+
+	w = postToken(r, "application/json", body)
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "10", w.Header().Get("X-RateLimit-Reset"))
+
+	// La solicitud rechazada también informa el estado, junto con Retry-After
+	w = postToken(r, "application/json", body)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "5", w.Header().Get("Retry-After"))
+
+	// Tras recuperar una solicitud el reset se acorta
+	now = now.Add(5 * time.Second)
+	w = postToken(r, "application/json", body)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "10", w.Header().Get("X-RateLimit-Reset"))
+}
+
+func TestLimitTokenByScopeHeadersDisabledByDefault(t *testing.T) {
+	config := TokenRateLimitConfig{Default: RateLimitRule{Requests: 1, Window: time.Minute}}
+	r := setupTokenRouter(NewRateLimiter(nil), config)
+
+	w := postToken(r, "application/json", `{"client_id":"cliente"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("X-RateLimit-Limit"))
+	assert.Empty(t, w.Header().Get("X-RateLimit-Remaining"))
+}
+
+func TestLimitTokenByScopeReadsBasicAuthClient(t *testing.T) {
+	config := TokenRateLimitConfig{
+		Default: RateLimitRule{Requests: 1, Window: time.Minute},
+	}
+	r := setupTokenRouter(NewRateLimiter(nil), config)
+
+	post := func(clientID string) int {
+		req, _ := http.NewRequest("POST", "/oauth/token", strings.NewReader("grant_type=client_credentials&scope=read"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(clientID, "secreto")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Cada cliente autenticado con HTTP Basic tiene su propio límite
+	assert.Equal(t, http.StatusOK, post("cliente-a"))
+	assert.Equal(t, http.StatusTooManyRequests, post("cliente-a"))
+	assert.Equal(t, http.StatusOK, post("cliente-b"))
+}
+
+func TestLimitByClient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	limiter := NewRateLimiter(nil)
+	limiter.SetHeaders(true)
+	rule := RateLimitRule{Requests: 1, Window: time.Minute}
+	// Autenticación de prueba: "Authorization: <userID>" identifica al usuario
+	auth := func(c *gin.Context) {
+		if userID := c.GetHeader("Authorization"); userID != "" {
+			c.Set(utils.UserIDContextKey, userID)
+		}
+		c.Next()
+	}
+	r.POST("/login", limiter.Limit("public", rule), func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/me", auth, limiter.Limit("api", rule), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	send := func(method, path, remoteAddr, userID string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, nil)
+		req.RemoteAddr = remoteAddr
+		if userID != "" {
+			req.Header.Set("Authorization", userID)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("sin sesión limita por IP", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send("POST", "/login", "10.0.0.1:1234", "").Code)
+		w := send("POST", "/login", "10.0.0.1:5678", "")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "60", w.Header().Get("Retry-After"))
+		assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+
+		assert.Equal(t, http.StatusOK, send("POST", "/login", "10.0.0.2:1234", "").Code)
+	})
+
+	t.Run("con sesión limita por usuario", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send("GET", "/me", "10.0.0.3:1234", "usuario-a").Code)
+		// Otra IP no evita el límite del mismo usuario
+		assert.Equal(t, http.StatusTooManyRequests, send("GET", "/me", "10.0.0.4:1234", "usuario-a").Code)
+		// Otro usuario desde la misma IP tiene su propio límite
+		assert.Equal(t, http.StatusOK, send("GET", "/me", "10.0.0.3:1234", "usuario-b").Code)
+	})
+
+	t.Run("cada grupo tiene sus contadores", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send("GET", "/me", "10.0.0.5:1234", "").Code)
+		assert.Equal(t, http.StatusOK, send("POST", "/login", "10.0.0.5:1234", "").Code)
+	})
+}
+
+func TestLimitWithoutRequestsDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", NewRateLimiter(nil).Limit("api", RateLimitRule{}), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for i := 0; i < 5; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+}
+
+func TestMemoryRateLimitStoreEvictsFullBuckets(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+	short := RateLimitRule{Requests: 2, Window: 10 * time.Second}
+	long := RateLimitRule{Requests: 2, Window: time.Hour}
+
+	store.Take("a", short)
+	store.Take("b", long)
+	assert.Len(t, store.buckets, 2)
+
+	// Tras el intervalo de barrido solo se descarta el bucket que ya se rellenó
+	now = now.Add(memoryStoreSweepInterval)
+	store.Take("c", short)
+	assert.Len(t, store.buckets, 2)
+	assert.NotContains(t, store.buckets, "a")
+
+	// El bucket conservado mantiene su consumo
+	assert.Equal(t, 0, store.Take("b", long).Remaining)
+}
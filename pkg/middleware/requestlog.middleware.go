@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// RequestIDHeader es el header con el ID de correlación de cada petición
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength limita el ID recibido del cliente para que no infle los logs
+const maxRequestIDLength = 128
+
+// RequestLogEntry describe una petición atendida
+type RequestLogEntry struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`            // Ruta solicitada, sin query string
+	Route     string    `json:"route,omitempty"` // Plantilla de la ruta (ej. /api/users/:id); vacía si no existe
+	Status    int       `json:"status"`
+	LatencyMS float64   `json:"latency_ms"`
+	ClientIP  string    `json:"client_ip"`
+	UserID    string    `json:"user_id,omitempty"` // Usuario (o "apikey:<id>") autenticado, si lo hay
+}
+
+// RequestLogRecorder registra las peticiones atendidas (ej. en un logger estructurado)
+type RequestLogRecorder interface {
+	RecordRequest(entry *RequestLogEntry)
+}
+
+// RequestLogRecorderFunc adapta una función a RequestLogRecorder
+type RequestLogRecorderFunc func(entry *RequestLogEntry)
+
+// RecordRequest llama a f(entry)
+func (f RequestLogRecorderFunc) RecordRequest(entry *RequestLogEntry) {
+	f(entry)
+}
+
+// NewJSONRequestLog retorna un RequestLogRecorder que escribe cada petición como una línea JSON
+// en out
+func NewJSONRequestLog(out io.Writer) RequestLogRecorder {
+	var mu sync.Mutex
+	encoder := json.NewEncoder(out)
+	return RequestLogRecorderFunc(func(entry *RequestLogEntry) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := encoder.Encode(entry); err != nil {
+			log.Printf("[ERROR] no se pudo registrar la petición request_id=%s: %v", entry.RequestID, err)
+		}
+	})
+}
+
+// RequestLogger asigna a cada petición un ID de correlación, lo guarda en el contexto
+// (utils.RequestIDContextKey) y en el header X-Request-ID de la respuesta, y al terminar registra
+// la petición con recorder (nil = JSON en la salida del paquete log). Respeta el X-Request-ID
+// recibido si es válido, para seguir una petición a través de varios servicios. Debe registrarse
+// primero con router.Use para que el ID exista en todos los demás middlewares y en los errores.
+func RequestLogger(recorder RequestLogRecorder) gin.HandlerFunc {
+	if recorder == nil {
+		recorder = NewJSONRequestLog(log.Writer())
+	}
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		c.Set(utils.RequestIDContextKey, requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		c.Next()
+
+		userID, _ := utils.MustUserID(c)
+		recorder.RecordRequest(&RequestLogEntry{
+			Time:      start.UTC(),
+			RequestID: requestID,
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			Route:     c.FullPath(),
+			Status:    c.Writer.Status(),
+			LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			ClientIP:  c.ClientIP(),
+			UserID:    userID,
+		})
+	}
+}
+
+// validRequestID acepta IDs no vacíos de hasta maxRequestIDLength caracteres alfanuméricos o
+// "-", "_", ".", ":", de modo que un valor del cliente no pueda inyectar contenido en los logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID genera un ID aleatorio de 32 caracteres hexadecimales
+func newRequestID() string {
+	id, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		// Sin aleatoriedad disponible se usa la hora, que sigue permitiendo correlacionar
+		return time.Now().UTC().Format("20060102T150405.000000000")
+	}
+	return id
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// setupRequestLogRouter registra RequestLogger de forma global, igual que main, y guarda las
+// peticiones registradas en entries
+func setupRequestLogRouter(entries *[]*RequestLogEntry) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestLogger(RequestLogRecorderFunc(func(entry *RequestLogEntry) {
+		*entries = append(*entries, entry)
+	})))
+	r.GET("/api/users/:id", func(c *gin.Context) {
+		c.Set(utils.UserIDContextKey, "usuario-1")
+		utils.NotFoundResponse(c, "Usuario")
+	})
+	return r
+}
+
+func TestRequestLogger(t *testing.T) {
+	send := func(r *gin.Engine, path, requestID string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		if requestID != "" {
+			req.Header.Set(RequestIDHeader, requestID)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("registra la petición y agrega el ID al error", func(t *testing.T) {
+		var entries []*RequestLogEntry
+		w := send(setupRequestLogRouter(&entries), "/api/users/42?token=secreto", "")
+
+		requestID := w.Header().Get(RequestIDHeader)
+		assert.Len(t, requestID, 32)
+		assert.Contains(t, w.Body.String(), `"request_id":"`+requestID+`"`)
+
+		require.Len(t, entries, 1)
+		entry := entries[0]
+		assert.Equal(t, requestID, entry.RequestID)
+		assert.Equal(t, "GET", entry.Method)
+		assert.Equal(t, "/api/users/42", entry.Path)
+		assert.Equal(t, "/api/users/:id", entry.Route)
+		assert.Equal(t, http.StatusNotFound, entry.Status)
+		assert.Equal(t, "usuario-1", entry.UserID)
+		assert.GreaterOrEqual(t, entry.LatencyMS, 0.0)
+	})
+
+	t.Run("respeta un X-Request-ID válido", func(t *testing.T) {
+		var entries []*RequestLogEntry
+		w := send(setupRequestLogRouter(&entries), "/api/users/42", "gateway-abc_123")
+
+		assert.Equal(t, "gateway-abc_123", w.Header().Get(RequestIDHeader))
+		require.Len(t, entries, 1)
+		assert.Equal(t, "gateway-abc_123", entries[0].RequestID)
+	})
+
+	t.Run("reemplaza un X-Request-ID no válido", func(t *testing.T) {
+		for _, invalid := range []string{"id con espacios", `id"}`, strings.Repeat("a", maxRequestIDLength+1)} {
+			var entries []*RequestLogEntry
+			w := send(setupRequestLogRouter(&entries), "/api/users/42", invalid)
+
+			assert.Len(t, w.Header().Get(RequestIDHeader), 32, invalid)
+			assert.NotEqual(t, invalid, entries[0].RequestID)
+		}
+	})
+
+	t.Run("ruta inexistente", func(t *testing.T) {
+		var entries []*RequestLogEntry
+		send(setupRequestLogRouter(&entries), "/no-existe", "")
+
+		require.Len(t, entries, 1)
+		assert.Equal(t, http.StatusNotFound, entries[0].Status)
+		assert.Empty(t, entries[0].Route)
+		assert.Empty(t, entries[0].UserID)
+	})
+}
+
+func TestNewJSONRequestLog(t *testing.T) {
+	var out bytes.Buffer
+	recorder := NewJSONRequestLog(&out)
+
+	recorder.RecordRequest(&RequestLogEntry{RequestID: "a", Method: "GET", Path: "/", Status: 200})
+	recorder.RecordRequest(&RequestLogEntry{RequestID: "b", Method: "POST", Path: "/x", Status: 201, UserID: "u"})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+	assert.Equal(t, "b", entry["request_id"])
+	assert.Equal(t, "POST", entry["method"])
+	assert.Equal(t, float64(201), entry["status"])
+	assert.Equal(t, "u", entry["user_id"])
+	assert.NotContains(t, lines[0], "user_id")
+}
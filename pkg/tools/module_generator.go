@@ -4,6 +4,8 @@
 package tools
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -11,14 +13,41 @@ import (
 	"text/template"
 )
 
-// GenerateModule crea la estructura básica de un nuevo módulo
+// ModuleWriter abstrae dónde se escriben los archivos de un módulo generado,
+// lo que permite redirigir la salida o probar el generador en memoria
+type ModuleWriter interface {
+	MkdirAll(dir string) error
+	WriteFile(path string, data []byte) error
+}
+
+// OSModuleWriter escribe los archivos en el sistema de archivos. Las rutas son relativas
+// a Root; vacío usa el directorio actual.
+type OSModuleWriter struct {
+	Root string
+}
+
+// MkdirAll crea el directorio y sus padres bajo Root
+func (w OSModuleWriter) MkdirAll(dir string) error {
+	return os.MkdirAll(filepath.Join(w.Root, dir), 0755)
+}
+
+// WriteFile crea o reemplaza el archivo bajo Root
+func (w OSModuleWriter) WriteFile(path string, data []byte) error {
+	return os.WriteFile(filepath.Join(w.Root, path), data, 0644)
+}
+
+// GenerateModule crea la estructura básica de un nuevo módulo en internal/<módulo>
 func GenerateModule(moduleName string) error {
-	// Convertir a minúsculas y quitar espacios
-	moduleName = strings.ToLower(strings.TrimSpace(moduleName))
+	return GenerateModuleTo(moduleName, OSModuleWriter{})
+}
 
-	// Verificar nombre
-	if moduleName == "" {
-		return fmt.Errorf("el nombre del módulo no puede estar vacío")
+// GenerateModuleTo crea la estructura básica de un nuevo módulo usando writer para
+// crear directorios y archivos
+func GenerateModuleTo(moduleName string, writer ModuleWriter) error {
+	// Validar el nombre antes de crear cualquier archivo
+	moduleName, err := CanonicalModuleName(moduleName)
+	if err != nil {
+		return err
 	}
 
 	// Rutas base
@@ -32,7 +61,7 @@ func GenerateModule(moduleName string) error {
 
 	// Crear estructura de directorios
 	for _, dir := range dirs {
-		if err := os.MkdirAll(dir, 0755); err != nil {
+		if err := writer.MkdirAll(dir); err != nil {
 			return fmt.Errorf("error al crear directorio %s: %w", dir, err)
 		}
 		fmt.Printf("Directorio creado: %s\n", dir)
@@ -44,6 +73,7 @@ func GenerateModule(moduleName string) error {
 		baseDir + "/repository/mongo." + moduleName + ".repository.go": repositoryTemplate,
 		baseDir + "/usecase/" + moduleName + ".usecase.go":             usecaseTemplate,
 		baseDir + "/delivery/" + moduleName + ".delivery.go":           deliveryTemplate,
+		baseDir + "/delivery/" + moduleName + "_delivery_test.go":      deliveryTestTemplate,
 	}
 
 	data := struct {
@@ -55,36 +85,63 @@ func GenerateModule(moduleName string) error {
 	}
 
 	for file, templateContent := range files {
-		if err := generateFile(file, templateContent, data); err != nil {
+		if err := generateFile(writer, file, templateContent, data); err != nil {
 			return fmt.Errorf("error al generar archivo %s: %w", file, err)
 		}
 		fmt.Printf("Archivo generado: %s\n", file)
 	}
 
 	// Generar fragmento para main.go
-	mainFragment := filepath.Join(baseDir, "main_fragment.go.txt")
-	if err := generateFile(mainFragment, mainTemplate, data); err != nil {
+	mainFragment := baseDir + "/main_fragment.go.txt"
+	if err := generateFile(writer, mainFragment, mainTemplate, data); err != nil {
 		return fmt.Errorf("error al generar fragmento para main.go: %w", err)
 	}
 	fmt.Printf("\nArchivo generado: %s\n", mainFragment)
 	fmt.Printf("\nFragmento para agregar a main.go creado. Revise el archivo %s\n", mainFragment)
 
+	// Generar manifiesto con los permisos del módulo
+	manifestPath := baseDir + "/permissions.json"
+	manifestData, err := json.MarshalIndent(ModulePermissionManifest(moduleName), "", "  ")
+	if err != nil {
+		return fmt.Errorf("error al generar el manifiesto de permisos: %w", err)
+	}
+	if err := writer.WriteFile(manifestPath, append(manifestData, '\n')); err != nil {
+		return fmt.Errorf("error al generar el manifiesto de permisos: %w", err)
+	}
+	fmt.Printf("\nArchivo generado: %s\n", manifestPath)
+	fmt.Printf("Aplique los permisos con: go run ./cmd/permission-manifest apply %s\n", manifestPath)
+
 	return nil
 }
 
-func generateFile(path, content string, data interface{}) error {
-	file, err := os.Create(path)
-	if err != nil {
-		return err
+// ModulePermissionManifest retorna el manifiesto con los permisos estándar de un módulo
+// generado (access, read, write y delete sobre <módulo>s)
+func ModulePermissionManifest(moduleName string) *PermissionManifest {
+	module := moduleName + "s"
+	return &PermissionManifest{
+		Permissions: []ManifestPermission{
+			{Code: module + ":access", Module: module, Action: "access", Name: "Acceso a " + module, Description: "Permite acceso básico al módulo de " + module},
+			{Code: module + ":read", Module: module, Action: "read", Name: "Ver " + module, Description: "Permite ver " + module},
+			{Code: module + ":write", Module: module, Action: "write", Name: "Gestionar " + module, Description: "Permite crear y modificar " + module},
+			{Code: module + ":delete", Module: module, Action: "delete", Name: "Eliminar " + module, Description: "Permite eliminar " + module},
+		},
+		Roles: []ManifestRole{},
 	}
-	defer file.Close()
+}
 
+// generateFile ejecuta la plantilla y entrega el resultado completo a writer
+func generateFile(writer ModuleWriter, path, content string, data interface{}) error {
 	tmpl, err := template.New("file").Parse(content)
 	if err != nil {
 		return err
 	}
 
-	return tmpl.Execute(file, data)
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return err
+	}
+
+	return writer.WriteFile(path, buf.Bytes())
 }
 
 // Templates para los archivos
@@ -94,6 +151,8 @@ import (
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
 )
 
 // Constantes para el estado del {{.ModuleName}}
@@ -109,6 +168,7 @@ type {{.ModuleNameTitle}} struct {
 	Name        string             ` + "`json:\"name\" bson:\"name\"`" + `
 	Description string             ` + "`json:\"description\" bson:\"description\"`" + `
 	Status      string             ` + "`json:\"status\" bson:\"status\"`" + `
+	OwnerID     string             ` + "`json:\"owner_id,omitempty\" bson:\"owner_id,omitempty\"`" + ` // Usuario propietario (ver utils.OwnerField)
 	CreatedAt   time.Time          ` + "`json:\"created_at\" bson:\"created_at\"`" + `
 	UpdatedAt   time.Time          ` + "`json:\"updated_at\" bson:\"updated_at\"`" + `
 	ArchivedAt  *time.Time         ` + "`json:\"archived_at,omitempty\" bson:\"archived_at,omitempty\"`" + `
@@ -136,6 +196,7 @@ type {{.ModuleNameTitle}}Response struct {
 	Name        string     ` + "`json:\"name\"`" + `
 	Description string     ` + "`json:\"description\"`" + `
 	Status      string     ` + "`json:\"status\"`" + `
+	OwnerID     string     ` + "`json:\"owner_id,omitempty\"`" + `
 	CreatedAt   time.Time  ` + "`json:\"created_at\"`" + `
 	UpdatedAt   time.Time  ` + "`json:\"updated_at\"`" + `
 	ArchivedAt  *time.Time ` + "`json:\"archived_at,omitempty\"`" + `
@@ -145,21 +206,24 @@ type {{.ModuleNameTitle}}Response struct {
 // {{.ModuleNameTitle}}Repository define el contrato para la capa de persistencia
 type {{.ModuleNameTitle}}Repository interface {
 	GetByID(id string) (*{{.ModuleNameTitle}}, error)
-	GetAll(params map[string]interface{}) ([]*{{.ModuleNameTitle}}, error)
+	GetAll(query utils.QueryOptions) ([]*{{.ModuleNameTitle}}, error)
 	Create({{.ModuleName}} *{{.ModuleNameTitle}}) error
 	Update({{.ModuleName}} *{{.ModuleNameTitle}}) error
 	Delete(id string) error
 	Archive(id string) error
+	TransferOwnership(fromUserID, toUserID string) (int64, error)
 }
 
 // {{.ModuleNameTitle}}UseCase define el contrato para la capa de casos de uso
 type {{.ModuleNameTitle}}UseCase interface {
 	Get{{.ModuleNameTitle}}(id string) (*{{.ModuleNameTitle}}Response, error)
-	GetAll{{.ModuleNameTitle}}s(params map[string]interface{}) ([]*{{.ModuleNameTitle}}Response, error)
+	GetAll{{.ModuleNameTitle}}s(query utils.QueryOptions) ([]*{{.ModuleNameTitle}}Response, error)
 	Create{{.ModuleNameTitle}}(req *Create{{.ModuleNameTitle}}Request) (*{{.ModuleNameTitle}}Response, error)
 	Update{{.ModuleNameTitle}}(id string, req *Update{{.ModuleNameTitle}}Request) (*{{.ModuleNameTitle}}Response, error)
 	Delete{{.ModuleNameTitle}}(id string) error
 	Archive{{.ModuleNameTitle}}(id string) error
+	// TransferOwnership reasigna los {{.ModuleName}}s de un usuario a otro (ej. al dar de baja al usuario)
+	TransferOwnership(fromUserID, toUserID string) (int64, error)
 }
 `
 
@@ -176,6 +240,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"github.com/black4ninja/mi-proyecto/internal/{{.ModuleName}}/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
 )
 
 type mongo{{.ModuleNameTitle}}Repository struct {
@@ -213,19 +278,22 @@ func (r *mongo{{.ModuleNameTitle}}Repository) GetByID(id string) (*domain.{{.Mod
 	return &{{.ModuleName}}, nil
 }
 
-// GetAll obtiene todos los {{.ModuleName}}s que coincidan con los parámetros dados
-func (r *mongo{{.ModuleNameTitle}}Repository) GetAll(params map[string]interface{}) ([]*domain.{{.ModuleNameTitle}}, error) {
+// GetAll obtiene los {{.ModuleName}}s que coincidan con el filtro, en el orden indicado
+func (r *mongo{{.ModuleNameTitle}}Repository) GetAll(query utils.QueryOptions) ([]*domain.{{.ModuleNameTitle}}, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
 
-	// Construir filtro
-	filter := bson.M{}
-	for key, value := range params {
-		filter[key] = value
+	filter := query.Filter
+	if filter == nil {
+		filter = bson.M{}
 	}
 
 	opts := options.Find()
-	opts.SetSort(bson.M{"created_at": -1})
+	if len(query.Sort) > 0 {
+		opts.SetSort(query.Sort)
+	} else {
+		opts.SetSort(bson.M{"created_at": -1})
+	}
 
 	cursor, err := r.collection.Find(ctx, filter, opts)
 	if err != nil {
@@ -310,6 +378,14 @@ func (r *mongo{{.ModuleNameTitle}}Repository) Archive(id string) error {
 	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": objID}, update)
 	return err
 }
+
+// TransferOwnership reasigna en bloque los {{.ModuleName}}s de un usuario a otro
+func (r *mongo{{.ModuleNameTitle}}Repository) TransferOwnership(fromUserID, toUserID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	return utils.TransferOwnership(ctx, r.collection, fromUserID, toUserID)
+}
 `
 
 const usecaseTemplate = `package usecase
@@ -319,6 +395,7 @@ import (
 	"time"
 
 	"github.com/black4ninja/mi-proyecto/internal/{{.ModuleName}}/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
 )
 
 type {{.ModuleName}}UseCase struct {
@@ -344,6 +421,7 @@ func (u *{{.ModuleName}}UseCase) Get{{.ModuleNameTitle}}(id string) (*domain.{{.
 		Name:        {{.ModuleName}}.Name,
 		Description: {{.ModuleName}}.Description,
 		Status:      {{.ModuleName}}.Status,
+		OwnerID:     {{.ModuleName}}.OwnerID,
 		CreatedAt:   {{.ModuleName}}.CreatedAt,
 		UpdatedAt:   {{.ModuleName}}.UpdatedAt,
 		ArchivedAt:  {{.ModuleName}}.ArchivedAt,
@@ -351,9 +429,9 @@ func (u *{{.ModuleName}}UseCase) Get{{.ModuleNameTitle}}(id string) (*domain.{{.
 	}, nil
 }
 
-// GetAll{{.ModuleNameTitle}}s obtiene todos los {{.ModuleName}}s
-func (u *{{.ModuleName}}UseCase) GetAll{{.ModuleNameTitle}}s(params map[string]interface{}) ([]*domain.{{.ModuleNameTitle}}Response, error) {
-	{{.ModuleName}}s, err := u.{{.ModuleName}}Repo.GetAll(params)
+// GetAll{{.ModuleNameTitle}}s obtiene los {{.ModuleName}}s que coincidan con la consulta
+func (u *{{.ModuleName}}UseCase) GetAll{{.ModuleNameTitle}}s(query utils.QueryOptions) ([]*domain.{{.ModuleNameTitle}}Response, error) {
+	{{.ModuleName}}s, err := u.{{.ModuleName}}Repo.GetAll(query)
 	if err != nil {
 		return nil, err
 	}
@@ -365,6 +443,7 @@ func (u *{{.ModuleName}}UseCase) GetAll{{.ModuleNameTitle}}s(params map[string]i
 			Name:        {{.ModuleName}}.Name,
 			Description: {{.ModuleName}}.Description,
 			Status:      {{.ModuleName}}.Status,
+			OwnerID:     {{.ModuleName}}.OwnerID,
 			CreatedAt:   {{.ModuleName}}.CreatedAt,
 			UpdatedAt:   {{.ModuleName}}.UpdatedAt,
 			ArchivedAt:  {{.ModuleName}}.ArchivedAt,
@@ -397,6 +476,7 @@ func (u *{{.ModuleName}}UseCase) Create{{.ModuleNameTitle}}(req *domain.Create{{
 		Name:        {{.ModuleName}}.Name,
 		Description: {{.ModuleName}}.Description,
 		Status:      {{.ModuleName}}.Status,
+		OwnerID:     {{.ModuleName}}.OwnerID,
 		CreatedAt:   {{.ModuleName}}.CreatedAt,
 		UpdatedAt:   {{.ModuleName}}.UpdatedAt,
 		// Añade aquí tus campos específicos
@@ -443,6 +523,7 @@ func (u *{{.ModuleName}}UseCase) Update{{.ModuleNameTitle}}(id string, req *doma
 		Name:        {{.ModuleName}}.Name,
 		Description: {{.ModuleName}}.Description,
 		Status:      {{.ModuleName}}.Status,
+		OwnerID:     {{.ModuleName}}.OwnerID,
 		CreatedAt:   {{.ModuleName}}.CreatedAt,
 		UpdatedAt:   {{.ModuleName}}.UpdatedAt,
 		ArchivedAt:  {{.ModuleName}}.ArchivedAt,
@@ -459,6 +540,15 @@ func (u *{{.ModuleName}}UseCase) Delete{{.ModuleNameTitle}}(id string) error {
 func (u *{{.ModuleName}}UseCase) Archive{{.ModuleNameTitle}}(id string) error {
 	return u.{{.ModuleName}}Repo.Archive(id)
 }
+
+// TransferOwnership reasigna los {{.ModuleName}}s de un usuario a otro.
+// Verifica aquí que el usuario destino exista si el módulo depende de UserUseCase.
+func (u *{{.ModuleName}}UseCase) TransferOwnership(fromUserID, toUserID string) (int64, error) {
+	if err := utils.ValidateOwnershipTransfer(fromUserID, toUserID); err != nil {
+		return 0, err
+	}
+	return u.{{.ModuleName}}Repo.TransferOwnership(fromUserID, toUserID)
+}
 `
 
 const deliveryTemplate = `package delivery
@@ -467,11 +557,31 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
 
 	"github.com/black4ninja/mi-proyecto/internal/{{.ModuleName}}/domain"
 	"github.com/black4ninja/mi-proyecto/pkg/utils"
 )
 
+// {{.ModuleNameTitle}}QueryConfig declara los campos por los que se puede filtrar y ordenar el
+// listado de {{.ModuleName}}s. Los filtros no declarados se ignoran y ordenar por un campo que
+// no esté en SortFields responde 400.
+var {{.ModuleNameTitle}}QueryConfig = utils.QueryConfig{
+	Filters: utils.FilterConfig{
+		"status": utils.FilterDefinition{
+			AllowedValues: []string{domain.{{.ModuleNameTitle}}StatusActive, domain.{{.ModuleNameTitle}}StatusInactive, domain.{{.ModuleNameTitle}}StatusArchived},
+			MultiValue:    true,
+		},
+		"name": utils.FilterDefinition{
+			Validator:   func(s string) bool { return len(s) <= 100 },
+			Transformer: utils.TransformToRegex,
+		},
+		// Declara aquí los filtros de los campos propios del módulo
+	},
+	SortFields:  []string{"name", "status", "created_at", "updated_at"},
+	DefaultSort: bson.D{bson.E{Key: "created_at", Value: -1}},
+}
+
 // {{.ModuleNameTitle}}Handler maneja las peticiones HTTP para {{.ModuleName}}s
 type {{.ModuleNameTitle}}Handler struct {
 	{{.ModuleName}}UseCase domain.{{.ModuleNameTitle}}UseCase
@@ -492,35 +602,22 @@ func New{{.ModuleNameTitle}}Handler(router *gin.RouterGroup, useCase domain.{{.M
 	router.PUT("/:id/archive", handler.Archive{{.ModuleNameTitle}})
 }
 
-// GetAll{{.ModuleNameTitle}}s manejador para obtener todos los {{.ModuleName}}s
+// GetAll{{.ModuleNameTitle}}s manejador para obtener todos los {{.ModuleName}}s. Acepta los filtros y
+// el parámetro sort declarados en {{.ModuleNameTitle}}QueryConfig (ej. ?status=active&sort=-created_at).
 func (h *{{.ModuleNameTitle}}Handler) GetAll{{.ModuleNameTitle}}s(c *gin.Context) {
-	// Extraer todos los parámetros de consulta
-	queryParams := make(map[string]string)
-
-	if status := c.Query("status"); status != "" {
-		queryParams["status"] = status
-	}
-	if name := c.Query("name"); name != "" {
-		queryParams["name"] = name
+	query, err := utils.ParseQueryOptions(c.Request.URL.Query(), {{.ModuleNameTitle}}QueryConfig)
+	if err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
 	}
 
-	// Construir filtro para MongoDB
-	filter := utils.BuildMongoFilter(queryParams, utils.FilterConfig{
-		"status": utils.FilterDefinition{
-			AllowedValues: []string{domain.{{.ModuleNameTitle}}StatusActive, domain.{{.ModuleNameTitle}}StatusInactive, domain.{{.ModuleNameTitle}}StatusArchived},
-		},
-		"name": utils.FilterDefinition{
-			Transformer: utils.TransformToRegex,
-		},
-	})
-
 	// Si no se especificó un estado, mostrar solo {{.ModuleName}}s activos por defecto
-	if _, hasStatus := filter["status"]; !hasStatus {
-		filter["status"] = domain.{{.ModuleNameTitle}}StatusActive
+	if _, hasStatus := query.Filter["status"]; !hasStatus {
+		query.Filter["status"] = domain.{{.ModuleNameTitle}}StatusActive
 	}
 
 	// Obtener todos los {{.ModuleName}}s con los filtros aplicados
-	{{.ModuleName}}s, err := h.{{.ModuleName}}UseCase.GetAll{{.ModuleNameTitle}}s(filter)
+	{{.ModuleName}}s, err := h.{{.ModuleName}}UseCase.GetAll{{.ModuleNameTitle}}s(query)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
@@ -603,6 +700,70 @@ func (h *{{.ModuleNameTitle}}Handler) Archive{{.ModuleNameTitle}}(c *gin.Context
 }
 `
 
+const deliveryTestTemplate = `package delivery_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/black4ninja/mi-proyecto/internal/{{.ModuleName}}/delivery"
+	"github.com/black4ninja/mi-proyecto/internal/{{.ModuleName}}/domain"
+	"github.com/black4ninja/mi-proyecto/pkg/utils"
+)
+
+// stub{{.ModuleNameTitle}}UseCase guarda la consulta que recibe GetAll{{.ModuleNameTitle}}s
+type stub{{.ModuleNameTitle}}UseCase struct {
+	domain.{{.ModuleNameTitle}}UseCase
+	query *utils.QueryOptions
+}
+
+func (s *stub{{.ModuleNameTitle}}UseCase) GetAll{{.ModuleNameTitle}}s(query utils.QueryOptions) ([]*domain.{{.ModuleNameTitle}}Response, error) {
+	s.query = &query
+	return []*domain.{{.ModuleNameTitle}}Response{}, nil
+}
+
+func TestGetAll{{.ModuleNameTitle}}sSortAllowList(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantSort   bson.D
+	}{
+		{name: "orden por defecto", wantStatus: http.StatusOK, wantSort: bson.D{bson.E{Key: "created_at", Value: -1}}},
+		{name: "campo permitido", query: "?sort=-name", wantStatus: http.StatusOK, wantSort: bson.D{bson.E{Key: "name", Value: -1}}},
+		{name: "campo no permitido", query: "?sort=password", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useCase := &stub{{.ModuleNameTitle}}UseCase{}
+			r := gin.New()
+			delivery.New{{.ModuleNameTitle}}Handler(r.Group("/{{.ModuleName}}s"), useCase)
+
+			req, _ := http.NewRequest("GET", "/{{.ModuleName}}s/"+tt.query, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus != http.StatusOK {
+				assert.Nil(t, useCase.query, "el caso de uso no debe recibir un orden no permitido")
+				return
+			}
+			if assert.NotNil(t, useCase.query) {
+				assert.Equal(t, tt.wantSort, useCase.query.Sort)
+			}
+		})
+	}
+}
+`
+
 const mainTemplate = `// Fragmento para añadir a main.go
 
 // En la sección de colecciones de MongoDB
@@ -620,9 +781,7 @@ const mainTemplate = `// Fragmento para añadir a main.go
 {{.ModuleName}}Routes.Use(permissionMiddleware.RequirePermission("{{.ModuleName}}s:access")) // Opcional: middleware de permisos
 {{.ModuleName}}Delivery.New{{.ModuleNameTitle}}Handler({{.ModuleName}}Routes, {{.ModuleName}}Service)
 
-// También puedes añadir permisos en scripts/init_permissions_and_admin.go:
-// createDefaultPermission(permissionService, "{{.ModuleName}}s:access", "{{.ModuleName}}s", "access", "Acceso a {{.ModuleName}}s", "Permite acceso básico al módulo de {{.ModuleName}}s")
-// createDefaultPermission(permissionService, "{{.ModuleName}}s:read", "{{.ModuleName}}s", "read", "Ver {{.ModuleName}}s", "Permite ver {{.ModuleName}}s")
-// createDefaultPermission(permissionService, "{{.ModuleName}}s:write", "{{.ModuleName}}s", "write", "Gestionar {{.ModuleName}}s", "Permite crear y modificar {{.ModuleName}}s")
-// createDefaultPermission(permissionService, "{{.ModuleName}}s:delete", "{{.ModuleName}}s", "delete", "Eliminar {{.ModuleName}}s", "Permite eliminar {{.ModuleName}}s")
+// Los permisos del módulo ({{.ModuleName}}s:access, read, write y delete) están en
+// internal/{{.ModuleName}}/permissions.json. Aplíquelos con:
+// go run ./cmd/permission-manifest apply internal/{{.ModuleName}}/permissions.json
 `
@@ -0,0 +1,213 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryModuleWriter guarda en memoria los directorios y archivos generados
+type memoryModuleWriter struct {
+	dirs  []string
+	files map[string]string
+	err   error // si está definido, WriteFile falla con este error
+}
+
+func newMemoryModuleWriter() *memoryModuleWriter {
+	return &memoryModuleWriter{files: make(map[string]string)}
+}
+
+func (w *memoryModuleWriter) MkdirAll(dir string) error {
+	w.dirs = append(w.dirs, dir)
+	return nil
+}
+
+func (w *memoryModuleWriter) WriteFile(path string, data []byte) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.files[path] = string(data)
+	return nil
+}
+
+func TestGenerateModuleTo(t *testing.T) {
+	writer := newMemoryModuleWriter()
+	require.NoError(t, GenerateModuleTo("  Facturas ", writer))
+
+	assert.ElementsMatch(t, []string{
+		"internal/facturas/domain",
+		"internal/facturas/repository",
+		"internal/facturas/usecase",
+		"internal/facturas/delivery",
+	}, writer.dirs)
+
+	var paths []string
+	for path := range writer.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	assert.Equal(t, []string{
+		"internal/facturas/delivery/facturas.delivery.go",
+		"internal/facturas/delivery/facturas_delivery_test.go",
+		"internal/facturas/domain/facturas.domain.go",
+		"internal/facturas/main_fragment.go.txt",
+		"internal/facturas/permissions.json",
+		"internal/facturas/repository/mongo.facturas.repository.go",
+		"internal/facturas/usecase/facturas.usecase.go",
+	}, paths)
+
+	t.Run("los archivos Go generados son válidos", func(t *testing.T) {
+		for path, content := range writer.files {
+			if !strings.HasSuffix(path, ".go") {
+				continue
+			}
+			file, err := parser.ParseFile(token.NewFileSet(), path, content, parser.ParseComments)
+			require.NoError(t, err, path)
+			assert.Equal(t, filepath.Base(filepath.Dir(path)), strings.TrimSuffix(file.Name.Name, "_test"), "paquete de %s", path)
+		}
+	})
+
+	t.Run("las plantillas usan el nombre del módulo", func(t *testing.T) {
+		domain := writer.files["internal/facturas/domain/facturas.domain.go"]
+		assert.Contains(t, domain, "type Facturas struct {")
+		assert.Contains(t, domain, "FacturasStatusActive")
+
+		repository := writer.files["internal/facturas/repository/mongo.facturas.repository.go"]
+		assert.Contains(t, repository, "func NewMongoFacturasRepository(collection *mongo.Collection) domain.FacturasRepository")
+
+		usecase := writer.files["internal/facturas/usecase/facturas.usecase.go"]
+		assert.Contains(t, usecase, "func NewFacturasUseCase(")
+
+		delivery := writer.files["internal/facturas/delivery/facturas.delivery.go"]
+		assert.Contains(t, delivery, "func NewFacturasHandler(router *gin.RouterGroup, useCase domain.FacturasUseCase)")
+
+		for path, content := range writer.files {
+			assert.NotContains(t, content, "{{", "plantilla sin resolver en %s", path)
+		}
+	})
+}
+
+func TestGenerateModuleQueryAllowList(t *testing.T) {
+	writer := newMemoryModuleWriter()
+	require.NoError(t, GenerateModuleTo("facturas", writer))
+
+	// El listado usa la lista de campos declarada en lugar de filtros fijos
+	delivery := writer.files["internal/facturas/delivery/facturas.delivery.go"]
+	assert.Contains(t, delivery, "var FacturasQueryConfig = utils.QueryConfig{")
+	assert.Contains(t, delivery, `SortFields:  []string{"name", "status", "created_at", "updated_at"},`)
+	assert.Contains(t, delivery, "utils.ParseQueryOptions(c.Request.URL.Query(), FacturasQueryConfig)")
+	assert.Contains(t, delivery, "utils.ValidationErrorResponse(c, err.Error())")
+
+	repository := writer.files["internal/facturas/repository/mongo.facturas.repository.go"]
+	assert.Contains(t, repository, "GetAll(query utils.QueryOptions)")
+	assert.Contains(t, repository, "opts.SetSort(query.Sort)")
+
+	// Cada módulo generado incluye la prueba de que el manejador rechaza órdenes no permitidos
+	test := writer.files["internal/facturas/delivery/facturas_delivery_test.go"]
+	assert.Contains(t, test, "func TestGetAllFacturassSortAllowList(t *testing.T)")
+	assert.Contains(t, test, `query: "?sort=password", wantStatus: http.StatusBadRequest`)
+}
+
+func TestGenerateModulePermissionManifest(t *testing.T) {
+	writer := newMemoryModuleWriter()
+	require.NoError(t, GenerateModuleTo("facturas", writer))
+
+	var manifest PermissionManifest
+	require.NoError(t, json.Unmarshal([]byte(writer.files["internal/facturas/permissions.json"]), &manifest))
+	require.NoError(t, manifest.Validate())
+
+	assert.Equal(t, []ManifestPermission{
+		{Code: "facturass:access", Module: "facturass", Action: "access", Name: "Acceso a facturass", Description: "Permite acceso básico al módulo de facturass"},
+		{Code: "facturass:read", Module: "facturass", Action: "read", Name: "Ver facturass", Description: "Permite ver facturass"},
+		{Code: "facturass:write", Module: "facturass", Action: "write", Name: "Gestionar facturass", Description: "Permite crear y modificar facturass"},
+		{Code: "facturass:delete", Module: "facturass", Action: "delete", Name: "Eliminar facturass", Description: "Permite eliminar facturass"},
+	}, manifest.Permissions)
+	assert.Empty(t, manifest.Roles)
+
+	// El fragmento de main.go protege las rutas con el mismo código de acceso del manifiesto
+	assert.Contains(t, writer.files["internal/facturas/main_fragment.go.txt"], `RequirePermission("facturass:access")`)
+	assert.Contains(t, writer.files["internal/facturas/main_fragment.go.txt"], "cmd/permission-manifest apply internal/facturas/permissions.json")
+}
+
+func TestGenerateModuleToErrors(t *testing.T) {
+	t.Run("nombre vacío", func(t *testing.T) {
+		writer := newMemoryModuleWriter()
+		assert.Error(t, GenerateModuleTo("   ", writer))
+		assert.Empty(t, writer.dirs)
+	})
+
+	t.Run("nombre no válido", func(t *testing.T) {
+		writer := newMemoryModuleWriter()
+		assert.ErrorIs(t, GenerateModuleTo("mi modulo", writer), ErrInvalidModuleName)
+		// No se crea ningún directorio ni archivo
+		assert.Empty(t, writer.dirs)
+		assert.Empty(t, writer.files)
+	})
+
+	t.Run("fallo de escritura", func(t *testing.T) {
+		writer := newMemoryModuleWriter()
+		writer.err = errors.New("disco lleno")
+		err := GenerateModuleTo("facturas", writer)
+		assert.ErrorIs(t, err, writer.err)
+	})
+}
+
+func TestCanonicalModuleName(t *testing.T) {
+	valid := map[string]string{
+		"facturas":       "facturas",
+		"  Facturas ":    "facturas",
+		"nuevo_modulo":   "nuevo_modulo",
+		"inventario2":    "inventario2",
+		"ORDEN_COMPRA_2": "orden_compra_2",
+	}
+	for input, want := range valid {
+		t.Run(input, func(t *testing.T) {
+			name, err := CanonicalModuleName(input)
+			require.NoError(t, err)
+			assert.Equal(t, want, name)
+		})
+	}
+
+	invalid := map[string]string{
+		"":           "vacío",
+		"   ":        "vacío",
+		"mi modulo":  "sin espacios",
+		"mi-modulo":  "sin espacios ni guiones",
+		"2facturas":  "empezar por una letra",
+		"_facturas":  "empezar por una letra",
+		"facturas_":  "guiones bajos simples",
+		"mi__modulo": "guiones bajos simples",
+		"factüras":   "solo letras",
+		"type":       "palabra reservada",
+		"Func":       "palabra reservada",
+		"string":     "predeclarado",
+		"error":      "predeclarado",
+		"time":       "paquete",
+		"domain":     "paquete",
+	}
+	for input, reason := range invalid {
+		t.Run(input, func(t *testing.T) {
+			_, err := CanonicalModuleName(input)
+			assert.ErrorIs(t, err, ErrInvalidModuleName)
+			assert.ErrorContains(t, err, reason)
+		})
+	}
+}
+
+func TestOSModuleWriterUsesRoot(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, GenerateModuleTo("facturas", OSModuleWriter{Root: root}))
+
+	content, err := os.ReadFile(filepath.Join(root, "internal", "facturas", "domain", "facturas.domain.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "package domain")
+}
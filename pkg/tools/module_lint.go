@@ -0,0 +1,88 @@
+// pkg/tools/module_lint.go
+// Detecta los módulos generados que aún contienen los marcadores de campos pendientes
+
+package tools
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ModulePlaceholder es el comentario que el generador de módulos deja donde faltan campos
+const ModulePlaceholder = "Añade aquí tus campos específicos"
+
+// PlaceholderFinding indica un archivo que aún contiene marcadores y en qué líneas
+type PlaceholderFinding struct {
+	Module string `json:"module"`
+	File   string `json:"file"`
+	Lines  []int  `json:"lines"`
+}
+
+// FindModulePlaceholders recorre los archivos Go de internal/* en fsys y retorna los que
+// contienen ModulePlaceholder, ordenados por ruta. fsys suele ser os.DirFS de la raíz del proyecto.
+func FindModulePlaceholders(fsys fs.FS) ([]PlaceholderFinding, error) {
+	findings := []PlaceholderFinding{}
+
+	err := fs.WalkDir(fsys, "internal", func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(filePath, ".go") {
+			return nil
+		}
+
+		lines, err := placeholderLines(fsys, filePath)
+		if err != nil {
+			return fmt.Errorf("error al leer %s: %w", filePath, err)
+		}
+		if len(lines) > 0 {
+			// internal/<módulo>/...
+			module := strings.SplitN(filePath, "/", 3)[1]
+			findings = append(findings, PlaceholderFinding{Module: module, File: filePath, Lines: lines})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(findings, func(i, j int) bool { return findings[i].File < findings[j].File })
+	return findings, nil
+}
+
+// PlaceholderModules retorna los módulos distintos con marcadores pendientes, ordenados
+func PlaceholderModules(findings []PlaceholderFinding) []string {
+	seen := make(map[string]bool)
+	modules := []string{}
+	for _, f := range findings {
+		if !seen[f.Module] {
+			seen[f.Module] = true
+			modules = append(modules, f.Module)
+		}
+	}
+	sort.Strings(modules)
+	return modules
+}
+
+// placeholderLines retorna los números de línea (desde 1) de los comentarios con el marcador
+func placeholderLines(fsys fs.FS, filePath string) ([]int, error) {
+	file, err := fsys.Open(path.Clean(filePath))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []int
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if idx := strings.Index(line, "//"); idx >= 0 && strings.Contains(line[idx:], ModulePlaceholder) {
+			lines = append(lines, n)
+		}
+	}
+	return lines, scanner.Err()
+}
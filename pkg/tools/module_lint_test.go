@@ -0,0 +1,59 @@
+package tools
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindModulePlaceholders(t *testing.T) {
+	t.Run("árbol de ejemplo", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			// Módulo recién generado: marcadores en dominio y casos de uso
+			"internal/facturas/domain/facturas.domain.go":   {Data: []byte("package domain\n\ntype Facturas struct {\n\tName string\n\t// " + ModulePlaceholder + "\n}\n\ntype Otro struct {\n\t// " + ModulePlaceholder + "\n}\n")},
+			"internal/facturas/usecase/facturas.usecase.go": {Data: []byte("package usecase\n\t\t// " + ModulePlaceholder + "\n")},
+			// El fragmento de main.go no es código Go del módulo
+			"internal/facturas/main_fragment.go.txt": {Data: []byte("// " + ModulePlaceholder + "\n")},
+			// Módulo completado
+			"internal/user/domain/user.domain.go": {Data: []byte("package domain\n\ntype User struct{}\n")},
+			// El texto fuera de un comentario no cuenta
+			"internal/notas/domain/notas.domain.go": {Data: []byte("package domain\n\nconst ayuda = \"" + ModulePlaceholder + "\"\n")},
+			// Fuera de internal/ no se revisa
+			"pkg/tools/module_generator.go": {Data: []byte("// " + ModulePlaceholder + "\n")},
+		}
+
+		findings, err := FindModulePlaceholders(fsys)
+		require.NoError(t, err)
+		assert.Equal(t, []PlaceholderFinding{
+			{Module: "facturas", File: "internal/facturas/domain/facturas.domain.go", Lines: []int{5, 9}},
+			{Module: "facturas", File: "internal/facturas/usecase/facturas.usecase.go", Lines: []int{2}},
+		}, findings)
+		assert.Equal(t, []string{"facturas"}, PlaceholderModules(findings))
+	})
+
+	t.Run("módulo generado", func(t *testing.T) {
+		writer := newMemoryModuleWriter()
+		require.NoError(t, GenerateModuleTo("facturas", writer))
+		fsys := fstest.MapFS{}
+		for path, content := range writer.files {
+			fsys[path] = &fstest.MapFile{Data: []byte(content)}
+		}
+
+		findings, err := FindModulePlaceholders(fsys)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"facturas"}, PlaceholderModules(findings))
+		require.Len(t, findings, 2)
+		assert.Equal(t, "internal/facturas/domain/facturas.domain.go", findings[0].File)
+		assert.Equal(t, "internal/facturas/usecase/facturas.usecase.go", findings[1].File)
+	})
+
+	t.Run("sin módulos pendientes", func(t *testing.T) {
+		findings, err := FindModulePlaceholders(fstest.MapFS{
+			"internal/user/domain/user.domain.go": {Data: []byte("package domain\n")},
+		})
+		require.NoError(t, err)
+		assert.Empty(t, findings)
+	})
+}
@@ -0,0 +1,53 @@
+// pkg/tools/module_name.go
+// Validación y forma canónica de los nombres de módulo del generador
+
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	"go/types"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidModuleName se retorna (envuelto junto con el motivo) cuando un nombre no sirve
+// para generar un módulo
+var ErrInvalidModuleName = errors.New("nombre de módulo no válido")
+
+// moduleNamePattern admite letras minúsculas, dígitos y guiones bajos simples, empezando por
+// letra, para que el nombre sea a la vez directorio, identificador de Go y módulo de permisos
+var moduleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+
+// templatePackages son los paquetes que importan los archivos generados. Las plantillas usan el
+// nombre del módulo como variable, que ocultaría al paquete del mismo nombre.
+var templatePackages = map[string]bool{
+	"assert": true, "bson": true, "context": true, "delivery": true, "domain": true,
+	"errors": true, "fmt": true, "gin": true, "http": true, "httptest": true, "json": true,
+	"mongo": true, "options": true, "primitive": true, "strings": true, "testing": true,
+	"time": true, "utils": true,
+}
+
+// CanonicalModuleName retorna el nombre del módulo en minúsculas y sin espacios alrededor, o
+// ErrInvalidModuleName si no es un identificador de Go válido (ej. "mi modulo", "mi-modulo",
+// "2facturas"), es una palabra reservada o un identificador predeclarado de Go (ej. "type",
+// "string") o coincide con un paquete que importan los archivos generados (ej. "time").
+func CanonicalModuleName(moduleName string) (string, error) {
+	name := strings.ToLower(strings.TrimSpace(moduleName))
+
+	switch {
+	case name == "":
+		return "", fmt.Errorf("%w: el nombre del módulo no puede estar vacío", ErrInvalidModuleName)
+	case !moduleNamePattern.MatchString(name):
+		return "", fmt.Errorf("%w: %q debe empezar por una letra y contener solo letras, dígitos y guiones bajos simples (sin espacios ni guiones)", ErrInvalidModuleName, moduleName)
+	case token.IsKeyword(name):
+		return "", fmt.Errorf("%w: %q es una palabra reservada de Go", ErrInvalidModuleName, name)
+	case types.Universe.Lookup(name) != nil:
+		return "", fmt.Errorf("%w: %q es un identificador predeclarado de Go", ErrInvalidModuleName, name)
+	case templatePackages[name]:
+		return "", fmt.Errorf("%w: %q coincide con un paquete que importa el módulo generado", ErrInvalidModuleName, name)
+	}
+
+	return name, nil
+}
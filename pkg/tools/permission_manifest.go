@@ -0,0 +1,357 @@
+// pkg/tools/permission_manifest.go
+// Manifiesto declarativo de permisos y roles, y comparación contra el estado en la base de datos
+
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	permDomain "github.com/black4ninja/mi-proyecto/internal/permission/domain"
+)
+
+// PermissionManifest describe el estado deseado de permisos y roles
+type PermissionManifest struct {
+	Permissions []ManifestPermission `json:"permissions"`
+	Roles       []ManifestRole       `json:"roles"`
+}
+
+// ManifestPermission representa un permiso declarado en el manifiesto
+type ManifestPermission struct {
+	Code        string `json:"code"`
+	Module      string `json:"module"`
+	Action      string `json:"action"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// ManifestRole representa un rol declarado en el manifiesto
+type ManifestRole struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// FieldChange describe un campo cuyo valor en la base de datos difiere del declarado
+type FieldChange struct {
+	Field    string      `json:"field"`
+	Live     interface{} `json:"live"`
+	Declared interface{} `json:"declared"`
+}
+
+// EntryDiff agrupa los cambios de una entrada existente (permiso por código, rol por nombre)
+type EntryDiff struct {
+	Key     string        `json:"key"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// SectionDiff contiene las diferencias de una sección del manifiesto.
+// Added son entradas declaradas que no existen en la base de datos;
+// Removed son entradas de la base de datos que el manifiesto no declara.
+type SectionDiff struct {
+	Added    []string    `json:"added"`
+	Removed  []string    `json:"removed"`
+	Modified []EntryDiff `json:"modified"`
+}
+
+// ManifestDiff es el resultado de comparar el manifiesto con el estado actual
+type ManifestDiff struct {
+	InSync      bool        `json:"in_sync"`
+	Permissions SectionDiff `json:"permissions"`
+	Roles       SectionDiff `json:"roles"`
+}
+
+// LoadPermissionManifest lee y valida un manifiesto en formato JSON
+func LoadPermissionManifest(path string) (*PermissionManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error al leer el manifiesto %s: %w", path, err)
+	}
+
+	var manifest PermissionManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("error al interpretar el manifiesto %s: %w", path, err)
+	}
+
+	if err := manifest.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &manifest, nil
+}
+
+// Validate verifica que el manifiesto no tenga entradas vacías ni duplicadas y que los códigos sigan la convención
+func (m *PermissionManifest) Validate() error {
+	codes := make(map[string]bool)
+	for _, p := range m.Permissions {
+		if p.Code == "" {
+			return fmt.Errorf("el manifiesto contiene un permiso sin código")
+		}
+		if err := permDomain.ValidatePermissionCode(p.Code); err != nil {
+			return err
+		}
+		if codes[p.Code] {
+			return fmt.Errorf("el permiso %s está declarado más de una vez", p.Code)
+		}
+		codes[p.Code] = true
+	}
+
+	names := make(map[string]bool)
+	for _, r := range m.Roles {
+		if r.Name == "" {
+			return fmt.Errorf("el manifiesto contiene un rol sin nombre")
+		}
+		if names[r.Name] {
+			return fmt.Errorf("el rol %s está declarado más de una vez", r.Name)
+		}
+		names[r.Name] = true
+	}
+
+	return nil
+}
+
+// DiffPermissionState obtiene los permisos y roles actuales de los repositorios y los compara con el manifiesto
+func DiffPermissionState(
+	manifest *PermissionManifest,
+	permissionRepo permDomain.PermissionRepository,
+	roleRepo permDomain.RoleRepository,
+) (*ManifestDiff, error) {
+	permissions, err := permissionRepo.GetAll(nil)
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener permisos: %w", err)
+	}
+
+	roles, err := roleRepo.GetAll(nil)
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener roles: %w", err)
+	}
+
+	return DiffPermissionManifest(manifest, permissions, roles), nil
+}
+
+// DiffPermissionManifest compara el manifiesto con los permisos y roles existentes sin modificar nada
+func DiffPermissionManifest(
+	manifest *PermissionManifest,
+	permissions []*permDomain.Permission,
+	roles []*permDomain.Role,
+) *ManifestDiff {
+	diff := &ManifestDiff{
+		Permissions: SectionDiff{Added: []string{}, Removed: []string{}, Modified: []EntryDiff{}},
+		Roles:       SectionDiff{Added: []string{}, Removed: []string{}, Modified: []EntryDiff{}},
+	}
+
+	// Permisos
+	livePermissions := make(map[string]*permDomain.Permission, len(permissions))
+	for _, p := range permissions {
+		livePermissions[p.Code] = p
+	}
+	declaredPermissions := make(map[string]bool, len(manifest.Permissions))
+	for _, declared := range manifest.Permissions {
+		declaredPermissions[declared.Code] = true
+
+		live, ok := livePermissions[declared.Code]
+		if !ok {
+			diff.Permissions.Added = append(diff.Permissions.Added, declared.Code)
+			continue
+		}
+
+		var changes []FieldChange
+		changes = appendChange(changes, "module", live.Module, declared.Module)
+		changes = appendChange(changes, "action", live.Action, declared.Action)
+		changes = appendChange(changes, "name", live.Name, declared.Name)
+		changes = appendChange(changes, "description", live.Description, declared.Description)
+		if len(changes) > 0 {
+			diff.Permissions.Modified = append(diff.Permissions.Modified, EntryDiff{Key: declared.Code, Changes: changes})
+		}
+	}
+	for code := range livePermissions {
+		if !declaredPermissions[code] {
+			diff.Permissions.Removed = append(diff.Permissions.Removed, code)
+		}
+	}
+
+	// Roles
+	liveRoles := make(map[string]*permDomain.Role, len(roles))
+	for _, r := range roles {
+		liveRoles[r.Name] = r
+	}
+	declaredRoles := make(map[string]bool, len(manifest.Roles))
+	for _, declared := range manifest.Roles {
+		declaredRoles[declared.Name] = true
+
+		live, ok := liveRoles[declared.Name]
+		if !ok {
+			diff.Roles.Added = append(diff.Roles.Added, declared.Name)
+			continue
+		}
+
+		var changes []FieldChange
+		changes = appendChange(changes, "description", live.Description, declared.Description)
+		livePerms, declaredPerms := sortedUnique(live.Permissions), sortedUnique(declared.Permissions)
+		if !equalStrings(livePerms, declaredPerms) {
+			changes = append(changes, FieldChange{Field: "permissions", Live: livePerms, Declared: declaredPerms})
+		}
+		if len(changes) > 0 {
+			diff.Roles.Modified = append(diff.Roles.Modified, EntryDiff{Key: declared.Name, Changes: changes})
+		}
+	}
+	for name := range liveRoles {
+		if !declaredRoles[name] {
+			diff.Roles.Removed = append(diff.Roles.Removed, name)
+		}
+	}
+
+	// Orden estable para que la salida sea comparable entre ejecuciones
+	diff.Permissions.sort()
+	diff.Roles.sort()
+
+	diff.InSync = diff.Permissions.empty() && diff.Roles.empty()
+	return diff
+}
+
+// ApplyResult lista las entradas creadas al aplicar un manifiesto
+type ApplyResult struct {
+	CreatedPermissions []string `json:"created_permissions"`
+	CreatedRoles       []string `json:"created_roles"`
+}
+
+// ApplyPermissionManifest crea los permisos y roles declarados que aún no existen.
+// Es aditivo: no modifica ni elimina entradas existentes, por lo que puede aplicarse
+// el manifiesto parcial de un módulo sin afectar al resto. Si recorder no es nil, cada
+// entrada creada se registra con SystemActor; si el registro falla se detiene con un error
+// que envuelve ErrAuditFailed.
+func ApplyPermissionManifest(
+	manifest *PermissionManifest,
+	permissionRepo permDomain.PermissionRepository,
+	roleRepo permDomain.RoleRepository,
+	recorder permDomain.PermissionChangeRecorder,
+) (*ApplyResult, error) {
+	diff, err := DiffPermissionState(manifest, permissionRepo, roleRepo)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ApplyResult{CreatedPermissions: []string{}, CreatedRoles: []string{}}
+	missingPermissions := make(map[string]bool, len(diff.Permissions.Added))
+	for _, code := range diff.Permissions.Added {
+		missingPermissions[code] = true
+	}
+	missingRoles := make(map[string]bool, len(diff.Roles.Added))
+	for _, name := range diff.Roles.Added {
+		missingRoles[name] = true
+	}
+
+	now := time.Now()
+	for _, declared := range manifest.Permissions {
+		if !missingPermissions[declared.Code] {
+			continue
+		}
+		permission := &permDomain.Permission{
+			Code:        declared.Code,
+			Module:      declared.Module,
+			Action:      declared.Action,
+			Name:        declared.Name,
+			Description: declared.Description,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		if err := permissionRepo.Create(permission); err != nil {
+			return result, fmt.Errorf("error al crear el permiso %s: %w", declared.Code, err)
+		}
+		result.CreatedPermissions = append(result.CreatedPermissions, declared.Code)
+		if err := recordManifestChange(recorder, permDomain.ChangePermissionCreate, "permission:"+declared.Code, ""); err != nil {
+			return result, err
+		}
+	}
+
+	for _, declared := range manifest.Roles {
+		if !missingRoles[declared.Name] {
+			continue
+		}
+		role := &permDomain.Role{
+			Name:        declared.Name,
+			Description: declared.Description,
+			Permissions: sortedUnique(declared.Permissions),
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		if err := roleRepo.Create(role); err != nil {
+			return result, fmt.Errorf("error al crear el rol %s: %w", declared.Name, err)
+		}
+		result.CreatedRoles = append(result.CreatedRoles, declared.Name)
+		if err := recordManifestChange(recorder, permDomain.ChangeRoleCreate, "role:"+role.ID.Hex(), "name="+role.Name); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// recordManifestChange registra con SystemActor una entrada creada por el manifiesto
+func recordManifestChange(recorder permDomain.PermissionChangeRecorder, action, target, details string) error {
+	if recorder == nil {
+		return nil
+	}
+	err := recorder.RecordPermissionChange(&permDomain.PermissionChange{
+		ActorID: permDomain.SystemActor,
+		Action:  action,
+		Target:  target,
+		Details: details,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: action=%s target=%s: %w", permDomain.ErrAuditFailed, action, target, err)
+	}
+	return nil
+}
+
+// HasDrift indica si el estado actual difiere del manifiesto
+func (d *ManifestDiff) HasDrift() bool {
+	return !d.InSync
+}
+
+func (s *SectionDiff) sort() {
+	sort.Strings(s.Added)
+	sort.Strings(s.Removed)
+	sort.Slice(s.Modified, func(i, j int) bool { return s.Modified[i].Key < s.Modified[j].Key })
+}
+
+func (s *SectionDiff) empty() bool {
+	return len(s.Added) == 0 && len(s.Removed) == 0 && len(s.Modified) == 0
+}
+
+// appendChange agrega un cambio si el valor actual difiere del declarado
+func appendChange(changes []FieldChange, field, live, declared string) []FieldChange {
+	if live == declared {
+		return changes
+	}
+	return append(changes, FieldChange{Field: field, Live: live, Declared: declared})
+}
+
+// sortedUnique retorna una copia ordenada y sin duplicados de la lista
+func sortedUnique(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
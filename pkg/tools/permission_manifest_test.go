@@ -0,0 +1,257 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	permDomain "github.com/black4ninja/mi-proyecto/internal/permission/domain"
+)
+
+func testManifest() *PermissionManifest {
+	return &PermissionManifest{
+		Permissions: []ManifestPermission{
+			{Code: "admin:users", Module: "admin", Action: "users", Name: "Administrar usuarios"},
+			{Code: "finanzas:read", Module: "finanzas", Action: "read", Name: "Ver finanzas"},
+		},
+		Roles: []ManifestRole{
+			{Name: "Administrador", Description: "Acceso completo", Permissions: []string{"admin:users", "finanzas:read"}},
+		},
+	}
+}
+
+func TestDiffPermissionManifestInSync(t *testing.T) {
+	permissions := []*permDomain.Permission{
+		{Code: "finanzas:read", Module: "finanzas", Action: "read", Name: "Ver finanzas"},
+		{Code: "admin:users", Module: "admin", Action: "users", Name: "Administrar usuarios"},
+	}
+	roles := []*permDomain.Role{
+		// El orden de los permisos del rol no se considera una diferencia
+		{Name: "Administrador", Description: "Acceso completo", Permissions: []string{"finanzas:read", "admin:users"}},
+	}
+
+	diff := DiffPermissionManifest(testManifest(), permissions, roles)
+
+	assert.True(t, diff.InSync)
+	assert.False(t, diff.HasDrift())
+	assert.Empty(t, diff.Permissions.Added)
+	assert.Empty(t, diff.Roles.Modified)
+}
+
+func TestDiffPermissionManifestDetectsDrift(t *testing.T) {
+	permissions := []*permDomain.Permission{
+		// Nombre modificado manualmente
+		{Code: "admin:users", Module: "admin", Action: "users", Name: "Usuarios"},
+		// Permiso creado manualmente, ausente del manifiesto
+		{Code: "debug:all", Module: "debug", Action: "all", Name: "Depuración"},
+		// finanzas:read aún no aplicado
+	}
+	roles := []*permDomain.Role{
+		{Name: "Administrador", Description: "Acceso completo", Permissions: []string{"admin:users", "debug:all"}},
+		{Name: "Soporte", Description: "Creado a mano"},
+	}
+
+	diff := DiffPermissionManifest(testManifest(), permissions, roles)
+
+	assert.False(t, diff.InSync)
+	assert.Equal(t, []string{"finanzas:read"}, diff.Permissions.Added)
+	assert.Equal(t, []string{"debug:all"}, diff.Permissions.Removed)
+	require.Len(t, diff.Permissions.Modified, 1)
+	assert.Equal(t, EntryDiff{
+		Key:     "admin:users",
+		Changes: []FieldChange{{Field: "name", Live: "Usuarios", Declared: "Administrar usuarios"}},
+	}, diff.Permissions.Modified[0])
+
+	assert.Empty(t, diff.Roles.Added)
+	assert.Equal(t, []string{"Soporte"}, diff.Roles.Removed)
+	require.Len(t, diff.Roles.Modified, 1)
+	assert.Equal(t, "Administrador", diff.Roles.Modified[0].Key)
+	assert.Equal(t, []FieldChange{{
+		Field:    "permissions",
+		Live:     []string{"admin:users", "debug:all"},
+		Declared: []string{"admin:users", "finanzas:read"},
+	}}, diff.Roles.Modified[0].Changes)
+}
+
+func TestManifestDiffJSONShape(t *testing.T) {
+	diff := DiffPermissionManifest(testManifest(), nil, nil)
+
+	data, err := json.Marshal(diff)
+	require.NoError(t, err)
+
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, false, decoded["in_sync"])
+
+	// Las listas vacías se serializan como [] y no como null
+	roles := decoded["roles"].(map[string]interface{})
+	assert.Equal(t, []interface{}{}, roles["removed"])
+	assert.Equal(t, []interface{}{"Administrador"}, roles["added"])
+}
+
+// fakePermissionRepository y fakeRoleRepository solo implementan GetAll y Create;
+// el resto de métodos entra en pánico a través de la interfaz embebida
+type fakePermissionRepository struct {
+	permDomain.PermissionRepository
+	permissions []*permDomain.Permission
+	err         error
+	createErr   error
+}
+
+func (f *fakePermissionRepository) GetAll(params map[string]interface{}) ([]*permDomain.Permission, error) {
+	return f.permissions, f.err
+}
+
+func (f *fakePermissionRepository) Create(permission *permDomain.Permission) error {
+	if f.createErr != nil {
+		return f.createErr
+	}
+	f.permissions = append(f.permissions, permission)
+	return nil
+}
+
+type fakeRoleRepository struct {
+	permDomain.RoleRepository
+	roles []*permDomain.Role
+}
+
+func (f *fakeRoleRepository) GetAll(params map[string]interface{}) ([]*permDomain.Role, error) {
+	return f.roles, nil
+}
+
+func (f *fakeRoleRepository) Create(role *permDomain.Role) error {
+	role.ID = primitive.NewObjectID()
+	f.roles = append(f.roles, role)
+	return nil
+}
+
+func TestDiffPermissionState(t *testing.T) {
+	t.Run("consulta los repositorios", func(t *testing.T) {
+		diff, err := DiffPermissionState(testManifest(),
+			&fakePermissionRepository{permissions: []*permDomain.Permission{{Code: "extra"}}},
+			&fakeRoleRepository{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"extra"}, diff.Permissions.Removed)
+		assert.Equal(t, []string{"admin:users", "finanzas:read"}, diff.Permissions.Added)
+	})
+
+	t.Run("propaga errores del repositorio", func(t *testing.T) {
+		cause := errors.New("sin conexión")
+		_, err := DiffPermissionState(testManifest(), &fakePermissionRepository{err: cause}, &fakeRoleRepository{})
+		assert.ErrorIs(t, err, cause)
+	})
+}
+
+func TestApplyPermissionManifest(t *testing.T) {
+	t.Run("crea solo las entradas faltantes", func(t *testing.T) {
+		permissionRepo := &fakePermissionRepository{permissions: []*permDomain.Permission{
+			// Existente con otro nombre: apply no lo modifica
+			{Code: "admin:users", Module: "admin", Action: "users", Name: "Usuarios"},
+			// No declarado: apply no lo elimina
+			{Code: "debug:all", Module: "debug", Action: "all"},
+		}}
+		roleRepo := &fakeRoleRepository{}
+
+		result, err := ApplyPermissionManifest(testManifest(), permissionRepo, roleRepo, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"finanzas:read"}, result.CreatedPermissions)
+		assert.Equal(t, []string{"Administrador"}, result.CreatedRoles)
+
+		require.Len(t, permissionRepo.permissions, 3)
+		assert.Equal(t, "Usuarios", permissionRepo.permissions[0].Name)
+		created := permissionRepo.permissions[2]
+		assert.Equal(t, "finanzas", created.Module)
+		assert.Equal(t, "Ver finanzas", created.Name)
+		assert.False(t, created.CreatedAt.IsZero())
+
+		require.Len(t, roleRepo.roles, 1)
+		assert.Equal(t, []string{"admin:users", "finanzas:read"}, roleRepo.roles[0].Permissions)
+
+		// Una segunda aplicación no crea nada
+		result, err = ApplyPermissionManifest(testManifest(), permissionRepo, roleRepo, nil)
+		require.NoError(t, err)
+		assert.Empty(t, result.CreatedPermissions)
+		assert.Empty(t, result.CreatedRoles)
+	})
+
+	t.Run("manifiesto generado para un módulo", func(t *testing.T) {
+		permissionRepo := &fakePermissionRepository{}
+		result, err := ApplyPermissionManifest(ModulePermissionManifest("factura"), permissionRepo, &fakeRoleRepository{}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"facturas:access", "facturas:read", "facturas:write", "facturas:delete"}, result.CreatedPermissions)
+	})
+
+	t.Run("propaga errores de creación", func(t *testing.T) {
+		cause := errors.New("sin conexión")
+		_, err := ApplyPermissionManifest(testManifest(), &fakePermissionRepository{createErr: cause}, &fakeRoleRepository{}, nil)
+		assert.ErrorIs(t, err, cause)
+	})
+
+	t.Run("registra cada entrada creada como cambio del sistema", func(t *testing.T) {
+		var changes []*permDomain.PermissionChange
+		recorder := permDomain.PermissionChangeRecorderFunc(func(change *permDomain.PermissionChange) error {
+			changes = append(changes, change)
+			return nil
+		})
+		permissionRepo := &fakePermissionRepository{permissions: []*permDomain.Permission{{Code: "admin:users"}}}
+		roleRepo := &fakeRoleRepository{}
+
+		_, err := ApplyPermissionManifest(testManifest(), permissionRepo, roleRepo, recorder)
+		require.NoError(t, err)
+		require.Len(t, roleRepo.roles, 1)
+		assert.Equal(t, []*permDomain.PermissionChange{
+			{ActorID: permDomain.SystemActor, Action: permDomain.ChangePermissionCreate, Target: "permission:finanzas:read"},
+			{ActorID: permDomain.SystemActor, Action: permDomain.ChangeRoleCreate, Target: "role:" + roleRepo.roles[0].ID.Hex(), Details: "name=Administrador"},
+		}, changes)
+	})
+
+	t.Run("se detiene si el registro falla", func(t *testing.T) {
+		recorder := permDomain.PermissionChangeRecorderFunc(func(*permDomain.PermissionChange) error {
+			return errors.New("sin conexión")
+		})
+		roleRepo := &fakeRoleRepository{}
+
+		result, err := ApplyPermissionManifest(testManifest(), &fakePermissionRepository{}, roleRepo, recorder)
+		assert.ErrorIs(t, err, permDomain.ErrAuditFailed)
+		assert.Equal(t, []string{"admin:users"}, result.CreatedPermissions)
+		assert.Empty(t, roleRepo.roles)
+	})
+}
+
+func TestLoadPermissionManifest(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("manifiesto válido", func(t *testing.T) {
+		path := filepath.Join(dir, "valido.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{
+			"permissions": [{"code": "admin:users", "module": "admin", "action": "users", "name": "Usuarios"}],
+			"roles": [{"name": "Administrador", "permissions": ["admin:users"]}]
+		}`), 0644))
+
+		manifest, err := LoadPermissionManifest(path)
+		require.NoError(t, err)
+		assert.Len(t, manifest.Permissions, 1)
+		assert.Equal(t, []string{"admin:users"}, manifest.Roles[0].Permissions)
+	})
+
+	t.Run("códigos duplicados", func(t *testing.T) {
+		path := filepath.Join(dir, "duplicado.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{
+			"permissions": [{"code": "admin:users"}, {"code": "admin:users"}]
+		}`), 0644))
+
+		_, err := LoadPermissionManifest(path)
+		assert.Error(t, err)
+	})
+
+	t.Run("archivo inexistente", func(t *testing.T) {
+		_, err := LoadPermissionManifest(filepath.Join(dir, "no-existe.json"))
+		assert.Error(t, err)
+	})
+}
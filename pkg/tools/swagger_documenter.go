@@ -121,7 +121,9 @@ func addSwaggerComments(content, moduleName string) (string, error) {
 // @Produce json
 // @Param status query string false "Estado del %s (active, inactive, archived)"
 // @Param name query string false "Nombre del %s (búsqueda parcial)"
+// @Param sort query string false "Campos de orden separados por coma, con - para descendente (name, status, created_at, updated_at)"
 // @Success 200 {object} utils.Response{data=[]domain.%sResponse} "Lista de %ss"
+// @Failure 400 {object} utils.Response "Campo de orden no permitido"
 // @Failure 500 {object} utils.Response "Error interno"
 // @Router /%ss [get]
 // @Security BearerAuth`, moduleName, moduleName, moduleName, moduleName, moduleName, moduleTitle, moduleName, moduleName),
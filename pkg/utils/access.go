@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessDenialMode define cómo se responde cuando el usuario autenticado no puede acceder a un
+// recurso: con 403 se revela que el recurso existe, con 404 se oculta su existencia
+type AccessDenialMode int
+
+const (
+	AccessDenialForbidden AccessDenialMode = iota // 403 Forbidden
+	AccessDenialNotFound                          // 404 Not Found, igual que un recurso inexistente
+)
+
+// ResourceType agrupa los recursos que comparten la misma política de denegación
+type ResourceType string
+
+const (
+	ResourceAdmin ResourceType = "admin" // APIs administrativas protegidas por permiso
+	ResourceUser  ResourceType = "user"  // Recursos propios de un usuario (ej. /users/:id)
+)
+
+// ParseAccessDenialMode convierte "403"/"forbidden" o "404"/"not_found"/"hide" en un
+// AccessDenialMode. Un valor vacío o desconocido retorna fallback.
+func ParseAccessDenialMode(value string, fallback AccessDenialMode) AccessDenialMode {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "403", "forbidden":
+		return AccessDenialForbidden
+	case "404", "not_found", "notfound", "hide":
+		return AccessDenialNotFound
+	default:
+		return fallback
+	}
+}
+
+// AccessPolicy asigna a cada tipo de recurso su modo de denegación
+type AccessPolicy struct {
+	modes map[ResourceType]AccessDenialMode
+}
+
+// NewAccessPolicy crea la política por defecto: 403 para las APIs administrativas y
+// 404 para los recursos de usuario. Los tipos no configurados responden 403.
+func NewAccessPolicy() *AccessPolicy {
+	return &AccessPolicy{
+		modes: map[ResourceType]AccessDenialMode{
+			ResourceAdmin: AccessDenialForbidden,
+			ResourceUser:  AccessDenialNotFound,
+		},
+	}
+}
+
+// Set configura el modo de denegación de un tipo de recurso
+func (p *AccessPolicy) Set(resource ResourceType, mode AccessDenialMode) {
+	p.modes[resource] = mode
+}
+
+// Mode retorna el modo de denegación de un tipo de recurso. Una política nil se comporta
+// como la política por defecto.
+func (p *AccessPolicy) Mode(resource ResourceType) AccessDenialMode {
+	if p == nil {
+		p = NewAccessPolicy()
+	}
+	return p.modes[resource]
+}
+
+// DeniedResponse responde a un acceso denegado según la política del recurso: 403 con
+// forbiddenMsg o 404 con notFoundMsg. notFoundMsg debe coincidir con el mensaje que recibe
+// el cliente cuando el recurso no existe, para que ambas respuestas sean indistinguibles.
+func (p *AccessPolicy) DeniedResponse(c *gin.Context, resource ResourceType, forbiddenMsg, notFoundMsg string) {
+	if p.Mode(resource) == AccessDenialNotFound {
+		ErrorResponse(c, http.StatusNotFound, notFoundMsg)
+		return
+	}
+	ErrorResponse(c, http.StatusForbidden, forbiddenMsg)
+}
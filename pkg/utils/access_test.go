@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAccessDenialMode(t *testing.T) {
+	assert.Equal(t, AccessDenialForbidden, ParseAccessDenialMode("403", AccessDenialNotFound))
+	assert.Equal(t, AccessDenialForbidden, ParseAccessDenialMode("Forbidden", AccessDenialNotFound))
+	assert.Equal(t, AccessDenialNotFound, ParseAccessDenialMode(" 404 ", AccessDenialForbidden))
+	assert.Equal(t, AccessDenialNotFound, ParseAccessDenialMode("hide", AccessDenialForbidden))
+	assert.Equal(t, AccessDenialNotFound, ParseAccessDenialMode("", AccessDenialNotFound))
+	assert.Equal(t, AccessDenialForbidden, ParseAccessDenialMode("desconocido", AccessDenialForbidden))
+}
+
+func TestAccessPolicyDeniedResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	respond := func(policy *AccessPolicy, resource ResourceType) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		policy.DeniedResponse(c, resource, "acceso denegado", "recurso no encontrado")
+		return w
+	}
+
+	t.Run("política por defecto", func(t *testing.T) {
+		policy := NewAccessPolicy()
+		assert.Equal(t, http.StatusForbidden, respond(policy, ResourceAdmin).Code)
+		w := respond(policy, ResourceUser)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "recurso no encontrado")
+		assert.Equal(t, http.StatusForbidden, respond(policy, ResourceType("otro")).Code)
+	})
+
+	t.Run("modos configurados", func(t *testing.T) {
+		policy := NewAccessPolicy()
+		policy.Set(ResourceAdmin, AccessDenialNotFound)
+		policy.Set(ResourceUser, AccessDenialForbidden)
+		assert.Equal(t, http.StatusNotFound, respond(policy, ResourceAdmin).Code)
+		w := respond(policy, ResourceUser)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "acceso denegado")
+	})
+
+	t.Run("una política nil usa los valores por defecto", func(t *testing.T) {
+		var policy *AccessPolicy
+		assert.Equal(t, http.StatusNotFound, respond(policy, ResourceUser).Code)
+	})
+}
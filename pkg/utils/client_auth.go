@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// ClientBasicAuth obtiene client_id y client_secret del encabezado Authorization: Basic.
+// Según RFC 6749 §2.3.1 ambos valores se codifican como application/x-www-form-urlencoded
+// antes de Base64, por lo que se decodifican aquí. Retorna false si el encabezado no
+// existe o está mal formado.
+func ClientBasicAuth(r *http.Request) (string, string, bool) {
+	rawID, rawSecret, ok := r.BasicAuth()
+	if !ok {
+		return "", "", false
+	}
+
+	clientID, err := url.QueryUnescape(rawID)
+	if err != nil || clientID == "" {
+		return "", "", false
+	}
+	clientSecret, err := url.QueryUnescape(rawSecret)
+	if err != nil {
+		return "", "", false
+	}
+
+	return clientID, clientSecret, true
+}
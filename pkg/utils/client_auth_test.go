@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientBasicAuth(t *testing.T) {
+	newRequest := func(header string) *http.Request {
+		req, _ := http.NewRequest("POST", "/oauth/token", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		return req
+	}
+	basic := func(credentials string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+	}
+
+	clientID, secret, ok := ClientBasicAuth(newRequest(basic("cliente:secreto")))
+	assert.True(t, ok)
+	assert.Equal(t, "cliente", clientID)
+	assert.Equal(t, "secreto", secret)
+
+	// Los valores llegan codificados como formulario (RFC 6749 §2.3.1)
+	clientID, secret, ok = ClientBasicAuth(newRequest(basic("mi%3Acliente:s%2Bcr%25to")))
+	assert.True(t, ok)
+	assert.Equal(t, "mi:cliente", clientID)
+	assert.Equal(t, "s+cr%to", secret)
+
+	for _, header := range []string{"", "Bearer token", basic(":secreto"), basic("cliente:%zz"), "Basic no-base64"} {
+		_, _, ok := ClientBasicAuth(newRequest(header))
+		assert.False(t, ok, header)
+	}
+}
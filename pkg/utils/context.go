@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserIDContextKey es la clave del contexto de Gin donde el middleware de autenticación guarda el ID del usuario
+const UserIDContextKey = "userID"
+
+// APIKeyIDContextKey es la clave del contexto de Gin donde el middleware de API keys guarda el ID
+// de la API key con la que se autenticó la petición. Solo existe en peticiones autenticadas con API key.
+const APIKeyIDContextKey = "apiKeyID"
+
+// RequestIDContextKey es la clave del contexto de Gin donde el middleware de registro de
+// peticiones guarda el ID de la petición (header X-Request-ID)
+const RequestIDContextKey = "requestID"
+
+// GrantedPermissionsContextKey es la clave del contexto de Gin donde el middleware de permisos
+// guarda los permisos que ya verificó y el usuario tiene, para que los handlers ajusten la
+// respuesta sin volver a consultarlos
+const GrantedPermissionsContextKey = "grantedPermissions"
+
+// HasGrantedPermission indica si el middleware de permisos verificó permissionCode para el
+// usuario de la petición. Un permiso no verificado en la ruta cuenta como no concedido.
+func HasGrantedPermission(c *gin.Context, permissionCode string) bool {
+	value, _ := c.Get(GrantedPermissionsContextKey)
+	granted, _ := value.([]string)
+	for _, code := range granted {
+		if code == permissionCode {
+			return true
+		}
+	}
+	return false
+}
+
+// MustUserID obtiene el ID del usuario autenticado del contexto.
+// Retorna false si no existe, no es un string o está vacío; el llamador decide la respuesta (normalmente 401).
+func MustUserID(c *gin.Context) (string, bool) {
+	return ClaimString(c, UserIDContextKey)
+}
+
+// ClaimString obtiene un claim de texto del contexto (ej. "role").
+// Retorna false si no existe, no es un string o está vacío, sin entrar en pánico por el tipo.
+func ClaimString(c *gin.Context, key string) (string, bool) {
+	value, exists := c.Get(key)
+	if !exists {
+		return "", false
+	}
+
+	text, ok := value.(string)
+	if !ok || text == "" {
+		return "", false
+	}
+
+	return text, true
+}
+
+// ClaimTime obtiene un claim de fecha (segundos Unix) del contexto (ej. "auth_time").
+// Los claims decodificados de un JWT llegan como float64.
+func ClaimTime(c *gin.Context, key string) (time.Time, bool) {
+	value, exists := c.Get(key)
+	if !exists {
+		return time.Time{}, false
+	}
+
+	switch v := value.(type) {
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case int64:
+		return time.Unix(v, 0), true
+	case json.Number:
+		seconds, err := v.Int64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(seconds, 0), true
+	}
+
+	return time.Time{}, false
+}
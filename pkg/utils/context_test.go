@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasGrantedPermission(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	assert.False(t, HasGrantedPermission(c, "admin:users"))
+
+	c.Set(GrantedPermissionsContextKey, []string{"admin:audit", "admin:users"})
+	assert.True(t, HasGrantedPermission(c, "admin:users"))
+	assert.False(t, HasGrantedPermission(c, "admin:*"))
+}
+
+func TestMustUserID(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  interface{}
+		set    bool
+		wantID string
+		wantOK bool
+	}{
+		{name: "presente", value: "60f1e5e5e5e5e5e5e5e5e5e5", set: true, wantID: "60f1e5e5e5e5e5e5e5e5e5e5", wantOK: true},
+		{name: "ausente", set: false},
+		{name: "tipo incorrecto", value: 42, set: true},
+		{name: "vacío", value: "", set: true},
+		{name: "nil", value: nil, set: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			if tt.set {
+				c.Set(UserIDContextKey, tt.value)
+			}
+
+			userID, ok := MustUserID(c)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantID, userID)
+		})
+	}
+}
+
+func TestClaimString(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set("role", "admin")
+	c.Set("scopes", []string{"read"})
+
+	role, ok := ClaimString(c, "role")
+	assert.True(t, ok)
+	assert.Equal(t, "admin", role)
+
+	// Un claim que no es texto no provoca pánico
+	scopes, ok := ClaimString(c, "scopes")
+	assert.False(t, ok)
+	assert.Empty(t, scopes)
+
+	_, ok = ClaimString(c, "client_id")
+	assert.False(t, ok)
+}
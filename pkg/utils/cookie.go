@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CookieOptions agrupa los atributos de seguridad de las cookies que emite la API. Los handlers
+// que necesiten una cookie deben emitirla con SetCookie en lugar de c.SetCookie, para que
+// siempre lleve los atributos configurados.
+type CookieOptions struct {
+	Domain   string        // Vacío = solo el host que emitió la cookie
+	Path     string        // Vacío = "/"
+	Secure   bool          // Solo se envía por HTTPS
+	HttpOnly bool          // No es accesible desde JavaScript
+	SameSite http.SameSite // Envío en solicitudes originadas en otros sitios
+}
+
+// DefaultCookieOptions retorna las opciones seguras por defecto: Secure, HttpOnly y SameSite=Lax
+func DefaultCookieOptions() CookieOptions {
+	return CookieOptions{
+		Path:     "/",
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// ParseSameSite interpreta "lax", "strict" o "none" (sin distinguir mayúsculas)
+func ParseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return http.SameSiteDefaultMode, fmt.Errorf("SameSite no válido: %q (use lax, strict o none)", value)
+	}
+}
+
+// SetCookie agrega la cookie a la respuesta con vigencia maxAge (0 = cookie de sesión).
+// Los navegadores rechazan SameSite=None sin Secure, por lo que en ese caso se fuerza Secure.
+func (o CookieOptions) SetCookie(c *gin.Context, name, value string, maxAge time.Duration) {
+	path := o.Path
+	if path == "" {
+		path = "/"
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   o.Domain,
+		MaxAge:   int(maxAge.Seconds()),
+		Secure:   o.Secure || o.SameSite == http.SameSiteNoneMode,
+		HttpOnly: o.HttpOnly,
+		SameSite: o.SameSite,
+	})
+}
+
+// ClearCookie indica al navegador que elimine la cookie emitida con las mismas opciones
+func (o CookieOptions) ClearCookie(c *gin.Context, name string) {
+	o.SetCookie(c, name, "", -time.Second)
+}
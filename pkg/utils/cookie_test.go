@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSameSite(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected http.SameSite
+		wantErr  bool
+	}{
+		{"lax", http.SameSiteLaxMode, false},
+		{" Strict ", http.SameSiteStrictMode, false},
+		{"NONE", http.SameSiteNoneMode, false},
+		{"", http.SameSiteDefaultMode, true},
+		{"relaxed", http.SameSiteDefaultMode, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			sameSite, err := ParseSameSite(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, sameSite)
+		})
+	}
+}
+
+func TestCookieOptions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	setCookie := func(set func(c *gin.Context)) *http.Cookie {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		set(c)
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		return cookies[0]
+	}
+
+	t.Run("opciones por defecto", func(t *testing.T) {
+		options := DefaultCookieOptions()
+		cookie := setCookie(func(c *gin.Context) { options.SetCookie(c, "session", "abc", time.Hour) })
+
+		assert.Equal(t, "abc", cookie.Value)
+		assert.Equal(t, "/", cookie.Path)
+		assert.Equal(t, 3600, cookie.MaxAge)
+		assert.True(t, cookie.Secure)
+		assert.True(t, cookie.HttpOnly)
+		assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+	})
+
+	t.Run("SameSite=None fuerza Secure", func(t *testing.T) {
+		options := CookieOptions{HttpOnly: true, SameSite: http.SameSiteNoneMode}
+		cookie := setCookie(func(c *gin.Context) { options.SetCookie(c, "session", "abc", 0) })
+
+		assert.True(t, cookie.Secure)
+		assert.Equal(t, http.SameSiteNoneMode, cookie.SameSite)
+	})
+
+	t.Run("ClearCookie", func(t *testing.T) {
+		options := DefaultCookieOptions()
+		options.Domain = "ejemplo.com"
+		cookie := setCookie(func(c *gin.Context) { options.ClearCookie(c, "session") })
+
+		assert.Empty(t, cookie.Value)
+		assert.Equal(t, "ejemplo.com", cookie.Domain)
+		assert.Equal(t, -1, cookie.MaxAge)
+	})
+}
@@ -1,9 +1,14 @@
 package utils
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
+	"strings"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -20,6 +25,12 @@ func CheckPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
+// IsPasswordHash indica si un valor ya es un hash bcrypt
+func IsPasswordHash(value string) bool {
+	_, err := bcrypt.Cost([]byte(value))
+	return err == nil
+}
+
 // GenerateRandomToken genera un token aleatorio con la longitud especificada
 func GenerateRandomToken(length int) (string, error) {
 	b := make([]byte, length)
@@ -44,3 +55,68 @@ func GenerateRandomString(length int) (string, error) {
 	}
 	return base64.URLEncoding.EncodeToString(b), nil
 }
+
+// HashToken retorna el hash SHA-256 (hex) de un token de alta entropía (access/refresh token,
+// API key) para guardarlo y buscarlo sin conservar el valor original. Un token vacío retorna "".
+func HashToken(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// sealedPrefix identifica los valores cifrados con SecretBox
+const sealedPrefix = "enc:v1:"
+
+// SecretBox cifra con AES-256-GCM valores pequeños que deben guardarse recuperables en la base
+// de datos (ej. secretos TOTP), de modo que una copia de la base no los exponga
+type SecretBox struct {
+	aead cipher.AEAD
+}
+
+// NewSecretBox crea un SecretBox con una clave derivada (SHA-256) de key
+func NewSecretBox(key string) (*SecretBox, error) {
+	if key == "" {
+		return nil, errors.New("la clave de cifrado no puede estar vacía")
+	}
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretBox{aead: aead}, nil
+}
+
+// Seal cifra value con un nonce aleatorio y retorna "enc:v1:" seguido del resultado en base64
+func (b *SecretBox) Seal(value string) (string, error) {
+	nonce, err := GenerateRandomBytes(b.aead.NonceSize())
+	if err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(value), nil)
+	return sealedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open descifra un valor de Seal. Los valores sin el prefijo "enc:v1:", guardados antes de
+// cifrarse, se retornan sin cambios.
+func (b *SecretBox) Open(value string) (string, error) {
+	encoded, ok := strings.CutPrefix(value, sealedPrefix)
+	if !ok {
+		return value, nil
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < b.aead.NonceSize() {
+		return "", errors.New("valor cifrado con formato inválido")
+	}
+	nonce, ciphertext := sealed[:b.aead.NonceSize()], sealed[b.aead.NonceSize():]
+	plain, err := b.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errors.New("no se pudo descifrar el valor: clave incorrecta o valor alterado")
+	}
+	return string(plain), nil
+}
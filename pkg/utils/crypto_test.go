@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretBox(t *testing.T) {
+	box, err := NewSecretBox("clave-de-prueba")
+	require.NoError(t, err)
+
+	sealed, err := box.Seal("JBSWY3DPEHPK3PXP")
+	require.NoError(t, err)
+	assert.NotContains(t, sealed, "JBSWY3DPEHPK3PXP")
+	other, err := box.Seal("JBSWY3DPEHPK3PXP")
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, other, "cada cifrado usa un nonce distinto")
+
+	opened, err := box.Open(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", opened)
+
+	t.Run("valor guardado sin cifrar", func(t *testing.T) {
+		opened, err := box.Open("JBSWY3DPEHPK3PXP")
+		require.NoError(t, err)
+		assert.Equal(t, "JBSWY3DPEHPK3PXP", opened)
+	})
+
+	t.Run("otra clave o valor alterado", func(t *testing.T) {
+		otherBox, err := NewSecretBox("otra-clave")
+		require.NoError(t, err)
+		_, err = otherBox.Open(sealed)
+		assert.Error(t, err)
+
+		_, err = box.Open(sealed[:len(sealed)-2] + "AA")
+		assert.Error(t, err)
+		_, err = box.Open(sealedPrefix + "%%")
+		assert.Error(t, err)
+	})
+
+	_, err = NewSecretBox("")
+	assert.Error(t, err)
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInvalidCursor se retorna cuando el cursor de paginación recibido no se puede decodificar
+var ErrInvalidCursor = errors.New("cursor de paginación inválido")
+
+// KeysetSort es el orden de la paginación por cursor: del más reciente al más antiguo, con
+// _id como desempate para que documentos con el mismo created_at tengan un orden estable
+var KeysetSort = bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}
+
+// KeysetCursor identifica el último documento de una página en el orden KeysetSort.
+// La página siguiente empieza en el primer documento posterior a él.
+type KeysetCursor struct {
+	CreatedAt time.Time
+	ID        primitive.ObjectID
+}
+
+// NewKeysetCursor crea el cursor de un documento a partir de su created_at e _id
+func NewKeysetCursor(createdAt time.Time, id primitive.ObjectID) KeysetCursor {
+	return KeysetCursor{CreatedAt: createdAt, ID: id}
+}
+
+// Encode serializa el cursor como un token opaco apto para URLs. created_at se guarda en
+// milisegundos, la misma precisión con la que lo conserva MongoDB.
+func (c KeysetCursor) Encode() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixMilli(), 10) + "." + c.ID.Hex()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeKeysetCursor interpreta un token generado por Encode
+func DecodeKeysetCursor(token string) (KeysetCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return KeysetCursor{}, ErrInvalidCursor
+	}
+
+	millis, hex, found := strings.Cut(string(raw), ".")
+	if !found {
+		return KeysetCursor{}, ErrInvalidCursor
+	}
+	ms, err := strconv.ParseInt(millis, 10, 64)
+	if err != nil {
+		return KeysetCursor{}, ErrInvalidCursor
+	}
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return KeysetCursor{}, ErrInvalidCursor
+	}
+
+	return KeysetCursor{CreatedAt: time.UnixMilli(ms), ID: id}, nil
+}
+
+// Filter retorna el filtro de los documentos posteriores al cursor en el orden KeysetSort
+func (c KeysetCursor) Filter() bson.M {
+	return bson.M{"$or": []bson.M{
+		{"created_at": bson.M{"$lt": c.CreatedAt}},
+		{"created_at": c.CreatedAt, "_id": bson.M{"$lt": c.ID}},
+	}}
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestKeysetCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2024, 3, 1, 10, 0, 0, 250_000_000, time.UTC)
+	id := primitive.NewObjectID()
+
+	token := NewKeysetCursor(createdAt, id).Encode()
+	assert.NotContains(t, token, "=", "el token debe poder usarse en una URL sin escapar")
+
+	decoded, err := DecodeKeysetCursor(token)
+	require.NoError(t, err)
+	assert.True(t, createdAt.Equal(decoded.CreatedAt))
+	assert.Equal(t, id, decoded.ID)
+}
+
+func TestDecodeKeysetCursorRejectsInvalidTokens(t *testing.T) {
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+
+	for _, token := range []string{
+		"no-es-base64!",
+		encode("sin-separador"),
+		encode("abc." + primitive.NewObjectID().Hex()),
+		encode("1709287200000.no-es-un-objectid"),
+	} {
+		_, err := DecodeKeysetCursor(token)
+		assert.ErrorIs(t, err, ErrInvalidCursor, token)
+	}
+}
+
+func TestKeysetCursorFilter(t *testing.T) {
+	createdAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	id := primitive.NewObjectID()
+
+	assert.Equal(t, bson.M{"$or": []bson.M{
+		{"created_at": bson.M{"$lt": createdAt}},
+		{"created_at": createdAt, "_id": bson.M{"$lt": id}},
+	}}, NewKeysetCursor(createdAt, id).Filter())
+}
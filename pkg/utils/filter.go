@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"net/url"
 	"strings"
 	"time"
 
@@ -13,6 +14,7 @@ type FilterDefinition struct {
 	AllowedValues []string                 // Valores permitidos para el campo (si es una lista de opciones)
 	Validator     func(string) bool        // Función de validación personalizada (si no es una lista simple)
 	Transformer   func(string) interface{} // Función para transformar el valor antes de usarlo (ej: convertir a ObjectID)
+	MultiValue    bool                     // Acepta varios valores separados por coma y filtra con $in
 }
 
 // FilterConfig define qué campos pueden ser filtrados y cómo
@@ -24,48 +26,81 @@ func BuildMongoFilter(queryParams map[string]string, config FilterConfig) bson.M
 
 	for param, value := range queryParams {
 		// Verificar si este parámetro está permitido para filtrado
-		if definition, exists := config[param]; exists {
-			// Ignorar valores vacíos
-			if value == "" {
-				continue
-			}
+		definition, exists := config[param]
+		if !exists {
+			continue
+		}
 
-			// Verificar si es un valor permitido (si hay lista de valores permitidos)
-			if len(definition.AllowedValues) > 0 {
-				isValidValue := false
-				for _, allowed := range definition.AllowedValues {
-					if value == allowed {
-						isValidValue = true
-						break
-					}
-				}
-
-				if !isValidValue {
-					continue // Ignorar valores no permitidos
-				}
-			}
+		// Ignorar valores vacíos
+		if value == "" {
+			continue
+		}
 
-			// Aplicar validador personalizado (si está definido)
-			if definition.Validator != nil {
-				if !definition.Validator(value) {
-					continue // Ignorar valores que no pasan la validación
-				}
+		if !definition.MultiValue {
+			if finalValue, ok := definition.apply(value); ok {
+				filter[param] = finalValue
 			}
+			continue
+		}
 
-			// Aplicar transformador (si está definido)
-			var finalValue interface{} = value
-			if definition.Transformer != nil {
-				finalValue = definition.Transformer(value)
+		// Campos multivalor: validar cada valor y descartar los inválidos o repetidos
+		var values []interface{}
+		seen := make(map[string]bool)
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" || seen[item] {
+				continue
 			}
+			seen[item] = true
+			if finalValue, ok := definition.apply(item); ok {
+				values = append(values, finalValue)
+			}
+		}
 
-			// Añadir al filtro
-			filter[param] = finalValue
+		switch len(values) {
+		case 0:
+			// Ningún valor válido: el parámetro se ignora
+		case 1:
+			filter[param] = values[0]
+		default:
+			filter[param] = bson.M{"$in": values}
 		}
 	}
 
 	return filter
 }
 
+// apply valida un valor individual y lo transforma. Retorna false si el valor no es permitido.
+func (definition FilterDefinition) apply(value string) (interface{}, bool) {
+	// Verificar si es un valor permitido (si hay lista de valores permitidos)
+	if len(definition.AllowedValues) > 0 {
+		isValidValue := false
+		for _, allowed := range definition.AllowedValues {
+			if value == allowed {
+				isValidValue = true
+				break
+			}
+		}
+
+		if !isValidValue {
+			return nil, false // Ignorar valores no permitidos
+		}
+	}
+
+	// Aplicar validador personalizado (si está definido)
+	if definition.Validator != nil && !definition.Validator(value) {
+		return nil, false // Ignorar valores que no pasan la validación
+	}
+
+	// Aplicar transformador (si está definido)
+	var finalValue interface{} = value
+	if definition.Transformer != nil {
+		finalValue = definition.Transformer(value)
+	}
+
+	return finalValue, true
+}
+
 // Validadores y transformadores comunes
 
 // IsValidObjectID verifica si un string puede convertirse en un ObjectID válido
@@ -147,11 +182,26 @@ func DateRangeFilter(fromDate, toDate string) bson.M {
 	return filter
 }
 
+// DateRangeQueryFilter construye filtros de rango de fechas a partir de los parámetros de consulta
+// <campo>_from y <campo>_to (RFC3339), donde <campo> es el nombre sin el sufijo _at: created_from
+// y created_to filtran created_at. Los campos sin parámetros válidos se omiten.
+func DateRangeQueryFilter(query url.Values, fields ...string) bson.M {
+	filter := bson.M{}
+	for _, field := range fields {
+		param := strings.TrimSuffix(field, "_at")
+		if dateRange := DateRangeFilter(query.Get(param+"_from"), query.Get(param+"_to")); dateRange != nil {
+			filter[field] = dateRange
+		}
+	}
+	return filter
+}
+
 // Constantes para filtros
 const (
 	StatusActive   = "active"
 	StatusInactive = "inactive"
 	StatusArchived = "archived"
+	StatusPending  = "pending"
 
 	RoleAdmin     = "admin"
 	RoleUser      = "user"
@@ -162,10 +212,12 @@ const (
 var (
 	CommonUserFilterConfig = FilterConfig{
 		"status": FilterDefinition{
-			AllowedValues: []string{StatusActive, StatusInactive, StatusArchived},
+			AllowedValues: []string{StatusActive, StatusInactive, StatusArchived, StatusPending},
+			MultiValue:    true,
 		},
 		"role": FilterDefinition{
 			AllowedValues: []string{RoleAdmin, RoleUser, RoleModerator},
+			MultiValue:    true,
 		},
 		"name": FilterDefinition{
 			Validator:   func(s string) bool { return len(s) > 0 && len(s) <= 100 },
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestBuildMongoFilterMultiValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   map[string]string
+		expected bson.M
+	}{
+		{
+			name:     "varios estados",
+			params:   map[string]string{"status": "active,inactive"},
+			expected: bson.M{"status": bson.M{"$in": []interface{}{"active", "inactive"}}},
+		},
+		{
+			name:   "varios estados y roles",
+			params: map[string]string{"status": "active, inactive", "role": "admin,moderator"},
+			expected: bson.M{
+				"status": bson.M{"$in": []interface{}{"active", "inactive"}},
+				"role":   bson.M{"$in": []interface{}{"admin", "moderator"}},
+			},
+		},
+		{
+			name:     "descarta valores inválidos y repetidos",
+			params:   map[string]string{"status": "active,borrado,active", "role": "admin,superuser"},
+			expected: bson.M{"status": "active", "role": "admin"},
+		},
+		{
+			name:     "sin valores válidos se ignora",
+			params:   map[string]string{"status": "borrado,,", "role": "superuser"},
+			expected: bson.M{},
+		},
+		{
+			name:     "valor único mantiene igualdad",
+			params:   map[string]string{"role": "user"},
+			expected: bson.M{"role": "user"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, BuildMongoFilter(tt.params, CommonUserFilterConfig))
+		})
+	}
+}
+
+func TestBuildMongoFilterSingleValueIgnoresCommas(t *testing.T) {
+	// Los campos no multivalor no se dividen por coma
+	config := FilterConfig{"status": {AllowedValues: []string{StatusActive, StatusInactive}}}
+
+	assert.Equal(t, bson.M{}, BuildMongoFilter(map[string]string{"status": "active,inactive"}, config))
+	assert.Equal(t, bson.M{"status": "active"}, BuildMongoFilter(map[string]string{"status": "active"}, config))
+}
+
+func TestDateRangeQueryFilter(t *testing.T) {
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 31, 23, 59, 59, 0, time.UTC)
+
+	query := url.Values{
+		"created_from": {from.Format(time.RFC3339)},
+		"updated_to":   {to.Format(time.RFC3339)},
+		"archived_to":  {to.Format(time.RFC3339)}, // Campo no solicitado
+	}
+	assert.Equal(t, bson.M{
+		"created_at": bson.M{"$gte": from},
+		"updated_at": bson.M{"$lte": to},
+	}, DateRangeQueryFilter(query, "created_at", "updated_at"))
+
+	// Las fechas inválidas se ignoran
+	assert.Equal(t, bson.M{}, DateRangeQueryFilter(url.Values{"created_from": {"ayer"}}, "created_at"))
+}
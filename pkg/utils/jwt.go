@@ -1,38 +1,142 @@
 package utils
 
 import (
+	"crypto/rsa"
 	"errors"
+	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 )
 
+// Errores de validación de tokens de acceso. Los mensajes no exponen detalles de la librería
+// JWT y pueden mostrarse al cliente; TokenErrorCode los clasifica.
+var (
+	ErrTokenExpired   = errors.New("token expirado")
+	ErrTokenMalformed = errors.New("token con formato inválido")
+	ErrTokenInvalid   = errors.New("token inválido") // Firma, algoritmo o claims no válidos, o token desconocido
+	ErrTokenRevoked   = errors.New("token revocado")
+)
+
+// Códigos de error de token para los clientes
+const (
+	TokenErrorExpired   = "token_expired"
+	TokenErrorMalformed = "token_malformed"
+	TokenErrorInvalid   = "token_invalid"
+)
+
+// TokenErrorCode clasifica un error de validación de token y retorna su código y el mensaje
+// que puede mostrarse al cliente. Un token revocado se clasifica como TokenErrorInvalid; los
+// errores desconocidos también, con el mensaje de ErrTokenInvalid para no exponer detalles internos.
+func TokenErrorCode(err error) (code string, message string) {
+	switch {
+	case errors.Is(err, ErrTokenExpired):
+		return TokenErrorExpired, ErrTokenExpired.Error()
+	case errors.Is(err, ErrTokenMalformed):
+		return TokenErrorMalformed, ErrTokenMalformed.Error()
+	case errors.Is(err, ErrTokenRevoked):
+		return TokenErrorInvalid, ErrTokenRevoked.Error()
+	default:
+		return TokenErrorInvalid, ErrTokenInvalid.Error()
+	}
+}
+
 // Claims es la estructura de claims para el JWT
 type Claims struct {
 	UserID string   `json:"user_id"`
 	Role   string   `json:"role"`
 	Scopes []string `json:"scopes"`
+	// Permisos efectivos del usuario al emitir el token (solo si se configuró un resolvedor de permisos)
+	Permissions []string `json:"permissions,omitempty"`
+	// Momento en que el usuario se autenticó (se conserva al refrescar el token)
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	// Cliente OAuth que emitió el token (solo si se configuró su inclusión)
+	ClientID   string `json:"client_id,omitempty"`
+	ClientName string `json:"client_name,omitempty"`
 	jwt.RegisteredClaims
 }
 
 // GenerateJWT genera un nuevo token JWT
 func GenerateJWT(userID, role string, scopes []string, secret string, expiration time.Duration) (string, error) {
-	// Preparar claims
-	claims := &Claims{
-		UserID: userID,
-		Role:   role,
-		Scopes: scopes,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+	return GenerateJWTWithPermissions(userID, role, scopes, nil, secret, expiration)
+}
+
+// GenerateJWTWithPermissions genera un nuevo token JWT que incluye los permisos del usuario como claim
+func GenerateJWTWithPermissions(userID, role string, scopes, permissions []string, secret string, expiration time.Duration) (string, error) {
+	return GenerateJWTWithClaims(&Claims{
+		UserID:      userID,
+		Role:        role,
+		Scopes:      scopes,
+		Permissions: permissions,
+	}, secret, expiration)
+}
+
+// Algoritmos de firma de JWT soportados
+const (
+	JWTAlgorithmHS256 = "HS256" // HMAC con secreto compartido
+	JWTAlgorithmRS256 = "RS256" // RSA: se firma con la clave privada y se valida con la pública
+)
+
+// JWTSigner firma y valida JWT con un único algoritmo. Al validar se rechaza cualquier token
+// cuyo encabezado alg no coincida con el configurado, para evitar ataques de confusión de
+// algoritmo (ej. un token HS256 firmado con la clave pública RSA como secreto).
+type JWTSigner struct {
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// NewHS256Signer crea un firmante HS256 con un secreto compartido
+func NewHS256Signer(secret string) *JWTSigner {
+	return &JWTSigner{
+		method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}
+}
+
+// NewRS256Signer crea un firmante RS256 que firma con la clave privada y valida con su clave pública
+func NewRS256Signer(privateKey *rsa.PrivateKey) *JWTSigner {
+	return &JWTSigner{
+		method:    jwt.SigningMethodRS256,
+		signKey:   privateKey,
+		verifyKey: &privateKey.PublicKey,
+	}
+}
+
+// NewRS256Verifier crea un validador RS256 que solo conoce la clave pública (ej. otros servicios
+// que verifican los tokens). Sign retorna error.
+func NewRS256Verifier(publicKey *rsa.PublicKey) *JWTSigner {
+	return &JWTSigner{
+		method:    jwt.SigningMethodRS256,
+		verifyKey: publicKey,
+	}
+}
+
+// Algorithm retorna el algoritmo de firma (valor del encabezado alg)
+func (s *JWTSigner) Algorithm() string {
+	return s.method.Alg()
+}
+
+// Sign firma los claims indicados estableciendo la emisión y la expiración
+func (s *JWTSigner) Sign(claims *Claims, expiration time.Duration) (string, error) {
+	now := time.Now()
+	return s.SignAt(claims, now, now.Add(expiration))
+}
+
+// SignAt firma los claims con la emisión issuedAt y la expiración expiresAt indicadas, para quien
+// usa un reloj propio
+func (s *JWTSigner) SignAt(claims *Claims, issuedAt, expiresAt time.Time) (string, error) {
+	if s.signKey == nil {
+		return "", errors.New("el firmante de JWT no tiene clave privada")
 	}
 
-	// Crear token con claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	claims.RegisteredClaims.ExpiresAt = jwt.NewNumericDate(expiresAt)
+	claims.RegisteredClaims.IssuedAt = jwt.NewNumericDate(issuedAt)
 
-	// Firmar token con clave secreta
-	tokenString, err := token.SignedString([]byte(secret))
+	// Crear token con claims y firmarlo
+	token := jwt.NewWithClaims(s.method, claims)
+	tokenString, err := token.SignedString(s.signKey)
 	if err != nil {
 		return "", err
 	}
@@ -40,38 +144,37 @@ func GenerateJWT(userID, role string, scopes []string, secret string, expiration
 	return tokenString, nil
 }
 
-// ValidateJWT valida un token JWT y retorna los claims
-func ValidateJWT(tokenString, secret string) (string, map[string]interface{}, error) {
-	// Parsear token
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Verificar que el método de firma sea HMAC
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+// Validate valida un token JWT y retorna el user_id y los claims. Los errores son
+// ErrTokenMalformed, ErrTokenExpired o ErrTokenInvalid, nunca los de la librería JWT.
+func (s *JWTSigner) Validate(tokenString string) (string, map[string]interface{}, error) {
+	// Parsear token aceptando únicamente el algoritmo configurado
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{s.method.Alg()}))
+	token, err := parser.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if token.Method.Alg() != s.method.Alg() {
 			return nil, errors.New("método de firma inválido")
 		}
-
-		// Retornar clave secreta
-		return []byte(secret), nil
+		return s.verifyKey, nil
 	})
 
 	if err != nil {
-		return "", nil, err
+		return "", nil, tokenValidationError(err)
 	}
 
 	// Verificar que el token sea válido
 	if !token.Valid {
-		return "", nil, errors.New("token inválido")
+		return "", nil, ErrTokenInvalid
 	}
 
 	// Obtener claims
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return "", nil, errors.New("no se pudieron obtener los claims")
+		return "", nil, ErrTokenInvalid
 	}
 
 	// Extraer userID
 	userID, ok := claims["user_id"].(string)
 	if !ok {
-		return "", nil, errors.New("user_id no encontrado en claims")
+		return "", nil, ErrTokenInvalid
 	}
 
 	// Convertir claims a map
@@ -82,3 +185,45 @@ func ValidateJWT(tokenString, secret string) (string, map[string]interface{}, er
 
 	return userID, claimsMap, nil
 }
+
+// tokenValidationError traduce un error de la librería JWT a ErrTokenMalformed, ErrTokenExpired
+// o ErrTokenInvalid (firma incorrecta, algoritmo no permitido, token aún no válido, etc.)
+func tokenValidationError(err error) error {
+	switch {
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return ErrTokenMalformed
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ErrTokenExpired
+	default:
+		return ErrTokenInvalid
+	}
+}
+
+// GenerateJWTWithClaims firma los claims indicados con HS256 estableciendo la emisión y la expiración
+func GenerateJWTWithClaims(claims *Claims, secret string, expiration time.Duration) (string, error) {
+	return NewHS256Signer(secret).Sign(claims, expiration)
+}
+
+// ValidateJWT valida un token JWT firmado con HS256 y retorna los claims
+func ValidateJWT(tokenString, secret string) (string, map[string]interface{}, error) {
+	return NewHS256Signer(secret).Validate(tokenString)
+}
+
+// GenerateJWTRS256 firma los claims indicados con RS256 estableciendo la emisión y la expiración
+func GenerateJWTRS256(claims *Claims, privateKey *rsa.PrivateKey, expiration time.Duration) (string, error) {
+	return NewRS256Signer(privateKey).Sign(claims, expiration)
+}
+
+// ValidateJWTRS256 valida un token JWT firmado con RS256 usando la clave pública y retorna los claims
+func ValidateJWTRS256(tokenString string, publicKey *rsa.PublicKey) (string, map[string]interface{}, error) {
+	return NewRS256Verifier(publicKey).Validate(tokenString)
+}
+
+// LoadRSAPrivateKey lee una clave privada RSA en formato PEM (PKCS#1 o PKCS#8)
+func LoadRSAPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return jwt.ParseRSAPrivateKeyFromPEM(data)
+}
@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return key
+}
+
+func TestJWTRS256RoundTrip(t *testing.T) {
+	key := newTestRSAKey(t)
+
+	tokenString, err := GenerateJWTRS256(&Claims{UserID: "usuario-1", Scopes: []string{"read"}}, key, time.Minute)
+	require.NoError(t, err)
+
+	userID, claims, err := ValidateJWTRS256(tokenString, &key.PublicKey)
+	require.NoError(t, err)
+	assert.Equal(t, "usuario-1", userID)
+	assert.Equal(t, []interface{}{"read"}, claims["scopes"])
+
+	// Otra clave pública no valida el token
+	_, _, err = ValidateJWTRS256(tokenString, &newTestRSAKey(t).PublicKey)
+	assert.Error(t, err)
+
+	// Un validador solo con clave pública no puede firmar
+	_, err = NewRS256Verifier(&key.PublicKey).Sign(&Claims{UserID: "usuario-1"}, time.Minute)
+	assert.Error(t, err)
+}
+
+func TestJWTRejectsAlgorithmMismatch(t *testing.T) {
+	key := newTestRSAKey(t)
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: mustMarshalPKIX(t, &key.PublicKey)})
+	claims := jwt.MapClaims{"user_id": "usuario-1", "exp": time.Now().Add(time.Minute).Unix()}
+
+	sign := func(method jwt.SigningMethod, signKey interface{}) string {
+		tokenString, err := jwt.NewWithClaims(method, claims).SignedString(signKey)
+		require.NoError(t, err)
+		return tokenString
+	}
+
+	t.Run("HS256 firmado con la clave pública contra un validador RS256", func(t *testing.T) {
+		_, _, err := ValidateJWTRS256(sign(jwt.SigningMethodHS256, publicPEM), &key.PublicKey)
+		assert.Error(t, err)
+	})
+
+	t.Run("RS256 contra un validador HS256", func(t *testing.T) {
+		_, _, err := ValidateJWT(sign(jwt.SigningMethodRS256, key), "secreto")
+		assert.Error(t, err)
+	})
+
+	t.Run("HS384 contra un validador HS256", func(t *testing.T) {
+		_, _, err := ValidateJWT(sign(jwt.SigningMethodHS384, []byte("secreto")), "secreto")
+		assert.Error(t, err)
+	})
+
+	t.Run("alg none", func(t *testing.T) {
+		_, _, err := ValidateJWT(sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType), "secreto")
+		assert.Error(t, err)
+	})
+
+	t.Run("HS256 válido", func(t *testing.T) {
+		userID, _, err := ValidateJWT(sign(jwt.SigningMethodHS256, []byte("secreto")), "secreto")
+		require.NoError(t, err)
+		assert.Equal(t, "usuario-1", userID)
+	})
+}
+
+func TestJWTValidationErrors(t *testing.T) {
+	key := newTestRSAKey(t)
+	sign := func(claims jwt.MapClaims, secret string) string {
+		tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		require.NoError(t, err)
+		return tokenString
+	}
+	valid := jwt.MapClaims{"user_id": "usuario-1", "exp": time.Now().Add(time.Minute).Unix()}
+	rs256, err := jwt.NewWithClaims(jwt.SigningMethodRS256, valid).SignedString(key)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+		code    string
+	}{
+		{"texto sin formato JWT", "no-es-un-jwt", ErrTokenMalformed, TokenErrorMalformed},
+		{"segmentos no decodificables", "a.b.c", ErrTokenMalformed, TokenErrorMalformed},
+		{"expirado", sign(jwt.MapClaims{"user_id": "usuario-1", "exp": time.Now().Add(-time.Minute).Unix()}, "secreto"), ErrTokenExpired, TokenErrorExpired},
+		{"firma incorrecta", sign(valid, "otro-secreto"), ErrTokenInvalid, TokenErrorInvalid},
+		{"algoritmo no permitido", rs256, ErrTokenInvalid, TokenErrorInvalid},
+		{"aún no válido", sign(jwt.MapClaims{"user_id": "usuario-1", "nbf": time.Now().Add(time.Hour).Unix()}, "secreto"), ErrTokenInvalid, TokenErrorInvalid},
+		{"sin user_id", sign(jwt.MapClaims{"exp": time.Now().Add(time.Minute).Unix()}, "secreto"), ErrTokenInvalid, TokenErrorInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ValidateJWT(tt.token, "secreto")
+			// Se retorna el error propio, no el de la librería JWT
+			assert.Equal(t, tt.wantErr, err)
+
+			code, message := TokenErrorCode(err)
+			assert.Equal(t, tt.code, code)
+			assert.Equal(t, tt.wantErr.Error(), message)
+		})
+	}
+}
+
+func TestTokenErrorCode(t *testing.T) {
+	code, message := TokenErrorCode(ErrTokenRevoked)
+	assert.Equal(t, TokenErrorInvalid, code)
+	assert.Equal(t, "token revocado", message)
+
+	// Un error desconocido no expone su mensaje
+	code, message = TokenErrorCode(errors.New("connection refused"))
+	assert.Equal(t, TokenErrorInvalid, code)
+	assert.Equal(t, ErrTokenInvalid.Error(), message)
+}
+
+func TestLoadRSAPrivateKey(t *testing.T) {
+	key := newTestRSAKey(t)
+	path := filepath.Join(t.TempDir(), "jwt.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	loaded, err := LoadRSAPrivateKey(path)
+	require.NoError(t, err)
+	assert.True(t, key.Equal(loaded))
+
+	_, err = LoadRSAPrivateKey(filepath.Join(t.TempDir(), "no-existe.pem"))
+	assert.Error(t, err)
+}
+
+func mustMarshalPKIX(t *testing.T, key *rsa.PublicKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	require.NoError(t, err)
+	return der
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Límites de los metadatos personalizados de una entidad
+const (
+	MaxMetadataKeys      = 20   // Número máximo de claves
+	MaxMetadataKeyLength = 40   // Longitud máxima de una clave
+	MaxMetadataSize      = 4096 // Tamaño máximo en bytes del documento serializado como JSON
+
+	// MetadataQueryPrefix es el prefijo de los parámetros de consulta que filtran por metadatos (ej. ?metadata.department=ventas)
+	MetadataQueryPrefix = "metadata."
+)
+
+// ErrInvalidMetadata se retorna cuando los metadatos no cumplen los límites o el formato de claves
+var ErrInvalidMetadata = errors.New("metadatos no válidos")
+
+// metadataKeyPattern evita claves con "." o "$", que MongoDB interpretaría como rutas u operadores
+var metadataKeyPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+
+// IsValidMetadataKey verifica el formato y la longitud de una clave de metadatos
+func IsValidMetadataKey(key string) bool {
+	return len(key) <= MaxMetadataKeyLength && metadataKeyPattern.MatchString(key)
+}
+
+// ValidateMetadata verifica claves, número de claves, tipos y tamaño de los metadatos.
+// Solo se admiten valores escalares (texto, número o booleano) para que puedan filtrarse.
+func ValidateMetadata(metadata map[string]interface{}) error {
+	if len(metadata) > MaxMetadataKeys {
+		return fmt.Errorf("%w: máximo %d claves", ErrInvalidMetadata, MaxMetadataKeys)
+	}
+
+	for key, value := range metadata {
+		if !IsValidMetadataKey(key) {
+			return fmt.Errorf("%w: clave %q no válida", ErrInvalidMetadata, key)
+		}
+		switch value.(type) {
+		case string, bool, float64, float32, int, int32, int64:
+		default:
+			return fmt.Errorf("%w: el valor de %q debe ser texto, número o booleano", ErrInvalidMetadata, key)
+		}
+	}
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMetadata, err)
+	}
+	if len(data) > MaxMetadataSize {
+		return fmt.Errorf("%w: máximo %d bytes", ErrInvalidMetadata, MaxMetadataSize)
+	}
+
+	return nil
+}
+
+// MergeMetadata aplica los cambios sobre los metadatos actuales.
+// Las claves con valor nil se eliminan; el resto se agregan o reemplazan.
+func MergeMetadata(current, changes map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(current)+len(changes))
+	for key, value := range current {
+		merged[key] = value
+	}
+	for key, value := range changes {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = value
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
+}
+
+// MetadataFilter construye el filtro de MongoDB para los parámetros "metadata.<clave>" de la consulta.
+// Las claves no válidas se ignoran. Como los valores de la consulta son texto, los que parecen
+// números o booleanos también coinciden con su valor tipado.
+func MetadataFilter(query url.Values) bson.M {
+	filter := bson.M{}
+
+	for param, values := range query {
+		if !strings.HasPrefix(param, MetadataQueryPrefix) || len(values) == 0 {
+			continue
+		}
+
+		key := strings.TrimPrefix(param, MetadataQueryPrefix)
+		value := values[0]
+		if !IsValidMetadataKey(key) || value == "" || len(value) > 100 {
+			continue
+		}
+
+		candidates := []interface{}{value}
+		if number, err := strconv.ParseFloat(value, 64); err == nil {
+			candidates = append(candidates, number)
+		}
+		if boolean, err := strconv.ParseBool(value); err == nil {
+			candidates = append(candidates, boolean)
+		}
+
+		field := "metadata." + key
+		if len(candidates) == 1 {
+			filter[field] = value
+		} else {
+			filter[field] = bson.M{"$in": candidates}
+		}
+	}
+
+	return filter
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestValidateMetadata(t *testing.T) {
+	tooManyKeys := make(map[string]interface{})
+	for i := 0; i <= MaxMetadataKeys; i++ {
+		tooManyKeys[fmt.Sprintf("clave%d", i)] = i
+	}
+
+	tests := []struct {
+		name     string
+		metadata map[string]interface{}
+		valid    bool
+	}{
+		{"valores escalares", map[string]interface{}{"department": "ventas", "employee_id": 1234.0, "remote": true}, true},
+		{"vacío", map[string]interface{}{}, true},
+		{"clave con punto", map[string]interface{}{"a.b": "x"}, false},
+		{"clave con operador", map[string]interface{}{"$where": "x"}, false},
+		{"clave demasiado larga", map[string]interface{}{strings.Repeat("a", MaxMetadataKeyLength+1): "x"}, false},
+		{"valor anidado", map[string]interface{}{"address": map[string]interface{}{"city": "x"}}, false},
+		{"demasiadas claves", tooManyKeys, false},
+		{"demasiado grande", map[string]interface{}{"notes": strings.Repeat("x", MaxMetadataSize)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateMetadata(tt.metadata)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidMetadata)
+			}
+		})
+	}
+}
+
+func TestMergeMetadata(t *testing.T) {
+	current := map[string]interface{}{"department": "ventas", "floor": 3.0}
+
+	merged := MergeMetadata(current, map[string]interface{}{"department": "soporte", "floor": nil, "remote": true})
+	assert.Equal(t, map[string]interface{}{"department": "soporte", "remote": true}, merged)
+	assert.Equal(t, "ventas", current["department"], "los metadatos actuales no se modifican")
+
+	assert.Nil(t, MergeMetadata(current, map[string]interface{}{"department": nil, "floor": nil}))
+}
+
+func TestMetadataFilter(t *testing.T) {
+	query := url.Values{
+		"metadata.department":  {"ventas"},
+		"metadata.employee_id": {"1234"},
+		"metadata.remote":      {"true"},
+		"metadata.$where":      {"1"},
+		"metadata.a.b":         {"x"},
+		"metadata.empty":       {""},
+		"status":               {"active"},
+	}
+
+	assert.Equal(t, bson.M{
+		"metadata.department":  "ventas",
+		"metadata.employee_id": bson.M{"$in": []interface{}{"1234", 1234.0}},
+		"metadata.remote":      bson.M{"$in": []interface{}{"true", true}},
+	}, MetadataFilter(query))
+}
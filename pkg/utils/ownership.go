@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// OwnerField es el nombre estándar del campo BSON que guarda el propietario de una entidad.
+// Las entidades con propietario declaran:
+//
+//	OwnerID string `json:"owner_id,omitempty" bson:"owner_id,omitempty"`
+const OwnerField = "owner_id"
+
+// ErrInvalidOwnershipTransfer se retorna cuando origen o destino de una transferencia no son válidos
+var ErrInvalidOwnershipTransfer = errors.New("transferencia de propiedad inválida: se requieren usuarios de origen y destino distintos")
+
+// ValidateOwnershipTransfer verifica que la transferencia tenga origen y destino distintos
+func ValidateOwnershipTransfer(fromUserID, toUserID string) error {
+	if fromUserID == "" || toUserID == "" || fromUserID == toUserID {
+		return ErrInvalidOwnershipTransfer
+	}
+	return nil
+}
+
+// TransferOwnership reasigna en bloque todos los documentos de la colección cuyo
+// propietario es fromUserID a toUserID. Retorna el número de documentos modificados.
+func TransferOwnership(ctx context.Context, collection *mongo.Collection, fromUserID, toUserID string) (int64, error) {
+	if err := ValidateOwnershipTransfer(fromUserID, toUserID); err != nil {
+		return 0, err
+	}
+
+	result, err := collection.UpdateMany(
+		ctx,
+		bson.M{OwnerField: fromUserID},
+		bson.M{"$set": bson.M{
+			OwnerField:   toUserID,
+			"updated_at": time.Now(),
+		}},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestTransferOwnership(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("retorna los documentos modificados", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(
+			bson.E{Key: "n", Value: 3},
+			bson.E{Key: "nModified", Value: 3},
+		))
+
+		moved, err := TransferOwnership(context.Background(), mt.Coll, "usuario-a", "usuario-b")
+
+		require.NoError(mt, err)
+		assert.Equal(mt, int64(3), moved)
+
+		// El filtro y la actualización usan el campo de propietario estándar
+		started := mt.GetStartedEvent()
+		require.NotNil(mt, started)
+		updates := started.Command.Lookup("updates").Array()
+		update, err := updates.IndexErr(0)
+		require.NoError(mt, err)
+		assert.Equal(mt, "usuario-a", update.Value().Document().Lookup("q", OwnerField).StringValue())
+		assert.Equal(mt, "usuario-b", update.Value().Document().Lookup("u", "$set", OwnerField).StringValue())
+		assert.True(mt, update.Value().Document().Lookup("multi").Boolean())
+	})
+
+	mt.Run("rechaza transferencias inválidas sin consultar la base", func(mt *mtest.T) {
+		for _, pair := range [][2]string{{"", "usuario-b"}, {"usuario-a", ""}, {"usuario-a", "usuario-a"}} {
+			_, err := TransferOwnership(context.Background(), mt.Coll, pair[0], pair[1])
+			assert.ErrorIs(mt, err, ErrInvalidOwnershipTransfer)
+		}
+		assert.Nil(mt, mt.GetStartedEvent())
+	})
+}
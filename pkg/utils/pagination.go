@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Valores por defecto de paginación
+const (
+	DefaultPageSize = 20
+	DefaultMaxSize  = 100
+	// MaxPage es la página más alta aceptada, para que Skip no desborde con un page enorme
+	MaxPage = 1000000
+)
+
+// Paginator interpreta los parámetros page y limit aplicando un tamaño máximo de página
+type Paginator struct {
+	DefaultPageSize int
+	MaxPageSize     int
+}
+
+// NewPaginator crea un paginador. Valores no positivos usan los valores por defecto.
+// El tamaño por defecto nunca supera el máximo.
+func NewPaginator(defaultPageSize, maxPageSize int) *Paginator {
+	if maxPageSize <= 0 {
+		maxPageSize = DefaultMaxSize
+	}
+	if defaultPageSize <= 0 {
+		defaultPageSize = DefaultPageSize
+	}
+	if defaultPageSize > maxPageSize {
+		defaultPageSize = maxPageSize
+	}
+	return &Paginator{
+		DefaultPageSize: defaultPageSize,
+		MaxPageSize:     maxPageSize,
+	}
+}
+
+// PageRequest representa una página solicitada ya validada
+type PageRequest struct {
+	Page           int // Página (desde 1)
+	Limit          int // Tamaño de página aplicado
+	RequestedLimit int // Tamaño de página solicitado por el cliente (0 si no lo indicó)
+}
+
+// Skip retorna el número de documentos a omitir. La página se limita a [1, MaxPage] antes de
+// multiplicar, de modo que el resultado nunca desborda ni es negativo.
+func (p PageRequest) Skip() int64 {
+	page := min(max(p.Page, 1), MaxPage)
+	return int64(page-1) * int64(max(p.Limit, 0))
+}
+
+// Clamped indica si el tamaño solicitado fue reducido al máximo permitido
+func (p PageRequest) Clamped() bool {
+	return p.RequestedLimit > p.Limit
+}
+
+// Parse obtiene page y limit de la query. Valores inválidos usan los valores por defecto,
+// un page superior a MaxPage se reduce a MaxPage y un limit superior al máximo a MaxPageSize.
+func (p *Paginator) Parse(c *gin.Context) PageRequest {
+	req := PageRequest{Page: 1, Limit: p.DefaultPageSize}
+
+	if page, err := strconv.Atoi(c.Query("page")); err == nil && page > 0 {
+		req.Page = min(page, MaxPage)
+	}
+
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 {
+		req.RequestedLimit = limit
+		req.Limit = limit
+		if limit > p.MaxPageSize {
+			req.Limit = p.MaxPageSize
+		}
+	}
+
+	return req
+}
+
+// PaginationMeta describe la página devuelta, incluyendo el límite solicitado y el aplicado
+type PaginationMeta struct {
+	Total          int64 `json:"total"`
+	Page           int   `json:"page"`
+	Limit          int   `json:"limit"`
+	TotalPages     int64 `json:"total_pages"`
+	RequestedLimit int   `json:"requested_limit,omitempty"`
+	MaxPageSize    int   `json:"max_page_size"`
+	Clamped        bool  `json:"clamped"`
+}
+
+// Meta construye los metadatos de paginación para el total de resultados dado
+func (p *Paginator) Meta(req PageRequest, total int64) PaginationMeta {
+	totalPages := int64(0)
+	if req.Limit > 0 {
+		totalPages = (total + int64(req.Limit) - 1) / int64(req.Limit)
+	}
+	return PaginationMeta{
+		Page:           req.Page,
+		Limit:          req.Limit,
+		RequestedLimit: req.RequestedLimit,
+		MaxPageSize:    p.MaxPageSize,
+		Clamped:        req.Clamped(),
+		Total:          total,
+		TotalPages:     totalPages,
+	}
+}
+
+// CursorMeta describe una página obtenida con paginación por cursor (keyset). No incluye
+// totales: contarlos recorrería la colección completa, que es lo que el cursor evita.
+type CursorMeta struct {
+	Limit          int    `json:"limit"`
+	RequestedLimit int    `json:"requested_limit,omitempty"`
+	MaxPageSize    int    `json:"max_page_size"`
+	Clamped        bool   `json:"clamped"`
+	NextCursor     string `json:"next_cursor,omitempty"` // Vacío en la última página
+	HasMore        bool   `json:"has_more"`
+}
+
+// CursorMeta construye los metadatos de una página por cursor
+func (p *Paginator) CursorMeta(req PageRequest, nextCursor string) CursorMeta {
+	return CursorMeta{
+		Limit:          req.Limit,
+		RequestedLimit: req.RequestedLimit,
+		MaxPageSize:    p.MaxPageSize,
+		Clamped:        req.Clamped(),
+		NextCursor:     nextCursor,
+		HasMore:        nextCursor != "",
+	}
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// contextWithQuery crea un contexto de gin con la query indicada
+func contextWithQuery(query string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/?"+query, nil)
+	return c
+}
+
+func TestPaginatorClampsOversizedLimit(t *testing.T) {
+	p := NewPaginator(20, 100)
+
+	tests := []struct {
+		query     string
+		page      int
+		limit     int
+		requested int
+		clamped   bool
+	}{
+		{"", 1, 20, 0, false},
+		{"limit=50&page=3", 3, 50, 50, false},
+		{"limit=100", 1, 100, 100, false},
+		{"limit=1000000", 1, 100, 1000000, true},
+		{"limit=-5&page=0", 1, 20, 0, false},
+		{"limit=abc&page=abc", 1, 20, 0, false},
+		{"page=9223372036854775807&limit=100", MaxPage, 100, 100, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			req := p.Parse(contextWithQuery(tt.query))
+			assert.Equal(t, tt.page, req.Page)
+			assert.Equal(t, tt.limit, req.Limit)
+			assert.Equal(t, tt.requested, req.RequestedLimit)
+			assert.Equal(t, tt.clamped, req.Clamped())
+		})
+	}
+}
+
+func TestPageRequestSkip(t *testing.T) {
+	assert.Equal(t, int64(0), PageRequest{Page: 1, Limit: 20}.Skip())
+	assert.Equal(t, int64(40), PageRequest{Page: 3, Limit: 20}.Skip())
+	assert.Equal(t, int64(0), PageRequest{Page: 0, Limit: 20}.Skip())
+	// Una página fuera de rango no desborda
+	assert.Equal(t, int64(MaxPage-1)*100, PageRequest{Page: int(^uint(0) >> 1), Limit: 100}.Skip())
+}
+
+func TestPaginatorMeta(t *testing.T) {
+	p := NewPaginator(20, 100)
+	req := p.Parse(contextWithQuery("limit=500&page=2"))
+
+	meta := p.Meta(req, 250)
+
+	assert.Equal(t, int64(100), req.Skip())
+	assert.Equal(t, 100, meta.Limit)
+	assert.Equal(t, 500, meta.RequestedLimit)
+	assert.Equal(t, 100, meta.MaxPageSize)
+	assert.True(t, meta.Clamped)
+	assert.Equal(t, int64(3), meta.TotalPages)
+}
+
+func TestNewPaginatorDefaults(t *testing.T) {
+	p := NewPaginator(0, 0)
+	assert.Equal(t, DefaultPageSize, p.DefaultPageSize)
+	assert.Equal(t, DefaultMaxSize, p.MaxPageSize)
+
+	// El tamaño por defecto no puede superar el máximo
+	p = NewPaginator(50, 10)
+	assert.Equal(t, 10, p.DefaultPageSize)
+}
@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxPasswordBytes es la longitud máxima de una contraseña en bytes: bcrypt ignora el resto
+const MaxPasswordBytes = 72
+
+// ErrWeakPassword se retorna (envuelto en *PasswordStrengthError) cuando una contraseña no
+// cumple la política de complejidad
+var ErrWeakPassword = errors.New("la contraseña no cumple la política de seguridad")
+
+// CommonPasswords son contraseñas frecuentes en filtraciones que se rechazan siempre
+var CommonPasswords = []string{
+	"123456", "1234567", "12345678", "123456789", "1234567890", "111111", "000000", "123123",
+	"654321", "666666", "121212", "abc123", "qwerty", "qwerty123", "asdfgh", "iloveyou",
+	"password", "password1", "password123", "passw0rd", "contraseña", "admin", "admin123",
+	"welcome", "letmein", "monkey", "dragon", "football", "sunshine", "princess",
+}
+
+// PasswordPolicy define las reglas de complejidad de las contraseñas
+type PasswordPolicy struct {
+	MinLength     int      // Longitud mínima en caracteres
+	RequireUpper  bool     // Al menos una letra mayúscula
+	RequireLower  bool     // Al menos una letra minúscula
+	RequireDigit  bool     // Al menos un dígito
+	RequireSymbol bool     // Al menos un símbolo o signo de puntuación
+	Blocklist     []string // Contraseñas rechazadas sin distinguir mayúsculas (además de CommonPasswords)
+}
+
+// DefaultPasswordPolicy retorna la política por defecto: al menos 6 caracteres y no ser una
+// contraseña común
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{MinLength: 6}
+}
+
+// PasswordStrengthError describe las reglas que no cumple una contraseña.
+// errors.Is lo reconoce como ErrWeakPassword.
+type PasswordStrengthError struct {
+	Missing []string // Requisitos no cumplidos (ej. "incluir un dígito")
+	Common  bool     // La contraseña está en la lista de contraseñas bloqueadas
+}
+
+// Error enumera los requisitos no cumplidos, ej. "la contraseña debe tener al menos 8
+// caracteres e incluir un dígito"
+func (e *PasswordStrengthError) Error() string {
+	var parts []string
+	if e.Common {
+		parts = append(parts, "la contraseña es demasiado común")
+	}
+	if len(e.Missing) > 0 {
+		parts = append(parts, "la contraseña debe "+joinRequirements(e.Missing))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Is permite usar errors.Is(err, ErrWeakPassword)
+func (e *PasswordStrengthError) Is(target error) bool {
+	return target == ErrWeakPassword
+}
+
+// ValidatePasswordStrength verifica la contraseña contra la política. Retorna nil si la
+// cumple o un *PasswordStrengthError con todos los requisitos incumplidos.
+func ValidatePasswordStrength(password string, policy PasswordPolicy) error {
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+
+	strength := &PasswordStrengthError{Common: isBlockedPassword(password, policy.Blocklist)}
+	if utf8.RuneCountInString(password) < policy.MinLength {
+		strength.Missing = append(strength.Missing, "tener al menos "+strconv.Itoa(policy.MinLength)+" caracteres")
+	}
+	if len(password) > MaxPasswordBytes {
+		strength.Missing = append(strength.Missing, "tener como máximo "+strconv.Itoa(MaxPasswordBytes)+" bytes")
+	}
+	if policy.RequireUpper && !hasUpper {
+		strength.Missing = append(strength.Missing, "incluir una letra mayúscula")
+	}
+	if policy.RequireLower && !hasLower {
+		strength.Missing = append(strength.Missing, "incluir una letra minúscula")
+	}
+	if policy.RequireDigit && !hasDigit {
+		strength.Missing = append(strength.Missing, "incluir un dígito")
+	}
+	if policy.RequireSymbol && !hasSymbol {
+		strength.Missing = append(strength.Missing, "incluir un símbolo")
+	}
+
+	if !strength.Common && len(strength.Missing) == 0 {
+		return nil
+	}
+	return strength
+}
+
+// Conjuntos de caracteres de las contraseñas generadas (sin caracteres ambiguos como 0/O o 1/l)
+const (
+	passwordUpper   = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+	passwordLower   = "abcdefghijkmnopqrstuvwxyz"
+	passwordDigits  = "23456789"
+	passwordSymbols = "!#$%&*+-=?@_"
+)
+
+// generatedPasswordLength es la longitud mínima de las contraseñas generadas
+const generatedPasswordLength = 16
+
+// GeneratePassword genera una contraseña aleatoria que cumple la política: tiene al menos
+// generatedPasswordLength caracteres (o MinLength si es mayor, hasta MaxPasswordBytes) e incluye
+// un carácter de cada tipo, exigido o no. Falla si la política no admite ninguna contraseña (ej.
+// MinLength mayor que MaxPasswordBytes).
+func GeneratePassword(policy PasswordPolicy) (string, error) {
+	length := max(policy.MinLength, generatedPasswordLength)
+	length = min(length, MaxPasswordBytes)
+	all := passwordUpper + passwordLower + passwordDigits + passwordSymbols
+
+	for attempt := 0; attempt < 10; attempt++ {
+		password := make([]byte, 0, length)
+		for _, set := range []string{passwordUpper, passwordLower, passwordDigits, passwordSymbols} {
+			c, err := randomChar(set)
+			if err != nil {
+				return "", err
+			}
+			password = append(password, c)
+		}
+		for len(password) < length {
+			c, err := randomChar(all)
+			if err != nil {
+				return "", err
+			}
+			password = append(password, c)
+		}
+
+		// Mezclar para que los caracteres obligatorios no queden siempre al inicio
+		for i := len(password) - 1; i > 0; i-- {
+			j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+			if err != nil {
+				return "", err
+			}
+			password[i], password[j.Int64()] = password[j.Int64()], password[i]
+		}
+
+		// Solo la lista de bloqueo puede rechazarla; en ese caso se genera otra
+		if ValidatePasswordStrength(string(password), policy) == nil {
+			return string(password), nil
+		}
+	}
+	return "", errors.New("no se pudo generar una contraseña que cumpla la política")
+}
+
+// randomChar elige un carácter aleatorio de set
+func randomChar(set string) (byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(set))))
+	if err != nil {
+		return 0, err
+	}
+	return set[n.Int64()], nil
+}
+
+// isBlockedPassword indica si la contraseña está en CommonPasswords o en blocklist
+func isBlockedPassword(password string, blocklist []string) bool {
+	normalized := strings.ToLower(strings.TrimSpace(password))
+	for _, list := range [][]string{CommonPasswords, blocklist} {
+		for _, blocked := range list {
+			if normalized == strings.ToLower(strings.TrimSpace(blocked)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// joinRequirements une los requisitos como una enumeración ("a, b y c"); antes de una palabra
+// que empieza por "i" se usa "e"
+func joinRequirements(requirements []string) string {
+	if len(requirements) == 1 {
+		return requirements[0]
+	}
+	last := requirements[len(requirements)-1]
+	conjunction := " y "
+	if strings.HasPrefix(last, "i") {
+		conjunction = " e "
+	}
+	return strings.Join(requirements[:len(requirements)-1], ", ") + conjunction + last
+}
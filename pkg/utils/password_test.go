@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatePasswordStrength(t *testing.T) {
+	strict := PasswordPolicy{
+		MinLength:     10,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		Blocklist:     []string{"Empresa2024!"},
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		policy   PasswordPolicy
+		wantErr  string
+	}{
+		{"política por defecto válida", "secreto123", DefaultPasswordPolicy(), ""},
+		{"política por defecto corta", "abc", DefaultPasswordPolicy(), "la contraseña debe tener al menos 6 caracteres"},
+		{"contraseña común", "Password123", DefaultPasswordPolicy(), "la contraseña es demasiado común"},
+		{"cumple la política estricta", "Correcta-2024", strict, ""},
+		{"la longitud cuenta caracteres, no bytes", "ñandú-ÁRBOL1", strict, ""},
+		{"varios requisitos incumplidos", "corta", strict,
+			"la contraseña debe tener al menos 10 caracteres, incluir una letra mayúscula, incluir un dígito e incluir un símbolo"},
+		{"solo falta un símbolo", "Correcta2024", strict, "la contraseña debe incluir un símbolo"},
+		{"lista de bloqueo configurada", "empresa2024!", strict, "la contraseña es demasiado común; la contraseña debe incluir una letra mayúscula"},
+		{"más de 72 bytes", strings.Repeat("ñ", 40), DefaultPasswordPolicy(), "la contraseña debe tener como máximo 72 bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePasswordStrength(tt.password, tt.policy)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.EqualError(t, err, tt.wantErr)
+			assert.ErrorIs(t, err, ErrWeakPassword)
+
+			var strength *PasswordStrengthError
+			assert.True(t, errors.As(err, &strength))
+		})
+	}
+}
+
+func TestGeneratePassword(t *testing.T) {
+	strict := PasswordPolicy{MinLength: 20, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true}
+
+	for _, policy := range []PasswordPolicy{DefaultPasswordPolicy(), strict, {MinLength: MaxPasswordBytes}} {
+		password, err := GeneratePassword(policy)
+		require.NoError(t, err)
+		assert.NoError(t, ValidatePasswordStrength(password, policy))
+		assert.GreaterOrEqual(t, len(password), max(policy.MinLength, 16))
+	}
+
+	t.Run("política imposible", func(t *testing.T) {
+		_, err := GeneratePassword(PasswordPolicy{MinLength: MaxPasswordBytes + 1})
+		assert.Error(t, err)
+	})
+}
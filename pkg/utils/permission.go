@@ -0,0 +1,43 @@
+package utils
+
+import "strings"
+
+// PermissionWildcard es el permiso comodín que concede todos los permisos
+const PermissionWildcard = "*"
+
+// PermissionMatches indica si el permiso concedido granted satisface el permiso requerido.
+// Además de la coincidencia exacta, granted puede ser un comodín: "*" concede cualquier permiso
+// y "module:*" o "module:sub:*" conceden los permisos bajo ese prefijo, siempre en el límite de
+// un segmento ("finanzas:*" concede "finanzas:read" pero no "finanzas" ni "finanzasx:read").
+// Solo granted se interpreta como comodín: un "module:*" requerido exige un comodín igual o más amplio.
+func PermissionMatches(granted, required string) bool {
+	if granted == "" || required == "" {
+		return false
+	}
+	if granted == required || granted == PermissionWildcard {
+		return true
+	}
+
+	prefix, ok := strings.CutSuffix(granted, PermissionWildcard)
+	if !ok || !strings.HasSuffix(prefix, ":") || len(prefix) < 2 {
+		return false
+	}
+	return len(required) > len(prefix) && strings.HasPrefix(required, prefix)
+}
+
+// GrantsModuleAccess indica si permissions incluye algún permiso que comience con "module:" o el
+// comodín global "*"
+func GrantsModuleAccess(permissions []string, module string) bool {
+	if module == "" {
+		return false
+	}
+
+	prefix := module + ":"
+	for _, p := range permissions {
+		if p == PermissionWildcard || strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
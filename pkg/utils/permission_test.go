@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGrantsModuleAccess(t *testing.T) {
+	assert.True(t, GrantsModuleAccess([]string{"finanzas:read"}, "finanzas"))
+	assert.True(t, GrantsModuleAccess([]string{PermissionWildcard}, "finanzas"))
+	assert.False(t, GrantsModuleAccess([]string{"finanzasx:read"}, "finanzas"), "el módulo se compara hasta el separador")
+	assert.False(t, GrantsModuleAccess([]string{PermissionWildcard}, ""))
+	assert.False(t, GrantsModuleAccess(nil, "finanzas"))
+}
+
+func TestPermissionMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		granted  string
+		required string
+		want     bool
+	}{
+		{"coincidencia exacta", "finanzas:read", "finanzas:read", true},
+		{"permiso distinto", "finanzas:read", "finanzas:write", false},
+		{"comodín global", "*", "finanzas:read", true},
+		{"comodín global sin permiso requerido", "*", "", false},
+		{"comodín de módulo", "finanzas:*", "finanzas:read", true},
+		{"comodín de módulo con submódulo", "finanzas:*", "finanzas:reportes:read", true},
+		{"comodín de submódulo", "finanzas:reportes:*", "finanzas:reportes:read", true},
+		{"comodín de submódulo sobre otro submódulo", "finanzas:reportes:*", "finanzas:pagos:read", false},
+		{"comodín de submódulo sobre el módulo", "finanzas:reportes:*", "finanzas:read", false},
+		{"módulo con el mismo prefijo", "finanzas:*", "finanzasx:read", false},
+		{"solo el nombre del módulo", "finanzas:*", "finanzas", false},
+		{"solo el prefijo del módulo", "finanzas:*", "finanzas:", false},
+		{"comodín requerido cubierto por uno más amplio", "finanzas:*", "finanzas:reportes:*", true},
+		{"comodín requerido igual", "finanzas:*", "finanzas:*", true},
+		{"comodín requerido más amplio", "finanzas:read", "finanzas:*", false},
+		{"comodín sin límite de segmento", "fin*", "finanzas:read", false},
+		{"comodín sin módulo", ":*", "finanzas:read", false},
+		{"permiso concedido vacío", "", "finanzas:read", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, PermissionMatches(tt.granted, tt.required))
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+)
+
+// ValidPKCEValue verifica el formato de un code_verifier o code_challenge (RFC 7636):
+// entre 43 y 128 caracteres no reservados [A-Za-z0-9-._~]
+func ValidPKCEValue(value string) bool {
+	if len(value) < 43 || len(value) > 128 {
+		return false
+	}
+	for _, r := range value {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-' || r == '.' || r == '_' || r == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// S256CodeChallenge calcula el code_challenge S256 de un code_verifier:
+// BASE64URL-ENCODE(SHA256(verifier)) sin relleno
+func S256CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyCodeChallenge recalcula el challenge a partir del verifier con el método indicado
+// ("S256" o "plain") y lo compara en tiempo constante
+func VerifyCodeChallenge(challenge, method, verifier string) bool {
+	var computed string
+	switch method {
+	case "S256":
+		computed = S256CodeChallenge(verifier)
+	case "plain":
+		computed = verifier
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
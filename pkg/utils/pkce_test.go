@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Vector de prueba del apéndice B de RFC 7636
+const (
+	rfcCodeVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	rfcCodeChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestS256CodeChallenge(t *testing.T) {
+	assert.Equal(t, rfcCodeChallenge, S256CodeChallenge(rfcCodeVerifier))
+}
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	tests := []struct {
+		name      string
+		challenge string
+		method    string
+		verifier  string
+		want      bool
+	}{
+		{"S256 válido", rfcCodeChallenge, "S256", rfcCodeVerifier, true},
+		{"S256 con verifier distinto", rfcCodeChallenge, "S256", strings.Repeat("a", 43), false},
+		{"plain válido", rfcCodeVerifier, "plain", rfcCodeVerifier, true},
+		{"plain con verifier distinto", rfcCodeVerifier, "plain", rfcCodeChallenge, false},
+		{"método desconocido", rfcCodeVerifier, "S512", rfcCodeVerifier, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, VerifyCodeChallenge(tt.challenge, tt.method, tt.verifier))
+		})
+	}
+}
+
+func TestValidPKCEValue(t *testing.T) {
+	assert.True(t, ValidPKCEValue(rfcCodeVerifier))
+	assert.True(t, ValidPKCEValue(strings.Repeat("a-._~", 26)[:128]))
+	assert.False(t, ValidPKCEValue(strings.Repeat("a", 42)), "muy corto")
+	assert.False(t, ValidPKCEValue(strings.Repeat("a", 129)), "muy largo")
+	assert.False(t, ValidPKCEValue(strings.Repeat("a", 42)+"+"), "carácter no permitido")
+}
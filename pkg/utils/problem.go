@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProblemContentType es el tipo de contenido de los errores en formato RFC 7807
+const ProblemContentType = "application/problem+json"
+
+// ProblemTypePrefix antecede al código del error para formar el campo type de un problema.
+// Los errores sin código usan "about:blank", como indica el RFC 7807.
+const ProblemTypePrefix = "urn:mi-proyecto:error:"
+
+// ErrorFormatContextKey es la clave del contexto de Gin donde se guarda el formato de los errores
+// de la petición (ver ErrorFormatEnvelope y ErrorFormatProblem)
+const ErrorFormatContextKey = "errorFormat"
+
+// Formatos de las respuestas de error
+const (
+	ErrorFormatEnvelope = "envelope" // Response con status "error" (por defecto)
+	ErrorFormatProblem  = "problem"  // application/problem+json (RFC 7807)
+)
+
+// ParseErrorFormat interpreta el formato de error configurado. Valores desconocidos usan el
+// formato envelope.
+func ParseErrorFormat(value string) string {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "problem", "problem+json", "rfc7807":
+		return ErrorFormatProblem
+	default:
+		return ErrorFormatEnvelope
+	}
+}
+
+// ProblemDetails es el cuerpo de un error en formato RFC 7807. Code repite el código estable del
+// error (ej. token_expired) y RequestID el ID de la petición como miembros de extensión.
+type ProblemDetails struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// NewProblemDetails construye el problema para el estado, código y mensaje dados
+func NewProblemDetails(statusCode int, code string, detail string, instance string) ProblemDetails {
+	problemType := "about:blank"
+	if code != "" {
+		problemType = ProblemTypePrefix + code
+	}
+	return ProblemDetails{
+		Type:     problemType,
+		Title:    http.StatusText(statusCode),
+		Status:   statusCode,
+		Detail:   detail,
+		Instance: instance,
+		Code:     code,
+	}
+}
+
+// WantsProblemDetails indica si los errores de la petición deben responderse como problem+json:
+// cuando el formato configurado en el contexto es ErrorFormatProblem o el cliente lo pide en Accept
+func WantsProblemDetails(c *gin.Context) bool {
+	if format, ok := ClaimString(c, ErrorFormatContextKey); ok && format == ErrorFormatProblem {
+		return true
+	}
+	if c.Request == nil {
+		return false
+	}
+
+	for _, accepted := range strings.Split(c.GetHeader("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err == nil && strings.EqualFold(mediaType, ProblemContentType) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProblemResponse envía un error en formato RFC 7807
+func ProblemResponse(c *gin.Context, statusCode int, code string, detail string) {
+	// c.JSON respeta el Content-Type ya establecido
+	c.Header("Content-Type", ProblemContentType+"; charset=utf-8")
+	instance := ""
+	if c.Request != nil {
+		instance = c.Request.URL.Path
+	}
+	problem := NewProblemDetails(statusCode, code, detail, instance)
+	problem.RequestID, _ = ClaimString(c, RequestIDContextKey)
+	c.JSON(statusCode, problem)
+}
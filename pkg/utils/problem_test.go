@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveError ejecuta handler en una ruta de prueba y retorna la respuesta
+func serveError(t *testing.T, format string, accept string, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/recurso", func(c *gin.Context) {
+		if format != "" {
+			c.Set(ErrorFormatContextKey, format)
+		}
+		handler(c)
+	})
+
+	req, _ := http.NewRequest("GET", "/api/recurso", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestErrorResponseProblemDetails(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		accept string
+	}{
+		{name: "formato configurado", format: ErrorFormatProblem},
+		{name: "header Accept", accept: "application/json, application/problem+json;q=0.9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveError(t, tt.format, tt.accept, func(c *gin.Context) {
+				ErrorCodeResponse(c, http.StatusUnauthorized, "token_expired", "El token ha expirado")
+			})
+
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.Equal(t, "application/problem+json; charset=utf-8", w.Header().Get("Content-Type"))
+
+			var body map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, map[string]interface{}{
+				"type":     "urn:mi-proyecto:error:token_expired",
+				"title":    "Unauthorized",
+				"status":   float64(http.StatusUnauthorized),
+				"detail":   "El token ha expirado",
+				"instance": "/api/recurso",
+				"code":     "token_expired",
+			}, body)
+		})
+	}
+
+	t.Run("error sin código", func(t *testing.T) {
+		w := serveError(t, ErrorFormatProblem, "", func(c *gin.Context) {
+			NotFoundResponse(c, "Usuario")
+		})
+
+		var problem ProblemDetails
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+		assert.Equal(t, ProblemDetails{
+			Type:     "about:blank",
+			Title:    "Not Found",
+			Status:   http.StatusNotFound,
+			Detail:   "Usuario no encontrado",
+			Instance: "/api/recurso",
+		}, problem)
+		assert.NotContains(t, w.Body.String(), `"code"`)
+	})
+}
+
+func TestErrorResponseEnvelopeByDefault(t *testing.T) {
+	for _, format := range []string{"", ErrorFormatEnvelope} {
+		w := serveError(t, format, "application/json", func(c *gin.Context) {
+			ErrorCodeResponse(c, http.StatusUnauthorized, "token_expired", "El token ha expirado")
+		})
+
+		assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"status":"error","error":"El token ha expirado","code":"token_expired"}`, w.Body.String())
+	}
+}
+
+func TestErrorResponseIncludesRequestID(t *testing.T) {
+	for _, format := range []string{ErrorFormatEnvelope, ErrorFormatProblem} {
+		t.Run(format, func(t *testing.T) {
+			w := serveError(t, format, "", func(c *gin.Context) {
+				c.Set(RequestIDContextKey, "req-123")
+				InternalErrorResponse(c)
+			})
+
+			var body map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, "req-123", body["request_id"])
+		})
+	}
+}
+
+func TestParseErrorFormat(t *testing.T) {
+	assert.Equal(t, ErrorFormatProblem, ParseErrorFormat(" Problem "))
+	assert.Equal(t, ErrorFormatProblem, ParseErrorFormat("rfc7807"))
+	assert.Equal(t, ErrorFormatEnvelope, ParseErrorFormat("envelope"))
+	assert.Equal(t, ErrorFormatEnvelope, ParseErrorFormat("xml"))
+	assert.Equal(t, ErrorFormatEnvelope, ParseErrorFormat(""))
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SortParam es el parámetro de consulta con el orden del listado: campos separados por coma,
+// con prefijo "-" para orden descendente (ej. sort=name,-created_at)
+const SortParam = "sort"
+
+// ErrInvalidSortField indica que la consulta pide ordenar por un campo no permitido
+var ErrInvalidSortField = errors.New("campo de ordenamiento no permitido")
+
+// QueryConfig declara los campos de un listado que pueden filtrarse y ordenarse
+type QueryConfig struct {
+	Filters     FilterConfig // Campos filtrables (ver BuildMongoFilter)
+	SortFields  []string     // Campos por los que se permite ordenar
+	DefaultSort bson.D       // Orden cuando la consulta no indica sort
+}
+
+// QueryOptions contiene el filtro y el orden de un listado ya validados
+type QueryOptions struct {
+	Filter bson.M
+	Sort   bson.D
+}
+
+// ParseQueryOptions construye el filtro y el orden de un listado a partir de la query. Los
+// filtros no declarados o con valores inválidos se ignoran, como en BuildMongoFilter; un
+// orden por un campo no declarado en SortFields retorna ErrInvalidSortField.
+func ParseQueryOptions(query url.Values, config QueryConfig) (QueryOptions, error) {
+	queryParams := make(map[string]string)
+	for field := range config.Filters {
+		if value := query.Get(field); value != "" {
+			queryParams[field] = value
+		}
+	}
+
+	sort, err := parseSort(query.Get(SortParam), config.SortFields)
+	if err != nil {
+		return QueryOptions{}, err
+	}
+	if len(sort) == 0 {
+		sort = config.DefaultSort
+	}
+
+	return QueryOptions{
+		Filter: BuildMongoFilter(queryParams, config.Filters),
+		Sort:   sort,
+	}, nil
+}
+
+// parseSort interpreta el valor de sort validando cada campo contra la lista permitida
+func parseSort(value string, allowed []string) (bson.D, error) {
+	var sort bson.D
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		direction := 1
+		field := item
+		if strings.HasPrefix(item, "-") {
+			direction = -1
+			field = strings.TrimPrefix(item, "-")
+		}
+
+		if !containsString(allowed, field) {
+			return nil, fmt.Errorf("%w: %q (permitidos: %s)", ErrInvalidSortField, field, strings.Join(allowed, ", "))
+		}
+		if seen[field] {
+			continue
+		}
+		seen[field] = true
+		sort = append(sort, bson.E{Key: field, Value: direction})
+	}
+	return sort, nil
+}
+
+// containsString indica si value está en values
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var testQueryConfig = QueryConfig{
+	Filters: FilterConfig{
+		"status": FilterDefinition{AllowedValues: []string{StatusActive, StatusInactive}},
+	},
+	SortFields:  []string{"name", "created_at"},
+	DefaultSort: bson.D{{Key: "created_at", Value: -1}},
+}
+
+func TestParseQueryOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		filter bson.M
+		sort   bson.D
+	}{
+		{
+			name:   "sin parámetros usa el orden por defecto",
+			filter: bson.M{},
+			sort:   bson.D{{Key: "created_at", Value: -1}},
+		},
+		{
+			name:   "filtro y orden permitidos",
+			query:  "status=inactive&sort=name,-created_at",
+			filter: bson.M{"status": StatusInactive},
+			sort:   bson.D{{Key: "name", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			name:   "los filtros no declarados se ignoran",
+			query:  "password=x&status=otro&sort=name",
+			filter: bson.M{},
+			sort:   bson.D{{Key: "name", Value: 1}},
+		},
+		{
+			name:   "los campos repetidos se ordenan una vez",
+			query:  "sort=-name,name,",
+			filter: bson.M{},
+			sort:   bson.D{{Key: "name", Value: -1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			require.NoError(t, err)
+
+			opts, err := ParseQueryOptions(query, testQueryConfig)
+			require.NoError(t, err)
+			assert.Equal(t, tt.filter, opts.Filter)
+			assert.Equal(t, tt.sort, opts.Sort)
+		})
+	}
+}
+
+func TestParseQueryOptionsRejectsSortFields(t *testing.T) {
+	for _, sort := range []string{"password", "-password", "name,email", "--name"} {
+		t.Run(sort, func(t *testing.T) {
+			_, err := ParseQueryOptions(url.Values{SortParam: {sort}}, testQueryConfig)
+			assert.ErrorIs(t, err, ErrInvalidSortField)
+		})
+	}
+}
@@ -11,7 +11,12 @@ type Response struct {
 	Status  string      `json:"status"`
 	Message string      `json:"message,omitempty"`
 	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	// Pagination describe la página de los listados (PaginationMeta o CursorMeta)
+	Pagination interface{} `json:"pagination,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	Code       string      `json:"code,omitempty"` // Código estable del error (ej. token_expired) para los clientes
+
+	RequestID string `json:"request_id,omitempty"` // ID de la petición en los errores, para rastrearla en los logs
 }
 
 // SuccessResponse envía una respuesta exitosa
@@ -23,25 +28,78 @@ func SuccessResponse(c *gin.Context, statusCode int, message string, data interf
 	})
 }
 
-// ErrorResponse envía una respuesta de error
+// PaginatedResponse envía una respuesta exitosa con la página en data y sus metadatos en
+// pagination ({total, page, limit, total_pages, ...})
+func PaginatedResponse(c *gin.Context, statusCode int, message string, data interface{}, meta PaginationMeta) {
+	c.JSON(statusCode, Response{
+		Status:     "success",
+		Message:    message,
+		Data:       data,
+		Pagination: meta,
+	})
+}
+
+// CursorPaginatedResponse envía una respuesta exitosa con metadatos de paginación por cursor
+// en pagination
+func CursorPaginatedResponse(c *gin.Context, statusCode int, message string, data interface{}, meta CursorMeta) {
+	c.JSON(statusCode, Response{
+		Status:     "success",
+		Message:    message,
+		Data:       data,
+		Pagination: meta,
+	})
+}
+
+// ErrorResponse envía una respuesta de error. Si la petición pide problem+json (ver
+// WantsProblemDetails) se responde en formato RFC 7807.
 func ErrorResponse(c *gin.Context, statusCode int, errorMsg string) {
+	ErrorCodeResponse(c, statusCode, "", errorMsg)
+}
+
+// ErrorCodeResponse envía una respuesta de error con un código que los clientes pueden
+// interpretar sin depender del mensaje. Incluye el ID de la petición si existe en el contexto.
+func ErrorCodeResponse(c *gin.Context, statusCode int, code string, errorMsg string) {
+	if WantsProblemDetails(c) {
+		ProblemResponse(c, statusCode, code, errorMsg)
+		return
+	}
+
+	requestID, _ := ClaimString(c, RequestIDContextKey)
 	c.JSON(statusCode, Response{
-		Status: "error",
-		Error:  errorMsg,
+		Status:    "error",
+		Error:     errorMsg,
+		Code:      code,
+		RequestID: requestID,
 	})
 }
 
-// ValidationErrorResponse envía respuesta de errores de validación
+// ValidationErrorResponse envía respuesta para solicitudes mal formadas (JSON inválido o campos
+// que no cumplen el formato declarado en la solicitud)
 func ValidationErrorResponse(c *gin.Context, errorMsg string) {
 	ErrorResponse(c, http.StatusBadRequest, errorMsg)
 }
 
+// UnprocessableEntityResponse envía respuesta para solicitudes bien formadas que violan
+// una regla de negocio (ej. email duplicado o estado no válido)
+func UnprocessableEntityResponse(c *gin.Context, errorMsg string) {
+	ErrorResponse(c, http.StatusUnprocessableEntity, errorMsg)
+}
+
+// PreconditionFailedResponse envía respuesta cuando una actualización condicional no se aplica
+// porque el recurso cambió desde que el cliente lo leyó
+func PreconditionFailedResponse(c *gin.Context, errorMsg string) {
+	ErrorResponse(c, http.StatusPreconditionFailed, errorMsg)
+}
+
 // NotFoundResponse envía respuesta para recursos no encontrados
 func NotFoundResponse(c *gin.Context, resourceName string) {
 	ErrorResponse(c, http.StatusNotFound, resourceName+" no encontrado")
 }
 
+// InternalErrorMessage es el mensaje que recibe el cliente ante un error interno, sin detalles
+const InternalErrorMessage = "Error interno del servidor"
+
 // InternalErrorResponse envía respuesta para errores internos
 func InternalErrorResponse(c *gin.Context) {
-	ErrorResponse(c, http.StatusInternalServerError, "Error interno del servidor")
+	ErrorResponse(c, http.StatusInternalServerError, InternalErrorMessage)
 }
@@ -0,0 +1,23 @@
+package utils
+
+import "time"
+
+// TimestampLayout es el formato de las fechas en las respuestas: RFC3339 en UTC con
+// precisión fija de milisegundos (la misma que conserva MongoDB)
+const TimestampLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// Timestamp es una fecha de respuesta que se serializa en JSON siempre en UTC con
+// TimestampLayout, sin importar la zona horaria con la que se creó el valor
+type Timestamp struct {
+	time.Time
+}
+
+// NewTimestamp envuelve t para serializarlo con TimestampLayout
+func NewTimestamp(t time.Time) Timestamp {
+	return Timestamp{Time: t}
+}
+
+// MarshalJSON serializa la fecha en UTC con TimestampLayout
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + t.UTC().Format(TimestampLayout) + `"`), nil
+}
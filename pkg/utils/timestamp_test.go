@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimestampMarshalJSON(t *testing.T) {
+	mexico := time.FixedZone("CST", -6*60*60)
+
+	tests := []struct {
+		name string
+		in   time.Time
+		want string
+	}{
+		{"UTC sin fracción", time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), `"2024-03-01T10:00:00.000Z"`},
+		{"zona local se convierte a UTC", time.Date(2024, 3, 1, 4, 0, 0, 0, mexico), `"2024-03-01T10:00:00.000Z"`},
+		{"precisión fija de milisegundos", time.Date(2024, 3, 1, 10, 0, 0, 123_456_789, time.UTC), `"2024-03-01T10:00:00.123Z"`},
+		{"valor cero", time.Time{}, `"0001-01-01T00:00:00.000Z"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(NewTimestamp(tt.in))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(data))
+		})
+	}
+
+	t.Run("con monotonic clock", func(t *testing.T) {
+		data, err := json.Marshal(NewTimestamp(time.Now()))
+		require.NoError(t, err)
+		parsed, err := time.Parse(time.RFC3339, string(data[1:len(data)-1]))
+		require.NoError(t, err)
+		assert.Equal(t, time.UTC, parsed.Location())
+	})
+}
+
+func TestTimestampRoundTrip(t *testing.T) {
+	type response struct {
+		CreatedAt Timestamp `json:"created_at"`
+	}
+	original := response{CreatedAt: NewTimestamp(time.Date(2024, 3, 1, 10, 0, 0, 250_000_000, time.UTC))}
+
+	data, err := json.Marshal(original)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"created_at": "2024-03-01T10:00:00.250Z"}`, string(data))
+
+	var decoded response
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.True(t, original.CreatedAt.Equal(decoded.CreatedAt.Time))
+}
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Parámetros TOTP (RFC 6238) compatibles con las aplicaciones de autenticación habituales
+const (
+	TOTPPeriod = 30 * time.Second
+	TOTPDigits = 6
+	// totpSecretBytes es el tamaño del secreto recomendado para HMAC-SHA1 (160 bits)
+	totpSecretBytes = 20
+)
+
+// totpEncoding es base32 sin relleno, el formato que esperan las aplicaciones de autenticación
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret genera un secreto TOTP aleatorio codificado en base32
+func GenerateTOTPSecret() (string, error) {
+	secret, err := GenerateRandomBytes(totpSecretBytes)
+	if err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPCode calcula el código TOTP del secreto (base32) para el instante indicado
+func TOTPCode(secret string, at time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return "", fmt.Errorf("secreto TOTP inválido: %w", err)
+	}
+	return hotp(key, totpStep(at)), nil
+}
+
+// ValidateTOTP indica si code es el código del secreto para el instante indicado, aceptando
+// hasta window periodos antes y después para tolerar desfases de reloj
+func ValidateTOTP(secret, code string, at time.Time, window int) bool {
+	_, ok := MatchTOTP(secret, code, at, window)
+	return ok
+}
+
+// MatchTOTP es como ValidateTOTP, pero retorna además el periodo al que corresponde el código,
+// para rechazar después un código ya usado (RFC 6238 §5.2)
+func MatchTOTP(secret, code string, at time.Time, window int) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil || len(code) != TOTPDigits {
+		return 0, false
+	}
+
+	step := totpStep(at)
+	for offset := -int64(window); offset <= int64(window); offset++ {
+		if subtle.ConstantTimeCompare([]byte(hotp(key, step+offset)), []byte(code)) == 1 {
+			return step + offset, true
+		}
+	}
+	return 0, false
+}
+
+// TOTPProvisioningURI construye la URI otpauth:// que las aplicaciones de autenticación
+// importan (normalmente como código QR)
+func TOTPProvisioningURI(issuer, account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(TOTPDigits))
+	query.Set("period", fmt.Sprint(int(TOTPPeriod.Seconds())))
+
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// totpStep retorna el número de periodo al que pertenece el instante
+func totpStep(at time.Time) int64 {
+	return at.Unix() / int64(TOTPPeriod.Seconds())
+}
+
+// hotp calcula el código HOTP (RFC 4226) de la clave para el contador indicado
+func hotp(key []byte, counter int64) string {
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	// Truncamiento dinámico
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, value%modulo)
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfc6238Secret es la clave SHA-1 de los vectores de prueba del RFC 6238 ("12345678901234567890")
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// Los vectores del RFC usan 8 dígitos; con 6 se toman los últimos 6
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		code, err := TOTPCode(rfc6238Secret, time.Unix(tt.unix, 0))
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, code, "t=%d", tt.unix)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, err := TOTPCode(rfc6238Secret, now)
+	require.NoError(t, err)
+
+	assert.True(t, ValidateTOTP(rfc6238Secret, code, now, 0))
+
+	// Un periodo después solo se acepta con ventana
+	later := now.Add(TOTPPeriod)
+	assert.False(t, ValidateTOTP(rfc6238Secret, code, later, 0))
+	assert.True(t, ValidateTOTP(rfc6238Secret, code, later, 1))
+	assert.False(t, ValidateTOTP(rfc6238Secret, code, now.Add(2*TOTPPeriod), 1))
+
+	assert.False(t, ValidateTOTP(rfc6238Secret, "000000", now, 1))
+	assert.False(t, ValidateTOTP(rfc6238Secret, "", now, 1))
+	assert.False(t, ValidateTOTP("no-es-base32!", code, now, 1))
+
+	// MatchTOTP informa el periodo del código, no el del instante de validación
+	step, ok := MatchTOTP(rfc6238Secret, code, later, 1)
+	assert.True(t, ok)
+	assert.Equal(t, totpStep(now), step)
+}
+
+func TestTOTPSecretAndProvisioningURI(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	require.NoError(t, err)
+	_, err = TOTPCode(secret, time.Now())
+	require.NoError(t, err)
+
+	uri, err := url.Parse(TOTPProvisioningURI("mi-proyecto", "ana@example.com", secret))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/mi-proyecto:ana@example.com", uri.Path)
+	assert.Equal(t, secret, uri.Query().Get("secret"))
+	assert.Equal(t, "mi-proyecto", uri.Query().Get("issuer"))
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// VersionField es el nombre estándar del campo BSON con la versión de una entidad editable.
+// Cada actualización lo incrementa; las entidades versionadas declaran:
+//
+//	Version int64 `json:"version" bson:"version"`
+const VersionField = "version"
+
+// ErrVersionConflict se retorna cuando la entidad cambió desde la versión que el cliente leyó
+var ErrVersionConflict = errors.New("el recurso fue modificado por otra solicitud; vuelva a obtenerlo e intente de nuevo")
+
+// Precondition agrupa las condiciones opcionales de una actualización concurrente:
+// la versión esperada (campo expected_version) y la cabecera If-Unmodified-Since
+type Precondition struct {
+	ExpectedVersion *int64
+	UnmodifiedSince *time.Time
+}
+
+// Check retorna ErrVersionConflict si la entidad guardada no cumple las condiciones.
+// updatedAt se compara con precisión de segundos, igual que las fechas HTTP.
+func (p Precondition) Check(version int64, updatedAt time.Time) error {
+	if p.ExpectedVersion != nil && *p.ExpectedVersion != version {
+		return ErrVersionConflict
+	}
+	if p.UnmodifiedSince != nil && updatedAt.Truncate(time.Second).After(*p.UnmodifiedSince) {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// ParseIfUnmodifiedSince interpreta la cabecera If-Unmodified-Since; vacía retorna nil
+func ParseIfUnmodifiedSince(header string) (*time.Time, error) {
+	if header == "" {
+		return nil, nil
+	}
+	t, err := http.ParseTime(header)
+	if err != nil {
+		return nil, errors.New("cabecera If-Unmodified-Since inválida")
+	}
+	return &t, nil
+}
+
+// VersionFilter retorna la condición de filtro sobre VersionField para una actualización
+// condicional. Los documentos creados antes de versionar no tienen el campo y equivalen a 0.
+func VersionFilter(version int64) interface{} {
+	if version == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
+	}
+	return version
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreconditionCheck(t *testing.T) {
+	updatedAt := time.Date(2024, 3, 1, 10, 0, 0, 500_000_000, time.UTC)
+	version := func(v int64) *int64 { return &v }
+	at := func(t time.Time) *time.Time { return &t }
+
+	tests := []struct {
+		name         string
+		precondition Precondition
+		wantConflict bool
+	}{
+		{"sin condiciones", Precondition{}, false},
+		{"versión vigente", Precondition{ExpectedVersion: version(3)}, false},
+		{"versión desactualizada", Precondition{ExpectedVersion: version(2)}, true},
+		{"misma fecha con precisión de segundos", Precondition{UnmodifiedSince: at(updatedAt.Truncate(time.Second))}, false},
+		{"modificado después de la fecha", Precondition{UnmodifiedSince: at(updatedAt.Add(-time.Minute))}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.precondition.Check(3, updatedAt)
+			if tt.wantConflict {
+				assert.ErrorIs(t, err, ErrVersionConflict)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestParseIfUnmodifiedSince(t *testing.T) {
+	since, err := ParseIfUnmodifiedSince("")
+	require.NoError(t, err)
+	assert.Nil(t, since)
+
+	expected := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	since, err = ParseIfUnmodifiedSince(expected.Format(http.TimeFormat))
+	require.NoError(t, err)
+	assert.True(t, since.Equal(expected))
+
+	_, err = ParseIfUnmodifiedSince("ayer")
+	assert.Error(t, err)
+}
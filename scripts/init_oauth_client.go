@@ -46,12 +46,18 @@ func main() {
 		log.Fatalf("Error al generar client_secret: %v", err)
 	}
 
+	// Solo se guarda el hash del secreto; se muestra una única vez al final
+	hashedSecret, err := utils.HashPassword(clientSecret)
+	if err != nil {
+		log.Fatalf("Error al hashear client_secret: %v", err)
+	}
+
 	// Crear cliente OAuth
 	now := time.Now()
 	oauthClient := domain.Client{
 		ID:           primitive.NewObjectID(),
 		ClientID:     clientID,
-		ClientSecret: clientSecret,
+		ClientSecret: hashedSecret,
 		Name:         "Cliente de prueba",
 		RedirectURIs: []string{"http://localhost:3000/callback"},
 		GrantTypes:   []string{domain.GrantTypePassword, domain.GrantTypeRefreshToken, domain.GrantTypeClientCredentials},
@@ -12,14 +12,17 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 
 	// Dominios
+	auditDomain "github.com/black4ninja/mi-proyecto/internal/audit/domain"
 	permDomain "github.com/black4ninja/mi-proyecto/internal/permission/domain"
 	userDomain "github.com/black4ninja/mi-proyecto/internal/user/domain"
 
 	// Repositorios
+	auditRepo "github.com/black4ninja/mi-proyecto/internal/audit/repository"
 	permRepo "github.com/black4ninja/mi-proyecto/internal/permission/repository"
 	userRepo "github.com/black4ninja/mi-proyecto/internal/user/repository"
 
 	// Casos de uso
+	auditUseCase "github.com/black4ninja/mi-proyecto/internal/audit/usecase"
 	permUseCase "github.com/black4ninja/mi-proyecto/internal/permission/usecase"
 	userUseCase "github.com/black4ninja/mi-proyecto/internal/user/usecase"
 )
@@ -50,26 +53,46 @@ func main() {
 	roleCollection := client.Database(mongoDBName).Collection("roles")
 	userCollection := client.Database(mongoDBName).Collection("users")
 	userRoleCollection := client.Database(mongoDBName).Collection("user_roles")
+	auditLogCollection := client.Database(mongoDBName).Collection("audit_logs")
 
 	permissionRepository := permRepo.NewMongoPermissionRepository(permissionCollection)
 	roleRepository := permRepo.NewMongoRoleRepository(roleCollection)
 	userRepository := userRepo.NewMongoUserRepository(userCollection)
-	userRoleRepository := permRepo.NewMongoUserRoleRepository(userRoleCollection, roleRepository)
+	userRoleRepository := permRepo.NewMongoUserRoleRepository(userRoleCollection, roleRepository, false)
+	if err := permRepo.EnsureUserRoleIndexes(userRoleCollection); err != nil {
+		log.Printf("No se pudo crear el índice único de asignaciones de rol por usuario: %v", err)
+	}
+	auditLogRepository := auditRepo.NewMongoAuditLogRepository(auditLogCollection)
+
+	// Los cambios de este script se registran en la auditoría con el actor "system"
+	auditLogService := auditUseCase.NewAuditLogUseCase(auditLogRepository)
+	recorder := permDomain.PermissionChangeRecorderFunc(func(change *permDomain.PermissionChange) error {
+		return auditLogService.Record(&auditDomain.AuditLog{
+			ActorID: change.ActorID,
+			Action:  change.Action,
+			Target:  change.Target,
+			Details: change.Details,
+		})
+	})
+	permissionChanges := permUseCase.WithChangeRecorder(recorder)
 
 	// Inicializar casos de uso
-	permissionService := permUseCase.NewPermissionUseCase(permissionRepository, userRoleRepository)
-	roleService := permUseCase.NewRoleUseCase(roleRepository, permissionRepository)
-	userService := userUseCase.NewUserUseCase(userRepository)
-	userRoleService := permUseCase.NewUserRoleUseCase(userRoleRepository, roleRepository, permissionRepository)
+	permissionService := permUseCase.NewPermissionUseCase(permissionRepository, userRoleRepository,
+		permRepo.NewMongoPermissionRenameRepository(permissionCollection, roleCollection, userRoleCollection),
+		permRepo.NewMongoPermissionReferenceRepository(permissionCollection, roleCollection, userRoleCollection),
+		permissionChanges)
+	roleService := permUseCase.NewRoleUseCase(roleRepository, permissionRepository, userRoleRepository, permDomain.RoleDeleteCleanup, permissionChanges)
+	userRoleService := permUseCase.NewUserRoleUseCase(userRoleRepository, roleRepository, permissionRepository, permissionChanges)
+	userService := userUseCase.NewUserUseCase(userRepository, userUseCase.WithRoleInitializer(userRoleService))
 
 	// Inicializar permisos y roles
 	log.Println("Iniciando creación de permisos y roles predeterminados...")
-	initializeDefaultPermissionsAndRoles(permissionService, roleService)
+	initializeDefaultPermissionsAndRoles(permissionService, roleService, recorder)
 	log.Println("Permisos y roles predeterminados creados correctamente")
 
 	// Crear usuario administrador
 	log.Println("Iniciando creación de usuario administrador predeterminado...")
-	createDefaultAdminUser(userService, roleService, userRoleService)
+	createDefaultAdminUser(userService, roleService, userRoleService, recorder)
 	log.Println("Usuario administrador predeterminado creado correctamente")
 }
 
@@ -77,27 +100,32 @@ func main() {
 func initializeDefaultPermissionsAndRoles(
 	permissionService permDomain.PermissionUseCase,
 	roleService permDomain.RoleUseCase,
+	recorder permDomain.PermissionChangeRecorder,
 ) {
 	// Crear permisos administrativos
-	createDefaultPermission(permissionService, "admin:permissions", "admin", "permissions", "Administrar permisos", "Permite administrar permisos y roles")
-	createDefaultPermission(permissionService, "admin:users", "admin", "users", "Administrar usuarios", "Permite administrar usuarios")
-	createDefaultPermission(permissionService, "admin:dashboard", "admin", "dashboard", "Dashboard administrativo", "Acceso al dashboard administrativo")
-	createDefaultPermission(permissionService, "admin:data:import", "admin", "data:import", "Importar datos", "Permite importar datos")
-	createDefaultPermission(permissionService, "admin:data:modify", "admin", "data:modify", "Modificar datos", "Permite modificar datos del sistema")
+	createDefaultPermission(permissionService, recorder, "admin:permissions", "admin", "permissions", "Administrar permisos", "Permite administrar permisos y roles")
+	createDefaultPermission(permissionService, recorder, "admin:users", "admin", "users", "Administrar usuarios", "Permite administrar usuarios")
+	createDefaultPermission(permissionService, recorder, "admin:tokens", "admin", "tokens", "Administrar tokens", "Permite expirar tokens de acceso")
+	createDefaultPermission(permissionService, recorder, "admin:clients", "admin", "clients", "Administrar clientes OAuth", "Permite registrar, modificar y eliminar clientes OAuth")
+	createDefaultPermission(permissionService, recorder, "admin:api-keys", "admin", "api-keys", "Administrar API keys", "Permite generar y revocar API keys de servicio")
+	createDefaultPermission(permissionService, recorder, "admin:audit", "admin", "audit", "Auditoría", "Permite consultar y exportar el registro de auditoría")
+	createDefaultPermission(permissionService, recorder, "admin:dashboard", "admin", "dashboard", "Dashboard administrativo", "Acceso al dashboard administrativo")
+	createDefaultPermission(permissionService, recorder, "admin:data:import", "admin", "data:import", "Importar datos", "Permite importar datos")
+	createDefaultPermission(permissionService, recorder, "admin:data:modify", "admin", "data:modify", "Modificar datos", "Permite modificar datos del sistema")
 
 	// Crear permisos de módulo financiero
-	createDefaultPermission(permissionService, "finanzas:read", "finanzas", "read", "Ver finanzas", "Acceso de lectura al módulo financiero")
-	createDefaultPermission(permissionService, "finanzas:write", "finanzas", "write", "Editar finanzas", "Permite crear y editar datos financieros")
-	createDefaultPermission(permissionService, "finanzas:reports:read", "finanzas", "reports:read", "Ver reportes financieros", "Acceso a reportes financieros")
-	createDefaultPermission(permissionService, "finanzas:reports:export", "finanzas", "reports:export", "Exportar reportes", "Permite exportar reportes financieros")
-	createDefaultPermission(permissionService, "finanzas:transactions:write", "finanzas", "transactions:write", "Crear transacciones", "Permite crear transacciones financieras")
-	createDefaultPermission(permissionService, "finanzas:dashboard", "finanzas", "dashboard", "Dashboard financiero", "Acceso al dashboard financiero")
+	createDefaultPermission(permissionService, recorder, "finanzas:read", "finanzas", "read", "Ver finanzas", "Acceso de lectura al módulo financiero")
+	createDefaultPermission(permissionService, recorder, "finanzas:write", "finanzas", "write", "Editar finanzas", "Permite crear y editar datos financieros")
+	createDefaultPermission(permissionService, recorder, "finanzas:reports:read", "finanzas", "reports:read", "Ver reportes financieros", "Acceso a reportes financieros")
+	createDefaultPermission(permissionService, recorder, "finanzas:reports:export", "finanzas", "reports:export", "Exportar reportes", "Permite exportar reportes financieros")
+	createDefaultPermission(permissionService, recorder, "finanzas:transactions:write", "finanzas", "transactions:write", "Crear transacciones", "Permite crear transacciones financieras")
+	createDefaultPermission(permissionService, recorder, "finanzas:dashboard", "finanzas", "dashboard", "Dashboard financiero", "Acceso al dashboard financiero")
 
 	// Crear permisos de módulo inventario
-	createDefaultPermission(permissionService, "inventario:read", "inventario", "read", "Ver inventario", "Acceso de lectura al módulo de inventario")
-	createDefaultPermission(permissionService, "inventario:write", "inventario", "write", "Editar inventario", "Permite crear y editar elementos del inventario")
-	createDefaultPermission(permissionService, "inventario:reports", "inventario", "reports", "Reportes de inventario", "Acceso a reportes de inventario")
-	createDefaultPermission(permissionService, "inventario:dashboard", "inventario", "dashboard", "Dashboard inventario", "Acceso al dashboard de inventario")
+	createDefaultPermission(permissionService, recorder, "inventario:read", "inventario", "read", "Ver inventario", "Acceso de lectura al módulo de inventario")
+	createDefaultPermission(permissionService, recorder, "inventario:write", "inventario", "write", "Editar inventario", "Permite crear y editar elementos del inventario")
+	createDefaultPermission(permissionService, recorder, "inventario:reports", "inventario", "reports", "Reportes de inventario", "Acceso a reportes de inventario")
+	createDefaultPermission(permissionService, recorder, "inventario:dashboard", "inventario", "dashboard", "Dashboard inventario", "Acceso al dashboard de inventario")
 
 	// Crear roles predeterminados
 
@@ -105,6 +133,10 @@ func initializeDefaultPermissionsAndRoles(
 	adminPerms := []string{
 		"admin:permissions",
 		"admin:users",
+		"admin:tokens",
+		"admin:clients",
+		"admin:api-keys",
+		"admin:audit",
 		"admin:dashboard",
 		"admin:data:import",
 		"admin:data:modify",
@@ -120,7 +152,7 @@ func initializeDefaultPermissionsAndRoles(
 		"inventario:dashboard",
 	}
 
-	createDefaultRole(roleService, "Administrador", "Acceso completo al sistema", adminPerms)
+	createDefaultRole(roleService, recorder, "Administrador", "Acceso completo al sistema", adminPerms)
 
 	// Rol de gerente financiero
 	finanzasPerms := []string{
@@ -132,7 +164,7 @@ func initializeDefaultPermissionsAndRoles(
 		"finanzas:dashboard",
 	}
 
-	createDefaultRole(roleService, "Gerente Financiero", "Gestión del módulo financiero", finanzasPerms)
+	createDefaultRole(roleService, recorder, "Gerente Financiero", "Gestión del módulo financiero", finanzasPerms)
 
 	// Rol de analista financiero
 	analistaPerms := []string{
@@ -141,7 +173,7 @@ func initializeDefaultPermissionsAndRoles(
 		"finanzas:dashboard",
 	}
 
-	createDefaultRole(roleService, "Analista Financiero", "Visualización de datos financieros", analistaPerms)
+	createDefaultRole(roleService, recorder, "Analista Financiero", "Visualización de datos financieros", analistaPerms)
 
 	// Rol de gerente de inventario
 	inventarioPerms := []string{
@@ -151,12 +183,13 @@ func initializeDefaultPermissionsAndRoles(
 		"inventario:dashboard",
 	}
 
-	createDefaultRole(roleService, "Gerente de Inventario", "Gestión del inventario", inventarioPerms)
+	createDefaultRole(roleService, recorder, "Gerente de Inventario", "Gestión del inventario", inventarioPerms)
 }
 
 // createDefaultPermission crea un permiso si no existe
 func createDefaultPermission(
 	permissionService permDomain.PermissionUseCase,
+	recorder permDomain.PermissionChangeRecorder,
 	code, module, action, name, description string,
 ) {
 	// Verificar si ya existe
@@ -166,18 +199,24 @@ func createDefaultPermission(
 	}
 
 	// Crear permiso
-	permissionService.CreatePermission(&permDomain.CreatePermissionRequest{
+	_, err = permissionService.CreatePermission(nil, &permDomain.CreatePermissionRequest{
 		Code:        code,
 		Module:      module,
 		Action:      action,
 		Name:        name,
 		Description: description,
 	})
+	if err != nil {
+		log.Printf("Error al crear permiso %s: %v", code, err)
+		return
+	}
+	recordInitChange(recorder, permDomain.ChangePermissionCreate, "permission:"+code, "")
 }
 
 // createDefaultRole crea un rol si no existe
 func createDefaultRole(
 	roleService permDomain.RoleUseCase,
+	recorder permDomain.PermissionChangeRecorder,
 	name, description string,
 	permissions []string,
 ) {
@@ -188,11 +227,16 @@ func createDefaultRole(
 	}
 
 	// Crear rol
-	roleService.CreateRole(&permDomain.CreateRoleRequest{
+	role, err := roleService.CreateRole(nil, &permDomain.CreateRoleRequest{
 		Name:        name,
 		Description: description,
 		Permissions: permissions,
 	})
+	if err != nil {
+		log.Printf("Error al crear rol %s: %v", name, err)
+		return
+	}
+	recordInitChange(recorder, permDomain.ChangeRoleCreate, "role:"+role.ID, "")
 }
 
 // createDefaultAdminUser crea un usuario administrador si no existe
@@ -200,6 +244,7 @@ func createDefaultAdminUser(
 	userService userDomain.UserUseCase,
 	roleService permDomain.RoleUseCase,
 	userRoleService permDomain.UserRoleUseCase,
+	recorder permDomain.PermissionChangeRecorder,
 ) {
 	// Configuración del usuario admin predeterminado
 	adminEmail := getEnvPerms("DEFAULT_ADMIN_EMAIL", "admin@sistema.com")
@@ -225,15 +270,16 @@ func createDefaultAdminUser(
 		}
 
 		// Asignar el rol al usuario existente
-		err = userRoleService.AssignRoleToUser(&permDomain.AssignRoleRequest{
+		err = userRoleService.AssignRoleToUser(nil, &permDomain.AssignRoleRequest{
 			UserID: existingUser.ID.Hex(),
 			RoleID: adminRole.ID,
 		})
 		if err != nil {
 			log.Printf("Error al asignar rol admin: %v", err)
-		} else {
-			log.Println("Rol de administrador asignado correctamente al usuario existente")
+			return
 		}
+		recordInitChange(recorder, permDomain.ChangeRoleAssign, "user:"+existingUser.ID.Hex(), "role="+adminRole.ID)
+		log.Println("Rol de administrador asignado correctamente al usuario existente")
 
 		return
 	}
@@ -258,7 +304,7 @@ func createDefaultAdminUser(
 	}
 
 	// Asignar el rol al usuario
-	err = userRoleService.AssignRoleToUser(&permDomain.AssignRoleRequest{
+	err = userRoleService.AssignRoleToUser(nil, &permDomain.AssignRoleRequest{
 		UserID: adminUser.ID,
 		RoleID: adminRole.ID,
 	})
@@ -266,11 +312,26 @@ func createDefaultAdminUser(
 		log.Printf("Error al asignar rol admin: %v", err)
 		return
 	}
+	recordInitChange(recorder, permDomain.ChangeRoleAssign, "user:"+adminUser.ID, "role="+adminRole.ID)
 
 	log.Printf("Usuario administrador creado con éxito: %s", adminEmail)
 	log.Printf("Contraseña: %s (cámbiala después de iniciar sesión)", adminPassword)
 }
 
+// recordInitChange registra en la auditoría un cambio aplicado por este script. Si el registro
+// falla se detiene: el cambio ya se aplicó y debe revisarse a mano antes de volver a ejecutarlo.
+func recordInitChange(recorder permDomain.PermissionChangeRecorder, action, target, details string) {
+	err := recorder.RecordPermissionChange(&permDomain.PermissionChange{
+		ActorID: permDomain.SystemActor,
+		Action:  action,
+		Target:  target,
+		Details: details,
+	})
+	if err != nil {
+		log.Fatalf("Error al registrar en la auditoría action=%s target=%s: %v", action, target, err)
+	}
+}
+
 // getEnv obtiene una variable de entorno o retorna un valor por defecto
 func getEnvPerms(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists && value != "" {